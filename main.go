@@ -32,18 +32,22 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/grycap/oscar/v4/pkg/backends"
+	"github.com/grycap/oscar/v4/pkg/controller"
 	"github.com/grycap/oscar/v4/pkg/handlers"
 	"github.com/grycap/oscar/v4/pkg/handlers/buckets"
 	"github.com/grycap/oscar/v4/pkg/metrics"
 	"github.com/grycap/oscar/v4/pkg/resourcemanager"
 	"github.com/grycap/oscar/v4/pkg/types"
+	"github.com/grycap/oscar/v4/pkg/utils"
 	"github.com/grycap/oscar/v4/pkg/utils/auth"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	versioned "k8s.io/metrics/pkg/client/clientset/versioned/typed/metrics/v1beta1"
@@ -96,6 +100,64 @@ func main() {
 		go resourcemanager.StartReScheduler(cfg, back, kubeClientset)
 	}
 
+	// Prepare the OSCARService controller if enabled
+	var serviceController *controller.Controller
+	if cfg.ServiceControllerEnable {
+		dynamicClient, err := dynamic.NewForConfig(kubeConfig)
+		if err != nil {
+			log.Fatal(err)
+		}
+		serviceController = controller.NewController(dynamicClient, cfg.ServicesNamespace, handlers.MakeServiceApplier(cfg, back), cfg.ServiceControllerResync)
+	}
+
+	// Prepare the watcher of the finished jobs
+	jobWatcher := controller.NewJobWatcher(kubeClientset, cfg.JobWatcherResync)
+	jobArchive := utils.MakeJobArchive(cfg)
+	if jobArchive != nil {
+		if err := jobArchive.Init(context.Background()); err != nil {
+			log.Fatal(err)
+		}
+		jobWatcher.AddHandler("archive", handlers.MakeJobArchiver(kubeClientset, jobArchive))
+	}
+	if cfg.EventSizeThreshold > 0 && cfg.MinIOProvider != nil {
+		if err := utils.EnsureEventBucket(context.Background(), cfg); err != nil {
+			log.Printf("Error preparing the bucket of the large events: %v", err)
+		}
+	}
+	if cfg.CloudEventsSink != "" {
+		jobWatcher.AddHandler("cloudevents", handlers.MakeJobCloudEventEmitter(cfg, kubeClientset))
+	}
+	if cfg.JobCallbacksEnable {
+		jobWatcher.AddHandler("callbacks", handlers.MakeJobCallbackNotifier(cfg, back, kubeClientset))
+	}
+	jobWatcher.AddHandler("fanout", handlers.MakeFanoutJobCounter(kubeClientset))
+
+	// Prepare the releaser of the jobs held by the max_concurrent_jobs limit of their services
+	heldJobReleaser := controller.NewHeldJobReleaser(kubeClientset, cfg.JobWatcherResync, handlers.MakeHeldJobReleaser(cfg, kubeClientset, back))
+
+	// The controllers must run in a single replica of the manager
+	runControllers := func(ctx context.Context) {
+		if serviceController != nil {
+			go serviceController.Run(ctx)
+		}
+		if jobArchive != nil {
+			go utils.StartJobArchivePruner(ctx, jobArchive, cfg.JobArchiveRetention)
+		}
+		// The events stored in MinIO are kept while their jobs exist, so they can be rerun
+		if cfg.EventSizeThreshold > 0 && cfg.MinIOProvider != nil {
+			go utils.StartJobEventPruner(ctx, cfg, kubeClientset)
+		}
+		go jobWatcher.Run(ctx)
+		go heldJobReleaser.Run(ctx)
+		// The submissions of the fan-out runs are not resumed when the manager restarts
+		go utils.StartFanoutRunMonitor(ctx, kubeClientset)
+	}
+	if cfg.LeaderElectionEnable {
+		go controller.RunLeaderElection(context.Background(), kubeClientset, cfg.Namespace, runControllers)
+	} else {
+		runControllers(context.Background())
+	}
+
 	//Create quotaBackend
 	var qb *types.QuotaBackend
 	if cfg.KueueEnable {
@@ -118,7 +180,8 @@ func main() {
 	// r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
 	// Define system group with basic auth middleware
-	system := r.Group("/system", auth.GetAuthMiddleware(cfg, kubeClientset))
+	authMiddleware := auth.GetAuthMiddleware(cfg, kubeClientset)
+	system := r.Group("/system", authMiddleware)
 
 	// Config path
 	system.GET("/config", handlers.MakeConfigHandler(cfg, kubeClientset))
@@ -133,7 +196,22 @@ func main() {
 	system.POST("/services/:serviceName/stop", handlers.MakeStopExposedServiceHandler(back, kubeClientset, cfg))
 	system.POST("/services/:serviceName/start", handlers.MakeStartExposedServiceHandler(back, kubeClientset, cfg))
 	system.POST("/services/:serviceName/restart", handlers.MakeRestartExposedServiceHandler(back, kubeClientset, cfg))
+	system.GET("/services/:serviceName/revisions", handlers.MakeListServiceRevisionsHandler(back, kubeClientset, cfg))
+	system.GET("/services/:serviceName/revisions/:revision", handlers.MakeReadServiceRevisionHandler(back, kubeClientset, cfg))
+	system.GET("/services/:serviceName/schedule", handlers.MakeReadScheduleHandler(back, kubeClientset, cfg))
+	system.POST("/services/:serviceName/rollback", handlers.MakeRollbackServiceHandler(back, kubeClientset, cfg))
+	system.POST("/services/:serviceName/fanout", handlers.MakeFanoutHandler(cfg, kubeClientset, back))
+	system.GET("/services/:serviceName/fanout", handlers.MakeListFanoutRunsHandler(cfg, kubeClientset, back))
+	system.GET("/services/:serviceName/fanout/:runName", handlers.MakeReadFanoutRunHandler(cfg, kubeClientset, back))
+	system.POST("/services/:serviceName/fanout/:runName/cancel", handlers.MakeCancelFanoutRunHandler(cfg, kubeClientset, back))
+	system.GET("/services/:serviceName/tokens", handlers.MakeListServiceTokensHandler(back, kubeClientset))
+	system.POST("/services/:serviceName/tokens", handlers.MakeCreateServiceTokenHandler(back, kubeClientset))
+	system.POST("/services/:serviceName/tokens/rotate", handlers.MakeRotateServiceTokenHandler(cfg, back, kubeClientset))
+	system.DELETE("/services/:serviceName/tokens/:tokenID", handlers.MakeDeleteServiceTokenHandler(back, kubeClientset))
+	system.GET("/services/:serviceName/acl", handlers.MakeReadServiceACLHandler(back))
+	system.PUT("/services/:serviceName/acl", handlers.MakeUpdateServiceACLHandler(cfg, back))
 	system.PUT("/services", handlers.MakeUpdateHandler(cfg, back))
+	system.POST("/apply", handlers.MakeApplyHandler(cfg, back))
 	system.DELETE("/services/:serviceName", handlers.MakeDeleteHandler(cfg, back))
 
 	// CRUD Replicas (federation)
@@ -157,12 +235,24 @@ func main() {
 	system.DELETE("/buckets/:bucket", buckets.MakeDeleteHandler(cfg))
 	system.POST("/buckets/:bucket/presign", buckets.MakePresignHandler(cfg))
 
-	// Logs paths
+	// Logs paths, the jobs and logs of a service can also be read with its tokens with the read-logs scope
+	readLogsAuth := auth.BuildScopedServiceTokenMiddlewareChain(back, authMiddleware, types.ServiceTokenScopeReadLogs)
 	system.GET("/logs", handlers.MakeGetSystemLogsHandler(kubeClientset, cfg))
-	system.GET("/logs/:serviceName", handlers.MakeJobsInfoHandler(back, kubeClientset, cfg))
+	r.GET("/system/logs/:serviceName", append(readLogsAuth, handlers.MakeJobsInfoHandler(back, kubeClientset, cfg))...)
 	system.DELETE("/logs/:serviceName", handlers.MakeDeleteJobsHandler(back, kubeClientset, cfg))
-	system.GET("/logs/:serviceName/:jobName", handlers.MakeGetLogsHandler(back, kubeClientset, cfg))
+	r.GET("/system/logs/:serviceName/:jobName", append(readLogsAuth, handlers.MakeGetLogsHandler(back, kubeClientset, cfg))...)
+	r.GET("/system/logs/:serviceName/:jobName/status", append(readLogsAuth, handlers.MakeJobStatusHandler(back, kubeClientset, cfg))...)
+	r.GET("/system/logs/:serviceName/:jobName/wait", append(readLogsAuth, handlers.MakeJobWaitHandler(back, kubeClientset, cfg))...)
 	system.DELETE("/logs/:serviceName/:jobName", handlers.MakeDeleteJobHandler(back, kubeClientset, cfg))
+	system.POST("/logs/:serviceName/:jobName/cancel", handlers.MakeCancelJobHandler(back, kubeClientset, cfg))
+	system.POST("/logs/:serviceName/:jobName/suspend", handlers.MakeSuspendJobHandler(back, kubeClientset, cfg))
+	system.POST("/logs/:serviceName/:jobName/resume", handlers.MakeResumeJobHandler(back, kubeClientset, cfg))
+	system.POST("/logs/:serviceName/:jobName/rerun", handlers.MakeRerunJobHandler(cfg, kubeClientset, back, resMan))
+
+	// Personal access tokens paths
+	system.POST("/tokens", handlers.MakeCreatePersonalTokenHandler(cfg, kubeClientset))
+	system.GET("/tokens", handlers.MakeListPersonalTokensHandler(cfg, kubeClientset))
+	system.DELETE("/tokens/:tokenID", handlers.MakeDeletePersonalTokenHandler(cfg, kubeClientset))
 
 	// Status path for cluster status (Memory and CPU) checks
 	system.GET("/status", handlers.MakeStatusHandler(cfg, kubeClientset, metricsClientset))
@@ -182,6 +272,7 @@ func main() {
 	}
 	// Job path for async invocations
 	r.POST("/job/:serviceName", auth.GetLoggerMiddleware(), handlers.MakeJobHandler(cfg, kubeClientset, back, resMan))
+	r.POST("/job/:serviceName/batch", auth.GetLoggerMiddleware(), handlers.MakeJobBatchHandler(cfg, kubeClientset, back, resMan))
 
 	// Service path for sync invocations (only if ServerlessBackend is enabled)
 	syncBack, ok := back.(types.SyncBackend)
@@ -55,6 +55,7 @@ func MakeFakeBackend() *FakeBackend {
 			"ReadService":        {},
 			"UpdateService":      {},
 			"DeleteService":      {},
+			"PlanService":        {},
 		},
 		kubeClientset: testclient.NewSimpleClientset(),
 	}
@@ -138,6 +139,13 @@ func (f *FakeBackend) DeleteService(service types.Service) error {
 	return f.returnError(getCurrentFuncName())
 }
 
+// PlanService renders a minimal plan with the service's podTemplate (fake)
+func (f *FakeBackend) PlanService(service types.Service) (*types.ServicePlan, error) {
+	plan := &types.ServicePlan{Service: service.Name, Namespace: service.Namespace}
+	plan.AddResource("PodTemplate", service.Name, service.Namespace, nil)
+	return plan, f.returnError(getCurrentFuncName())
+}
+
 // GetKubeClientset returns the Kubernetes Clientset (fake)
 func (f *FakeBackend) GetKubeClientset() kubernetes.Interface {
 	if f.kubeClientset == nil {
@@ -21,6 +21,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"slices"
 	"strings"
 
 	"github.com/goccy/go-yaml"
@@ -303,6 +304,49 @@ func (k *KubeBackend) UpdateService(service types.Service) error {
 	return nil
 }
 
+// PlanService renders the objects that CreateService would create without touching the cluster
+func (k *KubeBackend) PlanService(service types.Service) (*types.ServicePlan, error) {
+	namespace := service.Namespace
+	if namespace == "" {
+		namespace = k.config.ServicesNamespace
+	}
+	plan := &types.ServicePlan{Service: service.Name, Namespace: namespace}
+
+	// Check if there is some user defined settings for OSCAR
+	plan.AddError(checkAdditionalConfig(ConfigMapNameOSCAR, k.config.ServicesNamespace, service, k.config, k.kubeClientset))
+
+	fdlService := service
+	cm, err := getServiceConfigMapSpec(&fdlService, namespace)
+	if err != nil {
+		return nil, err
+	}
+	plan.AddResource("ConfigMap", cm.Name, namespace, cm)
+
+	podSpec, err := service.ToPodSpec(k.config)
+	if err != nil {
+		plan.AddError(err)
+	} else {
+		podTemplate := &v1.PodTemplate{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        service.Name,
+				Namespace:   namespace,
+				Labels:      service.Labels,
+				Annotations: service.Annotations,
+			},
+			Template: v1.PodTemplateSpec{
+				Spec: *podSpec,
+			},
+		}
+		plan.AddResource("PodTemplate", podTemplate.Name, namespace, podTemplate)
+	}
+
+	if len(service.Expose.APIPort) > 0 && service.Expose.APIPort[0] != 0 {
+		resources.PlanExpose(service, namespace, k.config, plan)
+	}
+
+	return plan, nil
+}
+
 // DeleteService deletes a service
 func (k *KubeBackend) DeleteService(service types.Service) error {
 	name := service.Name
@@ -426,44 +470,29 @@ func checkAdditionalConfig(configName string, configNamespace string, service ty
 	}
 
 	if len(air) > 0 {
-		for _, prefix := range air {
-			if strings.Contains(service.Image, prefix) {
-				return nil
+		// The init containers and sidecars run in the same pods, so their images are restricted too
+		images := []string{service.Image}
+		for _, container := range slices.Concat(service.InitContainers, service.Sidecars) {
+			images = append(images, container.Image)
+		}
+		for _, image := range images {
+			allowed := slices.ContainsFunc(air, func(prefix string) bool {
+				return strings.Contains(image, prefix)
+			})
+			if !allowed {
+				return fmt.Errorf("image %s is not allowed for pull on the cluster. Check the additional configuration file on '%s'", image, cfg.AdditionalConfigPath)
 			}
 		}
-		return fmt.Errorf("image %s is not allowed for pull on the cluster. Check the additional configuration file on '%s'", service.Image, cfg.AdditionalConfigPath)
 	}
 
 	return nil
 }
 
 func createServiceConfigMap(service *types.Service, namespace string, kubeClientset kubernetes.Interface) error {
-	// Copy script from service
-	script := service.Script
-
-	// Clear script from YAML
-	service.Script = ""
-
-	// Create FDL YAML
-	fdl, err := service.ToYAML()
+	cm, err := getServiceConfigMapSpec(service, namespace)
 	if err != nil {
 		return err
 	}
-
-	// Create ConfigMap
-	cm := &v1.ConfigMap{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      service.Name,
-			Namespace: namespace,
-			Labels: map[string]string{
-				types.ServiceLabel: service.Name,
-			},
-		},
-		Data: map[string]string{
-			types.ScriptFileName: script,
-			types.FDLFileName:    fdl,
-		},
-	}
 	_, err = kubeClientset.CoreV1().ConfigMaps(namespace).Create(context.TODO(), cm, metav1.CreateOptions{})
 	if err != nil {
 		return err
@@ -473,6 +502,20 @@ func createServiceConfigMap(service *types.Service, namespace string, kubeClient
 }
 
 func updateServiceConfigMap(service *types.Service, namespace string, kubeClientset kubernetes.Interface) error {
+	cm, err := getServiceConfigMapSpec(service, namespace)
+	if err != nil {
+		return err
+	}
+	_, err = kubeClientset.CoreV1().ConfigMaps(namespace).Update(context.TODO(), cm, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// getServiceConfigMapSpec returns the ConfigMap storing the FDL and user-script of the service
+func getServiceConfigMapSpec(service *types.Service, namespace string) (*v1.ConfigMap, error) {
 	// Copy script from service
 	script := service.Script
 
@@ -482,11 +525,10 @@ func updateServiceConfigMap(service *types.Service, namespace string, kubeClient
 	// Create FDL YAML
 	fdl, err := service.ToYAML()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// Create ConfigMap
-	cm := &v1.ConfigMap{
+	return &v1.ConfigMap{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      service.Name,
 			Namespace: namespace,
@@ -498,13 +540,7 @@ func updateServiceConfigMap(service *types.Service, namespace string, kubeClient
 			types.ScriptFileName: script,
 			types.FDLFileName:    fdl,
 		},
-	}
-	_, err = kubeClientset.CoreV1().ConfigMaps(namespace).Update(context.TODO(), cm, metav1.UpdateOptions{})
-	if err != nil {
-		return err
-	}
-
-	return nil
+	}, nil
 }
 
 func deleteServiceConfigMap(name string, namespace string, kubeClientset kubernetes.Interface) error {
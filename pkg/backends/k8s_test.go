@@ -999,3 +999,63 @@ func TestListKserveServicePods(t *testing.T) {
 		t.Fatalf("unexpected kserve pods: %#v", pods.Items)
 	}
 }
+
+func TestKubePlanService(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	back := MakeKubeBackend(clientset, testConfig)
+
+	service := types.Service{
+		Name:   "test",
+		Image:  "testimage",
+		Memory: "1Gi",
+		CPU:    "1",
+		Script: "testscript",
+		Token:  "testtoken",
+	}
+
+	plan, err := back.PlanService(service)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(plan.Errors) != 0 {
+		t.Fatalf("unexpected plan errors: %v", plan.Errors)
+	}
+	kinds := map[string]bool{}
+	for _, resource := range plan.Resources {
+		kinds[resource.Kind] = true
+		if resource.Namespace != testConfig.ServicesNamespace {
+			t.Errorf("expected namespace %s, got %s", testConfig.ServicesNamespace, resource.Namespace)
+		}
+	}
+	if !kinds["ConfigMap"] || !kinds["PodTemplate"] {
+		t.Fatalf("expected ConfigMap and PodTemplate resources, got %+v", plan.Resources)
+	}
+
+	// Nothing must be created in the cluster
+	for _, action := range clientset.Actions() {
+		if action.GetVerb() != "get" && action.GetVerb() != "list" {
+			t.Fatalf("unexpected %s action on %s", action.GetVerb(), action.GetResource().Resource)
+		}
+	}
+}
+
+func TestCheckAdditionalConfigContainerImages(t *testing.T) {
+	cfg := &types.Config{AdditionalConfigPath: "additional-config", Namespace: "oscar"}
+	clientset := fake.NewSimpleClientset(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "additional-config", Namespace: "oscar"},
+		Data:       map[string]string{types.AIR: `["ghcr.io/grycap"]`},
+	})
+
+	service := types.Service{
+		Image:          "ghcr.io/grycap/cowsay",
+		InitContainers: []types.ServiceContainer{{Name: "init", Image: "ghcr.io/grycap/init"}},
+	}
+	if err := checkAdditionalConfig(ConfigMapNameOSCAR, "oscar-svc", service, cfg, clientset); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	service.Sidecars = []types.ServiceContainer{{Name: "proxy", Image: "docker.io/library/nginx"}}
+	if err := checkAdditionalConfig(ConfigMapNameOSCAR, "oscar-svc", service, cfg, clientset); err == nil {
+		t.Error("expected the image of the sidecar to be rejected")
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"maps"
 	"net/http"
 	"strconv"
 
@@ -36,6 +37,10 @@ import (
 	knclientset "knative.dev/serving/pkg/client/clientset/versioned"
 )
 
+// knativeSidecarPort port of the service container when the pod has more than one container,
+// as Knative requires exactly one container to declare the serving port
+const knativeSidecarPort int32 = 8080
+
 // Custom logger - uncomment if needed
 // var knativeLogger = log.New(os.Stdout, "[KNATIVE] ", log.Flags())
 
@@ -371,6 +376,71 @@ func (kn *KnativeBackend) UpdateService(service types.Service) error {
 	return nil
 }
 
+// PlanService renders the objects that CreateService would create without touching the cluster
+func (kn *KnativeBackend) PlanService(service types.Service) (*types.ServicePlan, error) {
+	namespace := service.Namespace
+	if namespace == "" {
+		namespace = kn.config.ServicesNamespace
+	}
+	plan := &types.ServicePlan{Service: service.Name, Namespace: namespace}
+
+	// Work on copies of the maps mutated while rendering the definitions
+	service.Labels = maps.Clone(service.Labels)
+	if service.Labels == nil {
+		service.Labels = map[string]string{}
+	}
+	service.Environment.Vars = maps.Clone(service.Environment.Vars)
+
+	isKserve := isKserveServiceAndSupported(&service, kn)
+	if isKserve {
+		if err := utils.ValidateKserveService(&service); err != nil {
+			plan.AddError(err)
+			isKserve = false
+		} else {
+			if service.Environment.Vars == nil {
+				service.Environment.Vars = make(map[string]string)
+			}
+			service.Environment.Vars["KSERVE_HOST"] = fmt.Sprintf("%s.%s.svc.cluster.local", utils.GetKserveSvcName(service.Name, service.Kserve.Type), namespace)
+		}
+	}
+
+	// Check if there is some user defined settings for OSCAR
+	plan.AddError(checkAdditionalConfig(ConfigMapNameOSCAR, kn.config.ServicesNamespace, service, kn.config, kn.kubeClientset))
+
+	fdlService := service
+	cm, err := getServiceConfigMapSpec(&fdlService, namespace)
+	if err != nil {
+		return nil, err
+	}
+	plan.AddResource("ConfigMap", cm.Name, namespace, cm)
+
+	if len(service.Expose.APIPort) > 0 && service.Expose.APIPort[0] != 0 {
+		resources.PlanExpose(service, namespace, kn.config, plan)
+		return plan, nil
+	}
+	if types.IsInterLinkService(&service, kn.config) {
+		return plan, nil
+	}
+
+	knSvc, err := kn.createKNServiceDefinition(&service, namespace)
+	if err != nil {
+		plan.AddError(err)
+		return plan, nil
+	}
+	plan.AddResource("Service.serving.knative.dev", knSvc.Name, namespace, knSvc)
+
+	if isKserve {
+		isvc, err := utils.NewKserveServiceDefinition(&service, knSvc, kn.config)
+		if err != nil {
+			plan.AddError(err)
+		} else {
+			plan.AddResource(isvc.GetKind(), isvc.GetName(), namespace, isvc)
+		}
+	}
+
+	return plan, nil
+}
+
 // DeleteService deletes a service
 func (kn *KnativeBackend) DeleteService(service types.Service) error {
 
@@ -470,6 +540,9 @@ func (kn *KnativeBackend) createKNServiceDefinition(service *types.Service, name
 	if err != nil {
 		return nil, err
 	}
+	// Knative does not support native sidecars, so they are added as regular containers.
+	// User init containers require the "kubernetes.podspec-init-containers" Knative feature flag
+	types.SidecarsAsContainers(podSpec, service, knativeSidecarPort)
 
 	// fix ContainerConcurrency to 1 to avoid parallel invocations in the same container
 	containerConcurrency := int64(1)
@@ -197,6 +197,59 @@ func ignoreNotFound(err error) error {
 	return err
 }
 
+// PlanExpose renders the components of the exposed service without creating them.
+// Secrets are listed by name only to avoid leaking credentials in the plan.
+func PlanExpose(service types.Service, namespace string, cfg *types.Config, plan *types.ServicePlan) {
+	targetNamespace := namespace
+	if targetNamespace == "" {
+		targetNamespace = cfg.ServicesNamespace
+	}
+	if len(service.Expose.NodePort) > 0 && len(service.Expose.APIPort) != len(service.Expose.NodePort) {
+		plan.AddError(fmt.Errorf("The length of nodePort (%d) must be equal to that of api_port (%d)",
+			len(service.Expose.NodePort), len(service.Expose.APIPort)))
+	}
+
+	deployment := getDeploymentSpec(service, targetNamespace, cfg)
+	plan.AddResource("Deployment", deployment.Name, targetNamespace, deployment)
+	hpa := getHortizontalAutoScaleSpec(service, targetNamespace, cfg)
+	plan.AddResource("HorizontalPodAutoscaler", hpa.Name, targetNamespace, hpa)
+	svc := getServiceSpec(service, targetNamespace, cfg)
+	plan.AddResource("Service", svc.Name, targetNamespace, svc)
+
+	isFirstPortDynamic := len(service.Expose.NodePort) > 0 && service.Expose.NodePort[0] == 0
+	if len(service.Expose.NodePort) != 0 && !isFirstPortDynamic {
+		return
+	}
+	if getRouteKind(cfg) == routeKindHTTPRoute {
+		if err := validateHTTPRouteConfig(service, cfg); err != nil {
+			plan.AddError(err)
+			return
+		}
+		cors := getTraefikCORSMiddlewareSpec(service, targetNamespace, cfg)
+		plan.AddResource("Middleware", cors.GetName(), targetNamespace, cors)
+		if service.Expose.SetAuth {
+			if normalizeExposeAuthType(service.Expose.AuthType) == authTypeBasic {
+				plan.AddResource("Secret", getTraefikAuthSecretName(service.Name), targetNamespace, nil)
+			}
+			authMiddleware := getTraefikAuthMiddlewareSpec(service, targetNamespace, cfg)
+			plan.AddResource("Middleware", authMiddleware.GetName(), targetNamespace, authMiddleware)
+		}
+		route := getHTTPRouteSpec(service, targetNamespace, cfg)
+		plan.AddResource("HTTPRoute", route.GetName(), targetNamespace, route)
+		return
+	}
+
+	if err := validateExposeAuthConfig(service, cfg); err != nil {
+		plan.AddError(err)
+		return
+	}
+	ingress := getIngressSpec(service, targetNamespace, cfg)
+	plan.AddResource("Ingress", ingress.Name, targetNamespace, ingress)
+	if service.Expose.SetAuth {
+		plan.AddResource("Secret", getSecretName(service.Name), targetNamespace, nil)
+	}
+}
+
 // UpdateExpose updates all the components of the exposed service on the cluster
 func UpdateExpose(service types.Service, namespace string, kubeClientset kubernetes.Interface, cfg *types.Config) error {
 	targetNamespace := namespace
@@ -0,0 +1,155 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/grycap/oscar/v4/pkg/types"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// serviceJobsIndex index of the jobs of the informer by their service ("namespace/name")
+const serviceJobsIndex = "service"
+
+var heldJobReleaserLogger = log.New(os.Stdout, "[HELD-JOB-RELEASER] ", log.Flags())
+
+// HeldJobsRelease function releasing the held jobs of a service, given all its jobs
+type HeldJobsRelease func(ctx context.Context, namespace string, serviceName string, jobs []*batchv1.Job) error
+
+// HeldJobReleaser releases the jobs held by the MaxConcurrentJobs limit of their services.
+// The services are queued when one of their jobs is held, resumed or cancelled, and when a
+// running job finishes or is deleted, so a burst of submissions is released in a few passes.
+// Failed releases are retried, and the held jobs are queued again on every resync.
+type HeldJobReleaser struct {
+	factory  informers.SharedInformerFactory
+	informer cache.SharedIndexInformer
+	queue    workqueue.TypedRateLimitingInterface[string]
+	release  HeldJobsRelease
+}
+
+// NewHeldJobReleaser returns a new HeldJobReleaser watching the jobs of the services in all namespaces
+func NewHeldJobReleaser(kubeClientset kubernetes.Interface, resync time.Duration, release HeldJobsRelease) *HeldJobReleaser {
+	factory := informers.NewSharedInformerFactoryWithOptions(kubeClientset, resync, informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+		opts.LabelSelector = types.ServiceLabel
+	}))
+	releaser := &HeldJobReleaser{
+		factory:  factory,
+		informer: factory.Batch().V1().Jobs().Informer(),
+		queue:    workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[string]()),
+		release:  release,
+	}
+
+	_ = releaser.informer.AddIndexers(cache.Indexers{serviceJobsIndex: func(obj any) ([]string, error) {
+		job, ok := obj.(*batchv1.Job)
+		if !ok {
+			return nil, nil
+		}
+		return []string{serviceKey(job)}, nil
+	}})
+	releaser.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj any) {
+			if job, ok := obj.(*batchv1.Job); ok && types.JobHeld(job) {
+				releaser.queue.Add(serviceKey(job))
+			}
+		},
+		UpdateFunc: func(oldObj, obj any) {
+			old, ok := oldObj.(*batchv1.Job)
+			job, ok2 := obj.(*batchv1.Job)
+			if !ok || !ok2 {
+				return
+			}
+			if types.JobHeld(job) || types.JobStopped(job) && !types.JobStopped(old) {
+				releaser.queue.Add(serviceKey(job))
+			}
+		},
+		DeleteFunc: func(obj any) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if job, ok := obj.(*batchv1.Job); ok && !types.JobHeld(job) && !types.JobStopped(job) {
+				releaser.queue.Add(serviceKey(job))
+			}
+		},
+	})
+
+	return releaser
+}
+
+// Run starts the informer and releases the held jobs until the context is cancelled
+func (releaser *HeldJobReleaser) Run(ctx context.Context) {
+	defer releaser.queue.ShutDown()
+
+	heldJobReleaserLogger.Println("Releasing the held jobs of the services")
+	releaser.factory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), releaser.informer.HasSynced) {
+		heldJobReleaserLogger.Println("Error syncing the job informer cache")
+		return
+	}
+
+	go func() {
+		for releaser.processNextItem(ctx) {
+		}
+	}()
+	<-ctx.Done()
+}
+
+func (releaser *HeldJobReleaser) processNextItem(ctx context.Context) bool {
+	key, shutdown := releaser.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer releaser.queue.Done(key)
+
+	// The releases are retried until they succeed, as nothing else releases the held jobs of an idle service
+	if err := releaser.releaseService(ctx, key); err != nil {
+		heldJobReleaserLogger.Printf("Error releasing the held jobs of service '%s': %v", key, err)
+		releaser.queue.AddRateLimited(key)
+		return true
+	}
+	releaser.queue.Forget(key)
+	return true
+}
+
+// releaseService releases the held jobs of the service identified by key ("namespace/name")
+func (releaser *HeldJobReleaser) releaseService(ctx context.Context, key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return nil
+	}
+	objs, err := releaser.informer.GetIndexer().ByIndex(serviceJobsIndex, key)
+	if err != nil {
+		return err
+	}
+	jobs := make([]*batchv1.Job, 0, len(objs))
+	for _, obj := range objs {
+		jobs = append(jobs, obj.(*batchv1.Job).DeepCopy())
+	}
+	return releaser.release(ctx, namespace, name, jobs)
+}
+
+func serviceKey(job *batchv1.Job) string {
+	return cache.ObjectName{Namespace: job.Namespace, Name: job.Labels[types.ServiceLabel]}.String()
+}
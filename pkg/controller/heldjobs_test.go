@@ -0,0 +1,68 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/grycap/oscar/v4/pkg/types"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestHeldJobReleaserRetriesReleases(t *testing.T) {
+	other := newFinishedJob("other-1", false)
+	other.Labels[types.ServiceLabel] = "other"
+	kubeClientset := fake.NewSimpleClientset()
+
+	calls := 0
+	var released []string
+	releaser := NewHeldJobReleaser(kubeClientset, time.Minute, func(ctx context.Context, namespace string, serviceName string, jobs []*batchv1.Job) error {
+		calls++
+		if calls == 1 {
+			return errors.New("conflict")
+		}
+		released = nil
+		for _, job := range jobs {
+			released = append(released, namespace+"/"+serviceName+"/"+job.Name)
+		}
+		return nil
+	})
+	for _, job := range []*batchv1.Job{newFinishedJob("job-1", false), newFinishedJob("job-2", true), other} {
+		if err := releaser.informer.GetIndexer().Add(job); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	releaser.queue.Add("oscar-svc/svc")
+	releaser.processNextItem(context.Background())
+	if releaser.queue.NumRequeues("oscar-svc/svc") != 1 {
+		t.Fatalf("expected the failed release to be retried")
+	}
+
+	releaser.queue.Add("oscar-svc/svc")
+	releaser.processNextItem(context.Background())
+	if releaser.queue.NumRequeues("oscar-svc/svc") != 0 {
+		t.Fatalf("expected the successful release to be forgotten")
+	}
+	if len(released) != 2 || released[0] == "oscar-svc/other/other-1" || released[1] == "oscar-svc/other/other-1" {
+		t.Fatalf("expected the release of the jobs of the service, got %v", released)
+	}
+}
@@ -0,0 +1,258 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grycap/oscar/v4/pkg/types"
+	batchv1 "k8s.io/api/batch/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// maxJobHandlerRetries number of retries of a failed job handler before giving up
+const maxJobHandlerRetries = 5
+
+var jobWatcherLogger = log.New(os.Stdout, "[JOB-WATCHER] ", log.Flags())
+
+// JobHandler function run once when a job of a service finishes
+type JobHandler func(ctx context.Context, job *batchv1.Job) error
+
+type namedJobHandler struct {
+	name    string
+	handler JobHandler
+}
+
+// JobWatcher runs the registered handlers once on every finished job of the services.
+// The handlers already run on a job are recorded in its JobHandlersDoneAnnotation, so they
+// are not run again after a restart, and the jobs deleted before being handled (e.g. by
+// their TTL) are handled from their last known state.
+type JobWatcher struct {
+	kubeClientset kubernetes.Interface
+	factory       informers.SharedInformerFactory
+	informer      cache.SharedIndexInformer
+	queue         workqueue.TypedRateLimitingInterface[string]
+	handlers      []namedJobHandler
+
+	mutex sync.Mutex
+	// deleted finished jobs deleted before all the handlers were run
+	deleted map[string]*batchv1.Job
+}
+
+// NewJobWatcher returns a new JobWatcher watching the jobs of the services in all namespaces
+func NewJobWatcher(kubeClientset kubernetes.Interface, resync time.Duration) *JobWatcher {
+	factory := informers.NewSharedInformerFactoryWithOptions(kubeClientset, resync, informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+		opts.LabelSelector = types.ServiceLabel
+	}))
+	watcher := &JobWatcher{
+		kubeClientset: kubeClientset,
+		factory:       factory,
+		informer:      factory.Batch().V1().Jobs().Informer(),
+		queue:         workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[string]()),
+		deleted:       map[string]*batchv1.Job{},
+	}
+
+	enqueue := func(obj any) {
+		if job, ok := obj.(*batchv1.Job); ok && watcher.pending(job) {
+			watcher.queue.Add(cache.ObjectName{Namespace: job.Namespace, Name: job.Name}.String())
+		}
+	}
+	watcher.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    enqueue,
+		UpdateFunc: func(_, obj any) { enqueue(obj) },
+		DeleteFunc: func(obj any) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			job, ok := obj.(*batchv1.Job)
+			if !ok || !watcher.pending(job) {
+				return
+			}
+			key := cache.ObjectName{Namespace: job.Namespace, Name: job.Name}.String()
+			watcher.mutex.Lock()
+			watcher.deleted[key] = job
+			watcher.mutex.Unlock()
+			watcher.queue.Add(key)
+		},
+	})
+
+	return watcher
+}
+
+// AddHandler registers a handler to run on the finished jobs. Handlers must be added before calling Run.
+func (watcher *JobWatcher) AddHandler(name string, handler JobHandler) {
+	watcher.handlers = append(watcher.handlers, namedJobHandler{name: name, handler: handler})
+}
+
+// Run starts the informer and processes the finished jobs until the context is cancelled
+func (watcher *JobWatcher) Run(ctx context.Context) {
+	defer watcher.queue.ShutDown()
+
+	jobWatcherLogger.Println("Watching the jobs of the services")
+	watcher.factory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), watcher.informer.HasSynced) {
+		jobWatcherLogger.Println("Error syncing the job informer cache")
+		return
+	}
+
+	go func() {
+		for watcher.processNextItem(ctx) {
+		}
+	}()
+	<-ctx.Done()
+}
+
+func (watcher *JobWatcher) processNextItem(ctx context.Context) bool {
+	key, shutdown := watcher.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer watcher.queue.Done(key)
+
+	err := watcher.handleJob(ctx, key)
+	switch {
+	case err == nil:
+		watcher.forget(key)
+	case watcher.queue.NumRequeues(key) < maxJobHandlerRetries:
+		jobWatcherLogger.Printf("Error handling finished job '%s': %v", key, err)
+		watcher.queue.AddRateLimited(key)
+	default:
+		jobWatcherLogger.Printf("Giving up handling finished job '%s': %v", key, err)
+		watcher.forget(key)
+	}
+	return true
+}
+
+func (watcher *JobWatcher) forget(key string) {
+	watcher.queue.Forget(key)
+	watcher.mutex.Lock()
+	defer watcher.mutex.Unlock()
+	// Keep the deleted jobs pending while they are in the queue again
+	if _, exists, _ := watcher.informer.GetIndexer().GetByKey(key); !exists {
+		delete(watcher.deleted, key)
+	}
+}
+
+// handleJob runs the pending handlers on the finished job identified by key ("namespace/name")
+func (watcher *JobWatcher) handleJob(ctx context.Context, key string) error {
+	job, err := watcher.getJob(key)
+	if err != nil || job == nil || !watcher.pending(job) {
+		return err
+	}
+
+	done := handlersDone(job)
+	var errs []string
+	for _, h := range watcher.handlers {
+		if slices.Contains(done, h.name) {
+			continue
+		}
+		if err := h.handler(ctx, job); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", h.name, err))
+			continue
+		}
+		done = append(done, h.name)
+		if err := watcher.markDone(ctx, job, done); err != nil {
+			return err
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// getJob returns the job from the informer cache or, if it was deleted, its last known state
+func (watcher *JobWatcher) getJob(key string) (*batchv1.Job, error) {
+	obj, exists, err := watcher.informer.GetIndexer().GetByKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return obj.(*batchv1.Job).DeepCopy(), nil
+	}
+	watcher.mutex.Lock()
+	defer watcher.mutex.Unlock()
+	if job, ok := watcher.deleted[key]; ok {
+		return job.DeepCopy(), nil
+	}
+	return nil, nil
+}
+
+// markDone records the handlers run on the job. The record is kept in memory if the job was deleted.
+func (watcher *JobWatcher) markDone(ctx context.Context, job *batchv1.Job, done []string) error {
+	value := strings.Join(done, ",")
+	if job.Annotations == nil {
+		job.Annotations = map[string]string{}
+	}
+	job.Annotations[types.JobHandlersDoneAnnotation] = value
+
+	patch, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{
+			"annotations": map[string]string{types.JobHandlersDoneAnnotation: value},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = watcher.kubeClientset.BatchV1().Jobs(job.Namespace).Patch(ctx, job.Name, k8stypes.MergePatchType, patch, metav1.PatchOptions{})
+	if apierrors.IsNotFound(err) {
+		key := cache.ObjectName{Namespace: job.Namespace, Name: job.Name}.String()
+		watcher.mutex.Lock()
+		if _, ok := watcher.deleted[key]; ok {
+			watcher.deleted[key] = job.DeepCopy()
+		}
+		watcher.mutex.Unlock()
+		return nil
+	}
+	return err
+}
+
+// pending returns true if the job has finished and any handler has not been run on it
+func (watcher *JobWatcher) pending(job *batchv1.Job) bool {
+	if !types.JobFinished(job) {
+		return false
+	}
+	done := handlersDone(job)
+	for _, h := range watcher.handlers {
+		if !slices.Contains(done, h.name) {
+			return true
+		}
+	}
+	return false
+}
+
+func handlersDone(job *batchv1.Job) []string {
+	value := job.Annotations[types.JobHandlersDoneAnnotation]
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
@@ -0,0 +1,132 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/grycap/oscar/v4/pkg/types"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newFinishedJob(name string, finished bool) *batchv1.Job {
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "oscar-svc",
+			Labels:    map[string]string{types.ServiceLabel: "svc"},
+		},
+	}
+	if finished {
+		job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+	}
+	return job
+}
+
+func TestJobWatcherRunsHandlersOnce(t *testing.T) {
+	job := newFinishedJob("job-1", true)
+	kubeClientset := fake.NewSimpleClientset(job)
+	watcher := NewJobWatcher(kubeClientset, time.Minute)
+
+	calls := map[string]int{}
+	watcher.AddHandler("archive", func(ctx context.Context, job *batchv1.Job) error {
+		calls["archive"]++
+		return nil
+	})
+	watcher.AddHandler("callback", func(ctx context.Context, job *batchv1.Job) error {
+		calls["callback"]++
+		if calls["callback"] == 1 {
+			return errors.New("unreachable")
+		}
+		return nil
+	})
+	if err := watcher.informer.GetIndexer().Add(job); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := watcher.handleJob(context.Background(), "oscar-svc/job-1"); err == nil {
+		t.Fatalf("expected error from the failing handler")
+	}
+	updated, err := kubeClientset.BatchV1().Jobs("oscar-svc").Get(context.Background(), "job-1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := updated.Annotations[types.JobHandlersDoneAnnotation]; got != "archive" {
+		t.Fatalf("expected only the archive handler to be recorded, got %q", got)
+	}
+
+	// The retry only runs the failed handler
+	if err := watcher.informer.GetIndexer().Update(updated); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := watcher.handleJob(context.Background(), "oscar-svc/job-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if calls["archive"] != 1 || calls["callback"] != 2 {
+		t.Fatalf("unexpected handler calls: %v", calls)
+	}
+	updated, _ = kubeClientset.BatchV1().Jobs("oscar-svc").Get(context.Background(), "job-1", metav1.GetOptions{})
+	if watcher.pending(updated) {
+		t.Fatalf("expected the job to be fully handled, annotations: %v", updated.Annotations)
+	}
+}
+
+func TestJobWatcherSkipsRunningJobs(t *testing.T) {
+	job := newFinishedJob("job-1", false)
+	watcher := NewJobWatcher(fake.NewSimpleClientset(job), time.Minute)
+	watcher.AddHandler("archive", func(ctx context.Context, job *batchv1.Job) error {
+		t.Fatalf("unexpected call on a running job")
+		return nil
+	})
+	if err := watcher.informer.GetIndexer().Add(job); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := watcher.handleJob(context.Background(), "oscar-svc/job-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestJobWatcherHandlesDeletedJobs(t *testing.T) {
+	// The job was deleted by the TTL controller before being handled
+	watcher := NewJobWatcher(fake.NewSimpleClientset(), time.Minute)
+	var handled []string
+	watcher.AddHandler("archive", func(ctx context.Context, job *batchv1.Job) error {
+		handled = append(handled, job.Name)
+		return nil
+	})
+	watcher.deleted["oscar-svc/job-1"] = newFinishedJob("job-1", true)
+
+	if err := watcher.handleJob(context.Background(), "oscar-svc/job-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(handled) != 1 || handled[0] != "job-1" {
+		t.Fatalf("expected the deleted job to be handled, got %v", handled)
+	}
+	if watcher.pending(watcher.deleted["oscar-svc/job-1"]) {
+		t.Fatalf("expected the handlers to be recorded in the deleted job")
+	}
+	watcher.forget("oscar-svc/job-1")
+	if len(watcher.deleted) != 0 {
+		t.Fatalf("expected the deleted job to be forgotten")
+	}
+}
@@ -0,0 +1,70 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// LeaderElectionLease name of the Lease used to elect the replica running the controllers
+const LeaderElectionLease = "oscar-manager-controllers"
+
+var leaderElectionLogger = log.New(os.Stdout, "[LEADER-ELECTION] ", log.Flags())
+
+// RunLeaderElection runs the function only while this replica holds the Lease of the namespace, so the
+// controllers and watchers are not run by several replicas of the manager at the same time.
+// The process exits when the leadership is lost, as the function may not stop cleanly.
+func RunLeaderElection(ctx context.Context, kubeClientset kubernetes.Interface, namespace string, run func(ctx context.Context)) {
+	identity, err := os.Hostname()
+	if err != nil {
+		leaderElectionLogger.Fatalf("Error reading the identity of the replica: %v", err)
+	}
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta:  metav1.ObjectMeta{Name: LeaderElectionLease, Namespace: namespace},
+		Client:     kubeClientset.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
+	}
+	leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		ReleaseOnCancel: true,
+		LeaseDuration:   15 * time.Second,
+		RenewDeadline:   10 * time.Second,
+		RetryPeriod:     2 * time.Second,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				leaderElectionLogger.Printf("Replica %s elected to run the controllers", identity)
+				run(ctx)
+			},
+			OnStoppedLeading: func() {
+				leaderElectionLogger.Fatalf("Replica %s lost the leadership of the controllers", identity)
+			},
+			OnNewLeader: func(leader string) {
+				if leader != identity {
+					leaderElectionLogger.Printf("The controllers are run by replica %s", leader)
+				}
+			},
+		},
+	})
+}
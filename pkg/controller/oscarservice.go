@@ -0,0 +1,327 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package controller reconciles OSCARService custom resources into OSCAR services
+// and runs the handlers of the finished jobs of the services
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/grycap/oscar/v4/pkg/types"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// notReadyRequeue delay to check again a service whose resources are not ready yet
+const notReadyRequeue = 30 * time.Second
+
+var controllerLogger = log.New(os.Stdout, "[SERVICE-CONTROLLER] ", log.Flags())
+
+// ServiceApplier applies the services defined by OSCARService resources
+type ServiceApplier interface {
+	// Apply creates or updates the service, doing nothing if it did not change.
+	// Services that were not created by the same resource must not be adopted.
+	Apply(ctx context.Context, service types.Service) types.ServiceApplyResult
+	// Delete deletes the service created by the resource with the given key, doing nothing if it does not exist
+	Delete(ctx context.Context, name string, resource string) types.ServiceApplyResult
+	// Observe returns the runtime status of the deployment and volume of the service
+	Observe(service types.Service) (types.ServiceDeploymentStatus, types.ServiceVolumeStatus, error)
+}
+
+// Controller reconciles the OSCARService resources of a namespace
+type Controller struct {
+	client    dynamic.Interface
+	namespace string
+	applier   ServiceApplier
+	factory   dynamicinformer.DynamicSharedInformerFactory
+	informer  cache.SharedIndexInformer
+	queue     workqueue.TypedRateLimitingInterface[string]
+}
+
+// NewController returns a new Controller watching the OSCARService resources of the namespace
+func NewController(client dynamic.Interface, namespace string, applier ServiceApplier, resync time.Duration) *Controller {
+	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(client, resync, namespace, nil)
+	ctrl := &Controller{
+		client:    client,
+		namespace: namespace,
+		applier:   applier,
+		factory:   factory,
+		informer:  factory.ForResource(types.OSCARServiceGVR).Informer(),
+		queue:     workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[string]()),
+	}
+
+	enqueue := func(obj any) {
+		key, err := cache.MetaNamespaceKeyFunc(obj)
+		if err != nil {
+			controllerLogger.Printf("Error getting key of object: %v", err)
+			return
+		}
+		ctrl.queue.Add(key)
+	}
+	ctrl.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    enqueue,
+		UpdateFunc: func(_, obj any) { enqueue(obj) },
+	})
+
+	return ctrl
+}
+
+// Run starts the informer and processes the queue until the context is cancelled.
+// A single worker is used so that the events of a resource are applied in order.
+func (ctrl *Controller) Run(ctx context.Context) {
+	defer ctrl.queue.ShutDown()
+
+	controllerLogger.Printf("Watching OSCARService resources in namespace '%s'", ctrl.namespace)
+	ctrl.factory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), ctrl.informer.HasSynced) {
+		controllerLogger.Println("Error syncing the OSCARService informer cache")
+		return
+	}
+
+	go func() {
+		for ctrl.processNextItem(ctx) {
+		}
+	}()
+	<-ctx.Done()
+}
+
+func (ctrl *Controller) processNextItem(ctx context.Context) bool {
+	key, shutdown := ctrl.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer ctrl.queue.Done(key)
+
+	requeue, err := ctrl.Reconcile(ctx, key)
+	switch {
+	case err != nil:
+		controllerLogger.Printf("Error reconciling '%s': %v", key, err)
+		ctrl.queue.AddRateLimited(key)
+	case requeue:
+		ctrl.queue.Forget(key)
+		ctrl.queue.AddAfter(key, notReadyRequeue)
+	default:
+		ctrl.queue.Forget(key)
+	}
+	return true
+}
+
+// Reconcile converges the service of the OSCARService identified by key ("namespace/name").
+// Returns true if the resource must be checked again because its resources are not ready.
+func (ctrl *Controller) Reconcile(ctx context.Context, key string) (bool, error) {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return false, nil
+	}
+	resource := ctrl.client.Resource(types.OSCARServiceGVR).Namespace(namespace)
+	obj, err := resource.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	// Delete the service before releasing the resource
+	if obj.GetDeletionTimestamp() != nil {
+		if !slices.Contains(obj.GetFinalizers(), types.OSCARServiceFinalizer) {
+			return false, nil
+		}
+		if result := ctrl.applier.Delete(ctx, name, types.OSCARServiceKey(namespace, name)); result.Error != "" {
+			return false, fmt.Errorf("error deleting service: %s", result.Error)
+		}
+		obj.SetFinalizers(slices.DeleteFunc(obj.GetFinalizers(), func(f string) bool {
+			return f == types.OSCARServiceFinalizer
+		}))
+		_, err := resource.Update(ctx, obj, metav1.UpdateOptions{})
+		return false, err
+	}
+
+	if !slices.Contains(obj.GetFinalizers(), types.OSCARServiceFinalizer) {
+		obj.SetFinalizers(append(obj.GetFinalizers(), types.OSCARServiceFinalizer))
+		if obj, err = resource.Update(ctx, obj, metav1.UpdateOptions{}); err != nil {
+			return false, err
+		}
+	}
+
+	status := currentStatus(obj)
+	status.ObservedGeneration = obj.GetGeneration()
+
+	service, err := types.ServiceFromOSCARService(obj)
+	if err != nil {
+		setCondition(&status, types.OSCARServiceConditionReady, metav1.ConditionFalse, "InvalidSpec", err.Error())
+		return false, ctrl.updateStatus(ctx, obj, status)
+	}
+
+	result := ctrl.applier.Apply(ctx, *service)
+	if result.Error != "" {
+		for _, condition := range []string{types.OSCARServiceConditionBucketsReady, types.OSCARServiceConditionExposeReady, types.OSCARServiceConditionVolumeReady} {
+			setCondition(&status, condition, metav1.ConditionUnknown, "ApplyFailed", "The service could not be applied")
+		}
+		setCondition(&status, types.OSCARServiceConditionReady, metav1.ConditionFalse, "ApplyFailed", result.Error)
+		if err := ctrl.updateStatus(ctx, obj, status); err != nil {
+			return false, err
+		}
+		// Server errors are retried, invalid definitions wait for a spec change
+		if result.Status >= 500 {
+			return false, fmt.Errorf("error applying service: %s", result.Error)
+		}
+		return false, nil
+	}
+	if result.Action != types.ApplyActionNoOp {
+		status.LastAction = result.Action
+	}
+
+	if usesBuckets(service) {
+		setCondition(&status, types.OSCARServiceConditionBucketsReady, metav1.ConditionTrue, "Configured", "The service buckets are configured")
+	} else {
+		setCondition(&status, types.OSCARServiceConditionBucketsReady, metav1.ConditionTrue, "NotRequired", "The service has no MinIO storage")
+	}
+
+	deployment, volume, err := ctrl.applier.Observe(*service)
+	if err != nil {
+		setCondition(&status, types.OSCARServiceConditionExposeReady, metav1.ConditionUnknown, "ObserveFailed", err.Error())
+		setCondition(&status, types.OSCARServiceConditionVolumeReady, metav1.ConditionUnknown, "ObserveFailed", err.Error())
+	} else {
+		setExposeCondition(&status, service, deployment)
+		setVolumeCondition(&status, volume)
+	}
+
+	ready := true
+	for _, condition := range []string{types.OSCARServiceConditionBucketsReady, types.OSCARServiceConditionExposeReady, types.OSCARServiceConditionVolumeReady} {
+		if !meta.IsStatusConditionTrue(status.Conditions, condition) {
+			ready = false
+		}
+	}
+	if ready {
+		setCondition(&status, types.OSCARServiceConditionReady, metav1.ConditionTrue, "Reconciled", "The service is ready")
+	} else {
+		setCondition(&status, types.OSCARServiceConditionReady, metav1.ConditionFalse, "Progressing", "Waiting for the service resources to be ready")
+	}
+
+	return !ready, ctrl.updateStatus(ctx, obj, status)
+}
+
+func setExposeCondition(status *types.OSCARServiceStatus, service *types.Service, deployment types.ServiceDeploymentStatus) {
+	if len(service.Expose.APIPort) == 0 || service.Expose.APIPort[0] == 0 {
+		setCondition(status, types.OSCARServiceConditionExposeReady, metav1.ConditionTrue, "NotExposed", "The service is not exposed")
+		return
+	}
+	if deployment.State == types.DeploymentStateReady {
+		setCondition(status, types.OSCARServiceConditionExposeReady, metav1.ConditionTrue, "Available", "The exposed deployment is available")
+		return
+	}
+	message := deployment.Reason
+	if message == "" {
+		message = fmt.Sprintf("The exposed deployment is %s", deployment.State)
+	}
+	setCondition(status, types.OSCARServiceConditionExposeReady, metav1.ConditionFalse, conditionReason(deployment.State), message)
+}
+
+func setVolumeCondition(status *types.OSCARServiceStatus, volume types.ServiceVolumeStatus) {
+	switch {
+	case !volume.Enabled:
+		setCondition(status, types.OSCARServiceConditionVolumeReady, metav1.ConditionTrue, "NotRequired", "The service has no managed volume")
+	case volume.Phase == types.VolumePhaseReady || volume.Phase == types.VolumePhaseInUse:
+		setCondition(status, types.OSCARServiceConditionVolumeReady, metav1.ConditionTrue, "Bound", fmt.Sprintf("The volume %s is %s", volume.Name, volume.Phase))
+	default:
+		message := fmt.Sprintf("The volume %s is %s", volume.Name, volume.Phase)
+		if volume.Error != "" {
+			message = volume.Error
+		}
+		setCondition(status, types.OSCARServiceConditionVolumeReady, metav1.ConditionFalse, conditionReason(volume.Phase), message)
+	}
+}
+
+// usesBuckets returns true if the service stores inputs, outputs or mounts in MinIO
+func usesBuckets(service *types.Service) bool {
+	for _, storage := range append(append([]types.StorageIOConfig{}, service.Input...), service.Output...) {
+		if isMinIOProvider(storage.Provider) {
+			return true
+		}
+	}
+	return isMinIOProvider(service.Mount.Provider)
+}
+
+// isMinIOProvider checks providers in the form "minio" or "minio.<id>"
+func isMinIOProvider(provider string) bool {
+	return strings.SplitN(provider, ".", 2)[0] == types.MinIOName
+}
+
+// conditionReason converts a state like "in_use" into a CamelCase condition reason
+func conditionReason(state string) string {
+	var reason strings.Builder
+	for _, word := range strings.FieldsFunc(state, func(r rune) bool { return r == '_' || r == '-' || r == ' ' }) {
+		reason.WriteString(strings.ToUpper(word[:1]) + word[1:])
+	}
+	if reason.Len() == 0 {
+		return "Unknown"
+	}
+	return reason.String()
+}
+
+func setCondition(status *types.OSCARServiceStatus, conditionType string, value metav1.ConditionStatus, reason string, message string) {
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             value,
+		ObservedGeneration: status.ObservedGeneration,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+func currentStatus(obj *unstructured.Unstructured) types.OSCARServiceStatus {
+	status := types.OSCARServiceStatus{}
+	raw, found, err := unstructured.NestedMap(obj.Object, "status")
+	if err != nil || !found {
+		return status
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(raw, &status); err != nil {
+		return types.OSCARServiceStatus{}
+	}
+	return status
+}
+
+// updateStatus writes the status subresource only when it changed, to avoid reconcile loops
+func (ctrl *Controller) updateStatus(ctx context.Context, obj *unstructured.Unstructured, status types.OSCARServiceStatus) error {
+	if equality.Semantic.DeepEqual(currentStatus(obj), status) {
+		return nil
+	}
+	raw, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&status)
+	if err != nil {
+		return err
+	}
+	if err := unstructured.SetNestedMap(obj.Object, raw, "status"); err != nil {
+		return err
+	}
+	_, err = ctrl.client.Resource(types.OSCARServiceGVR).Namespace(obj.GetNamespace()).UpdateStatus(ctx, obj, metav1.UpdateOptions{})
+	return err
+}
@@ -0,0 +1,195 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/grycap/oscar/v4/pkg/types"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+type fakeApplier struct {
+	applied    []types.Service
+	deleted    []string
+	resources  []string
+	result     types.ServiceApplyResult
+	deployment types.ServiceDeploymentStatus
+	volume     types.ServiceVolumeStatus
+}
+
+func (f *fakeApplier) Apply(ctx context.Context, service types.Service) types.ServiceApplyResult {
+	f.applied = append(f.applied, service)
+	result := f.result
+	result.Service = service.Name
+	return result
+}
+
+func (f *fakeApplier) Delete(ctx context.Context, name string, resource string) types.ServiceApplyResult {
+	f.deleted = append(f.deleted, name)
+	f.resources = append(f.resources, resource)
+	return types.ServiceApplyResult{Service: name, Action: types.ApplyActionDelete}
+}
+
+func (f *fakeApplier) Observe(service types.Service) (types.ServiceDeploymentStatus, types.ServiceVolumeStatus, error) {
+	return f.deployment, f.volume, nil
+}
+
+func newOSCARService(name string, spec map[string]any) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]any{"spec": spec}}
+	obj.SetAPIVersion(types.OSCARServiceGroup + "/" + types.OSCARServiceVersion)
+	obj.SetKind(types.OSCARServiceKind)
+	obj.SetName(name)
+	obj.SetNamespace("oscar-svc")
+	obj.SetGeneration(1)
+	return obj
+}
+
+func newFakeController(applier ServiceApplier, objects ...runtime.Object) *Controller {
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{types.OSCARServiceGVR: "OSCARServiceList"}, objects...)
+	return NewController(client, "oscar-svc", applier, time.Minute)
+}
+
+func getCondition(t *testing.T, ctrl *Controller, name string, conditionType string) *metav1.Condition {
+	t.Helper()
+	obj, err := ctrl.client.Resource(types.OSCARServiceGVR).Namespace("oscar-svc").Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return meta.FindStatusCondition(currentStatus(obj).Conditions, conditionType)
+}
+
+func TestReconcileAppliesService(t *testing.T) {
+	applier := &fakeApplier{result: types.ServiceApplyResult{Action: types.ApplyActionCreate, Status: 201}}
+	obj := newOSCARService("cowsay", map[string]any{
+		"name":   "ignored",
+		"image":  "ghcr.io/grycap/cowsay",
+		"script": "echo hi",
+		"input":  []any{map[string]any{"storage_provider": "minio", "path": "cowsay/in"}},
+	})
+	ctrl := newFakeController(applier, obj)
+
+	requeue, err := ctrl.Reconcile(context.Background(), "oscar-svc/cowsay")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if requeue {
+		t.Fatal("expected a ready service not to be requeued")
+	}
+	if len(applier.applied) != 1 || applier.applied[0].Name != "cowsay" || applier.applied[0].Image != "ghcr.io/grycap/cowsay" {
+		t.Fatalf("unexpected applied services: %+v", applier.applied)
+	}
+	if resource := applier.applied[0].Annotations[types.OSCARServiceAnnotation]; resource != "oscar-svc/cowsay" {
+		t.Fatalf("expected the service to be annotated with the resource key, got %q", resource)
+	}
+
+	current, _ := ctrl.client.Resource(types.OSCARServiceGVR).Namespace("oscar-svc").Get(context.Background(), "cowsay", metav1.GetOptions{})
+	if !slices.Contains(current.GetFinalizers(), types.OSCARServiceFinalizer) {
+		t.Fatal("expected the finalizer to be added")
+	}
+	for _, conditionType := range []string{types.OSCARServiceConditionReady, types.OSCARServiceConditionBucketsReady, types.OSCARServiceConditionExposeReady, types.OSCARServiceConditionVolumeReady} {
+		condition := getCondition(t, ctrl, "cowsay", conditionType)
+		if condition == nil || condition.Status != metav1.ConditionTrue {
+			t.Errorf("expected condition %s to be true, got %+v", conditionType, condition)
+		}
+	}
+	if condition := getCondition(t, ctrl, "cowsay", types.OSCARServiceConditionBucketsReady); condition.Reason != "Configured" {
+		t.Errorf("expected buckets to be configured, got %s", condition.Reason)
+	}
+}
+
+func TestReconcileExposedNotReady(t *testing.T) {
+	applier := &fakeApplier{
+		result:     types.ServiceApplyResult{Action: types.ApplyActionUpdate, Status: 204},
+		deployment: types.ServiceDeploymentStatus{State: types.DeploymentStatePending},
+	}
+	obj := newOSCARService("exposed", map[string]any{
+		"image":  "nginx",
+		"script": "echo hi",
+		"expose": map[string]any{"api_port": []any{int64(80)}},
+	})
+	ctrl := newFakeController(applier, obj)
+
+	requeue, err := ctrl.Reconcile(context.Background(), "oscar-svc/exposed")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !requeue {
+		t.Fatal("expected a pending service to be requeued")
+	}
+	expose := getCondition(t, ctrl, "exposed", types.OSCARServiceConditionExposeReady)
+	if expose == nil || expose.Status != metav1.ConditionFalse || expose.Reason != "Pending" {
+		t.Fatalf("unexpected expose condition: %+v", expose)
+	}
+	ready := getCondition(t, ctrl, "exposed", types.OSCARServiceConditionReady)
+	if ready == nil || ready.Status != metav1.ConditionFalse {
+		t.Fatalf("unexpected ready condition: %+v", ready)
+	}
+}
+
+func TestReconcileApplyFailure(t *testing.T) {
+	applier := &fakeApplier{result: types.ServiceApplyResult{Action: types.ApplyActionCreate, Status: 400, Error: "invalid service"}}
+	ctrl := newFakeController(applier, newOSCARService("bad", map[string]any{"image": "img", "script": "s"}))
+
+	if _, err := ctrl.Reconcile(context.Background(), "oscar-svc/bad"); err != nil {
+		t.Fatalf("expected client errors not to be retried, got %v", err)
+	}
+	ready := getCondition(t, ctrl, "bad", types.OSCARServiceConditionReady)
+	if ready == nil || ready.Status != metav1.ConditionFalse || ready.Message != "invalid service" {
+		t.Fatalf("unexpected ready condition: %+v", ready)
+	}
+}
+
+func TestReconcileDeletesService(t *testing.T) {
+	applier := &fakeApplier{}
+	obj := newOSCARService("cowsay", map[string]any{"image": "img", "script": "s"})
+	obj.SetFinalizers([]string{types.OSCARServiceFinalizer})
+	now := metav1.Now()
+	obj.SetDeletionTimestamp(&now)
+	ctrl := newFakeController(applier, obj)
+
+	if _, err := ctrl.Reconcile(context.Background(), "oscar-svc/cowsay"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(applier.deleted) != 1 || applier.deleted[0] != "cowsay" {
+		t.Fatalf("expected the service to be deleted, got %v", applier.deleted)
+	}
+	if applier.resources[0] != "oscar-svc/cowsay" {
+		t.Fatalf("expected the deletion to be limited to the resource, got %q", applier.resources[0])
+	}
+	if len(applier.applied) != 0 {
+		t.Fatal("expected no apply for a deleted resource")
+	}
+}
+
+func TestConditionReason(t *testing.T) {
+	cases := map[string]string{"in_use": "InUse", "pending": "Pending", "": "Unknown"}
+	for state, expected := range cases {
+		if reason := conditionReason(state); reason != expected {
+			t.Errorf("%q: expected %s, got %s", state, expected, reason)
+		}
+	}
+}
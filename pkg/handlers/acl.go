@@ -0,0 +1,167 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"github.com/grycap/oscar/v4/pkg/types"
+	"github.com/grycap/oscar/v4/pkg/utils"
+)
+
+var aclLogger = log.New(os.Stdout, "[ACL-HANDLER] ", log.Flags())
+
+// MakeReadServiceACLHandler godoc
+// @Summary Get service ACL
+// @Description Get the roles granted on a service to users and OIDC groups, in addition to its owner and visibility.
+// @Tags services
+// @Produce json
+// @Param serviceName path string true "Service name"
+// @Success 200 {object} types.ServiceACL
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Not Found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Security BasicAuth
+// @Security BearerAuth
+// @Router /system/services/{serviceName}/acl [get]
+func MakeReadServiceACLHandler(back types.ServerlessBackend) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		service, ok := getManagedService(c, back, c.Param("serviceName"), types.ServiceRoleViewer)
+		if !ok {
+			return
+		}
+		acl := types.ServiceACL{}
+		if service.ACL != nil {
+			acl = *service.ACL
+		}
+		c.JSON(http.StatusOK, acl)
+	}
+}
+
+// MakeUpdateServiceACLHandler godoc
+// @Summary Update service ACL
+// @Description Replace the roles granted on a service to users and OIDC groups. The roles are viewer (read the service, its jobs, logs and metrics), invoker (invoke the service and manage its jobs), editor (update, restart and roll back the service) and owner (delete the service, manage its tokens and share it). Only the users with the owner role can update the ACL.
+// @Tags services
+// @Accept json
+// @Produce json
+// @Param serviceName path string true "Service name"
+// @Param acl body types.ServiceACL true "Access control list"
+// @Success 200 {object} types.ServiceACL
+// @Failure 400 {string} string "Bad Request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Not Found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Security BasicAuth
+// @Security BearerAuth
+// @Router /system/services/{serviceName}/acl [put]
+func MakeUpdateServiceACLHandler(cfg *types.Config, back types.ServerlessBackend) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var acl types.ServiceACL
+		if err := c.ShouldBindJSON(&acl); err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("The access control list is not valid: %v", err))
+			return
+		}
+		if err := acl.Validate(); err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("The access control list is not valid: %v", err))
+			return
+		}
+		service, ok := getManagedService(c, back, c.Param("serviceName"), types.ServiceRoleOwner)
+		if !ok {
+			return
+		}
+
+		previous := *service
+		service.ACL = &acl
+		if len(acl.Users) == 0 && len(acl.Groups) == 0 {
+			service.ACL = nil
+		}
+		if err := back.UpdateService(*service); err != nil {
+			c.String(http.StatusInternalServerError, fmt.Sprintf("Error updating the access control list: %v", err))
+			return
+		}
+		syncACLBucketPolicies(cfg, service, &previous)
+		c.JSON(http.StatusOK, acl)
+	}
+}
+
+// aclBucketGrants returns the buckets of the service each user of its access control list can access.
+// The users with the invoker role, at least, can read and write the buckets of the service to invoke it.
+// The roles of the OIDC groups are not granted, as MinIO doesn't know the groups of the users
+func aclBucketGrants(service *types.Service) map[string][]string {
+	grants := map[string][]string{}
+	if service == nil || service.ACL == nil {
+		return grants
+	}
+	buckets := collectMinIOBucketCandidates(service)
+	for uid, role := range service.ACL.Users {
+		if uid != service.Owner && types.ServiceRoleAllows(role, types.ServiceRoleInvoker) {
+			grants[uid] = buckets
+		}
+	}
+	return grants
+}
+
+// syncACLBucketPolicies adds the buckets of the service to the MinIO policies of the users of its access
+// control list, and removes the buckets of its previous definition from the users no longer granted.
+// Either definition can be nil, when the service is created or deleted. The errors are only logged, as
+// the users that never logged in have no MinIO user yet, and they are granted on the next update
+func syncACLBucketPolicies(cfg *types.Config, service *types.Service, previous *types.Service) {
+	grants := aclBucketGrants(service)
+	revoked := aclBucketGrants(previous)
+	if cfg.MinIOProvider == nil || (len(grants) == 0 && len(revoked) == 0) {
+		return
+	}
+	minIOAdminClient, err := utils.MakeMinIOAdminClient(cfg)
+	if err != nil {
+		aclLogger.Printf("Error creating the MinIO admin client: %v", err)
+		return
+	}
+
+	var errs []error
+	for uid, buckets := range revoked {
+		for _, bucket := range buckets {
+			if slices.Contains(grants[uid], bucket) || (service != nil && uid == service.Owner) {
+				continue
+			}
+			if minIOAdminClient.ResourceInPolicy(uid, bucket) {
+				errs = append(errs, minIOAdminClient.RemoveResource(bucket, uid, false))
+			}
+		}
+	}
+	for uid, buckets := range grants {
+		for _, bucket := range buckets {
+			if !minIOAdminClient.ResourceInPolicy(uid, bucket) {
+				errs = append(errs, minIOAdminClient.CreateAddPolicy(bucket, uid, utils.ALL_ACTIONS, false))
+			}
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		subject := service
+		if subject == nil {
+			subject = previous
+		}
+		aclLogger.Printf("WARNING: unable to update the access of the acl users to the buckets of service \"%s\": %v", subject.Name, err)
+	}
+}
@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/grycap/oscar/v4/pkg/backends"
+	"github.com/grycap/oscar/v4/pkg/types"
+	"github.com/grycap/oscar/v4/pkg/utils"
+	"github.com/grycap/oscar/v4/pkg/utils/auth"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	testclient "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestServiceACLHandlers(t *testing.T) {
+	back := backends.MakeFakeBackend()
+	kubeClient := testclient.NewSimpleClientset()
+	back.SetKubeClientset(kubeClient)
+	back.Service = &types.Service{Name: "svc", Namespace: "oscar-svc", Owner: "owner", Visibility: utils.PRIVATE}
+	cfg := types.Config{}
+	r := gin.Default()
+	// Authenticate the requests as the user and groups in the test headers
+	r.Use(func(c *gin.Context) {
+		c.Set("uidOrigin", c.GetHeader("X-Test-User"))
+		if groups := c.GetHeader("X-Test-Groups"); groups != "" {
+			auth.SetUserGroupsInContext(c, strings.Split(groups, ","))
+		}
+	})
+	r.GET("/system/services/:serviceName/acl", MakeReadServiceACLHandler(back))
+	r.PUT("/system/services/:serviceName/acl", MakeUpdateServiceACLHandler(&cfg, back))
+	r.GET("/system/services/:serviceName", MakeReadHandler(back, kubeClient, &cfg))
+	r.GET("/system/logs/:serviceName", MakeJobsInfoHandler(back, kubeClient, &cfg))
+	r.DELETE("/system/logs/:serviceName", MakeDeleteJobsHandler(back, kubeClient, &cfg))
+	r.POST("/system/services/:serviceName/restart", MakeRestartExposedServiceHandler(back, kubeClient, &cfg))
+	r.GET("/system/services/:serviceName/tokens", MakeListServiceTokensHandler(back, kubeClient))
+	r.DELETE("/system/services/:serviceName", MakeDeleteHandler(&cfg, back))
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPut, "/system/services/svc/acl", strings.NewReader(`{"users": {"student": "viewer"}, "groups": {"teachers": "editor"}}`))
+	req.Header.Set("Authorization", "Bearer oidc-token")
+	req.Header.Set("X-Test-User", "owner")
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if back.UpdatedService == nil || back.UpdatedService.ACL == nil || back.UpdatedService.ACL.Groups["teachers"] != types.ServiceRoleEditor {
+		t.Fatalf("expected the service to be updated with the acl, got %+v", back.UpdatedService)
+	}
+	back.Service = back.UpdatedService
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/system/services/svc/acl", nil)
+	req.Header.Set("Authorization", "Bearer oidc-token")
+	req.Header.Set("X-Test-User", "student")
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var acl types.ServiceACL
+	if err := json.Unmarshal(w.Body.Bytes(), &acl); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if acl.Users["student"] != types.ServiceRoleViewer {
+		t.Fatalf("unexpected acl: %+v", acl)
+	}
+
+	scenarios := []struct {
+		name   string
+		method string
+		path   string
+		user   string
+		groups string
+		body   string
+		code   int
+	}{
+		{"viewer reads the service", http.MethodGet, "/system/services/svc", "student", "", "", http.StatusOK},
+		{"viewer lists the jobs", http.MethodGet, "/system/logs/svc", "student", "", "", http.StatusOK},
+		{"viewer can't delete the jobs", http.MethodDelete, "/system/logs/svc", "student", "", "", http.StatusForbidden},
+		{"viewer can't restart the service", http.MethodPost, "/system/services/svc/restart", "student", "", "", http.StatusForbidden},
+		{"viewer can't share the service", http.MethodPut, "/system/services/svc/acl", "student", "", `{"users": {"student": "owner"}}`, http.StatusForbidden},
+		{"group editor deletes the jobs", http.MethodDelete, "/system/logs/svc", "teacher", "teachers", "", http.StatusNoContent},
+		{"group editor can't manage the tokens", http.MethodGet, "/system/services/svc/tokens", "teacher", "teachers", "", http.StatusForbidden},
+		{"group editor can't delete the service", http.MethodDelete, "/system/services/svc", "teacher", "teachers", "", http.StatusForbidden},
+		{"other users can't read the service", http.MethodGet, "/system/services/svc", "other", "others", "", http.StatusForbidden},
+		{"other users can't read the acl", http.MethodGet, "/system/services/svc/acl", "other", "", "", http.StatusForbidden},
+		{"invalid role", http.MethodPut, "/system/services/svc/acl", "owner", "", `{"users": {"student": "admin"}}`, http.StatusBadRequest},
+	}
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(s.method, s.path, strings.NewReader(s.body))
+			req.Header.Set("Authorization", "Bearer oidc-token")
+			req.Header.Set("X-Test-User", s.user)
+			req.Header.Set("X-Test-Groups", s.groups)
+			r.ServeHTTP(w, req)
+			if w.Code != s.code {
+				t.Errorf("expected %d, got %d: %s", s.code, w.Code, w.Body.String())
+			}
+		})
+	}
+
+	// An empty list removes the roles
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPut, "/system/services/svc/acl", strings.NewReader(`{}`))
+	req.Header.Set("Authorization", "Bearer oidc-token")
+	req.Header.Set("X-Test-User", "owner")
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if back.UpdatedService.ACL != nil {
+		t.Errorf("expected the acl to be removed, got %+v", back.UpdatedService.ACL)
+	}
+}
+
+func TestServiceACLJobScope(t *testing.T) {
+	suspend := false
+	back := backends.MakeFakeBackend()
+	back.Service = &types.Service{
+		Name:       "svc",
+		Namespace:  "oscar-svc",
+		Owner:      "owner",
+		Visibility: utils.PRIVATE,
+		ACL:        &types.ServiceACL{Users: map[string]string{"student": types.ServiceRoleInvoker, "teacher": types.ServiceRoleEditor}},
+	}
+	cfg := types.Config{ServicesNamespace: "oscar-svc"}
+	kubeClient := testclient.NewSimpleClientset(
+		&batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: "mine", Namespace: "oscar-svc", Labels: map[string]string{types.ServiceLabel: "svc", types.JobOwnerExecutionAnnotation: "student"}},
+			Spec:       batchv1.JobSpec{Suspend: &suspend},
+		},
+		&batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: "theirs", Namespace: "oscar-svc", Labels: map[string]string{types.ServiceLabel: "svc", types.JobOwnerExecutionAnnotation: "other"}},
+			Spec:       batchv1.JobSpec{Suspend: &suspend},
+		},
+	)
+	var selectors []string
+	kubeClient.PrependReactor("delete-collection", "jobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		selectors = append(selectors, action.(k8stesting.DeleteCollectionAction).GetListRestrictions().Labels.String())
+		return true, nil, nil
+	})
+	r := gin.Default()
+	r.Use(func(c *gin.Context) {
+		c.Set("uidOrigin", c.GetHeader("X-Test-User"))
+	})
+	r.DELETE("/system/logs/:serviceName", MakeDeleteJobsHandler(back, kubeClient, &cfg))
+	r.DELETE("/system/logs/:serviceName/:jobName", MakeDeleteJobHandler(back, kubeClient, &cfg))
+	r.POST("/system/logs/:serviceName/:jobName/cancel", MakeCancelJobHandler(back, kubeClient, &cfg))
+	r.POST("/system/logs/:serviceName/:jobName/suspend", MakeSuspendJobHandler(back, kubeClient, &cfg))
+	r.POST("/system/logs/:serviceName/:jobName/rerun", MakeRerunJobHandler(&cfg, kubeClient, back, nil))
+
+	// Invokers only manage the jobs they submitted, editors manage all of them
+	scenarios := []struct {
+		name   string
+		method string
+		path   string
+		user   string
+		code   int
+	}{
+		{"invoker can't cancel other jobs", http.MethodPost, "/system/logs/svc/theirs/cancel", "student", http.StatusForbidden},
+		{"invoker can't suspend other jobs", http.MethodPost, "/system/logs/svc/theirs/suspend", "student", http.StatusForbidden},
+		{"invoker can't rerun other jobs", http.MethodPost, "/system/logs/svc/theirs/rerun", "student", http.StatusForbidden},
+		{"invoker can't delete other jobs", http.MethodDelete, "/system/logs/svc/theirs", "student", http.StatusForbidden},
+		{"invoker cancels their jobs", http.MethodPost, "/system/logs/svc/mine/cancel", "student", http.StatusOK},
+		{"editor suspends other jobs", http.MethodPost, "/system/logs/svc/theirs/suspend", "teacher", http.StatusOK},
+		{"editor deletes other jobs", http.MethodDelete, "/system/logs/svc/theirs", "teacher", http.StatusNoContent},
+	}
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(s.method, s.path, strings.NewReader(""))
+			req.Header.Set("Authorization", "Bearer oidc-token")
+			req.Header.Set("X-Test-User", s.user)
+			r.ServeHTTP(w, req)
+			if w.Code != s.code {
+				t.Errorf("expected %d, got %d: %s", s.code, w.Code, w.Body.String())
+			}
+		})
+	}
+
+	for _, user := range []string{"student", "teacher"} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodDelete, "/system/logs/svc?all=true", nil)
+		req.Header.Set("Authorization", "Bearer oidc-token")
+		req.Header.Set("X-Test-User", user)
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("expected 204, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+	if len(selectors) != 2 || selectors[0] != "oscar.grycap/job-owner=student,oscar_service=svc" || selectors[1] != "oscar_service=svc" {
+		t.Errorf("expected the jobs of the invoker and all the jobs of the editor to be deleted, got %v", selectors)
+	}
+}
+
+func TestACLBucketGrants(t *testing.T) {
+	service := &types.Service{
+		Name:  "svc",
+		Owner: "owner",
+		Input: []types.StorageIOConfig{
+			{Provider: types.MinIOName + types.ProviderSeparator + types.DefaultProvider, Path: "svc/in"},
+		},
+		Output: []types.StorageIOConfig{
+			{Provider: types.MinIOName + types.ProviderSeparator + types.DefaultProvider, Path: "svc/out"},
+		},
+		ACL: &types.ServiceACL{
+			Users: map[string]string{
+				"owner":   types.ServiceRoleOwner,
+				"viewer":  types.ServiceRoleViewer,
+				"student": types.ServiceRoleInvoker,
+				"teacher": types.ServiceRoleEditor,
+			},
+			Groups: map[string]string{"teachers": types.ServiceRoleEditor},
+		},
+	}
+
+	grants := aclBucketGrants(service)
+	if len(grants) != 2 {
+		t.Fatalf("expected grants for the invoker and the editor, got %v", grants)
+	}
+	for _, uid := range []string{"student", "teacher"} {
+		if len(grants[uid]) != 1 || grants[uid][0] != "svc" {
+			t.Errorf("expected %s to be granted the bucket svc, got %v", uid, grants[uid])
+		}
+	}
+
+	if grants := aclBucketGrants(&types.Service{Name: "svc"}); len(grants) != 0 {
+		t.Errorf("expected no grants without acl, got %v", grants)
+	}
+	if grants := aclBucketGrants(nil); len(grants) != 0 {
+		t.Errorf("expected no grants without service, got %v", grants)
+	}
+}
@@ -0,0 +1,286 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/goccy/go-yaml"
+	"github.com/grycap/oscar/v4/pkg/types"
+	"github.com/grycap/oscar/v4/pkg/utils/auth"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// maxFDLSize maximum size in bytes of the FDL documents accepted by the apply handler
+const maxFDLSize = 10 * 1024 * 1024
+
+// Custom logger
+var applyLogger = log.New(os.Stdout, "[APPLY-HANDLER] ", log.Flags())
+
+// MakeApplyHandler godoc
+// @Summary Apply FDL
+// @Description Converge the caller's services to an OSCAR-CLI FDL document (YAML or JSON). Services are created, updated or left untouched in document order. With prune=true, services previously applied by the caller and missing from the document are deleted. Scripts must be provided inline.
+// @Tags services
+// @Accept json
+// @Accept application/x-yaml
+// @Produce json
+// @Param fdl body types.FDL true "FDL document"
+// @Param cluster query string false "Only apply the services defined for this cluster identifier"
+// @Param prune query bool false "Delete applied services missing from the document"
+// @Param dryRun query bool false "Only compute the actions"
+// @Success 200 {object} types.ApplyReport
+// @Success 207 {object} types.ApplyReport "Some actions failed"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 413 {string} string "Request Entity Too Large"
+// @Failure 500 {string} string "Internal Server Error"
+// @Security BasicAuth
+// @Security BearerAuth
+// @Router /system/apply [post]
+func MakeApplyHandler(cfg *types.Config, back types.ServerlessBackend) gin.HandlerFunc {
+	applier := MakeServiceApplier(cfg, back)
+
+	return func(c *gin.Context) {
+		raw, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxFDLSize))
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				c.String(http.StatusRequestEntityTooLarge, fmt.Sprintf("The FDL exceeds the maximum size of %d bytes", maxFDLSize))
+				return
+			}
+			c.String(http.StatusBadRequest, fmt.Sprintf("Error reading the FDL: %v", err))
+			return
+		}
+		// YAML is a superset of JSON, so both formats are accepted
+		var fdl types.FDL
+		if err := yaml.Unmarshal(raw, &fdl); err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("The FDL is not valid: %v", err))
+			return
+		}
+		desired, err := fdl.Services(c.Query("cluster"))
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("The FDL is not valid: %v", err))
+			return
+		}
+		prune, _ := strconv.ParseBool(c.Query("prune"))
+
+		owner := types.DefaultOwner
+		if isBearerRequest(c) {
+			uid, err := auth.GetUIDFromContext(c)
+			if err != nil || uid == "" {
+				c.String(http.StatusInternalServerError, "Couldn't find user identification")
+				return
+			}
+			owner = uid
+		}
+
+		existing, err := back.ListServices()
+		if err != nil {
+			c.String(http.StatusInternalServerError, fmt.Sprintf("Error listing services: %v", err))
+			return
+		}
+
+		report := &types.ApplyReport{DryRun: isDryRun(c)}
+		caller := makeServiceCaller(c)
+		steps := computeApplyActions(desired, existing, owner, prune)
+		for _, step := range steps {
+			if report.DryRun {
+				report.Results = append(report.Results, step.result)
+				continue
+			}
+			report.Results = append(report.Results, applier.run(caller, step))
+		}
+
+		if report.Failed() {
+			c.JSON(http.StatusMultiStatus, report)
+			return
+		}
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// ServiceApplier applies service definitions with the same create, update and delete
+// operations of the REST API, so every side effect (buckets, secrets, revisions...) is kept
+type ServiceApplier struct {
+	cfg  *types.Config
+	back types.ServerlessBackend
+}
+
+// MakeServiceApplier returns a new ServiceApplier
+func MakeServiceApplier(cfg *types.Config, back types.ServerlessBackend) *ServiceApplier {
+	return &ServiceApplier{
+		cfg:  cfg,
+		back: back,
+	}
+}
+
+// Apply creates or updates the service of an OSCARService resource as the cluster administrator,
+// doing nothing if it did not change. Existing services are only updated if they were created by the same resource.
+func (a *ServiceApplier) Apply(ctx context.Context, service types.Service) types.ServiceApplyResult {
+	existing, err := a.back.ListServicesByName(service.Name)
+	if err != nil && !k8sErrors.IsNotFound(err) {
+		return types.ServiceApplyResult{Service: service.Name, Status: http.StatusInternalServerError, Error: err.Error()}
+	}
+	resource := service.Annotations[types.OSCARServiceAnnotation]
+	for _, svc := range existing {
+		if resource == "" || svc.Annotations[types.OSCARServiceAnnotation] != resource {
+			return types.ServiceApplyResult{
+				Service: service.Name,
+				Action:  types.ApplyActionUpdate,
+				Status:  http.StatusConflict,
+				Error:   fmt.Sprintf("the service \"%s\" already exists and is not managed by this resource", service.Name),
+			}
+		}
+	}
+	steps := computeApplyActions([]types.Service{service}, existing, types.DefaultOwner, false)
+	return a.run(adminServiceCaller(ctx), steps[0])
+}
+
+// Delete deletes the service of an OSCARService resource, identified by its key, as the cluster administrator.
+// Nothing is done if the service does not exist or it was not created by the resource.
+func (a *ServiceApplier) Delete(ctx context.Context, name string, resource string) types.ServiceApplyResult {
+	existing, err := a.back.ListServicesByName(name)
+	if err != nil && !k8sErrors.IsNotFound(err) {
+		return types.ServiceApplyResult{Service: name, Action: types.ApplyActionDelete, Status: http.StatusInternalServerError, Error: err.Error()}
+	}
+	for _, svc := range existing {
+		if svc.Annotations[types.OSCARServiceAnnotation] == resource {
+			return a.run(adminServiceCaller(ctx), applyStep{result: types.ServiceApplyResult{Service: name, Action: types.ApplyActionDelete}, service: svc})
+		}
+	}
+	return types.ServiceApplyResult{Service: name, Action: types.ApplyActionNoOp}
+}
+
+// Observe returns the runtime status of the deployment and volume of an applied service
+func (a *ServiceApplier) Observe(service types.Service) (types.ServiceDeploymentStatus, types.ServiceVolumeStatus, error) {
+	current, err := a.back.ReadService(service.Namespace, service.Name)
+	if err != nil {
+		return types.ServiceDeploymentStatus{}, types.ServiceVolumeStatus{}, err
+	}
+	setVolumeStatus(a.back, current)
+	deployment, err := inspectDeploymentRuntimeStatusOnly(a.back, a.back.GetKubeClientset(), current, a.cfg)
+	return deployment, current.VolumeStatus, err
+}
+
+// run applies a computed step on behalf of the provided caller
+func (a *ServiceApplier) run(caller serviceCaller, step applyStep) types.ServiceApplyResult {
+	result := step.result
+	if result.Error != "" || result.Action == types.ApplyActionNoOp {
+		return result
+	}
+
+	var status int
+	var body string
+	switch result.Action {
+	case types.ApplyActionCreate:
+		status, body = createService(caller, a.cfg, a.back, *step.service)
+	case types.ApplyActionUpdate:
+		status, body = updateService(caller, a.cfg, a.back, *step.service)
+	case types.ApplyActionDelete:
+		namespace := ""
+		if step.service != nil {
+			namespace = step.service.Namespace
+		}
+		status, body = deleteService(caller, a.cfg, a.back, namespace, result.Service)
+	}
+	result.Status = status
+	if status >= http.StatusBadRequest {
+		result.Error = strings.TrimSpace(body)
+		if result.Error == "" {
+			result.Error = http.StatusText(status)
+		}
+		applyLogger.Printf("Error applying action '%s' to service '%s': %s", result.Action, result.Service, result.Error)
+	}
+	return result
+}
+
+type applyStep struct {
+	result  types.ServiceApplyResult
+	service *types.Service
+}
+
+// computeApplyActions compares the desired services with the existing ones.
+// Creates and updates keep the document order and deletions are appended at the end.
+func computeApplyActions(desired []types.Service, existing []*types.Service, owner string, prune bool) []applyStep {
+	current := make(map[string]*types.Service, len(existing))
+	for _, svc := range existing {
+		current[svc.Name] = svc
+	}
+
+	steps := []applyStep{}
+	inDocument := make(map[string]bool, len(desired))
+	for i := range desired {
+		service := desired[i]
+		inDocument[service.Name] = true
+		result := types.ServiceApplyResult{Service: service.Name, ClusterID: service.ClusterID}
+
+		hash, err := types.ApplyHash(service)
+		if err != nil {
+			result.Error = err.Error()
+			steps = append(steps, applyStep{result: result})
+			continue
+		}
+		annotations := make(map[string]string, len(service.Annotations)+2)
+		maps.Copy(annotations, service.Annotations)
+		annotations[types.AppliedFDLHashAnnotation] = hash
+		annotations[types.AppliedByAnnotation] = owner
+		service.Annotations = annotations
+
+		old, ok := current[service.Name]
+		switch {
+		case !ok:
+			result.Action = types.ApplyActionCreate
+		case owner != types.DefaultOwner && old.Owner != owner:
+			result.Action = types.ApplyActionUpdate
+			result.Status = http.StatusForbidden
+			result.Error = fmt.Sprintf("the service \"%s\" belongs to another user", service.Name)
+		case old.Annotations[types.AppliedFDLHashAnnotation] == hash && old.Annotations[types.AppliedByAnnotation] == owner:
+			result.Action = types.ApplyActionNoOp
+		default:
+			result.Action = types.ApplyActionUpdate
+		}
+		steps = append(steps, applyStep{result: result, service: &service})
+	}
+
+	// Only the services applied by the same caller are pruned, even for the administrator,
+	// and the services managed by an OSCARService resource are left to its controller
+	if prune {
+		for _, svc := range existing {
+			if inDocument[svc.Name] || svc.Annotations[types.AppliedByAnnotation] != owner {
+				continue
+			}
+			if svc.Annotations[types.OSCARServiceAnnotation] != "" {
+				continue
+			}
+			if owner != types.DefaultOwner && svc.Owner != owner {
+				continue
+			}
+			steps = append(steps, applyStep{result: types.ServiceApplyResult{Service: svc.Name, Action: types.ApplyActionDelete}})
+		}
+	}
+	return steps
+}
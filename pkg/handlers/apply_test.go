@@ -0,0 +1,292 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/grycap/oscar/v4/pkg/backends"
+	"github.com/grycap/oscar/v4/pkg/testsupport"
+	"github.com/grycap/oscar/v4/pkg/types"
+)
+
+const applyTestFDL = `functions:
+  oscar:
+  - oscar-cluster:
+      name: first
+      image: ghcr.io/grycap/cowsay
+      script: echo first
+  - oscar-cluster:
+      name: second
+      image: ghcr.io/grycap/cowsay
+      script: echo second
+  - other-cluster:
+      name: third
+      image: ghcr.io/grycap/cowsay
+      script: echo third
+`
+
+func TestComputeApplyActions(t *testing.T) {
+	var fdl types.FDL
+	fdl.Functions.Oscar = []map[string]*types.Service{
+		{"cluster": {Name: "new", Image: "image"}},
+		{"cluster": {Name: "same", Image: "image"}},
+		{"cluster": {Name: "changed", Image: "image:v2"}},
+		{"cluster": {Name: "foreign", Image: "image"}},
+	}
+	desired, err := fdl.Services("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sameHash, _ := types.ApplyHash(desired[1])
+	existing := []*types.Service{
+		{Name: "same", Owner: "user", Annotations: map[string]string{types.AppliedFDLHashAnnotation: sameHash, types.AppliedByAnnotation: "user"}},
+		{Name: "changed", Owner: "user", Annotations: map[string]string{types.AppliedFDLHashAnnotation: "old", types.AppliedByAnnotation: "user"}},
+		{Name: "foreign", Owner: "other"},
+		{Name: "removed", Owner: "user", Annotations: map[string]string{types.AppliedFDLHashAnnotation: "old", types.AppliedByAnnotation: "user"}},
+		{Name: "manual", Owner: "user"},
+		{Name: "applied-by-other", Owner: "other", Annotations: map[string]string{types.AppliedFDLHashAnnotation: "old", types.AppliedByAnnotation: "other"}},
+	}
+
+	steps := computeApplyActions(desired, existing, "user", true)
+	expected := []struct {
+		service string
+		action  string
+		failed  bool
+	}{
+		{"new", types.ApplyActionCreate, false},
+		{"same", types.ApplyActionNoOp, false},
+		{"changed", types.ApplyActionUpdate, false},
+		{"foreign", types.ApplyActionUpdate, true},
+		{"removed", types.ApplyActionDelete, false},
+	}
+	if len(steps) != len(expected) {
+		t.Fatalf("expected %d steps, got %+v", len(expected), steps)
+	}
+	for i, e := range expected {
+		result := steps[i].result
+		if result.Service != e.service || result.Action != e.action || (result.Error != "") != e.failed {
+			t.Errorf("step %d: expected %+v, got %+v", i, e, result)
+		}
+	}
+	if steps[0].service.Annotations[types.AppliedFDLHashAnnotation] == "" || steps[0].service.Annotations[types.AppliedByAnnotation] != "user" {
+		t.Errorf("expected the applied annotations to be set, got %v", steps[0].service.Annotations)
+	}
+
+	if steps := computeApplyActions(desired, existing, "user", false); len(steps) != 4 {
+		t.Errorf("expected no deletions without prune, got %+v", steps)
+	}
+
+	// The administrator only prunes its own applied services, not the ones managed by an OSCARService
+	existing = []*types.Service{
+		{Name: "user-applied", Owner: "user", Annotations: map[string]string{types.AppliedFDLHashAnnotation: "old", types.AppliedByAnnotation: "user"}},
+		{Name: "admin-applied", Owner: "user", Annotations: map[string]string{types.AppliedFDLHashAnnotation: "old", types.AppliedByAnnotation: types.DefaultOwner}},
+		{Name: "managed", Owner: types.DefaultOwner, Annotations: map[string]string{
+			types.AppliedFDLHashAnnotation: "old",
+			types.AppliedByAnnotation:      types.DefaultOwner,
+			types.OSCARServiceAnnotation:   "default/managed",
+		}},
+	}
+	steps = computeApplyActions(nil, existing, types.DefaultOwner, true)
+	if len(steps) != 1 || steps[0].result.Service != "admin-applied" || steps[0].result.Action != types.ApplyActionDelete {
+		t.Errorf("expected only the service applied by the administrator to be pruned, got %+v", steps)
+	}
+}
+
+func TestFDLServicesMergesStorageProviders(t *testing.T) {
+	fdl := types.FDL{
+		StorageProviders: &types.StorageProviders{
+			S3: map[string]*types.S3Provider{"shared": {Region: "us-east-1"}},
+		},
+	}
+	fdl.Functions.Oscar = []map[string]*types.Service{
+		{"cluster": {Name: "svc", StorageProviders: &types.StorageProviders{
+			S3: map[string]*types.S3Provider{"own": {Region: "eu-west-1"}},
+		}}},
+		{"cluster": {Name: "svc"}},
+	}
+	if _, err := fdl.Services(""); err == nil {
+		t.Fatal("expected an error for duplicated service names")
+	}
+
+	fdl.Functions.Oscar = fdl.Functions.Oscar[:1]
+	services, err := fdl.Services("cluster")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(services) != 1 || services[0].ClusterID != "cluster" {
+		t.Fatalf("unexpected services: %+v", services)
+	}
+	if len(services[0].StorageProviders.S3) != 2 {
+		t.Fatalf("expected merged storage providers, got %+v", services[0].StorageProviders.S3)
+	}
+}
+
+func TestMakeApplyHandlerDryRun(t *testing.T) {
+	back := backends.MakeFakeBackend()
+	back.Services = []*types.Service{{Name: "second", Owner: types.DefaultOwner}}
+	cfg := &types.Config{ServicesNamespace: "oscar-svc", MinIOProvider: &types.MinIOProvider{}}
+
+	r := gin.New()
+	r.POST("/system/apply", MakeApplyHandler(cfg, back))
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/system/apply?cluster=oscar-cluster&dryRun=true", strings.NewReader(applyTestFDL))
+	req.Header.Set("Content-Type", "application/x-yaml")
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var report types.ApplyReport
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if !report.DryRun || len(report.Results) != 2 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if report.Results[0].Action != types.ApplyActionCreate || report.Results[1].Action != types.ApplyActionUpdate {
+		t.Fatalf("unexpected actions: %+v", report.Results)
+	}
+	if back.CreatedService != nil || back.UpdatedService != nil {
+		t.Fatal("dry-run must not modify services")
+	}
+}
+
+func TestMakeApplyHandlerCreate(t *testing.T) {
+	testsupport.SkipIfCannotListen(t)
+	back := backends.MakeFakeBackend()
+
+	// Fake MinIO server accepting the webhook registration
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, hreq *http.Request) {
+		if hreq.URL.Path == "/minio/admin/v3/info" {
+			rw.Write([]byte(`{"Mode": "local", "Region": "us-east-1"}`))
+			return
+		}
+		rw.Write([]byte(`{"status": "success"}`))
+	}))
+	defer server.Close()
+
+	cfg := &types.Config{
+		ServicesNamespace: "oscar-svc",
+		MinIOProvider: &types.MinIOProvider{
+			Endpoint:  server.URL,
+			Region:    "us-east-1",
+			AccessKey: "minioadmin",
+			SecretKey: "minioadmin",
+		},
+	}
+
+	r := gin.New()
+	r.POST("/system/apply", MakeApplyHandler(cfg, back))
+
+	fdl := `{"functions": {"oscar": [{"oscar-cluster": {"name": "first", "image": "ghcr.io/grycap/cowsay", "script": "echo first"}}]}}`
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/system/apply", strings.NewReader(fdl))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if back.CreatedService == nil || back.CreatedService.Name != "first" {
+		t.Fatalf("expected service to be created, got %+v", back.CreatedService)
+	}
+	if back.CreatedService.ClusterID != "oscar-cluster" || back.CreatedService.Annotations[types.AppliedFDLHashAnnotation] == "" {
+		t.Fatalf("unexpected created service: %+v", back.CreatedService)
+	}
+}
+
+func TestMakeApplyHandlerInvalidFDL(t *testing.T) {
+	back := backends.MakeFakeBackend()
+	r := gin.New()
+	r.POST("/system/apply", MakeApplyHandler(&types.Config{}, back))
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/system/apply", strings.NewReader("functions: [invalid"))
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestMakeApplyHandlerFDLTooLarge(t *testing.T) {
+	back := backends.MakeFakeBackend()
+	r := gin.New()
+	r.POST("/system/apply", MakeApplyHandler(&types.Config{}, back))
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/system/apply", strings.NewReader(strings.Repeat("#", maxFDLSize+1)))
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestServiceApplierNoOp(t *testing.T) {
+	service := types.Service{Name: "svc", Image: "image", Annotations: map[string]string{types.OSCARServiceAnnotation: "ns/svc"}}
+	hash, _ := types.ApplyHash(service)
+
+	back := backends.MakeFakeBackend()
+	back.Services = []*types.Service{{Name: "svc", Owner: "someone", Annotations: map[string]string{
+		types.AppliedFDLHashAnnotation: hash,
+		types.AppliedByAnnotation:      types.DefaultOwner,
+		types.OSCARServiceAnnotation:   "ns/svc",
+	}}}
+	applier := MakeServiceApplier(&types.Config{}, back)
+
+	result := applier.Apply(context.Background(), service)
+	if result.Action != types.ApplyActionNoOp || result.Error != "" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if back.UpdatedService != nil || back.CreatedService != nil {
+		t.Fatal("expected no changes for an unchanged service")
+	}
+
+	result = applier.Delete(context.Background(), "missing", "ns/missing")
+	if result.Action != types.ApplyActionNoOp || back.DeletedService != nil {
+		t.Fatalf("expected no deletion for a missing service, got %+v", result)
+	}
+}
+
+func TestServiceApplierIgnoresUnmanagedServices(t *testing.T) {
+	back := backends.MakeFakeBackend()
+	back.Services = []*types.Service{{Name: "svc", Owner: "someone", Image: "image"}}
+	applier := MakeServiceApplier(&types.Config{}, back)
+
+	service := types.Service{Name: "svc", Image: "other", Annotations: map[string]string{types.OSCARServiceAnnotation: "ns/svc"}}
+	result := applier.Apply(context.Background(), service)
+	if result.Status != http.StatusConflict || result.Error == "" {
+		t.Fatalf("expected a conflict for a service not created by the resource, got %+v", result)
+	}
+	if back.UpdatedService != nil {
+		t.Fatal("expected the existing service not to be updated")
+	}
+
+	result = applier.Delete(context.Background(), "svc", "ns/svc")
+	if result.Action != types.ApplyActionNoOp || back.DeletedService != nil {
+		t.Fatalf("expected the existing service not to be deleted, got %+v", result)
+	}
+}
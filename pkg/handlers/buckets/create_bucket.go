@@ -40,7 +40,6 @@ const (
 
 // Custom logger
 var createLogger = log.New(os.Stdout, "[CREATE-BUCKETS-HANDLER] ", log.Flags())
-var isAdminUser = false
 
 // MakeCreateHandler godoc
 // @Summary Create bucket
@@ -64,7 +63,7 @@ func MakeCreateHandler(cfg *types.Config, kubeClientset kubernetes.Interface) gi
 			return
 
 		}
-		isAdminUser = false
+		isAdminUser := false
 		uid = cfg.Name
 
 		authHeader := c.GetHeader("Authorization")
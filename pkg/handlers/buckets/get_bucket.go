@@ -19,6 +19,7 @@ package buckets
 import (
 	"fmt"
 	"net/http"
+	"slices"
 	"strings"
 
 	"github.com/aws/aws-sdk-go/service/s3"
@@ -95,9 +96,22 @@ func MakeGetHandler(cfg *types.Config) gin.HandlerFunc {
 			}
 		}
 
-		if !isAdmin && visibility == "" {
-			c.String(http.StatusForbidden, fmt.Sprintf("User '%s' is not authorised", requester))
-			return
+		if !isAdmin {
+			allowed := requester == ownerCandidate
+			if !allowed {
+				switch visibility {
+				case utils.PUBLIC:
+					allowed = true
+				case utils.RESTRICTED:
+					allowed = slices.Contains(allowedUsers, requester) || adminClient.ResourceInPolicy(requester, bucketName)
+				default:
+					allowed = adminClient.ResourceInPolicy(requester, bucketName)
+				}
+			}
+			if !allowed {
+				c.String(http.StatusForbidden, fmt.Sprintf("User '%s' is not authorised", requester))
+				return
+			}
 		}
 
 		pageToken := c.DefaultQuery("page", "")
@@ -469,3 +469,79 @@ func TestMakeGetBucketHandlerPagination(t *testing.T) {
 	// Close the fake MinIO server
 	defer server.Close()
 }
+
+func TestMakeGetBucketHandlerPrivateBucket(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	testsupport.SkipIfCannotListen(t)
+
+	tests := []struct {
+		name     string
+		policies map[string]string
+		expected int
+	}{
+		{
+			name:     "granted",
+			policies: map[string]string{types.DefaultOwner: "demo", "bob": "demo"},
+			expected: http.StatusOK,
+		},
+		{
+			name:     "not granted",
+			policies: map[string]string{types.DefaultOwner: "demo", "bob": "other"},
+			expected: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodGet && r.URL.Path == "/demo" &&
+					r.URL.RawQuery == "list-type=2&max-keys=0" {
+					w.WriteHeader(http.StatusOK)
+					_, _ = w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+						<ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+							<Name>demo</Name>
+							<KeyCount>0</KeyCount>
+							<IsTruncated>false</IsTruncated>
+						</ListBucketResult>`))
+					return
+				} else if r.Method == http.MethodGet && r.URL.Path == "/minio/admin/v3/info-canned-policy" {
+					resource := tt.policies[r.URL.Query().Get("name")]
+					if resource == "" {
+						resource = "other"
+					}
+					w.WriteHeader(http.StatusOK)
+					_, _ = w.Write([]byte(`{"PolicyName": "p", "Policy": {"Version": "version","Statement": [{"Resource": ["arn:aws:s3:::` + resource + `/*"]}]}}`))
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+				_, _ = w.Write([]byte(`{"status":"success"}`))
+			}))
+			defer server.Close()
+
+			cfg := &types.Config{
+				MinIOProvider: &types.MinIOProvider{
+					Endpoint:  server.URL,
+					Region:    "us-east-1",
+					AccessKey: "minioadmin",
+					SecretKey: "minioadmin",
+					Verify:    false,
+				},
+			}
+
+			router := gin.New()
+			router.Use(func(c *gin.Context) {
+				c.Set("uidOrigin", "bob")
+			})
+			router.GET("/system/buckets/:bucket", MakeGetHandler(cfg))
+
+			req := httptest.NewRequest(http.MethodGet, "/system/buckets/demo", nil)
+			req.Header.Set("Authorization", "Bearer token")
+			res := httptest.NewRecorder()
+			router.ServeHTTP(res, req)
+
+			if res.Code != tt.expected {
+				t.Fatalf("expected status %d, got %d: %s", tt.expected, res.Code, res.Body.String())
+			}
+		})
+	}
+}
@@ -44,12 +44,10 @@ func MakeListHandler(cfg *types.Config) gin.HandlerFunc {
 	return func(c *gin.Context) {
 
 		authHeader := c.GetHeader("Authorization")
-		isAdminUser = false
 		var uid string
 		var err error
 		var bucketsList *s3.ListBucketsOutput
 		if len(strings.Split(authHeader, "Bearer")) == 1 {
-			isAdminUser = true
 			bucketsList, err = listUserBuckets(cfg.MinIOProvider.GetS3Client())
 			if err != nil {
 				c.JSON(http.StatusInternalServerError, err)
@@ -82,7 +82,7 @@ func MakeUpdateHandler(cfg *types.Config) gin.HandlerFunc {
 			return
 		}
 		isService, _ := strconv.ParseBool(metadata["service"])
-		if isService {
+		if isService || metadata["from_service"] != "" {
 			c.String(http.StatusForbidden, fmt.Sprintln("Forbidden action: A bucket from a service can't be modified"))
 			return
 		}
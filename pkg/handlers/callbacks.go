@@ -0,0 +1,142 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/grycap/oscar/v4/pkg/types"
+	"github.com/grycap/oscar/v4/pkg/utils"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// callbackWorkers number of callback notifications delivered concurrently
+	callbackWorkers = 10
+	// callbackQueueSize maximum number of callback notifications waiting to be delivered
+	callbackQueueSize = 1000
+)
+
+// callbackDelivery callback notification waiting to be delivered
+type callbackDelivery struct {
+	jobName      string
+	url          string
+	allowedHosts []string
+	id           string
+	token        string
+	body         []byte
+}
+
+var (
+	// callbackQueue notifications delivered in the background, so the slow receivers don't block the job watcher
+	callbackQueue = make(chan callbackDelivery, callbackQueueSize)
+	// callbackWorkersStarted starts the workers delivering the notifications once
+	callbackWorkersStarted sync.Once
+	// callbackDeliveries notifications queued and not delivered yet
+	callbackDeliveries sync.WaitGroup
+)
+
+// deliverCallbacks sends the queued notifications
+func deliverCallbacks() {
+	for delivery := range callbackQueue {
+		if err := utils.SendCallback(context.Background(), delivery.url, delivery.allowedHosts, delivery.id, delivery.token, delivery.body); err != nil {
+			jobLogger.Printf("Error notifying the end of job \"%s\": %v", delivery.jobName, err)
+		}
+		callbackDeliveries.Done()
+	}
+}
+
+// MakeJobCallbackNotifier returns a finished job handler that notifies the callbacks of the service and the
+// callback URL of the invocation. Notifications are signed with the service token and delivered in the
+// background. The deliveries that fail after their retries, or that don't fit in the queue, are logged
+// and not attempted again.
+func MakeJobCallbackNotifier(cfg *types.Config, back types.ServerlessBackend, kubeClientset kubernetes.Interface) func(ctx context.Context, job *batchv1.Job) error {
+	callbackWorkersStarted.Do(func() {
+		for range callbackWorkers {
+			go deliverCallbacks()
+		}
+	})
+
+	return func(ctx context.Context, job *batchv1.Job) error {
+		serviceName := job.Labels[types.ServiceLabel]
+		service, err := back.ReadService(job.Namespace, serviceName)
+		if err != nil {
+			// The jobs of deleted services are not notified
+			if errors.IsNotFound(err) || errors.IsGone(err) {
+				return nil
+			}
+			return err
+		}
+
+		callbacks := service.Callbacks
+		if callbackURL := job.Annotations[types.CallbackURLAnnotation]; callbackURL != "" {
+			callbacks = append(callbacks, types.ServiceCallback{URL: callbackURL})
+		}
+		if len(callbacks) == 0 {
+			return nil
+		}
+
+		pods, err := listJobPods(ctx, kubeClientset, job.Namespace, serviceName, job.Name)
+		if err != nil {
+			return err
+		}
+		info := buildJobInfo(job, pods)
+		notification := types.JobCallback{
+			JobName:   job.Name,
+			Service:   serviceName,
+			Namespace: job.Namespace,
+			JobInfo:   *info,
+			Outputs:   jobOutputs(ctx, kubeClientset, job.Namespace, serviceName, job.Name),
+		}
+		if info.StartTime != nil && info.FinishTime != nil {
+			notification.DurationSeconds = info.FinishTime.Sub(info.StartTime.Time).Seconds()
+		}
+		body, err := json.Marshal(notification)
+		if err != nil {
+			return err
+		}
+
+		deliveryID := string(job.UID)
+		if deliveryID == "" {
+			deliveryID = job.Namespace + "/" + job.Name
+		}
+		for _, callback := range callbacks {
+			if !callback.Notifies(info.Status) {
+				continue
+			}
+			callbackDeliveries.Add(1)
+			select {
+			case callbackQueue <- callbackDelivery{
+				jobName:      job.Name,
+				url:          callback.URL,
+				allowedHosts: cfg.CallbackAllowedHosts,
+				id:           deliveryID,
+				token:        service.Token,
+				body:         body,
+			}:
+			default:
+				callbackDeliveries.Done()
+				jobLogger.Printf("Error notifying the end of job \"%s\": too many pending callback notifications", job.Name)
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/grycap/oscar/v4/pkg/backends"
+	"github.com/grycap/oscar/v4/pkg/testsupport"
+	"github.com/grycap/oscar/v4/pkg/types"
+	"github.com/grycap/oscar/v4/pkg/utils"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	testclient "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestMakeJobCallbackNotifier(t *testing.T) {
+	testsupport.SkipIfCannotListen(t)
+
+	var mutex sync.Mutex
+	received := map[string]types.JobCallback{}
+	var signature string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		var notification types.JobCallback
+		_ = json.Unmarshal(body, &notification)
+		mutex.Lock()
+		defer mutex.Unlock()
+		received[req.URL.Path] = notification
+		if req.URL.Path == "/invocation" {
+			signature = req.Header.Get(types.CallbackSignatureHeader)
+			if signature != utils.SignCallback("token", body) {
+				rw.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+		}
+		rw.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	back := backends.MakeFakeBackend()
+	back.Service = &types.Service{
+		Name:  "test",
+		Token: "token",
+		Callbacks: []types.ServiceCallback{
+			{URL: server.URL + "/service"},
+			{URL: server.URL + "/failed", On: []string{"Failed"}},
+		},
+	}
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "job",
+			Namespace:   "ns",
+			UID:         "uid",
+			Labels:      map[string]string{types.ServiceLabel: "test"},
+			Annotations: map[string]string{types.CallbackURLAnnotation: server.URL + "/invocation"},
+		},
+		Status: batchv1.JobStatus{
+			Conditions: []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}},
+		},
+	}
+	cfg := types.Config{CallbackAllowedHosts: []string{"127.0.0.1"}}
+	if err := MakeJobCallbackNotifier(&cfg, back, testclient.NewSimpleClientset(job))(context.Background(), job); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	callbackDeliveries.Wait()
+
+	if len(received) != 2 {
+		t.Fatalf("expected notifications to the service and invocation callbacks, got %v", received)
+	}
+	notification := received["/service"]
+	if notification.JobName != "job" || notification.Service != "test" || notification.Namespace != "ns" || notification.Status != "Succeeded" {
+		t.Errorf("unexpected notification: %+v", notification)
+	}
+	if _, ok := received["/invocation"]; !ok || signature == "" {
+		t.Errorf("expected a signed notification to the invocation callback")
+	}
+}
+
+func TestMakeJobCallbackNotifierNoCallbacks(t *testing.T) {
+	back := backends.MakeFakeBackend()
+	back.Service = &types.Service{Name: "test", Token: "token"}
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "job", Namespace: "ns", Labels: map[string]string{types.ServiceLabel: "test"}},
+	}
+	if err := MakeJobCallbackNotifier(&types.Config{}, back, testclient.NewSimpleClientset())(context.Background(), job); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"time"
+
+	"github.com/grycap/oscar/v4/pkg/types"
+	"github.com/grycap/oscar/v4/pkg/utils"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// MakeJobCloudEventEmitter returns a finished job handler that sends a CloudEvent with the status of the job to the CloudEventsSink.
+// The status and the service are also set as the "oscarstatus" and "oscarservice" extensions to allow filtering them in brokers.
+func MakeJobCloudEventEmitter(cfg *types.Config, kubeClientset kubernetes.Interface) func(ctx context.Context, job *batchv1.Job) error {
+	return func(ctx context.Context, job *batchv1.Job) error {
+		serviceName := job.Labels[types.ServiceLabel]
+		pods, err := listJobPods(ctx, kubeClientset, job.Namespace, serviceName, job.Name)
+		if err != nil {
+			return err
+		}
+		info := buildJobInfo(job, pods)
+		data, err := json.Marshal(types.JobFinishedEventData{
+			Name:      job.Name,
+			Service:   serviceName,
+			Namespace: job.Namespace,
+			Owner:     job.Labels[types.JobOwnerExecutionAnnotation],
+			JobInfo:   *info,
+		})
+		if err != nil {
+			return err
+		}
+
+		finishTime := time.Now().UTC()
+		if info.FinishTime != nil {
+			finishTime = info.FinishTime.UTC()
+		}
+		id := string(job.UID)
+		if id == "" {
+			id = job.Namespace + "/" + job.Name
+		}
+		return utils.SendCloudEvent(ctx, cfg.CloudEventsSink, &types.CloudEvent{
+			ID:              id,
+			Source:          path.Join("/oscar", cfg.Name, "services", serviceName),
+			Type:            types.JobFinishedCloudEventType,
+			Subject:         job.Name,
+			Time:            finishTime.Format(time.RFC3339),
+			DataContentType: "application/json",
+			Extensions: map[string]string{
+				"oscarservice": serviceName,
+				"oscarstatus":  info.Status,
+			},
+			Data: data,
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/grycap/oscar/v4/pkg/testsupport"
+	"github.com/grycap/oscar/v4/pkg/types"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	testclient "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestMakeJobCloudEventEmitter(t *testing.T) {
+	testsupport.SkipIfCannotListen(t)
+
+	var header http.Header
+	var data types.JobFinishedEventData
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		header = req.Header
+		body, _ := io.ReadAll(req.Body)
+		_ = json.Unmarshal(body, &data)
+		rw.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "job",
+			Namespace: "ns",
+			UID:       "uid",
+			Labels:    map[string]string{types.ServiceLabel: "test", types.JobOwnerExecutionAnnotation: "user"},
+		},
+		Status: batchv1.JobStatus{
+			Conditions: []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: "BackoffLimitExceeded"}},
+		},
+	}
+	cfg := &types.Config{Name: "oscar", CloudEventsSink: server.URL}
+	if err := MakeJobCloudEventEmitter(cfg, testclient.NewSimpleClientset(job))(context.Background(), job); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if header.Get("Ce-Specversion") != "1.0" || header.Get("Ce-Id") != "uid" || header.Get("Ce-Type") != types.JobFinishedCloudEventType {
+		t.Errorf("unexpected headers: %v", header)
+	}
+	if header.Get("Ce-Source") != "/oscar/oscar/services/test" || header.Get("Ce-Subject") != "job" || header.Get("Content-Type") != "application/json" {
+		t.Errorf("unexpected headers: %v", header)
+	}
+	if header.Get("Ce-Oscarservice") != "test" || header.Get("Ce-Oscarstatus") != "Failed" {
+		t.Errorf("unexpected extensions: %v", header)
+	}
+	if data.Name != "job" || data.Service != "test" || data.Owner != "user" || data.Status != "Failed" {
+		t.Errorf("unexpected data: %+v", data)
+	}
+}
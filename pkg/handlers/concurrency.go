@@ -0,0 +1,151 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/grycap/oscar/v4/pkg/types"
+	"github.com/grycap/oscar/v4/pkg/utils"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// holdJob makes the job wait for a free slot of the MaxConcurrentJobs limit of its service.
+// The job is created suspended and out of the Kueue LocalQueue of the service, so Kueue does not admit it,
+// and is released by the HeldJobReleaser controller. Every job of a limited service is created held.
+func holdJob(job *batchv1.Job) {
+	job.Labels = maps.Clone(job.Labels)
+	if job.Labels == nil {
+		job.Labels = map[string]string{}
+	}
+	job.Labels[types.JobHeldLabel] = strconv.FormatInt(time.Now().UnixNano(), 10)
+	delete(job.Labels, utils.KueueQueueNameLabel)
+	suspend := true
+	job.Spec.Suspend = &suspend
+}
+
+// releaseHeldJobs releases the held jobs of the service, in the order they were queued, while the
+// service has less running jobs than its MaxConcurrentJobs limit. All of them are released if the
+// service is no longer limited. The jobs of the service are read from the cache of the controller
+// running the releases, so a slightly outdated state only delays a release or repeats a previous one.
+func releaseHeldJobs(ctx context.Context, cfg *types.Config, kubeClientset kubernetes.Interface, service *types.Service, jobs []*batchv1.Job) error {
+	var queue []*batchv1.Job
+	running := 0
+	for _, job := range jobs {
+		switch {
+		case types.JobHeld(job):
+			if waitingForRelease(job) {
+				queue = append(queue, job)
+			}
+		case !types.JobStopped(job):
+			running++
+		}
+	}
+	if len(queue) == 0 {
+		return nil
+	}
+	slices.SortStableFunc(queue, func(a, b *batchv1.Job) int {
+		return cmp.Compare(heldSince(a), heldSince(b))
+	})
+
+	free := len(queue)
+	if service.MaxConcurrentJobs > 0 {
+		free = min(free, service.MaxConcurrentJobs-running)
+	}
+	for i := 0; i < free; i++ {
+		if err := releaseJob(ctx, cfg, kubeClientset, service, queue[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// releaseJob lets a held job run, pointing it to the LocalQueue of the service if Kueue is enabled
+func releaseJob(ctx context.Context, cfg *types.Config, kubeClientset kubernetes.Interface, service *types.Service, job *batchv1.Job) error {
+	kueueJob := service.Owner != types.DefaultOwner && cfg.KueueEnable
+	err := updateJob(ctx, kubeClientset, job.Namespace, job.Name, func(job *batchv1.Job) {
+		delete(job.Labels, types.JobHeldLabel)
+		// Kueue unsuspends the job once it is admitted
+		if kueueJob {
+			job.Labels[utils.KueueQueueNameLabel] = utils.BuildLocalQueueName(service.Name)
+		} else {
+			suspend := false
+			job.Spec.Suspend = &suspend
+		}
+	})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// countQueuedJobs returns the number of held jobs of the service waiting to be released
+func countQueuedJobs(ctx context.Context, kubeClientset kubernetes.Interface, namespace string, serviceName string) (int, error) {
+	jobs, err := kubeClientset.BatchV1().Jobs(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s,%s", types.ServiceLabel, serviceName, types.JobHeldLabel),
+	})
+	if err != nil {
+		return 0, err
+	}
+	queued := 0
+	for i := range jobs.Items {
+		if waitingForRelease(&jobs.Items[i]) {
+			queued++
+		}
+	}
+	return queued, nil
+}
+
+// waitingForRelease returns true if a held job is released when a slot is free.
+// Jobs cancelled or suspended by their users, or already finished, are kept held
+func waitingForRelease(job *batchv1.Job) bool {
+	return !types.JobCancelled(job) && !types.JobSuspendedByUser(job) && !types.JobFinished(job)
+}
+
+// heldSince returns the time a held job was queued, comparable between jobs
+func heldSince(job *batchv1.Job) int64 {
+	since, err := strconv.ParseInt(job.Labels[types.JobHeldLabel], 10, 64)
+	if err != nil {
+		return job.CreationTimestamp.UnixNano()
+	}
+	return since
+}
+
+// MakeHeldJobReleaser returns the function releasing the held jobs of a service, run by the HeldJobReleaser
+// controller with the jobs of the service in its cache
+func MakeHeldJobReleaser(cfg *types.Config, kubeClientset kubernetes.Interface, back types.ServerlessBackend) func(ctx context.Context, namespace string, serviceName string, jobs []*batchv1.Job) error {
+	return func(ctx context.Context, namespace string, serviceName string, jobs []*batchv1.Job) error {
+		service, err := back.ReadService(namespace, serviceName)
+		if err != nil {
+			// The held jobs of deleted services are deleted with them
+			if errors.IsNotFound(err) || errors.IsGone(err) {
+				return nil
+			}
+			return err
+		}
+		return releaseHeldJobs(ctx, cfg, kubeClientset, service, jobs)
+	}
+}
@@ -24,6 +24,7 @@ import (
 	"net/http"
 	"os"
 	"reflect"
+	"slices"
 	"strings"
 
 	"github.com/aws/aws-sdk-go/service/s3"
@@ -47,7 +48,6 @@ var errInput = errors.New("unrecognized input (valid inputs are MinIO and dCache
 
 // Custom logger
 var createLogger = log.New(os.Stdout, "[CREATE-HANDLER] ", log.Flags())
-var isAdminUser = false
 
 // MakeCreateHandler godoc
 // @Summary Create service
@@ -56,7 +56,9 @@ var isAdminUser = false
 // @Accept json
 // @Produce json
 // @Param service body types.Service true "Service definition"
+// @Param dryRun query bool false "Validate and render the service without creating it"
 // @Success 201 {string} string "Created"
+// @Success 200 {object} types.ServicePlan "Dry-run plan"
 // @Failure 400 {string} string "Bad Request"
 // @Failure 401 {string} string "Unauthorized"
 // @Failure 500 {string} string "Internal Server Error"
@@ -66,8 +68,6 @@ var isAdminUser = false
 func MakeCreateHandler(cfg *types.Config, back types.ServerlessBackend) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var service types.Service
-		isAdminUser = false
-		authHeader := c.GetHeader("Authorization")
 		//Error creating the service: Service.serving.knative.dev "cowsay-s" is invalid: metadata.labels:
 		//  Invalid value: "platform-access:vo.ai4eosc.eu": a valid label must be an empty string or
 		// consist of alphanumeric characters, '-', '_' or '.', and must start and end with an alphanumeric character
@@ -76,389 +76,403 @@ func MakeCreateHandler(cfg *types.Config, back types.ServerlessBackend) gin.Hand
 			c.String(http.StatusBadRequest, fmt.Sprintf("The service specification is not valid: %v", err))
 			return
 		}
-		if len(strings.Split(authHeader, "Bearer")) == 1 {
-			isAdminUser = true
-			service.Owner = types.DefaultOwner
-			createLogger.Printf("Creating service '%s' for user '%s'", service.Name, service.Owner)
-		}
-		rawInput := cloneStorageIOConfigs(service.Input)
-		rawOutput := cloneStorageIOConfigs(service.Output)
-		if err := normalizeStoragePaths(&service); err != nil {
-			c.String(http.StatusBadRequest, err.Error())
+		if isDryRun(c) {
+			dryRunService(c, cfg, back, &service, planOperationCreate)
 			return
 		}
-		service.AllowedUsers = sanitizeUsers(service.AllowedUsers)
-		service.Script = utils.NormalizeLineEndings(service.Script)
+		status, message := createService(makeServiceCaller(c), cfg, back, service)
+		writeServiceResponse(c, status, message)
+	}
+}
 
-		// Check service values and set defaults
-		checkValues(&service, cfg)
-		if err := utils.ValidateVolumeConfig(service.Name, service.Volume); err != nil {
-			c.String(http.StatusBadRequest, fmt.Sprintf("The service specification is not valid: %v", err))
-			return
+// createService creates the service on behalf of the caller, returning the status and message of the response.
+// The first error stops the creation and is returned. If the buckets cannot be created, the service is deleted.
+func createService(caller serviceCaller, cfg *types.Config, back types.ServerlessBackend, service types.Service) (int, string) {
+	isAdminUser := caller.isAdmin()
+	authHeader := caller.authHeader
+	if isAdminUser {
+		service.Owner = types.DefaultOwner
+		createLogger.Printf("Creating service '%s' for user '%s'", service.Name, service.Owner)
+	}
+	rawInput := cloneStorageIOConfigs(service.Input)
+	rawOutput := cloneStorageIOConfigs(service.Output)
+	if err := normalizeStoragePaths(&service); err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	service.AllowedUsers = sanitizeUsers(service.AllowedUsers)
+	service.Script = utils.NormalizeLineEndings(service.Script)
+
+	// Check service values and set defaults
+	checkValues(&service, cfg)
+	if errs := validateServiceSpec(&service, cfg); len(errs) > 0 {
+		return http.StatusBadRequest, fmt.Sprintf("The service specification is not valid: %v", errs[0])
+	}
+	// Check if users in allowed_users have a MinIO associated user
+	minIOAdminClient, minIOAdminErr := utils.MakeMinIOAdminClient(cfg)
+
+	// Service is created by an EGI user
+	var uid string
+	var err error
+	var mc *auth.MultitenancyConfig
+	var minIOQuota *types.MinIOQuotaUpdate
+	namespace := cfg.ServicesNamespace
+	if !isAdminUser {
+		uid = caller.uid
+		if uid == "" {
+			return http.StatusInternalServerError, fmt.Sprintln("Couldn't find user identification")
 		}
-		// Check if users in allowed_users have a MinIO associated user
-		minIOAdminClient, minIOAdminErr := utils.MakeMinIOAdminClient(cfg)
-
-		// Service is created by an EGI user
-		var uid string
-		var err error
-		var mc *auth.MultitenancyConfig
-		var minIOQuota *types.MinIOQuotaUpdate
-		namespace := cfg.ServicesNamespace
-		if !isAdminUser {
-			uid, err = auth.GetUIDFromContext(c)
-			if err != nil {
-				c.String(http.StatusInternalServerError, fmt.Sprintln(err))
-				return
-			}
-			if uid == "" {
-				c.String(http.StatusInternalServerError, fmt.Sprintln("Couldn't find user identification"))
-				return
-			}
-			// Set UID from owner
-			service.Owner = uid
-			createLogger.Printf("Creating service '%s' for user '%s'", service.Name, service.Owner)
+		// Set UID from owner
+		service.Owner = uid
+		createLogger.Printf("Creating service '%s' for user '%s'", service.Name, service.Owner)
 
-			mc, err = auth.GetMultitenancyConfigFromContext(c)
-			if err != nil {
-				c.String(http.StatusInternalServerError, fmt.Sprintln(err))
-				return
-			}
+		mc = caller.mc
+		if mc == nil {
+			return http.StatusInternalServerError, fmt.Sprintln("missing multitenancy config")
+		}
 
-			full_uid := auth.FormatUID(uid)
-			// Check if the service VO is present on the cluster VO's and if the user creating the service is enrrolled in such
-			if service.VO != "" {
+		full_uid := auth.FormatUID(uid)
+		// Check if the service VO is present on the cluster VO's and if the user creating the service is enrrolled in such
+		if service.VO != "" {
+			for _, vo := range cfg.OIDCGroups {
+				if vo == service.VO {
+					err := checkRequestIdentity(&service, authHeader, caller.groups)
+					if err != nil {
+						return http.StatusBadRequest, fmt.Sprintln(err)
+					}
+					break
+				}
+			}
+		} else {
+			if len(cfg.OIDCGroups) != 0 {
+				var notFound bool = true
 				for _, vo := range cfg.OIDCGroups {
-					if vo == service.VO {
-						err := checkIdentity(&service, authHeader)
-						if err != nil {
-							c.String(http.StatusBadRequest, fmt.Sprintln(err))
-							return
-						}
+					service.VO = vo
+					err := checkRequestIdentity(&service, authHeader, caller.groups)
+					if err == nil {
+						notFound = false
 						break
 					}
 				}
-			} else {
-				if len(cfg.OIDCGroups) != 0 {
-					var notFound bool = true
-					for _, vo := range cfg.OIDCGroups {
-						service.VO = vo
-						err := checkIdentity(&service, authHeader)
-						if err == nil {
-							notFound = false
-							break
-						}
-					}
-					if notFound {
-						c.String(http.StatusBadRequest, fmt.Sprintln("service must be part of one of the following VO: ", cfg.OIDCGroups))
-						return
-					}
-
+				if notFound {
+					return http.StatusBadRequest, fmt.Sprintln("service must be part of one of the following VO: ", cfg.OIDCGroups)
 				}
+
 			}
+		}
 
-			ownerOnList := false
-			namespace, err = utils.EnsureUserNamespace(c.Request.Context(), back.GetKubeClientset(), cfg, uid)
-			if err != nil {
-				c.String(http.StatusInternalServerError, fmt.Sprintf("error ensuring namespace for user %s: %v", uid, err))
-				return
-			}
-			if err := mc.EnsureSecretInNamespace(uid, namespace); err != nil {
-				c.String(http.StatusInternalServerError, fmt.Sprintf("error ensuring credentials for user %s: %v", uid, err))
-				return
-			}
-
-			if len(service.AllowedUsers) > 0 && strings.ToUpper(service.IsolationLevel) == types.IsolationLevelUser {
-				for _, in := range service.Input {
-					_, provName := getProviderInfo(in.Provider)
-
-					// Only allow input from MinIO and dCache
-					if provName == types.MinIOName {
-						path := strings.Trim(in.Path, "/")
-						splitPath := strings.SplitN(path, "/", 2)
-						// If AllowedUsers is empty don't add uid
-						service.Labels["uid"] = full_uid[:10]
-						var userBucket string
-						for _, u := range service.AllowedUsers {
-							// Check if the uid's from allowed_users have and asociated MinIO user
-							// and create it if not
-							if !mc.UserExists(u) {
-								sk, _ := auth.GenerateRandomKey(8)
-								cmuErr := minIOAdminClient.CreateMinIOUser(u, sk)
-								if cmuErr != nil {
-									log.Printf("error creating MinIO user for user %s: %v", u, cmuErr)
-								}
-								csErr := mc.CreateSecretForOIDC(u, sk)
-								if csErr != nil {
-									log.Printf("error creating secret for user %s: %v", u, csErr)
-								}
-							}
-							// Fill the list of private buckets to be used on users buckets isolation
-							// Check the uid of the owner is on the allowed_users list
-							if u == service.Owner {
-								ownerOnList = true
+		ownerOnList := false
+		namespace, err = utils.EnsureUserNamespace(caller.ctx, back.GetKubeClientset(), cfg, uid)
+		if err != nil {
+			return http.StatusInternalServerError, fmt.Sprintf("error ensuring namespace for user %s: %v", uid, err)
+		}
+		if err := mc.EnsureSecretInNamespace(uid, namespace); err != nil {
+			return http.StatusInternalServerError, fmt.Sprintf("error ensuring credentials for user %s: %v", uid, err)
+		}
+
+		if len(service.AllowedUsers) > 0 && strings.ToUpper(service.IsolationLevel) == types.IsolationLevelUser {
+			for _, in := range service.Input {
+				_, provName := getProviderInfo(in.Provider)
+
+				// Only allow input from MinIO and dCache
+				if provName == types.MinIOName {
+					path := strings.Trim(in.Path, "/")
+					splitPath := strings.SplitN(path, "/", 2)
+					// If AllowedUsers is empty don't add uid
+					service.Labels["uid"] = full_uid[:10]
+					var userBucket string
+					for _, u := range service.AllowedUsers {
+						// Check if the uid's from allowed_users have and asociated MinIO user
+						// and create it if not
+						if !mc.UserExists(u) {
+							sk, _ := auth.GenerateRandomKey(8)
+							cmuErr := minIOAdminClient.CreateMinIOUser(u, sk)
+							if cmuErr != nil {
+								log.Printf("error creating MinIO user for user %s: %v", u, cmuErr)
 							}
-							// Fill the list of private buckets to create
-							userBucket = splitPath[0] + "-" + u[:10]
-							service.BucketList = append(service.BucketList, userBucket)
-							if err := mc.EnsureSecretInNamespace(u, namespace); err != nil {
-								c.String(http.StatusInternalServerError, fmt.Sprintf("error ensuring credentials for user %s: %v", u, err))
-								return
+							csErr := mc.CreateSecretForOIDC(u, sk)
+							if csErr != nil {
+								log.Printf("error creating secret for user %s: %v", u, csErr)
 							}
 						}
-
-						if !ownerOnList {
-							service.AllowedUsers = append(service.AllowedUsers, uid)
+						// Fill the list of private buckets to be used on users buckets isolation
+						// Check the uid of the owner is on the allowed_users list
+						if u == service.Owner {
+							ownerOnList = true
+						}
+						// Fill the list of private buckets to create
+						userBucket = splitPath[0] + "-" + u[:10]
+						service.BucketList = append(service.BucketList, userBucket)
+						if err := mc.EnsureSecretInNamespace(u, namespace); err != nil {
+							return http.StatusInternalServerError, fmt.Sprintf("error ensuring credentials for user %s: %v", u, err)
 						}
 					}
+
+					if !ownerOnList {
+						service.AllowedUsers = append(service.AllowedUsers, uid)
+					}
 				}
 			}
 		}
-		if service.Namespace == "" {
-			service.Namespace = namespace
-		}
-		if !isAdminUser {
-			if err := mc.EnsureSecretInNamespace(service.Owner, service.Namespace); err != nil {
-				c.String(http.StatusInternalServerError, fmt.Sprintf("error ensuring credentials for user %s: %v", service.Owner, err))
-				return
-			}
+	}
+	if service.Namespace == "" {
+		service.Namespace = namespace
+	}
+	if !isAdminUser {
+		if err := mc.EnsureSecretInNamespace(service.Owner, service.Namespace); err != nil {
+			return http.StatusInternalServerError, fmt.Sprintf("error ensuring credentials for user %s: %v", service.Owner, err)
 		}
+	}
 
-		refreshToken := extractRefreshTokenSecret(&service)
-		//log.Printf("extractRefreshTokenSecret: %s", refreshToken)
-		if service.HasFederationMembers() && refreshToken == "" {
-			c.String(http.StatusBadRequest, "refresh_token secret is required for federated services")
-			return
+	refreshToken := extractRefreshTokenSecret(&service)
+	//log.Printf("extractRefreshTokenSecret: %s", refreshToken)
+	if service.HasFederationMembers() && refreshToken == "" {
+		return http.StatusBadRequest, "refresh_token secret is required for federated services"
+	}
+	if service.HasFederationMembers() {
+		authErrors := utils.VerifyFederationAuth(&service, authHeader)
+		if len(authErrors) > 0 {
+			return http.StatusUnauthorized, fmt.Sprintf("federation auth failed: %v", authErrors)
 		}
-		if service.HasFederationMembers() {
-			authErrors := utils.VerifyFederationAuth(&service, authHeader)
-			if len(authErrors) > 0 {
-				c.String(http.StatusUnauthorized, fmt.Sprintf("federation auth failed: %v", authErrors))
-				return
-			}
+	}
+	/*if refreshToken != "" {
+		if err := upsertRefreshTokenSecret(&service, service.Namespace, refreshToken, back.GetKubeClientset()); err != nil {
+			return http.StatusInternalServerError, fmt.Sprintf("Error creating refresh-token secret: %v", err)
 		}
-		/*if refreshToken != "" {
-			if err := upsertRefreshTokenSecret(&service, service.Namespace, refreshToken, back.GetKubeClientset()); err != nil {
-				c.String(http.StatusInternalServerError, "Error creating refresh-token secret: %v", err)
-				return
-			}
-		}*/
+	}*/
 
-		utils.ApplyFederation(&service)
+	utils.ApplyFederation(&service)
 
-		if len(service.Environment.Secrets) > 0 {
-			if utils.SecretExists(service.Name, service.Namespace, back.GetKubeClientset()) {
-				c.String(http.StatusConflict, "A secret with the given name already exists")
-				return
-			}
-			secretsErr := utils.CreateSecret(service.Name, service.Namespace, service.Environment.Secrets, back.GetKubeClientset())
-			if secretsErr != nil {
-				c.String(http.StatusConflict, "Error creating secrets for service: %v", secretsErr)
-				return
-			}
+	if len(service.Environment.Secrets) > 0 {
+		if utils.SecretExists(service.Name, service.Namespace, back.GetKubeClientset()) {
+			return http.StatusConflict, "A secret with the given name already exists"
+		}
+		secretsErr := utils.CreateSecret(service.Name, service.Namespace, service.Environment.Secrets, back.GetKubeClientset())
+		if secretsErr != nil {
+			return http.StatusConflict, fmt.Sprintf("Error creating secrets for service: %v", secretsErr)
+		}
 
-			// Empty the secrets content from the Configmap
-			for secretKey := range service.Environment.Secrets {
-				service.Environment.Secrets[secretKey] = ""
-			}
+		// Empty the secrets content from the Configmap
+		for secretKey := range service.Environment.Secrets {
+			service.Environment.Secrets[secretKey] = ""
 		}
+	}
 
-		if !isAdminUser && cfg.KueueEnable {
-			if err := utils.EnsureKueueUserQueues(c.Request.Context(), cfg, service.Namespace, service.Owner, service.Name); err != nil {
-				createLogger.Printf("error ensuring Kueue queues for service %s: %v\n", service.Name, err)
-			}
-			service.Labels["kueue.x-k8s.io/queue-name"] = utils.BuildLocalQueueName(service.Name)
-			// At the moment check only for KServe service
-			if utils.IsKserveService(&service) && utils.IsKserveSupported(cfg) && !utils.VerifyWorkloadByResources(service, cfg) {
-				if err := utils.DeleteKueueLocalQueue(context.TODO(), cfg, service.Namespace, service.Name); err != nil {
-					createLogger.Printf("Error deleting Kueue local queue: %v", err)
-				}
-				c.String(http.StatusBadRequest, fmt.Sprintf("Error creating service %s: workload is NOT admitted", service.Name))
-				return
+	if !isAdminUser && cfg.KueueEnable {
+		if err := utils.EnsureKueueUserQueues(caller.ctx, cfg, service.Namespace, service.Owner, service.Name); err != nil {
+			createLogger.Printf("error ensuring Kueue queues for service %s: %v\n", service.Name, err)
+		}
+		service.Labels["kueue.x-k8s.io/queue-name"] = utils.BuildLocalQueueName(service.Name)
+		// At the moment check only for KServe service
+		if utils.IsKserveService(&service) && utils.IsKserveSupported(cfg) && !utils.VerifyWorkloadByResources(service, cfg) {
+			if err := utils.DeleteKueueLocalQueue(context.TODO(), cfg, service.Namespace, service.Name); err != nil {
+				createLogger.Printf("Error deleting Kueue local queue: %v", err)
 			}
+			return http.StatusBadRequest, fmt.Sprintf("Error creating service %s: workload is NOT admitted", service.Name)
 		}
+	}
 
-		ownerName := "oscar"
-		if !isAdminUser {
-			ownerName = auth.GetUserNameFromContext(c)
-			ownerName = utils.RemoveAccents(ownerName)
+	ownerName := "oscar"
+	if !isAdminUser {
+		ownerName = caller.userName
+		ownerName = utils.RemoveAccents(ownerName)
+	}
+	service.Labels["owner_name"] = strings.ReplaceAll(ownerName, " ", "_")
+	if !isAdminUser {
+		minIOQuota, _, err = GetMinIOQuotaConfig(caller.ctx, cfg, back.GetKubeClientset(), uid)
+		if err != nil {
+			return http.StatusInternalServerError, fmt.Sprintf("Error reading MinIO quota: %v", err)
 		}
-		service.Labels["owner_name"] = strings.ReplaceAll(ownerName, " ", "_")
-		if !isAdminUser {
-			minIOQuota, _, err = GetMinIOQuotaConfig(c.Request.Context(), cfg, back.GetKubeClientset(), uid)
-			if err != nil {
-				c.String(http.StatusInternalServerError, fmt.Sprintf("Error reading MinIO quota: %v", err))
-				return
+		if minIOQuota != nil {
+			if minIOAdminErr != nil {
+				return http.StatusInternalServerError, fmt.Sprintf("Error creating MinIO admin client: %v", minIOAdminErr)
 			}
-			if minIOQuota != nil {
-				if minIOAdminErr != nil {
-					c.String(http.StatusInternalServerError, fmt.Sprintf("Error creating MinIO admin client: %v", minIOAdminErr))
-					return
-				}
-				if err := ValidateMinIOBucketCountQuota(cfg, minIOAdminClient, minIOQuota, uid, collectMinIOBucketCandidates(&service)); err != nil {
-					c.String(http.StatusForbidden, err.Error())
-					return
-				}
+			if err := ValidateMinIOBucketCountQuota(cfg, minIOAdminClient, minIOQuota, uid, collectMinIOBucketCandidates(&service)); err != nil {
+				return http.StatusForbidden, err.Error()
 			}
 		}
+	}
 
-		// Check if a service with the same name already exists in the cluster
-		if exists, err := serviceWithSameNameExists(service.Name, back); err != nil {
-			c.String(http.StatusInternalServerError, fmt.Sprintf("Error checking for existing service: %v", err))
-			return
-		} else if exists {
-			c.String(http.StatusBadRequest, "A service with the provided name already exists")
-			return
-		}
+	// Check if a service with the same name already exists in the cluster
+	if exists, err := serviceWithSameNameExists(service.Name, back); err != nil {
+		return http.StatusInternalServerError, fmt.Sprintf("Error checking for existing service: %v", err)
+	} else if exists {
+		return http.StatusBadRequest, "A service with the provided name already exists"
+	}
 
-		// Create service
-		if err := back.CreateService(service); err != nil {
-			// Check if error is caused because the service name provided already exists
-			if k8sErrors.IsAlreadyExists(err) {
-				if service.CreatesManagedVolume() {
-					c.String(http.StatusConflict, "A managed volume with the provided name already exists")
-				} else {
-					c.String(http.StatusConflict, "A service with the provided name already exists")
-				}
-			} else if k8sErrors.IsNotFound(err) && service.Volume != nil {
-				if service.CreatesManagedVolume() {
-					errDelete := back.DeleteService(service)
-					if errDelete != nil {
-						log.Printf("Error deleting service: %v\n", errDelete)
-					}
-					c.String(http.StatusBadRequest, "Referenced volume size is not defined: Please add the volume size in service definition")
-				} else {
-					c.String(http.StatusBadRequest, "Referenced volume does not exist in the caller namespace")
-				}
-			} else {
+	// Create service
+	if err := back.CreateService(service); err != nil {
+		// Check if error is caused because the service name provided already exists
+		if k8sErrors.IsAlreadyExists(err) {
+			if service.CreatesManagedVolume() {
+				return http.StatusConflict, "A managed volume with the provided name already exists"
+			}
+			return http.StatusConflict, "A service with the provided name already exists"
+		}
+		if k8sErrors.IsNotFound(err) && service.Volume != nil {
+			if service.CreatesManagedVolume() {
 				errDelete := back.DeleteService(service)
 				if errDelete != nil {
 					log.Printf("Error deleting service: %v\n", errDelete)
 				}
-				c.String(http.StatusInternalServerError, fmt.Sprintf("Error creating the service: %v", err))
+				return http.StatusBadRequest, "Referenced volume size is not defined: Please add the volume size in service definition"
 			}
-			return
+			return http.StatusBadRequest, "Referenced volume does not exist in the caller namespace"
+		}
+		errDelete := back.DeleteService(service)
+		if errDelete != nil {
+			log.Printf("Error deleting service: %v\n", errDelete)
 		}
+		return http.StatusInternalServerError, fmt.Sprintf("Error creating the service: %v", err)
+	}
+
+	// Register minio webhook and restart the server
+	if err := registerMinIOWebhook(service.Name, service.Token, service.StorageProviders.MinIO[types.DefaultProvider], cfg); err != nil {
+		createLogger.Printf("Error registering MinIO webhook for service '%s': %v", service.Name, err)
+		derr := back.DeleteService(service)
+		if derr != nil {
+			log.Printf("Error deleting service: %v\n", derr)
+		}
+		return http.StatusInternalServerError, err.Error()
+	}
 
-		// Register minio webhook and restart the server
-		if err := registerMinIOWebhook(service.Name, service.Token, service.StorageProviders.MinIO[types.DefaultProvider], cfg); err != nil {
-			createLogger.Printf("Error registering MinIO webhook for service '%s': %v", service.Name, err)
+	buckets := []utils.MinIOBucket{}
+	if !(service.Annotations != nil &&
+		strings.EqualFold(strings.TrimSpace(service.Annotations[types.FederationWorkerAnnotation]), "true") &&
+		service.Federation != nil &&
+		strings.EqualFold(strings.TrimSpace(service.Federation.Topology), "mesh")) {
+		if buckets, err = createBuckets(&service, cfg, minIOAdminClient, false, isAdminUser); err != nil {
+			createLogger.Printf("Error creating buckets for service '%s': %v", service.Name, err)
+			status := http.StatusInternalServerError
+			if err == errInput {
+				status = http.StatusBadRequest
+			}
 			derr := back.DeleteService(service)
 			if derr != nil {
 				log.Printf("Error deleting service: %v\n", derr)
 			}
-			c.String(http.StatusInternalServerError, err.Error())
-			return
-		}
 
-		buckets := []utils.MinIOBucket{}
-		if !(service.Annotations != nil &&
-			strings.EqualFold(strings.TrimSpace(service.Annotations[types.FederationWorkerAnnotation]), "true") &&
-			service.Federation != nil &&
-			strings.EqualFold(strings.TrimSpace(service.Federation.Topology), "mesh")) {
-			if buckets, err = createBuckets(&service, cfg, minIOAdminClient, false); err != nil {
-				createLogger.Printf("Error creating buckets for service '%s': %v", service.Name, err)
-				if err == errInput {
-					c.String(http.StatusBadRequest, err.Error())
-				} else {
-					c.String(http.StatusInternalServerError, err.Error())
-				}
-				derr := back.DeleteService(service)
-				if derr != nil {
-					log.Printf("Error deleting service: %v\n", derr)
+			if !strings.Contains(err.Error(), " already exists") {
+				bderr := deleteBuckets(&service, cfg, minIOAdminClient)
+				if bderr != nil {
+					log.Printf("Error deleting buckets: %v\n", bderr)
 				}
-
-				if !strings.Contains(err.Error(), " already exists") {
-					bderr := deleteBuckets(&service, cfg, minIOAdminClient)
-					if bderr != nil {
-						log.Printf("Error deleting buckets: %v\n", bderr)
-					}
-				}
-				return
 			}
+			return status, err.Error()
 		}
-		if len(buckets) > 0 {
-			if service.Annotations != nil &&
-				strings.EqualFold(strings.TrimSpace(service.Annotations[types.FederationWorkerAnnotation]), "true") &&
-				service.Federation != nil &&
-				strings.EqualFold(strings.TrimSpace(service.Federation.Topology), "mesh") {
-				// Worker services should not manage origin buckets.
-				goto skipBucketTags
+	}
+	if len(buckets) > 0 {
+		if service.Annotations != nil &&
+			strings.EqualFold(strings.TrimSpace(service.Annotations[types.FederationWorkerAnnotation]), "true") &&
+			service.Federation != nil &&
+			strings.EqualFold(strings.TrimSpace(service.Federation.Topology), "mesh") {
+			// Worker services should not manage origin buckets.
+			goto skipBucketTags
+		}
+		for _, b := range buckets {
+			// If not specified default visibility is PRIVATE
+			if strings.ToLower(service.Visibility) == "" {
+				b.Visibility = utils.PRIVATE
 			}
-			for _, b := range buckets {
-				// If not specified default visibility is PRIVATE
-				if strings.ToLower(service.Visibility) == "" {
-					b.Visibility = utils.PRIVATE
-				}
-				if service.Owner != types.DefaultOwner {
-					err := minIOAdminClient.SetPolicies(b)
-					if err != nil {
-						c.String(http.StatusInternalServerError, fmt.Sprintf("Error creating the service: %v", err))
-					}
+			if service.Owner != types.DefaultOwner {
+				err := minIOAdminClient.SetPolicies(b)
+				if err != nil {
+					return http.StatusInternalServerError, fmt.Sprintf("Error creating the service: %v", err)
 				}
+			}
 
-				// Bucket metadata for filtering
-				tags := map[string]string{
-					"owner":        uid,
-					"from_service": service.Name,
-					"owner_name":   ownerName,
-				}
-				if err := minIOAdminClient.SetTags(b.BucketName, tags); err != nil {
-					c.String(http.StatusBadRequest, fmt.Sprintf("Error tagging bucket: %v", err))
-					return
-				}
-				if minIOQuota != nil && minIOQuota.StoragePerBucket != "" {
-					if err := minIOAdminClient.SetBucketStorageQuota(b.BucketName, minIOQuota.StoragePerBucket); err != nil {
-						derr := back.DeleteService(service)
-						if derr != nil {
-							log.Printf("Error deleting service: %v\n", derr)
-						}
-						c.String(http.StatusInternalServerError, fmt.Sprintf("Error setting bucket quota: %v", err))
-						return
+			// Bucket metadata for filtering
+			tags := map[string]string{
+				"owner":        uid,
+				"from_service": service.Name,
+				"owner_name":   ownerName,
+			}
+			if err := minIOAdminClient.SetTags(b.BucketName, tags); err != nil {
+				return http.StatusBadRequest, fmt.Sprintf("Error tagging bucket: %v", err)
+			}
+			if minIOQuota != nil && minIOQuota.StoragePerBucket != "" {
+				if err := minIOAdminClient.SetBucketStorageQuota(b.BucketName, minIOQuota.StoragePerBucket); err != nil {
+					derr := back.DeleteService(service)
+					if derr != nil {
+						log.Printf("Error deleting service: %v\n", derr)
 					}
+					return http.StatusInternalServerError, fmt.Sprintf("Error setting bucket quota: %v", err)
 				}
 			}
 		}
-	skipBucketTags:
+		syncACLBucketPolicies(cfg, &service, nil)
+	}
+skipBucketTags:
 
-		// Add Yunikorn queue if enabled
-		if cfg.YunikornEnable {
-			if err := utils.AddYunikornQueue(cfg, back.GetKubeClientset(), &service); err != nil {
-				log.Println(err.Error())
-			}
+	// Add Yunikorn queue if enabled
+	if cfg.YunikornEnable {
+		if err := utils.AddYunikornQueue(cfg, back.GetKubeClientset(), &service); err != nil {
+			log.Println(err.Error())
 		}
+	}
 
-		var federationErrors []error
-		federated := service
-		if service.HasFederationMembers() {
-			if service.Annotations != nil &&
-				strings.EqualFold(strings.TrimSpace(service.Annotations[types.FederationWorkerAnnotation]), "true") &&
-				service.Federation != nil &&
-				strings.EqualFold(strings.TrimSpace(service.Federation.Topology), "mesh") {
-				goto skipFederationExpansion
+	// Create the CronJob of the scheduled invocations
+	if service.Schedule != nil {
+		if err := syncServiceSchedule(caller.ctx, cfg, back.GetKubeClientset(), service); err != nil {
+			if derr := back.DeleteService(service); derr != nil {
+				log.Printf("Error deleting service: %v\n", derr)
 			}
-			federated.Input = rawInput
-			federated.Output = rawOutput
-			federationErrors = utils.ExpandFederation(&federated, authHeader, http.MethodPost, refreshToken)
+			return http.StatusInternalServerError, fmt.Sprintf("Error creating the service schedule: %v", err)
 		}
-	skipFederationExpansion:
+	}
 
-		if len(federationErrors) > 0 {
-			rollbackErrors := utils.RollbackFederationCreate(&federated, authHeader)
-			if err := back.DeleteService(service); err != nil {
-				rollbackErrors = append(rollbackErrors, fmt.Errorf("local rollback failed: %v", err))
-			}
-			if len(rollbackErrors) > 0 {
-				c.String(http.StatusInternalServerError, fmt.Sprintf("Federation failed: %v; rollback errors: %v", federationErrors, rollbackErrors))
-				return
-			}
-			c.String(http.StatusInternalServerError, fmt.Sprintf("Federation failed; rollback completed: %v", federationErrors))
-			return
+	var federationErrors []error
+	federated := service
+	if service.HasFederationMembers() {
+		if service.Annotations != nil &&
+			strings.EqualFold(strings.TrimSpace(service.Annotations[types.FederationWorkerAnnotation]), "true") &&
+			service.Federation != nil &&
+			strings.EqualFold(strings.TrimSpace(service.Federation.Topology), "mesh") {
+			goto skipFederationExpansion
 		}
+		federated.Input = rawInput
+		federated.Output = rawOutput
+		federationErrors = utils.ExpandFederation(&federated, authHeader, http.MethodPost, refreshToken)
+	}
+skipFederationExpansion:
 
-		createLogger.Printf("%s | %v | %s | %s | %s", "POST", 200, createPath, service.Name, uid)
-		c.Status(http.StatusCreated)
+	if len(federationErrors) > 0 {
+		rollbackErrors := utils.RollbackFederationCreate(&federated, authHeader)
+		if err := back.DeleteService(service); err != nil {
+			rollbackErrors = append(rollbackErrors, fmt.Errorf("local rollback failed: %v", err))
+		}
+		if len(rollbackErrors) > 0 {
+			return http.StatusInternalServerError, fmt.Sprintf("Federation failed: %v; rollback errors: %v", federationErrors, rollbackErrors)
+		}
+		return http.StatusInternalServerError, fmt.Sprintf("Federation failed; rollback completed: %v", federationErrors)
 	}
+
+	recordServiceRevision(caller, cfg, back, service, types.RevisionOperationCreate, 0)
+
+	createLogger.Printf("%s | %v | %s | %s | %s", "POST", 200, createPath, service.Name, uid)
+	return http.StatusCreated, ""
+}
+
+// validateServiceSpec runs the checks of the service definition that don't need
+// to reach the cluster, returning every error found
+func validateServiceSpec(service *types.Service, cfg *types.Config) []error {
+	checks := []func() error{
+		func() error { return utils.ValidateVolumeConfig(service.Name, service.Volume) },
+		service.ValidateContainers,
+		func() error { return service.ValidateScheduling(cfg) },
+		func() error { return service.ValidateAccelerators(cfg) },
+		service.ValidateSchedule,
+		func() error { return service.ValidateCallbacks(cfg) },
+		service.ValidateMaxConcurrentJobs,
+		service.ValidateRetryPolicy,
+		service.ValidateACL,
+	}
+	var errs []error
+	for _, check := range checks {
+		if err := check(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
 }
 
 func checkValues(service *types.Service, cfg *types.Config) {
@@ -616,9 +630,26 @@ func cloneStorageIOConfigs(items []types.StorageIOConfig) []types.StorageIOConfi
 	return append([]types.StorageIOConfig(nil), items...)
 }
 
-func createBuckets(service *types.Service, cfg *types.Config, minIOAdminClient *utils.MinIOAdminClient, isUpdate bool) ([]utils.MinIOBucket, error) {
-	var s3Client *s3.S3
-	var cdmiClient *cdmi.Client
+// bucketStore storage operations of createBuckets. The services create their buckets in the storage providers,
+// and the dry-runs record them in the plan walking the storage of the service the same way
+type bucketStore interface {
+	// createS3Path creates the bucket of the path, if it doesn't exist, and its folder, enabling the webhook of the service on it
+	createS3Path(provider string, path []string, webhook bool, bucketExists bool) error
+	// addPolicy grants a user access to a bucket
+	addPolicy(bucket string, user string) error
+	// createContainer creates a folder in the space of a Onedata provider
+	createContainer(provider string, path string) error
+	// mountBucketVisibility returns whether the bucket of the mount exists and its visibility
+	mountBucketVisibility(provider string, bucket string) (bool, string, error)
+}
+
+func createBuckets(service *types.Service, cfg *types.Config, minIOAdminClient *utils.MinIOAdminClient, isUpdate bool, isAdminUser bool) ([]utils.MinIOBucket, error) {
+	store := &providerBucketStore{service: service, cfg: cfg, minIOAdminClient: minIOAdminClient, isAdminUser: isAdminUser}
+	return createServiceBuckets(service, cfg, store, isUpdate, isAdminUser)
+}
+
+// createServiceBuckets validates the storage of the service and creates its buckets and folders in the store
+func createServiceBuckets(service *types.Service, cfg *types.Config, store bucketStore, isUpdate bool, isAdminUser bool) ([]utils.MinIOBucket, error) {
 	var provName, provID string
 	var minIOBuckets []utils.MinIOBucket
 
@@ -642,15 +673,12 @@ func createBuckets(service *types.Service, cfg *types.Config, minIOAdminClient *
 		}
 
 		// Check if the input provider is the defined in the server config
-		if provID != types.DefaultProvider {
+		if provID != types.DefaultProvider && cfg.MinIOProvider != nil {
 			if !reflect.DeepEqual(*cfg.MinIOProvider, *service.StorageProviders.MinIO[provID]) {
 				return nil, fmt.Errorf("the provided MinIO server \"%s\" is not the configured in OSCAR", service.StorageProviders.MinIO[provID].Endpoint)
 			}
 		}
 
-		// Use admin MinIO client for the bucket creation
-		s3Client = cfg.MinIOProvider.GetS3Client()
-
 		path := strings.Trim(in.Path, " /")
 		// Split buckets and folders from path
 		splitPath := strings.SplitN(path, "/", 2)
@@ -659,7 +687,8 @@ func createBuckets(service *types.Service, cfg *types.Config, minIOAdminClient *
 			folderKey = fmt.Sprintf("%s/", splitPath[1])
 		}
 
-		err := minIOAdminClient.CreateS3PathWithWebhook(s3Client, splitPath, service.GetMinIOWebhookARN(), false)
+		// The input providers are the MinIO of the cluster, so the buckets are created with the admin client
+		err := store.createS3Path(in.Provider, splitPath, true, false)
 
 		if err != nil && !isUpdate {
 			return nil, err
@@ -676,9 +705,9 @@ func createBuckets(service *types.Service, cfg *types.Config, minIOAdminClient *
 			for i, b := range service.BucketList {
 				// Create a bucket for each allowed user if allowed_users is not empty
 				if folderKey == "" {
-					err = minIOAdminClient.CreateS3PathWithWebhook(s3Client, []string{b}, service.GetMinIOWebhookARN(), false)
+					err = store.createS3Path(in.Provider, []string{b}, true, false)
 				} else {
-					err = minIOAdminClient.CreateS3PathWithWebhook(s3Client, []string{b, folderKey}, service.GetMinIOWebhookARN(), false)
+					err = store.createS3Path(in.Provider, []string{b, folderKey}, true, false)
 				}
 				if err != nil && isUpdate {
 					continue
@@ -689,7 +718,7 @@ func createBuckets(service *types.Service, cfg *types.Config, minIOAdminClient *
 				}
 				// Create bucket policy
 				if !isAdminUser {
-					err = minIOAdminClient.CreateAddPolicy(b, service.AllowedUsers[i], utils.ALL_ACTIONS, false)
+					err = store.addPolicy(b, service.AllowedUsers[i])
 					if err != nil {
 						return nil, err
 					}
@@ -717,17 +746,6 @@ func createBuckets(service *types.Service, cfg *types.Config, minIOAdminClient *
 
 		switch provName {
 		case types.MinIOName, types.S3Name:
-			// Use the appropriate client
-			if provName == types.MinIOName {
-				if provID == types.DefaultProvider {
-					s3Client = cfg.MinIOProvider.GetS3Client()
-				} else {
-					s3Client = service.StorageProviders.MinIO[provID].GetS3Client()
-
-				}
-			} else {
-				s3Client = service.StorageProviders.S3[provID].GetS3Client()
-			}
 			var found bool
 			for _, b := range minIOBuckets {
 				if b.BucketName == splitPath[0] {
@@ -742,13 +760,13 @@ func createBuckets(service *types.Service, cfg *types.Config, minIOAdminClient *
 					AllowedUsers: service.AllowedUsers,
 					Visibility:   service.Visibility,
 					Owner:        service.Owner})
-				err := minIOAdminClient.CreateS3Path(s3Client, splitPath, false)
+				err := store.createS3Path(out.Provider, splitPath, false, false)
 				if err != nil && !isUpdate {
 					return nil, err
 				}
 			} else {
 				// If the bucket is created on the previous loop, add output folders
-				err := minIOAdminClient.CreateS3Path(s3Client, splitPath, true)
+				err := store.createS3Path(out.Provider, splitPath, false, true)
 				if err != nil && !isUpdate {
 					return nil, err
 				}
@@ -756,7 +774,7 @@ func createBuckets(service *types.Service, cfg *types.Config, minIOAdminClient *
 
 			if strings.ToUpper(service.IsolationLevel) == types.IsolationLevelUser && len(service.BucketList) > 0 {
 				for _, b := range service.BucketList {
-					err := minIOAdminClient.CreateS3Path(s3Client, []string{b, folderKey}, true)
+					err := store.createS3Path(out.Provider, []string{b, folderKey}, false, true)
 					if err != nil && !isUpdate {
 						return nil, err
 					}
@@ -764,14 +782,8 @@ func createBuckets(service *types.Service, cfg *types.Config, minIOAdminClient *
 			}
 
 		case types.OnedataName:
-			cdmiClient = service.StorageProviders.Onedata[provID].GetCDMIClient()
-			err := cdmiClient.CreateContainer(fmt.Sprintf("%s/%s", service.StorageProviders.Onedata[provID].Space, path), true)
-			if err != nil {
-				if err == cdmi.ErrBadRequest {
-					log.Printf("Error creating \"%s\" folder in Onedata. Error: %v\n", path, err)
-				} else {
-					return nil, fmt.Errorf("error connecting to Onedata's Oneprovider \"%s\". Error: %v", service.StorageProviders.Onedata[provID].OneproviderHost, err)
-				}
+			if err := store.createContainer(out.Provider, path); err != nil {
+				return nil, err
 			}
 		}
 	}
@@ -792,13 +804,8 @@ func createBuckets(service *types.Service, cfg *types.Config, minIOAdminClient *
 			splitPath := strings.SplitN(path, "/", 2)
 
 			// Currently only MinIO/S3 are supported
-			// Use the appropriate client
-			if provName == types.MinIOName && provID == types.DefaultProvider {
-				s3Client = cfg.MinIOProvider.GetS3Client()
-			} else if provName == types.MinIOName {
+			if provID != types.DefaultProvider {
 				return minIOBuckets, nil
-			} else {
-				s3Client = service.StorageProviders.S3[provID].GetS3Client()
 			}
 
 			// Check if the bucket exists in the service
@@ -814,50 +821,23 @@ func createBuckets(service *types.Service, cfg *types.Config, minIOAdminClient *
 			// just create the folder if needed
 
 			if foundInService {
-				err := minIOAdminClient.CreateS3Path(s3Client, splitPath, true)
+				err := store.createS3Path(service.Mount.Provider, splitPath, false, true)
 				if err != nil && !isUpdate {
 					return nil, err
 				}
 				return minIOBuckets, nil
 			}
 
-			// List buckets to check if the bucket exists in MinIO
-			bucketInfo, err := s3Client.ListBuckets(&s3.ListBucketsInput{})
+			// Check if the bucket exists in MinIO
+			foundInMinIO, visibility, err := store.mountBucketVisibility(service.Mount.Provider, splitPath[0])
 			if err != nil {
 				return nil, err
 			}
-
-			var foundInMinIO bool
-			for _, b := range bucketInfo.Buckets {
-				if *b.Name == splitPath[0] {
-					foundInMinIO = true
-					break
-				}
-			}
 			if foundInMinIO {
-				minio := utils.MinIOBucket{
-					BucketName: splitPath[0],
-					Owner:      service.Owner,
-				}
-				visibility := minIOAdminClient.GetCurrentResourceVisibility(minio)
-
-				// Add admin exception for mount buckets
-				// Only allowed private buckets
-				// Admin buckets have no MinIO policy so visibility returns "".
-				// Guard against mounting another user's bucket by verifying the owner tag is empty or matches the admin user
-				// (oscar in our case, as admin users don't have a UID and are identified by the "owner" tag in MinIO buckets).
-				// (user buckets always carry their UID in the "owner" tag).
-				if isAdminUser && visibility == "" {
-					bucketTags, _ := minIOAdminClient.GetTaggedMetadata(splitPath[0])
-					if bucketTags["owner"] == "oscar" || bucketTags["owner"] == "" {
-						visibility = utils.PRIVATE
-					}
-				}
-
 				if visibility != utils.PRIVATE {
-					return nil, fmt.Errorf("the bucket \"%s\" must be private to be used as mount", minio.BucketName)
+					return nil, fmt.Errorf("the bucket \"%s\" must be private to be used as mount", splitPath[0])
 				} else {
-					err := minIOAdminClient.CreateS3Path(s3Client, splitPath, true)
+					err := store.createS3Path(service.Mount.Provider, splitPath, false, true)
 					minIOBuckets = append(minIOBuckets, utils.MinIOBucket{
 						BucketName:   splitPath[0],
 						AllowedUsers: service.AllowedUsers,
@@ -871,7 +851,7 @@ func createBuckets(service *types.Service, cfg *types.Config, minIOAdminClient *
 			}
 
 			// Create mount bucket
-			err = minIOAdminClient.CreateS3Path(s3Client, splitPath, false)
+			err = store.createS3Path(service.Mount.Provider, splitPath, false, false)
 			minIOBuckets = append(minIOBuckets, utils.MinIOBucket{
 				BucketName:   splitPath[0],
 				AllowedUsers: service.AllowedUsers,
@@ -887,6 +867,90 @@ func createBuckets(service *types.Service, cfg *types.Config, minIOAdminClient *
 	return minIOBuckets, nil
 }
 
+// providerBucketStore creates the buckets of a service in its storage providers
+type providerBucketStore struct {
+	service          *types.Service
+	cfg              *types.Config
+	minIOAdminClient *utils.MinIOAdminClient
+	isAdminUser      bool
+}
+
+// s3Client returns the client of a MinIO or S3 provider of the service, the admin MinIO client for the default one
+func (store *providerBucketStore) s3Client(provider string) *s3.S3 {
+	provID, provName := getProviderInfo(provider)
+	switch {
+	case provName == types.MinIOName && provID == types.DefaultProvider:
+		return store.cfg.MinIOProvider.GetS3Client()
+	case provName == types.MinIOName:
+		return store.service.StorageProviders.MinIO[provID].GetS3Client()
+	default:
+		return store.service.StorageProviders.S3[provID].GetS3Client()
+	}
+}
+
+func (store *providerBucketStore) createS3Path(provider string, path []string, webhook bool, bucketExists bool) error {
+	if webhook {
+		return store.minIOAdminClient.CreateS3PathWithWebhook(store.s3Client(provider), path, store.service.GetMinIOWebhookARN(), bucketExists)
+	}
+	return store.minIOAdminClient.CreateS3Path(store.s3Client(provider), path, bucketExists)
+}
+
+func (store *providerBucketStore) addPolicy(bucket string, user string) error {
+	return store.minIOAdminClient.CreateAddPolicy(bucket, user, utils.ALL_ACTIONS, false)
+}
+
+func (store *providerBucketStore) createContainer(provider string, path string) error {
+	provID, _ := getProviderInfo(provider)
+	onedata := store.service.StorageProviders.Onedata[provID]
+	err := onedata.GetCDMIClient().CreateContainer(fmt.Sprintf("%s/%s", onedata.Space, path), true)
+	if err != nil {
+		if err == cdmi.ErrBadRequest {
+			log.Printf("Error creating \"%s\" folder in Onedata. Error: %v\n", path, err)
+		} else {
+			return fmt.Errorf("error connecting to Onedata's Oneprovider \"%s\". Error: %v", onedata.OneproviderHost, err)
+		}
+	}
+	return nil
+}
+
+func (store *providerBucketStore) mountBucketVisibility(provider string, bucket string) (bool, string, error) {
+	// List buckets to check if the bucket exists in MinIO
+	bucketInfo, err := store.s3Client(provider).ListBuckets(&s3.ListBucketsInput{})
+	if err != nil {
+		return false, "", err
+	}
+
+	var foundInMinIO bool
+	for _, b := range bucketInfo.Buckets {
+		if *b.Name == bucket {
+			foundInMinIO = true
+			break
+		}
+	}
+	if !foundInMinIO {
+		return false, "", nil
+	}
+	minio := utils.MinIOBucket{
+		BucketName: bucket,
+		Owner:      store.service.Owner,
+	}
+	visibility := store.minIOAdminClient.GetCurrentResourceVisibility(minio)
+
+	// Add admin exception for mount buckets
+	// Only allowed private buckets
+	// Admin buckets have no MinIO policy so visibility returns "".
+	// Guard against mounting another user's bucket by verifying the owner tag is empty or matches the admin user
+	// (oscar in our case, as admin users don't have a UID and are identified by the "owner" tag in MinIO buckets).
+	// (user buckets always carry their UID in the "owner" tag).
+	if store.isAdminUser && visibility == "" {
+		bucketTags, _ := store.minIOAdminClient.GetTaggedMetadata(bucket)
+		if bucketTags["owner"] == "oscar" || bucketTags["owner"] == "" {
+			visibility = utils.PRIVATE
+		}
+	}
+	return true, visibility, nil
+}
+
 func collectMinIOBucketCandidates(service *types.Service) []string {
 	buckets := map[string]struct{}{}
 	addPathBucket := func(path string) {
@@ -959,6 +1023,19 @@ func getProviderInfo(rawInfo string) (string, string) {
 	return provID, provName
 }
 
+// checkRequestIdentity checks that the user of the request is enrolled in the VO of the service. The users
+// authenticated with a personal access token are checked against the groups they had when it was created
+func checkRequestIdentity(service *types.Service, authHeader string, groups []string) error {
+	if !auth.IsPersonalToken(strings.TrimPrefix(authHeader, "Bearer ")) {
+		return checkIdentity(service, authHeader)
+	}
+	if !slices.Contains(groups, service.VO) {
+		return fmt.Errorf("this user isn't enrrolled on the vo: %v", service.VO)
+	}
+	setServiceVOLabel(service)
+	return nil
+}
+
 func checkIdentity(service *types.Service, authHeader string) error {
 	rawToken := strings.TrimPrefix(authHeader, "Bearer ")
 	issuer, err := auth.GetIssuerFromToken(rawToken)
@@ -978,13 +1055,17 @@ func checkIdentity(service *types.Service, authHeader string) error {
 	if !hasVO {
 		return fmt.Errorf("this user isn't enrrolled on the vo: %v", service.VO)
 	}
+	setServiceVOLabel(service)
+	return nil
+}
+
+// setServiceVOLabel sets the label of the service with its VO
+func setServiceVOLabel(service *types.Service) {
 	voFirstReplace := strings.Replace(service.VO, "/", "", 1)
 	voParse := strings.ReplaceAll(voFirstReplace, "/", "--")
 	voParse = strings.ReplaceAll(voParse, " ", "__")
 	voParse = strings.ReplaceAll(voParse, ":", "___")
 	service.Labels["vo"] = voParse
-
-	return nil
 }
 
 func registerMinIOWebhook(name string, token string, minIO *types.MinIOProvider, cfg *types.Config) error {
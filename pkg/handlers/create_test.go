@@ -1002,3 +1002,17 @@ func TestValidateVolumeConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateServiceSpec(t *testing.T) {
+	cfg := &types.Config{}
+	service := &types.Service{Name: "svc"}
+	if errs := validateServiceSpec(service, cfg); len(errs) != 0 {
+		t.Fatalf("expected no errors, got %v", errs)
+	}
+
+	service.Volume = &types.ServiceVolumeConfig{MountPath: "/data"}
+	service.MaxConcurrentJobs = -1
+	if errs := validateServiceSpec(service, cfg); len(errs) != 2 {
+		t.Fatalf("expected 2 errors, got %v", errs)
+	}
+}
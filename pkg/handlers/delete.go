@@ -56,112 +56,139 @@ var deleteLogger = log.New(os.Stdout, "[DELETE-HANDLER] ", log.Flags())
 // @Router /system/services/{serviceName} [delete]
 func MakeDeleteHandler(cfg *types.Config, back types.ServerlessBackend) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// First get the Service
-		var service *types.Service
-		var uid string
-		var namespace string
-		var err error
-		serviceName := c.Param("serviceName")
-		authHeader := c.GetHeader("Authorization")
-
-		isOIDC := len(strings.Split(authHeader, "Bearer")) > 1
-		if isOIDC {
-			uid, err = auth.GetUIDFromContext(c)
-			if err != nil {
-				c.String(http.StatusInternalServerError, fmt.Sprintln(err))
-				return
-			}
-		}
-		if isOIDC {
-			namespace = utils.BuildUserNamespace(cfg, uid)
-		} else {
-			namespace = c.Query("namespace")
+		status, message := deleteService(makeServiceCaller(c), cfg, back, c.Query("namespace"), c.Param("serviceName"))
+		writeServiceResponse(c, status, message)
+	}
+}
+
+// deleteService deletes the service on behalf of the caller, returning the status and message of the response.
+// The namespace is only used by the cluster administrator, an empty one searches across all namespaces.
+// The errors deleting the buckets do not stop the deletion, and the first one is returned at the end.
+func deleteService(caller serviceCaller, cfg *types.Config, back types.ServerlessBackend, namespace string, serviceName string) (int, string) {
+	// First get the Service
+	var service *types.Service
+	var err error
+	uid := caller.uid
+
+	isOIDC := !caller.isAdmin()
+	if isOIDC {
+		if uid == "" {
+			return http.StatusInternalServerError, fmt.Sprintln("missing user identificator")
 		}
-		service, err = back.ReadService(namespace, serviceName)
-		if err != nil {
-			if errors.IsNotFound(err) || errors.IsGone(err) {
-				c.Status(http.StatusNotFound)
-			} else {
-				c.String(http.StatusInternalServerError, err.Error())
-			}
-			return
+		namespace = utils.BuildUserNamespace(cfg, uid)
+	}
+	service, err = back.ReadService(namespace, serviceName)
+	if isOIDC && (errors.IsNotFound(err) || errors.IsGone(err)) {
+		// Services shared with the owner role are deployed in the namespace of their owner
+		service, err = back.ReadService("", serviceName)
+	}
+	if err != nil {
+		if errors.IsNotFound(err) || errors.IsGone(err) {
+			return http.StatusNotFound, ""
 		}
+		return http.StatusInternalServerError, err.Error()
+	}
 
-		if isOIDC && service.Owner != uid {
-			c.String(http.StatusForbidden, "User %s doesn't have permision to delete this service", uid)
-			return
-		}
-		if service.Namespace == "" {
-			service.Namespace = cfg.ServicesNamespace
+	if isOIDC && !caller.hasServiceRole(service, types.ServiceRoleOwner) {
+		return http.StatusForbidden, fmt.Sprintf("User %s doesn't have permision to delete this service", uid)
+	}
+	if service.Namespace == "" {
+		service.Namespace = cfg.ServicesNamespace
+	}
+
+	if err := back.DeleteService(*service); err != nil {
+		// Check if error is caused because the service is not found
+		if errors.IsNotFound(err) || errors.IsGone(err) {
+			return http.StatusNotFound, ""
 		}
+		return http.StatusInternalServerError, err.Error()
+	}
 
-		if err := back.DeleteService(*service); err != nil {
-			// Check if error is caused because the service is not found
-			if errors.IsNotFound(err) || errors.IsGone(err) {
-				c.Status(http.StatusNotFound)
-			} else {
-				c.String(http.StatusInternalServerError, err.Error())
-			}
-			return
+	if err := deleteServiceSchedule(caller.ctx, back.GetKubeClientset(), service.Namespace, service.Name); err != nil {
+		deleteLogger.Printf("error deleting schedule of service %s: %v", service.Name, err)
+	}
+
+	if err := utils.DeleteServiceRevisions(caller.ctx, back.GetKubeClientset(), service.Namespace, service.Name); err != nil {
+		deleteLogger.Printf("error deleting revisions of service %s: %v", service.Name, err)
+	}
+
+	if err := deleteIdempotencyRecords(caller.ctx, back.GetKubeClientset(), service.Namespace, service.Name); err != nil {
+		deleteLogger.Printf("error deleting idempotency keys of service %s: %v", service.Name, err)
+	}
+
+	refreshSecretName := utils.RefreshTokenSecretName(service.Name)
+	if refreshSecretName != "" {
+		if err := utils.DeleteSecret(refreshSecretName, service.Namespace, back.GetKubeClientset()); err != nil {
+			log.Printf("error deleting refresh-token secret %s/%s: %v", service.Namespace, refreshSecretName, err)
 		}
+	}
 
-		refreshSecretName := utils.RefreshTokenSecretName(service.Name)
-		if refreshSecretName != "" {
-			if err := utils.DeleteSecret(refreshSecretName, service.Namespace, back.GetKubeClientset()); err != nil {
-				log.Printf("error deleting refresh-token secret %s/%s: %v", service.Namespace, refreshSecretName, err)
-			}
+	if err := utils.DeleteSecret(auth.ServiceTokensSecretName(service.Name), service.Namespace, back.GetKubeClientset()); err != nil {
+		deleteLogger.Printf("error deleting tokens of service %s: %v", service.Name, err)
+	}
+
+	// A new service with the same name must not read the logs of the old jobs
+	if archive := utils.MakeJobArchive(cfg); archive != nil {
+		if err := archive.DeleteService(caller.ctx, service.Namespace, service.Name); err != nil {
+			deleteLogger.Printf("error deleting archived jobs of service %s: %v", service.Name, err)
 		}
+	}
 
-		minIOAdminClient, err := utils.MakeMinIOAdminClient(cfg)
+	minIOAdminClient, err := utils.MakeMinIOAdminClient(cfg)
+	if err != nil {
+		log.Printf("the provided MinIO configuration is not valid: %v", err)
+	}
+
+	if service.Mount.Path != "" {
+		path := strings.Trim(service.Mount.Path, " /")
+		// Split buckets and folders from path
+		bucket := strings.SplitN(path, "/", 2)
+		var users []string
+		err = minIOAdminClient.CreateAddGroup(bucket[0], users, true)
 		if err != nil {
-			log.Printf("the provided MinIO configuration is not valid: %v", err)
+			log.Printf("error updating MinIO users in group: %v", err)
 		}
+	}
 
-		if service.Mount.Path != "" {
-			path := strings.Trim(service.Mount.Path, " /")
-			// Split buckets and folders from path
-			bucket := strings.SplitN(path, "/", 2)
-			var users []string
-			err = minIOAdminClient.CreateAddGroup(bucket[0], users, true)
-			if err != nil {
-				log.Printf("error updating MinIO users in group: %v", err)
-			}
-		}
+	// Remove the service's webhook in MinIO config and restart the server
+	if err := removeMinIOWebhook(service.Name, minIOAdminClient); err != nil {
+		log.Printf("Error removing MinIO webhook for service \"%s\": %v\n", service.Name, err)
+	}
 
-		// Remove the service's webhook in MinIO config and restart the server
-		if err := removeMinIOWebhook(service.Name, minIOAdminClient); err != nil {
-			log.Printf("Error removing MinIO webhook for service \"%s\": %v\n", service.Name, err)
-		}
+	syncACLBucketPolicies(cfg, nil, service)
 
-		// Delete service buckets
-		err = deleteBuckets(service, cfg, minIOAdminClient)
-		if err != nil && !strings.Contains(err.Error(), allUserGroupNotExist) && !strings.Contains(err.Error(), bucketNotExist) {
-			c.String(http.StatusInternalServerError, "Error deleting service buckets: ", err)
-		}
+	// Delete service buckets, the errors are returned once the rest of the resources are removed
+	var bucketsErr string
+	err = deleteBuckets(service, cfg, minIOAdminClient)
+	if err != nil && !strings.Contains(err.Error(), allUserGroupNotExist) && !strings.Contains(err.Error(), bucketNotExist) {
+		bucketsErr = fmt.Sprintf("Error deleting service buckets: %v", err)
+	}
 
-		if len(service.BucketList) > 0 && strings.ToUpper(service.IsolationLevel) == types.IsolationLevelUser {
-			for i, b := range service.BucketList {
-				err = minIOAdminClient.RemoveResource(b, service.AllowedUsers[i], false)
-				if err != nil {
-					c.String(http.StatusInternalServerError, "error while removing isolated bucket %v", err)
-				}
+	if len(service.BucketList) > 0 && strings.ToUpper(service.IsolationLevel) == types.IsolationLevelUser {
+		for i, b := range service.BucketList {
+			err = minIOAdminClient.RemoveResource(b, service.AllowedUsers[i], false)
+			if err != nil && bucketsErr == "" {
+				bucketsErr = fmt.Sprintf("error while removing isolated bucket %v", err)
 			}
 		}
+	}
 
-		// Add Yunikorn queue if enabled
-		if cfg.YunikornEnable {
-			if err := utils.DeleteYunikornQueue(cfg, back.GetKubeClientset(), service); err != nil {
-				log.Println(err.Error())
-			}
+	// Add Yunikorn queue if enabled
+	if cfg.YunikornEnable {
+		if err := utils.DeleteYunikornQueue(cfg, back.GetKubeClientset(), service); err != nil {
+			log.Println(err.Error())
 		}
-		if cfg.KueueEnable {
-			if err := utils.DeleteKueueLocalQueue(c.Request.Context(), cfg, service.Namespace, service.Name); err != nil {
-				log.Println(err.Error()) // #nosec
-			}
+	}
+	if cfg.KueueEnable {
+		if err := utils.DeleteKueueLocalQueue(caller.ctx, cfg, service.Namespace, service.Name); err != nil {
+			log.Println(err.Error()) // #nosec
 		}
+	}
 
-		c.Status(http.StatusNoContent)
+	if bucketsErr != "" {
+		return http.StatusInternalServerError, bucketsErr
 	}
+	return http.StatusNoContent, ""
 }
 
 func removeMinIOWebhook(name string, minIOAdminClient *utils.MinIOAdminClient) error {
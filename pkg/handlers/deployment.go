@@ -77,7 +77,7 @@ func MakeGetDeploymentStatusHandler(back types.ServerlessBackend, kubeClientset
 			c.String(http.StatusBadRequest, serviceName)
 			return
 		}
-		service, ok := getAuthorizedService(c, back, serviceName)
+		service, ok := getAuthorizedService(c, back, serviceName, types.ServiceRoleViewer)
 		if !ok {
 			c.String(http.StatusForbidden, "You do not have permission to access this service")
 			return
@@ -101,6 +101,7 @@ func MakeGetDeploymentStatusHandler(back types.ServerlessBackend, kubeClientset
 // @Param serviceName path string true "Service name"
 // @Param timestamps query bool false "Include timestamps"
 // @Param tailLines query int false "Maximum number of recent log entries to return"
+// @Param follow query bool false "Stream the logs of the newest pod until the client disconnects, as Server-Sent Events if accepted by the client or as chunked text"
 // @Success 200 {object} types.DeploymentLogStream
 // @Failure 401 {string} string "Unauthorized"
 // @Failure 403 {string} string "Forbidden"
@@ -116,7 +117,7 @@ func MakeGetDeploymentLogsHandler(back types.ServerlessBackend, kubeClientset ku
 			c.String(http.StatusBadRequest, serviceName)
 			return
 		}
-		service, ok := getAuthorizedService(c, back, serviceName)
+		service, ok := getAuthorizedService(c, back, serviceName, types.ServiceRoleViewer)
 		if !ok {
 			c.String(http.StatusForbidden, "You do not have permission to access this service")
 			return
@@ -125,6 +126,24 @@ func MakeGetDeploymentLogsHandler(back types.ServerlessBackend, kubeClientset ku
 		includeTimestamps, _ := strconv.ParseBool(c.DefaultQuery("timestamps", "false"))
 		tailLines := parseTailLines(c.DefaultQuery("tailLines", "200"))
 
+		if isFollowRequest(c) {
+			follower := &podLogFollower{
+				kubeClientset: kubeClientset,
+				namespace:     resolveServiceNamespace(service, cfg),
+				timestamps:    includeTimestamps,
+				tailLines:     &tailLines,
+				listPods: func(ctx context.Context) ([]corev1.Pod, error) {
+					runtimeCtx, err := inspectDeploymentRuntime(back, kubeClientset, service, cfg)
+					return runtimeCtx.logPods, err
+				},
+				containerName: deploymentLogContainerName,
+				// Deployments are followed until the client disconnects
+				finished: func(context.Context) bool { return false },
+			}
+			follower.follow(c)
+			return
+		}
+
 		runtimeCtx, err := inspectDeploymentRuntime(back, kubeClientset, service, cfg)
 		if err != nil {
 			c.String(http.StatusInternalServerError, err.Error())
@@ -627,7 +646,8 @@ func collectDeploymentLogs(kubeClientset kubernetes.Interface, namespace string,
 	return responseEntries
 }
 
-func getPodDeploymentLogs(kubeClientset kubernetes.Interface, pod *corev1.Pod, namespace string, tailLines int64) ([]logEntryWithTime, error) {
+// deploymentLogContainerName returns the container with the logs of a deployment pod
+func deploymentLogContainerName(pod corev1.Pod) string {
 	containerName := types.ContainerName
 
 	if len(pod.Spec.Containers) > 0 {
@@ -638,9 +658,12 @@ func getPodDeploymentLogs(kubeClientset kubernetes.Interface, pod *corev1.Pod, n
 			containerName = utils.KserveLLMISVCContainerName
 		}
 	}
+	return containerName
+}
 
+func getPodDeploymentLogs(kubeClientset kubernetes.Interface, pod *corev1.Pod, namespace string, tailLines int64) ([]logEntryWithTime, error) {
 	req := kubeClientset.CoreV1().Pods(namespace).GetLogs(pod.Name, &corev1.PodLogOptions{
-		Container:  containerName,
+		Container:  deploymentLogContainerName(*pod),
 		Timestamps: true,
 		TailLines:  &tailLines,
 	})
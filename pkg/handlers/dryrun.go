@@ -0,0 +1,217 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/grycap/oscar/v4/pkg/types"
+	"github.com/grycap/oscar/v4/pkg/utils"
+	"github.com/grycap/oscar/v4/pkg/utils/auth"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	dryRunQuery = "dryRun"
+
+	planOperationCreate = "create"
+	planOperationUpdate = "update"
+)
+
+// checkWorkloadQuota checks the Kueue quota of the services during dry-runs, replaceable in tests
+var checkWorkloadQuota = utils.CheckWorkloadQuota
+
+func isDryRun(c *gin.Context) bool {
+	dryRun, _ := strconv.ParseBool(c.Query(dryRunQuery))
+	return dryRun
+}
+
+// dryRunService validates the service definition and renders the resources that
+// a create or update request would apply, without modifying the cluster or MinIO.
+// The buckets are planned with the same checks createBuckets applies, and the Kueue
+// admission is checked reading the quota of the ClusterQueue of the owner.
+func dryRunService(c *gin.Context, cfg *types.Config, back types.ServerlessBackend, service *types.Service, operation string) {
+	var validationErrors []error
+	if err := normalizeStoragePaths(service); err != nil {
+		validationErrors = append(validationErrors, err)
+	}
+	service.AllowedUsers = sanitizeUsers(service.AllowedUsers)
+	service.Script = utils.NormalizeLineEndings(service.Script)
+
+	// Check service values and set defaults
+	checkValues(service, cfg)
+	utils.ApplyFederation(service)
+	for _, err := range validateServiceSpec(service, cfg) {
+		validationErrors = append(validationErrors, fmt.Errorf("the service specification is not valid: %v", err))
+	}
+
+	owner := types.DefaultOwner
+	namespace := cfg.ServicesNamespace
+	if isBearerRequest(c) {
+		uid, err := auth.GetUIDFromContext(c)
+		if err != nil || uid == "" {
+			c.String(http.StatusInternalServerError, "Couldn't find user identification")
+			return
+		}
+		owner = uid
+		namespace = utils.BuildUserNamespace(cfg, uid)
+	}
+
+	switch operation {
+	case planOperationCreate:
+		service.Owner = owner
+		if service.Namespace == "" {
+			service.Namespace = namespace
+		}
+		exists, err := serviceWithSameNameExists(service.Name, back)
+		if err != nil {
+			c.String(http.StatusInternalServerError, fmt.Sprintf("Error checking for existing service: %v", err))
+			return
+		}
+		if exists {
+			validationErrors = append(validationErrors, fmt.Errorf("a service with the provided name already exists"))
+		}
+	case planOperationUpdate:
+		oldService, err := back.ReadService("", service.Name)
+		if err != nil {
+			if k8sErrors.IsNotFound(err) || k8sErrors.IsGone(err) {
+				c.Status(http.StatusNotFound)
+			} else {
+				c.String(http.StatusInternalServerError, fmt.Sprintf("Error reading the service: %v", err))
+			}
+			return
+		}
+		if owner != types.DefaultOwner && !auth.HasServiceRole(c, oldService, types.ServiceRoleEditor) {
+			c.String(http.StatusForbidden, "User %s doesn't have permision to modify this service", owner)
+			return
+		}
+		if !utils.SameVolumeConfig(oldService.Volume, service.Volume) {
+			validationErrors = append(validationErrors, fmt.Errorf("volume updates are not supported after service creation"))
+		}
+		service.Owner = oldService.Owner
+		service.Token = oldService.Token
+		service.Namespace = resolveServiceNamespace(oldService, cfg)
+	}
+
+	if service.Owner != types.DefaultOwner && cfg.KueueEnable {
+		service.Labels["kueue.x-k8s.io/queue-name"] = utils.BuildLocalQueueName(service.Name)
+	}
+
+	plan := &types.ServicePlan{Service: service.Name, Namespace: service.Namespace}
+	if planBackend, ok := back.(types.PlanBackend); ok {
+		rendered, err := planBackend.PlanService(*service)
+		if err != nil {
+			c.String(http.StatusInternalServerError, fmt.Sprintf("Error rendering the service: %v", err))
+			return
+		}
+		plan = rendered
+	}
+	plan.Operation = operation
+	for _, err := range validationErrors {
+		plan.AddError(err)
+	}
+
+	if service.Owner != types.DefaultOwner && cfg.KueueEnable {
+		if err := checkWorkloadQuota(c.Request.Context(), *service, cfg); err != nil {
+			plan.AddError(fmt.Errorf("workload for service %s can't be admitted by Kueue: %v", service.Name, err))
+		}
+	}
+
+	buckets, err := planBuckets(service, cfg)
+	plan.Buckets = buckets
+	plan.AddError(err)
+
+	plan.Valid = len(plan.Errors) == 0
+	if !plan.Valid {
+		c.JSON(http.StatusBadRequest, plan)
+		return
+	}
+	c.JSON(http.StatusOK, plan)
+}
+
+// bucketPlanner records the buckets and folders createBuckets would configure, without creating them
+type bucketPlanner struct {
+	service *types.Service
+	buckets []types.PlannedBucket
+}
+
+// planBuckets lists the buckets and folders createBuckets would configure, with the same validations
+func planBuckets(service *types.Service, cfg *types.Config) ([]types.PlannedBucket, error) {
+	planner := &bucketPlanner{service: service}
+	if _, err := createServiceBuckets(service, cfg, planner, false, false); err != nil {
+		return nil, err
+	}
+	return planner.buckets, nil
+}
+
+func (planner *bucketPlanner) createS3Path(provider string, path []string, webhook bool, _ bool) error {
+	folder := ""
+	if len(path) > 1 {
+		folder = strings.Trim(path[1], " /")
+	}
+	planner.addBucket(path[0], provider, folder, webhook)
+	return nil
+}
+
+// addPolicy is not planned, as the users of the buckets are listed with them
+func (planner *bucketPlanner) addPolicy(string, string) error {
+	return nil
+}
+
+func (planner *bucketPlanner) createContainer(provider string, path string) error {
+	planner.addBucket(path, provider, "", false)
+	return nil
+}
+
+// mountBucketVisibility plans the creation of the bucket of the mount, as the existing buckets aren't read
+func (planner *bucketPlanner) mountBucketVisibility(string, string) (bool, string, error) {
+	return false, "", nil
+}
+
+func (planner *bucketPlanner) addBucket(name string, provider string, folder string, webhook bool) {
+	for i := range planner.buckets {
+		bucket := &planner.buckets[i]
+		if bucket.Name == name && bucket.Provider == provider {
+			if folder != "" && !slices.Contains(bucket.Folders, folder) {
+				bucket.Folders = append(bucket.Folders, folder)
+			}
+			bucket.Webhook = bucket.Webhook || webhook
+			return
+		}
+	}
+	visibility := planner.service.Visibility
+	if visibility == "" {
+		visibility = utils.PRIVATE
+	}
+	bucket := types.PlannedBucket{
+		Name:         name,
+		Provider:     provider,
+		Webhook:      webhook,
+		Visibility:   visibility,
+		AllowedUsers: planner.service.AllowedUsers,
+		Owner:        planner.service.Owner,
+	}
+	if folder != "" {
+		bucket.Folders = []string{folder}
+	}
+	planner.buckets = append(planner.buckets, bucket)
+}
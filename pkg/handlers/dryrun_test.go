@@ -0,0 +1,191 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/grycap/oscar/v4/pkg/backends"
+	"github.com/grycap/oscar/v4/pkg/types"
+)
+
+const dryRunServiceBody = `{
+	"name": "cowsay",
+	"image": "ghcr.io/grycap/cowsay",
+	"script": "echo hi",
+	"input": [{"storage_provider": "minio", "path": "cowsay/input"}],
+	"output": [{"storage_provider": "minio", "path": "cowsay/output"}],
+	"storage_providers": {"minio": {"default": {"endpoint": "http://minio"}}}
+}`
+
+func TestMakeCreateHandlerDryRun(t *testing.T) {
+	back := backends.MakeFakeBackend()
+	cfg := &types.Config{ServicesNamespace: "oscar-svc", MinIOProvider: &types.MinIOProvider{Endpoint: "http://minio"}}
+
+	r := gin.New()
+	r.POST("/system/services", MakeCreateHandler(cfg, back))
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/system/services?dryRun=true", strings.NewReader(dryRunServiceBody))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if back.CreatedService != nil {
+		t.Fatal("dry-run must not create the service")
+	}
+
+	var plan types.ServicePlan
+	if err := json.Unmarshal(w.Body.Bytes(), &plan); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if !plan.Valid || plan.Operation != planOperationCreate || plan.Namespace != "oscar-svc" {
+		t.Fatalf("unexpected plan: %+v", plan)
+	}
+	if len(plan.Resources) != 1 || plan.Resources[0].Kind != "PodTemplate" {
+		t.Fatalf("unexpected resources: %+v", plan.Resources)
+	}
+	if len(plan.Buckets) != 1 || plan.Buckets[0].Name != "cowsay" || !plan.Buckets[0].Webhook || len(plan.Buckets[0].Folders) != 2 {
+		t.Fatalf("unexpected buckets: %+v", plan.Buckets)
+	}
+}
+
+func TestMakeCreateHandlerDryRunErrors(t *testing.T) {
+	back := backends.MakeFakeBackend()
+	back.Services = []*types.Service{{Name: "cowsay"}}
+	cfg := &types.Config{ServicesNamespace: "oscar-svc", MinIOProvider: &types.MinIOProvider{Endpoint: "http://minio"}}
+
+	r := gin.New()
+	r.POST("/system/services", MakeCreateHandler(cfg, back))
+
+	body := strings.Replace(dryRunServiceBody, `"storage_provider": "minio", "path": "cowsay/output"`, `"storage_provider": "s3.aws", "path": "cowsay/output"`, 1)
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/system/services?dryRun=true", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %s", w.Code, w.Body.String())
+	}
+	var plan types.ServicePlan
+	if err := json.Unmarshal(w.Body.Bytes(), &plan); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if plan.Valid || len(plan.Errors) != 2 {
+		t.Fatalf("expected two validation errors, got %+v", plan.Errors)
+	}
+}
+
+func TestMakeCreateHandlerDryRunKueueQuota(t *testing.T) {
+	back := backends.MakeFakeBackend()
+	cfg := &types.Config{ServicesNamespace: "oscar-svc", KueueEnable: true, MinIOProvider: &types.MinIOProvider{Endpoint: "http://minio"}}
+	var checked *types.Service
+	defer func(check func(context.Context, types.Service, *types.Config) error) { checkWorkloadQuota = check }(checkWorkloadQuota)
+	checkWorkloadQuota = func(_ context.Context, service types.Service, _ *types.Config) error {
+		checked = &service
+		return fmt.Errorf("the workload requests 4 of cpu, over the quota of 2")
+	}
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("uidOrigin", "owner")
+		c.Next()
+	})
+	r.POST("/system/services", MakeCreateHandler(cfg, back))
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/system/services?dryRun=true", strings.NewReader(dryRunServiceBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer token")
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %s", w.Code, w.Body.String())
+	}
+	if checked == nil || checked.Owner != "owner" {
+		t.Fatalf("expected the quota of the owner to be checked, got %+v", checked)
+	}
+	var plan types.ServicePlan
+	if err := json.Unmarshal(w.Body.Bytes(), &plan); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if plan.Valid || len(plan.Errors) != 1 || !strings.Contains(plan.Errors[0], "over the quota") {
+		t.Fatalf("expected the quota error, got %+v", plan.Errors)
+	}
+}
+
+func TestMakeUpdateHandlerDryRun(t *testing.T) {
+	back := backends.MakeFakeBackend()
+	back.Service = &types.Service{Name: "cowsay", Namespace: "oscar-svc", Owner: types.DefaultOwner, Token: "current-token"}
+	cfg := &types.Config{ServicesNamespace: "oscar-svc", MinIOProvider: &types.MinIOProvider{Endpoint: "http://minio"}}
+
+	r := gin.New()
+	r.PUT("/system/services", MakeUpdateHandler(cfg, back))
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPut, "/system/services?dryRun=1", bytes.NewBufferString(dryRunServiceBody))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if back.UpdatedService != nil {
+		t.Fatal("dry-run must not update the service")
+	}
+
+	var plan types.ServicePlan
+	if err := json.Unmarshal(w.Body.Bytes(), &plan); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if !plan.Valid || plan.Operation != planOperationUpdate {
+		t.Fatalf("unexpected plan: %+v", plan)
+	}
+}
+
+func TestMakeUpdateHandlerDryRunForbidden(t *testing.T) {
+	back := backends.MakeFakeBackend()
+	back.Service = &types.Service{Name: "cowsay", Namespace: "oscar-svc", Owner: "owner"}
+	cfg := &types.Config{ServicesNamespace: "oscar-svc", MinIOProvider: &types.MinIOProvider{Endpoint: "http://minio"}}
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("uidOrigin", "other")
+		c.Next()
+	})
+	r.PUT("/system/services", MakeUpdateHandler(cfg, back))
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPut, "/system/services?dryRun=true", bytes.NewBufferString(dryRunServiceBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer token")
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d: %s", w.Code, w.Body.String())
+	}
+}
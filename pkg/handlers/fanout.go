@@ -0,0 +1,548 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/grycap/oscar/v4/pkg/types"
+	"github.com/grycap/oscar/v4/pkg/utils"
+	"github.com/grycap/oscar/v4/pkg/utils/auth"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// fanoutFlushInterval number of submitted objects between the updates of the progress of a run
+	fanoutFlushInterval = 50
+	// maxFanoutRunNameLength maximum length of the names of the runs, used as label values
+	maxFanoutRunNameLength = 40
+)
+
+var (
+	fanoutLogger        = log.New(os.Stdout, "[FANOUT-HANDLER] ", log.Flags())
+	validFanoutRunName  = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+	fanoutSubmitters    = map[string]context.CancelFunc{}
+	fanoutSubmitterLock sync.Mutex
+)
+
+// MakeFanoutHandler godoc
+// @Summary Run a service over the objects of a storage path
+// @Description Submit a job for each object of the path of a MinIO or S3 storage provider of the service, filtered by prefix and suffix like the service inputs. Each job receives a MinIO event of the creation of its object. The jobs are submitted in the background and tracked as a named run.
+// @Tags services
+// @Accept json
+// @Produce json
+// @Param serviceName path string true "Service name"
+// @Param request body types.FanoutRequest true "Storage path of the objects"
+// @Success 202 {object} types.FanoutRun
+// @Failure 400 {string} string "Bad Request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Not Found"
+// @Failure 409 {string} string "Conflict"
+// @Failure 413 {string} string "Too many objects"
+// @Failure 502 {string} string "Bad Gateway"
+// @Security BasicAuth
+// @Security BearerAuth
+// @Router /system/services/{serviceName}/fanout [post]
+func MakeFanoutHandler(cfg *types.Config, kubeClientset kubernetes.Interface, back types.ServerlessBackend) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		service, ok := getAuthorizedService(c, back, c.Param("serviceName"), types.ServiceRoleInvoker)
+		if !ok {
+			if !c.Writer.Written() {
+				c.Status(http.StatusForbidden)
+			}
+			return
+		}
+
+		var request types.FanoutRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("The fan-out request is not valid: %v", err))
+			return
+		}
+		if request.Name == "" {
+			request.Name = "run-" + uuid.New().String()[:8]
+		} else if len(request.Name) > maxFanoutRunNameLength || !validFanoutRunName.MatchString(request.Name) {
+			c.String(http.StatusBadRequest, fmt.Sprintf("The run name must be a lowercase RFC 1123 label of up to %d characters", maxFanoutRunNameLength))
+			return
+		}
+		if strings.Trim(request.Path, "/ ") == "" {
+			c.String(http.StatusBadRequest, "The path of the objects is required")
+			return
+		}
+
+		principal := service.Owner
+		var uid string
+		if isBearerRequest(c) {
+			var err error
+			if uid, err = auth.GetUIDFromContext(c); err != nil {
+				c.String(http.StatusUnauthorized, err.Error())
+				return
+			}
+			principal = uid
+		}
+		s3Client, eventSource, err := fanoutStorageClient(c, cfg, service, request.Provider, uid)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		objects, err := utils.ListStorageObjects(c.Request.Context(), s3Client, request.StorageIOConfig, cfg.FanoutMaxObjects)
+		if err != nil {
+			if _, ok := err.(utils.ErrTooManyObjects); ok {
+				c.String(http.StatusRequestEntityTooLarge, err.Error())
+			} else {
+				c.String(http.StatusBadGateway, err.Error())
+			}
+			return
+		}
+
+		podSpec, namespace, err := getPodSpecNamespace(service, cfg)
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		run := &types.FanoutRun{
+			Name:            request.Name,
+			Service:         service.Name,
+			Namespace:       namespace,
+			StorageProvider: request.Provider,
+			Path:            request.Path,
+			Prefix:          request.Prefix,
+			Suffix:          request.Suffix,
+			Owner:           uid,
+			Status:          types.FanoutRunning,
+			CreatedAt:       metav1.Now(),
+			Objects:         len(objects),
+		}
+		if len(objects) == 0 {
+			run.Status = types.FanoutCompleted
+		} else {
+			heartbeat := metav1.Now()
+			run.SubmitterHeartbeat = &heartbeat
+		}
+		if err := utils.CreateFanoutRun(c.Request.Context(), kubeClientset, run); err != nil {
+			if apierrors.IsAlreadyExists(err) {
+				c.String(http.StatusConflict, fmt.Sprintf("The run \"%s\" already exists", run.Name))
+			} else {
+				c.String(http.StatusInternalServerError, err.Error())
+			}
+			return
+		}
+
+		// The jobs are not delegated to the federated replicas, so all of them are tracked
+		invocation := newJobInvocation(cfg, kubeClientset, back, nil, service, podSpec, namespace)
+		invocation.uidFromToken = uid
+		invocation.labels = map[string]string{types.FanoutRunLabel: run.Name}
+		if len(objects) > 0 {
+			go submitFanoutRun(invocation, *run, objects, eventSource, principal)
+		}
+		fanoutLogger.Printf("Started run \"%s\" of service \"%s\" over %d objects of \"%s\"", run.Name, service.Name, len(objects), run.Path)
+		run.Progress.Pending = run.Objects
+		c.JSON(http.StatusAccepted, run)
+	}
+}
+
+// MakeListFanoutRunsHandler godoc
+// @Summary List the fan-out runs of a service
+// @Description List the fan-out runs of a service with their progress, from the newest to the oldest.
+// @Tags services
+// @Produce json
+// @Param serviceName path string true "Service name"
+// @Success 200 {array} types.FanoutRun
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Not Found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Security BasicAuth
+// @Security BearerAuth
+// @Router /system/services/{serviceName}/fanout [get]
+func MakeListFanoutRunsHandler(cfg *types.Config, kubeClientset kubernetes.Interface, back types.ServerlessBackend) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		service, ok := getAuthorizedService(c, back, c.Param("serviceName"), types.ServiceRoleViewer)
+		if !ok {
+			if !c.Writer.Written() {
+				c.Status(http.StatusForbidden)
+			}
+			return
+		}
+		runs, err := utils.ListFanoutRuns(c.Request.Context(), kubeClientset, resolveServiceNamespace(service, cfg), service.Name)
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		for i := range runs {
+			if err := setFanoutProgress(c.Request.Context(), kubeClientset, &runs[i]); err != nil {
+				c.String(http.StatusInternalServerError, err.Error())
+				return
+			}
+		}
+		c.JSON(http.StatusOK, runs)
+	}
+}
+
+// MakeReadFanoutRunHandler godoc
+// @Summary Get a fan-out run
+// @Description Get a fan-out run of a service with the number of pending, running, succeeded and failed objects.
+// @Tags services
+// @Produce json
+// @Param serviceName path string true "Service name"
+// @Param runName path string true "Run name"
+// @Success 200 {object} types.FanoutRun
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Not Found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Security BasicAuth
+// @Security BearerAuth
+// @Router /system/services/{serviceName}/fanout/{runName} [get]
+func MakeReadFanoutRunHandler(cfg *types.Config, kubeClientset kubernetes.Interface, back types.ServerlessBackend) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		service, ok := getAuthorizedService(c, back, c.Param("serviceName"), types.ServiceRoleViewer)
+		if !ok {
+			if !c.Writer.Written() {
+				c.Status(http.StatusForbidden)
+			}
+			return
+		}
+		run, err := utils.GetFanoutRun(c.Request.Context(), kubeClientset, resolveServiceNamespace(service, cfg), service.Name, c.Param("runName"))
+		if err == nil {
+			err = setFanoutProgress(c.Request.Context(), kubeClientset, run)
+		}
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				c.Status(http.StatusNotFound)
+			} else {
+				c.String(http.StatusInternalServerError, err.Error())
+			}
+			return
+		}
+		c.JSON(http.StatusOK, run)
+	}
+}
+
+// MakeCancelFanoutRunHandler godoc
+// @Summary Cancel a fan-out run
+// @Description Stop submitting the jobs of a fan-out run and delete its unfinished jobs. The finished jobs are kept.
+// @Tags services
+// @Produce json
+// @Param serviceName path string true "Service name"
+// @Param runName path string true "Run name"
+// @Success 200 {object} types.FanoutRun
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Not Found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Security BasicAuth
+// @Security BearerAuth
+// @Router /system/services/{serviceName}/fanout/{runName}/cancel [post]
+func MakeCancelFanoutRunHandler(cfg *types.Config, kubeClientset kubernetes.Interface, back types.ServerlessBackend) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		service, ok := getAuthorizedService(c, back, c.Param("serviceName"), types.ServiceRoleInvoker)
+		if !ok {
+			if !c.Writer.Written() {
+				c.Status(http.StatusForbidden)
+			}
+			return
+		}
+		ctx := c.Request.Context()
+		namespace := resolveServiceNamespace(service, cfg)
+		run, err := utils.UpdateFanoutRun(ctx, kubeClientset, namespace, service.Name, c.Param("runName"), func(run *types.FanoutRun) {
+			if run.Status == types.FanoutRunning {
+				run.Status = types.FanoutCancelled
+			}
+		})
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				c.Status(http.StatusNotFound)
+			} else {
+				c.String(http.StatusInternalServerError, err.Error())
+			}
+			return
+		}
+
+		fanoutSubmitterLock.Lock()
+		if cancel, ok := fanoutSubmitters[fanoutSubmitterKey(namespace, service.Name, run.Name)]; ok {
+			cancel()
+		}
+		fanoutSubmitterLock.Unlock()
+		if err := deleteUnfinishedFanoutJobs(ctx, kubeClientset, namespace, service.Name, run.Name); err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		if err := setFanoutProgress(ctx, kubeClientset, run); err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, run)
+	}
+}
+
+// MakeFanoutJobCounter returns a finished job handler that counts the succeeded and failed jobs of the fan-out runs,
+// so their progress is kept when the finished jobs are deleted
+func MakeFanoutJobCounter(kubeClientset kubernetes.Interface) func(ctx context.Context, job *batchv1.Job) error {
+	return func(ctx context.Context, job *batchv1.Job) error {
+		runName := job.Labels[types.FanoutRunLabel]
+		if runName == "" {
+			return nil
+		}
+		succeeded := jobSucceeded(job)
+		_, err := utils.UpdateFanoutRun(ctx, kubeClientset, job.Namespace, job.Labels[types.ServiceLabel], runName, func(run *types.FanoutRun) {
+			if succeeded {
+				run.Progress.Succeeded++
+			} else {
+				run.Progress.Failed++
+			}
+			completeFanoutRun(run)
+		})
+		// The jobs of deleted runs are not counted
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+}
+
+// submitFanoutRun submits the jobs of the objects of a run in the background, updating its progress
+// periodically. The submission stops when the run is cancelled, also from another replica of the manager.
+// The updates are the heartbeat of the submission, so the run is set as failed if the manager restarts.
+func submitFanoutRun(invocation *jobInvocation, run types.FanoutRun, objects []utils.StorageObject, eventSource string, principal string) {
+	key := fanoutSubmitterKey(run.Namespace, run.Service, run.Name)
+	ctx, cancel := context.WithCancel(context.Background())
+	fanoutSubmitterLock.Lock()
+	fanoutSubmitters[key] = cancel
+	fanoutSubmitterLock.Unlock()
+	defer func() {
+		fanoutSubmitterLock.Lock()
+		delete(fanoutSubmitters, key)
+		fanoutSubmitterLock.Unlock()
+		cancel()
+	}()
+
+	var mutex sync.Mutex
+	var submitted, failed int
+	var lastError string
+	flush := func(done bool) {
+		mutex.Lock()
+		submittedDelta, failedDelta, message := submitted, failed, lastError
+		submitted, failed, lastError = 0, 0, ""
+		mutex.Unlock()
+		updated, err := utils.UpdateFanoutRun(context.Background(), invocation.kubeClientset, run.Namespace, run.Service, run.Name, func(run *types.FanoutRun) {
+			run.Submitted += submittedDelta
+			run.Progress.Failed += failedDelta
+			if message != "" {
+				run.Message = message
+			}
+			if done {
+				run.SubmitterHeartbeat = nil
+			} else {
+				heartbeat := metav1.Now()
+				run.SubmitterHeartbeat = &heartbeat
+			}
+			completeFanoutRun(run)
+		})
+		if err != nil {
+			fanoutLogger.Printf("Error updating the progress of run \"%s\": %v", run.Name, err)
+			return
+		}
+		if updated.Status == types.FanoutCancelled {
+			cancel()
+		}
+	}
+
+	parallelism := invocation.cfg.JobBatchParallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	// The progress is also recorded while the submissions are slow
+	heartbeats := time.NewTicker(utils.FanoutHeartbeatInterval)
+	heartbeatsDone := make(chan struct{})
+	heartbeatsStopped := make(chan struct{})
+	go func() {
+		defer close(heartbeatsStopped)
+		for {
+			select {
+			case <-heartbeats.C:
+				flush(false)
+			case <-heartbeatsDone:
+				return
+			}
+		}
+	}()
+
+	slots := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i, object := range objects {
+		if i > 0 && i%fanoutFlushInterval == 0 {
+			flush(false)
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		slots <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			submission := invocation.submit(ctx, utils.ObjectCreatedEvent(object, eventSource, principal), nil, "")
+			mutex.Lock()
+			defer mutex.Unlock()
+			if submission.err != nil {
+				failed++
+				lastError = fmt.Sprintf("%s/%s: %v", object.Bucket, object.Key, submission.err)
+				return
+			}
+			submitted++
+		}()
+	}
+	wg.Wait()
+	heartbeats.Stop()
+	close(heartbeatsDone)
+	// The last heartbeat must not be recorded after the end of the submission
+	<-heartbeatsStopped
+	flush(true)
+
+	if ctx.Err() != nil {
+		// Delete the jobs submitted while the run was being cancelled
+		if err := deleteUnfinishedFanoutJobs(context.Background(), invocation.kubeClientset, run.Namespace, run.Service, run.Name); err != nil {
+			fanoutLogger.Printf("Error deleting the jobs of the cancelled run \"%s\": %v", run.Name, err)
+		}
+		fanoutLogger.Printf("Run \"%s\" of service \"%s\" cancelled", run.Name, run.Service)
+		return
+	}
+	fanoutLogger.Printf("Submitted the jobs of run \"%s\" of service \"%s\"", run.Name, run.Service)
+}
+
+// fanoutStorageClient returns the S3 client of a MinIO or S3 provider of the service and the source of its events.
+// The default MinIO provider is accessed with the credentials of the user in the bearer requests.
+func fanoutStorageClient(c *gin.Context, cfg *types.Config, service *types.Service, provider string, uid string) (*s3.S3, string, error) {
+	providerName, providerID, _ := strings.Cut(provider, types.ProviderSeparator)
+	if providerID == "" {
+		providerID = types.DefaultProvider
+	}
+	var providers types.StorageProviders
+	if service.StorageProviders != nil {
+		providers = *service.StorageProviders
+	}
+	switch strings.ToLower(providerName) {
+	case types.MinIOName:
+		if providerID == types.DefaultProvider && cfg.MinIOProvider != nil {
+			minIOProvider := *cfg.MinIOProvider
+			if uid != "" {
+				mc, err := auth.GetMultitenancyConfigFromContext(c)
+				if err != nil {
+					return nil, "", err
+				}
+				if minIOProvider.AccessKey, minIOProvider.SecretKey, err = mc.GetUserCredentials(uid); err != nil {
+					return nil, "", fmt.Errorf("error getting credentials for MinIO user %s: %v", uid, err)
+				}
+			}
+			return minIOProvider.GetS3Client(), "minio:s3", nil
+		}
+		if minIOProvider, ok := providers.MinIO[providerID]; ok && minIOProvider != nil {
+			return minIOProvider.GetS3Client(), "minio:s3", nil
+		}
+	case types.S3Name:
+		if s3Provider, ok := providers.S3[providerID]; ok && s3Provider != nil {
+			return s3Provider.GetS3Client(), "aws:s3", nil
+		}
+	default:
+		return nil, "", fmt.Errorf("the storage provider \"%s\" is not supported, use a MinIO or S3 provider", provider)
+	}
+	return nil, "", fmt.Errorf("the storage provider \"%s\" is not defined in the service", provider)
+}
+
+// setFanoutProgress completes the progress of a run with its running jobs. The objects without a running
+// or finished job are pending.
+func setFanoutProgress(ctx context.Context, kubeClientset kubernetes.Interface, run *types.FanoutRun) error {
+	jobs, err := listFanoutJobs(ctx, kubeClientset, run.Namespace, run.Service, run.Name)
+	if err != nil {
+		return err
+	}
+	run.Progress.Running = 0
+	for _, job := range jobs {
+		suspended := job.Spec.Suspend != nil && *job.Spec.Suspend
+		if !types.JobFinished(&job) && !suspended && job.Status.Active > 0 {
+			run.Progress.Running++
+		}
+	}
+	run.Progress.Pending = max(run.Objects-run.Progress.Succeeded-run.Progress.Failed-run.Progress.Running, 0)
+	return nil
+}
+
+// deleteUnfinishedFanoutJobs deletes the jobs of a run that have not finished
+func deleteUnfinishedFanoutJobs(ctx context.Context, kubeClientset kubernetes.Interface, namespace string, serviceName string, runName string) error {
+	jobs, err := listFanoutJobs(ctx, kubeClientset, namespace, serviceName, runName)
+	if err != nil {
+		return err
+	}
+	propagation := metav1.DeletePropagationBackground
+	for _, job := range jobs {
+		if types.JobFinished(&job) {
+			continue
+		}
+		err := kubeClientset.BatchV1().Jobs(namespace).Delete(ctx, job.Name, metav1.DeleteOptions{PropagationPolicy: &propagation})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func listFanoutJobs(ctx context.Context, kubeClientset kubernetes.Interface, namespace string, serviceName string, runName string) ([]batchv1.Job, error) {
+	jobs, err := kubeClientset.BatchV1().Jobs(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s,%s=%s", types.ServiceLabel, serviceName, types.FanoutRunLabel, runName),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return jobs.Items, nil
+}
+
+// completeFanoutRun sets the run as completed when the jobs of all its objects have finished
+func completeFanoutRun(run *types.FanoutRun) {
+	if run.Status == types.FanoutRunning && run.Progress.Succeeded+run.Progress.Failed >= run.Objects {
+		run.Status = types.FanoutCompleted
+	}
+}
+
+// jobSucceeded returns true if the job has completed successfully
+func jobSucceeded(job *batchv1.Job) bool {
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == batchv1.JobComplete && condition.Status == v1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+func fanoutSubmitterKey(namespace string, serviceName string, runName string) string {
+	return namespace + "/" + serviceName + "/" + runName
+}
@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/grycap/oscar/v4/pkg/backends"
+	"github.com/grycap/oscar/v4/pkg/testsupport"
+	"github.com/grycap/oscar/v4/pkg/types"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	testclient "k8s.io/client-go/kubernetes/fake"
+)
+
+func waitFanoutSubmitted(t *testing.T, r *gin.Engine, name string, submitted int) types.FanoutRun {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/system/services/testName/fanout/"+name, nil)
+		r.ServeHTTP(w, req)
+		var run types.FanoutRun
+		if err := json.Unmarshal(w.Body.Bytes(), &run); err != nil {
+			t.Fatalf("invalid run: %v", err)
+		}
+		if run.Submitted+run.Progress.Failed >= submitted || time.Now().After(deadline) {
+			return run
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestMakeFanoutHandler(t *testing.T) {
+	testsupport.SkipIfCannotListen(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/"><Name>bucket</Name><KeyCount>4</KeyCount><IsTruncated>false</IsTruncated>`+
+			`<Contents><Key>input/</Key><Size>10</Size></Contents><Contents><Key>input/a.jpg</Key><Size>10</Size></Contents>`+
+			`<Contents><Key>input/b.png</Key><Size>10</Size></Contents><Contents><Key>input/c.jpg</Key><Size>10</Size></Contents></ListBucketResult>`)
+	}))
+	defer server.Close()
+	cfg := &types.Config{
+		ServicesNamespace: "oscar-svc",
+		MinIOProvider:     &types.MinIOProvider{Endpoint: server.URL, Region: "us-east-1", AccessKey: "minio", SecretKey: "minio123"},
+	}
+	back := backends.MakeFakeBackend()
+	back.Service = &types.Service{Name: "testName", Namespace: "oscar-svc", Owner: "owner", CPU: "100m", Memory: "128Mi", Labels: map[string]string{types.ServiceLabel: "testName"}}
+	kubeClient := testclient.NewSimpleClientset()
+	r := gin.Default()
+	r.POST("/system/services/:serviceName/fanout", MakeFanoutHandler(cfg, kubeClient, back))
+	r.GET("/system/services/:serviceName/fanout", MakeListFanoutRunsHandler(cfg, kubeClient, back))
+	r.GET("/system/services/:serviceName/fanout/:runName", MakeReadFanoutRunHandler(cfg, kubeClient, back))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/system/services/testName/fanout", strings.NewReader(`{"name":"reprocess","storage_provider":"minio.default","path":"bucket/input","suffix":[".jpg"]}`))
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expecting code %d, got %d: %s", http.StatusAccepted, w.Code, w.Body.String())
+	}
+	var run types.FanoutRun
+	if err := json.Unmarshal(w.Body.Bytes(), &run); err != nil {
+		t.Fatalf("invalid run: %v", err)
+	}
+	if run.Name != "reprocess" || run.Objects != 2 || run.Status != types.FanoutRunning || run.Progress.Pending != 2 {
+		t.Fatalf("unexpected run: %+v", run)
+	}
+
+	run = waitFanoutSubmitted(t, r, "reprocess", 2)
+	if run.Submitted != 2 || run.Progress.Pending != 2 || run.SubmitterHeartbeat != nil {
+		t.Fatalf("expected 2 pending jobs, got %+v", run)
+	}
+
+	jobs, _ := kubeClient.BatchV1().Jobs("oscar-svc").List(context.TODO(), metav1.ListOptions{LabelSelector: types.FanoutRunLabel + "=reprocess"})
+	if len(jobs.Items) != 2 {
+		t.Fatalf("expected 2 jobs of the run, got %d", len(jobs.Items))
+	}
+	var events []string
+	for _, job := range jobs.Items {
+		for _, env := range job.Spec.Template.Spec.Containers[0].Env {
+			if env.Name == types.EventVariable {
+				events = append(events, env.Value)
+			}
+		}
+	}
+	if joined := strings.Join(events, "\n"); !strings.Contains(joined, "input%2Fa.jpg") || !strings.Contains(joined, "input%2Fc.jpg") {
+		t.Errorf("expected the events of the objects, got %s", joined)
+	}
+
+	// The finished jobs are counted by the job watcher
+	counter := MakeFanoutJobCounter(kubeClient)
+	succeeded := jobs.Items[0].DeepCopy()
+	succeeded.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: v1.ConditionTrue}}
+	failed := jobs.Items[1].DeepCopy()
+	failed.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: v1.ConditionTrue}}
+	for _, job := range []*batchv1.Job{succeeded, failed} {
+		if err := counter(context.TODO(), job); err != nil {
+			t.Fatalf("unexpected error counting the job: %v", err)
+		}
+		if _, err := kubeClient.BatchV1().Jobs("oscar-svc").Update(context.TODO(), job, metav1.UpdateOptions{}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/system/services/testName/fanout/reprocess", nil)
+	r.ServeHTTP(w, req)
+	if err := json.Unmarshal(w.Body.Bytes(), &run); err != nil {
+		t.Fatalf("invalid run: %v", err)
+	}
+	if run.Status != types.FanoutCompleted || run.Progress.Succeeded != 1 || run.Progress.Failed != 1 || run.Progress.Pending != 0 {
+		t.Errorf("expected the run to be completed, got %+v", run)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/system/services/testName/fanout", nil)
+	r.ServeHTTP(w, req)
+	var runs []types.FanoutRun
+	if err := json.Unmarshal(w.Body.Bytes(), &runs); err != nil || len(runs) != 1 {
+		t.Errorf("expected the run in the list, got %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/system/services/testName/fanout", strings.NewReader(`{"name":"reprocess","storage_provider":"minio.default","path":"bucket/input"}`))
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusConflict {
+		t.Errorf("expecting code %d reusing the run name, got %d", http.StatusConflict, w.Code)
+	}
+}
+
+func TestMakeCancelFanoutRunHandler(t *testing.T) {
+	testsupport.SkipIfCannotListen(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/"><Name>bucket</Name><KeyCount>2</KeyCount><IsTruncated>false</IsTruncated>`+
+			`<Contents><Key>input/a.jpg</Key><Size>10</Size></Contents><Contents><Key>input/b.jpg</Key><Size>10</Size></Contents></ListBucketResult>`)
+	}))
+	defer server.Close()
+	cfg := &types.Config{
+		ServicesNamespace: "oscar-svc",
+		MinIOProvider:     &types.MinIOProvider{Endpoint: server.URL, Region: "us-east-1", AccessKey: "minio", SecretKey: "minio123"},
+	}
+	back := backends.MakeFakeBackend()
+	back.Service = &types.Service{Name: "testName", Namespace: "oscar-svc", Owner: "owner", CPU: "100m", Memory: "128Mi", Labels: map[string]string{types.ServiceLabel: "testName"}}
+	kubeClient := testclient.NewSimpleClientset()
+	r := gin.Default()
+	r.POST("/system/services/:serviceName/fanout", MakeFanoutHandler(cfg, kubeClient, back))
+	r.GET("/system/services/:serviceName/fanout/:runName", MakeReadFanoutRunHandler(cfg, kubeClient, back))
+	r.POST("/system/services/:serviceName/fanout/:runName/cancel", MakeCancelFanoutRunHandler(cfg, kubeClient, back))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/system/services/testName/fanout", strings.NewReader(`{"name":"cancel-me","storage_provider":"minio","path":"bucket/input"}`))
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expecting code %d, got %d: %s", http.StatusAccepted, w.Code, w.Body.String())
+	}
+	waitFanoutSubmitted(t, r, "cancel-me", 2)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/system/services/testName/fanout/cancel-me/cancel", nil)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expecting code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var run types.FanoutRun
+	if err := json.Unmarshal(w.Body.Bytes(), &run); err != nil {
+		t.Fatalf("invalid run: %v", err)
+	}
+	if run.Status != types.FanoutCancelled {
+		t.Errorf("expected the run to be cancelled, got %+v", run)
+	}
+	jobs, _ := kubeClient.BatchV1().Jobs("oscar-svc").List(context.TODO(), metav1.ListOptions{})
+	if len(jobs.Items) != 0 {
+		t.Errorf("expected the unfinished jobs to be deleted, got %d", len(jobs.Items))
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/system/services/testName/fanout/missing/cancel", nil)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expecting code %d cancelling a missing run, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestMakeFanoutHandlerInvalidRequests(t *testing.T) {
+	cfg := &types.Config{
+		MinIOProvider: &types.MinIOProvider{Endpoint: "http://minio.minio:9000", Region: "us-east-1", AccessKey: "minio", SecretKey: "minio123"},
+	}
+	back := backends.MakeFakeBackend()
+	back.Service = &types.Service{Name: "testName"}
+	r := gin.Default()
+	r.POST("/system/services/:serviceName/fanout", MakeFanoutHandler(cfg, testclient.NewSimpleClientset(), back))
+
+	tests := []struct {
+		name string
+		body string
+		code int
+	}{
+		{"invalid json", `{`, http.StatusBadRequest},
+		{"invalid name", `{"name":"Invalid_Name","storage_provider":"minio","path":"bucket"}`, http.StatusBadRequest},
+		{"missing path", `{"storage_provider":"minio"}`, http.StatusBadRequest},
+		{"unsupported provider", `{"storage_provider":"onedata.default","path":"bucket"}`, http.StatusBadRequest},
+		{"undefined provider", `{"storage_provider":"s3.aws","path":"bucket"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/system/services/testName/fanout", strings.NewReader(tt.body))
+			r.ServeHTTP(w, req)
+			if w.Code != tt.code {
+				t.Errorf("expecting code %d, got %d: %s", tt.code, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestMakeFanoutHandlerTooManyObjects(t *testing.T) {
+	testsupport.SkipIfCannotListen(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var contents bytes.Buffer
+		for i := 0; i < 3; i++ {
+			fmt.Fprintf(&contents, "<Contents><Key>input/%d.jpg</Key><Size>10</Size></Contents>", i)
+		}
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/"><Name>bucket</Name><IsTruncated>false</IsTruncated>%s</ListBucketResult>`, contents.String())
+	}))
+	defer server.Close()
+	cfg := &types.Config{
+		FanoutMaxObjects: 2,
+		MinIOProvider:    &types.MinIOProvider{Endpoint: server.URL, Region: "us-east-1", AccessKey: "minio", SecretKey: "minio123"},
+	}
+	back := backends.MakeFakeBackend()
+	back.Service = &types.Service{Name: "testName"}
+	r := gin.New()
+	r.POST("/system/services/:serviceName/fanout", MakeFanoutHandler(cfg, testclient.NewSimpleClientset(), back))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/system/services/testName/fanout", strings.NewReader(`{"storage_provider":"minio","path":"bucket/input"}`))
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expecting code %d, got %d: %s", http.StatusRequestEntityTooLarge, w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,198 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/grycap/oscar/v4/pkg/types"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// IdempotencyKeyHeader header of the asynchronous invocations with the key identifying retries of the same request
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader header of the responses replaying the job previously created with the idempotency key
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	// maxIdempotencyKeyLength maximum length of the idempotency keys
+	maxIdempotencyKeyLength = 255
+	// idempotentJobDeletionTimeout maximum time waiting for the deletion of the job of an expired key
+	idempotentJobDeletionTimeout = 30 * time.Second
+	// idempotencyRecordTemplate name of the ConfigMap recording the idempotency key of a delegated job.
+	// Service names are DNS-1035 labels, so the dot keeps it from colliding with the ConfigMap of a service
+	idempotencyRecordTemplate = "%s.idempotency-key"
+)
+
+// validIdempotencyKey checks that the key is not too long and only has printable ASCII characters
+func validIdempotencyKey(key string) bool {
+	if len(key) > maxIdempotencyKeyLength {
+		return false
+	}
+	for _, r := range key {
+		if r < ' ' || r > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// idempotentJobName derives the name of the job of an idempotency key. Keys are scoped to the service and
+// the caller (the OIDC subject, or the service token if empty), so different users never share a job.
+func idempotentJobName(service *types.Service, namespace string, caller string, key string) string {
+	serviceName := service.Name
+	if len(serviceName) >= 25 {
+		serviceName = serviceName[:16]
+	}
+	if caller == "" {
+		caller = "service-token"
+	}
+	id := uuid.NewSHA1(uuid.NameSpaceURL, []byte(strings.Join([]string{namespace, service.Name, caller, key}, "\n")))
+	return serviceName + "-" + id.String()
+}
+
+// replayIdempotentJob returns the job previously created with the idempotency key, if any.
+// The handle of the job is returned while the key is retained, and the reuse of the key with a different
+// event is rejected. Once the key expires, its finished job is deleted so the key creates a new one.
+// Returns false if there is no job to replay.
+func replayIdempotentJob(ctx context.Context, cfg *types.Config, kubeClientset kubernetes.Interface, namespace string, serviceName string, jobName string, eventBytes []byte) (jobSubmission, bool) {
+	job, err := kubeClientset.BatchV1().Jobs(namespace).Get(ctx, jobName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return replayDelegatedIdempotentJob(ctx, cfg, kubeClientset, namespace, serviceName, jobName, eventBytes)
+	}
+	if err != nil {
+		return failedSubmission(http.StatusInternalServerError, err), true
+	}
+
+	expired := idempotencyKeyExpired(cfg, job.CreationTimestamp.Time)
+	if expired && types.JobFinished(job) {
+		if err := deleteExpiredIdempotentJob(ctx, kubeClientset, job); err != nil {
+			return failedSubmission(http.StatusInternalServerError, err), true
+		}
+		return jobSubmission{}, false
+	}
+
+	if job.Annotations[types.EventSHA256Annotation] != eventSHA256(eventBytes) {
+		return failedSubmission(http.StatusUnprocessableEntity, fmt.Errorf("the %s \"%s\" was already used with a different event", IdempotencyKeyHeader, job.Annotations[types.IdempotencyKeyAnnotation])), true
+	}
+	return jobSubmission{handle: newJobHandle(serviceName, namespace, jobName, false), status: http.StatusOK, replayed: true}, true
+}
+
+// idempotencyKeyExpired returns true if a key used at the given time is no longer retained
+func idempotencyKeyExpired(cfg *types.Config, created time.Time) bool {
+	return cfg.IdempotencyKeyRetention > 0 && time.Since(created) > cfg.IdempotencyKeyRetention
+}
+
+// deleteExpiredIdempotentJob deletes the job of an expired key and waits until it is gone,
+// as the new job of the key is created with the same name
+func deleteExpiredIdempotentJob(ctx context.Context, kubeClientset kubernetes.Interface, job *batchv1.Job) error {
+	propagation := metav1.DeletePropagationBackground
+	err := kubeClientset.BatchV1().Jobs(job.Namespace).Delete(ctx, job.Name, metav1.DeleteOptions{
+		PropagationPolicy: &propagation,
+		Preconditions:     &metav1.Preconditions{UID: &job.UID},
+	})
+	if errors.IsNotFound(err) || errors.IsConflict(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return wait.PollUntilContextTimeout(ctx, 500*time.Millisecond, idempotentJobDeletionTimeout, true, func(ctx context.Context) (bool, error) {
+		current, err := kubeClientset.BatchV1().Jobs(job.Namespace).Get(ctx, job.Name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return current.UID != job.UID, nil
+	})
+}
+
+// replayDelegatedIdempotentJob returns the job delegated to another cluster with the idempotency key, if any,
+// from the record of the key. Expired records are deleted so the key creates a new job.
+func replayDelegatedIdempotentJob(ctx context.Context, cfg *types.Config, kubeClientset kubernetes.Interface, namespace string, serviceName string, jobName string, eventBytes []byte) (jobSubmission, bool) {
+	record, err := kubeClientset.CoreV1().ConfigMaps(namespace).Get(ctx, fmt.Sprintf(idempotencyRecordTemplate, jobName), metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return jobSubmission{}, false
+	}
+	if err != nil {
+		return failedSubmission(http.StatusInternalServerError, err), true
+	}
+
+	if idempotencyKeyExpired(cfg, record.CreationTimestamp.Time) {
+		err := kubeClientset.CoreV1().ConfigMaps(namespace).Delete(ctx, record.Name, metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return failedSubmission(http.StatusInternalServerError, err), true
+		}
+		return jobSubmission{}, false
+	}
+
+	if record.Annotations[types.EventSHA256Annotation] != eventSHA256(eventBytes) {
+		return failedSubmission(http.StatusUnprocessableEntity, fmt.Errorf("the %s \"%s\" was already used with a different event", IdempotencyKeyHeader, record.Annotations[types.IdempotencyKeyAnnotation])), true
+	}
+	return jobSubmission{handle: newJobHandle(serviceName, namespace, jobName, true), status: http.StatusOK, replayed: true}, true
+}
+
+// recordDelegatedIdempotentJob records the idempotency key of a job delegated to another cluster, which
+// has no job in this cluster to replay, and deletes the expired records of the service
+func recordDelegatedIdempotentJob(ctx context.Context, cfg *types.Config, kubeClientset kubernetes.Interface, namespace string, serviceName string, jobName string, key string, eventBytes []byte) error {
+	records, err := kubeClientset.CoreV1().ConfigMaps(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", types.IdempotencyRecordLabel, serviceName),
+	})
+	if err != nil {
+		return err
+	}
+	for _, record := range records.Items {
+		if idempotencyKeyExpired(cfg, record.CreationTimestamp.Time) {
+			err := kubeClientset.CoreV1().ConfigMaps(namespace).Delete(ctx, record.Name, metav1.DeleteOptions{})
+			if err != nil && !errors.IsNotFound(err) {
+				return err
+			}
+		}
+	}
+
+	record := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf(idempotencyRecordTemplate, jobName),
+			Namespace: namespace,
+			Labels:    map[string]string{types.IdempotencyRecordLabel: serviceName},
+			Annotations: map[string]string{
+				types.IdempotencyKeyAnnotation: key,
+				types.EventSHA256Annotation:    eventSHA256(eventBytes),
+			},
+		},
+	}
+	_, err = kubeClientset.CoreV1().ConfigMaps(namespace).Create(ctx, record, metav1.CreateOptions{})
+	return err
+}
+
+// deleteIdempotencyRecords removes the records of the idempotency keys of the delegated jobs of a service
+func deleteIdempotencyRecords(ctx context.Context, kubeClientset kubernetes.Interface, namespace string, serviceName string) error {
+	return kubeClientset.CoreV1().ConfigMaps(namespace).DeleteCollection(ctx, metav1.DeleteOptions{}, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", types.IdempotencyRecordLabel, serviceName),
+	})
+}
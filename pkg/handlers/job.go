@@ -23,12 +23,14 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"maps"
 	"net/http"
 	"net/url"
 	"os"
 	"path"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -76,355 +78,518 @@ const (
 
 // MakeJobHandler godoc
 // @Summary Invoke service asynchronously
-// @Description Invoke a service asynchronously creating a Kubernetes Job.
+// @Description Invoke a service asynchronously creating a Kubernetes Job. CloudEvents 1.0 in binary and structured mode are accepted, passing their data as the event and their attributes as CE_* variables.
 // @Tags async
 // @Accept json
 // @Accept octet-stream
+// @Accept application/cloudevents+json
 // @Param serviceName path string true "Service name"
+// @Param X-OSCAR-Callback-URL header string false "URL notified when the job finishes"
+// @Param Idempotency-Key header string false "Key identifying the retries of the same invocation"
 // @Param payload body string false "Event payload"
-// @Success 201 {string} string "Created"
+// @Produce json
+// @Success 201 {object} types.JobHandle
+// @Success 200 {object} types.JobHandle "Job previously created with the idempotency key"
+// @Failure 400 {string} string "Bad Request"
 // @Failure 401 {string} string "Unauthorized"
 // @Failure 404 {string} string "Not Found"
+// @Failure 422 {string} string "Idempotency key reused with a different event"
 // @Failure 500 {string} string "Internal Server Error"
 // @Security BearerAuth
 // @Router /job/{serviceName} [post]
 func MakeJobHandler(cfg *types.Config, kubeClientset kubernetes.Interface, back types.ServerlessBackend, rm resourcemanager.ResourceManager) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var service *types.Service
-		var podSpec *v1.PodSpec
-		var serviceNamespace string
-		serviceList, err := back.ListServicesByName(c.Param("serviceName"), "")
+		invocation, ok := authenticateJobInvocation(c, cfg, kubeClientset, back, rm)
+		if !ok {
+			return
+		}
+		idempotencyKey := c.GetHeader(IdempotencyKeyHeader)
+		if !validIdempotencyKey(idempotencyKey) {
+			c.String(http.StatusBadRequest, "invalid %s: must have up to %d printable ASCII characters", IdempotencyKeyHeader, maxIdempotencyKeyLength)
+			return
+		}
+		// Get the event from request body
+		eventBytes, err := io.ReadAll(c.Request.Body)
 		if err != nil {
-			// Check if error is caused because the service is not found
-			if errors.IsNotFound(err) || errors.IsGone(err) {
-				c.Status(http.StatusNotFound)
-			} else {
-				c.String(http.StatusInternalServerError, err.Error())
-			}
+			c.String(http.StatusInternalServerError, err.Error())
 			return
 		}
 
-		// Check auth token
-		authHeader := c.GetHeader("Authorization")
-		splitToken := strings.Split(authHeader, "Bearer ")
-		if len(splitToken) != 2 {
-			c.Status(http.StatusUnauthorized)
+		// Pass the data of the CloudEvents as the event, with their attributes as variables
+		cloudEvent, err := utils.ParseCloudEvent(c.Request.Header, eventBytes)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
 			return
 		}
+		if cloudEvent != nil {
+			c.Set("cloudEvent", cloudEvent)
+			eventBytes = cloudEvent.Data
+		}
 
-		// Check if reqToken is the service token
-		var uidFromToken string
-		var minIOSecretKey string
-		rawToken := strings.TrimSpace(splitToken[1])
-		if len(rawToken) == tokenLength {
-			for _, serviceIter := range serviceList {
-				if rawToken == serviceIter.Token {
-					service = serviceIter
-				}
-			}
-			if service == nil {
-				c.Status(http.StatusUnauthorized)
-				return
-			}
-			// Get podSpec from the service
-			podSpec, serviceNamespace, err = getPodSpecNamespace(service, cfg)
-			if err != nil {
-				c.String(http.StatusInternalServerError, err.Error())
-				return
-			}
-			// Use
-			minIOSecretKey = service.Owner
-		} else {
-			//  If isn't service token check if it is an oidc token
-			issuer, err := auth.GetIssuerFromToken(rawToken)
-			if err != nil {
-				c.String(http.StatusBadGateway, fmt.Sprintf("%v", err))
-			}
-			oidcManager := auth.ClusterOidcManagers[issuer]
-			if oidcManager == nil {
-				c.String(http.StatusBadRequest, fmt.Sprintf("Error getting oidc manager for issuer '%s'", issuer))
-				return
-			}
+		c.Set("eventBytes", eventBytes)
 
-			ui, err := oidcManager.GetUserInfo(rawToken)
-			uidFromToken = ui.Subject
-			if err != nil {
-				c.String(http.StatusInternalServerError, err.Error())
-				return
-			}
-			uid := auth.FormatUID(uidFromToken)
-			c.Set("uidOrigin", uid)
-			c.Next()
-
-			service, err = selectService(c, serviceList)
-			if err != nil {
-				if err.Error() == errServiceNotFound {
-					c.Status(http.StatusNotFound)
-				} else {
-					c.String(http.StatusBadRequest, err.Error())
-				}
-				return
-			}
-			// Get podSpec from the service
-			podSpec, serviceNamespace, err = getPodSpecNamespace(service, cfg)
-			if err != nil {
-				c.String(http.StatusInternalServerError, err.Error())
-				return
-			}
-			if len(uid) > 62 {
-				uid = uid[:62]
-			}
-			service.Labels[types.JobOwnerExecutionAnnotation] = uid
-			if !oidcManager.IsAuthorised(rawToken) {
-				c.Status(http.StatusUnauthorized)
-				return
-			}
+		//extract delegation header
+		invocation.delegateUID = c.GetHeader(DelegationHeader)
+		invocation.delegateFrom = c.GetHeader("X-Delegated-From")
 
-			if !oidcManager.UserInOneGroup(ui, cfg) {
-				c.String(http.StatusUnauthorized, "this user isn't enrrolled on the vo: %v", service.VO)
-				return
-			}
-			mc := auth.NewMultitenancyConfig(kubeClientset, cfg.OIDCSubject)
-			if !mc.UserExists(uidFromToken) {
-				c.String(http.StatusForbidden, fmt.Sprintf("MinIO user not provisioned for %s; submit a direct request first", uidFromToken))
-				return
-			}
+		submission := invocation.submit(c.Request.Context(), eventBytes, cloudEvent, idempotencyKey)
+		c.Set("uidOrigin", submission.uidOrigin)
+		if submission.ipAddress != "" {
+			c.Set("IPAddress", submission.ipAddress)
 		}
-		// Add secrets as environment variables if defined
-		if utils.SecretExists(service.Name, serviceNamespace, back.GetKubeClientset()) {
-			podSpec.Containers[0].EnvFrom = []v1.EnvFromSource{
-				{
-					SecretRef: &v1.SecretEnvSource{
-						LocalObjectReference: v1.LocalObjectReference{
-							Name: service.Name,
-						},
-					},
-				},
-			}
+		if submission.err != nil {
+			c.String(submission.status, submission.err.Error())
+			return
 		}
-		// Get the event from request body
-		eventBytes, err := io.ReadAll(c.Request.Body)
-		if err != nil {
+		if submission.replayed {
+			c.Header(IdempotentReplayedHeader, "true")
+		}
+		c.JSON(submission.status, submission.handle)
+	}
+}
+
+// jobInvocation authenticated asynchronous invocation of a service, which can submit one or many jobs
+type jobInvocation struct {
+	cfg           *types.Config
+	kubeClientset kubernetes.Interface
+	back          types.ServerlessBackend
+	rm            resourcemanager.ResourceManager
+
+	service    *types.Service
+	podSpec    *v1.PodSpec
+	namespace  string
+	authHeader string
+	// uidFromToken subject of the OIDC token or owner of the personal access token, empty if invoked with the service token
+	uidFromToken string
+	// minIOSecretKey user whose MinIO credentials are mounted if the event has no owner
+	minIOSecretKey string
+	callbackURL    string
+	delegateUID    string
+	delegateFrom   string
+	// labels additional labels of the jobs
+	labels map[string]string
+	// annotations additional annotations of the jobs
+	annotations map[string]string
+
+	// secretsMutex protects the cache of the MinIO secrets already ensured in the namespace
+	secretsMutex sync.Mutex
+	secrets      map[string]bool
+}
+
+// jobSubmission result of the submission of the job of an event
+type jobSubmission struct {
+	handle types.JobHandle
+	status int
+	err    error
+	// replayed true if the job was previously created with the idempotency key
+	replayed  bool
+	uidOrigin string
+	ipAddress string
+}
+
+// failedSubmission returns the result of a submission that failed with the status code
+func failedSubmission(status int, err error) jobSubmission {
+	return jobSubmission{status: status, err: err}
+}
+
+// authenticateJobInvocation checks the token of the request against the services with the requested name.
+// Returns false if the request has been answered because the invocation is not authorised.
+func authenticateJobInvocation(c *gin.Context, cfg *types.Config, kubeClientset kubernetes.Interface, back types.ServerlessBackend, rm resourcemanager.ResourceManager) (*jobInvocation, bool) {
+	var service *types.Service
+	var podSpec *v1.PodSpec
+	var serviceNamespace string
+	serviceList, err := back.ListServicesByName(c.Param("serviceName"), "")
+	if err != nil {
+		// Check if error is caused because the service is not found
+		if errors.IsNotFound(err) || errors.IsGone(err) {
+			c.Status(http.StatusNotFound)
+		} else {
 			c.String(http.StatusInternalServerError, err.Error())
-			return
 		}
+		return nil, false
+	}
 
-		c.Set("eventBytes", eventBytes)
+	// Check auth token
+	authHeader := c.GetHeader("Authorization")
+	splitToken := strings.Split(authHeader, "Bearer ")
+	if len(splitToken) != 2 {
+		c.Status(http.StatusUnauthorized)
+		return nil, false
+	}
+
+	// Check if reqToken is the service token
+	var uidFromToken string
+	var minIOSecretKey string
+	rawToken := strings.TrimSpace(splitToken[1])
+	if len(rawToken) == tokenLength {
+		service = auth.FindServiceByToken(c.Request.Context(), kubeClientset, serviceList, rawToken, types.ServiceTokenScopeInvokeAsync)
+		if service == nil {
+			c.Status(http.StatusUnauthorized)
+			return nil, false
+		}
+		// Get podSpec from the service
+		podSpec, serviceNamespace, err = getPodSpecNamespace(service, cfg)
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return nil, false
+		}
+		// Use
+		minIOSecretKey = service.Owner
+	} else if auth.IsPersonalToken(rawToken) {
+		// Personal access tokens invoke the services as the OIDC user who created them
+		token, ok := authenticatePersonalToken(c, cfg, kubeClientset, rawToken)
+		if !ok {
+			return nil, false
+		}
+		// The owner must still be enrolled in the allowed groups, as with OIDC tokens
+		if err := auth.CheckPersonalTokenGroups(token, cfg); err != nil {
+			c.String(http.StatusUnauthorized, err.Error())
+			return nil, false
+		}
+		auth.SetUserGroupsInContext(c, token.Groups)
+		uidFromToken = token.Owner
+		uid := auth.FormatUID(uidFromToken)
+		c.Set("uidOrigin", uid)
 
-		// Check if it has the MinIO event format
-		requestUserUID, sourceIPAddress, err := decodeEventBytes(eventBytes)
+		service, err = selectService(c, serviceList)
 		if err != nil {
-			// Check if the request was made with OIDC token to get user UID
-			if uidFromToken != "" {
-				minIOSecretKey = uidFromToken
-				c.Set("uidOrigin", uidFromToken)
+			if err.Error() == errServiceNotFound {
+				c.Status(http.StatusNotFound)
 			} else {
-				// Set as nil string if unable to get an UID
-				jobLogger.Println("WARNING:", err)
-				c.Set("uidOrigin", "nil")
+				c.String(http.StatusBadRequest, err.Error())
 			}
-		} else {
-			if service.Labels == nil {
-				service.Labels = make(map[string]string)
-			}
-			uid := auth.FormatUID(requestUserUID)
-			if len(uid) > 62 {
-				uid = uid[:62]
-			}
-			service.Labels[types.JobOwnerExecutionAnnotation] = uid
-			c.Set("IPAddress", sourceIPAddress)
-			c.Set("uidOrigin", requestUserUID)
-			minIOSecretKey = requestUserUID
+			return nil, false
 		}
-
-		if minIOSecretKey == "" {
-			minIOSecretKey = service.Owner
+		podSpec, serviceNamespace, err = getPodSpecNamespace(service, cfg)
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return nil, false
 		}
-
-		if minIOSecretKey == service.Owner {
-			minIOSecretKey = "minio"
+		if len(uid) > 62 {
+			uid = uid[:62]
+		}
+		service.Labels[types.JobOwnerExecutionAnnotation] = uid
+		mc := auth.NewMultitenancyConfig(kubeClientset, cfg.OIDCSubject)
+		if !mc.UserExists(uidFromToken) {
+			c.String(http.StatusForbidden, fmt.Sprintf("MinIO user not provisioned for %s; submit a direct request first", uidFromToken))
+			return nil, false
+		}
+	} else {
+		//  If isn't service token check if it is an oidc token
+		issuer, err := auth.GetIssuerFromToken(rawToken)
+		if err != nil {
+			c.String(http.StatusBadGateway, fmt.Sprintf("%v", err))
+		}
+		oidcManager := auth.ClusterOidcManagers[issuer]
+		if oidcManager == nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("Error getting oidc manager for issuer '%s'", issuer))
+			return nil, false
 		}
 
-		secretName := auth.FormatUID(minIOSecretKey)
-		originSecretName, err := ensureOriginMinIODefaultSecretIfNeeded(c, cfg, service, serviceNamespace, kubeClientset, authHeader)
+		ui, err := oidcManager.GetUserInfo(rawToken)
+		uidFromToken = ui.Subject
 		if err != nil {
 			c.String(http.StatusInternalServerError, err.Error())
-			return
+			return nil, false
 		}
-		if originSecretName != "" {
-			secretName = originSecretName
-		} else {
-			if err := ensureMinIOSecret(kubeClientset, minIOSecretKey, serviceNamespace); err != nil {
-				c.String(http.StatusInternalServerError, fmt.Sprintf("error ensuring credentials for user %s: %v", minIOSecretKey, err))
-				return
+		uid := auth.FormatUID(uidFromToken)
+		c.Set("uidOrigin", uid)
+		auth.SetUserGroupsInContext(c, ui.Groups)
+		c.Next()
+
+		service, err = selectService(c, serviceList)
+		if err != nil {
+			if err.Error() == errServiceNotFound {
+				c.Status(http.StatusNotFound)
+			} else {
+				c.String(http.StatusBadRequest, err.Error())
 			}
+			return nil, false
+		}
+		// Get podSpec from the service
+		podSpec, serviceNamespace, err = getPodSpecNamespace(service, cfg)
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return nil, false
+		}
+		if len(uid) > 62 {
+			uid = uid[:62]
+		}
+		service.Labels[types.JobOwnerExecutionAnnotation] = uid
+		if !oidcManager.IsAuthorised(rawToken) {
+			c.Status(http.StatusUnauthorized)
+			return nil, false
 		}
 
-		c.Next()
+		if !oidcManager.UserInOneGroup(ui, cfg) {
+			c.String(http.StatusUnauthorized, "this user isn't enrrolled on the vo: %v", service.VO)
+			return nil, false
+		}
+		mc := auth.NewMultitenancyConfig(kubeClientset, cfg.OIDCSubject)
+		if !mc.UserExists(uidFromToken) {
+			c.String(http.StatusForbidden, fmt.Sprintf("MinIO user not provisioned for %s; submit a direct request first", uidFromToken))
+			return nil, false
+		}
+	}
+	// Check the callback URL of the invocation
+	callbackURL := c.GetHeader(types.CallbackURLHeader)
+	if callbackURL != "" {
+		if err := types.ValidateCallbackURL(callbackURL, cfg.CallbackAllowedHosts); err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return nil, false
+		}
+	}
+
+	invocation := newJobInvocation(cfg, kubeClientset, back, rm, service, podSpec, serviceNamespace)
+	invocation.authHeader = authHeader
+	invocation.uidFromToken = uidFromToken
+	invocation.minIOSecretKey = minIOSecretKey
+	invocation.callbackURL = callbackURL
+	return invocation, true
+}
 
-		// Mount user MinIO credentials
-		podSpec.Volumes = append(podSpec.Volumes, v1.Volume{
-			Name: MinIOSecretVolumeName,
-			VolumeSource: v1.VolumeSource{
-				Secret: &v1.SecretVolumeSource{
-					SecretName: secretName,
+// newJobInvocation returns an invocation of the service creating its jobs from the pod spec
+func newJobInvocation(cfg *types.Config, kubeClientset kubernetes.Interface, back types.ServerlessBackend, rm resourcemanager.ResourceManager, service *types.Service, podSpec *v1.PodSpec, namespace string) *jobInvocation {
+	// Add secrets as environment variables if defined
+	if utils.SecretExists(service.Name, namespace, back.GetKubeClientset()) {
+		podSpec.Containers[0].EnvFrom = []v1.EnvFromSource{
+			{
+				SecretRef: &v1.SecretEnvSource{
+					LocalObjectReference: v1.LocalObjectReference{
+						Name: service.Name,
+					},
 				},
 			},
-		})
-
-		podSpec.Containers[0].VolumeMounts = append(podSpec.Containers[0].VolumeMounts, v1.VolumeMount{
-			Name:      MinIOSecretVolumeName,
-			ReadOnly:  true,
-			MountPath: MinIODefaultPath,
-		})
-
-		if err := configureDelegatedMinIOProvider(c, serviceNamespace, service, podSpec, kubeClientset, authHeader); err != nil {
-			c.String(http.StatusInternalServerError, err.Error())
-			return
 		}
+	}
+	return &jobInvocation{
+		cfg:           cfg,
+		kubeClientset: kubeClientset,
+		back:          back,
+		rm:            rm,
+		service:       service,
+		podSpec:       podSpec,
+		namespace:     namespace,
+		secrets:       map[string]bool{},
+	}
+}
 
-		// Initialize event envVar and args var
-		var event v1.EnvVar
-		var args []string
+// ensureMinIOSecret ensures the MinIO secret of the user once per invocation
+func (inv *jobInvocation) ensureMinIOSecret(uid string) error {
+	inv.secretsMutex.Lock()
+	defer inv.secretsMutex.Unlock()
+	if inv.secrets[uid] {
+		return nil
+	}
+	if err := ensureMinIOSecret(inv.kubeClientset, uid, inv.namespace); err != nil {
+		return err
+	}
+	inv.secrets[uid] = true
+	return nil
+}
 
-		if types.IsInterLinkService(service, cfg) {
-			command, event, args = types.SetInterlinkJob(podSpec, service, cfg, eventBytes)
+// submit creates the job of an event. The service and pod spec of the invocation are copied, so the
+// events of a batch can be submitted concurrently.
+func (inv *jobInvocation) submit(ctx context.Context, eventBytes []byte, cloudEvent *types.CloudEvent, idempotencyKey string) jobSubmission {
+	cfg := inv.cfg
+	kubeClientset := inv.kubeClientset
+	serviceNamespace := inv.namespace
+	minIOSecretKey := inv.minIOSecretKey
+	podSpec := inv.podSpec.DeepCopy()
+	service := copyInvokedService(inv.service)
+	var uidOrigin, ipAddress string
+
+	// Check if it has the MinIO event format
+	requestUserUID, sourceIPAddress, err := decodeEventBytes(eventBytes)
+	if err != nil {
+		// Check if the request was made with OIDC token to get user UID
+		if inv.uidFromToken != "" {
+			minIOSecretKey = inv.uidFromToken
+			uidOrigin = inv.uidFromToken
 		} else {
+			// Set as nil string if unable to get an UID
+			jobLogger.Println("WARNING:", err)
+			uidOrigin = "nil"
+		}
+	} else {
+		uid := auth.FormatUID(requestUserUID)
+		if len(uid) > 62 {
+			uid = uid[:62]
+		}
+		service.Labels[types.JobOwnerExecutionAnnotation] = uid
+		ipAddress = sourceIPAddress
+		uidOrigin = requestUserUID
+		minIOSecretKey = requestUserUID
+	}
+	failed := func(status int, err error) jobSubmission {
+		submission := failedSubmission(status, err)
+		submission.uidOrigin = uidOrigin
+		submission.ipAddress = ipAddress
+		return submission
+	}
 
-			if service.Mount.Provider != "" {
-				args = []string{"-c", fmt.Sprintf("echo $%s | %s", types.EventVariable, service.GetSupervisorPath()) + ";echo \"I finish\" > /tmpfolder/finish-file;"}
-				resources.SetMount(podSpec, *service, cfg)
-			} else {
-				args = []string{"-c", fmt.Sprintf("echo $%s | %s", types.EventVariable, service.GetSupervisorPath())}
-			}
+	if minIOSecretKey == "" {
+		minIOSecretKey = service.Owner
+	}
 
-			event = v1.EnvVar{
-				Name:  types.EventVariable,
-				Value: string(eventBytes),
-			}
+	if minIOSecretKey == service.Owner {
+		minIOSecretKey = "minio"
+	}
+
+	secretName := auth.FormatUID(minIOSecretKey)
+	originSecretName, err := ensureOriginMinIODefaultSecretIfNeeded(uidOrigin, cfg, service, serviceNamespace, kubeClientset, inv.authHeader)
+	if err != nil {
+		return failed(http.StatusInternalServerError, err)
+	}
+	if originSecretName != "" {
+		secretName = originSecretName
+	} else {
+		if err := inv.ensureMinIOSecret(minIOSecretKey); err != nil {
+			return failed(http.StatusInternalServerError, fmt.Errorf("error ensuring credentials for user %s: %v", minIOSecretKey, err))
 		}
+	}
 
-		//extract delegation header
-		delegateUID := c.GetHeader(DelegationHeader)
-		var jobUUID string
+	// Mount user MinIO credentials
+	mountMinIOCredentials(podSpec, secretName)
 
-		if delegateUID != "" {
-			jobUUID = delegateUID
-			delegateFrom := c.GetHeader("X-Delegated-From")
-			jobLogger.Printf("Creating job \"%s\" delegated from cluster \"%s\" ", jobUUID, delegateFrom)
+	if err := configureDelegatedMinIOProvider(eventBytes, uidOrigin, serviceNamespace, service, podSpec, kubeClientset, inv.authHeader); err != nil {
+		return failed(http.StatusInternalServerError, err)
+	}
 
-		} else {
+	// Initialize command, event envVar and args var
+	jobCommand, event, args := jobEventCommand(podSpec, service, cfg, eventBytes)
 
-			serviceNameLenght := len(service.Name)
-			serviceName := service.Name
-			jobUUID = uuid.New().String()
+	var jobUUID string
 
-			if serviceNameLenght >= 25 {
-				serviceName = serviceName[:16]
-			}
-			jobUUID = serviceName + "-" + jobUUID
-			jobLogger.Printf("Creating job \"%s\". ", jobUUID)
+	switch {
+	case inv.delegateUID != "":
+		jobUUID = inv.delegateUID
+		jobLogger.Printf("Creating job \"%s\" delegated from cluster \"%s\" ", jobUUID, inv.delegateFrom)
 
+	case idempotencyKey != "":
+		// Retries of the request with the same key get the job created by the first one
+		jobUUID = idempotentJobName(service, serviceNamespace, inv.uidFromToken, idempotencyKey)
+		if submission, ok := replayIdempotentJob(ctx, cfg, kubeClientset, serviceNamespace, service.Name, jobUUID, eventBytes); ok {
+			submission.uidOrigin = uidOrigin
+			submission.ipAddress = ipAddress
+			return submission
 		}
+		jobLogger.Printf("Creating job \"%s\" with idempotency key. ", jobUUID)
 
-		// Make JOB_UUID envVar
-		jobUUIDVar := v1.EnvVar{
-			Name:  types.JobUUIDVariable,
-			Value: jobUUID,
-		}
+	default:
 
-		// Make RESOURCE_ID envVar
-		resourceIDVar := v1.EnvVar{
-			Name: "RESOURCE_ID",
-			ValueFrom: &v1.EnvVarSource{
-				FieldRef: &v1.ObjectFieldSelector{
-					FieldPath: "spec.nodeName",
-				},
-			},
-		}
+		serviceNameLenght := len(service.Name)
+		serviceName := service.Name
+		jobUUID = uuid.New().String()
 
-		// Add podSpec variables
-		podSpec.RestartPolicy = restartPolicy
-		for i, c := range podSpec.Containers {
-			if c.Name == types.ContainerName {
-				podSpec.Containers[i].Command = command
-				podSpec.Containers[i].Args = args
-				podSpec.Containers[i].Env = append(podSpec.Containers[i].Env, event)
-				podSpec.Containers[i].Env = append(podSpec.Containers[i].Env, jobUUIDVar)
-				podSpec.Containers[i].Env = append(podSpec.Containers[i].Env, resourceIDVar)
-			}
+		if serviceNameLenght >= 25 {
+			serviceName = serviceName[:16]
 		}
+		jobUUID = serviceName + "-" + jobUUID
+		jobLogger.Printf("Creating job \"%s\". ", jobUUID)
+
+	}
+
+	// Make JOB_UUID envVar
+	jobUUIDVar := v1.EnvVar{
+		Name:  types.JobUUIDVariable,
+		Value: jobUUID,
+	}
 
-		// Delegate job if can't be scheduled and has defined replicas
-		if rm != nil && service.HasFederationMembers() {
-			if !rm.IsSchedulable(podSpec.Containers[0].Resources) {
-				authHeader := c.GetHeader("Authorization")
-				err := resourcemanager.DelegateJob(service, event.Value, jobUUID, authHeader, resourcemanager.ResourceManagerLogger, cfg, back.GetKubeClientset())
-				if err == nil {
-					// TODO: check if another status code suits better
-					c.Status(http.StatusCreated)
-					return
+	// Add podSpec variables
+	envVars := []v1.EnvVar{event, jobUUIDVar, resourceIDEnvVar()}
+	if cloudEvent != nil {
+		envVars = append(envVars, cloudEvent.EnvVars()...)
+	}
+	setJobContainer(podSpec, jobCommand, args, envVars...)
+
+	// Delegate job if can't be scheduled and has defined replicas
+	if inv.rm != nil && service.HasFederationMembers() {
+		if !inv.rm.IsSchedulable(podSpec.Containers[0].Resources) {
+			err := resourcemanager.DelegateJob(service, event.Value, jobUUID, inv.authHeader, resourcemanager.ResourceManagerLogger, cfg, inv.back.GetKubeClientset())
+			if err == nil {
+				// Retries of the request with the same key get the delegated job
+				if idempotencyKey != "" {
+					if err := recordDelegatedIdempotentJob(ctx, cfg, kubeClientset, serviceNamespace, service.Name, jobUUID, idempotencyKey, eventBytes); err != nil {
+						jobLogger.Printf("WARNING: unable to record the %s of the delegated job \"%s\": %v", IdempotencyKeyHeader, jobUUID, err)
+					}
 				}
-				jobLogger.Printf("unable to delegate job. Error: %v\n", err)
+				// TODO: check if another status code suits better
+				return jobSubmission{handle: newJobHandle(service.Name, serviceNamespace, jobUUID, true), status: http.StatusCreated, uidOrigin: uidOrigin, ipAddress: ipAddress}
 			}
+			jobLogger.Printf("unable to delegate job. Error: %v\n", err)
 		}
+	}
 
-		// Create job definition
-		ttl := int32(cfg.TTLJob) // #nosec
-		suspend := false
-		if service.Owner != types.DefaultOwner && cfg.KueueEnable {
-			suspend = true
-		}
-		job := &batchv1.Job{
-			ObjectMeta: metav1.ObjectMeta{
-				// UUID used as a name for jobs
-				// To filter jobs by service name use the label "oscar_service"
-				Name:        jobUUID,
-				Namespace:   serviceNamespace,
-				Labels:      service.Labels,
-				Annotations: service.Annotations,
-			},
-			Spec: batchv1.JobSpec{
-				Suspend:                 &suspend,
-				BackoffLimit:            &backoffLimit,
-				TTLSecondsAfterFinished: &ttl,
-				Template: v1.PodTemplateSpec{
-					ObjectMeta: metav1.ObjectMeta{
-						Labels:      service.Labels,
-						Annotations: service.Annotations,
-					},
-					Spec: *podSpec,
-				},
-			},
+	// Store the large events out of the job definition
+	var eventRef *utils.EventReference
+	if utils.IsLargeEvent(cfg, eventBytes) {
+		eventRef, err = useStoredJobEvent(ctx, cfg, kubeClientset, podSpec, serviceNamespace, service, jobUUID, eventBytes)
+		if err != nil {
+			return failed(http.StatusInternalServerError, err)
 		}
+	}
 
-		// Add ReScheduler label if there are replicas defined and the cfg.ReSchedulerEnable is true
-		if service.HasFederationMembers() && cfg.ReSchedulerEnable {
-			if service.Federation != nil && service.Federation.ReschedulerThreshold != 0 {
-				job.Labels[types.ReSchedulerLabelKey] = strconv.Itoa(service.Federation.ReschedulerThreshold)
-			} else {
-				job.Labels[types.ReSchedulerLabelKey] = strconv.Itoa(cfg.ReSchedulerThreshold)
-			}
-		}
+	// Create job definition
+	job := newServiceJob(cfg, service, podSpec, serviceNamespace, jobUUID)
+	if service.MaxConcurrentJobs > 0 {
+		holdJob(job)
+	}
+	if inv.delegateUID != "" && inv.delegateFrom != "" {
+		setJobAnnotation(job, types.DelegatedFromAnnotation, inv.delegateFrom)
+	}
+	if eventRef != nil {
+		setJobAnnotation(job, types.EventSHA256Annotation, eventSHA256(eventBytes))
+	}
+	if inv.callbackURL != "" {
+		setJobAnnotation(job, types.CallbackURLAnnotation, inv.callbackURL)
+	}
+	maps.Copy(job.Labels, inv.labels)
+	for key, value := range inv.annotations {
+		setJobAnnotation(job, key, value)
+	}
+	if idempotencyKey != "" {
+		setJobAnnotation(job, types.IdempotencyKeyAnnotation, idempotencyKey)
+		setJobAnnotation(job, types.EventSHA256Annotation, eventSHA256(eventBytes))
+	}
 
-		// Point the job to the service's LocalQueue so Kueue can admit it.
-		if service.Owner != types.DefaultOwner && cfg.KueueEnable {
-			if job.Labels == nil {
-				job.Labels = make(map[string]string)
-			}
-			if job.Annotations == nil {
-				job.Annotations = make(map[string]string)
+	createdJob, err := kubeClientset.BatchV1().Jobs(serviceNamespace).Create(context.TODO(), job, metav1.CreateOptions{})
+	if err != nil {
+		// A concurrent retry with the same key created the job first
+		if idempotencyKey != "" && errors.IsAlreadyExists(err) {
+			if submission, ok := replayIdempotentJob(ctx, cfg, kubeClientset, serviceNamespace, service.Name, jobUUID, eventBytes); ok {
+				submission.uidOrigin = uidOrigin
+				submission.ipAddress = ipAddress
+				return submission
 			}
-			job.Labels["kueue.x-k8s.io/queue-name"] = utils.BuildLocalQueueName(service.Name)
+			return failed(http.StatusConflict, err)
 		}
-
-		_, err = kubeClientset.BatchV1().Jobs(serviceNamespace).Create(context.TODO(), job, metav1.CreateOptions{})
-		if err != nil {
-			c.String(http.StatusInternalServerError, err.Error())
-			return
+		if eventRef != nil {
+			_ = utils.DeleteJobEvent(context.TODO(), cfg, kubeClientset, serviceNamespace, *eventRef)
+		}
+		return failed(http.StatusInternalServerError, err)
+	}
+	if eventRef != nil {
+		if err := utils.SetJobEventOwner(context.TODO(), kubeClientset, *eventRef, createdJob); err != nil {
+			jobLogger.Printf("WARNING: unable to set the owner of the event of job \"%s\": %v", jobUUID, err)
 		}
-		c.Status(http.StatusCreated)
 	}
+	return jobSubmission{handle: newJobHandle(service.Name, serviceNamespace, jobUUID, false), status: http.StatusCreated, uidOrigin: uidOrigin, ipAddress: ipAddress}
+}
+
+// copyInvokedService copies the fields of the service modified when submitting a job
+func copyInvokedService(service *types.Service) *types.Service {
+	serviceCopy := *service
+	serviceCopy.Labels = maps.Clone(service.Labels)
+	if serviceCopy.Labels == nil {
+		serviceCopy.Labels = map[string]string{}
+	}
+	if service.StorageProviders != nil {
+		providers := *service.StorageProviders
+		providers.MinIO = maps.Clone(service.StorageProviders.MinIO)
+		serviceCopy.StorageProviders = &providers
+	}
+	return &serviceCopy
 }
 
 type configForUser struct {
@@ -459,7 +624,7 @@ func decodeEventBytes(eventBytes []byte) (string, string, error) {
 
 }
 
-func ensureOriginMinIODefaultSecretIfNeeded(c *gin.Context, cfg *types.Config, service *types.Service, serviceNamespace string, kubeClientset kubernetes.Interface, authHeader string) (string, error) {
+func ensureOriginMinIODefaultSecretIfNeeded(uidOrigin string, cfg *types.Config, service *types.Service, serviceNamespace string, kubeClientset kubernetes.Interface, authHeader string) (string, error) {
 	if service == nil || service.StorageProviders == nil || service.StorageProviders.MinIO == nil {
 		return "", nil
 	}
@@ -500,9 +665,7 @@ func ensureOriginMinIODefaultSecretIfNeeded(c *gin.Context, cfg *types.Config, s
 		return "", fmt.Errorf("origin MinIO credentials are empty for cluster %q", originClusterID)
 	}
 
-	uidOrigin, _ := c.Get("uidOrigin")
-	uid, _ := uidOrigin.(string)
-	uid = strings.TrimSpace(uid)
+	uid := strings.TrimSpace(uidOrigin)
 	if uid == "" || uid == "nil" {
 		return "", fmt.Errorf("origin user id is missing for delegated job")
 	}
@@ -515,8 +678,8 @@ func ensureOriginMinIODefaultSecretIfNeeded(c *gin.Context, cfg *types.Config, s
 	return secretName, nil
 }
 
-func configureDelegatedMinIOProvider(c *gin.Context, serviceNamespace string, service *types.Service, podSpec *v1.PodSpec, kubeClientset kubernetes.Interface, authHeader string) error {
-	providerType, providerID, ok := parseDelegatedStorageProvider(c)
+func configureDelegatedMinIOProvider(eventBytes []byte, uidOrigin string, serviceNamespace string, service *types.Service, podSpec *v1.PodSpec, kubeClientset kubernetes.Interface, authHeader string) error {
+	providerType, providerID, ok := parseDelegatedStorageProvider(eventBytes)
 	if !ok || providerType != types.MinIOName || providerID == types.DefaultProvider {
 		return nil
 	}
@@ -553,7 +716,7 @@ func configureDelegatedMinIOProvider(c *gin.Context, serviceNamespace string, se
 		service.StorageProviders.MinIO[providerID] = &providerCopy
 	}
 
-	secretName := buildMinIOProviderSecretName(c, providerID)
+	secretName := buildMinIOProviderSecretName(uidOrigin, providerID)
 	if secretName == "" {
 		return fmt.Errorf("unable to build MinIO secret name for provider %q", providerID)
 	}
@@ -580,17 +743,12 @@ func configureDelegatedMinIOProvider(c *gin.Context, serviceNamespace string, se
 	return nil
 }
 
-func parseDelegatedStorageProvider(c *gin.Context) (string, string, bool) {
-	eventBytes, ok := c.Get("eventBytes")
-	if !ok {
-		return "", "", false
-	}
-	raw, ok := eventBytes.([]byte)
-	if !ok || len(raw) == 0 {
+func parseDelegatedStorageProvider(eventBytes []byte) (string, string, bool) {
+	if len(eventBytes) == 0 {
 		return "", "", false
 	}
 	var payload map[string]interface{}
-	if err := json.Unmarshal(raw, &payload); err != nil {
+	if err := json.Unmarshal(eventBytes, &payload); err != nil {
 		return "", "", false
 	}
 	rawProvider, ok := payload["storage_provider"].(string)
@@ -648,10 +806,8 @@ func fetchMinIOProvider(originEndpoint string, authHeader string, sslVerify bool
 	return cfgResp.MinIOProvider, nil
 }
 
-func buildMinIOProviderSecretName(c *gin.Context, providerID string) string {
-	uidOrigin, _ := c.Get("uidOrigin")
-	uid, _ := uidOrigin.(string)
-	uid = strings.TrimSpace(uid)
+func buildMinIOProviderSecretName(uidOrigin string, providerID string) string {
+	uid := strings.TrimSpace(uidOrigin)
 	if uid == "" || uid == "nil" {
 		return ""
 	}
@@ -761,3 +917,157 @@ func getPodSpecNamespace(service *types.Service, cfg *types.Config) (*v1.PodSpec
 	}
 	return podSpec, serviceNamespace, nil
 }
+
+// mountMinIOCredentials mounts the secret with the MinIO credentials in the service container
+func mountMinIOCredentials(podSpec *v1.PodSpec, secretName string) {
+	podSpec.Volumes = append(podSpec.Volumes, v1.Volume{
+		Name: MinIOSecretVolumeName,
+		VolumeSource: v1.VolumeSource{
+			Secret: &v1.SecretVolumeSource{
+				SecretName: secretName,
+			},
+		},
+	})
+
+	podSpec.Containers[0].VolumeMounts = append(podSpec.Containers[0].VolumeMounts, v1.VolumeMount{
+		Name:      MinIOSecretVolumeName,
+		ReadOnly:  true,
+		MountPath: MinIODefaultPath,
+	})
+}
+
+// jobEventCommand returns the command, event envVar and args of the service container to process the event
+func jobEventCommand(podSpec *v1.PodSpec, service *types.Service, cfg *types.Config, eventBytes []byte) ([]string, v1.EnvVar, []string) {
+	if types.IsInterLinkService(service, cfg) {
+		return types.SetInterlinkJob(podSpec, service, cfg, eventBytes)
+	}
+
+	var args []string
+	if service.Mount.Provider != "" {
+		args = []string{"-c", fmt.Sprintf("echo $%s | %s", types.EventVariable, service.GetSupervisorPath()) + ";echo \"I finish\" > /tmpfolder/finish-file;"}
+		resources.SetMount(podSpec, *service, cfg)
+	} else {
+		args = []string{"-c", fmt.Sprintf("echo $%s | %s", types.EventVariable, service.GetSupervisorPath())}
+	}
+
+	event := v1.EnvVar{
+		Name:  types.EventVariable,
+		Value: string(eventBytes),
+	}
+	return command, event, args
+}
+
+// setJobAnnotation sets an annotation of the job without modifying the annotations shared with the service
+func setJobAnnotation(job *batchv1.Job, key string, value string) {
+	job.Annotations = maps.Clone(job.Annotations)
+	if job.Annotations == nil {
+		job.Annotations = map[string]string{}
+	}
+	job.Annotations[key] = value
+}
+
+// resourceIDEnvVar returns the RESOURCE_ID envVar with the node running the job
+func resourceIDEnvVar() v1.EnvVar {
+	return v1.EnvVar{
+		Name: "RESOURCE_ID",
+		ValueFrom: &v1.EnvVarSource{
+			FieldRef: &v1.ObjectFieldSelector{
+				FieldPath: "spec.nodeName",
+			},
+		},
+	}
+}
+
+// setJobContainer sets the restart policy of the podSpec and the command, args and envVars of the service container
+func setJobContainer(podSpec *v1.PodSpec, command []string, args []string, envVars ...v1.EnvVar) {
+	podSpec.RestartPolicy = restartPolicy
+	for i, c := range podSpec.Containers {
+		if c.Name == types.ContainerName {
+			podSpec.Containers[i].Command = command
+			podSpec.Containers[i].Args = args
+			podSpec.Containers[i].Env = append(podSpec.Containers[i].Env, envVars...)
+		}
+	}
+}
+
+// newServiceJob returns the definition of a job of the service, pointed to the service's LocalQueue if Kueue is enabled
+func newServiceJob(cfg *types.Config, service *types.Service, podSpec *v1.PodSpec, namespace string, name string) *batchv1.Job {
+	ttl := int32(cfg.TTLJob) // #nosec
+	suspend := false
+	if service.Owner != types.DefaultOwner && cfg.KueueEnable {
+		suspend = true
+	}
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			// UUID used as a name for jobs
+			// To filter jobs by service name use the label "oscar_service"
+			Name:        name,
+			Namespace:   namespace,
+			Labels:      service.Labels,
+			Annotations: service.Annotations,
+		},
+		Spec: batchv1.JobSpec{
+			Suspend:                 &suspend,
+			BackoffLimit:            &backoffLimit,
+			TTLSecondsAfterFinished: &ttl,
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels:      service.Labels,
+					Annotations: service.Annotations,
+				},
+				Spec: *podSpec,
+			},
+		},
+	}
+
+	setJobRetryPolicy(job, service.RetryPolicy)
+
+	// Add ReScheduler label if there are replicas defined and the cfg.ReSchedulerEnable is true
+	if service.HasFederationMembers() && cfg.ReSchedulerEnable {
+		if service.Federation != nil && service.Federation.ReschedulerThreshold != 0 {
+			job.Labels[types.ReSchedulerLabelKey] = strconv.Itoa(service.Federation.ReschedulerThreshold)
+		} else {
+			job.Labels[types.ReSchedulerLabelKey] = strconv.Itoa(cfg.ReSchedulerThreshold)
+		}
+	}
+
+	// Point the job to the service's LocalQueue so Kueue can admit it.
+	if service.Owner != types.DefaultOwner && cfg.KueueEnable {
+		if job.Labels == nil {
+			job.Labels = make(map[string]string)
+		}
+		if job.Annotations == nil {
+			job.Annotations = make(map[string]string)
+		}
+		job.Labels["kueue.x-k8s.io/queue-name"] = utils.BuildLocalQueueName(service.Name)
+	}
+	return job
+}
+
+// setJobRetryPolicy applies the retries, failure policy, deadline and restart policy of the service to the job
+func setJobRetryPolicy(job *batchv1.Job, policy *types.JobRetryPolicy) {
+	if policy == nil {
+		return
+	}
+	maxRetries := policy.MaxRetries
+	job.Spec.BackoffLimit = &maxRetries
+	if policy.ActiveDeadlineSeconds > 0 {
+		deadline := policy.ActiveDeadlineSeconds
+		job.Spec.ActiveDeadlineSeconds = &deadline
+	}
+	job.Spec.PodFailurePolicy = policy.PodFailurePolicy()
+	job.Spec.Template.Spec.RestartPolicy = policy.KubeRestartPolicy()
+}
+
+// newJobHandle returns the reference to a job returned by the job handler
+func newJobHandle(serviceName string, namespace string, jobName string, delegated bool) types.JobHandle {
+	logsURL := path.Join("/system/logs", serviceName, jobName)
+	return types.JobHandle{
+		JobName:   jobName,
+		Namespace: namespace,
+		Delegated: delegated,
+		StatusURL: logsURL + "/status",
+		WaitURL:   logsURL + "/wait",
+		LogsURL:   logsURL,
+	}
+}
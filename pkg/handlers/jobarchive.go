@@ -0,0 +1,201 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/grycap/oscar/v4/pkg/types"
+	"github.com/grycap/oscar/v4/pkg/utils"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes"
+)
+
+// MakeJobArchiver returns a finished job handler that stores the record and the logs of the job in the archive
+func MakeJobArchiver(kubeClientset kubernetes.Interface, archive utils.JobArchive) func(ctx context.Context, job *batchv1.Job) error {
+	return func(ctx context.Context, job *batchv1.Job) error {
+		serviceName := job.Labels[types.ServiceLabel]
+		pods, err := listJobPods(ctx, kubeClientset, job.Namespace, serviceName, job.Name)
+		if err != nil {
+			return err
+		}
+
+		info := buildJobInfo(job, pods)
+		info.Archived = true
+		record := types.JobRecord{
+			Name:        job.Name,
+			Service:     serviceName,
+			Namespace:   job.Namespace,
+			Owner:       job.Labels[types.JobOwnerExecutionAnnotation],
+			JobInfo:     *info,
+			EventSHA256: jobEventSHA256(job),
+			ArchivedAt:  time.Now().UTC(),
+		}
+
+		var logs []byte
+		if len(pods) > 0 {
+			podLogOpts := &v1.PodLogOptions{Container: types.ContainerName, Timestamps: true}
+			logs, err = kubeClientset.CoreV1().Pods(job.Namespace).GetLogs(latestPod(pods).Name, podLogOpts).Do(ctx).Raw()
+			// The pods may be already deleted with the job, the record is archived anyway
+			if err != nil && !errors.IsNotFound(err) {
+				return fmt.Errorf("error reading the logs of job \"%s\": %v", job.Name, err)
+			}
+		}
+		return archive.Store(ctx, record, logs)
+	}
+}
+
+// jobEventSHA256 returns the hex encoded SHA-256 hash of the event passed to the job, if any
+func jobEventSHA256(job *batchv1.Job) string {
+	// The hash of the stored events is computed when they are stored
+	if sum, ok := job.Annotations[types.EventSHA256Annotation]; ok {
+		return sum
+	}
+	for _, container := range job.Spec.Template.Spec.Containers {
+		if container.Name != types.ContainerName {
+			continue
+		}
+		for _, env := range container.Env {
+			if env.Name == types.EventVariable && env.Value != "" {
+				return eventSHA256([]byte(env.Value))
+			}
+		}
+	}
+	return ""
+}
+
+// readArchivedJob returns the record of an archived job of the service, or a NotFound error
+func readArchivedJob(ctx context.Context, cfg *types.Config, namespace string, serviceName string, jobName string) (*types.JobRecord, error) {
+	notFound := errors.NewNotFound(batchv1.Resource("jobs"), jobName)
+	archive := utils.MakeJobArchive(cfg)
+	if archive == nil {
+		return nil, notFound
+	}
+	record, err := archive.Get(ctx, namespace, serviceName, jobName)
+	if err == utils.ErrJobNotArchived {
+		return nil, notFound
+	}
+	return record, err
+}
+
+// readArchivedJobStatus returns the status of an archived job of the service, or a NotFound error
+func readArchivedJobStatus(ctx context.Context, cfg *types.Config, namespace string, serviceName string, jobName string) (*types.JobStatus, error) {
+	record, err := readArchivedJob(ctx, cfg, namespace, serviceName, jobName)
+	if err != nil {
+		return nil, err
+	}
+	return &types.JobStatus{Name: record.Name, JobInfo: record.JobInfo, Events: []types.JobEvent{}}, nil
+}
+
+// readArchivedLogs returns the logs of an archived job of the service, or a NotFound error.
+// The logs are archived with timestamps, which are removed if not requested.
+func readArchivedLogs(ctx context.Context, cfg *types.Config, namespace string, serviceName string, jobName string, timestamps bool) (string, error) {
+	notFound := errors.NewNotFound(batchv1.Resource("jobs"), jobName)
+	archive := utils.MakeJobArchive(cfg)
+	if archive == nil {
+		return "", notFound
+	}
+	logs, err := archive.GetLogs(ctx, namespace, serviceName, jobName)
+	if err == utils.ErrJobNotArchived {
+		return "", notFound
+	}
+	if err != nil || timestamps {
+		return string(logs), err
+	}
+
+	lines := strings.SplitAfter(string(logs), "\n")
+	for i, line := range lines {
+		if _, text, found := strings.Cut(line, " "); found {
+			lines[i] = text
+		}
+	}
+	return strings.Join(lines, ""), nil
+}
+
+// archivedJobsInfo returns the archived jobs of the service not included in jobsInfo.
+// If owner is not empty only the jobs with that owner label are returned.
+func archivedJobsInfo(ctx context.Context, cfg *types.Config, namespace string, serviceName string, owner string, jobsInfo map[string]*types.JobInfo) (map[string]*types.JobInfo, error) {
+	archived := map[string]*types.JobInfo{}
+	archive := utils.MakeJobArchive(cfg)
+	if archive == nil {
+		return archived, nil
+	}
+	records, err := archive.List(ctx, namespace, serviceName)
+	if err != nil {
+		return nil, err
+	}
+	for i := range records {
+		if _, live := jobsInfo[records[i].Name]; live {
+			continue
+		}
+		if owner != "" && records[i].Owner != owner {
+			continue
+		}
+		archived[records[i].Name] = &records[i].JobInfo
+	}
+	return archived, nil
+}
+
+// deleteArchivedJob removes a job of the service from the archive, returning false if it was not archived.
+// If owner is not empty only the jobs with that owner label can be removed
+func deleteArchivedJob(ctx context.Context, cfg *types.Config, namespace string, serviceName string, jobName string, owner string) (bool, error) {
+	archive := utils.MakeJobArchive(cfg)
+	if archive == nil {
+		return false, nil
+	}
+	record, err := archive.Get(ctx, namespace, serviceName, jobName)
+	if err != nil {
+		if err == utils.ErrJobNotArchived {
+			return false, nil
+		}
+		return false, err
+	}
+	if owner != "" && record.Owner != owner {
+		return false, errJobNotOwned
+	}
+	return true, archive.Delete(ctx, namespace, serviceName, jobName)
+}
+
+// deleteArchivedJobs removes the archived jobs of the service, all of them or only the succeeded ones.
+// If owner is not empty only the jobs with that owner label are removed
+func deleteArchivedJobs(ctx context.Context, cfg *types.Config, namespace string, serviceName string, all bool, owner string) error {
+	archive := utils.MakeJobArchive(cfg)
+	if archive == nil {
+		return nil
+	}
+	if all && owner == "" {
+		return archive.DeleteService(ctx, namespace, serviceName)
+	}
+	records, err := archive.List(ctx, namespace, serviceName)
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		if (!all && record.Status != string(v1.PodSucceeded)) || (owner != "" && record.Owner != owner) {
+			continue
+		}
+		if err := archive.Delete(ctx, namespace, serviceName, record.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/grycap/oscar/v4/pkg/backends"
+	"github.com/grycap/oscar/v4/pkg/types"
+	"github.com/grycap/oscar/v4/pkg/utils"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	testclient "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestMakeJobArchiver(t *testing.T) {
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "job",
+			Namespace: "ns",
+			Labels:    map[string]string{types.ServiceLabel: "test", types.JobOwnerExecutionAnnotation: "user"},
+		},
+		Spec: batchv1.JobSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name: types.ContainerName,
+						Env:  []corev1.EnvVar{{Name: types.EventVariable, Value: `{"key":"value"}`}},
+					}},
+				},
+			},
+		},
+		Status: batchv1.JobStatus{
+			Conditions: []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}},
+		},
+	}
+	kubeClientset := testclient.NewSimpleClientset(job, &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "job-pod", Namespace: "ns", Labels: map[string]string{types.ServiceLabel: "test", "job-name": "job"}},
+		Status:     corev1.PodStatus{Phase: corev1.PodSucceeded},
+	})
+	cfg := &types.Config{JobArchiveEnable: true, JobArchivePath: t.TempDir()}
+	archive := utils.MakeJobArchive(cfg)
+
+	if err := MakeJobArchiver(kubeClientset, archive)(context.Background(), job); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	record, err := archive.Get(context.Background(), "ns", "test", "job")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sum := sha256.Sum256([]byte(`{"key":"value"}`))
+	if record.Owner != "user" || record.Status != "Succeeded" || !record.Archived || record.EventSHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("unexpected record: %+v", record)
+	}
+	logs, err := archive.GetLogs(context.Background(), "ns", "test", "job")
+	if err != nil || string(logs) != "fake logs" {
+		t.Errorf("unexpected logs %q, error: %v", logs, err)
+	}
+}
+
+func TestJobArchiveFallbacks(t *testing.T) {
+	back := backends.MakeFakeBackend()
+	back.Service = &types.Service{Name: "test", Namespace: "ns"}
+	kubeClientset := testclient.NewSimpleClientset(&batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "live", Namespace: "ns", Labels: map[string]string{types.ServiceLabel: "test"}},
+	})
+	cfg := &types.Config{JobArchiveEnable: true, JobArchivePath: t.TempDir(), JobListingLimit: 10}
+	record := types.JobRecord{Name: "old", Service: "test", Namespace: "ns", JobInfo: types.JobInfo{Status: "Succeeded", Archived: true}}
+	logs := "2024-01-01T00:00:00Z Uploading file '/out.txt' to bucket 'bucket'\n2024-01-01T00:00:01Z done\n"
+	if err := utils.MakeJobArchive(cfg).Store(context.Background(), record, []byte(logs)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	r := gin.New()
+	r.GET("/system/logs/:serviceName", MakeJobsInfoHandler(back, kubeClientset, cfg))
+	r.GET("/system/logs/:serviceName/:jobName", MakeGetLogsHandler(back, kubeClientset, cfg))
+	r.GET("/system/logs/:serviceName/:jobName/status", MakeJobStatusHandler(back, kubeClientset, cfg))
+	r.GET("/system/logs/:serviceName/:jobName/wait", MakeJobWaitHandler(back, kubeClientset, cfg))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/system/logs/test", nil))
+	var jobs types.JobsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &jobs); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(jobs.Jobs) != 2 || jobs.Jobs["live"] == nil || jobs.Jobs["old"] == nil || !jobs.Jobs["old"].Archived {
+		t.Errorf("unexpected jobs: %s", w.Body.String())
+	}
+
+	tests := []struct {
+		path string
+		body string
+	}{
+		{"/system/logs/test/old", "Uploading file '/out.txt' to bucket 'bucket'\ndone\n"},
+		{"/system/logs/test/old?timestamps=true", logs},
+		{"/system/logs/test/old?follow=true", "Uploading file '/out.txt' to bucket 'bucket'\ndone\n"},
+	}
+	for _, tc := range tests {
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if w.Code != http.StatusOK || w.Body.String() != tc.body {
+			t.Errorf("%s: unexpected response %d: %q", tc.path, w.Code, w.Body.String())
+		}
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/system/logs/test/old/status", nil))
+	var status types.JobStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil || status.Status != "Succeeded" || !status.Archived {
+		t.Errorf("unexpected status %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/system/logs/test/old/wait", nil))
+	var result types.JobResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil || !result.Finished || len(result.Outputs) != 1 || result.Outputs[0] != "bucket/out.txt" {
+		t.Errorf("unexpected result %d: %s", w.Code, w.Body.String())
+	}
+
+	for _, path := range []string{"/system/logs/test/missing", "/system/logs/test/missing/status", "/system/logs/test/missing/wait"} {
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d", path, w.Code)
+		}
+	}
+}
+
+func TestDeleteArchivedJobs(t *testing.T) {
+	back := backends.MakeFakeBackend()
+	back.Service = &types.Service{Name: "test", Namespace: "ns"}
+	kubeClientset := testclient.NewSimpleClientset(&batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "live", Namespace: "ns", Labels: map[string]string{types.ServiceLabel: "test"}},
+	})
+	cfg := &types.Config{JobArchiveEnable: true, JobArchivePath: t.TempDir(), JobListingLimit: 10}
+	archive := utils.MakeJobArchive(cfg)
+	for _, record := range []types.JobRecord{
+		{Name: "live", Service: "test", Namespace: "ns", JobInfo: types.JobInfo{Status: "Succeeded"}},
+		{Name: "old", Service: "test", Namespace: "ns", JobInfo: types.JobInfo{Status: "Succeeded"}},
+		{Name: "failed", Service: "test", Namespace: "ns", JobInfo: types.JobInfo{Status: "Failed"}},
+	} {
+		if err := archive.Store(context.Background(), record, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	r := gin.New()
+	r.DELETE("/system/logs/:serviceName", MakeDeleteJobsHandler(back, kubeClientset, cfg))
+	r.DELETE("/system/logs/:serviceName/:jobName", MakeDeleteJobHandler(back, kubeClientset, cfg))
+
+	// The jobs are deleted from the cluster and the archive, or only from the archive if already deleted
+	for _, path := range []string{"/system/logs/test/live", "/system/logs/test/old"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, path, nil))
+		if w.Code != http.StatusNoContent {
+			t.Errorf("%s: expected 204, got %d: %s", path, w.Code, w.Body.String())
+		}
+	}
+	if records, _ := archive.List(context.Background(), "ns", "test"); len(records) != 1 || records[0].Name != "failed" {
+		t.Errorf("unexpected archived jobs %+v", records)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/system/logs/test/old", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 deleting a deleted job, got %d", w.Code)
+	}
+
+	// Only the succeeded jobs are deleted unless all are requested
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/system/logs/test", nil))
+	if records, _ := archive.List(context.Background(), "ns", "test"); w.Code != http.StatusNoContent || len(records) != 1 {
+		t.Errorf("expected the failed job to be kept, got %d: %+v", w.Code, records)
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/system/logs/test?all=true", nil))
+	if records, _ := archive.List(context.Background(), "ns", "test"); w.Code != http.StatusNoContent || len(records) != 0 {
+		t.Errorf("expected all the archived jobs to be deleted, got %d: %+v", w.Code, records)
+	}
+}
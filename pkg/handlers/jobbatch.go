@@ -0,0 +1,191 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/grycap/oscar/v4/pkg/resourcemanager"
+	"github.com/grycap/oscar/v4/pkg/types"
+	"github.com/grycap/oscar/v4/pkg/utils"
+	"k8s.io/client-go/kubernetes"
+)
+
+// NDJSONContentType media type of the batches with an event per line
+const NDJSONContentType = "application/x-ndjson"
+
+// batchEvent event of a batch submission
+type batchEvent struct {
+	data       []byte
+	cloudEvent *types.CloudEvent
+}
+
+// errBatchTooLarge error of the batches with more events than allowed
+type errBatchTooLarge struct {
+	max int
+}
+
+func (e errBatchTooLarge) Error() string {
+	return fmt.Sprintf("the batch exceeds the maximum of %d events", e.max)
+}
+
+// MakeJobBatchHandler godoc
+// @Summary Invoke service asynchronously with many events
+// @Description Create a Kubernetes Job for each event of the batch, authenticating the request once. The batch is a JSON array of events (strings are passed unquoted), a CloudEvents batch or an NDJSON stream with an event per line. The results keep the order of the events. When an Idempotency-Key is given, the key of each event is the key followed by "/" and the index of the event.
+// @Tags async
+// @Accept json
+// @Accept application/x-ndjson
+// @Accept application/cloudevents-batch+json
+// @Param serviceName path string true "Service name"
+// @Param X-OSCAR-Callback-URL header string false "URL notified when each job finishes"
+// @Param Idempotency-Key header string false "Key identifying the retries of the same batch"
+// @Param payload body string true "Events of the batch"
+// @Produce json
+// @Success 200 {object} types.JobBatchResponse
+// @Failure 400 {string} string "Bad Request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Not Found"
+// @Failure 413 {string} string "Too many events"
+// @Failure 500 {string} string "Internal Server Error"
+// @Security BearerAuth
+// @Router /job/{serviceName}/batch [post]
+func MakeJobBatchHandler(cfg *types.Config, kubeClientset kubernetes.Interface, back types.ServerlessBackend, rm resourcemanager.ResourceManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		invocation, ok := authenticateJobInvocation(c, cfg, kubeClientset, back, rm)
+		if !ok {
+			return
+		}
+		idempotencyKey := c.GetHeader(IdempotencyKeyHeader)
+		if !validIdempotencyKey(idempotencyKey) {
+			c.String(http.StatusBadRequest, "invalid %s: must have up to %d printable ASCII characters", IdempotencyKeyHeader, maxIdempotencyKeyLength)
+			return
+		}
+
+		events, err := parseJobBatch(c.Request.Header, c.Request.Body, cfg.JobBatchMaxEvents)
+		if err != nil {
+			if _, ok := err.(errBatchTooLarge); ok {
+				c.String(http.StatusRequestEntityTooLarge, err.Error())
+			} else {
+				c.String(http.StatusBadRequest, err.Error())
+			}
+			return
+		}
+
+		parallelism := cfg.JobBatchParallelism
+		if parallelism < 1 {
+			parallelism = 1
+		}
+		ctx := c.Request.Context()
+		results := make([]types.JobBatchResult, len(events))
+		slots := make(chan struct{}, parallelism)
+		var wg sync.WaitGroup
+		for i, event := range events {
+			wg.Add(1)
+			slots <- struct{}{}
+			go func() {
+				defer wg.Done()
+				defer func() { <-slots }()
+				eventKey := ""
+				if idempotencyKey != "" {
+					eventKey = fmt.Sprintf("%s/%d", idempotencyKey, i)
+				}
+				submission := invocation.submit(ctx, event.data, event.cloudEvent, eventKey)
+				results[i] = types.JobBatchResult{Index: i, Status: submission.status}
+				if submission.err != nil {
+					results[i].Error = submission.err.Error()
+					return
+				}
+				handle := submission.handle
+				results[i].JobHandle = &handle
+			}()
+		}
+		wg.Wait()
+
+		response := types.JobBatchResponse{Results: results}
+		for _, result := range results {
+			if result.Error == "" {
+				response.Submitted++
+			} else {
+				response.Failed++
+			}
+		}
+		jobLogger.Printf("Batch of %d events for service \"%s\": %d jobs submitted, %d failed", len(events), invocation.service.Name, response.Submitted, response.Failed)
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// parseJobBatch reads the events of a batch from a JSON array, a CloudEvents batch or an NDJSON stream
+func parseJobBatch(header http.Header, body io.Reader, maxEvents int) ([]batchEvent, error) {
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	var events []batchEvent
+	if mediaType == NDJSONContentType {
+		reader := bufio.NewReader(body)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if line = bytes.TrimSpace(line); len(line) > 0 {
+				if maxEvents > 0 && len(events) >= maxEvents {
+					return nil, errBatchTooLarge{max: maxEvents}
+				}
+				events = append(events, batchEvent{data: line})
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		var rawEvents []json.RawMessage
+		if err := json.NewDecoder(body).Decode(&rawEvents); err != nil {
+			return nil, fmt.Errorf("the batch must be a JSON array of events: %v", err)
+		}
+		if maxEvents > 0 && len(rawEvents) > maxEvents {
+			return nil, errBatchTooLarge{max: maxEvents}
+		}
+		ceHeader := http.Header{"Content-Type": []string{utils.CloudEventsContentType}}
+		for i, raw := range rawEvents {
+			if mediaType == utils.CloudEventsBatchContentType {
+				cloudEvent, err := utils.ParseCloudEvent(ceHeader, raw)
+				if err != nil {
+					return nil, fmt.Errorf("event %d: %v", i, err)
+				}
+				events = append(events, batchEvent{data: cloudEvent.Data, cloudEvent: cloudEvent})
+				continue
+			}
+			// The strings are passed as raw events
+			var text string
+			if err := json.Unmarshal(raw, &text); err == nil {
+				events = append(events, batchEvent{data: []byte(text)})
+			} else {
+				events = append(events, batchEvent{data: raw})
+			}
+		}
+	}
+	if len(events) == 0 {
+		return nil, fmt.Errorf("the batch has no events")
+	}
+	return events, nil
+}
@@ -0,0 +1,309 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/grycap/oscar/v4/pkg/types"
+	"github.com/grycap/oscar/v4/pkg/utils"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// setJobWorkloadActive activates or deactivates the Kueue Workload of a job, replaceable in tests
+var setJobWorkloadActive = utils.SetJobWorkloadActive
+
+// MakeCancelJobHandler godoc
+// @Summary Cancel a job
+// @Description Cancel a job, terminating its pods without retries but keeping the job and its logs. The job is reported with the Cancelled status until it is deleted.
+// @Tags logs
+// @Produce json
+// @Param serviceName path string true "Service name"
+// @Param jobName path string true "Job name"
+// @Success 200 {object} types.JobStatus
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Not Found"
+// @Failure 409 {string} string "Conflict"
+// @Failure 500 {string} string "Internal Server Error"
+// @Security BasicAuth
+// @Security BearerAuth
+// @Router /system/logs/{serviceName}/{jobName}/cancel [post]
+func MakeCancelJobHandler(back types.ServerlessBackend, kubeClientset kubernetes.Interface, cfg *types.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, job, ok := getControlledJob(c, back, kubeClientset, cfg)
+		if !ok {
+			return
+		}
+		namespace := job.Namespace
+		ctx := c.Request.Context()
+
+		if !types.JobCancelled(job) {
+			// Kueue would admit the queued jobs, so their workloads are deactivated.
+			// Admitted jobs are not, as Kueue would evict them deleting their pods
+			if isKueueJob(job) && isJobSuspended(job) {
+				if err := setJobWorkloadActive(ctx, namespace, string(job.UID), false); err != nil {
+					c.String(http.StatusInternalServerError, err.Error())
+					return
+				}
+			}
+			err := updateJob(ctx, kubeClientset, namespace, job.Name, func(job *batchv1.Job) {
+				job.Annotations[types.JobCancelledAnnotation] = time.Now().UTC().Format(time.RFC3339)
+				// The failure of the terminated pods exhausts the retries of the job
+				failed := job.Status.Failed
+				job.Spec.BackoffLimit = &failed
+			})
+			if err != nil {
+				c.String(http.StatusInternalServerError, err.Error())
+				return
+			}
+		}
+
+		if err := stopJobPods(ctx, kubeClientset, namespace, c.Param("serviceName"), job.Name); err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		respondJobStatus(c, kubeClientset, namespace)
+	}
+}
+
+// MakeSuspendJobHandler godoc
+// @Summary Suspend a job
+// @Description Suspend a job, deleting its running pods until it is resumed. Jobs queued in Kueue are kept out of admission while suspended.
+// @Tags logs
+// @Produce json
+// @Param serviceName path string true "Service name"
+// @Param jobName path string true "Job name"
+// @Success 200 {object} types.JobStatus
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Not Found"
+// @Failure 409 {string} string "Conflict"
+// @Failure 500 {string} string "Internal Server Error"
+// @Security BasicAuth
+// @Security BearerAuth
+// @Router /system/logs/{serviceName}/{jobName}/suspend [post]
+func MakeSuspendJobHandler(back types.ServerlessBackend, kubeClientset kubernetes.Interface, cfg *types.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, job, ok := getControlledJob(c, back, kubeClientset, cfg)
+		if !ok {
+			return
+		}
+		namespace := job.Namespace
+		if types.JobCancelled(job) {
+			c.String(http.StatusConflict, "job \"%s\" has been cancelled", job.Name)
+			return
+		}
+		ctx := c.Request.Context()
+
+		if !types.JobSuspendedByUser(job) {
+			if isKueueJob(job) {
+				if err := setJobWorkloadActive(ctx, namespace, string(job.UID), false); err != nil {
+					c.String(http.StatusInternalServerError, err.Error())
+					return
+				}
+			}
+			err := updateJob(ctx, kubeClientset, namespace, job.Name, func(job *batchv1.Job) {
+				job.Annotations[types.JobSuspendedAnnotation] = time.Now().UTC().Format(time.RFC3339)
+				suspend := true
+				job.Spec.Suspend = &suspend
+			})
+			if err != nil {
+				c.String(http.StatusInternalServerError, err.Error())
+				return
+			}
+		}
+		respondJobStatus(c, kubeClientset, namespace)
+	}
+}
+
+// MakeResumeJobHandler godoc
+// @Summary Resume a job
+// @Description Resume a job suspended by a user. Jobs managed by Kueue are queued again for admission.
+// @Tags logs
+// @Produce json
+// @Param serviceName path string true "Service name"
+// @Param jobName path string true "Job name"
+// @Success 200 {object} types.JobStatus
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Not Found"
+// @Failure 409 {string} string "Conflict"
+// @Failure 500 {string} string "Internal Server Error"
+// @Security BasicAuth
+// @Security BearerAuth
+// @Router /system/logs/{serviceName}/{jobName}/resume [post]
+func MakeResumeJobHandler(back types.ServerlessBackend, kubeClientset kubernetes.Interface, cfg *types.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, job, ok := getControlledJob(c, back, kubeClientset, cfg)
+		if !ok {
+			return
+		}
+		namespace := job.Namespace
+		if types.JobCancelled(job) {
+			c.String(http.StatusConflict, "job \"%s\" has been cancelled", job.Name)
+			return
+		}
+		if _, suspended := job.Annotations[types.JobSuspendedAnnotation]; !suspended {
+			c.String(http.StatusConflict, "job \"%s\" has not been suspended", job.Name)
+			return
+		}
+		ctx := c.Request.Context()
+
+		// The held jobs wait again for their release by the HeldJobReleaser controller
+		held := types.JobHeld(job)
+		kueueJob := isKueueJob(job)
+		err := updateJob(ctx, kubeClientset, namespace, job.Name, func(job *batchv1.Job) {
+			delete(job.Annotations, types.JobSuspendedAnnotation)
+			// Kueue unsuspends the job once its workload is admitted again
+			if !kueueJob && !held {
+				suspend := false
+				job.Spec.Suspend = &suspend
+			}
+		})
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		if kueueJob && !held {
+			if err := setJobWorkloadActive(ctx, namespace, string(job.UID), true); err != nil {
+				c.String(http.StatusInternalServerError, err.Error())
+				return
+			}
+		}
+		respondJobStatus(c, kubeClientset, namespace)
+	}
+}
+
+// getControlledJob returns an authorized service and one of its unfinished jobs,
+// writing the error response otherwise
+func getControlledJob(c *gin.Context, back types.ServerlessBackend, kubeClientset kubernetes.Interface, cfg *types.Config) (*types.Service, *batchv1.Job, bool) {
+	serviceName := c.Param("serviceName")
+	service, ok := getAuthorizedService(c, back, serviceName, types.ServiceRoleInvoker)
+	if !ok {
+		if !c.Writer.Written() {
+			c.Status(http.StatusForbidden)
+		}
+		return nil, nil, false
+	}
+	namespace := resolveServiceNamespace(service, cfg)
+	jobName := c.Param("jobName")
+
+	job, err := kubeClientset.BatchV1().Jobs(namespace).Get(c.Request.Context(), jobName, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) || errors.IsGone(err) {
+			c.Status(http.StatusNotFound)
+		} else {
+			c.String(http.StatusInternalServerError, err.Error())
+		}
+		return nil, nil, false
+	}
+	if job.Labels[types.ServiceLabel] != serviceName {
+		c.Status(http.StatusNotFound)
+		return nil, nil, false
+	}
+	if !canManageJob(c, service, job.Labels[types.JobOwnerExecutionAnnotation]) {
+		c.String(http.StatusForbidden, errJobNotOwned.Error())
+		return nil, nil, false
+	}
+	if types.JobFinished(job) {
+		c.String(http.StatusConflict, "job \"%s\" has already finished", jobName)
+		return nil, nil, false
+	}
+	return service, job, true
+}
+
+// updateJob applies the update to a job, retrying on conflicts with the job controller
+func updateJob(ctx context.Context, kubeClientset kubernetes.Interface, namespace string, jobName string, update func(job *batchv1.Job)) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		job, err := kubeClientset.BatchV1().Jobs(namespace).Get(ctx, jobName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if job.Annotations == nil {
+			job.Annotations = map[string]string{}
+		}
+		update(job)
+		_, err = kubeClientset.BatchV1().Jobs(namespace).Update(ctx, job, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// stopJobPods terminates the active pods of a job keeping them, and their logs, as failed pods.
+// The kubelet kills the containers of the pods whose active deadline is exceeded, so the deadline
+// of the running pods is set to their current age. Pods not scheduled yet are deleted instead.
+func stopJobPods(ctx context.Context, kubeClientset kubernetes.Interface, namespace string, serviceName string, jobName string) error {
+	pods, err := listJobPods(ctx, kubeClientset, namespace, serviceName, jobName)
+	if err != nil {
+		return err
+	}
+	for _, pod := range pods {
+		if pod.Status.Phase != v1.PodPending && pod.Status.Phase != v1.PodRunning || pod.DeletionTimestamp != nil {
+			continue
+		}
+		if pod.Spec.NodeName == "" {
+			err := kubeClientset.CoreV1().Pods(namespace).Delete(ctx, pod.Name, metav1.DeleteOptions{})
+			if err != nil && !errors.IsNotFound(err) {
+				return err
+			}
+			continue
+		}
+		deadline := int64(1)
+		if pod.Status.StartTime != nil {
+			deadline = max(deadline, int64(time.Since(pod.Status.StartTime.Time).Seconds()))
+		}
+		// The deadline of the pods can only be decreased
+		if pod.Spec.ActiveDeadlineSeconds != nil && *pod.Spec.ActiveDeadlineSeconds <= deadline {
+			continue
+		}
+		patch := []byte(fmt.Sprintf(`{"spec":{"activeDeadlineSeconds":%d}}`, deadline))
+		_, err := kubeClientset.CoreV1().Pods(namespace).Patch(ctx, pod.Name, k8stypes.StrategicMergePatchType, patch, metav1.PatchOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// respondJobStatus replies with the current status of the job of the request
+func respondJobStatus(c *gin.Context, kubeClientset kubernetes.Interface, namespace string) {
+	status, _, err := readJobStatus(c.Request.Context(), kubeClientset, namespace, c.Param("serviceName"), c.Param("jobName"))
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+func isKueueJob(job *batchv1.Job) bool {
+	_, ok := job.Labels[utils.KueueQueueNameLabel]
+	return ok
+}
+
+func isJobSuspended(job *batchv1.Job) bool {
+	return job.Spec.Suspend != nil && *job.Spec.Suspend
+}
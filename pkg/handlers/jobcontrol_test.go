@@ -0,0 +1,308 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/grycap/oscar/v4/pkg/backends"
+	"github.com/grycap/oscar/v4/pkg/types"
+	"github.com/grycap/oscar/v4/pkg/utils"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	testclient "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestMakeCancelJobHandler(t *testing.T) {
+	calls := map[string]bool{}
+	setJobWorkloadActive = func(_ context.Context, _ string, jobUID string, active bool) error {
+		calls[jobUID] = active
+		return nil
+	}
+	defer func() { setJobWorkloadActive = utils.SetJobWorkloadActive }()
+
+	suspend := false
+	start := metav1.NewTime(time.Now().Add(-time.Minute))
+	podLabels := map[string]string{types.ServiceLabel: "testName", "job-name": "job"}
+	back := backends.MakeFakeBackend()
+	back.Service = &types.Service{Name: "testName", Namespace: "oscar-svc"}
+	cfg := types.Config{ServicesNamespace: "oscar-svc"}
+	kubeClient := testclient.NewSimpleClientset(
+		&batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: "job", Namespace: "oscar-svc", UID: "job-uid", Labels: map[string]string{types.ServiceLabel: "testName"}},
+			Spec:       batchv1.JobSpec{Suspend: &suspend},
+			Status:     batchv1.JobStatus{Failed: 1},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "running", Namespace: "oscar-svc", Labels: podLabels},
+			Spec:       corev1.PodSpec{NodeName: "node-1"},
+			Status:     corev1.PodStatus{Phase: corev1.PodRunning, StartTime: &start},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "unscheduled", Namespace: "oscar-svc", Labels: podLabels},
+			Status:     corev1.PodStatus{Phase: corev1.PodPending},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "failed", Namespace: "oscar-svc", Labels: podLabels},
+			Spec:       corev1.PodSpec{NodeName: "node-1"},
+			Status:     corev1.PodStatus{Phase: corev1.PodFailed, StartTime: &start},
+		},
+	)
+	r := gin.Default()
+	r.POST("/system/logs/:serviceName/:jobName/cancel", MakeCancelJobHandler(back, kubeClient, &cfg))
+	r.POST("/system/logs/:serviceName/:jobName/suspend", MakeSuspendJobHandler(back, kubeClient, &cfg))
+	r.POST("/system/logs/:serviceName/:jobName/resume", MakeResumeJobHandler(back, kubeClient, &cfg))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/system/logs/testName/job/cancel", nil)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expecting code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var status types.JobStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatalf("invalid status: %v", err)
+	}
+	if status.Status != types.JobStatusCancelled {
+		t.Errorf("expected the job to be cancelled, got %+v", status)
+	}
+	if len(calls) != 0 {
+		t.Errorf("unexpected kueue workload updates: %v", calls)
+	}
+
+	job, _ := kubeClient.BatchV1().Jobs("oscar-svc").Get(context.TODO(), "job", metav1.GetOptions{})
+	if !types.JobCancelled(job) || job.Spec.BackoffLimit == nil || *job.Spec.BackoffLimit != 1 {
+		t.Errorf("expected the job to be cancelled without retries, got %+v", job)
+	}
+	pods, _ := kubeClient.CoreV1().Pods("oscar-svc").List(context.TODO(), metav1.ListOptions{})
+	if len(pods.Items) != 2 {
+		t.Fatalf("expected the unscheduled pod to be deleted, got %d pods", len(pods.Items))
+	}
+	for _, pod := range pods.Items {
+		switch pod.Name {
+		case "running":
+			if pod.Spec.ActiveDeadlineSeconds == nil || *pod.Spec.ActiveDeadlineSeconds < 60 {
+				t.Errorf("expected the deadline of the running pod to be exceeded, got %v", pod.Spec.ActiveDeadlineSeconds)
+			}
+		case "failed":
+			if pod.Spec.ActiveDeadlineSeconds != nil {
+				t.Errorf("unexpected deadline for the failed pod")
+			}
+		}
+	}
+
+	// Cancelled jobs can not be suspended or resumed, and cancelling again is a no-op
+	for path, code := range map[string]int{
+		"/system/logs/testName/job/suspend": http.StatusConflict,
+		"/system/logs/testName/job/resume":  http.StatusConflict,
+		"/system/logs/testName/job/cancel":  http.StatusOK,
+	} {
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("POST", path, nil)
+		r.ServeHTTP(w, req)
+		if w.Code != code {
+			t.Errorf("expecting code %d for %s, got %d", code, path, w.Code)
+		}
+	}
+}
+
+func TestMakeCancelJobHandlerQueuedJob(t *testing.T) {
+	calls := map[string]bool{}
+	setJobWorkloadActive = func(_ context.Context, _ string, jobUID string, active bool) error {
+		calls[jobUID] = active
+		return nil
+	}
+	defer func() { setJobWorkloadActive = utils.SetJobWorkloadActive }()
+
+	suspend := true
+	back := backends.MakeFakeBackend()
+	back.Service = &types.Service{Name: "testName", Namespace: "oscar-svc"}
+	cfg := types.Config{ServicesNamespace: "oscar-svc"}
+	kubeClient := testclient.NewSimpleClientset(&batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "job",
+			Namespace: "oscar-svc",
+			UID:       "job-uid",
+			Labels:    map[string]string{types.ServiceLabel: "testName", "kueue.x-k8s.io/queue-name": "queue"},
+		},
+		Spec: batchv1.JobSpec{Suspend: &suspend},
+	})
+	r := gin.Default()
+	r.POST("/system/logs/:serviceName/:jobName/cancel", MakeCancelJobHandler(back, kubeClient, &cfg))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/system/logs/testName/job/cancel", nil)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expecting code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var status types.JobStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatalf("invalid status: %v", err)
+	}
+	if status.Status != types.JobStatusCancelled {
+		t.Errorf("expected the job to be cancelled, got %+v", status)
+	}
+	if active, ok := calls["job-uid"]; !ok || active {
+		t.Errorf("expected the kueue workload to be deactivated, got %v", calls)
+	}
+	job, _ := kubeClient.BatchV1().Jobs("oscar-svc").Get(context.TODO(), "job", metav1.GetOptions{})
+	if !types.JobStopped(job) {
+		t.Errorf("expected the cancelled queued job to be stopped")
+	}
+}
+
+func TestMakeSuspendResumeJobHandlers(t *testing.T) {
+	calls := map[string]bool{}
+	setJobWorkloadActive = func(_ context.Context, _ string, jobUID string, active bool) error {
+		calls[jobUID] = active
+		return nil
+	}
+	defer func() { setJobWorkloadActive = utils.SetJobWorkloadActive }()
+
+	suspend := false
+	back := backends.MakeFakeBackend()
+	back.Service = &types.Service{Name: "testName", Namespace: "oscar-svc"}
+	cfg := types.Config{ServicesNamespace: "oscar-svc"}
+	kubeClient := testclient.NewSimpleClientset(&batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "job", Namespace: "oscar-svc", UID: "job-uid", Labels: map[string]string{types.ServiceLabel: "testName"}},
+		Spec:       batchv1.JobSpec{Suspend: &suspend},
+	})
+	r := gin.Default()
+	r.POST("/system/logs/:serviceName/:jobName/suspend", MakeSuspendJobHandler(back, kubeClient, &cfg))
+	r.POST("/system/logs/:serviceName/:jobName/resume", MakeResumeJobHandler(back, kubeClient, &cfg))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/system/logs/testName/job/resume", nil)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusConflict {
+		t.Errorf("expecting code %d resuming a running job, got %d", http.StatusConflict, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/system/logs/testName/job/suspend", nil)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expecting code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var status types.JobStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatalf("invalid status: %v", err)
+	}
+	if status.Status != types.JobStatusSuspended {
+		t.Errorf("expected the job to be suspended, got %+v", status)
+	}
+	job, _ := kubeClient.BatchV1().Jobs("oscar-svc").Get(context.TODO(), "job", metav1.GetOptions{})
+	if !types.JobSuspendedByUser(job) {
+		t.Errorf("expected the job to be suspended by the user, got %+v", job)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/system/logs/testName/job/resume", nil)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expecting code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	job, _ = kubeClient.BatchV1().Jobs("oscar-svc").Get(context.TODO(), "job", metav1.GetOptions{})
+	if isJobSuspended(job) || types.JobSuspendedByUser(job) {
+		t.Errorf("expected the job to be resumed, got %+v", job)
+	}
+	if len(calls) != 0 {
+		t.Errorf("unexpected kueue workload updates: %v", calls)
+	}
+}
+
+func TestMakeSuspendResumeJobHandlersKueue(t *testing.T) {
+	calls := map[string]bool{}
+	setJobWorkloadActive = func(_ context.Context, _ string, jobUID string, active bool) error {
+		calls[jobUID] = active
+		return nil
+	}
+	defer func() { setJobWorkloadActive = utils.SetJobWorkloadActive }()
+
+	suspend := false
+	back := backends.MakeFakeBackend()
+	back.Service = &types.Service{Name: "testName", Namespace: "oscar-svc"}
+	cfg := types.Config{ServicesNamespace: "oscar-svc"}
+	kubeClient := testclient.NewSimpleClientset(&batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "job",
+			Namespace: "oscar-svc",
+			UID:       "job-uid",
+			Labels:    map[string]string{types.ServiceLabel: "testName", "kueue.x-k8s.io/queue-name": "queue"},
+		},
+		Spec: batchv1.JobSpec{Suspend: &suspend},
+	})
+	r := gin.Default()
+	r.POST("/system/logs/:serviceName/:jobName/suspend", MakeSuspendJobHandler(back, kubeClient, &cfg))
+	r.POST("/system/logs/:serviceName/:jobName/resume", MakeResumeJobHandler(back, kubeClient, &cfg))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/system/logs/testName/job/suspend", nil)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expecting code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if active, ok := calls["job-uid"]; !ok || active {
+		t.Errorf("expected the kueue workload to be deactivated, got %v", calls)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/system/logs/testName/job/resume", nil)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expecting code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var status types.JobStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatalf("invalid status: %v", err)
+	}
+	if !calls["job-uid"] {
+		t.Errorf("expected the kueue workload to be activated, got %v", calls)
+	}
+	// Kueue unsuspends the job when it is admitted again
+	job, _ := kubeClient.BatchV1().Jobs("oscar-svc").Get(context.TODO(), "job", metav1.GetOptions{})
+	if !isJobSuspended(job) || types.JobSuspendedByUser(job) {
+		t.Errorf("expected the job to wait for kueue admission, got %+v", job)
+	}
+	if status.KueueAdmission != types.KueueAdmissionPending {
+		t.Errorf("expected the job to be pending admission, got %+v", status)
+	}
+}
+
+func TestJobControlFinishedJob(t *testing.T) {
+	back := backends.MakeFakeBackend()
+	back.Service = &types.Service{Name: "testName", Namespace: "oscar-svc"}
+	cfg := types.Config{ServicesNamespace: "oscar-svc"}
+	kubeClient := testclient.NewSimpleClientset(&batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "job", Namespace: "oscar-svc", UID: "job-uid", Labels: map[string]string{types.ServiceLabel: "testName"}},
+		Status: batchv1.JobStatus{
+			Conditions: []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}},
+		},
+	})
+	r := gin.Default()
+	r.POST("/system/logs/:serviceName/:jobName/cancel", MakeCancelJobHandler(back, kubeClient, &cfg))
+	r.POST("/system/logs/:serviceName/:jobName/suspend", MakeSuspendJobHandler(back, kubeClient, &cfg))
+	r.POST("/system/logs/:serviceName/:jobName/resume", MakeResumeJobHandler(back, kubeClient, &cfg))
+
+	for _, action := range []string{"cancel", "suspend", "resume"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/system/logs/testName/job/"+action, nil)
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusConflict {
+			t.Errorf("expecting code %d to %s a finished job, got %d", http.StatusConflict, action, w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/system/logs/testName/missing/cancel", nil)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expecting code %d cancelling a missing job, got %d", http.StatusNotFound, w.Code)
+	}
+}
@@ -0,0 +1,156 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/grycap/oscar/v4/pkg/types"
+	"github.com/grycap/oscar/v4/pkg/utils"
+	"github.com/grycap/oscar/v4/pkg/utils/auth"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// eventVolumeName name of the volume with the stored event of a job
+	eventVolumeName = "oscar-event"
+	// eventFetcherContainerName name of the init container downloading the events stored in MinIO
+	eventFetcherContainerName = "event-fetcher"
+)
+
+// useStoredJobEvent stores the event of the job out of its definition and makes the service container
+// read it from a file, mounted from the Secret or downloaded from MinIO by an init container
+func useStoredJobEvent(ctx context.Context, cfg *types.Config, kubeClientset kubernetes.Interface, podSpec *v1.PodSpec, namespace string, service *types.Service, jobName string, event []byte) (*utils.EventReference, error) {
+	ref, err := utils.StoreJobEvent(ctx, cfg, kubeClientset, namespace, jobName, service.Name, service.Owner, event)
+	if err != nil {
+		return nil, err
+	}
+
+	eventFile := path.Join(types.EventFileMountPath, types.EventFileName)
+	if ref.Kind == utils.EventStoreSecret {
+		podSpec.Volumes = append(podSpec.Volumes, v1.Volume{
+			Name: eventVolumeName,
+			VolumeSource: v1.VolumeSource{
+				Secret: &v1.SecretVolumeSource{SecretName: ref.Path},
+			},
+		})
+	} else {
+		podSpec.Volumes = append(podSpec.Volumes, v1.Volume{
+			Name:         eventVolumeName,
+			VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}},
+		})
+		podSpec.InitContainers = append(podSpec.InitContainers, eventFetcherContainer(cfg, service.Owner, *ref, eventFile))
+	}
+
+	for i, c := range podSpec.Containers {
+		if c.Name != types.ContainerName {
+			continue
+		}
+		podSpec.Containers[i].Env = slices.DeleteFunc(slices.Clone(c.Env), func(env v1.EnvVar) bool {
+			return env.Name == types.EventVariable
+		})
+		podSpec.Containers[i].Env = append(podSpec.Containers[i].Env, v1.EnvVar{Name: types.EventRefVariable, Value: ref.String()})
+		podSpec.Containers[i].Args = storedEventArgs(c.Args, eventFile)
+		podSpec.Containers[i].VolumeMounts = append(podSpec.Containers[i].VolumeMounts, v1.VolumeMount{
+			Name:      eventVolumeName,
+			MountPath: types.EventFileMountPath,
+			ReadOnly:  ref.Kind == utils.EventStoreSecret,
+		})
+	}
+	return ref, nil
+}
+
+// storedEventArgs replaces the event variable piped to the supervisor by the event file.
+// The InterLink jobs do not decode the stored events, as they are not base64 encoded.
+func storedEventArgs(args []string, eventFile string) []string {
+	replacer := strings.NewReplacer(
+		"echo $"+types.EventVariable+" | base64 -d", "cat "+eventFile,
+		"echo $"+types.EventVariable, "cat "+eventFile,
+	)
+	stored := make([]string, len(args))
+	for i, arg := range args {
+		stored[i] = replacer.Replace(arg)
+	}
+	return stored
+}
+
+// eventSHA256 returns the hex encoded SHA-256 hash of an event
+func eventSHA256(event []byte) string {
+	sum := sha256.Sum256(event)
+	return hex.EncodeToString(sum[:])
+}
+
+// jobEventReference returns the reference to the stored event of a job, if any
+func jobEventReference(podSpec v1.PodSpec) *utils.EventReference {
+	for _, c := range podSpec.Containers {
+		if c.Name != types.ContainerName {
+			continue
+		}
+		for _, env := range c.Env {
+			if env.Name == types.EventRefVariable {
+				ref, err := utils.ParseEventReference(env.Value)
+				if err != nil {
+					return nil
+				}
+				return ref
+			}
+		}
+	}
+	return nil
+}
+
+// eventFetcherContainer returns the init container downloading an event stored in MinIO with rclone,
+// authenticated with the MinIO credentials of the service owner mounted from its Secret
+func eventFetcherContainer(cfg *types.Config, owner string, ref utils.EventReference, eventFile string) v1.Container {
+	credentialsSecret := auth.FormatUID(owner)
+	if owner == "" || owner == types.DefaultOwner {
+		credentialsSecret = "minio"
+	}
+	secretEnv := func(name string, key string) v1.EnvVar {
+		return v1.EnvVar{
+			Name: name,
+			ValueFrom: &v1.EnvVarSource{
+				SecretKeyRef: &v1.SecretKeySelector{
+					LocalObjectReference: v1.LocalObjectReference{Name: credentialsSecret},
+					Key:                  key,
+				},
+			},
+		}
+	}
+	return v1.Container{
+		Name:    eventFetcherContainerName,
+		Image:   cfg.EventFetcherImage,
+		Command: []string{"rclone", "copyto", "minio:" + ref.Path, eventFile},
+		Env: []v1.EnvVar{
+			{Name: "RCLONE_CONFIG_MINIO_TYPE", Value: "s3"},
+			{Name: "RCLONE_CONFIG_MINIO_PROVIDER", Value: "Minio"},
+			{Name: "RCLONE_CONFIG_MINIO_ENDPOINT", Value: cfg.MinIOProvider.Endpoint},
+			secretEnv("RCLONE_CONFIG_MINIO_ACCESS_KEY_ID", MinIOSecretKeyName),
+			secretEnv("RCLONE_CONFIG_MINIO_SECRET_ACCESS_KEY", MinIOSecretValueName),
+		},
+		VolumeMounts: []v1.VolumeMount{{
+			Name:      eventVolumeName,
+			MountPath: types.EventFileMountPath,
+		}},
+	}
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/grycap/oscar/v4/pkg/types"
+	"github.com/grycap/oscar/v4/pkg/utils"
+	"github.com/grycap/oscar/v4/pkg/utils/auth"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestStoredEventArgs(t *testing.T) {
+	args := storedEventArgs([]string{"-c", "echo $EVENT | /oscar/bin/supervisor;echo \"I finish\" > /tmpfolder/finish-file;"}, "/oscar/event/event")
+	if args[1] != "cat /oscar/event/event | /oscar/bin/supervisor;echo \"I finish\" > /tmpfolder/finish-file;" {
+		t.Errorf("unexpected args: %v", args)
+	}
+	args = storedEventArgs(types.OscarContainerCommand, "/oscar/event/event")
+	if args[0] != "cat /oscar/event/event | /data/supervisor" {
+		t.Errorf("unexpected InterLink args: %v", args)
+	}
+}
+
+func TestEventFetcherContainer(t *testing.T) {
+	cfg := &types.Config{EventFetcherImage: "rclone/rclone", MinIOProvider: &types.MinIOProvider{Endpoint: "http://minio.minio:9000"}}
+	ref := utils.EventReference{Kind: utils.EventStoreMinIO, Path: "oscar-events/user/oscar-svc/job"}
+
+	for owner, secret := range map[string]string{"user": auth.FormatUID("user"), types.DefaultOwner: "minio", "": "minio"} {
+		container := eventFetcherContainer(cfg, owner, ref, "/oscar/event/event")
+		if strings.Join(container.Command, " ") != "rclone copyto minio:oscar-events/user/oscar-svc/job /oscar/event/event" {
+			t.Errorf("unexpected command: %v", container.Command)
+		}
+		for _, env := range container.Env {
+			if env.Value == "" && (env.ValueFrom == nil || env.ValueFrom.SecretKeyRef.Name != secret) {
+				t.Errorf("expected the credentials of owner %q from Secret %s, got %+v", owner, secret, env)
+			}
+		}
+	}
+}
+
+func TestJobEventReference(t *testing.T) {
+	var podSpec corev1.PodSpec
+	podSpec.Containers = []corev1.Container{{
+		Name: types.ContainerName,
+		Env:  []corev1.EnvVar{{Name: types.EventRefVariable, Value: "secret:job-event"}},
+	}}
+	if ref := jobEventReference(podSpec); ref == nil || ref.Path != "job-event" {
+		t.Errorf("unexpected event reference: %v", ref)
+	}
+}
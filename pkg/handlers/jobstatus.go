@@ -0,0 +1,474 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/grycap/oscar/v4/pkg/types"
+	"github.com/grycap/oscar/v4/pkg/utils"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// MakeJobStatusHandler godoc
+// @Summary Get job status
+// @Description Get the detailed status of a job: exit code, termination reason, retries, node, Kueue admission, delegation and related Kubernetes events.
+// @Tags logs
+// @Produce json
+// @Param serviceName path string true "Service name"
+// @Param jobName path string true "Job name"
+// @Success 200 {object} types.JobStatus
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Not Found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Security BasicAuth
+// @Security BearerAuth
+// @Router /system/logs/{serviceName}/{jobName}/status [get]
+func MakeJobStatusHandler(back types.ServerlessBackend, kubeClientset kubernetes.Interface, cfg *types.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		serviceName := c.Param("serviceName")
+		service, ok := getAuthorizedService(c, back, serviceName, types.ServiceRoleViewer)
+		if !ok {
+			if !c.Writer.Written() {
+				c.Status(http.StatusForbidden)
+			}
+			return
+		}
+		status, _, err := readJobStatus(c.Request.Context(), kubeClientset, resolveServiceNamespace(service, cfg), serviceName, c.Param("jobName"))
+		if errors.IsNotFound(err) {
+			status, err = readArchivedJobStatus(c.Request.Context(), cfg, resolveServiceNamespace(service, cfg), serviceName, c.Param("jobName"))
+		}
+		if err != nil {
+			if errors.IsNotFound(err) {
+				c.Status(http.StatusNotFound)
+			} else {
+				c.String(http.StatusInternalServerError, err.Error())
+			}
+			return
+		}
+		c.JSON(http.StatusOK, status)
+	}
+}
+
+const (
+	// defaultJobWaitTimeout time waiting for a job to finish if no timeout is provided
+	defaultJobWaitTimeout = 60 * time.Second
+	// jobWaitMargin margin to reply before the server write timeout
+	jobWaitMargin = 5 * time.Second
+)
+
+// jobWaitInterval interval between checks of the job status, replaceable in tests
+var jobWaitInterval = 2 * time.Second
+
+// supervisorUploadRegexp matches the log lines of the FaaS Supervisor when uploading an output file
+var supervisorUploadRegexp = regexp.MustCompile(`Uploading file\s+'([^']+)'\s+to bucket\s+'([^']+)'`)
+
+// MakeJobWaitHandler godoc
+// @Summary Wait for a job
+// @Description Wait until a job finishes, up to the provided timeout, and return its final status and the output objects uploaded by the FaaS Supervisor. Returns 202 with the current status if the job is still running when the timeout expires.
+// @Tags logs
+// @Produce json
+// @Param serviceName path string true "Service name"
+// @Param jobName path string true "Job name"
+// @Param timeout query int false "Maximum time to wait in seconds (default: 60)"
+// @Success 200 {object} types.JobResult
+// @Success 202 {object} types.JobResult
+// @Failure 400 {string} string "Bad Request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Not Found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Security BasicAuth
+// @Security BearerAuth
+// @Router /system/logs/{serviceName}/{jobName}/wait [get]
+func MakeJobWaitHandler(back types.ServerlessBackend, kubeClientset kubernetes.Interface, cfg *types.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		serviceName := c.Param("serviceName")
+		service, ok := getAuthorizedService(c, back, serviceName, types.ServiceRoleViewer)
+		if !ok {
+			if !c.Writer.Written() {
+				c.Status(http.StatusForbidden)
+			}
+			return
+		}
+		serviceNamespace := resolveServiceNamespace(service, cfg)
+		jobName := c.Param("jobName")
+
+		timeout := defaultJobWaitTimeout
+		if value := c.Query("timeout"); value != "" {
+			seconds, err := strconv.Atoi(value)
+			if err != nil || seconds < 0 {
+				c.String(http.StatusBadRequest, "invalid timeout \"%s\"", value)
+				return
+			}
+			timeout = time.Duration(seconds) * time.Second
+		}
+		// Reply before the server closes the connection
+		if cfg.WriteTimeout > jobWaitMargin {
+			timeout = min(timeout, cfg.WriteTimeout-jobWaitMargin)
+		}
+
+		ctx := c.Request.Context()
+		deadline := time.Now().Add(timeout)
+		// Only the job is polled, its full status is read once it finishes or the timeout expires
+		for {
+			job, err := kubeClientset.BatchV1().Jobs(serviceNamespace).Get(ctx, jobName, metav1.GetOptions{})
+			if err != nil && !errors.IsNotFound(err) {
+				c.String(http.StatusInternalServerError, err.Error())
+				return
+			}
+			if err != nil || job.Labels[types.ServiceLabel] != serviceName || types.JobStopped(job) || !time.Now().Before(deadline) {
+				break
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(min(jobWaitInterval, time.Until(deadline))):
+			}
+		}
+
+		status, job, err := readJobStatus(ctx, kubeClientset, serviceNamespace, serviceName, jobName)
+		if errors.IsNotFound(err) {
+			// Jobs deleted from the cluster are finished, if archived
+			if status, err = readArchivedJobStatus(ctx, cfg, serviceNamespace, serviceName, jobName); err == nil {
+				result := types.JobResult{JobStatus: *status, Finished: true, Outputs: []string{}}
+				if logs, err := readArchivedLogs(ctx, cfg, serviceNamespace, serviceName, jobName, false); err == nil {
+					result.Outputs = supervisorOutputs(logs)
+				}
+				c.JSON(http.StatusOK, result)
+				return
+			}
+		}
+		if err != nil {
+			if errors.IsNotFound(err) {
+				c.Status(http.StatusNotFound)
+			} else {
+				c.String(http.StatusInternalServerError, err.Error())
+			}
+			return
+		}
+		result := types.JobResult{JobStatus: *status, Outputs: []string{}}
+		// The result of delegated jobs is only available in the target cluster
+		if job == nil {
+			c.JSON(http.StatusOK, result)
+			return
+		}
+		if !types.JobStopped(job) {
+			c.JSON(http.StatusAccepted, result)
+			return
+		}
+		result.Finished = true
+		result.Outputs = jobOutputs(ctx, kubeClientset, serviceNamespace, serviceName, jobName)
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// jobOutputs returns the output objects uploaded by the FaaS Supervisor, read from the logs of the latest pod of the job
+func jobOutputs(ctx context.Context, kubeClientset kubernetes.Interface, namespace string, serviceName string, jobName string) []string {
+	outputs := []string{}
+	pods, err := listJobPods(ctx, kubeClientset, namespace, serviceName, jobName)
+	if err != nil || len(pods) == 0 {
+		return outputs
+	}
+	podLogOpts := &v1.PodLogOptions{Container: types.ContainerName}
+	logs, err := kubeClientset.CoreV1().Pods(namespace).GetLogs(latestPod(pods).Name, podLogOpts).Do(ctx).Raw()
+	if err != nil {
+		return outputs
+	}
+	return supervisorOutputs(string(logs))
+}
+
+// supervisorOutputs parses the output objects uploaded by the FaaS Supervisor from its logs
+func supervisorOutputs(logs string) []string {
+	outputs := []string{}
+	for _, match := range supervisorUploadRegexp.FindAllStringSubmatch(logs, -1) {
+		key := strings.TrimPrefix(match[1], "/")
+		output := match[2] + "/" + key
+		if !slices.Contains(outputs, output) {
+			outputs = append(outputs, output)
+		}
+	}
+	return outputs
+}
+
+// readJobStatus returns the detailed status of a job of the service and the job itself.
+// The job is nil if it was delegated to another cluster.
+func readJobStatus(ctx context.Context, kubeClientset kubernetes.Interface, namespace string, serviceName string, jobName string) (*types.JobStatus, *batchv1.Job, error) {
+	notFound := errors.NewNotFound(batchv1.Resource("jobs"), jobName)
+	job, err := kubeClientset.BatchV1().Jobs(namespace).Get(ctx, jobName, metav1.GetOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, nil, err
+	}
+	jobFound := err == nil
+
+	jobEvents, err := objectEvents(ctx, kubeClientset, namespace, "Job", jobName)
+	if err != nil {
+		return nil, nil, err
+	}
+	delegatedTo := delegationTarget(jobEvents)
+
+	if !jobFound {
+		// Jobs delegated to other clusters are only recorded by their events
+		if delegatedTo == "" {
+			return nil, nil, notFound
+		}
+		return &types.JobStatus{
+			Name:    jobName,
+			JobInfo: types.JobInfo{Status: types.JobDelegatedReason, DelegatedTo: delegatedTo},
+			Events:  toJobEvents(jobEvents),
+		}, nil, nil
+	}
+	if job.Labels[types.ServiceLabel] != serviceName {
+		return nil, nil, notFound
+	}
+
+	pods, err := listJobPods(ctx, kubeClientset, namespace, serviceName, jobName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	events := jobEvents
+	for _, pod := range pods {
+		podEvents, err := objectEvents(ctx, kubeClientset, namespace, "Pod", pod.Name)
+		if err != nil {
+			return nil, nil, err
+		}
+		events = append(events, podEvents...)
+	}
+
+	info := buildJobInfo(job, pods)
+	info.DelegatedTo = delegatedTo
+	return &types.JobStatus{
+		Name:    jobName,
+		JobInfo: *info,
+		Events:  toJobEvents(events),
+	}, job, nil
+}
+
+// listJobPods returns the pods of a job of the service
+func listJobPods(ctx context.Context, kubeClientset kubernetes.Interface, namespace string, serviceName string, jobName string) ([]v1.Pod, error) {
+	listOpts := metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s,job-name=%s", types.ServiceLabel, serviceName, jobName),
+	}
+	pods, err := kubeClientset.CoreV1().Pods(namespace).List(ctx, listOpts)
+	if err != nil {
+		return nil, err
+	}
+	return pods.Items, nil
+}
+
+// latestPod returns the most recently created pod
+func latestPod(pods []v1.Pod) v1.Pod {
+	latest := pods[0]
+	for _, pod := range pods[1:] {
+		if pod.CreationTimestamp.After(latest.CreationTimestamp.Time) {
+			latest = pod
+		}
+	}
+	return latest
+}
+
+// buildJobInfo summarises the status of a job from the job and its pods, using the most recent pod
+func buildJobInfo(job *batchv1.Job, pods []v1.Pod) *types.JobInfo {
+	jobInfo := &types.JobInfo{
+		Status:        types.JobStatusSuspended,
+		Retries:       job.Status.Failed,
+		DelegatedFrom: job.Annotations[types.DelegatedFromAnnotation],
+		RerunOf:       job.Annotations[types.RerunOfAnnotation],
+	}
+	if _, ok := job.Labels[utils.KueueQueueNameLabel]; ok {
+		if job.Spec.Suspend != nil && *job.Spec.Suspend {
+			jobInfo.KueueAdmission = types.KueueAdmissionPending
+		} else {
+			jobInfo.KueueAdmission = types.KueueAdmissionAdmitted
+		}
+	}
+
+	var failed, complete *batchv1.JobCondition
+	for i, condition := range job.Status.Conditions {
+		if condition.Status != v1.ConditionTrue {
+			continue
+		}
+		switch condition.Type {
+		case batchv1.JobFailed:
+			failed = &job.Status.Conditions[i]
+		case batchv1.JobComplete:
+			complete = &job.Status.Conditions[i]
+		}
+	}
+
+	if len(pods) == 0 {
+		// The pods of finished jobs may have been removed (e.g. when the deadline is exceeded)
+		switch {
+		case failed != nil:
+			jobInfo.Status = string(v1.PodFailed)
+			jobInfo.Reason = failed.Reason
+			jobInfo.Message = failed.Message
+			jobInfo.FinishTime = &failed.LastTransitionTime
+		case complete != nil:
+			jobInfo.Status = string(v1.PodSucceeded)
+			jobInfo.FinishTime = job.Status.CompletionTime
+		}
+		setFailedJobStatus(job, failed, jobInfo)
+		setUserJobStatus(job, jobInfo)
+		return jobInfo
+	}
+
+	podObject := latestPod(pods)
+	jobInfo.Status = string(podObject.Status.Phase)
+	jobInfo.CreationTime = podObject.Status.StartTime
+	jobInfo.NodeName = podObject.Spec.NodeName
+	for _, contStatus := range podObject.Status.ContainerStatuses {
+		if contStatus.Name != types.ContainerName {
+			continue
+		}
+		jobInfo.Retries += contStatus.RestartCount
+		switch {
+		case contStatus.State.Running != nil:
+			jobInfo.StartTime = &(contStatus.State.Running.StartedAt)
+		case contStatus.State.Terminated != nil:
+			jobInfo.StartTime = &(contStatus.State.Terminated.StartedAt)
+			jobInfo.FinishTime = &(contStatus.State.Terminated.FinishedAt)
+			exitCode := contStatus.State.Terminated.ExitCode
+			jobInfo.ExitCode = &exitCode
+			jobInfo.Reason = contStatus.State.Terminated.Reason
+			jobInfo.Message = strings.TrimSpace(contStatus.State.Terminated.Message)
+		case contStatus.State.Waiting != nil:
+			jobInfo.Reason = contStatus.State.Waiting.Reason
+			jobInfo.Message = contStatus.State.Waiting.Message
+		}
+	}
+	if jobInfo.Reason == "" {
+		jobInfo.Reason = podObject.Status.Reason
+		jobInfo.Message = podObject.Status.Message
+	}
+	if jobInfo.Reason == "" && failed != nil {
+		jobInfo.Reason = failed.Reason
+		jobInfo.Message = failed.Message
+	}
+	setFailedJobStatus(job, failed, jobInfo)
+	setUserJobStatus(job, jobInfo)
+	return jobInfo
+}
+
+// setFailedJobStatus reports the jobs failed by the deadline or the retries of the retry policy of their service
+func setFailedJobStatus(job *batchv1.Job, failed *batchv1.JobCondition, jobInfo *types.JobInfo) {
+	if failed == nil {
+		return
+	}
+	switch failed.Reason {
+	case batchv1.JobReasonDeadlineExceeded:
+		jobInfo.Status = types.JobStatusDeadlineExceeded
+	case batchv1.JobReasonBackoffLimitExceeded:
+		if job.Spec.BackoffLimit != nil && *job.Spec.BackoffLimit > 0 {
+			jobInfo.Status = types.JobStatusRetriesExhausted
+		}
+	}
+}
+
+// setUserJobStatus reports the jobs cancelled or suspended by their users and the jobs held by the
+// concurrency limit of their service, which are otherwise seen as failed or suspended
+func setUserJobStatus(job *batchv1.Job, jobInfo *types.JobInfo) {
+	switch {
+	case types.JobCancelled(job):
+		jobInfo.Status = types.JobStatusCancelled
+	case types.JobSuspendedByUser(job):
+		jobInfo.Status = types.JobStatusSuspended
+	case types.JobHeld(job):
+		jobInfo.Status = types.JobStatusQueued
+	}
+}
+
+// objectEvents returns the events of the object with the provided kind and name
+func objectEvents(ctx context.Context, kubeClientset kubernetes.Interface, namespace string, kind string, name string) ([]v1.Event, error) {
+	listOpts := metav1.ListOptions{
+		FieldSelector: fmt.Sprintf("involvedObject.kind=%s,involvedObject.name=%s", kind, name),
+	}
+	events, err := kubeClientset.CoreV1().Events(namespace).List(ctx, listOpts)
+	if err != nil {
+		return nil, err
+	}
+	// Filter again, as field selectors are ignored by some clients
+	return slices.DeleteFunc(events.Items, func(event v1.Event) bool {
+		return event.InvolvedObject.Kind != kind || event.InvolvedObject.Name != name
+	}), nil
+}
+
+// delegationTarget returns the cluster of the last delegation event, if any
+func delegationTarget(events []v1.Event) string {
+	target := ""
+	var last metav1.Time
+	for _, event := range events {
+		if event.Reason != types.JobDelegatedReason {
+			continue
+		}
+		if t := eventTime(event); target == "" || !t.Before(&last) {
+			target = event.Annotations[types.DelegatedToAnnotation]
+			last = t
+		}
+	}
+	return target
+}
+
+// toJobEvents converts the Kubernetes events, sorted by time
+func toJobEvents(events []v1.Event) []types.JobEvent {
+	slices.SortStableFunc(events, func(a, b v1.Event) int {
+		return eventTime(a).Compare(eventTime(b).Time)
+	})
+	jobEvents := make([]types.JobEvent, 0, len(events))
+	for _, event := range events {
+		jobEvent := types.JobEvent{
+			Type:    event.Type,
+			Reason:  event.Reason,
+			Message: event.Message,
+			Object:  fmt.Sprintf("%s/%s", strings.ToLower(event.InvolvedObject.Kind), event.InvolvedObject.Name),
+			Count:   event.Count,
+		}
+		if !event.FirstTimestamp.IsZero() {
+			jobEvent.FirstTime = event.FirstTimestamp.DeepCopy()
+		}
+		if last := eventTime(event); !last.IsZero() {
+			jobEvent.LastTime = &last
+		}
+		jobEvents = append(jobEvents, jobEvent)
+	}
+	return jobEvents
+}
+
+// eventTime returns the last time the event was observed
+func eventTime(event v1.Event) metav1.Time {
+	switch {
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp
+	case !event.EventTime.IsZero():
+		return metav1.NewTime(event.EventTime.Time)
+	default:
+		return event.FirstTimestamp
+	}
+}
@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/grycap/oscar/v4/pkg/backends"
+	"github.com/grycap/oscar/v4/pkg/types"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	testclient "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestBuildJobInfo(t *testing.T) {
+	now := metav1.Now()
+	suspended := true
+	kueueJob := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "job", Labels: map[string]string{"kueue.x-k8s.io/queue-name": "queue"}},
+		Spec:       batchv1.JobSpec{Suspend: &suspended},
+	}
+	info := buildJobInfo(kueueJob, nil)
+	if info.Status != "Suspended" || info.KueueAdmission != types.KueueAdmissionPending {
+		t.Errorf("unexpected job info: %+v", info)
+	}
+
+	deadlineJob := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "job"},
+		Status: batchv1.JobStatus{
+			Conditions: []batchv1.JobCondition{{
+				Type:               batchv1.JobFailed,
+				Status:             corev1.ConditionTrue,
+				Reason:             "DeadlineExceeded",
+				Message:            "Job was active longer than specified deadline",
+				LastTransitionTime: now,
+			}},
+		},
+	}
+	info = buildJobInfo(deadlineJob, nil)
+	if info.Status != types.JobStatusDeadlineExceeded || info.Reason != "DeadlineExceeded" || info.FinishTime == nil {
+		t.Errorf("unexpected job info: %+v", info)
+	}
+
+	maxRetries := int32(2)
+	retriedJob := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "job"},
+		Spec:       batchv1.JobSpec{BackoffLimit: &maxRetries},
+		Status: batchv1.JobStatus{
+			Failed: 3,
+			Conditions: []batchv1.JobCondition{{
+				Type:               batchv1.JobFailed,
+				Status:             corev1.ConditionTrue,
+				Reason:             batchv1.JobReasonBackoffLimitExceeded,
+				LastTransitionTime: now,
+			}},
+		},
+	}
+	info = buildJobInfo(retriedJob, nil)
+	if info.Status != types.JobStatusRetriesExhausted || info.Retries != 3 {
+		t.Errorf("unexpected job info: %+v", info)
+	}
+	// Jobs without retries keep the Failed status
+	retriedJob.Spec.BackoffLimit = nil
+	if info = buildJobInfo(retriedJob, nil); info.Status != "Failed" {
+		t.Errorf("unexpected job info: %+v", info)
+	}
+
+	oomJob := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "job", Annotations: map[string]string{types.DelegatedFromAnnotation: "cluster-a"}},
+		Status:     batchv1.JobStatus{Failed: 1},
+	}
+	pods := []corev1.Pod{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "old", CreationTimestamp: metav1.NewTime(now.Add(-time.Minute))},
+			Status:     corev1.PodStatus{Phase: corev1.PodFailed},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "new", CreationTimestamp: now},
+			Spec:       corev1.PodSpec{NodeName: "node-1"},
+			Status: corev1.PodStatus{
+				Phase: corev1.PodFailed,
+				ContainerStatuses: []corev1.ContainerStatus{{
+					Name:         types.ContainerName,
+					RestartCount: 1,
+					State: corev1.ContainerState{
+						Terminated: &corev1.ContainerStateTerminated{ExitCode: 137, Reason: "OOMKilled", StartedAt: now, FinishedAt: now},
+					},
+				}},
+			},
+		},
+	}
+	info = buildJobInfo(oomJob, pods)
+	if info.Status != "Failed" || info.Reason != "OOMKilled" || info.ExitCode == nil || *info.ExitCode != 137 {
+		t.Errorf("unexpected job info: %+v", info)
+	}
+	if info.NodeName != "node-1" || info.Retries != 2 || info.DelegatedFrom != "cluster-a" {
+		t.Errorf("unexpected job info: %+v", info)
+	}
+}
+
+func TestMakeJobStatusHandler(t *testing.T) {
+	back := backends.MakeFakeBackend()
+	back.Service = &types.Service{Name: "test", Namespace: "ns"}
+	now := metav1.Now()
+
+	kubeClientset := testclient.NewSimpleClientset(
+		&batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: "job", Namespace: "ns", Labels: map[string]string{types.ServiceLabel: "test"}},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "job-pod", Namespace: "ns", Labels: map[string]string{types.ServiceLabel: "test", "job-name": "job"}},
+			Status:     corev1.PodStatus{Phase: corev1.PodPending, Reason: "Unschedulable"},
+		},
+		&corev1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Name: "job-pod.1", Namespace: "ns"},
+			InvolvedObject: corev1.ObjectReference{Kind: "Pod", Name: "job-pod"},
+			Type:           corev1.EventTypeWarning,
+			Reason:         "FailedScheduling",
+			Message:        "0/3 nodes are available: 3 Insufficient cpu.",
+			LastTimestamp:  now,
+		},
+		&corev1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Name: "job.1", Namespace: "ns"},
+			InvolvedObject: corev1.ObjectReference{Kind: "Job", Name: "job"},
+			Type:           corev1.EventTypeNormal,
+			Reason:         "SuccessfulCreate",
+			LastTimestamp:  metav1.NewTime(now.Add(-time.Second)),
+		},
+		&corev1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Name: "other.1", Namespace: "ns"},
+			InvolvedObject: corev1.ObjectReference{Kind: "Pod", Name: "other"},
+			Reason:         "Pulled",
+		},
+		&corev1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Name: "delegated.1", Namespace: "ns", Annotations: map[string]string{types.DelegatedToAnnotation: "cluster-b"}},
+			InvolvedObject: corev1.ObjectReference{Kind: "Job", Name: "delegated"},
+			Reason:         types.JobDelegatedReason,
+			LastTimestamp:  now,
+		},
+	)
+
+	r := gin.New()
+	r.GET("/system/logs/:serviceName/:jobName/status", MakeJobStatusHandler(back, kubeClientset, &types.Config{}))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/system/logs/test/job/status", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var status types.JobStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if status.Name != "job" || status.Status != "Pending" || status.Reason != "Unschedulable" {
+		t.Errorf("unexpected status: %+v", status)
+	}
+	if len(status.Events) != 2 || status.Events[0].Reason != "SuccessfulCreate" || status.Events[1].Object != "pod/job-pod" {
+		t.Errorf("unexpected events: %+v", status.Events)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/system/logs/test/delegated/status", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	status = types.JobStatus{}
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if status.Status != types.JobDelegatedReason || status.DelegatedTo != "cluster-b" {
+		t.Errorf("unexpected status: %+v", status)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/system/logs/test/missing/status", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", w.Code)
+	}
+}
+
+func TestMakeJobWaitHandler(t *testing.T) {
+	back := backends.MakeFakeBackend()
+	back.Service = &types.Service{Name: "test", Namespace: "ns"}
+	kubeClientset := testclient.NewSimpleClientset(
+		&batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: "running", Namespace: "ns", Labels: map[string]string{types.ServiceLabel: "test"}},
+		},
+		&batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: "done", Namespace: "ns", Labels: map[string]string{types.ServiceLabel: "test"}},
+			Status: batchv1.JobStatus{
+				Conditions: []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}},
+			},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "done-pod", Namespace: "ns", Labels: map[string]string{types.ServiceLabel: "test", "job-name": "done"}},
+			Status:     corev1.PodStatus{Phase: corev1.PodSucceeded},
+		},
+	)
+	jobWaitInterval = 10 * time.Millisecond
+
+	r := gin.New()
+	r.GET("/system/logs/:serviceName/:jobName/wait", MakeJobWaitHandler(back, kubeClientset, &types.Config{}))
+
+	tests := []struct {
+		path     string
+		code     int
+		finished bool
+	}{
+		{"/system/logs/test/done/wait", http.StatusOK, true},
+		{"/system/logs/test/running/wait?timeout=0", http.StatusAccepted, false},
+		{"/system/logs/test/running/wait?timeout=abc", http.StatusBadRequest, false},
+		{"/system/logs/test/missing/wait", http.StatusNotFound, false},
+	}
+	for _, tc := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if w.Code != tc.code {
+			t.Errorf("%s: expected %d, got %d: %s", tc.path, tc.code, w.Code, w.Body.String())
+			continue
+		}
+		if tc.code != http.StatusOK && tc.code != http.StatusAccepted {
+			continue
+		}
+		var result types.JobResult
+		if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+			t.Fatalf("%s: decode response: %v", tc.path, err)
+		}
+		if result.Finished != tc.finished || result.Outputs == nil {
+			t.Errorf("%s: unexpected result: %+v", tc.path, result)
+		}
+	}
+}
+
+func TestMakeJobWaitHandlerPollsOnlyTheJob(t *testing.T) {
+	back := backends.MakeFakeBackend()
+	back.Service = &types.Service{Name: "test", Namespace: "ns"}
+	kubeClientset := testclient.NewSimpleClientset(&batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "running", Namespace: "ns", Labels: map[string]string{types.ServiceLabel: "test"}},
+	})
+	jobWaitInterval = 10 * time.Millisecond
+
+	r := gin.New()
+	r.GET("/system/logs/:serviceName/:jobName/wait", MakeJobWaitHandler(back, kubeClientset, &types.Config{}))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/system/logs/test/running/wait?timeout=1", nil))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected %d, got %d: %s", http.StatusAccepted, w.Code, w.Body.String())
+	}
+
+	gets, lists := 0, 0
+	for _, action := range kubeClientset.Actions() {
+		switch {
+		case action.GetVerb() == "get" && action.GetResource().Resource == "jobs":
+			gets++
+		case action.GetVerb() == "list":
+			lists++
+		}
+	}
+	// The events and pods of the job are listed once, when building the final status
+	if gets < 2 || lists != 2 {
+		t.Errorf("expected the job to be polled and its status read once, got %d gets and %d lists", gets, lists)
+	}
+}
+
+func TestSupervisorOutputs(t *testing.T) {
+	logs := `2024-01-10 10:00:00 - SUPERVISOR - INFO - Uploading file  'output/result.txt' to bucket 'bucket'
+2024-01-10 10:00:01 - SUPERVISOR - INFO - Uploading file '/output/plot.png' to bucket 'bucket'
+2024-01-10 10:00:01 - SUPERVISOR - INFO - Uploading file 'output/result.txt' to bucket 'bucket'
+2024-01-10 10:00:02 - SUPERVISOR - INFO - Creating temporary folder`
+	outputs := supervisorOutputs(logs)
+	expected := []string{"bucket/output/result.txt", "bucket/output/plot.png"}
+	if len(outputs) != len(expected) || outputs[0] != expected[0] || outputs[1] != expected[1] {
+		t.Errorf("expected %v, got %v", expected, outputs)
+	}
+}
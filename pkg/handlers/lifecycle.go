@@ -107,7 +107,7 @@ func makeExposedServiceLifecycleHandler(back types.ServerlessBackend, kubeClient
 			c.String(http.StatusBadRequest, serviceName)
 			return
 		}
-		service, ok := getAuthorizedServiceOwner(c, back, serviceName)
+		service, ok := getManagedService(c, back, serviceName, types.ServiceRoleEditor)
 		if !ok {
 			return
 		}
@@ -135,7 +135,8 @@ func makeExposedServiceLifecycleHandler(back types.ServerlessBackend, kubeClient
 	}
 }
 
-func getAuthorizedServiceOwner(c *gin.Context, back types.ServerlessBackend, serviceName string) (*types.Service, bool) {
+// getManagedService returns the service if the OIDC user has, at least, the role on it, writing the error response otherwise
+func getManagedService(c *gin.Context, back types.ServerlessBackend, serviceName string, role string) (*types.Service, bool) {
 	service, err := back.ReadService("", serviceName)
 	if err != nil {
 		if apierrors.IsNotFound(err) || apierrors.IsGone(err) {
@@ -154,7 +155,7 @@ func getAuthorizedServiceOwner(c *gin.Context, back types.ServerlessBackend, ser
 		c.String(http.StatusUnauthorized, err.Error())
 		return nil, false
 	}
-	if service.Owner != uid {
+	if !auth.HasServiceRole(c, service, role) {
 		c.String(http.StatusForbidden, "User %s doesn't have permission to manage this service", uid)
 		return nil, false
 	}
@@ -19,12 +19,10 @@ package handlers
 import (
 	"fmt"
 	"net/http"
-	"slices"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/grycap/oscar/v4/pkg/types"
-	"github.com/grycap/oscar/v4/pkg/utils"
 	"github.com/grycap/oscar/v4/pkg/utils/auth"
 	"k8s.io/client-go/kubernetes"
 )
@@ -59,26 +57,13 @@ func MakeListHandler(back types.ServerlessBackend, kubeClientset kubernetes.Inte
 				return
 			}
 
-			isAllowedServiceForUser := false
+			groups := auth.GetUserGroupsFromContext(c)
 			allowedServicesForUser := []*types.Service{}
 			for _, service := range services {
-				switch service.Visibility {
-				case utils.PUBLIC:
-					isAllowedServiceForUser = true
-				case utils.PRIVATE:
-					if service.Owner == uid {
-						isAllowedServiceForUser = true
-					}
-				case utils.RESTRICTED:
-					if service.Owner == uid || slices.Contains(service.AllowedUsers, uid) {
-						isAllowedServiceForUser = true
-					}
-				}
-				// If the service is allowed for the user,
+				// If the user has a role on the service,
 				// set the volume status and deployment summary (if requested),
 				// and add it to the list of allowed services for the user.
-				if isAllowedServiceForUser {
-					isAllowedServiceForUser = false
+				if isServiceAccessibleByUser(service, uid, groups) {
 					setVolumeStatus(back, service)
 					if includeDeployment {
 						if err := setDeploymentSummary(back, kubeClientset, cfg, service); err != nil {
@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"maps"
 	"net/http"
 	"slices"
 	"strconv"
@@ -48,7 +49,7 @@ type PodListResult struct {
 
 // MakeJobsInfoHandler godoc
 // @Summary List jobs
-// @Description List jobs created by a service including their status and timestamps.
+// @Description List jobs created by a service including their status and timestamps. The first page also includes the archived jobs already deleted from the cluster.
 // @Tags logs
 // @Produce json
 // @Param serviceName path string true "Service name"
@@ -66,7 +67,7 @@ func MakeJobsInfoHandler(back types.ServerlessBackend, kubeClientset kubernetes.
 		// Get serviceName
 		serviceName := c.Param("serviceName")
 		page := c.DefaultQuery("page", "")
-		service, ok := getAuthorizedService(c, back, serviceName)
+		service, ok := getAuthorizedService(c, back, serviceName, types.ServiceRoleViewer)
 		if !ok {
 			return
 		}
@@ -74,6 +75,7 @@ func MakeJobsInfoHandler(back types.ServerlessBackend, kubeClientset kubernetes.
 		uid, err := auth.GetUIDFromContext(c)
 		// List jobs
 		var labelSelector string
+		owner := ""
 		if err != nil {
 			labelSelector = fmt.Sprintf("%s=%s", types.ServiceLabel, serviceName)
 		} else {
@@ -81,6 +83,7 @@ func MakeJobsInfoHandler(back types.ServerlessBackend, kubeClientset kubernetes.
 			if len(uidParsed) > 62 {
 				uidParsed = uidParsed[:62]
 			}
+			owner = uidParsed
 			labelSelector = fmt.Sprintf("%s=%s,%s=%s", types.ServiceLabel, serviceName, types.JobOwnerExecutionAnnotation, uidParsed)
 		}
 		listOpts := metav1.ListOptions{
@@ -89,6 +92,9 @@ func MakeJobsInfoHandler(back types.ServerlessBackend, kubeClientset kubernetes.
 			Continue:      page,
 		}
 		jobs := getJobs(kubeClientset, serviceNamespace, listOpts, c)
+		if jobs == nil {
+			return
+		}
 		var wg sync.WaitGroup
 		channelPod := make(chan PodListResult)
 
@@ -99,7 +105,7 @@ func MakeJobsInfoHandler(back types.ServerlessBackend, kubeClientset kubernetes.
 				getPod(
 					kubeClientset,
 					serviceNamespace,
-					jobs.Items[i].ObjectMeta.Name,
+					&job,
 					listOpts,
 					c,
 					channelPod,
@@ -115,11 +121,30 @@ func MakeJobsInfoHandler(back types.ServerlessBackend, kubeClientset kubernetes.
 		for podListResult := range channelPod {
 			jobsInfo[podListResult.Identity] = podListResult.Pods
 		}
+
+		// The archived jobs deleted from the cluster are listed with the first page
+		if page == "" {
+			archived, err := archivedJobsInfo(c.Request.Context(), cfg, serviceNamespace, serviceName, owner, jobsInfo)
+			if err != nil {
+				c.String(http.StatusInternalServerError, err.Error())
+				return
+			}
+			maps.Copy(jobsInfo, archived)
+		}
 		jr := types.JobsResponse{
 			Jobs:         jobsInfo,
 			NextPage:     jobs.ListMeta.Continue,
 			RemainingJob: jobs.ListMeta.RemainingItemCount,
 		}
+		if service.MaxConcurrentJobs > 0 {
+			queued, err := countQueuedJobs(c.Request.Context(), kubeClientset, serviceNamespace, serviceName)
+			if err != nil {
+				c.String(http.StatusInternalServerError, err.Error())
+				return
+			}
+			jr.MaxConcurrentJobs = service.MaxConcurrentJobs
+			jr.QueuedJobs = queued
+		}
 
 		c.JSON(http.StatusOK, jr)
 	}
@@ -139,11 +164,11 @@ func getJobs(kubeClientset kubernetes.Interface, serviceNamespace string, listOp
 	return jobs
 }
 
-func getPod(kubeClientset kubernetes.Interface, serviceNamespace string, jobName string, listOpts metav1.ListOptions, c *gin.Context, ch chan PodListResult) {
+func getPod(kubeClientset kubernetes.Interface, serviceNamespace string, job *batchv1.Job, listOpts metav1.ListOptions, c *gin.Context, ch chan PodListResult) {
 	if listOpts.LabelSelector != "" {
 		listOpts.LabelSelector += "," // separar con coma
 	}
-	listOpts.LabelSelector += fmt.Sprintf("job-name=%s", jobName)
+	listOpts.LabelSelector += fmt.Sprintf("job-name=%s", job.Name)
 	pods, err := kubeClientset.CoreV1().Pods(serviceNamespace).List(context.TODO(), listOpts)
 	if err != nil {
 		// Check if error is caused because the service is not found
@@ -155,29 +180,7 @@ func getPod(kubeClientset kubernetes.Interface, serviceNamespace string, jobName
 		return
 	}
 
-	if len(pods.Items) < 1 {
-		ch <- PodListResult{Pods: &types.JobInfo{
-			Status: string("Suspended"),
-		}, Identity: jobName}
-		return
-
-	}
-	podObject := pods.Items[0]
-	jobInfo := &types.JobInfo{
-		Status:       string(podObject.Status.Phase),
-		CreationTime: podObject.Status.StartTime,
-	}
-	for _, contStatus := range podObject.Status.ContainerStatuses {
-		if contStatus.Name == types.ContainerName {
-			if contStatus.State.Running != nil {
-				jobInfo.StartTime = &(contStatus.State.Running.StartedAt)
-			} else if contStatus.State.Terminated != nil {
-				jobInfo.StartTime = &(contStatus.State.Terminated.StartedAt)
-				jobInfo.FinishTime = &(contStatus.State.Terminated.FinishedAt)
-			}
-		}
-	}
-	ch <- PodListResult{Pods: jobInfo, Identity: jobName}
+	ch <- PodListResult{Pods: buildJobInfo(job, pods.Items), Identity: job.Name}
 }
 
 // MakeDeleteJobsHandler godoc
@@ -197,7 +200,7 @@ func MakeDeleteJobsHandler(back types.ServerlessBackend, kubeClientset kubernete
 	return func(c *gin.Context) {
 		// Get serviceName and jobName
 		serviceName := c.Param("serviceName")
-		service, ok := getAuthorizedService(c, back, serviceName)
+		service, ok := getAuthorizedService(c, back, serviceName, types.ServiceRoleInvoker)
 		if !ok {
 			return
 		}
@@ -218,6 +221,10 @@ func MakeDeleteJobsHandler(back types.ServerlessBackend, kubeClientset kubernete
 			// Only delete completed jobs
 			listOpts.FieldSelector = "status.successful!=0"
 		}
+		owner := jobOwnerScope(c, service)
+		if owner != "" {
+			listOpts.LabelSelector += fmt.Sprintf(",%s=%s", types.JobOwnerExecutionAnnotation, owner)
+		}
 
 		// Create DeleteOptions and configure PropagationPolicy for deleting associated pods in background
 		background := metav1.DeletePropagationBackground
@@ -236,18 +243,25 @@ func MakeDeleteJobsHandler(back types.ServerlessBackend, kubeClientset kubernete
 			return
 		}
 
+		// The archived jobs are deleted too, so they are not listed again
+		if err := deleteArchivedJobs(c.Request.Context(), cfg, serviceNamespace, serviceName, all, owner); err != nil {
+			c.String(http.StatusInternalServerError, fmt.Sprintf("Error deleting the archived jobs: %v", err))
+			return
+		}
+
 		c.Status(http.StatusNoContent)
 	}
 }
 
 // MakeGetLogsHandler godoc
 // @Summary Get job logs
-// @Description Stream logs of a specific job execution.
+// @Description Stream logs of a specific job execution. The logs of the jobs already deleted from the cluster are read from the job archive.
 // @Tags logs
 // @Produce plain
 // @Param serviceName path string true "Service name"
 // @Param jobName path string true "Job name"
 // @Param timestamps query bool false "Include timestamps"
+// @Param follow query bool false "Stream the logs until the job finishes, as Server-Sent Events if accepted by the client or as chunked text"
 // @Success 200 {string} string "Logs"
 // @Failure 401 {string} string "Unauthorized"
 // @Failure 404 {string} string "Not Found"
@@ -259,7 +273,7 @@ func MakeGetLogsHandler(back types.ServerlessBackend, kubeClientset kubernetes.I
 	return func(c *gin.Context) {
 		// Get serviceName and jobName
 		serviceName := c.Param("serviceName")
-		service, ok := getAuthorizedService(c, back, serviceName)
+		service, ok := getAuthorizedService(c, back, serviceName, types.ServiceRoleViewer)
 		if !ok {
 			return
 		}
@@ -271,12 +285,49 @@ func MakeGetLogsHandler(back types.ServerlessBackend, kubeClientset kubernetes.I
 			timestamps = false
 		}
 
+		if isFollowRequest(c) {
+			job, err := kubeClientset.BatchV1().Jobs(serviceNamespace).Get(c.Request.Context(), jobName, metav1.GetOptions{})
+			if err != nil && (errors.IsNotFound(err) || errors.IsGone(err)) {
+				// Finished jobs deleted from the cluster have no more logs to follow
+				serveArchivedLogs(c, cfg, serviceNamespace, serviceName, jobName, timestamps)
+				return
+			}
+			if err != nil || job.Labels[types.ServiceLabel] != serviceName {
+				if err != nil {
+					c.String(http.StatusInternalServerError, err.Error())
+				} else {
+					c.Status(http.StatusNotFound)
+				}
+				return
+			}
+			follower := &podLogFollower{
+				kubeClientset: kubeClientset,
+				namespace:     serviceNamespace,
+				timestamps:    timestamps,
+				listPods: func(ctx context.Context) ([]v1.Pod, error) {
+					return listJobPods(ctx, kubeClientset, serviceNamespace, serviceName, jobName)
+				},
+				containerName: jobContainerName,
+				finished: func(ctx context.Context) bool {
+					job, err := kubeClientset.BatchV1().Jobs(serviceNamespace).Get(ctx, jobName, metav1.GetOptions{})
+					return err != nil || types.JobStopped(job)
+				},
+			}
+			follower.follow(c)
+			return
+		}
+
 		// Get job's pod (assuming there's only one pod per job)
 		listOpts := metav1.ListOptions{
 			LabelSelector: fmt.Sprintf("%s=%s,job-name=%s", types.ServiceLabel, serviceName, jobName),
 		}
 		pods, err := kubeClientset.CoreV1().Pods(serviceNamespace).List(context.TODO(), listOpts)
-		if err != nil || len(pods.Items) < 1 {
+		if err == nil && len(pods.Items) < 1 {
+			// The pods of the finished jobs are deleted with them
+			serveArchivedLogs(c, cfg, serviceNamespace, serviceName, jobName, timestamps)
+			return
+		}
+		if err != nil {
 			// Check if error is caused because the service is not found
 			if !errors.IsNotFound(err) && !errors.IsGone(err) {
 				c.String(http.StatusInternalServerError, err.Error())
@@ -311,6 +362,20 @@ func MakeGetLogsHandler(back types.ServerlessBackend, kubeClientset kubernetes.I
 	}
 }
 
+// serveArchivedLogs replies with the logs of the job from the job archive, or 404 if not archived
+func serveArchivedLogs(c *gin.Context, cfg *types.Config, namespace string, serviceName string, jobName string, timestamps bool) {
+	logs, err := readArchivedLogs(c.Request.Context(), cfg, namespace, serviceName, jobName, timestamps)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			c.Status(http.StatusNotFound)
+		} else {
+			c.String(http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	c.String(http.StatusOK, logs)
+}
+
 // MakeGetLogsHandler godoc
 // @Summary Get job from logs
 // @Description Stream logs of a specific job execution.
@@ -436,7 +501,9 @@ type executionLogEntry struct {
 	Method    string `json:"method"`
 	Path      string `json:"path"`
 	User      string `json:"user"`
-	Raw       string `json:"raw"`
+	// CloudEvent attributes of the CloudEvent of the invocation, if any
+	CloudEvent map[string]string `json:"cloudevent,omitempty"`
+	Raw        string            `json:"raw"`
 }
 
 // parseExecutionLogs filters OSCAR execution log lines and structures them.
@@ -482,6 +549,10 @@ func parseExecutionLogs(raw string) []executionLogEntry {
 		entry.Method = methodPathFields[0]
 		entry.Path = methodPathFields[1]
 		entry.User = user
+		if len(parts) > 6 {
+			// The attribute values may contain the separator
+			entry.CloudEvent = parseCloudEventLog(strings.Join(parts[6:], "|"))
+		}
 
 		if entry.Method != "POST" {
 			continue
@@ -496,6 +567,28 @@ func parseExecutionLogs(raw string) []executionLogEntry {
 	return filtered
 }
 
+// parseCloudEventLog parses the quoted attributes of the CloudEvent appended to an execution log line
+func parseCloudEventLog(raw string) map[string]string {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(raw), "cloudevent")
+	if !ok {
+		return nil
+	}
+	attrs := map[string]string{}
+	for rest = strings.TrimSpace(rest); rest != ""; rest = strings.TrimSpace(rest) {
+		name, quoted, ok := strings.Cut(rest, "=")
+		if !ok {
+			break
+		}
+		prefix, err := strconv.QuotedPrefix(quoted)
+		if err != nil {
+			break
+		}
+		attrs[name], _ = strconv.Unquote(prefix)
+		rest = quoted[len(prefix):]
+	}
+	return attrs
+}
+
 // MakeDeleteJobHandler makes a handler for removing a job
 // MakeDeleteJobHandler godoc
 // @Summary Delete job
@@ -514,7 +607,7 @@ func MakeDeleteJobHandler(back types.ServerlessBackend, kubeClientset kubernetes
 	return func(c *gin.Context) {
 		// Get serviceName and jobName
 		serviceName := c.Param("serviceName")
-		service, ok := getAuthorizedService(c, back, serviceName)
+		service, ok := getAuthorizedService(c, back, serviceName, types.ServiceRoleInvoker)
 		if !ok {
 			c.String(http.StatusForbidden, "You do not have permission to access this service")
 			return
@@ -528,7 +621,18 @@ func MakeDeleteJobHandler(back types.ServerlessBackend, kubeClientset kubernetes
 			// Check if error is caused because the service is not found
 			if !errors.IsNotFound(err) && !errors.IsGone(err) {
 				c.String(http.StatusInternalServerError, err.Error())
-			} else {
+				return
+			}
+			// The jobs already deleted from the cluster may be still archived
+			archived, err := deleteArchivedJob(c.Request.Context(), cfg, serviceNamespace, serviceName, jobName, jobOwnerScope(c, service))
+			switch {
+			case err == errJobNotOwned:
+				c.String(http.StatusForbidden, err.Error())
+			case err != nil:
+				c.String(http.StatusInternalServerError, fmt.Sprintf("Error deleting the archived job: %v", err))
+			case archived:
+				c.Status(http.StatusNoContent)
+			default:
 				c.Status(http.StatusNotFound)
 			}
 			return
@@ -539,6 +643,10 @@ func MakeDeleteJobHandler(back types.ServerlessBackend, kubeClientset kubernetes
 			c.Status(http.StatusNotFound)
 			return
 		}
+		if !canManageJob(c, service, job.Labels[types.JobOwnerExecutionAnnotation]) {
+			c.String(http.StatusForbidden, errJobNotOwned.Error())
+			return
+		}
 
 		// Create DeleteOptions and configure PropagationPolicy for deleting associated pods in background
 		background := metav1.DeletePropagationBackground
@@ -558,11 +666,17 @@ func MakeDeleteJobHandler(back types.ServerlessBackend, kubeClientset kubernetes
 			return
 		}
 
+		if _, err := deleteArchivedJob(c.Request.Context(), cfg, serviceNamespace, serviceName, jobName, ""); err != nil {
+			c.String(http.StatusInternalServerError, fmt.Sprintf("Error deleting the archived job: %v", err))
+			return
+		}
+
 		c.Status(http.StatusNoContent)
 	}
 }
 
-func getAuthorizedService(c *gin.Context, back types.ServerlessBackend, serviceName string) (*types.Service, bool) {
+// getAuthorizedService returns the service if the request has, at least, the role on it, setting the error status otherwise
+func getAuthorizedService(c *gin.Context, back types.ServerlessBackend, serviceName string, role string) (*types.Service, bool) {
 	service, err := back.ReadService("", serviceName)
 	if err != nil {
 		if errors.IsNotFound(err) || errors.IsGone(err) {
@@ -573,43 +687,50 @@ func getAuthorizedService(c *gin.Context, back types.ServerlessBackend, serviceN
 		return nil, false
 	}
 
-	if !authorizeRequest(c, service) {
+	if !authorizeRequest(c, service, role) {
+		c.Status(http.StatusForbidden)
 		return nil, false
 	}
 
 	return service, true
 }
 
-func authorizeRequest(c *gin.Context, service *types.Service) bool {
+// authorizeRequest checks the role of the OIDC user on the service. Requests authenticated
+// with the service token or as the cluster administrator are always authorized
+func authorizeRequest(c *gin.Context, service *types.Service, role string) bool {
+	// The service token has already been checked against the requested service with the scope of the path
+	if auth.IsServiceTokenRequest(c) {
+		return service.Name == c.Param("serviceName")
+	}
 	authHeader := c.GetHeader("Authorization")
 	if len(strings.Split(authHeader, "Bearer")) > 1 {
-		uid, err := auth.GetUIDFromContext(c)
-		if err != nil {
-			//c.String(http.StatusInternalServerError, fmt.Sprintln(err))
-			return false
-		}
-		if service.Visibility == utils.PUBLIC {
-			return true
-		}
+		return auth.HasServiceRole(c, service, role)
+	}
+	return true
+}
 
-		if uid == service.Owner {
-			return true
-		}
+// errJobNotOwned error returned when the user can only manage the jobs they submitted
+var errJobNotOwned = fmt.Errorf("only the jobs submitted by the user can be managed with the role on the service")
 
-		if service.Visibility == utils.RESTRICTED && len(service.AllowedUsers) > 0 {
-			for _, id := range service.AllowedUsers {
-				if uid == id {
-					return true
-				}
-			}
-		}
-		return false
-		/*if !isAllowed {
-			c.String(http.StatusForbidden, "User %s doesn't have permision to get this service", uid)
-			return false
-		}*/
+// jobOwnerScope returns the owner label of the jobs of the service the request can manage, or an empty string
+// if it can manage all of them: editors of the service, the service token and the cluster administrator.
+// The rest of the users can only manage the jobs they submitted
+func jobOwnerScope(c *gin.Context, service *types.Service) string {
+	if !isBearerRequest(c) || auth.IsServiceTokenRequest(c) || auth.HasServiceRole(c, service, types.ServiceRoleEditor) {
+		return ""
 	}
-	return true
+	uid, _ := auth.GetUIDFromContext(c)
+	owner := auth.FormatUID(uid)
+	if len(owner) > 62 {
+		owner = owner[:62]
+	}
+	return owner
+}
+
+// canManageJob returns true if the request can cancel, suspend, resume, rerun or delete the job of the service
+func canManageJob(c *gin.Context, service *types.Service, jobOwner string) bool {
+	owner := jobOwnerScope(c, service)
+	return owner == "" || owner == jobOwner
 }
 
 func resolveServiceNamespace(service *types.Service, cfg *types.Config) string {
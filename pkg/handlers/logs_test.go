@@ -390,3 +390,16 @@ func TestParseExecutionLogs(t *testing.T) {
 		t.Fatalf("unexpected second entry: %+v", second)
 	}
 }
+
+func TestParseExecutionLogsCloudEvent(t *testing.T) {
+	raw := `[GIN-EXECUTIONS-LOGGER] 2025-10-28T16:55:12Z | 201 |   14.219292ms | 127.0.0.1 | POST    /job/simple-test | oscar | cloudevent id="1" source="/brokers/default" subject="a | b" type="dev.knative.example"`
+
+	entries := parseExecutionLogs(raw)
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(entries))
+	}
+	expected := map[string]string{"id": "1", "source": "/brokers/default", "subject": "a | b", "type": "dev.knative.example"}
+	if entries[0].User != "oscar" || !reflect.DeepEqual(entries[0].CloudEvent, expected) {
+		t.Fatalf("unexpected entry: %+v", entries[0])
+	}
+}
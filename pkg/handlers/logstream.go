@@ -0,0 +1,261 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/grycap/oscar/v4/pkg/types"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// maxLogLineSize maximum size of a streamed log line
+	maxLogLineSize = 1024 * 1024
+	// sseContentType content type of the Server-Sent Events responses
+	sseContentType = "text/event-stream"
+)
+
+// logFollowInterval interval between checks for new pods while following logs, replaceable in tests
+var logFollowInterval = 2 * time.Second
+
+var logStreamLogger = log.New(os.Stdout, "[LOG-STREAM] ", log.Flags())
+
+// followedLogLine log line sent as data of the Server-Sent Events
+type followedLogLine struct {
+	Pod  string `json:"pod"`
+	Line string `json:"line"`
+}
+
+// podLogFollower streams the logs of the pods of a job or a deployment, switching to the newest pod
+// when the current one is replaced or its container restarts
+type podLogFollower struct {
+	kubeClientset kubernetes.Interface
+	namespace     string
+	timestamps    bool
+	// tailLines number of lines streamed from the first pod (all if nil)
+	tailLines *int64
+	// listPods returns the candidate pods
+	listPods func(ctx context.Context) ([]v1.Pod, error)
+	// containerName returns the container whose logs are streamed
+	containerName func(pod v1.Pod) string
+	// finished returns true when no more logs are expected
+	finished func(ctx context.Context) bool
+}
+
+// isFollowRequest returns true if the request asks to stream the logs
+func isFollowRequest(c *gin.Context) bool {
+	follow, err := strconv.ParseBool(c.DefaultQuery("follow", "false"))
+	return err == nil && follow
+}
+
+// follow streams the logs until no more logs are expected or the client disconnects.
+// Lines are sent as Server-Sent Events if the client accepts them or as chunked plain text otherwise.
+func (f *podLogFollower) follow(c *gin.Context) {
+	ctx := c.Request.Context()
+	sse := strings.Contains(c.GetHeader("Accept"), sseContentType)
+
+	// Long-running streams must not be cut by the server write timeout
+	_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+	if sse {
+		c.Header("Content-Type", sseContentType)
+	} else {
+		c.Header("Content-Type", "text/plain; charset=utf-8")
+	}
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.WriteHeaderNow()
+	c.Writer.Flush()
+
+	current := ""
+	restarts := int32(-1)
+	tailLines := f.tailLines
+	// since time of the last line streamed from the current pod
+	var since time.Time
+	for {
+		pods, err := f.listPods(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				f.writeEvent(c, sse, "error", err.Error())
+			}
+			return
+		}
+		pod, ok := f.newestStartedPod(pods)
+		if ok {
+			podRestarts := containerRestarts(pod, f.containerName(pod))
+			if pod.Name != current || podRestarts > restarts {
+				current, restarts = pod.Name, podRestarts
+				f.writeEvent(c, sse, "pod", pod.Name)
+				since = f.streamPodLogs(ctx, c, sse, pod, tailLines, time.Time{})
+				tailLines = nil
+				continue
+			}
+		}
+		if f.finished(ctx) {
+			f.writeEvent(c, sse, "end", "")
+			return
+		}
+		// The stream can end while the container is still running (API timeouts, log rotation),
+		// so it is reopened from the last line received
+		if ok && containerRunning(pod, f.containerName(pod)) {
+			since = f.streamPodLogs(ctx, c, sse, pod, nil, since)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(logFollowInterval):
+		}
+	}
+}
+
+// streamPodLogs streams the logs of a pod written after since, logging the errors, and returns the
+// time of the last line received, or the time the stream was opened if no line was received
+func (f *podLogFollower) streamPodLogs(ctx context.Context, c *gin.Context, sse bool, pod v1.Pod, tailLines *int64, since time.Time) time.Time {
+	opened := time.Now()
+	last, err := f.streamPod(ctx, c, sse, pod, tailLines, since)
+	if err != nil && ctx.Err() == nil {
+		logStreamLogger.Printf("error streaming logs of pod \"%s\": %v", pod.Name, err)
+	}
+	if last.IsZero() {
+		return opened
+	}
+	return last
+}
+
+// streamPod streams the logs of a pod written after since (all if zero) until its container finishes,
+// the stream ends or the client disconnects, and returns the time of the last line sent.
+// The logs are always requested with timestamps, as SinceTime only has a precision of seconds,
+// and the timestamps are removed from the lines if not requested by the client.
+func (f *podLogFollower) streamPod(ctx context.Context, c *gin.Context, sse bool, pod v1.Pod, tailLines *int64, since time.Time) (time.Time, error) {
+	podLogOpts := &v1.PodLogOptions{
+		Container:  f.containerName(pod),
+		Follow:     true,
+		Timestamps: true,
+		TailLines:  tailLines,
+	}
+	if !since.IsZero() {
+		podLogOpts.SinceTime = &metav1.Time{Time: since}
+	}
+	stream, err := f.kubeClientset.CoreV1().Pods(f.namespace).GetLogs(pod.Name, podLogOpts).Stream(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer stream.Close()
+
+	var last time.Time
+	scanner := bufio.NewScanner(stream)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLogLineSize)
+	for scanner.Scan() {
+		line := scanner.Text()
+		timestamp, text, _ := strings.Cut(line, " ")
+		lineTime, err := time.Parse(time.RFC3339Nano, timestamp)
+		if err != nil {
+			text = line
+		}
+		// Lines already sent before the stream was reopened, or whose time is unknown
+		if !since.IsZero() && !lineTime.After(since) {
+			continue
+		}
+		if err == nil {
+			last = lineTime
+		}
+		if f.timestamps {
+			text = line
+		}
+		if sse {
+			c.SSEvent("log", followedLogLine{Pod: pod.Name, Line: text})
+		} else {
+			fmt.Fprintln(c.Writer, text)
+		}
+		c.Writer.Flush()
+	}
+	return last, scanner.Err()
+}
+
+// writeEvent sends a control event. Only the errors are written in plain text streams.
+func (f *podLogFollower) writeEvent(c *gin.Context, sse bool, event string, data string) {
+	switch {
+	case sse:
+		c.SSEvent(event, data)
+	case event == "error":
+		fmt.Fprintf(c.Writer, "error: %s\n", data)
+	default:
+		return
+	}
+	c.Writer.Flush()
+}
+
+// newestStartedPod returns the most recent pod whose container has started
+func (f *podLogFollower) newestStartedPod(pods []v1.Pod) (v1.Pod, bool) {
+	var newest v1.Pod
+	found := false
+	for _, pod := range pods {
+		if !containerStarted(pod, f.containerName(pod)) {
+			continue
+		}
+		if !found || pod.CreationTimestamp.After(newest.CreationTimestamp.Time) {
+			newest = pod
+			found = true
+		}
+	}
+	return newest, found
+}
+
+func containerStarted(pod v1.Pod, containerName string) bool {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name == containerName {
+			return status.State.Running != nil || status.State.Terminated != nil
+		}
+	}
+	return false
+}
+
+func containerRunning(pod v1.Pod, containerName string) bool {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name == containerName {
+			return status.State.Running != nil
+		}
+	}
+	return false
+}
+
+func containerRestarts(pod v1.Pod, containerName string) int32 {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name == containerName {
+			return status.RestartCount
+		}
+	}
+	return 0
+}
+
+// jobContainerName returns the container of the service in the job pods
+func jobContainerName(v1.Pod) string {
+	return types.ContainerName
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/grycap/oscar/v4/pkg/backends"
+	"github.com/grycap/oscar/v4/pkg/types"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	testclient "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"knative.dev/serving/pkg/apis/serving"
+	knv1 "knative.dev/serving/pkg/apis/serving/v1"
+)
+
+func runningPod(name string, created time.Time, restarts int32, labels map[string]string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ns", Labels: labels, CreationTimestamp: metav1.NewTime(created)},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodRunning,
+			ContainerStatuses: []corev1.ContainerStatus{{
+				Name:         types.ContainerName,
+				RestartCount: restarts,
+				State:        corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+			}},
+		},
+	}
+}
+
+func TestMakeGetLogsHandlerFollow(t *testing.T) {
+	back := backends.MakeFakeBackend()
+	back.Service = &types.Service{Name: "test", Namespace: "ns"}
+	kubeClientset := testclient.NewSimpleClientset(
+		&batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: "job", Namespace: "ns", Labels: map[string]string{types.ServiceLabel: "test"}},
+			Status: batchv1.JobStatus{
+				Conditions: []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}},
+			},
+		},
+		runningPod("job-pod", time.Now(), 0, map[string]string{types.ServiceLabel: "test", "job-name": "job"}),
+	)
+	logFollowInterval = 10 * time.Millisecond
+
+	r := gin.New()
+	r.GET("/system/logs/:serviceName/:jobName", MakeGetLogsHandler(back, kubeClientset, &types.Config{}))
+
+	// Chunked plain text
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/system/logs/test/job?follow=true", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w.Body.String() != "fake logs\n" {
+		t.Errorf("unexpected logs %q", w.Body.String())
+	}
+
+	// Server-Sent Events
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/system/logs/test/job?follow=true", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	r.ServeHTTP(w, req)
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream") {
+		t.Errorf("unexpected content type %s", w.Header().Get("Content-Type"))
+	}
+	body := w.Body.String()
+	for _, expected := range []string{"event:pod\ndata:job-pod", "event:log\ndata:{\"pod\":\"job-pod\",\"line\":\"fake logs\"}", "event:end"} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("expected %q in %q", expected, body)
+		}
+	}
+
+	// Jobs of other services are not found
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/system/logs/test/other?follow=true", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", w.Code)
+	}
+}
+
+func TestPodLogFollowerSwitchesPods(t *testing.T) {
+	now := time.Now()
+	first := runningPod("first", now, 0, nil)
+	restarted := runningPod("first", now, 1, nil)
+	second := runningPod("second", now.Add(time.Minute), 0, nil)
+	pending := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "third", Namespace: "ns", CreationTimestamp: metav1.NewTime(now.Add(2 * time.Minute))}}
+
+	// Each call returns the next state of the pods
+	states := [][]corev1.Pod{{*first}, {*first}, {*restarted}, {*restarted, *second, *pending}}
+	calls := 0
+	logFollowInterval = time.Millisecond
+	follower := &podLogFollower{
+		kubeClientset: testclient.NewSimpleClientset(),
+		namespace:     "ns",
+		listPods: func(context.Context) ([]corev1.Pod, error) {
+			state := states[min(calls, len(states)-1)]
+			calls++
+			return state, nil
+		},
+		containerName: jobContainerName,
+		finished:      func(context.Context) bool { return calls >= len(states) },
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	c.Request.Header.Set("Accept", "text/event-stream")
+	follower.follow(c)
+
+	body := w.Body.String()
+	if strings.Count(body, "event:pod\ndata:first") != 2 || strings.Count(body, "event:pod\ndata:second") != 1 || strings.Contains(body, "data:third") {
+		t.Errorf("unexpected stream %q", body)
+	}
+	if !strings.HasSuffix(strings.TrimSpace(body), "event:end\ndata:") {
+		t.Errorf("expected end event in %q", body)
+	}
+}
+
+func TestPodLogFollowerReopensStream(t *testing.T) {
+	pod := runningPod("pod", time.Now(), 0, nil)
+	tailLines := int64(10)
+	kubeClientset := testclient.NewSimpleClientset()
+	calls := 0
+	logFollowInterval = time.Millisecond
+	follower := &podLogFollower{
+		kubeClientset: kubeClientset,
+		namespace:     "ns",
+		tailLines:     &tailLines,
+		listPods: func(context.Context) ([]corev1.Pod, error) {
+			calls++
+			return []corev1.Pod{*pod}, nil
+		},
+		containerName: jobContainerName,
+		finished:      func(context.Context) bool { return calls >= 3 },
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	follower.follow(c)
+
+	// The stream of the running container is reopened from the last line, without repeating it
+	if w.Body.String() != "fake logs\n" {
+		t.Errorf("unexpected logs %q", w.Body.String())
+	}
+	var opts []*corev1.PodLogOptions
+	for _, action := range kubeClientset.Actions() {
+		if action.GetSubresource() == "log" {
+			opts = append(opts, action.(k8stesting.GenericAction).GetValue().(*corev1.PodLogOptions))
+		}
+	}
+	if len(opts) != 2 {
+		t.Fatalf("expected the stream to be opened twice, got %d", len(opts))
+	}
+	if opts[0].SinceTime != nil || opts[0].TailLines == nil || !opts[0].Timestamps {
+		t.Errorf("unexpected options of the first stream %+v", opts[0])
+	}
+	if opts[1].SinceTime == nil || opts[1].TailLines != nil {
+		t.Errorf("unexpected options of the reopened stream %+v", opts[1])
+	}
+}
+
+func TestMakeGetDeploymentLogsHandlerFollow(t *testing.T) {
+	back := &fakeRuntimeServiceBackend{
+		FakeBackend:    backends.MakeFakeBackend(),
+		runtimeService: &knv1.Service{ObjectMeta: metav1.ObjectMeta{Name: "svc", Namespace: "ns"}},
+	}
+	back.Service = &types.Service{Name: "svc", Namespace: "ns"}
+	kubeClientset := testclient.NewSimpleClientset(runningPod("svc-pod", time.Now(), 0, map[string]string{serving.ServiceLabelKey: "svc"}))
+	logFollowInterval = 10 * time.Millisecond
+
+	r := gin.New()
+	r.GET("/system/services/:serviceName/deployment/logs", MakeGetDeploymentLogsHandler(back, kubeClientset, &types.Config{}))
+
+	// Deployments are followed until the client disconnects
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/system/services/svc/deployment/logs?follow=true", nil).WithContext(ctx))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w.Body.String() != "fake logs\n" {
+		t.Errorf("unexpected logs %q", w.Body.String())
+	}
+}
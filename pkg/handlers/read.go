@@ -20,13 +20,11 @@ import (
 	"context"
 	"fmt"
 	"net/http"
-	"slices"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/grycap/oscar/v4/pkg/backends/resources"
 	"github.com/grycap/oscar/v4/pkg/types"
-	"github.com/grycap/oscar/v4/pkg/utils"
 	"github.com/grycap/oscar/v4/pkg/utils/auth"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/client-go/kubernetes"
@@ -87,23 +85,9 @@ func MakeReadHandler(back types.ServerlessBackend, kubeClientset kubernetes.Inte
 				}
 			}*/
 
-			switch service.Visibility {
-			case utils.PUBLIC:
+			if isServiceAccessibleByUser(service, uid, auth.GetUserGroupsFromContext(c)) {
 				c.JSON(http.StatusOK, service)
 				return
-			case utils.PRIVATE:
-				if service.Owner == uid {
-					c.JSON(http.StatusOK, service)
-					return
-				}
-			case utils.RESTRICTED:
-				if service.Owner == uid || slices.Contains(service.AllowedUsers, uid) {
-					c.JSON(http.StatusOK, service)
-					return
-				}
-			default:
-				c.String(http.StatusForbidden, "User %s doesn't have permision to get this service", uid)
-				return
 			}
 			c.String(http.StatusForbidden, "User %s doesn't have permision to get this service", uid)
 			return
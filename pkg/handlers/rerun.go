@@ -0,0 +1,224 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/grycap/oscar/v4/pkg/resourcemanager"
+	"github.com/grycap/oscar/v4/pkg/types"
+	"github.com/grycap/oscar/v4/pkg/utils"
+	"github.com/grycap/oscar/v4/pkg/utils/auth"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// errNoJobEvent error of the jobs created without an event
+var errNoJobEvent = fmt.Errorf("the job has no event")
+
+// MakeRerunJobHandler godoc
+// @Summary Rerun a job
+// @Description Submit again the event of a job, read from its definition or its stored event, as a new job of the service. The CPU, memory and environment variables of the service can be overridden for the new job, which is annotated with the name of the original one.
+// @Tags logs
+// @Accept json
+// @Produce json
+// @Param serviceName path string true "Service name"
+// @Param jobName path string true "Job name"
+// @Param overrides body types.JobRerunRequest false "Overrides of the service definition"
+// @Success 201 {object} types.JobHandle
+// @Failure 400 {string} string "Bad Request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Not Found"
+// @Failure 410 {string} string "Gone"
+// @Failure 500 {string} string "Internal Server Error"
+// @Security BasicAuth
+// @Security BearerAuth
+// @Router /system/logs/{serviceName}/{jobName}/rerun [post]
+func MakeRerunJobHandler(cfg *types.Config, kubeClientset kubernetes.Interface, back types.ServerlessBackend, rm resourcemanager.ResourceManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		serviceName := c.Param("serviceName")
+		service, ok := getAuthorizedService(c, back, serviceName, types.ServiceRoleInvoker)
+		if !ok {
+			if !c.Writer.Written() {
+				c.Status(http.StatusForbidden)
+			}
+			return
+		}
+		var uid string
+		if isBearerRequest(c) {
+			var err error
+			if uid, err = auth.GetUIDFromContext(c); err != nil {
+				c.String(http.StatusUnauthorized, err.Error())
+				return
+			}
+		}
+
+		var overrides types.JobRerunRequest
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		if len(bytes.TrimSpace(body)) > 0 {
+			if err := json.Unmarshal(body, &overrides); err != nil {
+				c.String(http.StatusBadRequest, fmt.Sprintf("The overrides are not valid: %v", err))
+				return
+			}
+		}
+		for _, quantity := range []string{overrides.CPU, overrides.Memory} {
+			if quantity == "" {
+				continue
+			}
+			if _, err := resource.ParseQuantity(quantity); err != nil {
+				c.String(http.StatusBadRequest, fmt.Sprintf("invalid resource quantity \"%s\": %v", quantity, err))
+				return
+			}
+		}
+
+		namespace := resolveServiceNamespace(service, cfg)
+		jobName := c.Param("jobName")
+		job, err := kubeClientset.BatchV1().Jobs(namespace).Get(c.Request.Context(), jobName, metav1.GetOptions{})
+		if err != nil {
+			if errors.IsNotFound(err) || errors.IsGone(err) {
+				c.Status(http.StatusNotFound)
+			} else {
+				c.String(http.StatusInternalServerError, err.Error())
+			}
+			return
+		}
+		if job.Labels[types.ServiceLabel] != serviceName {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		if !canManageJob(c, service, job.Labels[types.JobOwnerExecutionAnnotation]) {
+			c.String(http.StatusForbidden, errJobNotOwned.Error())
+			return
+		}
+
+		eventBytes, err := originalJobEvent(c.Request.Context(), cfg, kubeClientset, job)
+		if err != nil {
+			if err == utils.ErrJobEventNotFound || err == errNoJobEvent {
+				c.String(http.StatusGone, err.Error())
+			} else {
+				c.String(http.StatusInternalServerError, err.Error())
+			}
+			return
+		}
+		c.Set("eventBytes", eventBytes)
+
+		rerunService := overriddenService(service, overrides)
+		podSpec, _, err := getPodSpecNamespace(rerunService, cfg)
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		// Keep the attributes of the original CloudEvent
+		podSpec.Containers[0].Env = append(podSpec.Containers[0].Env, jobCloudEventVars(job)...)
+
+		invocation := newJobInvocation(cfg, kubeClientset, back, rm, rerunService, podSpec, namespace)
+		invocation.authHeader = c.GetHeader("Authorization")
+		invocation.uidFromToken = uid
+		invocation.annotations = map[string]string{types.RerunOfAnnotation: jobName}
+
+		submission := invocation.submit(c.Request.Context(), eventBytes, nil, "")
+		c.Set("uidOrigin", submission.uidOrigin)
+		if submission.ipAddress != "" {
+			c.Set("IPAddress", submission.ipAddress)
+		}
+		if submission.err != nil {
+			c.String(submission.status, submission.err.Error())
+			return
+		}
+		c.JSON(submission.status, submission.handle)
+	}
+}
+
+// originalJobEvent returns the event submitted to create a job, read from its EVENT variable or its stored event
+func originalJobEvent(ctx context.Context, cfg *types.Config, kubeClientset kubernetes.Interface, job *batchv1.Job) ([]byte, error) {
+	for _, c := range job.Spec.Template.Spec.Containers {
+		if c.Name != types.ContainerName {
+			continue
+		}
+		for _, env := range c.Env {
+			switch env.Name {
+			case types.EventVariable:
+				// The events of the InterLink jobs are base64 encoded
+				if slices.ContainsFunc(c.Args, func(arg string) bool { return strings.Contains(arg, "base64 -d") }) {
+					return base64.StdEncoding.DecodeString(env.Value)
+				}
+				return []byte(env.Value), nil
+			case types.EventRefVariable:
+				ref, err := utils.ParseEventReference(env.Value)
+				if err != nil {
+					return nil, err
+				}
+				return utils.ReadJobEvent(ctx, cfg, kubeClientset, job.Namespace, *ref)
+			}
+		}
+	}
+	return nil, errNoJobEvent
+}
+
+// overriddenService returns a copy of the service with the overrides of a rerun applied
+func overriddenService(service *types.Service, overrides types.JobRerunRequest) *types.Service {
+	rerunService := *service
+	if overrides.CPU != "" {
+		rerunService.CPU = overrides.CPU
+	}
+	if overrides.Memory != "" {
+		rerunService.Memory = overrides.Memory
+	}
+	if len(overrides.Environment) > 0 {
+		rerunService.Environment.Vars = maps.Clone(service.Environment.Vars)
+		if rerunService.Environment.Vars == nil {
+			rerunService.Environment.Vars = map[string]string{}
+		}
+		maps.Copy(rerunService.Environment.Vars, overrides.Environment)
+	}
+	return &rerunService
+}
+
+// jobCloudEventVars returns the variables with the CloudEvent attributes of a job
+func jobCloudEventVars(job *batchv1.Job) []v1.EnvVar {
+	var envVars []v1.EnvVar
+	for _, c := range job.Spec.Template.Spec.Containers {
+		if c.Name != types.ContainerName {
+			continue
+		}
+		for _, env := range c.Env {
+			if strings.HasPrefix(env.Name, types.CloudEventEnvPrefix) {
+				envVars = append(envVars, env)
+			}
+		}
+	}
+	return envVars
+}
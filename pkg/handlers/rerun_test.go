@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/grycap/oscar/v4/pkg/backends"
+	"github.com/grycap/oscar/v4/pkg/types"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	testclient "k8s.io/client-go/kubernetes/fake"
+)
+
+func containerEnv(job *batchv1.Job) map[string]string {
+	env := map[string]string{}
+	for _, envVar := range job.Spec.Template.Spec.Containers[0].Env {
+		env[envVar.Name] = envVar.Value
+	}
+	return env
+}
+
+func TestMakeRerunJobHandler(t *testing.T) {
+	back := backends.MakeFakeBackend()
+	back.Service = &types.Service{Name: "testName", Namespace: "oscar-svc", CPU: "100m", Memory: "128Mi"}
+	back.Service.Environment.Vars = map[string]string{"MODE": "default", "LEVEL": "info"}
+	cfg := types.Config{ServicesNamespace: "oscar-svc"}
+	kubeClient := testclient.NewSimpleClientset(&batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "original", Namespace: "oscar-svc", Labels: map[string]string{types.ServiceLabel: "testName"}},
+		Spec: batchv1.JobSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name: types.ContainerName,
+						Env: []corev1.EnvVar{
+							{Name: types.EventVariable, Value: `{"key":"value"}`},
+							{Name: types.CloudEventEnvPrefix + "TYPE", Value: "org.example.upload"},
+						},
+					}},
+				},
+			},
+		},
+	})
+	r := gin.Default()
+	r.POST("/system/logs/:serviceName/:jobName/rerun", MakeRerunJobHandler(&cfg, kubeClient, back, nil))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/system/logs/testName/original/rerun", strings.NewReader(""))
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expecting code %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var handle types.JobHandle
+	if err := json.Unmarshal(w.Body.Bytes(), &handle); err != nil {
+		t.Fatalf("invalid job handle: %v", err)
+	}
+	job, err := kubeClient.BatchV1().Jobs("oscar-svc").Get(context.TODO(), handle.JobName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected the new job: %v", err)
+	}
+	env := containerEnv(job)
+	if env[types.EventVariable] != `{"key":"value"}` || env[types.CloudEventEnvPrefix+"TYPE"] != "org.example.upload" {
+		t.Errorf("expected the event of the original job, got %v", env)
+	}
+	if job.Annotations[types.RerunOfAnnotation] != "original" {
+		t.Errorf("expected the job to be linked to the original one, got %v", job.Annotations)
+	}
+	if info := buildJobInfo(job, nil); info.RerunOf != "original" {
+		t.Errorf("expected the original job in the job info, got %+v", info)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/system/logs/testName/original/rerun", strings.NewReader(`{"cpu":"2","memory":"1Gi","environment":{"MODE":"debug"}}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expecting code %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &handle); err != nil {
+		t.Fatalf("invalid job handle: %v", err)
+	}
+	job, err = kubeClient.BatchV1().Jobs("oscar-svc").Get(context.TODO(), handle.JobName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected the new job: %v", err)
+	}
+	env = containerEnv(job)
+	if env["MODE"] != "debug" || env["LEVEL"] != "info" {
+		t.Errorf("expected the overridden environment, got %v", env)
+	}
+	limits := job.Spec.Template.Spec.Containers[0].Resources.Limits
+	if !limits.Cpu().Equal(resource.MustParse("2")) || !limits.Memory().Equal(resource.MustParse("1Gi")) {
+		t.Errorf("expected the overridden resources, got %v", limits)
+	}
+}
+
+func TestMakeRerunJobHandlerInterLinkEvent(t *testing.T) {
+	back := backends.MakeFakeBackend()
+	back.Service = &types.Service{Name: "testName", Namespace: "oscar-svc", CPU: "100m", Memory: "128Mi"}
+	cfg := types.Config{ServicesNamespace: "oscar-svc"}
+	kubeClient := testclient.NewSimpleClientset(&batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "original", Namespace: "oscar-svc", Labels: map[string]string{types.ServiceLabel: "testName"}},
+		Spec: batchv1.JobSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name: types.ContainerName,
+						Env:  []corev1.EnvVar{{Name: types.EventVariable, Value: base64.StdEncoding.EncodeToString([]byte("raw event"))}},
+						Args: types.OscarContainerCommand,
+					}},
+				},
+			},
+		},
+	})
+	r := gin.Default()
+	r.POST("/system/logs/:serviceName/:jobName/rerun", MakeRerunJobHandler(&cfg, kubeClient, back, nil))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/system/logs/testName/original/rerun", strings.NewReader(""))
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expecting code %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var handle types.JobHandle
+	if err := json.Unmarshal(w.Body.Bytes(), &handle); err != nil {
+		t.Fatalf("invalid job handle: %v", err)
+	}
+	job, err := kubeClient.BatchV1().Jobs("oscar-svc").Get(context.TODO(), handle.JobName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected the new job: %v", err)
+	}
+	if env := containerEnv(job); env[types.EventVariable] != "raw event" {
+		t.Errorf("expected the decoded event of the original job, got %v", env)
+	}
+}
+
+func TestMakeRerunJobHandlerStoredEvent(t *testing.T) {
+	back := backends.MakeFakeBackend()
+	back.Service = &types.Service{Name: "testName", Namespace: "oscar-svc", CPU: "100m", Memory: "128Mi"}
+	cfg := types.Config{ServicesNamespace: "oscar-svc"}
+	kubeClient := testclient.NewSimpleClientset(
+		&batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: "stored", Namespace: "oscar-svc", Labels: map[string]string{types.ServiceLabel: "testName"}},
+			Spec: batchv1.JobSpec{
+				Template: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{{
+							Name: types.ContainerName,
+							Env:  []corev1.EnvVar{{Name: types.EventRefVariable, Value: "secret:stored-event"}},
+						}},
+					},
+				},
+			},
+		},
+		&batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: "deleted", Namespace: "oscar-svc", Labels: map[string]string{types.ServiceLabel: "testName"}},
+			Spec: batchv1.JobSpec{
+				Template: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{{
+							Name: types.ContainerName,
+							Env:  []corev1.EnvVar{{Name: types.EventRefVariable, Value: "secret:deleted-event"}},
+						}},
+					},
+				},
+			},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "stored-event", Namespace: "oscar-svc"},
+			Data:       map[string][]byte{types.EventFileName: []byte("stored event")},
+		},
+	)
+	r := gin.Default()
+	r.POST("/system/logs/:serviceName/:jobName/rerun", MakeRerunJobHandler(&cfg, kubeClient, back, nil))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/system/logs/testName/stored/rerun", strings.NewReader(""))
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expecting code %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var handle types.JobHandle
+	if err := json.Unmarshal(w.Body.Bytes(), &handle); err != nil {
+		t.Fatalf("invalid job handle: %v", err)
+	}
+	job, err := kubeClient.BatchV1().Jobs("oscar-svc").Get(context.TODO(), handle.JobName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected the new job: %v", err)
+	}
+	if env := containerEnv(job); env[types.EventVariable] != "stored event" {
+		t.Errorf("expected the stored event of the original job, got %v", env)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/system/logs/testName/deleted/rerun", strings.NewReader(""))
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusGone {
+		t.Errorf("expecting code %d for a deleted event, got %d: %s", http.StatusGone, w.Code, w.Body.String())
+	}
+}
+
+func TestMakeRerunJobHandlerInvalidRequests(t *testing.T) {
+	back := backends.MakeFakeBackend()
+	back.Service = &types.Service{Name: "testName", Namespace: "oscar-svc", CPU: "100m", Memory: "128Mi"}
+	cfg := types.Config{ServicesNamespace: "oscar-svc"}
+	kubeClient := testclient.NewSimpleClientset(
+		&batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: "original", Namespace: "oscar-svc", Labels: map[string]string{types.ServiceLabel: "testName"}},
+			Spec: batchv1.JobSpec{
+				Template: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{{
+							Name: types.ContainerName,
+							Env:  []corev1.EnvVar{{Name: types.EventVariable, Value: "event"}},
+						}},
+					},
+				},
+			},
+		},
+		&batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "oscar-svc", Labels: map[string]string{types.ServiceLabel: "otherService"}},
+		},
+	)
+	r := gin.Default()
+	r.POST("/system/logs/:serviceName/:jobName/rerun", MakeRerunJobHandler(&cfg, kubeClient, back, nil))
+
+	tests := []struct {
+		name string
+		job  string
+		body string
+		code int
+	}{
+		{"invalid json", "original", `{`, http.StatusBadRequest},
+		{"invalid cpu", "original", `{"cpu":"two"}`, http.StatusBadRequest},
+		{"missing job", "missing", "", http.StatusNotFound},
+		{"job of another service", "other", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/system/logs/testName/"+tt.job+"/rerun", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			r.ServeHTTP(w, req)
+			if w.Code != tt.code {
+				t.Errorf("expecting code %d, got %d: %s", tt.code, w.Code, w.Body.String())
+			}
+		})
+	}
+}
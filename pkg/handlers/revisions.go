@@ -0,0 +1,206 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/grycap/oscar/v4/pkg/types"
+	"github.com/grycap/oscar/v4/pkg/utils"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Custom logger
+var revisionsLogger = log.New(os.Stdout, "[REVISIONS-HANDLER] ", log.Flags())
+
+// MakeListServiceRevisionsHandler godoc
+// @Summary List service revisions
+// @Description List the stored revisions of a service, oldest first.
+// @Tags services
+// @Produce json
+// @Param serviceName path string true "Service name"
+// @Success 200 {array} types.ServiceRevision
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Not Found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Security BasicAuth
+// @Security BearerAuth
+// @Router /system/services/{serviceName}/revisions [get]
+func MakeListServiceRevisionsHandler(back types.ServerlessBackend, kubeClientset kubernetes.Interface, cfg *types.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		service, ok := getAuthorizedService(c, back, c.Param("serviceName"), types.ServiceRoleViewer)
+		if !ok {
+			if !c.Writer.Written() {
+				c.Status(http.StatusForbidden)
+			}
+			return
+		}
+
+		revisions, err := utils.ListServiceRevisions(c.Request.Context(), kubeClientset, resolveServiceNamespace(service, cfg), service.Name)
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, revisions)
+	}
+}
+
+// MakeReadServiceRevisionHandler godoc
+// @Summary Get service revision
+// @Description Get a stored revision of a service, including its FDL and script.
+// @Tags services
+// @Produce json
+// @Param serviceName path string true "Service name"
+// @Param revision path int true "Revision number"
+// @Success 200 {object} types.ServiceRevision
+// @Failure 400 {string} string "Bad Request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Not Found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Security BasicAuth
+// @Security BearerAuth
+// @Router /system/services/{serviceName}/revisions/{revision} [get]
+func MakeReadServiceRevisionHandler(back types.ServerlessBackend, kubeClientset kubernetes.Interface, cfg *types.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		number, err := strconv.Atoi(c.Param("revision"))
+		if err != nil || number < 1 {
+			c.String(http.StatusBadRequest, "invalid revision number")
+			return
+		}
+		service, ok := getAuthorizedService(c, back, c.Param("serviceName"), types.ServiceRoleViewer)
+		if !ok {
+			if !c.Writer.Written() {
+				c.Status(http.StatusForbidden)
+			}
+			return
+		}
+
+		revision, err := utils.GetServiceRevision(c.Request.Context(), kubeClientset, resolveServiceNamespace(service, cfg), service.Name, number)
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				c.String(http.StatusNotFound, "revision %d of service %s not found", number, service.Name)
+			} else {
+				c.String(http.StatusInternalServerError, err.Error())
+			}
+			return
+		}
+		c.JSON(http.StatusOK, revision)
+	}
+}
+
+// MakeRollbackServiceHandler godoc
+// @Summary Roll back service
+// @Description Re-apply a previous revision of a service through the same update path as PUT /system/services. The service token, owner, access control list and namespace are kept, and a new revision is recorded.
+// @Tags services
+// @Accept json
+// @Produce json
+// @Param serviceName path string true "Service name"
+// @Param rollback body types.ServiceRollbackRequest true "Revision to roll back to"
+// @Success 200 {object} types.ServiceRevision
+// @Failure 400 {string} string "Bad Request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Not Found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Security BasicAuth
+// @Security BearerAuth
+// @Router /system/services/{serviceName}/rollback [post]
+func MakeRollbackServiceHandler(back types.ServerlessBackend, kubeClientset kubernetes.Interface, cfg *types.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request types.ServiceRollbackRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("The rollback request is not valid: %v", err))
+			return
+		}
+		service, ok := getManagedService(c, back, c.Param("serviceName"), types.ServiceRoleEditor)
+		if !ok {
+			return
+		}
+		namespace := resolveServiceNamespace(service, cfg)
+
+		revision, err := utils.GetServiceRevision(c.Request.Context(), kubeClientset, namespace, service.Name, request.Revision)
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				c.String(http.StatusNotFound, "revision %d of service %s not found", request.Revision, service.Name)
+			} else {
+				c.String(http.StatusInternalServerError, err.Error())
+			}
+			return
+		}
+		target, err := utils.ServiceFromRevision(revision)
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !utils.SameVolumeConfig(service.Volume, target.Volume) {
+			c.String(http.StatusBadRequest, "revision %d uses a different volume configuration and cannot be restored", request.Revision)
+			return
+		}
+
+		// Identity and access fields always come from the current definition
+		target.Name = service.Name
+		target.Owner = service.Owner
+		target.ACL = service.ACL
+		target.Namespace = namespace
+		// The revisions don't store the values of the secrets, so the current ones are kept
+		target.Environment.Secrets = nil
+
+		status, message, recorded := updateServiceWithRevision(makeServiceCaller(c), cfg, back, *target, types.RevisionOperationRollback, request.Revision)
+		if status >= http.StatusBadRequest {
+			writeServiceResponse(c, status, message)
+			return
+		}
+		if message != "" {
+			revisionsLogger.Printf("Rollback of service '%s': %s", service.Name, message)
+		}
+		if recorded == nil {
+			c.String(http.StatusInternalServerError, fmt.Sprintf("The service was rolled back to revision %d, but the new revision could not be recorded", request.Revision))
+			return
+		}
+		recorded.FDL = ""
+		recorded.Script = ""
+		c.JSON(http.StatusOK, recorded)
+	}
+}
+
+// recordServiceRevision stores a new revision after a successful create, update or rollback,
+// returning nil if it could not be recorded. Failures are logged.
+func recordServiceRevision(caller serviceCaller, cfg *types.Config, back types.ServerlessBackend, service types.Service, operation string, sourceRevision int) *types.ServiceRevision {
+	namespace := resolveServiceNamespace(&service, cfg)
+	recorded, err := utils.RecordServiceRevision(caller.ctx, back.GetKubeClientset(), service, namespace, caller.revisionAuthor(), operation, sourceRevision, cfg.ServiceRevisionLimit)
+	if err != nil {
+		revisionsLogger.Printf("Error recording revision for service '%s': %v", service.Name, err)
+		return nil
+	}
+	return recorded
+}
+
+// revisionAuthor returns the user recorded as the author of the revisions made by the caller
+func (caller serviceCaller) revisionAuthor() string {
+	if caller.isAdmin() {
+		return types.DefaultOwner
+	}
+	return caller.uid
+}
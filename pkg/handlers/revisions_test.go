@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/grycap/oscar/v4/pkg/backends"
+	"github.com/grycap/oscar/v4/pkg/types"
+	"github.com/grycap/oscar/v4/pkg/utils"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	testclient "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func seedRevisions(t *testing.T, back *backends.FakeBackend, images ...string) {
+	t.Helper()
+	for i, image := range images {
+		operation := types.RevisionOperationUpdate
+		if i == 0 {
+			operation = types.RevisionOperationCreate
+		}
+		svc := types.Service{Name: "svc", Image: image, Owner: "owner", Token: "token"}
+		if _, err := utils.RecordServiceRevision(context.Background(), back.GetKubeClientset(), svc, "ns", "owner", operation, 0, 0); err != nil {
+			t.Fatalf("seeding revision: %v", err)
+		}
+	}
+}
+
+func TestMakeListServiceRevisionsHandler(t *testing.T) {
+	back := backends.MakeFakeBackend()
+	back.SetKubeClientset(testclient.NewSimpleClientset())
+	back.Service = &types.Service{Name: "svc", Namespace: "ns", Owner: "owner", Image: "image:v2"}
+	seedRevisions(t, back, "image:v1", "image:v2")
+
+	r := gin.New()
+	r.GET("/system/services/:serviceName/revisions", MakeListServiceRevisionsHandler(back, back.GetKubeClientset(), &types.Config{}))
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/system/services/svc/revisions", nil)
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var revisions []types.ServiceRevision
+	if err := json.Unmarshal(w.Body.Bytes(), &revisions); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(revisions) != 2 || revisions[0].Image != "image:v1" || revisions[1].Image != "image:v2" {
+		t.Fatalf("unexpected revisions: %+v", revisions)
+	}
+}
+
+func TestMakeReadServiceRevisionHandler(t *testing.T) {
+	back := backends.MakeFakeBackend()
+	back.SetKubeClientset(testclient.NewSimpleClientset())
+	back.Service = &types.Service{Name: "svc", Namespace: "ns", Owner: "owner"}
+	seedRevisions(t, back, "image:v1")
+
+	r := gin.New()
+	r.GET("/system/services/:serviceName/revisions/:revision", MakeReadServiceRevisionHandler(back, back.GetKubeClientset(), &types.Config{}))
+
+	tests := []struct {
+		path string
+		code int
+	}{
+		{"/system/services/svc/revisions/1", http.StatusOK},
+		{"/system/services/svc/revisions/2", http.StatusNotFound},
+		{"/system/services/svc/revisions/abc", http.StatusBadRequest},
+	}
+	for _, tc := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if w.Code != tc.code {
+			t.Errorf("%s: expected %d, got %d: %s", tc.path, tc.code, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestMakeReadServiceRevisionHandlerForbidden(t *testing.T) {
+	back := backends.MakeFakeBackend()
+	back.Service = &types.Service{Name: "svc", Namespace: "ns", Owner: "owner", Visibility: utils.PRIVATE}
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("uidOrigin", "other")
+		c.Next()
+	})
+	r.GET("/system/services/:serviceName/revisions/:revision", MakeReadServiceRevisionHandler(back, back.GetKubeClientset(), &types.Config{}))
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/system/services/svc/revisions/1", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", w.Code)
+	}
+}
+
+func TestMakeRollbackServiceHandler(t *testing.T) {
+	back := backends.MakeFakeBackend()
+	back.SetKubeClientset(testclient.NewSimpleClientset())
+	back.Service = &types.Service{Name: "svc", Namespace: "ns", Owner: "owner", Image: "image:v2", Token: "current-token"}
+	seedRevisions(t, back, "image:v1", "image:v2")
+
+	r := gin.New()
+	r.POST("/system/services/:serviceName/rollback", MakeRollbackServiceHandler(back, back.GetKubeClientset(), &types.Config{MinIOProvider: &types.MinIOProvider{}}))
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/system/services/svc/rollback", bytes.NewBufferString(`{"revision": 1}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if back.UpdatedService == nil {
+		t.Fatal("expected the backend update path to be called")
+	}
+	if back.UpdatedService.Image != "image:v1" {
+		t.Fatalf("expected image of revision 1, got %q", back.UpdatedService.Image)
+	}
+	if back.UpdatedService.Token != "current-token" || back.UpdatedService.Namespace != "ns" {
+		t.Fatalf("expected token and namespace to be kept, got %+v", back.UpdatedService)
+	}
+
+	var recorded types.ServiceRevision
+	if err := json.Unmarshal(w.Body.Bytes(), &recorded); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if recorded.Revision != 3 || recorded.Operation != types.RevisionOperationRollback || recorded.SourceRevision != 1 {
+		t.Fatalf("unexpected recorded revision: %+v", recorded)
+	}
+}
+
+func TestMakeRollbackServiceHandlerRevisionNotRecorded(t *testing.T) {
+	back := backends.MakeFakeBackend()
+	kubeClientset := testclient.NewSimpleClientset()
+	back.SetKubeClientset(kubeClientset)
+	back.Service = &types.Service{Name: "svc", Namespace: "ns", Owner: "owner", Image: "image:v2"}
+	seedRevisions(t, back, "image:v1", "image:v2")
+	kubeClientset.PrependReactor("create", "configmaps", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.NewForbidden(schema.GroupResource{Resource: "configmaps"}, "", nil)
+	})
+
+	r := gin.New()
+	r.POST("/system/services/:serviceName/rollback", MakeRollbackServiceHandler(back, kubeClientset, &types.Config{MinIOProvider: &types.MinIOProvider{}}))
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/system/services/svc/rollback", bytes.NewBufferString(`{"revision": 1}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestMakeRollbackServiceHandlerRequiresOwner(t *testing.T) {
+	back := backends.MakeFakeBackend()
+	back.Service = &types.Service{Name: "svc", Namespace: "ns", Owner: "owner"}
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("uidOrigin", "other")
+		c.Next()
+	})
+	r.POST("/system/services/:serviceName/rollback", MakeRollbackServiceHandler(back, back.GetKubeClientset(), &types.Config{}))
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/system/services/svc/rollback", bytes.NewBufferString(`{"revision": 1}`))
+	req.Header.Set("Authorization", "Bearer token")
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d: %s", w.Code, w.Body.String())
+	}
+	if back.UpdatedService != nil {
+		t.Fatal("expected no update for a non-owner")
+	}
+}
@@ -17,9 +17,12 @@ limitations under the License.
 package handlers
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httputil"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -37,10 +40,11 @@ const (
 
 // MakeRunHandler godoc
 // @Summary Invoke service synchronously
-// @Description Invoke a service synchronously using the configured Serverless backend.
+// @Description Invoke a service synchronously using the configured Serverless backend. CloudEvents 1.0 in structured mode are forwarded to the service in binary mode.
 // @Tags sync
 // @Accept json
 // @Accept octet-stream
+// @Accept application/cloudevents+json
 // @Param serviceName path string true "Service name"
 // @Param payload body string false "Event payload"
 // @Success 200 {string} string "OK"
@@ -75,15 +79,34 @@ func MakeRunHandler(cfg *types.Config, back types.SyncBackend) gin.HandlerFunc {
 		// Check if reqToken is the service token
 		rawToken := strings.TrimSpace(splitToken[1])
 		if len(rawToken) == tokenLength {
-			for _, serviceIter := range serviceList {
-				if rawToken == serviceIter.Token {
-					service = serviceIter
-				}
-			}
+			service = auth.FindServiceByToken(c.Request.Context(), back.GetKubeClientset(), serviceList, rawToken, types.ServiceTokenScopeInvokeSync)
 			if service == nil {
 				c.Status(http.StatusUnauthorized)
 				return
 			}
+		} else if auth.IsPersonalToken(rawToken) {
+			// Personal access tokens invoke the services as the OIDC user who created them
+			token, ok := authenticatePersonalToken(c, cfg, back.GetKubeClientset(), rawToken)
+			if !ok {
+				return
+			}
+			// The owner must still be enrolled in the allowed groups, as with OIDC tokens
+			if err := auth.CheckPersonalTokenGroups(token, cfg); err != nil {
+				c.String(http.StatusUnauthorized, err.Error())
+				return
+			}
+			auth.SetUserGroupsInContext(c, token.Groups)
+			c.Set("uidOrigin", token.Owner)
+
+			service, err = selectService(c, serviceList)
+			if err != nil {
+				if err.Error() == errServiceNotFound {
+					c.Status(http.StatusNotFound)
+				} else {
+					c.String(http.StatusBadRequest, err.Error())
+				}
+				return
+			}
 		} else {
 			issuer, err := auth.GetIssuerFromToken(rawToken)
 			if err != nil {
@@ -104,6 +127,7 @@ func MakeRunHandler(cfg *types.Config, back types.SyncBackend) gin.HandlerFunc {
 
 			uid := ui.Subject
 			c.Set("uidOrigin", uid)
+			auth.SetUserGroupsInContext(c, ui.Groups)
 			c.Next()
 
 			service, err = selectService(c, serviceList)
@@ -130,6 +154,11 @@ func MakeRunHandler(cfg *types.Config, back types.SyncBackend) gin.HandlerFunc {
 			return
 		}
 
+		if err := prepareRunCloudEvent(c); err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
 		proxy := &httputil.ReverseProxy{
 			Director: back.GetProxyDirector(service.Name, service.Namespace),
 		}
@@ -137,12 +166,39 @@ func MakeRunHandler(cfg *types.Config, back types.SyncBackend) gin.HandlerFunc {
 	}
 }
 
+// prepareRunCloudEvent validates the CloudEvent of the request, if any, to log its attributes.
+// The events in structured mode are converted to binary mode, so the service receives their data as the event.
+func prepareRunCloudEvent(c *gin.Context) error {
+	var body []byte
+	structured := utils.IsStructuredCloudEvent(c.Request.Header)
+	if structured {
+		var err error
+		if body, err = io.ReadAll(c.Request.Body); err != nil {
+			return err
+		}
+	}
+	cloudEvent, err := utils.ParseCloudEvent(c.Request.Header, body)
+	if err != nil || cloudEvent == nil {
+		return err
+	}
+	c.Set("cloudEvent", cloudEvent)
+
+	if structured {
+		c.Request.Header.Del("Content-Type")
+		utils.SetCloudEventHeaders(c.Request.Header, cloudEvent)
+		c.Request.Body = io.NopCloser(bytes.NewReader(cloudEvent.Data))
+		c.Request.ContentLength = int64(len(cloudEvent.Data))
+		c.Request.Header.Set("Content-Length", strconv.Itoa(len(cloudEvent.Data)))
+	}
+	return nil
+}
+
 func selectService(c *gin.Context, serviceList []*types.Service) (*types.Service, error) {
 	// If no services found, return not found
 	if len(serviceList) == 0 {
 		return nil, fmt.Errorf(errServiceNotFound)
 	} else if len(serviceList) == 1 { // Found 1 service
-		if authorizeRequest(c, serviceList[0]) { // Found 1 service and is authorize
+		if authorizeRequest(c, serviceList[0], types.ServiceRoleInvoker) { // Found 1 service and is authorize
 			return serviceList[0], nil
 		} else {
 			return nil, fmt.Errorf(errServiceNotFound)
@@ -151,7 +207,7 @@ func selectService(c *gin.Context, serviceList []*types.Service) (*types.Service
 		authTime := 0
 		var service *types.Service
 		for _, serviceIter := range serviceList {
-			if authorizeRequest(c, serviceIter) { // Get the services authorized
+			if authorizeRequest(c, serviceIter, types.ServiceRoleInvoker) { // Get the services authorized
 				service = serviceIter
 				authTime++
 			}
@@ -166,7 +222,7 @@ func selectService(c *gin.Context, serviceList []*types.Service) (*types.Service
 				return nil, fmt.Errorf(errMultipleServiceAuth)
 			}
 			for _, serviceIter := range serviceList {
-				if authorizeRequest(c, serviceIter) && serviceIter.Owner == owner {
+				if authorizeRequest(c, serviceIter, types.ServiceRoleInvoker) && serviceIter.Owner == owner {
 					service = serviceIter
 					return service, nil
 				}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -291,3 +292,30 @@ func (c *closeNotifierRecorder) CloseNotify() <-chan bool {
 	ch := make(chan bool, 1)
 	return ch
 }
+
+func TestPrepareRunCloudEvent(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/run/hello", strings.NewReader(`{"specversion":"1.0","id":"1","source":"src","type":"t","datacontenttype":"text/plain","data":"hello"}`))
+	c.Request.Header.Set("Content-Type", "application/cloudevents+json")
+
+	if err := prepareRunCloudEvent(c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body, _ := io.ReadAll(c.Request.Body)
+	if string(body) != "hello" || c.Request.ContentLength != 5 {
+		t.Errorf("expected the data as body, got %q", body)
+	}
+	header := c.Request.Header
+	if header.Get("Ce-Id") != "1" || header.Get("Ce-Source") != "src" || header.Get("Ce-Type") != "t" || header.Get("Content-Type") != "text/plain" {
+		t.Errorf("expected the event in binary mode, got headers %v", header)
+	}
+	if _, ok := c.Get("cloudEvent"); !ok {
+		t.Errorf("expected the event to be set in the context")
+	}
+
+	c.Request = httptest.NewRequest(http.MethodPost, "/run/hello", strings.NewReader(`{}`))
+	c.Request.Header.Set("Content-Type", "application/cloudevents+json")
+	if err := prepareRunCloudEvent(c); err == nil {
+		t.Errorf("expected error for an invalid CloudEvent")
+	}
+}
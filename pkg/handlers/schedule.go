@@ -0,0 +1,244 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/grycap/oscar/v4/pkg/types"
+	"github.com/grycap/oscar/v4/pkg/utils"
+	"github.com/grycap/oscar/v4/pkg/utils/auth"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// scheduledJobNameLabel pod label with the name of the job, set by the Job controller
+const scheduledJobNameLabel = "batch.kubernetes.io/job-name"
+
+// MakeReadScheduleHandler godoc
+// @Summary Get service schedule
+// @Description Get the schedule of a service with the last and next scheduled invocations.
+// @Tags services
+// @Produce json
+// @Param serviceName path string true "Service name"
+// @Success 200 {object} types.ServiceScheduleStatus
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Not Found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Security BasicAuth
+// @Security BearerAuth
+// @Router /system/services/{serviceName}/schedule [get]
+func MakeReadScheduleHandler(back types.ServerlessBackend, kubeClientset kubernetes.Interface, cfg *types.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		service, ok := getAuthorizedService(c, back, c.Param("serviceName"), types.ServiceRoleViewer)
+		if !ok {
+			if !c.Writer.Written() {
+				c.Status(http.StatusForbidden)
+			}
+			return
+		}
+		if service.Schedule == nil {
+			c.String(http.StatusNotFound, "the service %s has no schedule", service.Name)
+			return
+		}
+
+		cronJobName := types.ServiceCronJobName(service.Name)
+		cronJob, err := kubeClientset.BatchV1().CronJobs(resolveServiceNamespace(service, cfg)).Get(c.Request.Context(), cronJobName, metav1.GetOptions{})
+		if err != nil {
+			if errors.IsNotFound(err) {
+				c.String(http.StatusNotFound, "the schedule of the service %s is not deployed", service.Name)
+			} else {
+				c.String(http.StatusInternalServerError, err.Error())
+			}
+			return
+		}
+
+		status, err := scheduleStatus(*service.Schedule, cronJob, time.Now())
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, status)
+	}
+}
+
+// scheduleStatus returns the status of the scheduled invocations from the CronJob of the service
+func scheduleStatus(schedule types.ServiceSchedule, cronJob *batchv1.CronJob, now time.Time) (*types.ServiceScheduleStatus, error) {
+	status := &types.ServiceScheduleStatus{
+		Schedule:   schedule,
+		CronJob:    cronJob.Name,
+		ActiveJobs: []string{},
+	}
+	if cronJob.Status.LastScheduleTime != nil {
+		status.LastScheduleTime = &cronJob.Status.LastScheduleTime.Time
+	}
+	if cronJob.Status.LastSuccessfulTime != nil {
+		status.LastSuccessfulTime = &cronJob.Status.LastSuccessfulTime.Time
+	}
+	for _, job := range cronJob.Status.Active {
+		status.ActiveJobs = append(status.ActiveJobs, job.Name)
+	}
+
+	if schedule.Suspend {
+		return status, nil
+	}
+	expr, timeZone, err := schedule.CronTimeZone()
+	if err != nil {
+		return nil, err
+	}
+	cron, err := types.ParseCron(expr)
+	if err != nil {
+		return nil, err
+	}
+	location, err := time.LoadLocation(timeZone)
+	if err != nil {
+		return nil, err
+	}
+	if next := cron.Next(now.In(location)); !next.IsZero() {
+		status.NextScheduleTime = &next
+	}
+	return status, nil
+}
+
+// syncServiceSchedule creates, updates or deletes the CronJob of the service to match its schedule
+func syncServiceSchedule(ctx context.Context, cfg *types.Config, kubeClientset kubernetes.Interface, service types.Service) error {
+	namespace := resolveServiceNamespace(&service, cfg)
+	if service.Schedule == nil {
+		return deleteServiceSchedule(ctx, kubeClientset, namespace, service.Name)
+	}
+
+	cronJob, err := newServiceCronJob(cfg, kubeClientset, service)
+	if err != nil {
+		return err
+	}
+	cronJobs := kubeClientset.BatchV1().CronJobs(namespace)
+	current, err := cronJobs.Get(ctx, cronJob.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = cronJobs.Create(ctx, cronJob, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	current.Labels = cronJob.Labels
+	current.Spec = cronJob.Spec
+	_, err = cronJobs.Update(ctx, current, metav1.UpdateOptions{})
+	return err
+}
+
+// deleteServiceSchedule deletes the CronJob of the service, if any, and its running jobs
+func deleteServiceSchedule(ctx context.Context, kubeClientset kubernetes.Interface, namespace string, serviceName string) error {
+	propagation := metav1.DeletePropagationBackground
+	err := kubeClientset.BatchV1().CronJobs(namespace).Delete(ctx, types.ServiceCronJobName(serviceName), metav1.DeleteOptions{PropagationPolicy: &propagation})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// newServiceCronJob returns the CronJob of a scheduled service. Its jobs are built like the ones created
+// by the job handler when the service is invoked with its token, passing the static event of the schedule
+func newServiceCronJob(cfg *types.Config, kubeClientset kubernetes.Interface, service types.Service) (*batchv1.CronJob, error) {
+	schedule := service.Schedule
+	// Avoid modifying the labels of the provided service
+	service.Labels = maps.Clone(service.Labels)
+	if service.Labels == nil {
+		service.Labels = map[string]string{}
+	}
+
+	podSpec, namespace, err := getPodSpecNamespace(&service, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Add secrets as environment variables if defined
+	if utils.SecretExists(service.Name, namespace, kubeClientset) {
+		podSpec.Containers[0].EnvFrom = []v1.EnvFromSource{
+			{
+				SecretRef: &v1.SecretEnvSource{
+					LocalObjectReference: v1.LocalObjectReference{
+						Name: service.Name,
+					},
+				},
+			},
+		}
+	}
+
+	// Scheduled invocations run with the credentials of the service owner
+	minIOSecretKey := "minio"
+	if err := ensureMinIOSecret(kubeClientset, minIOSecretKey, namespace); err != nil {
+		return nil, fmt.Errorf("error ensuring credentials for the scheduled invocations: %v", err)
+	}
+	mountMinIOCredentials(podSpec, auth.FormatUID(minIOSecretKey))
+
+	jobCommand, event, args := jobEventCommand(podSpec, &service, cfg, []byte(schedule.Event))
+	// The name of each scheduled job is generated by the CronJob controller
+	jobUUIDVar := v1.EnvVar{
+		Name: types.JobUUIDVariable,
+		ValueFrom: &v1.EnvVarSource{
+			FieldRef: &v1.ObjectFieldSelector{
+				FieldPath: fmt.Sprintf("metadata.labels['%s']", scheduledJobNameLabel),
+			},
+		},
+	}
+	setJobContainer(podSpec, jobCommand, args, event, jobUUIDVar, resourceIDEnvVar())
+
+	job := newServiceJob(cfg, &service, podSpec, namespace, "")
+	if service.MaxConcurrentJobs > 0 {
+		holdJob(job)
+		// The scheduled jobs are queued when the CronJob creates them, ordered by their creation time
+		job.Labels[types.JobHeldLabel] = ""
+	}
+
+	// The timezone is always set, so the next runs are the ones returned in the status of the schedule
+	cron, timeZone, err := schedule.CronTimeZone()
+	if err != nil {
+		return nil, err
+	}
+	suspend := schedule.Suspend
+	return &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      types.ServiceCronJobName(service.Name),
+			Namespace: namespace,
+			Labels: map[string]string{
+				types.ServiceLabel: service.Name,
+			},
+		},
+		Spec: batchv1.CronJobSpec{
+			Schedule:          cron,
+			TimeZone:          &timeZone,
+			ConcurrencyPolicy: schedule.KubeConcurrencyPolicy(),
+			Suspend:           &suspend,
+			JobTemplate: batchv1.JobTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels:      job.Labels,
+					Annotations: job.Annotations,
+				},
+				Spec: job.Spec,
+			},
+		},
+	}, nil
+}
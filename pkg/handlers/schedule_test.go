@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/grycap/oscar/v4/pkg/backends"
+	"github.com/grycap/oscar/v4/pkg/types"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	testclient "k8s.io/client-go/kubernetes/fake"
+)
+
+func scheduledService() types.Service {
+	return types.Service{
+		Name:      "nightly",
+		Namespace: "oscar-svc",
+		Image:     "image",
+		Script:    "echo hi",
+		CPU:       "1",
+		Memory:    "1Gi",
+		Owner:     "owner",
+		Labels:    map[string]string{},
+		Schedule: &types.ServiceSchedule{
+			Cron:     "0 3 * * *",
+			TimeZone: "Europe/Madrid",
+			Event:    `{"date": "yesterday"}`,
+		},
+	}
+}
+
+func TestSyncServiceSchedule(t *testing.T) {
+	kubeClient := testclient.NewSimpleClientset()
+	cfg := &types.Config{ServicesNamespace: "oscar-svc", TTLJob: 60}
+	service := scheduledService()
+
+	if err := syncServiceSchedule(context.Background(), cfg, kubeClient, service); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cronJob, err := kubeClient.BatchV1().CronJobs("oscar-svc").Get(context.Background(), "nightly-schedule", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected CronJob, got error: %v", err)
+	}
+	if cronJob.Spec.Schedule != "0 3 * * *" || cronJob.Spec.TimeZone == nil || *cronJob.Spec.TimeZone != "Europe/Madrid" {
+		t.Errorf("unexpected schedule %s %v", cronJob.Spec.Schedule, cronJob.Spec.TimeZone)
+	}
+	if cronJob.Spec.ConcurrencyPolicy != batchv1.ForbidConcurrent {
+		t.Errorf("unexpected concurrency policy %s", cronJob.Spec.ConcurrencyPolicy)
+	}
+	if cronJob.Labels[types.ServiceLabel] != "nightly" {
+		t.Errorf("unexpected labels %v", cronJob.Labels)
+	}
+
+	podSpec := cronJob.Spec.JobTemplate.Spec.Template.Spec
+	envVars := map[string]string{}
+	for _, env := range podSpec.Containers[0].Env {
+		envVars[env.Name] = env.Value
+		if env.Name == types.JobUUIDVariable && (env.ValueFrom == nil || env.ValueFrom.FieldRef == nil) {
+			t.Errorf("expected %s from the job name label", types.JobUUIDVariable)
+		}
+	}
+	if envVars[types.EventVariable] != `{"date": "yesterday"}` {
+		t.Errorf("unexpected event %q", envVars[types.EventVariable])
+	}
+	if _, ok := envVars[types.JobUUIDVariable]; !ok {
+		t.Errorf("expected %s variable", types.JobUUIDVariable)
+	}
+	mounted := false
+	for _, volume := range podSpec.Volumes {
+		if volume.Name == MinIOSecretVolumeName {
+			mounted = true
+		}
+	}
+	if !mounted {
+		t.Error("expected MinIO credentials volume")
+	}
+	if jobSpec := cronJob.Spec.JobTemplate.Spec; jobSpec.BackoffLimit == nil || *jobSpec.BackoffLimit != 0 || jobSpec.ActiveDeadlineSeconds != nil {
+		t.Errorf("unexpected retries and deadline %v %v", jobSpec.BackoffLimit, jobSpec.ActiveDeadlineSeconds)
+	}
+	// The labels of the service must not be modified
+	if len(service.Labels) != 0 {
+		t.Errorf("the service labels were modified: %v", service.Labels)
+	}
+
+	// Update
+	service.Schedule.Cron = "@hourly"
+	service.Schedule.Suspend = true
+	if err := syncServiceSchedule(context.Background(), cfg, kubeClient, service); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cronJob, _ = kubeClient.BatchV1().CronJobs("oscar-svc").Get(context.Background(), "nightly-schedule", metav1.GetOptions{})
+	if cronJob.Spec.Schedule != "@hourly" || cronJob.Spec.Suspend == nil || !*cronJob.Spec.Suspend {
+		t.Errorf("CronJob not updated: %s %v", cronJob.Spec.Schedule, cronJob.Spec.Suspend)
+	}
+
+	// The scheduled jobs follow the retry policy of the service
+	service.RetryPolicy = &types.JobRetryPolicy{MaxRetries: 2, ActiveDeadlineSeconds: 60, RestartPolicy: "OnFailure"}
+	if err := syncServiceSchedule(context.Background(), cfg, kubeClient, service); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cronJob, _ = kubeClient.BatchV1().CronJobs("oscar-svc").Get(context.Background(), "nightly-schedule", metav1.GetOptions{})
+	jobSpec := cronJob.Spec.JobTemplate.Spec
+	if *jobSpec.BackoffLimit != 2 || jobSpec.ActiveDeadlineSeconds == nil || *jobSpec.ActiveDeadlineSeconds != 60 {
+		t.Errorf("unexpected retries and deadline %v %v", jobSpec.BackoffLimit, jobSpec.ActiveDeadlineSeconds)
+	}
+	if jobSpec.Template.Spec.RestartPolicy != corev1.RestartPolicyOnFailure || jobSpec.PodFailurePolicy != nil {
+		t.Errorf("unexpected restart and failure policies %s %+v", jobSpec.Template.Spec.RestartPolicy, jobSpec.PodFailurePolicy)
+	}
+
+	// The scheduled jobs of limited services wait for a free slot
+	service.MaxConcurrentJobs = 1
+	if err := syncServiceSchedule(context.Background(), cfg, kubeClient, service); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cronJob, _ = kubeClient.BatchV1().CronJobs("oscar-svc").Get(context.Background(), "nightly-schedule", metav1.GetOptions{})
+	if since, held := cronJob.Spec.JobTemplate.Labels[types.JobHeldLabel]; !held || since != "" {
+		t.Errorf("expected the scheduled jobs to be held, got labels %v", cronJob.Spec.JobTemplate.Labels)
+	}
+	if suspend := cronJob.Spec.JobTemplate.Spec.Suspend; suspend == nil || !*suspend {
+		t.Errorf("expected the scheduled jobs to be created suspended")
+	}
+
+	// Removing the schedule deletes the CronJob
+	service.Schedule = nil
+	if err := syncServiceSchedule(context.Background(), cfg, kubeClient, service); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := kubeClient.BatchV1().CronJobs("oscar-svc").Get(context.Background(), "nightly-schedule", metav1.GetOptions{}); err == nil {
+		t.Error("expected CronJob to be deleted")
+	}
+	// Deleting a missing schedule is not an error
+	if err := deleteServiceSchedule(context.Background(), kubeClient, "oscar-svc", "nightly"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestSyncServiceScheduleTimeZone(t *testing.T) {
+	kubeClient := testclient.NewSimpleClientset()
+	cfg := &types.Config{ServicesNamespace: "oscar-svc"}
+
+	// The CronJobs always set their timezone, moving the one of the cron expression
+	for cron, expected := range map[string]string{"0 3 * * *": types.DefaultScheduleTimeZone, "TZ=Europe/Madrid 0 3 * * *": "Europe/Madrid"} {
+		service := scheduledService()
+		service.Schedule.Cron = cron
+		service.Schedule.TimeZone = ""
+		if err := syncServiceSchedule(context.Background(), cfg, kubeClient, service); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		cronJob, err := kubeClient.BatchV1().CronJobs("oscar-svc").Get(context.Background(), "nightly-schedule", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("expected CronJob, got error: %v", err)
+		}
+		if cronJob.Spec.Schedule != "0 3 * * *" || cronJob.Spec.TimeZone == nil || *cronJob.Spec.TimeZone != expected {
+			t.Errorf("%s: unexpected schedule %s %v", cron, cronJob.Spec.Schedule, cronJob.Spec.TimeZone)
+		}
+	}
+}
+
+func TestMakeReadScheduleHandler(t *testing.T) {
+	service := scheduledService()
+	back := backends.MakeFakeBackend()
+	back.Service = &service
+	lastSchedule := metav1.NewTime(time.Date(2024, time.January, 10, 3, 0, 0, 0, time.UTC))
+	kubeClient := testclient.NewSimpleClientset(&batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "nightly-schedule", Namespace: "oscar-svc"},
+		Status: batchv1.CronJobStatus{
+			LastScheduleTime: &lastSchedule,
+			Active:           []corev1.ObjectReference{{Name: "nightly-schedule-28415"}},
+		},
+	})
+
+	r := gin.New()
+	r.GET("/system/services/:serviceName/schedule", MakeReadScheduleHandler(back, kubeClient, &types.Config{ServicesNamespace: "oscar-svc"}))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/system/services/nightly/schedule", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var status types.ServiceScheduleStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if status.CronJob != "nightly-schedule" || status.LastScheduleTime == nil || !status.LastScheduleTime.Equal(lastSchedule.Time) {
+		t.Errorf("unexpected status: %+v", status)
+	}
+	if status.NextScheduleTime == nil || !status.NextScheduleTime.After(time.Now()) {
+		t.Errorf("unexpected next schedule time: %v", status.NextScheduleTime)
+	}
+	if len(status.ActiveJobs) != 1 || status.ActiveJobs[0] != "nightly-schedule-28415" {
+		t.Errorf("unexpected active jobs: %v", status.ActiveJobs)
+	}
+
+	// Services without schedule
+	service.Schedule = nil
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/system/services/nightly/schedule", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", w.Code)
+	}
+}
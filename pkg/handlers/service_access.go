@@ -1,13 +1,12 @@
 package handlers
 
 import (
+	"context"
 	"net/http"
-	"slices"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/grycap/oscar/v4/pkg/types"
-	"github.com/grycap/oscar/v4/pkg/utils"
 	"github.com/grycap/oscar/v4/pkg/utils/auth"
 	"k8s.io/apimachinery/pkg/api/errors"
 )
@@ -16,17 +15,60 @@ func isBearerRequest(c *gin.Context) bool {
 	return strings.HasPrefix(c.GetHeader("Authorization"), "Bearer ")
 }
 
-func isServiceAccessibleByUser(service *types.Service, uid string) bool {
-	if service == nil {
-		return false
+// serviceCaller identity on whose behalf a service is created, updated or deleted.
+// Callers without a bearer token act as the cluster administrator
+type serviceCaller struct {
+	ctx        context.Context
+	authHeader string
+	uid        string
+	userName   string
+	groups     []string
+	mc         *auth.MultitenancyConfig
+}
+
+// makeServiceCaller returns the caller of the request
+func makeServiceCaller(c *gin.Context) serviceCaller {
+	uid, _ := auth.GetUIDFromContext(c)
+	mc, _ := auth.GetMultitenancyConfigFromContext(c)
+	return serviceCaller{
+		ctx:        c.Request.Context(),
+		authHeader: c.GetHeader("Authorization"),
+		uid:        uid,
+		userName:   auth.GetUserNameFromContext(c),
+		groups:     auth.GetUserGroupsFromContext(c),
+		mc:         mc,
 	}
-	if service.Visibility == utils.PUBLIC {
-		return true
+}
+
+// adminServiceCaller returns a caller acting as the cluster administrator
+func adminServiceCaller(ctx context.Context) serviceCaller {
+	return serviceCaller{ctx: ctx}
+}
+
+func (caller serviceCaller) isAdmin() bool {
+	return !strings.Contains(caller.authHeader, "Bearer")
+}
+
+// hasServiceRole returns true if the caller, or one of their groups, has the role on the service
+func (caller serviceCaller) hasServiceRole(service *types.Service, role string) bool {
+	if caller.uid == "" {
+		return false
 	}
-	if uid == service.Owner {
-		return true
+	return types.ServiceRoleAllows(auth.ServiceRole(service, caller.uid, caller.groups), role)
+}
+
+// writeServiceResponse writes the status and message returned by a service operation
+func writeServiceResponse(c *gin.Context, status int, message string) {
+	if message == "" {
+		c.Status(status)
+		return
 	}
-	return service.Visibility == utils.RESTRICTED && slices.Contains(service.AllowedUsers, uid)
+	c.String(status, message)
+}
+
+// isServiceAccessibleByUser returns true if the user, or one of their groups, has a viewer role on the service
+func isServiceAccessibleByUser(service *types.Service, uid string, groups []string) bool {
+	return types.ServiceRoleAllows(auth.ServiceRole(service, uid, groups), types.ServiceRoleViewer)
 }
 
 func listAuthorizedServicesForMetrics(c *gin.Context, back types.ServerlessBackend) ([]*types.Service, bool) {
@@ -45,9 +87,10 @@ func listAuthorizedServicesForMetrics(c *gin.Context, back types.ServerlessBacke
 		return nil, false
 	}
 
+	groups := auth.GetUserGroupsFromContext(c)
 	filtered := make([]*types.Service, 0, len(services))
 	for _, service := range services {
-		if isServiceAccessibleByUser(service, uid) {
+		if isServiceAccessibleByUser(service, uid, groups) {
 			filtered = append(filtered, service)
 		}
 	}
@@ -73,7 +116,7 @@ func getAuthorizedServiceForMetrics(c *gin.Context, back types.ServerlessBackend
 		c.String(http.StatusUnauthorized, err.Error())
 		return nil, false
 	}
-	if !isServiceAccessibleByUser(service, uid) {
+	if !isServiceAccessibleByUser(service, uid, auth.GetUserGroupsFromContext(c)) {
 		c.Status(http.StatusForbidden)
 		return nil, false
 	}
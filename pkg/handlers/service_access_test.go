@@ -80,7 +80,7 @@ func TestIsServiceAccessibleByUser(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := isServiceAccessibleByUser(tt.service, tt.uid)
+			result := isServiceAccessibleByUser(tt.service, tt.uid, nil)
 			if result != tt.expected {
 				t.Errorf("isServiceAccessibleByUser(%v, %q) = %v, want %v", tt.service, tt.uid, result, tt.expected)
 			}
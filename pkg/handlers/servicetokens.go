@@ -0,0 +1,241 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/grycap/oscar/v4/pkg/types"
+	"github.com/grycap/oscar/v4/pkg/utils"
+	"github.com/grycap/oscar/v4/pkg/utils/auth"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes"
+)
+
+var serviceTokensLogger = log.New(os.Stdout, "[SERVICE-TOKENS] ", log.Flags())
+
+// MakeListServiceTokensHandler godoc
+// @Summary List service tokens
+// @Description List the tokens accepted to access a service, without their values: the primary token, the previous primary token during its grace period and the named tokens, with their scopes, expiration and last use.
+// @Tags services
+// @Produce json
+// @Param serviceName path string true "Service name"
+// @Success 200 {array} types.ServiceToken
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Not Found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Security BasicAuth
+// @Security BearerAuth
+// @Router /system/services/{serviceName}/tokens [get]
+func MakeListServiceTokensHandler(back types.ServerlessBackend, kubeClientset kubernetes.Interface) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		service, ok := getManagedService(c, back, c.Param("serviceName"), types.ServiceRoleOwner)
+		if !ok {
+			return
+		}
+		tokens, err := auth.ListServiceTokens(c.Request.Context(), kubeClientset, service)
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, tokens)
+	}
+}
+
+// MakeCreateServiceTokenHandler godoc
+// @Summary Create service token
+// @Description Create a named token of a service with the scopes invoke-sync, invoke-async, read-logs and exposed-access. The value of the token is only returned in this response.
+// @Tags services
+// @Accept json
+// @Produce json
+// @Param serviceName path string true "Service name"
+// @Param token body types.ServiceTokenRequest true "Token name, scopes and validity"
+// @Success 201 {object} types.ServiceToken
+// @Failure 400 {string} string "Bad Request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Not Found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Security BasicAuth
+// @Security BearerAuth
+// @Router /system/services/{serviceName}/tokens [post]
+func MakeCreateServiceTokenHandler(back types.ServerlessBackend, kubeClientset kubernetes.Interface) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request types.ServiceTokenRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("The token request is not valid: %v", err))
+			return
+		}
+		if err := request.Validate(); err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("The token request is not valid: %v", err))
+			return
+		}
+		service, ok := getManagedService(c, back, c.Param("serviceName"), types.ServiceRoleOwner)
+		if !ok {
+			return
+		}
+
+		var expiresAt *time.Time
+		if request.ExpiresIn > 0 {
+			expiration := time.Now().Add(time.Duration(request.ExpiresIn) * time.Second)
+			expiresAt = &expiration
+		}
+		token, err := auth.CreateServiceToken(c.Request.Context(), kubeClientset, service, request.Name, request.Scopes, expiresAt)
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		c.JSON(http.StatusCreated, token)
+	}
+}
+
+// MakeDeleteServiceTokenHandler godoc
+// @Summary Revoke service token
+// @Description Revoke a named token of a service, or the previous primary token before the end of its grace period using the "grace" ID. The primary token can only be rotated.
+// @Tags services
+// @Param serviceName path string true "Service name"
+// @Param tokenID path string true "Token ID"
+// @Success 204 "No Content"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Not Found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Security BasicAuth
+// @Security BearerAuth
+// @Router /system/services/{serviceName}/tokens/{tokenID} [delete]
+func MakeDeleteServiceTokenHandler(back types.ServerlessBackend, kubeClientset kubernetes.Interface) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenID := c.Param("tokenID")
+		if tokenID == types.PrimaryServiceTokenID {
+			c.String(http.StatusBadRequest, "the primary token can't be revoked, rotate it instead")
+			return
+		}
+		service, ok := getManagedService(c, back, c.Param("serviceName"), types.ServiceRoleOwner)
+		if !ok {
+			return
+		}
+		if err := auth.DeleteServiceToken(c.Request.Context(), kubeClientset, service, tokenID); err != nil {
+			if apierrors.IsNotFound(err) {
+				c.String(http.StatusNotFound, "token %s of service %s not found", tokenID, service.Name)
+			} else {
+				c.String(http.StatusInternalServerError, err.Error())
+			}
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// MakeRotateServiceTokenHandler godoc
+// @Summary Rotate service token
+// @Description Replace the primary token of a service without recreating it. The previous token is still accepted during the grace period, which defaults to SERVICE_TOKEN_GRACE_PERIOD. The MinIO webhook of the service is registered again with the new token.
+// @Tags services
+// @Accept json
+// @Produce json
+// @Param serviceName path string true "Service name"
+// @Param rotation body types.ServiceTokenRotationRequest false "Grace period of the previous token"
+// @Success 200 {object} types.ServiceTokenRotation
+// @Failure 400 {string} string "Bad Request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Not Found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Security BasicAuth
+// @Security BearerAuth
+// @Router /system/services/{serviceName}/tokens/rotate [post]
+func MakeRotateServiceTokenHandler(cfg *types.Config, back types.ServerlessBackend, kubeClientset kubernetes.Interface) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request types.ServiceTokenRotationRequest
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		if len(bytes.TrimSpace(body)) > 0 {
+			if err := json.Unmarshal(body, &request); err != nil {
+				c.String(http.StatusBadRequest, fmt.Sprintf("The rotation request is not valid: %v", err))
+				return
+			}
+		}
+		gracePeriod := cfg.ServiceTokenGracePeriod
+		if request.GracePeriod != nil {
+			if *request.GracePeriod < 0 {
+				c.String(http.StatusBadRequest, "grace_period can't be negative")
+				return
+			}
+			gracePeriod = time.Duration(*request.GracePeriod) * time.Second
+		}
+		service, ok := getManagedService(c, back, c.Param("serviceName"), types.ServiceRoleOwner)
+		if !ok {
+			return
+		}
+
+		oldService := *service
+		service.Token = utils.GenerateToken()
+		// The previous token is recorded before the service is updated, so it is never revoked without its grace period
+		ctx := c.Request.Context()
+		graceExpiresAt := time.Now().Add(gracePeriod)
+		if err := auth.RecordServiceTokenRotation(ctx, kubeClientset, service, oldService.Token, graceExpiresAt); err != nil {
+			c.String(http.StatusInternalServerError, fmt.Sprintf("Error recording the grace period of the previous token: %v", err))
+			return
+		}
+		if err := back.UpdateService(*service); err != nil {
+			rollbackServiceTokenRotation(ctx, kubeClientset, &oldService)
+			c.String(http.StatusInternalServerError, fmt.Sprintf("Error rotating the service token: %v", err))
+			return
+		}
+		// MinIO authenticates the events sent to the service with its token
+		var minIOProvider *types.MinIOProvider
+		if service.StorageProviders != nil {
+			minIOProvider = service.StorageProviders.MinIO[types.DefaultProvider]
+		}
+		if err := registerMinIOWebhook(service.Name, service.Token, minIOProvider, cfg); err != nil {
+			if uerr := back.UpdateService(oldService); uerr != nil {
+				log.Println(uerr.Error())
+			} else {
+				rollbackServiceTokenRotation(ctx, kubeClientset, &oldService)
+			}
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		rotation := types.ServiceTokenRotation{Token: service.Token}
+		if gracePeriod > 0 && oldService.Token != "" {
+			expiration := graceExpiresAt.UTC().Truncate(time.Second)
+			rotation.GraceExpiresAt = &expiration
+		}
+		c.JSON(http.StatusOK, rotation)
+	}
+}
+
+// rollbackServiceTokenRotation records again the previous token as the primary token of a service whose rotation failed
+func rollbackServiceTokenRotation(ctx context.Context, kubeClientset kubernetes.Interface, oldService *types.Service) {
+	if err := auth.RecordServiceTokenRotation(ctx, kubeClientset, oldService, "", time.Time{}); err != nil {
+		serviceTokensLogger.Printf("Error restoring the tokens of service '%s': %v", oldService.Name, err)
+	}
+}
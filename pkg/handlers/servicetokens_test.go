@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/grycap/oscar/v4/pkg/backends"
+	"github.com/grycap/oscar/v4/pkg/testsupport"
+	"github.com/grycap/oscar/v4/pkg/types"
+	"github.com/grycap/oscar/v4/pkg/utils/auth"
+	"k8s.io/apimachinery/pkg/runtime"
+	testclient "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestServiceTokensHandlers(t *testing.T) {
+	back := backends.MakeFakeBackend()
+	kubeClient := testclient.NewSimpleClientset()
+	back.SetKubeClientset(kubeClient)
+	back.Service = &types.Service{Name: "svc", Namespace: "oscar-svc", Owner: "owner", Token: "11e387cf727630d899925d57fceb4578f478c44be6cde0ae3fe886d8be513acf"}
+	cfg := types.Config{}
+	r := gin.Default()
+	r.Use(func(c *gin.Context) {
+		if strings.HasPrefix(c.GetHeader("Authorization"), "Bearer ") {
+			c.Set("uidOrigin", "owner")
+		}
+	})
+	r.GET("/system/services/:serviceName/tokens", MakeListServiceTokensHandler(back, kubeClient))
+	r.POST("/system/services/:serviceName/tokens", MakeCreateServiceTokenHandler(back, kubeClient))
+	r.POST("/system/services/:serviceName/tokens/rotate", MakeRotateServiceTokenHandler(&cfg, back, kubeClient))
+	r.DELETE("/system/services/:serviceName/tokens/:tokenID", MakeDeleteServiceTokenHandler(back, kubeClient))
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/system/services/svc/tokens", strings.NewReader(`{"name": "ci", "scopes": ["invoke-async", "read-logs"], "expires_in": 3600}`))
+	req.Header.Set("Authorization", "Bearer oidc-token")
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var created types.ServiceToken
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(created.Token) != tokenLength || created.ExpiresAt == nil || !created.HasScope(types.ServiceTokenScopeReadLogs) {
+		t.Fatalf("unexpected token: %+v", created)
+	}
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/system/services/svc/tokens", nil)
+	req.Header.Set("Authorization", "Bearer oidc-token")
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var tokens []types.ServiceToken
+	if err := json.Unmarshal(w.Body.Bytes(), &tokens); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(tokens) != 2 || tokens[0].ID != types.PrimaryServiceTokenID || tokens[1].ID != created.ID || tokens[1].Token != "" {
+		t.Fatalf("unexpected tokens: %+v", tokens)
+	}
+
+	scenarios := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		code   int
+	}{
+		{"invalid scope", http.MethodPost, "/system/services/svc/tokens", `{"name": "ci", "scopes": ["admin"]}`, http.StatusBadRequest},
+		{"missing scopes", http.MethodPost, "/system/services/svc/tokens", `{"name": "ci"}`, http.StatusBadRequest},
+		{"revoke primary", http.MethodDelete, "/system/services/svc/tokens/primary", "", http.StatusBadRequest},
+		{"revoke named", http.MethodDelete, "/system/services/svc/tokens/" + created.ID, "", http.StatusNoContent},
+		{"revoke revoked", http.MethodDelete, "/system/services/svc/tokens/" + created.ID, "", http.StatusNotFound},
+		{"negative grace period", http.MethodPost, "/system/services/svc/tokens/rotate", `{"grace_period": -1}`, http.StatusBadRequest},
+	}
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(s.method, s.path, strings.NewReader(s.body))
+			req.Header.Set("Authorization", "Bearer oidc-token")
+			r.ServeHTTP(w, req)
+			if w.Code != s.code {
+				t.Errorf("expected %d, got %d: %s", s.code, w.Code, w.Body.String())
+			}
+		})
+	}
+
+	// Only the owner manages the tokens of the service
+	other := gin.Default()
+	other.Use(func(c *gin.Context) {
+		if strings.HasPrefix(c.GetHeader("Authorization"), "Bearer ") {
+			c.Set("uidOrigin", "other")
+		}
+	})
+	other.GET("/system/services/:serviceName/tokens", MakeListServiceTokensHandler(back, kubeClient))
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/system/services/svc/tokens", nil)
+	req.Header.Set("Authorization", "Bearer oidc-token")
+	other.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for other users, got %d", w.Code)
+	}
+}
+
+func TestRotateServiceTokenHandler(t *testing.T) {
+	testsupport.SkipIfCannotListen(t)
+
+	minIOServer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, hreq *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+		rw.Write([]byte(`{"status": "success"}`))
+	}))
+	defer minIOServer.Close()
+
+	back := backends.MakeFakeBackend()
+	kubeClient := testclient.NewSimpleClientset()
+	back.SetKubeClientset(kubeClient)
+	service := &types.Service{Name: "svc", Namespace: "oscar-svc", Owner: "owner", Token: "11e387cf727630d899925d57fceb4578f478c44be6cde0ae3fe886d8be513acf"}
+	back.Service = service
+	cfg := types.Config{
+		MinIOProvider: &types.MinIOProvider{
+			Endpoint:  minIOServer.URL,
+			Region:    "us-east-1",
+			AccessKey: "minioadmin",
+			SecretKey: "minioadmin",
+		},
+	}
+	r := gin.Default()
+	r.Use(func(c *gin.Context) {
+		if strings.HasPrefix(c.GetHeader("Authorization"), "Bearer ") {
+			c.Set("uidOrigin", "owner")
+		}
+	})
+	r.POST("/system/services/:serviceName/tokens/rotate", MakeRotateServiceTokenHandler(&cfg, back, kubeClient))
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/system/services/svc/tokens/rotate", strings.NewReader(`{"grace_period": 600}`))
+	req.Header.Set("Authorization", "Bearer oidc-token")
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var rotation types.ServiceTokenRotation
+	if err := json.Unmarshal(w.Body.Bytes(), &rotation); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if back.UpdatedService == nil || back.UpdatedService.Token != rotation.Token || rotation.Token == "11e387cf727630d899925d57fceb4578f478c44be6cde0ae3fe886d8be513acf" {
+		t.Fatalf("expected the service to be updated with the new token, got %+v", back.UpdatedService)
+	}
+	if rotation.GraceExpiresAt == nil {
+		t.Fatalf("expected the grace period of the previous token")
+	}
+
+	rotated := *back.UpdatedService
+	ctx := context.Background()
+	if !auth.MatchServiceToken(ctx, kubeClient, &rotated, "11e387cf727630d899925d57fceb4578f478c44be6cde0ae3fe886d8be513acf", types.ServiceTokenScopeInvokeAsync) {
+		t.Errorf("expected the previous token to be accepted during the grace period")
+	}
+	if !auth.MatchServiceToken(ctx, kubeClient, &rotated, rotation.Token, types.ServiceTokenScopeInvokeAsync) {
+		t.Errorf("expected the new token to be accepted")
+	}
+}
+
+func TestReadLogsServiceToken(t *testing.T) {
+	back := backends.MakeFakeBackend()
+	kubeClient := testclient.NewSimpleClientset()
+	back.SetKubeClientset(kubeClient)
+	service := &types.Service{Name: "svc", Namespace: "oscar-svc", Owner: "owner", Token: "11e387cf727630d899925d57fceb4578f478c44be6cde0ae3fe886d8be513acf"}
+	back.Service = service
+	back.Services = []*types.Service{service}
+	cfg := &types.Config{JobListingLimit: 10}
+
+	ctx := context.Background()
+	logs, err := auth.CreateServiceToken(ctx, kubeClient, service, "logs", []string{types.ServiceTokenScopeReadLogs}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	invoke, err := auth.CreateServiceToken(ctx, kubeClient, service, "invoke", []string{types.ServiceTokenScopeInvokeAsync}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	userAuth := func(c *gin.Context) {
+		c.AbortWithStatus(http.StatusUnauthorized)
+	}
+	r := gin.New()
+	r.GET("/system/logs/:serviceName", append(auth.BuildScopedServiceTokenMiddlewareChain(back, userAuth, types.ServiceTokenScopeReadLogs), MakeJobsInfoHandler(back, kubeClient, cfg))...)
+
+	scenarios := []struct {
+		name  string
+		token string
+		code  int
+	}{
+		{"read-logs token", logs.Token, http.StatusOK},
+		{"invoke-async token", invoke.Token, http.StatusUnauthorized},
+	}
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/system/logs/svc", nil)
+			req.Header.Set("Authorization", "Bearer "+s.token)
+			r.ServeHTTP(w, req)
+			if w.Code != s.code {
+				t.Errorf("expected %d, got %d: %s", s.code, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRotateServiceTokenHandlerRecordError(t *testing.T) {
+	back := backends.MakeFakeBackend()
+	kubeClient := testclient.NewSimpleClientset()
+	kubeClient.PrependReactor("*", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetVerb() == "create" || action.GetVerb() == "update" {
+			return true, nil, fmt.Errorf("secrets unavailable")
+		}
+		return false, nil, nil
+	})
+	back.SetKubeClientset(kubeClient)
+	back.Service = &types.Service{Name: "svc", Namespace: "oscar-svc", Owner: "owner", Token: "11e387cf727630d899925d57fceb4578f478c44be6cde0ae3fe886d8be513acf"}
+	cfg := types.Config{}
+	r := gin.Default()
+	r.Use(func(c *gin.Context) {
+		c.Set("uidOrigin", "owner")
+	})
+	r.POST("/system/services/:serviceName/tokens/rotate", MakeRotateServiceTokenHandler(&cfg, back, kubeClient))
+
+	// The token is not rotated if the previous one can't be kept during its grace period
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/system/services/svc/tokens/rotate", strings.NewReader(`{"grace_period": 600}`))
+	req.Header.Set("Authorization", "Bearer oidc-token")
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d: %s", w.Code, w.Body.String())
+	}
+	if back.UpdatedService != nil {
+		t.Errorf("expected the service to keep its token, got %+v", back.UpdatedService)
+	}
+}
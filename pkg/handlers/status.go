@@ -87,7 +87,7 @@ func MakeStatusHandler(cfg *types.Config, kubeClientset kubernetes.Interface, me
 		clusterInfo.Cluster.Nodes = make([]types.NodeDetail, 0)
 		clusterInfo.Cluster.Metrics.GPU.TotalGPU = 0
 
-		nodeInfoMap, err := getNodesInfo(kubeClientset, &clusterInfo)
+		nodeInfoMap, err := getNodesInfo(kubeClientset, cfg, &clusterInfo)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error getting node info: %v", err)})
 			return
@@ -131,7 +131,7 @@ func checkIfInterLinkNode(node v1.Node) bool {
 	return false
 }
 
-func getNodesInfo(kubeClientset kubernetes.Interface, clusterInfo *types.StatusInfo) (map[string]*NodeInfoWithAllocatable, error) {
+func getNodesInfo(kubeClientset kubernetes.Interface, cfg *types.Config, clusterInfo *types.StatusInfo) (map[string]*NodeInfoWithAllocatable, error) {
 	nodes, err := kubeClientset.CoreV1().Nodes().List(context.Background(), metav1.ListOptions{})
 	if err != nil {
 		return nil, err
@@ -144,6 +144,11 @@ func getNodesInfo(kubeClientset kubernetes.Interface, clusterInfo *types.StatusI
 
 	nodeInfoMap := make(map[string]*NodeInfoWithAllocatable)
 	var totalGPUs int64 = 0
+	accelerators := []types.AvailableAccelerator{}
+	modelLabel := cfg.GPUModelLabel
+	if modelLabel == "" {
+		modelLabel = types.DefaultGPUModelLabel
+	}
 	eligibleNodes := utils.SelectEligibleNodes(nodes.Items)
 
 	for _, node := range eligibleNodes {
@@ -159,6 +164,8 @@ func getNodesInfo(kubeClientset kubernetes.Interface, clusterInfo *types.StatusI
 			gpu_alloc = gpuVal
 			totalGPUs += gpuVal
 		}
+		// Accelerators of any vendor grouped by resource and model
+		accelerators = types.MergeAccelerators(accelerators, types.NodeAccelerators(node, modelLabel))
 
 		// Calculate CPU and Memory Requests by summing the pods of the node
 		var cpu_request int64 = 0
@@ -277,6 +284,7 @@ func getNodesInfo(kubeClientset kubernetes.Interface, clusterInfo *types.StatusI
 
 	// Update Cluster GPU metrics
 	clusterInfo.Cluster.Metrics.GPU.TotalGPU = totalGPUs
+	clusterInfo.Cluster.Metrics.GPU.Accelerators = accelerators
 
 	return nodeInfoMap, nil
 }
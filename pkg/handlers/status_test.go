@@ -788,7 +788,7 @@ func TestGetNodesInfoAggregatesClusterData(t *testing.T) {
 	fakeClient, _ := makeFakeClients()
 	statusInfo := &types.StatusInfo{}
 
-	nodeInfo, err := getNodesInfo(fakeClient, statusInfo)
+	nodeInfo, err := getNodesInfo(fakeClient, &types.Config{}, statusInfo)
 	if err != nil {
 		t.Fatalf("getNodesInfo returned unexpected error: %v", err)
 	}
@@ -843,7 +843,7 @@ func TestGetMetricsInfoUpdatesUsage(t *testing.T) {
 	fakeClient, metricsClient := makeFakeClients()
 	statusInfo := &types.StatusInfo{}
 
-	nodeInfo, err := getNodesInfo(fakeClient, statusInfo)
+	nodeInfo, err := getNodesInfo(fakeClient, &types.Config{}, statusInfo)
 	if err != nil {
 		t.Fatalf("getNodesInfo returned unexpected error: %v", err)
 	}
@@ -0,0 +1,166 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/grycap/oscar/v4/pkg/types"
+	"github.com/grycap/oscar/v4/pkg/utils/auth"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes"
+)
+
+// MakeCreatePersonalTokenHandler godoc
+// @Summary Create personal access token
+// @Description Create a personal access token of the OIDC user, accepted as a bearer token until it expires or it is revoked. The value of the token is only returned in this response.
+// @Tags tokens
+// @Accept json
+// @Produce json
+// @Param token body types.PersonalTokenRequest true "Token name and validity"
+// @Success 201 {object} types.PersonalToken
+// @Failure 400 {string} string "Bad Request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 500 {string} string "Internal Server Error"
+// @Security BearerAuth
+// @Router /system/tokens [post]
+func MakeCreatePersonalTokenHandler(cfg *types.Config, kubeClientset kubernetes.Interface) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uid, ok := personalTokenOwner(c)
+		if !ok {
+			return
+		}
+		// Personal access tokens can't be used to mint new ones, so a leaked token can't outlive its expiration
+		if auth.IsPersonalToken(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")) {
+			c.String(http.StatusForbidden, "personal access tokens must be created with an OIDC token")
+			return
+		}
+
+		var request types.PersonalTokenRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.String(http.StatusBadRequest, "invalid token request: %v", err)
+			return
+		}
+		expiresIn := time.Duration(request.ExpiresIn) * time.Second
+		if request.ExpiresIn == 0 {
+			expiresIn = cfg.PersonalTokenMaxTTL
+		}
+		if expiresIn <= 0 || (cfg.PersonalTokenMaxTTL > 0 && expiresIn > cfg.PersonalTokenMaxTTL) {
+			c.String(http.StatusBadRequest, "expires_in must be a positive number of seconds up to %d", int64(cfg.PersonalTokenMaxTTL.Seconds()))
+			return
+		}
+
+		token, err := auth.CreatePersonalToken(c.Request.Context(), kubeClientset, cfg.Namespace, uid, auth.GetUserNameFromContext(c), auth.GetUserGroupsFromContext(c), request.Name, time.Now().Add(expiresIn))
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		c.JSON(http.StatusCreated, token)
+	}
+}
+
+// MakeListPersonalTokensHandler godoc
+// @Summary List personal access tokens
+// @Description List the personal access tokens of the OIDC user, without their values.
+// @Tags tokens
+// @Produce json
+// @Success 200 {array} types.PersonalToken
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 500 {string} string "Internal Server Error"
+// @Security BearerAuth
+// @Router /system/tokens [get]
+func MakeListPersonalTokensHandler(cfg *types.Config, kubeClientset kubernetes.Interface) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uid, ok := personalTokenOwner(c)
+		if !ok {
+			return
+		}
+		tokens, err := auth.ListPersonalTokens(c.Request.Context(), kubeClientset, cfg.Namespace, uid)
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, tokens)
+	}
+}
+
+// MakeDeletePersonalTokenHandler godoc
+// @Summary Revoke personal access token
+// @Description Revoke a personal access token of the OIDC user.
+// @Tags tokens
+// @Param tokenID path string true "Token ID"
+// @Success 204 "No Content"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Not Found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Security BearerAuth
+// @Router /system/tokens/{tokenID} [delete]
+func MakeDeletePersonalTokenHandler(cfg *types.Config, kubeClientset kubernetes.Interface) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uid, ok := personalTokenOwner(c)
+		if !ok {
+			return
+		}
+		if err := auth.DeletePersonalToken(c.Request.Context(), kubeClientset, cfg.Namespace, uid, c.Param("tokenID")); err != nil {
+			if apierrors.IsNotFound(err) {
+				c.String(http.StatusNotFound, "personal access token %s not found", c.Param("tokenID"))
+			} else {
+				c.String(http.StatusInternalServerError, err.Error())
+			}
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// personalTokenOwner returns the UID of the user managing its personal access tokens. The basic auth
+// admin has no UID, so it can't own personal access tokens
+func personalTokenOwner(c *gin.Context) (string, bool) {
+	if !isBearerRequest(c) {
+		c.String(http.StatusForbidden, "personal access tokens are only available for OIDC users")
+		return "", false
+	}
+	uid, err := auth.GetUIDFromContext(c)
+	if err != nil {
+		c.String(http.StatusForbidden, err.Error())
+		return "", false
+	}
+	return uid, true
+}
+
+// authenticatePersonalToken checks the personal access token of an invocation, returning it with the UID and
+// groups of its owner. The callers must still check that the owner belongs to the groups allowed in the cluster
+// with auth.CheckPersonalTokenGroups, as they check the groups of the users of OIDC tokens
+func authenticatePersonalToken(c *gin.Context, cfg *types.Config, kubeClientset kubernetes.Interface, rawToken string) (*types.PersonalToken, bool) {
+	token, err := auth.ValidatePersonalToken(c.Request.Context(), kubeClientset, cfg.Namespace, rawToken)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidPersonalToken) {
+			c.Status(http.StatusUnauthorized)
+		} else {
+			c.String(http.StatusInternalServerError, err.Error())
+		}
+		return nil, false
+	}
+	return token, true
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/grycap/oscar/v4/pkg/backends"
+	"github.com/grycap/oscar/v4/pkg/types"
+	"github.com/grycap/oscar/v4/pkg/utils/auth"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	testclient "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestPersonalTokensHandlers(t *testing.T) {
+	cfg := &types.Config{Namespace: "oscar", PersonalTokenMaxTTL: time.Hour}
+	kubeClient := testclient.NewSimpleClientset()
+	r := gin.Default()
+	r.Use(func(c *gin.Context) {
+		if strings.HasPrefix(c.GetHeader("Authorization"), "Bearer ") {
+			c.Set("uidOrigin", "user1")
+			c.Set("userName", "User One")
+			c.Set("userGroups", []string{"vo.example.eu"})
+		}
+	})
+	r.POST("/system/tokens", MakeCreatePersonalTokenHandler(cfg, kubeClient))
+	r.GET("/system/tokens", MakeListPersonalTokensHandler(cfg, kubeClient))
+	r.DELETE("/system/tokens/:tokenID", MakeDeletePersonalTokenHandler(cfg, kubeClient))
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/system/tokens", strings.NewReader(`{"name": "ci", "expires_in": 600}`))
+	req.Header.Set("Authorization", "Bearer oidc-token")
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var created types.PersonalToken
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if !auth.IsPersonalToken(created.Token) || created.Owner != "user1" || created.Name != "ci" {
+		t.Fatalf("unexpected token: %+v", created)
+	}
+	if ttl := created.ExpiresAt.Sub(created.CreatedAt); ttl < 9*time.Minute || ttl > 11*time.Minute {
+		t.Errorf("expected the token to expire in 600 seconds, got %v", ttl)
+	}
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/system/tokens", nil)
+	req.Header.Set("Authorization", "Bearer oidc-token")
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var tokens []types.PersonalToken
+	if err := json.Unmarshal(w.Body.Bytes(), &tokens); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(tokens) != 1 || tokens[0].ID != created.ID || tokens[0].Token != "" {
+		t.Fatalf("unexpected tokens: %+v", tokens)
+	}
+
+	// Personal access tokens can't mint new tokens
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/system/tokens", strings.NewReader(`{"name": "other"}`))
+	req.Header.Set("Authorization", "Bearer "+created.Token)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 creating a token with a personal access token, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodDelete, "/system/tokens/"+created.ID, nil)
+	req.Header.Set("Authorization", "Bearer oidc-token")
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d: %s", w.Code, w.Body.String())
+	}
+	if _, err := auth.ValidatePersonalToken(context.Background(), kubeClient, cfg.Namespace, created.Token); err == nil {
+		t.Errorf("expected the revoked token to be rejected")
+	}
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodDelete, "/system/tokens/"+created.ID, nil)
+	req.Header.Set("Authorization", "Bearer oidc-token")
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 revoking a revoked token, got %d", w.Code)
+	}
+}
+
+func TestCreatePersonalTokenHandlerErrors(t *testing.T) {
+	cfg := &types.Config{Namespace: "oscar", PersonalTokenMaxTTL: time.Hour}
+	r := gin.Default()
+	r.Use(func(c *gin.Context) {
+		if strings.HasPrefix(c.GetHeader("Authorization"), "Bearer ") {
+			c.Set("uidOrigin", "user1")
+			c.Set("userName", "User One")
+			c.Set("userGroups", []string{"vo.example.eu"})
+		}
+	})
+	r.POST("/system/tokens", MakeCreatePersonalTokenHandler(cfg, testclient.NewSimpleClientset()))
+
+	scenarios := []struct {
+		name          string
+		authorization string
+		body          string
+		code          int
+	}{
+		{"basic auth", "Basic b3NjYXI6cGFzcw==", `{"name": "ci"}`, http.StatusForbidden},
+		{"missing name", "Bearer oidc-token", `{"expires_in": 60}`, http.StatusBadRequest},
+		{"over max ttl", "Bearer oidc-token", `{"name": "ci", "expires_in": 7200}`, http.StatusBadRequest},
+		{"negative ttl", "Bearer oidc-token", `{"name": "ci", "expires_in": -1}`, http.StatusBadRequest},
+	}
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/system/tokens", strings.NewReader(s.body))
+			req.Header.Set("Authorization", s.authorization)
+			r.ServeHTTP(w, req)
+			if w.Code != s.code {
+				t.Errorf("expected %d, got %d: %s", s.code, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestMakeJobHandlerPersonalToken(t *testing.T) {
+	kubeClient := testclient.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "user1", Namespace: auth.ServicesNamespace},
+	})
+	back := backends.MakeFakeBackend()
+	back.Services = []*types.Service{{
+		Name:   "testName",
+		Owner:  "user1",
+		Token:  "11e387cf727630d899925d57fceb4578f478c44be6cde0ae3fe886d8be513acf",
+		CPU:    "100m",
+		Memory: "128Mi",
+		Labels: map[string]string{},
+	}}
+	cfg := &types.Config{Namespace: "oscar", OIDCGroups: []string{"vo.example.eu"}}
+
+	ctx := context.Background()
+	token, err := auth.CreatePersonalToken(ctx, kubeClient, cfg.Namespace, "user1", "", []string{"vo.example.eu"}, "ci", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	otherVO, err := auth.CreatePersonalToken(ctx, kubeClient, cfg.Namespace, "user1", "", []string{"other.vo"}, "old", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	r := gin.New()
+	r.POST("/job/:serviceName", MakeJobHandler(cfg, kubeClient, back, nil))
+
+	scenarios := []struct {
+		name  string
+		token string
+		code  int
+	}{
+		{"valid token", token.Token, http.StatusCreated},
+		{"unknown token", token.Token[:len(token.Token)-1] + "x", http.StatusUnauthorized},
+		{"owner out of the groups", otherVO.Token, http.StatusUnauthorized},
+	}
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/job/testName", strings.NewReader(`{"key": "value"}`))
+			req.Header.Set("Authorization", "Bearer "+s.token)
+			r.ServeHTTP(w, req)
+			if w.Code != s.code {
+				t.Errorf("expected %d, got %d: %s", s.code, w.Code, w.Body.String())
+			}
+		})
+	}
+
+	// Only the valid token creates a job
+	if jobs, _ := kubeClient.BatchV1().Jobs("").List(ctx, metav1.ListOptions{}); len(jobs.Items) != 1 {
+		t.Errorf("expected 1 job, got %d", len(jobs.Items))
+	}
+}
@@ -41,7 +41,9 @@ var updateLogger = log.New(os.Stdout, "[UPDATE-HANDLER] ", log.Flags())
 // @Accept json
 // @Produce json
 // @Param service body types.Service true "Service definition"
+// @Param dryRun query bool false "Validate and render the service without updating it"
 // @Success 204 {string} string "No Content"
+// @Success 200 {object} types.ServicePlan "Dry-run plan"
 // @Failure 400 {string} string "Bad Request"
 // @Failure 401 {string} string "Unauthorized"
 // @Failure 403 {string} string "Forbidden"
@@ -52,361 +54,363 @@ var updateLogger = log.New(os.Stdout, "[UPDATE-HANDLER] ", log.Flags())
 // @Router /system/services [put]
 func MakeUpdateHandler(cfg *types.Config, back types.ServerlessBackend) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var provName string
 		var newService types.Service
-		var uid string
-		var mc *auth.MultitenancyConfig
 		if err := c.ShouldBindJSON(&newService); err != nil {
 			c.String(http.StatusBadRequest, fmt.Sprintf("The service specification is not valid: %v", err))
 			return
 		}
-		rawInput := cloneStorageIOConfigs(newService.Input)
-		rawOutput := cloneStorageIOConfigs(newService.Output)
-		if err := normalizeStoragePaths(&newService); err != nil {
-			c.String(http.StatusBadRequest, err.Error())
+		if isDryRun(c) {
+			dryRunService(c, cfg, back, &newService, planOperationUpdate)
 			return
 		}
-		newService.AllowedUsers = sanitizeUsers(newService.AllowedUsers)
-		newService.Script = utils.NormalizeLineEndings(newService.Script)
-
-		// Check service values and set defaults
-		checkValues(&newService, cfg)
-		utils.ApplyFederation(&newService)
-		if err := utils.ValidateVolumeConfig(newService.Name, newService.Volume); err != nil {
-			c.String(http.StatusBadRequest, fmt.Sprintf("The service specification is not valid: %v", err))
-			return
-		}
-		authHeader := c.GetHeader("Authorization")
-		isAdminUser := false
-		if len(strings.Split(authHeader, "Bearer")) == 1 {
-			isAdminUser = true
-			createLogger.Printf("[*] Updating service as admin user")
-		}
-		// Read the current service
-		oldService, err := back.ReadService("", newService.Name)
+		status, message := updateService(makeServiceCaller(c), cfg, back, newService)
+		writeServiceResponse(c, status, message)
+	}
+}
 
-		if err != nil {
-			// Check if error is caused because the service is not found
-			if errors.IsNotFound(err) || errors.IsGone(err) {
-				c.Status(http.StatusNotFound)
-			} else {
-				c.String(http.StatusInternalServerError, fmt.Sprintf("Error updating the service: %v", err))
-			}
-			return
-		}
+// updateService updates the service on behalf of the caller, returning the status and message of the response
+func updateService(caller serviceCaller, cfg *types.Config, back types.ServerlessBackend, newService types.Service) (int, string) {
+	status, message, _ := updateServiceWithRevision(caller, cfg, back, newService, types.RevisionOperationUpdate, 0)
+	return status, message
+}
 
-		if !utils.SameVolumeConfig(oldService.Volume, newService.Volume) {
-			c.String(http.StatusBadRequest, "volume updates are not supported after service creation")
-			return
-		}
+// updateServiceWithRevision updates the service recording a revision with the provided operation,
+// which is also returned (nil if it could not be recorded). The first error, including a failed check
+// of the VO of the caller, stops the update and is returned. The errors found before updating the
+// service keep its previous definition.
+func updateServiceWithRevision(caller serviceCaller, cfg *types.Config, back types.ServerlessBackend, newService types.Service, operation string, sourceRevision int) (int, string, *types.ServiceRevision) {
+	var provName string
+	var uid string
+	var mc *auth.MultitenancyConfig
+	rawInput := cloneStorageIOConfigs(newService.Input)
+	rawOutput := cloneStorageIOConfigs(newService.Output)
+	if err := normalizeStoragePaths(&newService); err != nil {
+		return http.StatusBadRequest, err.Error(), nil
+	}
+	newService.AllowedUsers = sanitizeUsers(newService.AllowedUsers)
+	newService.Script = utils.NormalizeLineEndings(newService.Script)
+
+	// Check service values and set defaults
+	checkValues(&newService, cfg)
+	utils.ApplyFederation(&newService)
+	if errs := validateServiceSpec(&newService, cfg); len(errs) > 0 {
+		return http.StatusBadRequest, fmt.Sprintf("The service specification is not valid: %v", errs[0]), nil
+	}
+	isAdminUser := caller.isAdmin()
+	if isAdminUser {
+		createLogger.Printf("[*] Updating service as admin user")
+	}
+	// Read the current service
+	oldService, err := back.ReadService("", newService.Name)
 
-		if oldService.Token != "" {
-			newService.Token = oldService.Token
+	if err != nil {
+		// Check if error is caused because the service is not found
+		if errors.IsNotFound(err) || errors.IsGone(err) {
+			return http.StatusNotFound, "", nil
 		}
+		return http.StatusInternalServerError, fmt.Sprintf("Error updating the service: %v", err), nil
+	}
 
-		serviceNamespace := oldService.Namespace
-		if serviceNamespace == "" {
-			serviceNamespace = cfg.ServicesNamespace
-		}
-		newService.Namespace = serviceNamespace
+	if !utils.SameVolumeConfig(oldService.Volume, newService.Volume) {
+		return http.StatusBadRequest, "volume updates are not supported after service creation", nil
+	}
 
-		if !isAdminUser {
-			uid, err = auth.GetUIDFromContext(c)
+	if oldService.Token != "" {
+		newService.Token = oldService.Token
+	}
 
-			if err != nil {
-				c.String(http.StatusInternalServerError, fmt.Sprintln("Couldn't get UID from context"))
-			}
+	serviceNamespace := oldService.Namespace
+	if serviceNamespace == "" {
+		serviceNamespace = cfg.ServicesNamespace
+	}
+	newService.Namespace = serviceNamespace
 
-			if oldService.Owner != uid {
-				c.String(http.StatusForbidden, "User %s doesn't have permision to modify this service", uid)
-				return
-			}
-			mc, err = auth.GetMultitenancyConfigFromContext(c)
+	if !isAdminUser {
+		uid = caller.uid
+		if uid == "" {
+			return http.StatusInternalServerError, fmt.Sprintln("Couldn't get UID from context"), nil
+		}
 
-			if err != nil {
-				c.String(http.StatusInternalServerError, fmt.Sprintln("Couldn't get UID from context"))
-			}
+		if !caller.hasServiceRole(oldService, types.ServiceRoleEditor) {
+			return http.StatusForbidden, fmt.Sprintf("User %s doesn't have permision to modify this service", uid), nil
+		}
+		// Only the owners can share the service
+		if !caller.hasServiceRole(oldService, types.ServiceRoleOwner) {
+			newService.Visibility = oldService.Visibility
+			newService.AllowedUsers = oldService.AllowedUsers
+			newService.ACL = oldService.ACL
+		}
+		mc = caller.mc
+		if mc == nil {
+			return http.StatusInternalServerError, fmt.Sprintln("missing multitenancy config"), nil
+		}
 
-			if err := mc.EnsureSecretInNamespace(newService.Owner, serviceNamespace); err != nil {
-				c.String(http.StatusInternalServerError, fmt.Sprintf("error ensuring credentials for user %s: %v", newService.Owner, err))
-				return
-			}
+		// Set the owner on the new service definition
+		newService.Owner = oldService.Owner
 
-			// Set the owner on the new service definition
-			newService.Owner = oldService.Owner
+		if err := mc.EnsureSecretInNamespace(newService.Owner, serviceNamespace); err != nil {
+			return http.StatusInternalServerError, fmt.Sprintf("error ensuring credentials for user %s: %v", newService.Owner, err), nil
+		}
 
-			// If the service has changed VO check permisions again
-			if newService.VO != "" && newService.VO != oldService.VO {
-				for _, vo := range cfg.OIDCGroups {
-					if vo == newService.VO {
-						authHeader := c.GetHeader("Authorization")
-						err := checkIdentity(&newService, authHeader)
-						if err != nil {
-							c.String(http.StatusBadRequest, fmt.Sprintln(err))
-						}
-						break
+		// If the service has changed VO check permisions again
+		if newService.VO != "" && newService.VO != oldService.VO {
+			for _, vo := range cfg.OIDCGroups {
+				if vo == newService.VO {
+					if err := checkRequestIdentity(&newService, caller.authHeader, caller.groups); err != nil {
+						return http.StatusBadRequest, fmt.Sprintln(err), nil
 					}
+					break
 				}
 			}
 		}
+	}
+
+	minIOAdminClient, _ := utils.MakeMinIOAdminClient(cfg)
+	s3Client := cfg.MinIOProvider.GetS3Client()
+	if newService.IsolationLevel == types.IsolationLevelUser && len(newService.AllowedUsers) > 0 {
+		// new bucket list
+		ownerOnList := false
+		// The user buckets are labelled with the owner, also when an editor updates the service
+		bucketOwner := uid
+		if !isAdminUser {
+			bucketOwner = newService.Owner
+		}
+		full_uid := auth.FormatUID(bucketOwner)
+		for _, in := range newService.Input {
+			_, provName := getProviderInfo(in.Provider)
 
-		minIOAdminClient, _ := utils.MakeMinIOAdminClient(cfg)
-		s3Client := cfg.MinIOProvider.GetS3Client()
-		if newService.IsolationLevel == types.IsolationLevelUser && len(newService.AllowedUsers) > 0 {
-			// new bucket list
-			ownerOnList := false
-			full_uid := auth.FormatUID(uid)
-			for _, in := range newService.Input {
-				_, provName := getProviderInfo(in.Provider)
-
-				// Only allow input from MinIO
-				if provName == types.MinIOName {
-					path := strings.Trim(in.Path, "/")
-					splitPath := strings.SplitN(path, "/", 2)
-					// If AllowedUsers is empty don't add uid
-					newService.Labels["uid"] = full_uid[:10]
-					var userBucket string
-					for _, u := range newService.AllowedUsers {
-						// Check if the uid's from allowed_users have and asociated MinIO user
-						// and create it if not
-						if mc != nil && !mc.UserExists(u) {
-							sk, _ := auth.GenerateRandomKey(8)
-							cmuErr := minIOAdminClient.CreateMinIOUser(u, sk)
-							if cmuErr != nil {
-								log.Printf("error creating MinIO user for user %s: %v", u, cmuErr)
-							}
-							csErr := mc.CreateSecretForOIDC(u, sk)
-							if csErr != nil {
-								log.Printf("error creating secret for user %s: %v", u, csErr)
-							}
+			// Only allow input from MinIO
+			if provName == types.MinIOName {
+				path := strings.Trim(in.Path, "/")
+				splitPath := strings.SplitN(path, "/", 2)
+				// If AllowedUsers is empty don't add uid
+				newService.Labels["uid"] = full_uid[:10]
+				var userBucket string
+				for _, u := range newService.AllowedUsers {
+					// Check if the uid's from allowed_users have and asociated MinIO user
+					// and create it if not
+					if mc != nil && !mc.UserExists(u) {
+						sk, _ := auth.GenerateRandomKey(8)
+						cmuErr := minIOAdminClient.CreateMinIOUser(u, sk)
+						if cmuErr != nil {
+							log.Printf("error creating MinIO user for user %s: %v", u, cmuErr)
 						}
-						// Fill the list of private buckets to be used on users buckets isolation
-						// Check the uid of the owner is on the allowed_users list
-						if u == newService.Owner {
-							ownerOnList = true
+						csErr := mc.CreateSecretForOIDC(u, sk)
+						if csErr != nil {
+							log.Printf("error creating secret for user %s: %v", u, csErr)
 						}
-						// Fill the list of private buckets to create
-						userBucket = splitPath[0] + "-" + u[:10]
-						newService.BucketList = append(newService.BucketList, userBucket)
-						if mc != nil {
-							if err := mc.EnsureSecretInNamespace(u, serviceNamespace); err != nil {
-								c.String(http.StatusInternalServerError, fmt.Sprintf("error ensuring credentials for user %s: %v", u, err))
-								return
-							}
+					}
+					// Fill the list of private buckets to be used on users buckets isolation
+					// Check the uid of the owner is on the allowed_users list
+					if u == newService.Owner {
+						ownerOnList = true
+					}
+					// Fill the list of private buckets to create
+					userBucket = splitPath[0] + "-" + u[:10]
+					newService.BucketList = append(newService.BucketList, userBucket)
+					if mc != nil {
+						if err := mc.EnsureSecretInNamespace(u, serviceNamespace); err != nil {
+							return http.StatusInternalServerError, fmt.Sprintf("error ensuring credentials for user %s: %v", u, err), nil
 						}
 					}
+				}
 
-					if !ownerOnList {
-						newService.AllowedUsers = append(newService.AllowedUsers, uid)
-					}
-					/// Create
+				if !ownerOnList {
+					newService.AllowedUsers = append(newService.AllowedUsers, bucketOwner)
 				}
+				/// Create
 			}
 		}
+	}
 
-		if oldService.IsolationLevel == types.IsolationLevelUser && len(oldService.BucketList) != 0 {
-			for _, bucket := range oldService.BucketList {
-				if !slices.Contains(newService.BucketList, bucket) {
-					// Disable input notifications for service bucket
-					if err := disableInputNotifications(s3Client, oldService.GetMinIOWebhookARN(), bucket); err != nil {
-						log.Printf("Error disabling MinIO input notifications for service \"%s\": %v\n", oldService.Name, err)
-					}
+	if oldService.IsolationLevel == types.IsolationLevelUser && len(oldService.BucketList) != 0 {
+		for _, bucket := range oldService.BucketList {
+			if !slices.Contains(newService.BucketList, bucket) {
+				// Disable input notifications for service bucket
+				if err := disableInputNotifications(s3Client, oldService.GetMinIOWebhookARN(), bucket); err != nil {
+					log.Printf("Error disabling MinIO input notifications for service \"%s\": %v\n", oldService.Name, err)
+				}
 
-					err := DeleteMinIOBuckets(s3Client, minIOAdminClient, utils.MinIOBucket{
-						BucketName:   bucket,
-						Visibility:   utils.PRIVATE,
-						AllowedUsers: []string{},
-						Owner:        oldService.Owner,
-					})
-					if err != nil {
-						log.Printf("error while removing MinIO bucket %v", err)
-					}
+				err := DeleteMinIOBuckets(s3Client, minIOAdminClient, utils.MinIOBucket{
+					BucketName:   bucket,
+					Visibility:   utils.PRIVATE,
+					AllowedUsers: []string{},
+					Owner:        oldService.Owner,
+				})
+				if err != nil {
+					log.Printf("error while removing MinIO bucket %v", err)
 				}
 			}
 		}
+	}
 
-		// If isolation level was USER delete all private buckets
-		if strings.ToUpper(oldService.IsolationLevel) == types.IsolationLevelUser && strings.ToUpper(newService.IsolationLevel) == types.IsolationLevelUser {
-			// TODO add/remove users buckets
-		}
+	// If isolation level was USER delete all private buckets
+	if strings.ToUpper(oldService.IsolationLevel) == types.IsolationLevelUser && strings.ToUpper(newService.IsolationLevel) == types.IsolationLevelUser {
+		// TODO add/remove users buckets
+	}
 
-		// Use create buckets function to create new inputs/outputs if needed
-		var newServiceBuckets []utils.MinIOBucket
-		if newServiceBuckets, err = createBuckets(&newService, cfg, minIOAdminClient, true); err != nil {
-			if err == errInput {
-				c.String(http.StatusBadRequest, err.Error())
-			} else {
-				c.String(http.StatusInternalServerError, err.Error())
-			}
-			// If createBuckets fails restore the oldService
-			uerr := back.UpdateService(*oldService)
-			if uerr != nil {
-				log.Println(uerr.Error())
-			}
-			return
+	// Use create buckets function to create new inputs/outputs if needed
+	var newServiceBuckets []utils.MinIOBucket
+	if newServiceBuckets, err = createBuckets(&newService, cfg, minIOAdminClient, true, isAdminUser); err != nil {
+		// The service has not been updated yet, so the old definition is kept
+		if err == errInput {
+			return http.StatusBadRequest, err.Error(), nil
 		}
+		return http.StatusInternalServerError, err.Error(), nil
+	}
 
-		// Get old service buckets and compare to the new ones
-		var oldServiceBuckets = make(map[string]bool)
-		// Set true all MinIO buckets of the previous definition
-		for _, in := range oldService.Input {
+	// Get old service buckets and compare to the new ones
+	var oldServiceBuckets = make(map[string]bool)
+	// Set true all MinIO buckets of the previous definition
+	for _, in := range oldService.Input {
 
-			_, provName = getProviderInfo(in.Provider)
+		_, provName = getProviderInfo(in.Provider)
 
-			if provName == types.MinIOName {
-				path := strings.Trim(in.Path, " /")
-				// Split buckets and folders from path
-				splitPath := strings.SplitN(path, "/", 2)
-				oldServiceBuckets[splitPath[0]] = true
-			}
+		if provName == types.MinIOName {
+			path := strings.Trim(in.Path, " /")
+			// Split buckets and folders from path
+			splitPath := strings.SplitN(path, "/", 2)
+			oldServiceBuckets[splitPath[0]] = true
 		}
-		for _, in := range oldService.Output {
+	}
+	for _, in := range oldService.Output {
 
-			_, provName = getProviderInfo(in.Provider)
+		_, provName = getProviderInfo(in.Provider)
 
-			if provName == types.MinIOName {
-				path := strings.Trim(in.Path, " /")
-				// Split buckets and folders from path
-				splitPath := strings.SplitN(path, "/", 2)
-				oldServiceBuckets[splitPath[0]] = true
-			}
+		if provName == types.MinIOName {
+			path := strings.Trim(in.Path, " /")
+			// Split buckets and folders from path
+			splitPath := strings.SplitN(path, "/", 2)
+			oldServiceBuckets[splitPath[0]] = true
 		}
-		if len(newServiceBuckets) > 0 {
-			for _, b := range newServiceBuckets {
-				if oldServiceBuckets[b.BucketName] {
-					// If the visibility of the bucket has changed remove old policies and config new ones
-					if oldService.Visibility != newService.Visibility {
-						err := minIOAdminClient.UnsetPolicies(utils.MinIOBucket{
-							BucketName:   b.BucketName,
-							AllowedUsers: oldService.AllowedUsers,
-							Visibility:   oldService.Visibility,
-							Owner:        oldService.Owner,
-						})
-						if err != nil {
-							c.String(http.StatusInternalServerError, fmt.Sprintf("Error creating the service: %v", err))
-						}
-						// If not specified default visibility is PRIVATE
-						if strings.ToLower(newService.Visibility) == "" {
-							b.Visibility = utils.PRIVATE
-						}
-						err = minIOAdminClient.SetPolicies(b)
-						if err != nil {
-							c.String(http.StatusInternalServerError, fmt.Sprintf("Error creating the service: %v", err))
-						}
-					} else {
-						if newService.Visibility == utils.RESTRICTED {
-							err := minIOAdminClient.UpdateServiceGroup(b.BucketName, newService.AllowedUsers)
-							if err != nil {
-								c.String(http.StatusInternalServerError, fmt.Sprintf("Error creating the service: %v", err))
-							}
-						}
+	}
+	if len(newServiceBuckets) > 0 {
+		for _, b := range newServiceBuckets {
+			if oldServiceBuckets[b.BucketName] {
+				// If the visibility of the bucket has changed remove old policies and config new ones
+				if oldService.Visibility != newService.Visibility {
+					err := minIOAdminClient.UnsetPolicies(utils.MinIOBucket{
+						BucketName:   b.BucketName,
+						AllowedUsers: oldService.AllowedUsers,
+						Visibility:   oldService.Visibility,
+						Owner:        oldService.Owner,
+					})
+					if err != nil {
+						return http.StatusInternalServerError, fmt.Sprintf("Error creating the service: %v", err), nil
 					}
-					// Set false to know which buckets need to be private
-					oldServiceBuckets[b.BucketName] = false
-				} else {
-					// If the bucket didn't exist on the old service assume its created an set policies & webhooks
-					err := minIOAdminClient.SetPolicies(b)
+					// If not specified default visibility is PRIVATE
+					if strings.ToLower(newService.Visibility) == "" {
+						b.Visibility = utils.PRIVATE
+					}
+					err = minIOAdminClient.SetPolicies(b)
 					if err != nil {
-						c.String(http.StatusInternalServerError, fmt.Sprintf("Error creating the service: %v", err))
+						return http.StatusInternalServerError, fmt.Sprintf("Error creating the service: %v", err), nil
 					}
-					// Register minio webhook and restart the server
-					if err = registerMinIOWebhook(newService.Name, newService.Token, newService.StorageProviders.MinIO[types.DefaultProvider], cfg); err != nil {
-						uerr := back.UpdateService(*oldService)
-						if uerr != nil {
-							log.Println(uerr.Error())
+				} else {
+					if newService.Visibility == utils.RESTRICTED {
+						err := minIOAdminClient.UpdateServiceGroup(b.BucketName, newService.AllowedUsers)
+						if err != nil {
+							return http.StatusInternalServerError, fmt.Sprintf("Error creating the service: %v", err), nil
 						}
-						c.String(http.StatusInternalServerError, err.Error())
-						return
 					}
 				}
-			}
-		}
-
-		for key, value := range oldServiceBuckets {
-			// If the bucket was not used in the new service definition set it to private
-			if value {
-				err := minIOAdminClient.SetPolicies(utils.MinIOBucket{BucketName: key, Visibility: utils.PRIVATE})
+				// Set false to know which buckets need to be private
+				oldServiceBuckets[b.BucketName] = false
+			} else {
+				// If the bucket didn't exist on the old service assume its created an set policies & webhooks
+				err := minIOAdminClient.SetPolicies(b)
 				if err != nil {
-					c.String(http.StatusInternalServerError, "error setting new policies: %v", err)
+					return http.StatusInternalServerError, fmt.Sprintf("Error creating the service: %v", err), nil
+				}
+				// Register minio webhook and restart the server
+				if err = registerMinIOWebhook(newService.Name, newService.Token, newService.StorageProviders.MinIO[types.DefaultProvider], cfg); err != nil {
+					return http.StatusInternalServerError, err.Error(), nil
 				}
 			}
 		}
+	}
 
-		refreshToken := extractRefreshTokenSecret(&newService)
-		if newService.HasFederationMembers() {
-			refreshTokenSecretName := utils.RefreshTokenSecretName(newService.Name)
-			if refreshToken == "" && !utils.SecretExists(refreshTokenSecretName, serviceNamespace, back.GetKubeClientset()) {
-				c.String(http.StatusBadRequest, "refresh_token secret is required for federated services")
-				return
+	for key, value := range oldServiceBuckets {
+		// If the bucket was not used in the new service definition set it to private
+		if value {
+			err := minIOAdminClient.SetPolicies(utils.MinIOBucket{BucketName: key, Visibility: utils.PRIVATE})
+			if err != nil {
+				return http.StatusInternalServerError, fmt.Sprintf("error setting new policies: %v", err), nil
 			}
 		}
-		if refreshToken != "" {
-			if err := upsertRefreshTokenSecret(&newService, serviceNamespace, refreshToken, back.GetKubeClientset()); err != nil {
-				c.String(http.StatusInternalServerError, "error updating refresh-token secret: %v", err)
-				return
-			}
+	}
+
+	refreshToken := extractRefreshTokenSecret(&newService)
+	if newService.HasFederationMembers() {
+		refreshTokenSecretName := utils.RefreshTokenSecretName(newService.Name)
+		if refreshToken == "" && !utils.SecretExists(refreshTokenSecretName, serviceNamespace, back.GetKubeClientset()) {
+			return http.StatusBadRequest, "refresh_token secret is required for federated services", nil
 		}
+	}
+	if refreshToken != "" {
+		if err := upsertRefreshTokenSecret(&newService, serviceNamespace, refreshToken, back.GetKubeClientset()); err != nil {
+			return http.StatusInternalServerError, fmt.Sprintf("error updating refresh-token secret: %v", err), nil
+		}
+	}
 
-		federationRefreshToken := refreshToken
-		if federationRefreshToken == "" && newService.HasFederationMembers() {
-			var err error
-			federationRefreshToken, err = readRefreshTokenSecretValue(newService.Name, serviceNamespace, back.GetKubeClientset())
-			if err != nil {
-				c.String(http.StatusInternalServerError, "error reading refresh-token secret: %v", err)
-				return
-			}
+	federationRefreshToken := refreshToken
+	if federationRefreshToken == "" && newService.HasFederationMembers() {
+		var err error
+		federationRefreshToken, err = readRefreshTokenSecretValue(newService.Name, serviceNamespace, back.GetKubeClientset())
+		if err != nil {
+			return http.StatusInternalServerError, fmt.Sprintf("error reading refresh-token secret: %v", err), nil
 		}
+	}
 
-		// Update service secret data or create it
-		if len(newService.Environment.Secrets) > 0 {
-			if utils.SecretExists(newService.Name, serviceNamespace, back.GetKubeClientset()) {
-				secretsErr := utils.UpdateSecretData(newService.Name, serviceNamespace, newService.Environment.Secrets, back.GetKubeClientset())
-				if secretsErr != nil {
-					c.String(http.StatusInternalServerError, "error updating asociated secret: %v", secretsErr)
-					return
-				}
-			} else {
-				secretsErr := utils.CreateSecret(newService.Name, serviceNamespace, newService.Environment.Secrets, back.GetKubeClientset())
-				if secretsErr != nil {
-					c.String(http.StatusInternalServerError, "error adding asociated secret: %v", secretsErr)
-					return
-				}
+	// Update service secret data or create it
+	if len(newService.Environment.Secrets) > 0 {
+		if utils.SecretExists(newService.Name, serviceNamespace, back.GetKubeClientset()) {
+			secretsErr := utils.UpdateSecretData(newService.Name, serviceNamespace, newService.Environment.Secrets, back.GetKubeClientset())
+			if secretsErr != nil {
+				return http.StatusInternalServerError, fmt.Sprintf("error updating asociated secret: %v", secretsErr), nil
 			}
-			// Empty the secrets content from the Configmap
-			for secretKey := range newService.Environment.Secrets {
-				newService.Environment.Secrets[secretKey] = ""
+		} else {
+			secretsErr := utils.CreateSecret(newService.Name, serviceNamespace, newService.Environment.Secrets, back.GetKubeClientset())
+			if secretsErr != nil {
+				return http.StatusInternalServerError, fmt.Sprintf("error adding asociated secret: %v", secretsErr), nil
 			}
 		}
-
-		if err := back.UpdateService(newService); err != nil {
-			uerr := back.UpdateService(*oldService)
-			if uerr != nil {
-				log.Println(uerr.Error())
-			}
-			c.String(http.StatusInternalServerError, fmt.Sprintf("Error updating the service: %v", err))
-			return
+		// Empty the secrets content from the Configmap
+		for secretKey := range newService.Environment.Secrets {
+			newService.Environment.Secrets[secretKey] = ""
 		}
+	}
 
-		if newService.Annotations != nil &&
-			strings.EqualFold(strings.TrimSpace(newService.Annotations[types.FederationWorkerAnnotation]), "true") &&
-			newService.Federation != nil &&
-			strings.EqualFold(strings.TrimSpace(newService.Federation.Topology), "mesh") {
-			// Worker services should not trigger federation expansion or manage origin buckets.
-			c.Status(http.StatusNoContent)
-			return
+	if err := back.UpdateService(newService); err != nil {
+		uerr := back.UpdateService(*oldService)
+		if uerr != nil {
+			log.Println(uerr.Error())
 		}
-
-		if newService.HasFederationMembers() {
-			authHeader := c.GetHeader("Authorization")
-			federated := newService
-			federated.Input = rawInput
-			federated.Output = rawOutput
-			if errs := utils.ExpandFederation(&federated, authHeader, http.MethodPut, federationRefreshToken); len(errs) > 0 {
-				c.String(http.StatusOK, fmt.Sprintf("Updated with federation warnings: %v", errs))
-				return
-			}
+		return http.StatusInternalServerError, fmt.Sprintf("Error updating the service: %v", err), nil
+	}
+	// Create, update or delete the CronJob of the scheduled invocations
+	if err := syncServiceSchedule(caller.ctx, cfg, back.GetKubeClientset(), newService); err != nil {
+		return http.StatusInternalServerError, fmt.Sprintf("Error updating the service schedule: %v", err), nil
+	}
+	recorded := recordServiceRevision(caller, cfg, back, newService, operation, sourceRevision)
+
+	if newService.Annotations != nil &&
+		strings.EqualFold(strings.TrimSpace(newService.Annotations[types.FederationWorkerAnnotation]), "true") &&
+		newService.Federation != nil &&
+		strings.EqualFold(strings.TrimSpace(newService.Federation.Topology), "mesh") {
+		// Worker services should not trigger federation expansion or manage origin buckets.
+		return http.StatusNoContent, "", recorded
+	}
+	syncACLBucketPolicies(cfg, &newService, oldService)
+
+	if newService.HasFederationMembers() {
+		federated := newService
+		federated.Input = rawInput
+		federated.Output = rawOutput
+		if errs := utils.ExpandFederation(&federated, caller.authHeader, http.MethodPut, federationRefreshToken); len(errs) > 0 {
+			return http.StatusOK, fmt.Sprintf("Updated with federation warnings: %v", errs), recorded
 		}
-
-		c.Status(http.StatusNoContent)
 	}
+
+	return http.StatusNoContent, "", recorded
 }
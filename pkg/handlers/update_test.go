@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -12,6 +13,8 @@ import (
 	"github.com/grycap/oscar/v4/pkg/testsupport"
 	"github.com/grycap/oscar/v4/pkg/types"
 	"github.com/grycap/oscar/v4/pkg/utils/auth"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	testclient "k8s.io/client-go/kubernetes/fake"
 )
 
@@ -149,6 +152,34 @@ func TestMakeUpdateHandlerUnauthorizedVO(t *testing.T) {
 	if resp.Code != http.StatusBadRequest {
 		t.Fatalf("expected 400 when VO not authorized, got %d", resp.Code)
 	}
+	// The update stops on the first error
+	if back.UpdatedService != nil {
+		t.Fatalf("expected backend not to update service, got %+v", back.UpdatedService)
+	}
+}
+
+func TestMakeUpdateHandlerInvalidInputKeepsService(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	back := backends.MakeFakeBackend()
+	back.Service = &types.Service{Name: "svc", Owner: types.DefaultOwner}
+	cfg := &types.Config{MinIOProvider: &types.MinIOProvider{}}
+
+	r := gin.New()
+	r.PUT("/system/services", MakeUpdateHandler(cfg, back))
+
+	body := `{"name":"svc","image":"img","script":"echo","input":[{"storage_provider":"s3.default","path":"bucket/in"}]}`
+	req := httptest.NewRequest(http.MethodPut, "/system/services", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusBadRequest || resp.Body.String() != errInput.Error() {
+		t.Fatalf("expected 400 for an invalid input, got %d: %s", resp.Code, resp.Body.String())
+	}
+	// Nothing was updated, so the old definition is not written back
+	if back.UpdatedService != nil {
+		t.Fatalf("expected backend not to update service, got %+v", back.UpdatedService)
+	}
 }
 
 func TestMakeUpdateHandlerForbiddenOwner(t *testing.T) {
@@ -156,7 +187,6 @@ func TestMakeUpdateHandlerForbiddenOwner(t *testing.T) {
 	back := backends.MakeFakeBackend()
 	back.Service = &types.Service{Name: "svc", Owner: "owner"}
 	cfg := &types.Config{MinIOProvider: &types.MinIOProvider{}}
-	isAdminUser = false
 
 	r := gin.New()
 	r.Use(func(c *gin.Context) {
@@ -175,6 +205,9 @@ func TestMakeUpdateHandlerForbiddenOwner(t *testing.T) {
 	if resp.Code != http.StatusForbidden {
 		t.Fatalf("expected 403 for different owner, got %d: %s", resp.Code, resp.Body.String())
 	}
+	if back.UpdatedService != nil {
+		t.Fatalf("expected backend not to update service, got %+v", back.UpdatedService)
+	}
 }
 
 func TestMakeUpdateHandlerIgnoresStaleGlobalAdminState(t *testing.T) {
@@ -182,25 +215,31 @@ func TestMakeUpdateHandlerIgnoresStaleGlobalAdminState(t *testing.T) {
 	back := backends.MakeFakeBackend()
 	back.Service = &types.Service{Name: "svc", Owner: "owner"}
 	cfg := &types.Config{MinIOProvider: &types.MinIOProvider{}}
-	isAdminUser = true
-	defer func() { isAdminUser = false }()
 
 	r := gin.New()
 	r.Use(func(c *gin.Context) {
-		c.Set("uidOrigin", "other")
+		if c.GetHeader("Authorization") != "" {
+			c.Set("uidOrigin", "other")
+		}
 		c.Next()
 	})
 	r.PUT("/system/services", MakeUpdateHandler(cfg, back))
 
-	body := `{"name":"svc","image":"img","script":"echo","token":"t","visibility":"private"}`
+	// A request of the administrator must not make the next requests run as the administrator
+	body := `{"name":"svc","image":"img","script":"echo","token":"t","visibility":"private","input":[{"storage_provider":"s3.default","path":"bucket/in"}]}`
 	req := httptest.NewRequest(http.MethodPut, "/system/services", strings.NewReader(body))
 	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	body = `{"name":"svc","image":"img","script":"echo","token":"t","visibility":"private"}`
+	req = httptest.NewRequest(http.MethodPut, "/system/services", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer token")
 	resp := httptest.NewRecorder()
 	r.ServeHTTP(resp, req)
 
 	if resp.Code != http.StatusForbidden {
-		t.Fatalf("expected 403 for different owner despite stale admin state, got %d", resp.Code)
+		t.Fatalf("expected 403 for different owner after an admin request, got %d", resp.Code)
 	}
 	if back.UpdatedService != nil {
 		t.Fatalf("expected backend not to update service, got %+v", back.UpdatedService)
@@ -221,7 +260,6 @@ func TestMakeUpdateHandlerRejectsVolumeMutation(t *testing.T) {
 	cfg := &types.Config{
 		MinIOProvider: &types.MinIOProvider{},
 	}
-	isAdminUser = false
 
 	r := gin.New()
 	r.Use(func(c *gin.Context) {
@@ -310,3 +348,71 @@ func TestMakeUpdateHandlerLegacyServiceWithoutVolume(t *testing.T) {
 		t.Fatalf("expected legacy service update to keep volume nil, got %+v", back.UpdatedService.Volume)
 	}
 }
+
+func TestMakeUpdateHandlerEditorRole(t *testing.T) {
+	testsupport.SkipIfCannotListen(t)
+
+	back := backends.MakeFakeBackend()
+	ownerSecret := auth.FormatUID("owner@example.com")
+	kubeClientset := testclient.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: ownerSecret, Namespace: auth.ServicesNamespace},
+		Data:       map[string][]byte{"accessKey": []byte("owner"), "secretKey": []byte("secret")},
+	})
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, hreq *http.Request) {
+		if hreq.URL.Path == "/minio/admin/v3/info" {
+			rw.WriteHeader(http.StatusOK)
+			rw.Write([]byte(`{"Mode": "local", "Region": "us-east-1"}`))
+			return
+		}
+		rw.WriteHeader(http.StatusOK)
+		rw.Write([]byte(`{"status": "success"}`))
+	}))
+	defer server.Close()
+
+	acl := &types.ServiceACL{Groups: map[string]string{"teachers": types.ServiceRoleEditor}}
+	back.Service = &types.Service{
+		Name:       "svc",
+		Token:      "token",
+		CPU:        "1.0",
+		Owner:      "owner@example.com",
+		Namespace:  "oscar-svc-owner",
+		Visibility: "private",
+		ACL:        acl,
+	}
+	cfg := &types.Config{
+		MinIOProvider: &types.MinIOProvider{
+			Endpoint:  server.URL,
+			Region:    "us-east-1",
+			AccessKey: "ak",
+			SecretKey: "sk",
+		},
+	}
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("uidOrigin", "teacher@example.com")
+		auth.SetUserGroupsInContext(c, []string{"teachers"})
+		c.Set("multitenancyConfig", auth.NewMultitenancyConfig(kubeClientset, "teacher@example.com"))
+		c.Next()
+	})
+	r.PUT("/system/services", MakeUpdateHandler(cfg, back))
+
+	// Editors can update the service, but not share it nor change its owner
+	body := `{"name":"svc","owner":"teacher@example.com","cluster_id":"oscar","memory":"1Gi","cpu":"1.0","log_level":"CRITICAL","image":"ghcr.io/grycap/cowsay","script":"echo hi","visibility":"public","acl":{"users":{"teacher@example.com":"owner"}}}`
+	req := httptest.NewRequest(http.MethodPut, "/system/services", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer token")
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 for an editor, got %d: %s", resp.Code, resp.Body.String())
+	}
+	updated := back.UpdatedService
+	if updated == nil || updated.Owner != "owner@example.com" || updated.Visibility != "private" || updated.ACL != acl {
+		t.Fatalf("expected the owner, visibility and acl to be kept, got %+v", updated)
+	}
+	if _, err := kubeClientset.CoreV1().Secrets("oscar-svc-owner").Get(context.TODO(), ownerSecret, metav1.GetOptions{}); err != nil {
+		t.Errorf("expected the credentials of the owner in the service namespace: %v", err)
+	}
+}
@@ -33,20 +33,22 @@ import (
 
 // MakeListVolumesHandler godoc
 // @Summary List volumes
-// @Description List managed volumes in the caller namespace.
+// @Description List managed volumes in the caller namespace, or in the namespace of a service.
 // @Tags volumes
 // @Produce json
+// @Param service query string false "Service whose namespace is listed, with the viewer role on it"
 // @Success 200 {array} types.ManagedVolume
 // @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Not Found"
 // @Failure 500 {string} string "Internal Server Error"
 // @Security BasicAuth
 // @Security BearerAuth
 // @Router /system/volumes [get]
 func MakeListVolumesHandler(cfg *types.Config, back types.ServerlessBackend) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		namespace, _, err := resolveVolumeCaller(c, cfg, back)
-		if err != nil {
-			c.String(http.StatusInternalServerError, err.Error())
+		namespace, _, ok := resolveVolumeNamespace(c, cfg, back, types.ServiceRoleViewer)
+		if !ok {
 			return
 		}
 
@@ -62,14 +64,17 @@ func MakeListVolumesHandler(cfg *types.Config, back types.ServerlessBackend) gin
 
 // MakeCreateVolumeHandler godoc
 // @Summary Create volume
-// @Description Create a managed volume in the caller namespace.
+// @Description Create a managed volume in the caller namespace, or in the namespace of a service.
 // @Tags volumes
 // @Accept json
 // @Produce json
 // @Param volume body types.ManagedVolumeCreateRequest true "Volume definition"
+// @Param service query string false "Service whose namespace hosts the volume, with the editor role on it"
 // @Success 201 {object} types.ManagedVolume
 // @Failure 400 {string} string "Bad Request"
 // @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Not Found"
 // @Failure 409 {string} string "Conflict"
 // @Failure 500 {string} string "Internal Server Error"
 // @Security BasicAuth
@@ -87,9 +92,8 @@ func MakeCreateVolumeHandler(cfg *types.Config, back types.ServerlessBackend) gi
 			return
 		}
 
-		namespace, owner, err := resolveVolumeCaller(c, cfg, back)
-		if err != nil {
-			c.String(http.StatusInternalServerError, err.Error())
+		namespace, owner, ok := resolveVolumeNamespace(c, cfg, back, types.ServiceRoleEditor)
+		if !ok {
 			return
 		}
 		if owner != types.DefaultOwner {
@@ -99,7 +103,7 @@ func MakeCreateVolumeHandler(cfg *types.Config, back types.ServerlessBackend) gi
 			}
 		}
 
-		err = resources.CreateManagedVolume(
+		err := resources.CreateManagedVolume(
 			c.Request.Context(),
 			cfg,
 			back.GetKubeClientset(),
@@ -132,12 +136,14 @@ func MakeCreateVolumeHandler(cfg *types.Config, back types.ServerlessBackend) gi
 
 // MakeReadVolumeHandler godoc
 // @Summary Read volume
-// @Description Get a managed volume in the caller namespace.
+// @Description Get a managed volume in the caller namespace, or in the namespace of a service.
 // @Tags volumes
 // @Produce json
 // @Param volumeName path string true "Volume name"
+// @Param service query string false "Service whose namespace hosts the volume, with the viewer role on it"
 // @Success 200 {object} types.ManagedVolume
 // @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
 // @Failure 404 {string} string "Not Found"
 // @Failure 500 {string} string "Internal Server Error"
 // @Security BasicAuth
@@ -145,9 +151,8 @@ func MakeCreateVolumeHandler(cfg *types.Config, back types.ServerlessBackend) gi
 // @Router /system/volumes/{volumeName} [get]
 func MakeReadVolumeHandler(cfg *types.Config, back types.ServerlessBackend) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		namespace, _, err := resolveVolumeCaller(c, cfg, back)
-		if err != nil {
-			c.String(http.StatusInternalServerError, err.Error())
+		namespace, _, ok := resolveVolumeNamespace(c, cfg, back, types.ServiceRoleViewer)
+		if !ok {
 			return
 		}
 
@@ -166,12 +171,14 @@ func MakeReadVolumeHandler(cfg *types.Config, back types.ServerlessBackend) gin.
 
 // MakeDeleteVolumeHandler godoc
 // @Summary Delete volume
-// @Description Delete a detached managed volume in the caller namespace.
+// @Description Delete a detached managed volume in the caller namespace, or in the namespace of a service.
 // @Tags volumes
 // @Param volumeName path string true "Volume name"
+// @Param service query string false "Service whose namespace hosts the volume, with the editor role on it"
 // @Success 204 {string} string "No Content"
 // @Failure 400 {string} string "Bad Request"
 // @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
 // @Failure 404 {string} string "Not Found"
 // @Failure 500 {string} string "Internal Server Error"
 // @Security BasicAuth
@@ -179,13 +186,12 @@ func MakeReadVolumeHandler(cfg *types.Config, back types.ServerlessBackend) gin.
 // @Router /system/volumes/{volumeName} [delete]
 func MakeDeleteVolumeHandler(cfg *types.Config, back types.ServerlessBackend) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		namespace, _, err := resolveVolumeCaller(c, cfg, back)
-		if err != nil {
-			c.String(http.StatusInternalServerError, err.Error())
+		namespace, _, ok := resolveVolumeNamespace(c, cfg, back, types.ServiceRoleEditor)
+		if !ok {
 			return
 		}
 
-		err = resources.DeleteManagedVolume(c.Request.Context(), back.GetKubeClientset(), namespace, c.Param("volumeName"), false)
+		err := resources.DeleteManagedVolume(c.Request.Context(), back.GetKubeClientset(), namespace, c.Param("volumeName"), false)
 		if err != nil {
 			switch {
 			case errors.Is(err, resources.ErrManagedVolumeAttached):
@@ -201,6 +207,30 @@ func MakeDeleteVolumeHandler(cfg *types.Config, back types.ServerlessBackend) gi
 	}
 }
 
+// resolveVolumeNamespace returns the namespace and owner of the volumes of the request, writing the error
+// response if they can't be resolved. With the service query parameter the volumes are those of the namespace
+// of the service, which requires the role on the service; otherwise, those of the caller namespace
+func resolveVolumeNamespace(c *gin.Context, cfg *types.Config, back types.ServerlessBackend, role string) (string, string, bool) {
+	if serviceName := c.Query("service"); serviceName != "" {
+		service, ok := getAuthorizedService(c, back, serviceName, role)
+		if !ok {
+			return "", "", false
+		}
+		owner := service.Owner
+		if owner == "" {
+			owner = types.DefaultOwner
+		}
+		return resolveServiceNamespace(service, cfg), owner, true
+	}
+
+	namespace, owner, err := resolveVolumeCaller(c, cfg, back)
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return "", "", false
+	}
+	return namespace, owner, true
+}
+
 func resolveVolumeCaller(c *gin.Context, cfg *types.Config, back types.ServerlessBackend) (string, string, error) {
 	authHeader := c.GetHeader("Authorization")
 	if len(strings.Split(authHeader, "Bearer")) == 1 {
@@ -197,3 +197,60 @@ func createBaseRuntimePVC(t *testing.T, back *backends.FakeBackend, cfg *types.C
 		},
 	}, metav1.CreateOptions{})
 }
+
+func TestVolumeHandlersServiceNamespace(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	back := backends.MakeFakeBackend()
+	cfg := &types.Config{ServicesNamespace: "oscar-svc"}
+	createBaseRuntimePVC(t, back, cfg)
+	back.Service = &types.Service{
+		Name:       "svc",
+		Owner:      types.DefaultOwner,
+		Visibility: utils.PRIVATE,
+		ACL: &types.ServiceACL{
+			Users: map[string]string{"student": types.ServiceRoleViewer, "assistant": types.ServiceRoleEditor},
+		},
+	}
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("uidOrigin", c.GetHeader("X-Test-User"))
+		c.Next()
+	})
+	r.POST("/system/volumes", MakeCreateVolumeHandler(cfg, back))
+	r.GET("/system/volumes", MakeListVolumesHandler(cfg, back))
+	r.DELETE("/system/volumes/:volumeName", MakeDeleteVolumeHandler(cfg, back))
+
+	steps := []struct {
+		user     string
+		method   string
+		path     string
+		body     string
+		expected int
+	}{
+		{user: "student", method: http.MethodPost, path: "/system/volumes?service=svc", body: `{"name":"shared-data","size":"1Gi"}`, expected: http.StatusForbidden},
+		{user: "assistant", method: http.MethodPost, path: "/system/volumes?service=svc", body: `{"name":"shared-data","size":"1Gi"}`, expected: http.StatusCreated},
+		{user: "student", method: http.MethodGet, path: "/system/volumes?service=svc", expected: http.StatusOK},
+		{user: "stranger", method: http.MethodGet, path: "/system/volumes?service=svc", expected: http.StatusForbidden},
+		{user: "student", method: http.MethodDelete, path: "/system/volumes/shared-data?service=svc", expected: http.StatusForbidden},
+		{user: "assistant", method: http.MethodDelete, path: "/system/volumes/shared-data?service=svc", expected: http.StatusNoContent},
+	}
+	for _, s := range steps {
+		req := httptest.NewRequest(s.method, s.path, strings.NewReader(s.body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer token")
+		req.Header.Set("X-Test-User", s.user)
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		if resp.Code != s.expected {
+			t.Fatalf("%s %s as %s: expected status %d, got %d: %s", s.method, s.path, s.user, s.expected, resp.Code, resp.Body.String())
+		}
+		if s.expected == http.StatusOK && !strings.Contains(resp.Body.String(), "shared-data") {
+			t.Fatalf("expected the volume of the service namespace to be listed, got %s", resp.Body.String())
+		}
+	}
+
+	if _, err := back.GetKubeClientset().CoreV1().PersistentVolumeClaims(cfg.ServicesNamespace).Get(t.Context(), "shared-data", metav1.GetOptions{}); err == nil {
+		t.Fatalf("expected the volume to be deleted from the service namespace")
+	}
+}
@@ -36,6 +36,7 @@ import (
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/grycap/oscar/v4/pkg/types"
+	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
@@ -477,6 +478,7 @@ func DelegateJob(service *types.Service, event string, jobID string, authHeader
 			// Check status code
 			if res.StatusCode == http.StatusCreated {
 				logger.Printf("Job ( \"%s\" ) successfully delegated from service \"%s\" to cluster \"%s\"\n", jobID, service.Name, replica.ClusterID)
+				recordDelegationEvent(kubeClientset, service, cfg, jobID, replica.ClusterID, logger)
 				return nil
 			} else if res.StatusCode == http.StatusUnauthorized {
 				// Retry updating the token
@@ -543,6 +545,11 @@ func DelegateJob(service *types.Service, event string, jobID string, authHeader
 			if res.StatusCode == http.StatusOK {
 				logger.Printf("Job ( \"%s\" ) successfully delegated to endpoint \"%s\"\n", jobID, replica.ClusterID)
 				//fmt.Println("Job successfully delegated to cluster ", replica.ClusterID)
+				target := replica.ClusterID
+				if target == "" {
+					target = replica.URL
+				}
+				recordDelegationEvent(kubeClientset, service, cfg, jobID, target, logger)
 				return nil
 			}
 			logger.Printf("Error delegating job ( \"%s\" ) from service \"%s\" to endpoint \"%s\": Status code %d\n", jobID, service.Name, replica.URL, res.StatusCode)
@@ -551,6 +558,47 @@ func DelegateJob(service *types.Service, event string, jobID string, authHeader
 	return fmt.Errorf("unable to delegate job ( \"%s\" ) from service \"%s\" to any replica, scheduling in the current cluster", jobID, service.Name)
 }
 
+// recordDelegationEvent records a Kubernetes event for the delegated job, so its status can be queried
+// in the current cluster even if the job was never created or has been removed
+func recordDelegationEvent(kubeClientset kubernetes.Interface, service *types.Service, cfg *types.Config, jobID string, target string, logger *log.Logger) {
+	if kubeClientset == nil || jobID == "" {
+		return
+	}
+	namespace := service.Namespace
+	if namespace == "" && cfg != nil {
+		namespace = cfg.ServicesNamespace
+	}
+	now := metav1.Now()
+	event := &v1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: jobID + ".",
+			Namespace:    namespace,
+			Labels: map[string]string{
+				types.ServiceLabel: service.Name,
+			},
+			Annotations: map[string]string{
+				types.DelegatedToAnnotation: target,
+			},
+		},
+		InvolvedObject: v1.ObjectReference{
+			Kind:       "Job",
+			APIVersion: "batch/v1",
+			Namespace:  namespace,
+			Name:       jobID,
+		},
+		Reason:         types.JobDelegatedReason,
+		Message:        fmt.Sprintf("Job delegated to cluster \"%s\"", target),
+		Type:           v1.EventTypeNormal,
+		Source:         v1.EventSource{Component: "oscar"},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+	if _, err := kubeClientset.CoreV1().Events(namespace).Create(context.TODO(), event, metav1.CreateOptions{}); err != nil {
+		logger.Printf("Error recording delegation event of job \"%s\": %v\n", jobID, err)
+	}
+}
+
 func federationMembers(service *types.Service) types.ReplicaList {
 	if service == nil || service.Federation == nil {
 		return nil
@@ -1064,7 +1112,7 @@ func countJobs(jobStatuses map[string]JobStatus) (float64, int) {
 			finishTime, _ := time.Parse(time.RFC3339, status.FinishTime)
 			duration := finishTime.Sub(creationTime).Seconds() // Duration in seconds
 			totalExecutionTime += duration
-		case "Failed":
+		case "Failed", types.JobStatusDeadlineExceeded, types.JobStatusRetriesExhausted:
 			failedCount++
 		case "Pending": // Pending jobs
 			pendingCount++
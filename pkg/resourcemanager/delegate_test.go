@@ -18,6 +18,7 @@ package resourcemanager
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -31,6 +32,8 @@ import (
 
 	"github.com/grycap/oscar/v4/pkg/testsupport"
 	"github.com/grycap/oscar/v4/pkg/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	testclient "k8s.io/client-go/kubernetes/fake"
 )
 
 func TestDelegateJob(t *testing.T) {
@@ -527,3 +530,34 @@ func TestCreateParametersConstraints(t *testing.T) {
 		t.Fatalf("expected zeroed values when insufficient CPU, got %v", results)
 	}
 }
+
+func TestRecordDelegationEvent(t *testing.T) {
+	kubeClientset := testclient.NewSimpleClientset()
+	service := &types.Service{Name: "svc"}
+	cfg := &types.Config{ServicesNamespace: "oscar-svc"}
+	var buf bytes.Buffer
+	logger := log.New(&buf, "", 0)
+
+	recordDelegationEvent(kubeClientset, service, cfg, "svc-job", "cluster-b", logger)
+
+	events, err := kubeClientset.CoreV1().Events("oscar-svc").List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events.Items) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(events.Items))
+	}
+	event := events.Items[0]
+	if event.InvolvedObject.Kind != "Job" || event.InvolvedObject.Name != "svc-job" || event.Reason != types.JobDelegatedReason {
+		t.Errorf("unexpected event: %+v", event)
+	}
+	if event.Annotations[types.DelegatedToAnnotation] != "cluster-b" {
+		t.Errorf("unexpected annotations: %v", event.Annotations)
+	}
+
+	// Without clientset nothing is recorded
+	recordDelegationEvent(nil, service, cfg, "svc-job", "cluster-b", logger)
+	if buf.Len() != 0 {
+		t.Errorf("unexpected log output: %s", buf.String())
+	}
+}
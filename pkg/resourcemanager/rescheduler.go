@@ -26,6 +26,7 @@ import (
 	"time"
 
 	"github.com/grycap/oscar/v4/pkg/types"
+	"github.com/grycap/oscar/v4/pkg/utils"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
@@ -53,7 +54,7 @@ func StartReScheduler(cfg *types.Config, back types.ServerlessBackend, kubeClien
 		}
 
 		// Get all reScheduleInfo elements
-		reScheduleInfos := getReScheduleInfos(pods, back)
+		reScheduleInfos := getReScheduleInfos(pods, back, cfg, kubeClientset)
 
 		// Delegate jobs
 		for _, rsi := range reScheduleInfos {
@@ -150,7 +151,7 @@ func getReschedulerNamespaces(kubeClientset kubernetes.Interface, servicesNamesp
 	return result, nil
 }
 
-func getReScheduleInfos(pods []v1.Pod, back types.ServerlessBackend) []reScheduleInfo {
+func getReScheduleInfos(pods []v1.Pod, back types.ServerlessBackend, cfg *types.Config, kubeClientset kubernetes.Interface) []reScheduleInfo {
 	rsi := []reScheduleInfo{}
 
 	// Map to store services' pointers
@@ -175,9 +176,14 @@ func getReScheduleInfos(pods []v1.Pod, back types.ServerlessBackend) []reSchedul
 			if svcPtrs[serviceKey] == nil {
 				continue
 			}
+			event, err := getEvent(cfg, kubeClientset, pod)
+			if err != nil {
+				reSchedulerLogger.Printf("error reading the event of job \"%s\": %v\n", jobName, err)
+				continue
+			}
 			rsi = append(rsi, reScheduleInfo{
 				service:   svcPtrs[serviceKey],
-				event:     getEvent(pod.Spec),
+				event:     event,
 				jobName:   jobName,
 				namespace: pod.Namespace,
 			})
@@ -188,16 +194,25 @@ func getReScheduleInfos(pods []v1.Pod, back types.ServerlessBackend) []reSchedul
 	return rsi
 }
 
-func getEvent(podSpec v1.PodSpec) string {
-	for _, c := range podSpec.Containers {
+// getEvent returns the event of the job of the pod, reading it from the event store if it was too large for its definition
+func getEvent(cfg *types.Config, kubeClientset kubernetes.Interface, pod v1.Pod) (string, error) {
+	for _, c := range pod.Spec.Containers {
 		if c.Name == types.ContainerName {
 			for _, envVar := range c.Env {
-				if envVar.Name == types.EventVariable {
-					return envVar.Value
+				switch envVar.Name {
+				case types.EventVariable:
+					return envVar.Value, nil
+				case types.EventRefVariable:
+					ref, err := utils.ParseEventReference(envVar.Value)
+					if err != nil {
+						return "", err
+					}
+					event, err := utils.ReadJobEvent(context.TODO(), cfg, kubeClientset, pod.Namespace, *ref)
+					return string(event), err
 				}
 			}
 		}
 	}
 
-	return ""
+	return "", nil
 }
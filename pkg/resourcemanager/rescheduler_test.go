@@ -126,7 +126,7 @@ func TestGetReScheduleInfos(t *testing.T) {
 
 	back := backends.MakeFakeBackend()
 	// Call the function to test
-	reScheduleInfos := getReScheduleInfos(pods, back)
+	reScheduleInfos := getReScheduleInfos(pods, back, &types.Config{}, fake.NewSimpleClientset())
 	if reScheduleInfos == nil {
 		t.Fatalf("error getting reschedule infos")
 	}
@@ -194,24 +194,42 @@ func TestStartReScheduler(t *testing.T) {
 }
 
 func TestGetEventEnvVar(t *testing.T) {
-	podSpec := v1.PodSpec{
-		Containers: []v1.Container{
-			{
-				Name: types.ContainerName,
-				Env: []v1.EnvVar{
-					{Name: "other", Value: "x"},
-					{Name: types.EventVariable, Value: "payload"},
+	cfg := &types.Config{}
+	kubeClientset := fake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "job-event", Namespace: "ns"},
+		Data:       map[string][]byte{types.EventFileName: []byte("stored payload")},
+	})
+	pod := v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns"},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{
+				{
+					Name: types.ContainerName,
+					Env: []v1.EnvVar{
+						{Name: "other", Value: "x"},
+						{Name: types.EventVariable, Value: "payload"},
+					},
 				},
 			},
 		},
 	}
 
-	if ev := getEvent(podSpec); ev != "payload" {
-		t.Fatalf("expected payload event, got %s", ev)
+	if ev, err := getEvent(cfg, kubeClientset, pod); err != nil || ev != "payload" {
+		t.Fatalf("expected payload event, got %s (%v)", ev, err)
+	}
+
+	pod.Spec.Containers[0].Env = []v1.EnvVar{{Name: types.EventRefVariable, Value: "secret:job-event"}}
+	if ev, err := getEvent(cfg, kubeClientset, pod); err != nil || ev != "stored payload" {
+		t.Fatalf("expected stored event, got %s (%v)", ev, err)
+	}
+
+	pod.Spec.Containers[0].Env = []v1.EnvVar{{Name: types.EventRefVariable, Value: "secret:missing"}}
+	if _, err := getEvent(cfg, kubeClientset, pod); err == nil {
+		t.Fatalf("expected error reading a missing stored event")
 	}
 
-	emptySpec := v1.PodSpec{Containers: []v1.Container{{Name: "faas-container"}}}
-	if ev := getEvent(emptySpec); ev != "" {
+	emptyPod := v1.Pod{Spec: v1.PodSpec{Containers: []v1.Container{{Name: "faas-container"}}}}
+	if ev, err := getEvent(cfg, kubeClientset, emptyPod); err != nil || ev != "" {
 		t.Fatalf("expected empty event, got %s", ev)
 	}
 }
@@ -0,0 +1,211 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	// DefaultAcceleratorResource resource requested by "enable_gpu" and by accelerators without resource name
+	DefaultAcceleratorResource v1.ResourceName = "nvidia.com/gpu"
+	// DefaultGPUModelLabel node label with the GPU model, set by the NVIDIA GPU feature discovery
+	DefaultGPUModelLabel = "nvidia.com/gpu.product"
+)
+
+// acceleratorVendorDomains domains of the extended resources considered accelerators
+var acceleratorVendorDomains = []string{"nvidia.com", "amd.com", "gpu.intel.com"}
+
+// Accelerators accelerator devices requested by a service
+type Accelerators struct {
+	// Count number of devices requested
+	// Optional. (default: 1)
+	Count int64 `json:"count,omitempty"`
+
+	// ResourceName kubernetes extended resource of the devices (e.g. "nvidia.com/gpu", "amd.com/gpu" or "nvidia.com/mig-1g.5gb")
+	// Optional. (default: "nvidia.com/gpu")
+	ResourceName string `json:"resource_name,omitempty"`
+
+	// Model value of the GPU model node label required to schedule the service (e.g. "NVIDIA-A100-SXM4-40GB")
+	// Optional
+	Model string `json:"model,omitempty"`
+}
+
+// AvailableAccelerator accelerators discovered in the cluster nodes, grouped by resource and model
+type AvailableAccelerator struct {
+	// ResourceName kubernetes extended resource of the devices
+	ResourceName string `json:"resource_name"`
+	// Model value of the GPU model node label (empty if the nodes are not labelled)
+	Model string `json:"model,omitempty"`
+	// Count number of allocatable devices
+	Count int64 `json:"count"`
+	// MaxPerNode maximum number of allocatable devices in a single node
+	MaxPerNode int64 `json:"max_per_node"`
+}
+
+// IsAcceleratorResource returns true if the resource belongs to a known accelerator vendor
+func IsAcceleratorResource(name v1.ResourceName) bool {
+	domain, _, found := strings.Cut(string(name), "/")
+	return found && slices.Contains(acceleratorVendorDomains, domain)
+}
+
+// AcceleratorRequest returns the accelerator resource and quantity requested by "enable_gpu" or an accelerators block.
+// The accelerators block takes precedence over "enable_gpu".
+func AcceleratorRequest(enableGPU bool, accelerators *Accelerators) (v1.ResourceName, resource.Quantity, bool) {
+	if accelerators == nil {
+		if enableGPU {
+			return DefaultAcceleratorResource, *resource.NewQuantity(1, resource.DecimalSI), true
+		}
+		return "", resource.Quantity{}, false
+	}
+	name := DefaultAcceleratorResource
+	if accelerators.ResourceName != "" {
+		name = v1.ResourceName(accelerators.ResourceName)
+	}
+	count := accelerators.Count
+	if count == 0 {
+		count = 1
+	}
+	return name, *resource.NewQuantity(count, resource.DecimalSI), true
+}
+
+// NodeAccelerators returns the allocatable accelerators of a node, with the model read from modelLabel
+func NodeAccelerators(node v1.Node, modelLabel string) []AvailableAccelerator {
+	accelerators := []AvailableAccelerator{}
+	for name, quantity := range node.Status.Allocatable {
+		if !IsAcceleratorResource(name) || quantity.Value() <= 0 {
+			continue
+		}
+		accelerators = append(accelerators, AvailableAccelerator{
+			ResourceName: string(name),
+			Model:        node.Labels[modelLabel],
+			Count:        quantity.Value(),
+			MaxPerNode:   quantity.Value(),
+		})
+	}
+	return accelerators
+}
+
+// MergeAccelerators adds the accelerators of a node to the list, aggregating by resource and model
+func MergeAccelerators(list []AvailableAccelerator, node []AvailableAccelerator) []AvailableAccelerator {
+	for _, accelerator := range node {
+		i := slices.IndexFunc(list, func(a AvailableAccelerator) bool {
+			return a.ResourceName == accelerator.ResourceName && a.Model == accelerator.Model
+		})
+		if i < 0 {
+			list = append(list, accelerator)
+			continue
+		}
+		list[i].Count += accelerator.Count
+		list[i].MaxPerNode = max(list[i].MaxPerNode, accelerator.MaxPerNode)
+	}
+	slices.SortFunc(list, func(a, b AvailableAccelerator) int {
+		return strings.Compare(a.ResourceName+"/"+a.Model, b.ResourceName+"/"+b.Model)
+	})
+	return list
+}
+
+// AcceleratorResourceNames returns the accelerator resources discovered in the cluster,
+// or the default accelerator resource if none was discovered
+func (cfg *Config) AcceleratorResourceNames() []v1.ResourceName {
+	names := []v1.ResourceName{}
+	for _, accelerator := range cfg.AvailableAccelerators {
+		if !slices.Contains(names, v1.ResourceName(accelerator.ResourceName)) {
+			names = append(names, v1.ResourceName(accelerator.ResourceName))
+		}
+	}
+	if len(names) == 0 {
+		names = append(names, DefaultAcceleratorResource)
+	}
+	return names
+}
+
+// ValidateAccelerators checks the accelerators requested by the service and its KServe definition.
+// The accelerators not discovered in the cluster are only warned about, as they may be provided
+// by node pools scaled from zero or by nodes added after the discovery.
+func (service *Service) ValidateAccelerators(cfg *Config) error {
+	if err := validateAccelerators(cfg, service.Accelerators); err != nil {
+		return err
+	}
+	if service.Kserve != nil {
+		if service.Kserve.Accelerators != nil && service.Kserve.Accelerators.Model != "" {
+			return fmt.Errorf("kserve: the accelerators model is not supported")
+		}
+		if err := validateAccelerators(cfg, service.Kserve.Accelerators); err != nil {
+			return fmt.Errorf("kserve: %v", err)
+		}
+	}
+	return nil
+}
+
+func validateAccelerators(cfg *Config, accelerators *Accelerators) error {
+	if accelerators == nil {
+		return nil
+	}
+	if accelerators.Count < 0 {
+		return fmt.Errorf("the accelerators count must be positive")
+	}
+	name, _, _ := AcceleratorRequest(false, accelerators)
+	if !IsAcceleratorResource(name) {
+		return fmt.Errorf("\"%s\" is not an accelerator resource", name)
+	}
+	if err := checkDiscoveredAccelerators(cfg, name, accelerators); err != nil {
+		log.Printf("WARNING: %v, the jobs will wait until a node provides them", err)
+	}
+	return nil
+}
+
+// checkDiscoveredAccelerators checks the accelerators against the ones discovered in the cluster
+func checkDiscoveredAccelerators(cfg *Config, name v1.ResourceName, accelerators *Accelerators) error {
+	available := slices.DeleteFunc(slices.Clone(cfg.AvailableAccelerators), func(a AvailableAccelerator) bool {
+		return a.ResourceName != string(name)
+	})
+	if len(available) == 0 {
+		return fmt.Errorf("there are no \"%s\" accelerators in the cluster", name)
+	}
+	if accelerators.Model != "" && !slices.ContainsFunc(available, func(a AvailableAccelerator) bool { return a.Model == accelerators.Model }) {
+		return fmt.Errorf("there are no \"%s\" accelerators of model \"%s\" in the cluster", name, accelerators.Model)
+	}
+	// All the devices of a pod must be allocated in the same node
+	if !slices.ContainsFunc(available, func(a AvailableAccelerator) bool {
+		return a.MaxPerNode >= accelerators.Count && (accelerators.Model == "" || a.Model == accelerators.Model)
+	}) {
+		return fmt.Errorf("no node in the cluster has %d \"%s\" accelerators", accelerators.Count, name)
+	}
+	return nil
+}
+
+// addAcceleratorNodeSelector requires the GPU model of the accelerators in the node selector of the podSpec
+func addAcceleratorNodeSelector(podSpec *v1.PodSpec, service *Service, cfg *Config) {
+	if service.Accelerators == nil || service.Accelerators.Model == "" {
+		return
+	}
+	label := cfg.GPUModelLabel
+	if label == "" {
+		label = DefaultGPUModelLabel
+	}
+	if podSpec.NodeSelector == nil {
+		podSpec.NodeSelector = map[string]string{}
+	}
+	podSpec.NodeSelector[label] = service.Accelerators.Model
+}
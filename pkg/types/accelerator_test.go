@@ -0,0 +1,151 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func acceleratorNode(name, model string, allocatable v1.ResourceList) *v1.Node {
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{DefaultGPUModelLabel: model},
+		},
+		Status: v1.NodeStatus{Allocatable: allocatable},
+	}
+}
+
+func TestCheckAvailableAccelerators(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		acceleratorNode("a100-1", "A100", v1.ResourceList{
+			"nvidia.com/gpu":    *resource.NewQuantity(4, resource.DecimalSI),
+			v1.ResourceCPU:      resource.MustParse("32"),
+			"example.com/other": *resource.NewQuantity(1, resource.DecimalSI),
+		}),
+		acceleratorNode("a100-2", "A100", v1.ResourceList{"nvidia.com/gpu": *resource.NewQuantity(2, resource.DecimalSI)}),
+		acceleratorNode("mi250", "", v1.ResourceList{"amd.com/gpu": *resource.NewQuantity(8, resource.DecimalSI)}),
+	)
+	cfg := &Config{}
+	cfg.CheckAvailableGPUs(client)
+
+	if !cfg.GPUAvailable {
+		t.Fatal("expected GPU availability to be detected")
+	}
+	expected := []AvailableAccelerator{
+		{ResourceName: "amd.com/gpu", Count: 8, MaxPerNode: 8},
+		{ResourceName: "nvidia.com/gpu", Model: "A100", Count: 6, MaxPerNode: 4},
+	}
+	if len(cfg.AvailableAccelerators) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, cfg.AvailableAccelerators)
+	}
+	for i := range expected {
+		if cfg.AvailableAccelerators[i] != expected[i] {
+			t.Errorf("expected %v, got %v", expected[i], cfg.AvailableAccelerators[i])
+		}
+	}
+	names := cfg.AcceleratorResourceNames()
+	if len(names) != 2 || names[0] != "amd.com/gpu" || names[1] != DefaultAcceleratorResource {
+		t.Errorf("unexpected accelerator resources: %v", names)
+	}
+}
+
+func TestValidateAccelerators(t *testing.T) {
+	cfg := &Config{AvailableAccelerators: []AvailableAccelerator{
+		{ResourceName: "nvidia.com/gpu", Model: "A100", Count: 6, MaxPerNode: 4},
+		{ResourceName: "nvidia.com/mig-1g.5gb", Count: 7, MaxPerNode: 7},
+	}}
+
+	scenarios := []struct {
+		name         string
+		accelerators *Accelerators
+		kserve       *Accelerators
+		valid        bool
+	}{
+		{"no accelerators", nil, nil, true},
+		{"default resource", &Accelerators{Count: 2}, nil, true},
+		{"mig profile", &Accelerators{ResourceName: "nvidia.com/mig-1g.5gb"}, nil, true},
+		{"model", &Accelerators{Count: 4, Model: "A100"}, nil, true},
+		// The accelerators not discovered are only warned about, as the nodes may be added later
+		{"unknown model", &Accelerators{Model: "H100"}, nil, true},
+		{"too many devices per node", &Accelerators{Count: 6}, nil, true},
+		{"negative count", &Accelerators{Count: -1}, nil, false},
+		{"not discovered", &Accelerators{ResourceName: "amd.com/gpu"}, nil, true},
+		{"not an accelerator", &Accelerators{ResourceName: "cpu"}, nil, false},
+		{"kserve", nil, &Accelerators{Count: 2}, true},
+		{"kserve model", nil, &Accelerators{Model: "A100"}, false},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			svc := &Service{Accelerators: s.accelerators}
+			if s.kserve != nil {
+				svc.Kserve = &Kserve{Accelerators: s.kserve}
+			}
+			err := svc.ValidateAccelerators(cfg)
+			if s.valid && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !s.valid && err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestCheckDiscoveredAccelerators(t *testing.T) {
+	cfg := &Config{AvailableAccelerators: []AvailableAccelerator{
+		{ResourceName: "nvidia.com/gpu", Model: "A100", Count: 6, MaxPerNode: 4},
+	}}
+	for accelerators, available := range map[Accelerators]bool{
+		{Count: 4, Model: "A100"}:     true,
+		{Model: "H100"}:               false,
+		{Count: 6}:                    false,
+		{ResourceName: "amd.com/gpu"}: false,
+	} {
+		name, _, _ := AcceleratorRequest(false, &accelerators)
+		if err := checkDiscoveredAccelerators(cfg, name, &accelerators); (err == nil) != available {
+			t.Errorf("expected accelerators %+v to be available: %v, got %v", accelerators, available, err)
+		}
+	}
+}
+
+func TestToPodSpecWithAccelerators(t *testing.T) {
+	svc := testService
+	svc.EnableGPU = true
+	svc.Accelerators = &Accelerators{Count: 2, ResourceName: "amd.com/gpu", Model: "MI250"}
+
+	podSpec, err := svc.ToPodSpec(&Config{GPUModelLabel: "amd.com/gpu.product-name"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	limits := podSpec.Containers[0].Resources.Limits
+	if gpu := limits["amd.com/gpu"]; gpu.Value() != 2 {
+		t.Errorf("expected 2 amd.com/gpu, got %v", limits)
+	}
+	if _, ok := limits[DefaultAcceleratorResource]; ok {
+		t.Errorf("expected no %s limit, got %v", DefaultAcceleratorResource, limits)
+	}
+	if podSpec.NodeSelector["amd.com/gpu.product-name"] != "MI250" {
+		t.Errorf("unexpected node selector: %v", podSpec.NodeSelector)
+	}
+}
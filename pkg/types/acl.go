@@ -0,0 +1,84 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Roles of the users on a service. Each role allows the operations of the previous ones
+const (
+	// ServiceRoleViewer allows reading the service definition, its jobs, logs and metrics
+	ServiceRoleViewer = "viewer"
+	// ServiceRoleInvoker allows invoking the service and managing its jobs
+	ServiceRoleInvoker = "invoker"
+	// ServiceRoleEditor allows updating, restarting and rolling back the service
+	ServiceRoleEditor = "editor"
+	// ServiceRoleOwner allows deleting the service, managing its tokens and sharing it
+	ServiceRoleOwner = "owner"
+)
+
+// ServiceRoles valid roles of the access control list of a service, from the least to the most privileged
+var ServiceRoles = []string{ServiceRoleViewer, ServiceRoleInvoker, ServiceRoleEditor, ServiceRoleOwner}
+
+// ServiceACL access control list of a service
+type ServiceACL struct {
+	// Users roles granted to users, indexed by their UID
+	Users map[string]string `json:"users,omitempty"`
+
+	// Groups roles granted to the members of OIDC groups, indexed by the group name
+	Groups map[string]string `json:"groups,omitempty"`
+}
+
+// ServiceRoleAllows returns true if the role includes the operations of the required role
+func ServiceRoleAllows(role, required string) bool {
+	index := slices.Index(ServiceRoles, role)
+	return index >= 0 && index >= slices.Index(ServiceRoles, required)
+}
+
+// HigherServiceRole returns the most privileged of two roles
+func HigherServiceRole(role, other string) string {
+	if slices.Index(ServiceRoles, other) > slices.Index(ServiceRoles, role) {
+		return other
+	}
+	return role
+}
+
+// Validate checks the subjects and roles of the access control list
+func (acl *ServiceACL) Validate() error {
+	if acl == nil {
+		return nil
+	}
+	for kind, grants := range map[string]map[string]string{"user": acl.Users, "group": acl.Groups} {
+		for subject, role := range grants {
+			if strings.TrimSpace(subject) == "" {
+				return fmt.Errorf("the acl can't contain an empty %s", kind)
+			}
+			if !slices.Contains(ServiceRoles, role) {
+				return fmt.Errorf("invalid role %q of %s %q, must be one of %v", role, kind, subject, ServiceRoles)
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateACL checks the access control list of the service
+func (service *Service) ValidateACL() error {
+	return service.ACL.Validate()
+}
@@ -0,0 +1,72 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import "testing"
+
+func TestServiceACLValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		acl   *ServiceACL
+		valid bool
+	}{
+		{"nil", nil, true},
+		{"empty", &ServiceACL{}, true},
+		{"users and groups", &ServiceACL{Users: map[string]string{"student@egi.eu": ServiceRoleViewer}, Groups: map[string]string{"vo.example.eu": ServiceRoleInvoker}}, true},
+		{"invalid role", &ServiceACL{Users: map[string]string{"student@egi.eu": "admin"}}, false},
+		{"empty user", &ServiceACL{Users: map[string]string{" ": ServiceRoleViewer}}, false},
+		{"empty group role", &ServiceACL{Groups: map[string]string{"vo.example.eu": ""}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := (&Service{ACL: tt.acl}).ValidateACL()
+			if tt.valid && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestServiceRoleAllows(t *testing.T) {
+	tests := []struct {
+		role     string
+		required string
+		allowed  bool
+	}{
+		{ServiceRoleOwner, ServiceRoleEditor, true},
+		{ServiceRoleEditor, ServiceRoleEditor, true},
+		{ServiceRoleInvoker, ServiceRoleViewer, true},
+		{ServiceRoleViewer, ServiceRoleInvoker, false},
+		{ServiceRoleEditor, ServiceRoleOwner, false},
+		{"", ServiceRoleViewer, false},
+	}
+	for _, tt := range tests {
+		if allowed := ServiceRoleAllows(tt.role, tt.required); allowed != tt.allowed {
+			t.Errorf("expected %q allowing %q to be %v", tt.role, tt.required, tt.allowed)
+		}
+	}
+
+	if role := HigherServiceRole(ServiceRoleViewer, ServiceRoleEditor); role != ServiceRoleEditor {
+		t.Errorf("expected the editor role, got %q", role)
+	}
+	if role := HigherServiceRole(ServiceRoleInvoker, ""); role != ServiceRoleInvoker {
+		t.Errorf("expected the invoker role, got %q", role)
+	}
+}
@@ -44,3 +44,10 @@ type SyncBackend interface {
 	ServerlessBackend
 	GetProxyDirector(serviceName string, serviceNamespace string) func(req *http.Request)
 }
+
+// PlanBackend define an interface for serverless backends able to render the
+// Kubernetes objects of a service without creating them (dry-run)
+type PlanBackend interface {
+	ServerlessBackend
+	PlanService(service Service) (*ServicePlan, error)
+}
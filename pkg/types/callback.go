@@ -0,0 +1,124 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+const (
+	// CallbackURLHeader header of the asynchronous invocations with an additional callback URL for the job
+	CallbackURLHeader = "X-OSCAR-Callback-URL"
+	// CallbackURLAnnotation annotation of the jobs with the callback URL provided in their invocation
+	CallbackURLAnnotation = "oscar.grycap/callback-url"
+	// CallbackSignatureHeader header of the callback notifications with the HMAC-SHA256 signature of the body
+	CallbackSignatureHeader = "X-OSCAR-Signature"
+	// CallbackDeliveryHeader header of the callback notifications with the unique identifier of the notification
+	CallbackDeliveryHeader = "X-OSCAR-Delivery"
+)
+
+// ServiceCallback webhook notified when an asynchronous job of the service finishes
+type ServiceCallback struct {
+	// URL http(s) endpoint receiving the notifications
+	URL string `json:"url"`
+
+	// On statuses of the jobs notified: Succeeded and/or Failed
+	// Optional. (default: all)
+	On []string `json:"on,omitempty"`
+}
+
+// JobCallback notification sent to the callbacks when a job finishes
+type JobCallback struct {
+	JobName   string `json:"job_name"`
+	Service   string `json:"service"`
+	Namespace string `json:"namespace"`
+	JobInfo
+	// DurationSeconds running time of the job, if started
+	DurationSeconds float64 `json:"duration_seconds,omitempty"`
+	// Outputs keys of the output objects uploaded by the FaaS Supervisor, prefixed by their bucket
+	Outputs []string `json:"outputs"`
+}
+
+// Notifies returns true if the callback must be notified of a job with the provided status
+func (callback ServiceCallback) Notifies(status string) bool {
+	if len(callback.On) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(callback.On, func(on string) bool {
+		// The jobs failed by the retry policy are notified as failed
+		return strings.EqualFold(on, status) || strings.EqualFold(on, "Failed") && JobFailedStatus(status)
+	})
+}
+
+// Validate checks the URL and statuses of the callback
+func (callback ServiceCallback) Validate(allowedHosts []string) error {
+	if err := ValidateCallbackURL(callback.URL, allowedHosts); err != nil {
+		return err
+	}
+	for _, on := range callback.On {
+		if !strings.EqualFold(on, "Succeeded") && !strings.EqualFold(on, "Failed") {
+			return fmt.Errorf("invalid callback status \"%s\": must be Succeeded or Failed", on)
+		}
+	}
+	return nil
+}
+
+// ValidateCallbackURL checks that the callback URL is an absolute http(s) URL that doesn't target the cluster
+// or the internal networks, unless its host is in the allowed hosts. The resolved addresses are checked again
+// when the notifications are sent.
+func ValidateCallbackURL(rawURL string, allowedHosts []string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid callback URL \"%s\": must be an absolute http(s) URL", rawURL)
+	}
+	host := strings.ToLower(u.Hostname())
+	if slices.Contains(allowedHosts, host) {
+		return nil
+	}
+	internal := host == "localhost" || !strings.Contains(host, ".") && net.ParseIP(host) == nil
+	for _, suffix := range []string{".localhost", ".local", ".internal", ".svc"} {
+		internal = internal || strings.HasSuffix(host, suffix)
+	}
+	if ip := net.ParseIP(host); internal || ip != nil && !CallbackAddressAllowed(ip) {
+		return fmt.Errorf("invalid callback URL \"%s\": internal hosts are not allowed", rawURL)
+	}
+	return nil
+}
+
+// sharedAddressSpace carrier-grade NAT range, also used by some clusters for the pod and service networks
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// CallbackAddressAllowed returns false for the loopback, private, link-local and unspecified addresses,
+// where the cluster services and the cloud metadata endpoints are reachable
+func CallbackAddressAllowed(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || sharedAddressSpace.Contains(ip))
+}
+
+// ValidateCallbacks checks the callbacks of the service
+func (service *Service) ValidateCallbacks(cfg *Config) error {
+	for _, callback := range service.Callbacks {
+		if err := callback.Validate(cfg.CallbackAllowedHosts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import "testing"
+
+func TestServiceCallbackValidate(t *testing.T) {
+	valid := []ServiceCallback{
+		{URL: "https://example.org/hook"},
+		{URL: "http://hooks.svc:8080/jobs", On: []string{"succeeded", "Failed"}},
+	}
+	allowedHosts := []string{"hooks.svc"}
+	for _, callback := range valid {
+		if err := callback.Validate(allowedHosts); err != nil {
+			t.Errorf("unexpected error validating %+v: %v", callback, err)
+		}
+	}
+
+	invalid := []ServiceCallback{
+		{URL: ""},
+		{URL: "/relative"},
+		{URL: "ftp://example.org"},
+		{URL: "https://example.org", On: []string{"Running"}},
+		{URL: "http://localhost:8080/hook"},
+		{URL: "http://127.0.0.1/hook"},
+		{URL: "http://[::1]/hook"},
+		{URL: "http://169.254.169.254/latest/meta-data"},
+		{URL: "http://10.0.0.1/hook"},
+		{URL: "http://minio:9000/hook"},
+		{URL: "http://minio.minio.svc.cluster.local:9000/hook"},
+		{URL: "http://other.svc:8080/hook"},
+	}
+	for _, callback := range invalid {
+		if err := callback.Validate(allowedHosts); err == nil {
+			t.Errorf("expected error validating %+v", callback)
+		}
+	}
+}
+
+func TestServiceCallbackNotifies(t *testing.T) {
+	if !(ServiceCallback{}).Notifies("Failed") {
+		t.Errorf("expected callbacks without statuses to notify every job")
+	}
+	callback := ServiceCallback{On: []string{"failed"}}
+	if !callback.Notifies("Failed") || callback.Notifies("Succeeded") {
+		t.Errorf("unexpected statuses notified by %+v", callback)
+	}
+	if !callback.Notifies(JobStatusDeadlineExceeded) || !callback.Notifies(JobStatusRetriesExhausted) {
+		t.Errorf("expected the jobs failed by the retry policy to be notified by %+v", callback)
+	}
+}
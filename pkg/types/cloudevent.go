@@ -0,0 +1,94 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"maps"
+	"slices"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// CloudEventsSpecVersion version of the CloudEvents specification supported
+	CloudEventsSpecVersion = "1.0"
+	// CloudEventEnvPrefix prefix of the environment variables with the attributes of the CloudEvent invoking a job
+	CloudEventEnvPrefix = "CE_"
+	// JobFinishedCloudEventType type of the CloudEvents emitted when a job finishes
+	JobFinishedCloudEventType = "io.grycap.oscar.job.finished"
+)
+
+// CloudEvent CloudEvents 1.0 event received or emitted by OSCAR
+type CloudEvent struct {
+	ID              string `json:"id"`
+	Source          string `json:"source"`
+	Type            string `json:"type"`
+	Subject         string `json:"subject,omitempty"`
+	Time            string `json:"time,omitempty"`
+	DataContentType string `json:"datacontenttype,omitempty"`
+	DataSchema      string `json:"dataschema,omitempty"`
+	// Extensions extension context attributes of the event
+	Extensions map[string]string `json:"-"`
+	// Data payload of the event, passed to the services as their event
+	Data []byte `json:"-"`
+}
+
+// Attributes returns the context attributes of the event (excluding specversion)
+func (ce *CloudEvent) Attributes() map[string]string {
+	attrs := maps.Clone(ce.Extensions)
+	if attrs == nil {
+		attrs = map[string]string{}
+	}
+	for name, value := range map[string]string{
+		"id":              ce.ID,
+		"source":          ce.Source,
+		"type":            ce.Type,
+		"subject":         ce.Subject,
+		"time":            ce.Time,
+		"datacontenttype": ce.DataContentType,
+		"dataschema":      ce.DataSchema,
+	} {
+		if value != "" {
+			attrs[name] = value
+		}
+	}
+	return attrs
+}
+
+// EnvVars returns the attributes of the event as environment variables for the service container,
+// named after the attributes in upper case with the CE_ prefix (e.g. CE_SOURCE)
+func (ce *CloudEvent) EnvVars() []v1.EnvVar {
+	attrs := ce.Attributes()
+	envVars := make([]v1.EnvVar, 0, len(attrs))
+	for _, name := range slices.Sorted(maps.Keys(attrs)) {
+		envVars = append(envVars, v1.EnvVar{
+			Name:  CloudEventEnvPrefix + strings.ToUpper(name),
+			Value: attrs[name],
+		})
+	}
+	return envVars
+}
+
+// JobFinishedEventData data of the CloudEvents emitted when a job finishes
+type JobFinishedEventData struct {
+	Name      string `json:"name"`
+	Service   string `json:"service"`
+	Namespace string `json:"namespace"`
+	Owner     string `json:"owner,omitempty"`
+	JobInfo
+}
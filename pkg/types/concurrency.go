@@ -0,0 +1,27 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import "fmt"
+
+// ValidateMaxConcurrentJobs checks the limit of concurrent jobs of the service
+func (service *Service) ValidateMaxConcurrentJobs() error {
+	if service.MaxConcurrentJobs < 0 {
+		return fmt.Errorf("max_concurrent_jobs must be a positive number, or 0 for no limit")
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestValidateMaxConcurrentJobs(t *testing.T) {
+	for _, limit := range []int{0, 1, 100} {
+		service := &Service{MaxConcurrentJobs: limit}
+		if err := service.ValidateMaxConcurrentJobs(); err != nil {
+			t.Errorf("unexpected error for limit %d: %v", limit, err)
+		}
+	}
+	service := &Service{MaxConcurrentJobs: -1}
+	if err := service.ValidateMaxConcurrentJobs(); err == nil {
+		t.Error("expected an error for a negative limit")
+	}
+}
+
+func TestJobHeld(t *testing.T) {
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{ServiceLabel: "svc"}}}
+	if JobHeld(job) {
+		t.Error("expected the job not to be held")
+	}
+	job.Labels[JobHeldLabel] = "1"
+	if !JobHeld(job) {
+		t.Error("expected the job to be held")
+	}
+}
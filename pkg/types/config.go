@@ -91,6 +91,12 @@ type Config struct {
 	// Parameter used to check if the cluster have GPUs
 	GPUAvailable bool `json:"gpu_available"`
 
+	// AvailableAccelerators accelerators discovered in the cluster nodes
+	AvailableAccelerators []AvailableAccelerator `json:"accelerators,omitempty"`
+
+	// GPUModelLabel node label with the GPU model, used to schedule services requesting a model (default: nvidia.com/gpu.product)
+	GPUModelLabel string `json:"-"`
+
 	// Parameter used to check if the cluster have vega nodes
 	InterLinkAvailable bool `json:"interLink_available"`
 
@@ -167,7 +173,7 @@ type Config struct {
 	// KueueDefaultMemory default per-user ClusterQueue memory quota
 	KueueDefaultMemory string `json:"-"`
 
-	// KueueDefaultGPU default per-user ClusterQueue GPU quota
+	// KueueDefaultGPU default per-user ClusterQueue quota of each accelerator resource
 	KueueDefaultGPU string `json:"-"`
 
 	// KueueDefaultFlavor default ResourceFlavor name used for ClusterQueues
@@ -299,6 +305,81 @@ type Config struct {
 
 	// MinIOQuotaStorage default storage allowed per bucket and user
 	MinIOQuotaStorage string `json:"-"`
+
+	// ServiceRevisionLimit maximum number of revisions kept per service (0 keeps all of them)
+	ServiceRevisionLimit int `json:"-"`
+
+	// ServiceControllerEnable option to enable the controller reconciling OSCARService custom resources
+	ServiceControllerEnable bool `json:"-"`
+
+	// ServiceControllerResync period to re-reconcile all the OSCARService custom resources
+	ServiceControllerResync time.Duration `json:"-"`
+
+	// JobWatcherResync period to re-list the jobs watched to run the handlers of the finished jobs and to release the held jobs
+	JobWatcherResync time.Duration `json:"-"`
+
+	// LeaderElectionEnable option to run the controllers and watchers only in the replica elected as leader,
+	// required to run more than one replica of the manager
+	LeaderElectionEnable bool `json:"-"`
+
+	// SchedulingAllowedNodeLabels node label keys that services can use in node selectors and affinity ("*" allows any)
+	SchedulingAllowedNodeLabels []string `json:"scheduling_allowed_node_labels,omitempty"`
+
+	// SchedulingAllowedTolerations taint keys that services can tolerate ("*" allows any)
+	SchedulingAllowedTolerations []string `json:"scheduling_allowed_tolerations,omitempty"`
+
+	// JobArchiveEnable option to archive the status and logs of the finished jobs
+	JobArchiveEnable bool `json:"-"`
+
+	// JobArchiveBucket MinIO bucket where the finished jobs are archived
+	JobArchiveBucket string `json:"-"`
+
+	// JobArchivePath directory (e.g. a mounted PVC) where the finished jobs are archived instead of MinIO
+	JobArchivePath string `json:"-"`
+
+	// JobArchiveRetention period after which the archived jobs are removed from the archive
+	JobArchiveRetention time.Duration `json:"-"`
+
+	// EventSizeThreshold size in bytes above which the job events are stored in a Secret or MinIO object
+	// instead of the EVENT environment variable (0 disables it)
+	EventSizeThreshold int `json:"-"`
+
+	// EventBucket MinIO bucket where the events too large for a Secret are stored
+	EventBucket string `json:"-"`
+
+	// EventFetcherImage image of the init container downloading the events stored in MinIO
+	EventFetcherImage string `json:"-"`
+
+	// CloudEventsSink URL (e.g. a Knative Eventing broker) where a CloudEvent is sent when a job finishes (empty disables it)
+	CloudEventsSink string `json:"-"`
+
+	// JobCallbacksEnable option to notify the callbacks of the services and invocations when their jobs finish
+	JobCallbacksEnable bool `json:"-"`
+
+	// CallbackAllowedHosts hosts of the callback URLs allowed even if they are internal to the cluster or its network
+	CallbackAllowedHosts []string `json:"-"`
+
+	// IdempotencyKeyRetention time the idempotency keys of the asynchronous invocations are retained
+	IdempotencyKeyRetention time.Duration `json:"-"`
+
+	// JobBatchMaxEvents maximum number of events of a batch submission
+	JobBatchMaxEvents int `json:"-"`
+
+	// JobBatchParallelism number of jobs of a batch submission created in parallel
+	JobBatchParallelism int `json:"-"`
+
+	// FanoutMaxObjects maximum number of objects of a fan-out run
+	FanoutMaxObjects int `json:"-"`
+
+	// PersonalTokenMaxTTL maximum validity of the personal access tokens of the users
+	PersonalTokenMaxTTL time.Duration `json:"-"`
+
+	// PersonalTokenGroupsTTL maximum time the groups stored in a personal access token are trusted without
+	// being refreshed by an OIDC login of its owner
+	PersonalTokenGroupsTTL time.Duration `json:"-"`
+
+	// ServiceTokenGracePeriod default time the previous token of a service is accepted after its rotation
+	ServiceTokenGracePeriod time.Duration `json:"-"`
 }
 
 type ConfigForUser struct {
@@ -384,6 +465,31 @@ var configVars = []configVar{
 	{"MinIOQuotaEnabled", "MINIO_QUOTA_ENABLED", false, boolType, "false"},
 	{"MinIOQuotaBuckets", "MINIO_QUOTA_BUCKETS", false, stringType, "5"},
 	{"MinIOQuotaStorage", "MINIO_QUOTA_STORAGE", false, stringType, "5Gi"},
+	{"ServiceRevisionLimit", "SERVICE_REVISION_LIMIT", false, intType, "10"},
+	{"ServiceControllerEnable", "SERVICE_CONTROLLER_ENABLE", false, boolType, "false"},
+	{"ServiceControllerResync", "SERVICE_CONTROLLER_RESYNC", false, secondsType, "300"},
+	{"JobWatcherResync", "JOB_WATCHER_RESYNC", false, secondsType, "3600"},
+	{"LeaderElectionEnable", "LEADER_ELECTION_ENABLE", false, boolType, "false"},
+	{"SchedulingAllowedNodeLabels", "SCHEDULING_ALLOWED_NODE_LABELS", false, stringSliceType, ""},
+	{"SchedulingAllowedTolerations", "SCHEDULING_ALLOWED_TOLERATIONS", false, stringSliceType, ""},
+	{"GPUModelLabel", "GPU_MODEL_LABEL", false, stringType, DefaultGPUModelLabel},
+	{"JobArchiveEnable", "JOB_ARCHIVE_ENABLE", false, boolType, "false"},
+	{"JobArchiveBucket", "JOB_ARCHIVE_BUCKET", false, stringType, "oscar-job-archive"},
+	{"JobArchivePath", "JOB_ARCHIVE_PATH", false, stringType, ""},
+	{"JobArchiveRetention", "JOB_ARCHIVE_RETENTION", false, secondsType, "7776000"},
+	{"EventSizeThreshold", "EVENT_SIZE_THRESHOLD", false, intType, "0"},
+	{"EventBucket", "EVENT_BUCKET", false, stringType, "oscar-events"},
+	{"EventFetcherImage", "EVENT_FETCHER_IMAGE", false, stringType, "rclone/rclone"},
+	{"CloudEventsSink", "CLOUDEVENTS_SINK", false, urlType, ""},
+	{"JobCallbacksEnable", "JOB_CALLBACKS_ENABLE", false, boolType, "true"},
+	{"CallbackAllowedHosts", "CALLBACK_ALLOWED_HOSTS", false, stringSliceType, ""},
+	{"IdempotencyKeyRetention", "IDEMPOTENCY_KEY_RETENTION", false, secondsType, "86400"},
+	{"JobBatchMaxEvents", "JOB_BATCH_MAX_EVENTS", false, intType, "1000"},
+	{"JobBatchParallelism", "JOB_BATCH_PARALLELISM", false, intType, "10"},
+	{"FanoutMaxObjects", "FANOUT_MAX_OBJECTS", false, intType, "10000"},
+	{"PersonalTokenMaxTTL", "PERSONAL_TOKEN_MAX_TTL", false, secondsType, "7776000"},
+	{"PersonalTokenGroupsTTL", "PERSONAL_TOKEN_GROUPS_TTL", false, secondsType, "604800"},
+	{"ServiceTokenGracePeriod", "SERVICE_TOKEN_GRACE_PERIOD", false, secondsType, "86400"},
 }
 
 func readConfigVar(cfgVar configVar) (string, error) {
@@ -539,19 +645,24 @@ func ReadConfig() (*Config, error) {
 	return config, nil
 }
 
-// CheckAvailableGPUs checks if there are "nvidia.com/gpu" resources in the cluster
+// CheckAvailableGPUs checks if there are accelerator resources (e.g. "nvidia.com/gpu") in the cluster,
+// grouping them by resource name and GPU model
 func (cfg *Config) CheckAvailableGPUs(kubeClientset kubernetes.Interface) {
 	nodes, err := kubeClientset.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{LabelSelector: "!node-role.kubernetes.io/control-plane,!node-role.kubernetes.io/master"})
 	if err != nil {
 		log.Printf("Error getting list of nodes: %v\n", err)
+		return
 	}
+	modelLabel := cfg.GPUModelLabel
+	if modelLabel == "" {
+		modelLabel = DefaultGPUModelLabel
+	}
+	accelerators := []AvailableAccelerator{}
 	for _, node := range nodes.Items {
-		gpu := node.Status.Allocatable["nvidia.com/gpu"]
-		if gpu.Value() > 0 {
-			cfg.GPUAvailable = true
-			return
-		}
+		accelerators = MergeAccelerators(accelerators, NodeAccelerators(node, modelLabel))
 	}
+	cfg.AvailableAccelerators = accelerators
+	cfg.GPUAvailable = len(accelerators) > 0
 }
 
 // CheckAvailableInterLink checks if there is a node with a virtual-kubelet label
@@ -0,0 +1,273 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// sharedVolumePrefix prefix of the pod volumes created for the shared volumes. No volume managed by OSCAR
+// starts with it (e.g. the "shared-data" volume of the storage mounts), so they can't collide
+const sharedVolumePrefix = "shared-volume-"
+
+// reservedContainerNames names of the containers managed by OSCAR
+var reservedContainerNames = []string{ContainerName, ContainerSupervisorName, "rclone-container", "kserve-container"}
+
+// ServiceContainer additional container of the service pods, used to define init containers and sidecars
+type ServiceContainer struct {
+	// Name of the container
+	// Required. Must be a valid DNS label and unique in the service
+	Name string `json:"name"`
+
+	// Image container image
+	// Required
+	Image string `json:"image"`
+
+	// Command entrypoint of the container
+	// Optional. (default: the image entrypoint)
+	Command []string `json:"command,omitempty"`
+
+	// Args arguments of the entrypoint
+	// Optional
+	Args []string `json:"args,omitempty"`
+
+	// Environment variables of the container
+	// Optional
+	Environment map[string]string `json:"environment,omitempty"`
+
+	// CPU cpu limit for the container following the kubernetes format
+	// Optional
+	CPU string `json:"cpu,omitempty"`
+
+	// Memory memory limit for the container following the kubernetes format
+	// Optional
+	Memory string `json:"memory,omitempty"`
+
+	// VolumeMounts shared volumes mounted in the container
+	// Optional
+	VolumeMounts []ContainerVolumeMount `json:"volume_mounts,omitempty"`
+}
+
+// ContainerVolumeMount mount of a shared volume in an additional container
+type ContainerVolumeMount struct {
+	// Name of the shared volume
+	Name string `json:"name"`
+	// MountPath path inside the container
+	// Optional. (default: the mount path of the shared volume)
+	MountPath string `json:"mount_path,omitempty"`
+	// ReadOnly mount the volume as read-only
+	// Optional. (default: false)
+	ReadOnly bool `json:"read_only,omitempty"`
+}
+
+// SharedVolume ephemeral volume shared by the service container, its init containers and sidecars
+type SharedVolume struct {
+	// Name of the volume
+	// Required. Must be a valid DNS label of up to 49 characters and unique in the service
+	Name string `json:"name"`
+	// MountPath path where the volume is mounted in the service container
+	// Required
+	MountPath string `json:"mount_path"`
+	// SizeLimit maximum size of the volume following the kubernetes format
+	// Optional
+	SizeLimit string `json:"size_limit,omitempty"`
+}
+
+// HasAdditionalContainers returns true if the service defines init containers or sidecars
+func (service *Service) HasAdditionalContainers() bool {
+	return len(service.InitContainers) > 0 || len(service.Sidecars) > 0
+}
+
+// ValidateContainers checks the init containers, sidecars and shared volumes of the service
+func (service *Service) ValidateContainers() error {
+	volumes := map[string]bool{}
+	for _, volume := range service.SharedVolumes {
+		if errs := validation.IsDNS1123Label(volume.Name); len(errs) > 0 {
+			return fmt.Errorf("invalid shared volume name \"%s\": %v", volume.Name, errs)
+		}
+		if len(sharedVolumePrefix+volume.Name) > validation.DNS1123LabelMaxLength {
+			return fmt.Errorf("the shared volume name \"%s\" is longer than %d characters", volume.Name, validation.DNS1123LabelMaxLength-len(sharedVolumePrefix))
+		}
+		if volumes[volume.Name] {
+			return fmt.Errorf("the shared volume \"%s\" is defined more than once", volume.Name)
+		}
+		if volume.MountPath == "" {
+			return fmt.Errorf("the shared volume \"%s\" has no mount_path", volume.Name)
+		}
+		if volume.SizeLimit != "" {
+			if _, err := resource.ParseQuantity(volume.SizeLimit); err != nil {
+				return fmt.Errorf("invalid size_limit for shared volume \"%s\": %v", volume.Name, err)
+			}
+		}
+		volumes[volume.Name] = true
+	}
+
+	names := map[string]bool{}
+	for _, container := range slices.Concat(service.InitContainers, service.Sidecars) {
+		if errs := validation.IsDNS1123Label(container.Name); len(errs) > 0 {
+			return fmt.Errorf("invalid container name \"%s\": %v", container.Name, errs)
+		}
+		if slices.Contains(reservedContainerNames, container.Name) {
+			return fmt.Errorf("the container name \"%s\" is reserved", container.Name)
+		}
+		if names[container.Name] {
+			return fmt.Errorf("the container \"%s\" is defined more than once", container.Name)
+		}
+		names[container.Name] = true
+		if container.Image == "" {
+			return fmt.Errorf("the container \"%s\" has no image", container.Name)
+		}
+		if _, err := container.resources(); err != nil {
+			return fmt.Errorf("invalid resources for container \"%s\": %v", container.Name, err)
+		}
+		for _, mount := range container.VolumeMounts {
+			if !volumes[mount.Name] {
+				return fmt.Errorf("the container \"%s\" mounts the undefined shared volume \"%s\"", container.Name, mount.Name)
+			}
+		}
+	}
+	return nil
+}
+
+func (container ServiceContainer) resources() (v1.ResourceRequirements, error) {
+	resources := v1.ResourceRequirements{Limits: v1.ResourceList{}}
+	if container.CPU != "" {
+		cpu, err := resource.ParseQuantity(container.CPU)
+		if err != nil {
+			return resources, err
+		}
+		resources.Limits[v1.ResourceCPU] = cpu
+	}
+	if container.Memory != "" {
+		memory, err := resource.ParseQuantity(container.Memory)
+		if err != nil {
+			return resources, err
+		}
+		resources.Limits[v1.ResourceMemory] = memory
+	}
+	return resources, nil
+}
+
+func (container ServiceContainer) toContainer(volumes []SharedVolume) (v1.Container, error) {
+	resources, err := container.resources()
+	if err != nil {
+		return v1.Container{}, err
+	}
+	env := ConvertEnvVars(container.Environment)
+	// Keep a stable order to avoid unneeded rollouts
+	sort.Slice(env, func(i, j int) bool { return env[i].Name < env[j].Name })
+
+	c := v1.Container{
+		Name:            container.Name,
+		Image:           container.Image,
+		ImagePullPolicy: v1.PullIfNotPresent,
+		Command:         container.Command,
+		Args:            container.Args,
+		Env:             env,
+		Resources:       resources,
+	}
+	for _, mount := range container.VolumeMounts {
+		mountPath := mount.MountPath
+		if mountPath == "" {
+			for _, volume := range volumes {
+				if volume.Name == mount.Name {
+					mountPath = volume.MountPath
+				}
+			}
+		}
+		c.VolumeMounts = append(c.VolumeMounts, v1.VolumeMount{
+			Name:      sharedVolumePrefix + mount.Name,
+			MountPath: mountPath,
+			ReadOnly:  mount.ReadOnly,
+		})
+	}
+	return c, nil
+}
+
+// addServiceContainers adds the shared volumes, init containers and sidecars of the service to the podSpec.
+// Sidecars are defined as init containers with restartPolicy "Always" (native sidecars),
+// so they start before the service container and do not prevent jobs from completing.
+func addServiceContainers(podSpec *v1.PodSpec, service *Service) error {
+	for _, volume := range service.SharedVolumes {
+		emptyDir := &v1.EmptyDirVolumeSource{}
+		if volume.SizeLimit != "" {
+			sizeLimit, err := resource.ParseQuantity(volume.SizeLimit)
+			if err != nil {
+				return err
+			}
+			emptyDir.SizeLimit = &sizeLimit
+		}
+		podSpec.Volumes = append(podSpec.Volumes, v1.Volume{
+			Name:         sharedVolumePrefix + volume.Name,
+			VolumeSource: v1.VolumeSource{EmptyDir: emptyDir},
+		})
+		podSpec.Containers[0].VolumeMounts = append(podSpec.Containers[0].VolumeMounts, v1.VolumeMount{
+			Name:      sharedVolumePrefix + volume.Name,
+			MountPath: volume.MountPath,
+		})
+	}
+
+	for _, initContainer := range service.InitContainers {
+		container, err := initContainer.toContainer(service.SharedVolumes)
+		if err != nil {
+			return err
+		}
+		podSpec.InitContainers = append(podSpec.InitContainers, container)
+	}
+
+	restartAlways := v1.ContainerRestartPolicyAlways
+	for _, sidecar := range service.Sidecars {
+		container, err := sidecar.toContainer(service.SharedVolumes)
+		if err != nil {
+			return err
+		}
+		container.RestartPolicy = &restartAlways
+		podSpec.InitContainers = append(podSpec.InitContainers, container)
+	}
+	return nil
+}
+
+// SidecarsAsContainers moves the sidecars of the service from native sidecars to regular containers,
+// for runtimes that do not support init containers with restartPolicy "Always" (e.g. Knative).
+// The service container gets the port so it keeps receiving the requests.
+func SidecarsAsContainers(podSpec *v1.PodSpec, service *Service, port int32) {
+	if len(service.Sidecars) == 0 {
+		return
+	}
+	initContainers := []v1.Container{}
+	for _, container := range podSpec.InitContainers {
+		isSidecar := slices.ContainsFunc(service.Sidecars, func(sidecar ServiceContainer) bool {
+			return sidecar.Name == container.Name
+		})
+		if !isSidecar {
+			initContainers = append(initContainers, container)
+			continue
+		}
+		container.RestartPolicy = nil
+		podSpec.Containers = append(podSpec.Containers, container)
+	}
+	podSpec.InitContainers = initContainers
+	if len(podSpec.Containers[0].Ports) == 0 {
+		podSpec.Containers[0].Ports = []v1.ContainerPort{{ContainerPort: port}}
+	}
+}
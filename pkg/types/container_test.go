@@ -0,0 +1,168 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/barkimedes/go-deepcopy"
+	v1 "k8s.io/api/core/v1"
+)
+
+func serviceWithContainers(t *testing.T) Service {
+	copy, err := deepcopy.Anything(testService)
+	if err != nil {
+		t.Fatalf("unable to deep copy the testService: %v", err)
+	}
+	svc := copy.(Service)
+	svc.CPU = "1"
+	svc.Memory = "1Gi"
+	svc.SharedVolumes = []SharedVolume{{Name: "data", MountPath: "/data", SizeLimit: "1Gi"}}
+	svc.InitContainers = []ServiceContainer{{
+		Name:         "fetch-model",
+		Image:        "busybox",
+		Command:      []string{"sh", "-c", "wget -O /model/model.bin $URL"},
+		Environment:  map[string]string{"URL": "http://example.com/model.bin"},
+		VolumeMounts: []ContainerVolumeMount{{Name: "data", MountPath: "/model"}},
+	}}
+	svc.Sidecars = []ServiceContainer{{
+		Name:         "log-shipper",
+		Image:        "fluent-bit",
+		CPU:          "100m",
+		Memory:       "64Mi",
+		VolumeMounts: []ContainerVolumeMount{{Name: "data", ReadOnly: true}},
+	}}
+	return svc
+}
+
+func TestToPodSpecWithContainers(t *testing.T) {
+	svc := serviceWithContainers(t)
+
+	podSpec, err := svc.ToPodSpec(&testConfig)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var dataVolume *v1.Volume
+	for i := range podSpec.Volumes {
+		if podSpec.Volumes[i].Name == "shared-volume-data" {
+			dataVolume = &podSpec.Volumes[i]
+		}
+	}
+	if dataVolume == nil || dataVolume.EmptyDir == nil {
+		t.Fatalf("expected an emptyDir volume for the shared volume, got %v", podSpec.Volumes)
+	}
+	if dataVolume.EmptyDir.SizeLimit == nil || dataVolume.EmptyDir.SizeLimit.String() != "1Gi" {
+		t.Errorf("expected size limit 1Gi, got %v", dataVolume.EmptyDir.SizeLimit)
+	}
+
+	mounted := false
+	for _, mount := range podSpec.Containers[0].VolumeMounts {
+		if mount.Name == "shared-volume-data" && mount.MountPath == "/data" {
+			mounted = true
+		}
+	}
+	if !mounted {
+		t.Errorf("expected the shared volume to be mounted in the service container, got %v", podSpec.Containers[0].VolumeMounts)
+	}
+
+	if len(podSpec.InitContainers) != 2 {
+		t.Fatalf("expected 2 init containers, got %d", len(podSpec.InitContainers))
+	}
+	initContainer := podSpec.InitContainers[0]
+	if initContainer.Name != "fetch-model" || initContainer.RestartPolicy != nil {
+		t.Errorf("unexpected init container %s with restart policy %v", initContainer.Name, initContainer.RestartPolicy)
+	}
+	if initContainer.VolumeMounts[0].MountPath != "/model" {
+		t.Errorf("expected mount path /model, got %s", initContainer.VolumeMounts[0].MountPath)
+	}
+	if len(initContainer.Env) != 1 || initContainer.Env[0].Name != "URL" {
+		t.Errorf("unexpected environment %v", initContainer.Env)
+	}
+
+	sidecar := podSpec.InitContainers[1]
+	if sidecar.Name != "log-shipper" {
+		t.Fatalf("expected sidecar log-shipper, got %s", sidecar.Name)
+	}
+	if sidecar.RestartPolicy == nil || *sidecar.RestartPolicy != v1.ContainerRestartPolicyAlways {
+		t.Errorf("expected sidecar restart policy Always, got %v", sidecar.RestartPolicy)
+	}
+	if sidecar.VolumeMounts[0].MountPath != "/data" || !sidecar.VolumeMounts[0].ReadOnly {
+		t.Errorf("expected read-only mount in /data, got %v", sidecar.VolumeMounts[0])
+	}
+	if sidecar.Resources.Limits.Memory().String() != "64Mi" {
+		t.Errorf("expected memory limit 64Mi, got %s", sidecar.Resources.Limits.Memory().String())
+	}
+}
+
+func TestSidecarsAsContainers(t *testing.T) {
+	svc := serviceWithContainers(t)
+
+	podSpec, err := svc.ToPodSpec(&testConfig)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	SidecarsAsContainers(podSpec, &svc, 8080)
+
+	if len(podSpec.InitContainers) != 1 || podSpec.InitContainers[0].Name != "fetch-model" {
+		t.Errorf("expected only the fetch-model init container, got %v", podSpec.InitContainers)
+	}
+	if len(podSpec.Containers) != 2 || podSpec.Containers[1].Name != "log-shipper" {
+		t.Fatalf("expected the sidecar as a regular container, got %v", podSpec.Containers)
+	}
+	if podSpec.Containers[1].RestartPolicy != nil {
+		t.Errorf("expected no restart policy in the sidecar container")
+	}
+	if len(podSpec.Containers[0].Ports) != 1 || podSpec.Containers[0].Ports[0].ContainerPort != 8080 {
+		t.Errorf("expected port 8080 in the service container, got %v", podSpec.Containers[0].Ports)
+	}
+}
+
+func TestValidateContainers(t *testing.T) {
+	scenarios := []struct {
+		name   string
+		modify func(svc *Service)
+		valid  bool
+	}{
+		{"valid", func(svc *Service) {}, true},
+		{"no containers", func(svc *Service) { svc.InitContainers, svc.Sidecars, svc.SharedVolumes = nil, nil, nil }, true},
+		{"missing image", func(svc *Service) { svc.Sidecars[0].Image = "" }, false},
+		{"invalid name", func(svc *Service) { svc.Sidecars[0].Name = "Log_Shipper" }, false},
+		{"reserved name", func(svc *Service) { svc.Sidecars[0].Name = ContainerName }, false},
+		{"duplicated name", func(svc *Service) { svc.Sidecars[0].Name = "fetch-model" }, false},
+		{"undefined volume", func(svc *Service) { svc.Sidecars[0].VolumeMounts[0].Name = "other" }, false},
+		{"invalid resources", func(svc *Service) { svc.Sidecars[0].CPU = "1cpu" }, false},
+		{"too long volume name", func(svc *Service) { svc.SharedVolumes[0].Name = strings.Repeat("a", 50) }, false},
+		{"volume without path", func(svc *Service) { svc.SharedVolumes[0].MountPath = "" }, false},
+		{"invalid size limit", func(svc *Service) { svc.SharedVolumes[0].SizeLimit = "1gb" }, false},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			svc := serviceWithContainers(t)
+			s.modify(&svc)
+			err := svc.ValidateContainers()
+			if s.valid && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !s.valid && err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+const (
+	// FanoutRunLabel label of the jobs and records of a fan-out run storing the name of the run
+	FanoutRunLabel = "oscar.grycap/fanout-run"
+
+	// FanoutServiceLabel label of the records of the fan-out runs storing the name of their service
+	FanoutServiceLabel = "oscar.grycap/fanout-service"
+
+	// FanoutRunning status of the runs with jobs to submit or unfinished
+	FanoutRunning = "Running"
+
+	// FanoutCompleted status of the runs whose jobs have all finished
+	FanoutCompleted = "Completed"
+
+	// FanoutCancelled status of the cancelled runs
+	FanoutCancelled = "Cancelled"
+
+	// FanoutFailed status of the runs whose submission was interrupted, as when the manager restarts
+	FanoutFailed = "Failed"
+)
+
+// FanoutRequest payload for POST /system/services/:serviceName/fanout
+type FanoutRequest struct {
+	// Name name of the run, generated if empty
+	Name string `json:"name,omitempty"`
+	// StorageIOConfig storage provider and path of the objects, filtered by prefix and suffix like the service inputs
+	StorageIOConfig
+}
+
+// FanoutProgress number of objects of a fan-out run in each state
+type FanoutProgress struct {
+	// Pending objects whose job has not been submitted or is not running yet
+	Pending int `json:"pending"`
+	// Running objects whose job is running
+	Running int `json:"running"`
+	// Succeeded objects whose job succeeded
+	Succeeded int `json:"succeeded"`
+	// Failed objects whose job failed or could not be submitted
+	Failed int `json:"failed"`
+}
+
+// FanoutRun run of a service over the objects of a storage path
+type FanoutRun struct {
+	Name      string `json:"name"`
+	Service   string `json:"service"`
+	Namespace string `json:"namespace"`
+	// StorageProvider provider of the objects (e.g. "minio.default")
+	StorageProvider string   `json:"storage_provider"`
+	Path            string   `json:"path"`
+	Prefix          []string `json:"prefix,omitempty"`
+	Suffix          []string `json:"suffix,omitempty"`
+	// Owner UID of the user that started the run
+	Owner  string `json:"owner,omitempty"`
+	Status string `json:"status"`
+	// Message last error submitting the jobs of the run
+	Message   string      `json:"message,omitempty"`
+	CreatedAt metav1.Time `json:"created_at"`
+	// Objects number of objects matching the path and filters
+	Objects int `json:"objects"`
+	// Submitted number of jobs created
+	Submitted int            `json:"submitted"`
+	Progress  FanoutProgress `json:"progress"`
+	// SubmitterHeartbeat last time the submission of the jobs recorded its progress, empty once all of them are submitted
+	SubmitterHeartbeat *metav1.Time `json:"submitter_heartbeat,omitempty"`
+}
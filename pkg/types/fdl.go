@@ -0,0 +1,170 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+const (
+	// AppliedFDLHashAnnotation annotation storing the hash of the definition applied through /system/apply
+	AppliedFDLHashAnnotation = "oscar.grycap/applied-fdl-hash"
+	// AppliedByAnnotation annotation storing the user that applied the definition through /system/apply
+	AppliedByAnnotation = "oscar.grycap/applied-by"
+
+	// ApplyActionCreate the service does not exist and will be created
+	ApplyActionCreate = "create"
+	// ApplyActionUpdate the service exists and its definition changed
+	ApplyActionUpdate = "update"
+	// ApplyActionNoOp the service exists and its definition did not change
+	ApplyActionNoOp = "no-op"
+	// ApplyActionDelete the service is no longer in the document and will be deleted
+	ApplyActionDelete = "delete"
+)
+
+// FDL represents a Function Definition Language document as used by OSCAR-CLI
+type FDL struct {
+	// Functions services to deploy grouped by platform
+	Functions FDLFunctions `json:"functions"`
+	// StorageProviders storage providers shared by all the services in the document
+	// Optional
+	StorageProviders *StorageProviders `json:"storage_providers,omitempty"`
+	// Clusters OSCAR clusters shared by all the services in the document
+	// Optional
+	Clusters map[string]Cluster `json:"clusters,omitempty"`
+}
+
+// FDLFunctions services of a FDL document
+type FDLFunctions struct {
+	// Oscar list of services indexed by the identifier of the target cluster
+	Oscar []map[string]*Service `json:"oscar"`
+}
+
+// Services returns the services defined in the document for the provided cluster
+// (all clusters if clusterID is empty) with the shared storage providers and clusters merged
+func (fdl *FDL) Services(clusterID string) ([]Service, error) {
+	services := []Service{}
+	names := map[string]bool{}
+	for _, entry := range fdl.Functions.Oscar {
+		for _, id := range slices.Sorted(maps.Keys(entry)) {
+			svc := entry[id]
+			if svc == nil || (clusterID != "" && id != clusterID) {
+				continue
+			}
+			if svc.Name == "" {
+				return nil, fmt.Errorf("the service definition for cluster \"%s\" has no name", id)
+			}
+			if names[svc.Name] {
+				return nil, fmt.Errorf("the service \"%s\" is defined more than once", svc.Name)
+			}
+			names[svc.Name] = true
+
+			service := *svc
+			service.ClusterID = id
+			service.StorageProviders = mergeStorageProviders(service.StorageProviders, fdl.StorageProviders)
+			if len(fdl.Clusters) > 0 {
+				clusters := make(map[string]Cluster, len(fdl.Clusters)+len(service.Clusters))
+				maps.Copy(clusters, fdl.Clusters)
+				maps.Copy(clusters, service.Clusters)
+				service.Clusters = clusters
+			}
+			services = append(services, service)
+		}
+	}
+	return services, nil
+}
+
+// mergeStorageProviders adds the shared providers not already defined by the service
+func mergeStorageProviders(service *StorageProviders, shared *StorageProviders) *StorageProviders {
+	if shared == nil {
+		return service
+	}
+	merged := &StorageProviders{}
+	if service != nil {
+		*merged = *service
+	}
+	merged.S3 = mergeProviderMap(merged.S3, shared.S3)
+	merged.MinIO = mergeProviderMap(merged.MinIO, shared.MinIO)
+	merged.Onedata = mergeProviderMap(merged.Onedata, shared.Onedata)
+	merged.WebDav = mergeProviderMap(merged.WebDav, shared.WebDav)
+	merged.Rucio = mergeProviderMap(merged.Rucio, shared.Rucio)
+	return merged
+}
+
+func mergeProviderMap[T any](service map[string]*T, shared map[string]*T) map[string]*T {
+	if len(shared) == 0 {
+		return service
+	}
+	merged := make(map[string]*T, len(service)+len(shared))
+	maps.Copy(merged, shared)
+	maps.Copy(merged, service)
+	return merged
+}
+
+// ApplyHash returns a stable hash of the service definition, ignoring the annotations set by /system/apply
+func ApplyHash(service Service) (string, error) {
+	annotations := make(map[string]string, len(service.Annotations))
+	for k, v := range service.Annotations {
+		if k != AppliedFDLHashAnnotation && k != AppliedByAnnotation {
+			annotations[k] = v
+		}
+	}
+	service.Annotations = annotations
+	raw, err := json.Marshal(service)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// ServiceApplyResult outcome of the action computed for a service
+type ServiceApplyResult struct {
+	// Service name of the service
+	Service string `json:"service"`
+	// ClusterID identifier of the cluster in the FDL document
+	ClusterID string `json:"cluster_id,omitempty"`
+	// Action computed action (create, update, no-op or delete)
+	Action string `json:"action"`
+	// Status HTTP status returned when applying the action
+	Status int `json:"status,omitempty"`
+	// Error message when the action could not be applied
+	Error string `json:"error,omitempty"`
+}
+
+// ApplyReport result of a /system/apply request
+type ApplyReport struct {
+	// DryRun true when the actions were only computed
+	DryRun bool `json:"dry_run"`
+	// Results per-service results in the order they were applied
+	Results []ServiceApplyResult `json:"results"`
+}
+
+// Failed returns true if any action could not be applied
+func (report *ApplyReport) Failed() bool {
+	for _, result := range report.Results {
+		if result.Error != "" {
+			return true
+		}
+	}
+	return false
+}
@@ -47,17 +47,17 @@ func SetInterlinkJob(podSpec *v1.PodSpec, service *Service, cfg *Config, eventBy
 		Value: base64.StdEncoding.EncodeToString([]byte(eventBytes)),
 	}
 	args := OscarContainerCommand
-	podSpec.NodeSelector = map[string]string{
-		NodeSelectorKey: service.InterLinkNodeName,
+	// Keep the scheduling constraints defined in the service
+	if podSpec.NodeSelector == nil {
+		podSpec.NodeSelector = map[string]string{}
 	}
+	podSpec.NodeSelector[NodeSelectorKey] = service.InterLinkNodeName
 	podSpec.DNSPolicy = InterLinkDNSPolicy
 	podSpec.RestartPolicy = InterLinkRestartPolicy
-	podSpec.Tolerations = []v1.Toleration{
-		{
-			Key:      InterLinkTolerationKey,
-			Operator: InterLinkTolerationOperator,
-		},
-	}
+	podSpec.Tolerations = append(podSpec.Tolerations, v1.Toleration{
+		Key:      InterLinkTolerationKey,
+		Operator: InterLinkTolerationOperator,
+	})
 
 	addInitContainer(podSpec, cfg)
 	return command, event, args
@@ -97,7 +97,7 @@ func addInitContainer(podSpec *v1.PodSpec, cfg *Config) {
 			},
 		},
 	}
-	podSpec.InitContainers = []v1.Container{initContainer}
+	podSpec.InitContainers = append([]v1.Container{initContainer}, podSpec.InitContainers...)
 }
 
 func IsInterLinkService(service *Service, cfg *Config) bool {
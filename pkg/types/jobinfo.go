@@ -16,7 +16,35 @@ limitations under the License.
 
 package types
 
-import metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+import (
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// JobDelegatedReason reason of the Kubernetes events recorded when a job is delegated to another cluster
+const JobDelegatedReason = "Delegated"
+
+// Kueue admission states of a job
+const (
+	KueueAdmissionPending  = "Pending"
+	KueueAdmissionAdmitted = "Admitted"
+)
+
+// Statuses of the jobs stopped by their users
+const (
+	JobStatusCancelled = "Cancelled"
+	JobStatusSuspended = "Suspended"
+	JobStatusQueued    = "Queued"
+)
+
+// Statuses of the jobs failed by the retry policy of their service
+const (
+	JobStatusDeadlineExceeded = "DeadlineExceeded"
+	JobStatusRetriesExhausted = "RetriesExhausted"
+)
 
 // JobInfo details the current status of a service's job
 type JobInfo struct {
@@ -24,10 +52,160 @@ type JobInfo struct {
 	CreationTime *metav1.Time `json:"creation_time,omitempty"`
 	StartTime    *metav1.Time `json:"start_time,omitempty"`
 	FinishTime   *metav1.Time `json:"finish_time,omitempty"`
+	// ExitCode exit code of the service container, once terminated
+	ExitCode *int32 `json:"exit_code,omitempty"`
+	// Reason termination or failure reason (e.g. OOMKilled, Error, DeadlineExceeded, BackoffLimitExceeded)
+	Reason string `json:"reason,omitempty"`
+	// Message human readable details of the termination or failure
+	Message string `json:"message,omitempty"`
+	// Retries number of failed pods and container restarts of the job
+	Retries int32 `json:"retries,omitempty"`
+	// NodeName node running the job pod
+	NodeName string `json:"node_name,omitempty"`
+	// KueueAdmission admission state of the job in Kueue (Pending or Admitted)
+	KueueAdmission string `json:"kueue_admission,omitempty"`
+	// DelegatedTo cluster the job was delegated to
+	DelegatedTo string `json:"delegated_to,omitempty"`
+	// DelegatedFrom cluster that delegated the job
+	DelegatedFrom string `json:"delegated_from,omitempty"`
+	// RerunOf job whose event was submitted again to create the job
+	RerunOf string `json:"rerun_of,omitempty"`
+	// Archived the job no longer exists and its information is read from the job archive
+	Archived bool `json:"archived,omitempty"`
+}
+
+// JobEvent Kubernetes event related to a job or its pods
+type JobEvent struct {
+	Type      string       `json:"type"`
+	Reason    string       `json:"reason"`
+	Message   string       `json:"message"`
+	Object    string       `json:"object"`
+	Count     int32        `json:"count,omitempty"`
+	FirstTime *metav1.Time `json:"first_time,omitempty"`
+	LastTime  *metav1.Time `json:"last_time,omitempty"`
+}
+
+// JobStatus detailed status of a service's job
+type JobStatus struct {
+	Name string `json:"name"`
+	JobInfo
+	Events []JobEvent `json:"events"`
+}
+
+// JobHandle reference to a job created by an asynchronous invocation
+type JobHandle struct {
+	// JobName name of the job
+	JobName string `json:"job_name"`
+	// Namespace namespace of the job
+	Namespace string `json:"namespace"`
+	// Delegated true if the job has been delegated to another cluster
+	Delegated bool `json:"delegated,omitempty"`
+	// StatusURL path of the job status endpoint
+	StatusURL string `json:"status_url"`
+	// WaitURL path of the endpoint to wait for the job result
+	WaitURL string `json:"wait_url"`
+	// LogsURL path of the job logs endpoint
+	LogsURL string `json:"logs_url"`
+}
+
+// JobRerunRequest overrides of the service definition applied when a job is run again
+type JobRerunRequest struct {
+	// CPU cpu limit of the new job, following the kubernetes format
+	CPU string `json:"cpu,omitempty"`
+	// Memory memory limit of the new job, following the kubernetes format
+	Memory string `json:"memory,omitempty"`
+	// Environment variables added to, or replacing, the environment of the service
+	Environment map[string]string `json:"environment,omitempty"`
+}
+
+// JobBatchResult result of the submission of an event of a batch
+type JobBatchResult struct {
+	// Index position of the event in the batch
+	Index int `json:"index"`
+	// Status HTTP status code of the submission of the event
+	Status int `json:"status"`
+	*JobHandle
+	// Error reason why the job of the event was not created
+	Error string `json:"error,omitempty"`
+}
+
+// JobBatchResponse results of a batch submission, in the order of the events
+type JobBatchResponse struct {
+	// Submitted number of events with a job
+	Submitted int `json:"submitted"`
+	// Failed number of events without a job
+	Failed  int              `json:"failed"`
+	Results []JobBatchResult `json:"results"`
+}
+
+// JobResult final status of a job and the output objects uploaded by the FaaS Supervisor
+type JobResult struct {
+	JobStatus
+	// Finished false if the wait timed out before the job finished
+	Finished bool `json:"finished"`
+	// Outputs keys of the output objects uploaded by the FaaS Supervisor, prefixed by their bucket
+	Outputs []string `json:"outputs"`
+}
+
+// JobRecord archived status of a finished job
+type JobRecord struct {
+	Name      string `json:"name"`
+	Service   string `json:"service"`
+	Namespace string `json:"namespace"`
+	// Owner value of the job owner label of the job
+	Owner string `json:"owner,omitempty"`
+	JobInfo
+	// EventSHA256 hex encoded SHA-256 hash of the event payload of the job
+	EventSHA256 string `json:"event_sha256,omitempty"`
+	// ArchivedAt time the job was archived
+	ArchivedAt time.Time `json:"archived_at"`
 }
 
 type JobsResponse struct {
 	Jobs         map[string]*JobInfo `json:"jobs"`
 	NextPage     string              `json:"next_page,omitempty"`
 	RemainingJob *int64              `json:"remaining_jobs,omitempty"`
+	// MaxConcurrentJobs maximum number of jobs of the service running simultaneously, if limited
+	MaxConcurrentJobs int `json:"max_concurrent_jobs,omitempty"`
+	// QueuedJobs number of jobs of the service waiting for the end of the running ones
+	QueuedJobs int `json:"queued_jobs,omitempty"`
+}
+
+// JobFinished returns true if the job has completed or failed
+func JobFinished(job *batchv1.Job) bool {
+	for _, condition := range job.Status.Conditions {
+		if (condition.Type == batchv1.JobComplete || condition.Type == batchv1.JobFailed) && condition.Status == v1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// JobFailedStatus returns true if the status is the one of a failed job, including the failures of the retry policy
+func JobFailedStatus(status string) bool {
+	return status == string(v1.PodFailed) || status == JobStatusDeadlineExceeded || status == JobStatusRetriesExhausted
+}
+
+// JobCancelled returns true if the job was cancelled by a user
+func JobCancelled(job *batchv1.Job) bool {
+	_, ok := job.Annotations[JobCancelledAnnotation]
+	return ok
+}
+
+// JobStopped returns true if the job has finished or has been cancelled without active pods,
+// as the cancelled jobs that were suspended never finish
+func JobStopped(job *batchv1.Job) bool {
+	return JobFinished(job) || JobCancelled(job) && job.Status.Active == 0
+}
+
+// JobHeld returns true if the job is waiting for the MaxConcurrentJobs limit of its service
+func JobHeld(job *batchv1.Job) bool {
+	_, ok := job.Labels[JobHeldLabel]
+	return ok
+}
+
+// JobSuspendedByUser returns true if the job was suspended by a user, and not only waiting for Kueue admission
+func JobSuspendedByUser(job *batchv1.Job) bool {
+	_, ok := job.Annotations[JobSuspendedAnnotation]
+	return ok && job.Spec.Suspend != nil && *job.Spec.Suspend
 }
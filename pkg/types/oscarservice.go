@@ -0,0 +1,96 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// OSCARServiceGroup API group of the OSCARService custom resource
+	OSCARServiceGroup = "oscar.grycap.upv.es"
+	// OSCARServiceVersion API version of the OSCARService custom resource
+	OSCARServiceVersion = "v1alpha1"
+	// OSCARServiceKind kind of the OSCARService custom resource
+	OSCARServiceKind = "OSCARService"
+	// OSCARServiceFinalizer finalizer used to delete the service before removing the resource
+	OSCARServiceFinalizer = "oscar.grycap.upv.es/service-cleanup"
+	// OSCARServiceAnnotation annotation of the services managed by an OSCARService resource, with its "namespace/name" key
+	OSCARServiceAnnotation = "oscar.grycap.upv.es/oscarservice"
+
+	// OSCARServiceConditionReady the service is applied and all its resources are ready
+	OSCARServiceConditionReady = "Ready"
+	// OSCARServiceConditionBucketsReady the storage buckets of the service are configured
+	OSCARServiceConditionBucketsReady = "BucketsReady"
+	// OSCARServiceConditionExposeReady the exposed deployment of the service is available
+	OSCARServiceConditionExposeReady = "ExposeReady"
+	// OSCARServiceConditionVolumeReady the managed volume of the service is ready
+	OSCARServiceConditionVolumeReady = "VolumeReady"
+)
+
+// OSCARServiceGVR GroupVersionResource of the OSCARService custom resource
+var OSCARServiceGVR = schema.GroupVersionResource{
+	Group:    OSCARServiceGroup,
+	Version:  OSCARServiceVersion,
+	Resource: "oscarservices",
+}
+
+// OSCARServiceStatus status subresource of the OSCARService custom resource
+type OSCARServiceStatus struct {
+	// ObservedGeneration generation of the spec last reconciled
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// LastAction last action applied to the service (create, update or no-op)
+	LastAction string `json:"lastAction,omitempty"`
+	// Conditions current conditions of the service
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// ServiceFromOSCARService returns the service defined in the spec of an OSCARService resource.
+// The service is always named after the resource and annotated with its key.
+func ServiceFromOSCARService(obj *unstructured.Unstructured) (*Service, error) {
+	spec, found, err := unstructured.NestedMap(obj.Object, "spec")
+	if err != nil {
+		return nil, fmt.Errorf("invalid spec: %v", err)
+	}
+	if !found {
+		return nil, fmt.Errorf("the resource has no spec")
+	}
+	raw, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+	service := &Service{}
+	if err := json.Unmarshal(raw, service); err != nil {
+		return nil, fmt.Errorf("invalid spec: %v", err)
+	}
+	service.Name = obj.GetName()
+	if service.Annotations == nil {
+		service.Annotations = map[string]string{}
+	}
+	service.Annotations[OSCARServiceAnnotation] = OSCARServiceKey(obj.GetNamespace(), obj.GetName())
+	return service, nil
+}
+
+// OSCARServiceKey returns the key ("namespace/name") of an OSCARService resource
+func OSCARServiceKey(namespace string, name string) string {
+	return namespace + "/" + name
+}
@@ -0,0 +1,63 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"time"
+)
+
+// PersonalToken personal access token of a user, accepted as a bearer token instead of its OIDC token
+type PersonalToken struct {
+	// ID public identifier of the token, used to revoke it
+	ID string `json:"id"`
+	// Name description of the token provided by its owner (e.g. the CI pipeline using it)
+	Name string `json:"name"`
+	// Owner UID of the user owning the token
+	Owner string `json:"owner"`
+	// UserName name of the owner when the token was created
+	UserName string `json:"user_name,omitempty"`
+	// Groups OIDC groups of the owner the last time they were read from the OIDC provider, used to check its VOs
+	Groups []string `json:"groups,omitempty"`
+	// GroupsCheckedAt time the groups of the owner were last read from the OIDC provider
+	GroupsCheckedAt time.Time `json:"groups_checked_at"`
+	// CreatedAt time the token was created
+	CreatedAt time.Time `json:"created_at"`
+	// ExpiresAt time the token expires
+	ExpiresAt time.Time `json:"expires_at"`
+	// Token secret value of the token, only returned when it is created
+	Token string `json:"token,omitempty"`
+}
+
+// PersonalTokenRequest request to create a personal access token
+type PersonalTokenRequest struct {
+	// Name description of the token
+	Name string `json:"name" binding:"required"`
+	// ExpiresIn validity of the token in seconds
+	// Optional. (default: the maximum validity allowed by the cluster)
+	ExpiresIn int64 `json:"expires_in,omitempty"`
+}
+
+// GroupsOutdated returns true if the groups of the owner were read from the OIDC provider longer than ttl ago.
+// A ttl of zero trusts the groups until the token expires
+func (token *PersonalToken) GroupsOutdated(now time.Time, ttl time.Duration) bool {
+	return ttl > 0 && now.Sub(token.GroupsCheckedAt) >= ttl
+}
+
+// Expired returns true if the token has expired at the provided time
+func (token *PersonalToken) Expired(now time.Time) bool {
+	return !now.Before(token.ExpiresAt)
+}
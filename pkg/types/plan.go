@@ -0,0 +1,72 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+// ServicePlan result of a dry-run service creation or update
+type ServicePlan struct {
+	// Operation requested operation (create or update)
+	Operation string `json:"operation"`
+	// Service name of the planned service
+	Service string `json:"service"`
+	// Namespace namespace where the resources would be created
+	Namespace string `json:"namespace,omitempty"`
+	// Valid true when no validation errors were found
+	Valid bool `json:"valid"`
+	// Errors validation errors that would make the request fail
+	Errors []string `json:"errors,omitempty"`
+	// Resources Kubernetes objects that would be created or updated
+	Resources []PlannedResource `json:"resources"`
+	// Buckets storage buckets and policies that would be configured
+	Buckets []PlannedBucket `json:"buckets,omitempty"`
+}
+
+// PlannedResource Kubernetes object rendered by a dry-run
+type PlannedResource struct {
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+	Object    any    `json:"object"`
+}
+
+// PlannedBucket storage bucket rendered by a dry-run
+type PlannedBucket struct {
+	Name         string   `json:"name"`
+	Provider     string   `json:"provider"`
+	Folders      []string `json:"folders,omitempty"`
+	Webhook      bool     `json:"webhook,omitempty"`
+	Visibility   string   `json:"visibility,omitempty"`
+	AllowedUsers []string `json:"allowed_users,omitempty"`
+	Owner        string   `json:"owner,omitempty"`
+}
+
+// AddError appends a validation error to the plan
+func (plan *ServicePlan) AddError(err error) {
+	if err == nil {
+		return
+	}
+	plan.Errors = append(plan.Errors, err.Error())
+}
+
+// AddResource appends a rendered object to the plan
+func (plan *ServicePlan) AddResource(kind string, name string, namespace string, object any) {
+	plan.Resources = append(plan.Resources, PlannedResource{
+		Kind:      kind,
+		Name:      name,
+		Namespace: namespace,
+		Object:    object,
+	})
+}
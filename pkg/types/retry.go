@@ -0,0 +1,124 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+)
+
+// maxRetryExitCodes maximum number of exit codes of a kubernetes PodFailurePolicy rule
+const maxRetryExitCodes = 255
+
+// JobRetryPolicy retry, failure and deadline policy of the asynchronous jobs of a service
+type JobRetryPolicy struct {
+	// MaxRetries number of times a failed job is retried before it is marked as failed
+	// Optional. (default: 0)
+	MaxRetries int32 `json:"max_retries,omitempty"`
+
+	// RetryOnExitCodes exit codes of the service container that are retried. Failures with any other exit
+	// code fail the job without retries. Pod disruptions (e.g. evictions) are retried without counting them
+	// Optional. (default: all the failures are retried)
+	RetryOnExitCodes []int32 `json:"retry_on_exit_codes,omitempty"`
+
+	// ActiveDeadlineSeconds maximum duration of a job, including its retries, before it is terminated
+	// Optional. (default: 0, no deadline)
+	ActiveDeadlineSeconds int64 `json:"active_deadline_seconds,omitempty"`
+
+	// RestartPolicy restart policy of the job pods: Never (retries create new pods) or OnFailure
+	// (retries restart the container in the same pod). OnFailure can't be used with RetryOnExitCodes
+	// Optional. (default: Never)
+	RestartPolicy string `json:"restart_policy,omitempty"`
+}
+
+// Validate checks the retries, exit codes, deadline and restart policy of the policy
+func (policy *JobRetryPolicy) Validate() error {
+	if policy.MaxRetries < 0 {
+		return fmt.Errorf("retry_policy max_retries must be a positive number")
+	}
+	if policy.ActiveDeadlineSeconds < 0 {
+		return fmt.Errorf("retry_policy active_deadline_seconds must be a positive number, or 0 for no deadline")
+	}
+	switch strings.ToLower(policy.RestartPolicy) {
+	case "", "never", "onfailure":
+	default:
+		return fmt.Errorf("invalid retry_policy restart_policy \"%s\": must be Never or OnFailure", policy.RestartPolicy)
+	}
+	if len(policy.RetryOnExitCodes) > maxRetryExitCodes {
+		return fmt.Errorf("retry_policy retry_on_exit_codes can't have more than %d exit codes", maxRetryExitCodes)
+	}
+	for _, code := range policy.RetryOnExitCodes {
+		if code < 1 || code > 255 {
+			return fmt.Errorf("invalid retry_policy exit code %d: must be between 1 and 255", code)
+		}
+	}
+	if len(policy.RetryOnExitCodes) > 0 && policy.KubeRestartPolicy() != v1.RestartPolicyNever {
+		return fmt.Errorf("retry_policy retry_on_exit_codes requires the Never restart_policy")
+	}
+	return nil
+}
+
+// KubeRestartPolicy returns the kubernetes restart policy of the job pods
+func (policy *JobRetryPolicy) KubeRestartPolicy() v1.RestartPolicy {
+	if strings.EqualFold(policy.RestartPolicy, "onfailure") {
+		return v1.RestartPolicyOnFailure
+	}
+	return v1.RestartPolicyNever
+}
+
+// PodFailurePolicy returns the kubernetes PodFailurePolicy that fails the job on the exit codes not retried,
+// or nil if all the failures are retried
+func (policy *JobRetryPolicy) PodFailurePolicy() *batchv1.PodFailurePolicy {
+	if len(policy.RetryOnExitCodes) == 0 {
+		return nil
+	}
+	// Kubernetes requires the exit codes sorted and without duplicates
+	codes := slices.Clone(policy.RetryOnExitCodes)
+	slices.Sort(codes)
+	codes = slices.Compact(codes)
+	containerName := ContainerName
+	return &batchv1.PodFailurePolicy{
+		Rules: []batchv1.PodFailurePolicyRule{
+			{
+				Action: batchv1.PodFailurePolicyActionIgnore,
+				OnPodConditions: []batchv1.PodFailurePolicyOnPodConditionsPattern{
+					{Type: v1.DisruptionTarget, Status: v1.ConditionTrue},
+				},
+			},
+			{
+				Action: batchv1.PodFailurePolicyActionFailJob,
+				OnExitCodes: &batchv1.PodFailurePolicyOnExitCodesRequirement{
+					ContainerName: &containerName,
+					Operator:      batchv1.PodFailurePolicyOnExitCodesOpNotIn,
+					Values:        codes,
+				},
+			},
+		},
+	}
+}
+
+// ValidateRetryPolicy checks the retry policy of the service
+func (service *Service) ValidateRetryPolicy() error {
+	if service.RetryPolicy == nil {
+		return nil
+	}
+	return service.RetryPolicy.Validate()
+}
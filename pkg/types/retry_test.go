@@ -0,0 +1,91 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"slices"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestJobRetryPolicyValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy JobRetryPolicy
+		valid  bool
+	}{
+		{"empty", JobRetryPolicy{}, true},
+		{"complete", JobRetryPolicy{MaxRetries: 3, RetryOnExitCodes: []int32{1, 75}, ActiveDeadlineSeconds: 60, RestartPolicy: "Never"}, true},
+		{"on failure", JobRetryPolicy{MaxRetries: 1, RestartPolicy: "onfailure"}, true},
+		{"negative retries", JobRetryPolicy{MaxRetries: -1}, false},
+		{"negative deadline", JobRetryPolicy{ActiveDeadlineSeconds: -1}, false},
+		{"invalid restart policy", JobRetryPolicy{RestartPolicy: "Always"}, false},
+		{"invalid exit code", JobRetryPolicy{RetryOnExitCodes: []int32{0}}, false},
+		{"exit code out of range", JobRetryPolicy{RetryOnExitCodes: []int32{256}}, false},
+		{"exit codes with on failure", JobRetryPolicy{RetryOnExitCodes: []int32{1}, RestartPolicy: "OnFailure"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Validate()
+			if tt.valid && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+
+	if err := (&Service{}).ValidateRetryPolicy(); err != nil {
+		t.Errorf("unexpected error for a service without retry policy: %v", err)
+	}
+}
+
+func TestJobRetryPolicyPodFailurePolicy(t *testing.T) {
+	if policy := (&JobRetryPolicy{MaxRetries: 2}).PodFailurePolicy(); policy != nil {
+		t.Errorf("expected all the failures to be retried, got %+v", policy)
+	}
+
+	codes := []int32{75, 3, 75}
+	policy := (&JobRetryPolicy{RetryOnExitCodes: codes}).PodFailurePolicy()
+	if policy == nil || len(policy.Rules) != 2 {
+		t.Fatalf("unexpected pod failure policy %+v", policy)
+	}
+	if rule := policy.Rules[0]; rule.Action != batchv1.PodFailurePolicyActionIgnore || rule.OnPodConditions[0].Type != v1.DisruptionTarget {
+		t.Errorf("expected the disruptions to be ignored, got %+v", rule)
+	}
+	rule := policy.Rules[1]
+	if rule.Action != batchv1.PodFailurePolicyActionFailJob || *rule.OnExitCodes.ContainerName != ContainerName ||
+		rule.OnExitCodes.Operator != batchv1.PodFailurePolicyOnExitCodesOpNotIn || !slices.Equal(rule.OnExitCodes.Values, []int32{3, 75}) {
+		t.Errorf("unexpected exit codes rule %+v", rule.OnExitCodes)
+	}
+	// The exit codes of the service are not modified
+	if !slices.Equal(codes, []int32{75, 3, 75}) {
+		t.Errorf("the exit codes were modified: %v", codes)
+	}
+}
+
+func TestJobRetryPolicyKubeRestartPolicy(t *testing.T) {
+	if restart := (&JobRetryPolicy{}).KubeRestartPolicy(); restart != v1.RestartPolicyNever {
+		t.Errorf("unexpected default restart policy %s", restart)
+	}
+	if restart := (&JobRetryPolicy{RestartPolicy: "OnFailure"}).KubeRestartPolicy(); restart != v1.RestartPolicyOnFailure {
+		t.Errorf("unexpected restart policy %s", restart)
+	}
+}
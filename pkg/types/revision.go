@@ -0,0 +1,71 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+const (
+	// ServiceRevisionLabel label storing the name of the service a revision belongs to
+	ServiceRevisionLabel = "oscar.grycap/service-revision-of"
+
+	// ServiceRevisionNumberLabel label storing the revision number
+	ServiceRevisionNumberLabel = "oscar.grycap/revision"
+
+	// RevisionOperationCreate revision recorded when the service is created
+	RevisionOperationCreate = "create"
+
+	// RevisionOperationUpdate revision recorded when the service is updated
+	RevisionOperationUpdate = "update"
+
+	// RevisionOperationRollback revision recorded when the service is rolled back
+	RevisionOperationRollback = "rollback"
+)
+
+// ServiceRevision immutable snapshot of a service definition
+type ServiceRevision struct {
+	// Revision incremental revision number, starting at 1
+	Revision int `json:"revision"`
+	// ServiceName name of the service
+	ServiceName string `json:"service_name"`
+	// Namespace namespace of the service
+	Namespace string `json:"namespace,omitempty"`
+	// Operation operation that produced the revision (create, update or rollback)
+	Operation string `json:"operation"`
+	// SourceRevision revision re-applied when the operation is a rollback
+	SourceRevision int `json:"source_revision,omitempty"`
+	// CreatedAt time the revision was recorded
+	CreatedAt metav1.Time `json:"created_at"`
+	// Author UID of the user that applied the revision
+	Author string `json:"author,omitempty"`
+	// Image container image of the service
+	Image string `json:"image"`
+	// CPU CPU limit of the service
+	CPU string `json:"cpu,omitempty"`
+	// Memory memory limit of the service
+	Memory string `json:"memory,omitempty"`
+	// EnableGPU whether the service requested a GPU
+	EnableGPU bool `json:"enable_gpu,omitempty"`
+	// FDL service definition in YAML (omitted when listing revisions)
+	FDL string `json:"fdl,omitempty"`
+	// Script user script of the service (omitted when listing revisions)
+	Script string `json:"script,omitempty"`
+}
+
+// ServiceRollbackRequest payload for POST /system/services/:serviceName/rollback
+type ServiceRollbackRequest struct {
+	Revision int `json:"revision" binding:"required,min=1"`
+}
@@ -0,0 +1,313 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	// Embedded timezone database to validate the schedule timezones
+	_ "time/tzdata"
+
+	batchv1 "k8s.io/api/batch/v1"
+)
+
+const (
+	// ScheduleCronJobSuffix suffix of the name of the CronJob of a scheduled service
+	ScheduleCronJobSuffix = "-schedule"
+	// maxCronJobNameLength maximum length of a CronJob name (the controller appends 11 characters to the job names)
+	maxCronJobNameLength = 52
+	// DefaultScheduleTimeZone timezone of the schedules without one, always set in their CronJobs so the next
+	// runs don't depend on the timezone of the kube-controller-manager
+	DefaultScheduleTimeZone = "UTC"
+)
+
+// cronTimeZonePrefixes prefixes of the cron expressions setting their timezone, accepted by kubernetes
+var cronTimeZonePrefixes = []string{"CRON_TZ=", "TZ="}
+
+// ServiceSchedule periodic invocation of an asynchronous service
+type ServiceSchedule struct {
+	// Cron schedule in cron format (e.g. "0 3 * * *") or a predefined macro (e.g. "@daily")
+	Cron string `json:"cron"`
+
+	// TimeZone IANA name of the timezone of the schedule, also accepted as a "TZ=" prefix of the cron expression
+	// Optional. (default: UTC)
+	TimeZone string `json:"timezone,omitempty"`
+
+	// Event static payload passed to every scheduled invocation
+	// Optional
+	Event string `json:"event,omitempty"`
+
+	// ConcurrencyPolicy how to treat an invocation while the previous one is still running: Allow, Forbid or Replace
+	// Optional. (default: Forbid)
+	ConcurrencyPolicy string `json:"concurrency_policy,omitempty"`
+
+	// Suspend pause the scheduled invocations
+	// Optional. (default: false)
+	Suspend bool `json:"suspend,omitempty"`
+}
+
+// ServiceScheduleStatus status of the scheduled invocations of a service
+type ServiceScheduleStatus struct {
+	// Schedule schedule defined in the service
+	Schedule ServiceSchedule `json:"schedule"`
+	// CronJob name of the kubernetes CronJob
+	CronJob string `json:"cron_job"`
+	// LastScheduleTime last time a job was scheduled
+	LastScheduleTime *time.Time `json:"last_schedule_time,omitempty"`
+	// LastSuccessfulTime last time a scheduled job finished successfully
+	LastSuccessfulTime *time.Time `json:"last_successful_time,omitempty"`
+	// NextScheduleTime next time a job will be scheduled (empty if suspended)
+	NextScheduleTime *time.Time `json:"next_schedule_time,omitempty"`
+	// ActiveJobs names of the scheduled jobs currently running
+	ActiveJobs []string `json:"active_jobs"`
+}
+
+// ServiceCronJobName returns the name of the CronJob of a scheduled service
+func ServiceCronJobName(serviceName string) string {
+	name := serviceName
+	if len(name)+len(ScheduleCronJobSuffix) > maxCronJobNameLength {
+		name = strings.TrimRight(name[:maxCronJobNameLength-len(ScheduleCronJobSuffix)], "-.")
+	}
+	return name + ScheduleCronJobSuffix
+}
+
+// KubeConcurrencyPolicy returns the kubernetes concurrency policy of the schedule
+func (schedule *ServiceSchedule) KubeConcurrencyPolicy() batchv1.ConcurrencyPolicy {
+	switch strings.ToLower(schedule.ConcurrencyPolicy) {
+	case "allow":
+		return batchv1.AllowConcurrent
+	case "replace":
+		return batchv1.ReplaceConcurrent
+	default:
+		return batchv1.ForbidConcurrent
+	}
+}
+
+// CronTimeZone returns the cron expression of the schedule and its timezone, moving the "TZ=" or "CRON_TZ="
+// prefix of the expression to the timezone, as the CronJobs can't set both
+func (schedule *ServiceSchedule) CronTimeZone() (string, string, error) {
+	cron := strings.TrimSpace(schedule.Cron)
+	timeZone := schedule.TimeZone
+	for _, prefix := range cronTimeZonePrefixes {
+		if !strings.HasPrefix(cron, prefix) {
+			continue
+		}
+		prefixZone, expr, _ := strings.Cut(strings.TrimPrefix(cron, prefix), " ")
+		if timeZone != "" && timeZone != prefixZone {
+			return "", "", fmt.Errorf("the timezone \"%s\" of the cron expression doesn't match the timezone \"%s\"", prefixZone, timeZone)
+		}
+		cron, timeZone = strings.TrimSpace(expr), prefixZone
+		break
+	}
+	if timeZone == "" {
+		timeZone = DefaultScheduleTimeZone
+	}
+	return cron, timeZone, nil
+}
+
+// Validate checks the cron expression, timezone and concurrency policy of the schedule
+func (schedule *ServiceSchedule) Validate() error {
+	cron, timeZone, err := schedule.CronTimeZone()
+	if err != nil {
+		return fmt.Errorf("invalid schedule: %v", err)
+	}
+	if _, err := ParseCron(cron); err != nil {
+		return fmt.Errorf("invalid schedule: %v", err)
+	}
+	if _, err := time.LoadLocation(timeZone); err != nil {
+		return fmt.Errorf("invalid schedule timezone \"%s\": %v", timeZone, err)
+	}
+	switch strings.ToLower(schedule.ConcurrencyPolicy) {
+	case "", "allow", "forbid", "replace":
+	default:
+		return fmt.Errorf("invalid schedule concurrency_policy \"%s\": must be Allow, Forbid or Replace", schedule.ConcurrencyPolicy)
+	}
+	return nil
+}
+
+// ValidateSchedule checks the schedule of the service
+func (service *Service) ValidateSchedule() error {
+	if service.Schedule == nil {
+		return nil
+	}
+	return service.Schedule.Validate()
+}
+
+// CronSchedule parsed cron expression
+type CronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// Standard cron matches any of the day fields when both are restricted
+	domStar, dowStar bool
+}
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var cronMonthNames = map[string]int{"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6, "jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12}
+
+var cronDayNames = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+
+// ParseCron parses a standard five fields cron expression (minute, hour, day of month, month and day of week),
+// where "?" is a wildcard like "*", without its timezone prefix
+func ParseCron(expr string) (*CronSchedule, error) {
+	expr = strings.TrimSpace(expr)
+	if macro, ok := cronMacros[strings.ToLower(expr)]; ok {
+		expr = macro
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("the cron expression \"%s\" must have 5 fields", expr)
+	}
+
+	schedule := &CronSchedule{}
+	var err error
+	if schedule.minute, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("minute: %v", err)
+	}
+	if schedule.hour, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("hour: %v", err)
+	}
+	if schedule.dom, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("day of month: %v", err)
+	}
+	if schedule.month, err = parseCronField(fields[3], 1, 12, cronMonthNames); err != nil {
+		return nil, fmt.Errorf("month: %v", err)
+	}
+	if schedule.dow, err = parseCronField(fields[4], 0, 7, cronDayNames); err != nil {
+		return nil, fmt.Errorf("day of week: %v", err)
+	}
+	// 7 is also Sunday
+	if schedule.dow&(1<<7) != 0 {
+		schedule.dow |= 1
+	}
+	schedule.domStar = isCronWildcard(fields[2])
+	schedule.dowStar = isCronWildcard(fields[4])
+	return schedule, nil
+}
+
+func isCronWildcard(field string) bool {
+	return field == "*" || field == "?"
+}
+
+func parseCronField(field string, min, max int, names map[string]int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepPart)
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step \"%s\"", stepPart)
+			}
+		}
+
+		var start, end int
+		switch {
+		case isCronWildcard(rangePart):
+			start, end = min, max
+		case strings.Contains(rangePart, "-"):
+			low, high, _ := strings.Cut(rangePart, "-")
+			var err error
+			if start, err = parseCronValue(low, min, max, names); err != nil {
+				return 0, err
+			}
+			if end, err = parseCronValue(high, min, max, names); err != nil {
+				return 0, err
+			}
+			if start > end {
+				return 0, fmt.Errorf("invalid range \"%s\"", rangePart)
+			}
+		default:
+			var err error
+			if start, err = parseCronValue(rangePart, min, max, names); err != nil {
+				return 0, err
+			}
+			end = start
+			// "a/n" means from a to the maximum every n
+			if hasStep {
+				end = max
+			}
+		}
+
+		for i := start; i <= end; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+	return bits, nil
+}
+
+func parseCronValue(value string, min, max int, names map[string]int) (int, error) {
+	if n, ok := names[strings.ToLower(value)]; ok {
+		return n, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value \"%s\"", value)
+	}
+	if n < min || n > max {
+		return 0, fmt.Errorf("value %d out of range [%d, %d]", n, min, max)
+	}
+	return n, nil
+}
+
+// Next returns the first time after t matching the schedule, in the location of t.
+// It returns the zero time if there is no match in the next five years.
+func (s *CronSchedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, loc)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (s *CronSchedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
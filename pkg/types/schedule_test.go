@@ -0,0 +1,150 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+)
+
+func TestParseCronNext(t *testing.T) {
+	// Wednesday
+	from := time.Date(2024, time.January, 10, 10, 30, 0, 0, time.UTC)
+
+	scenarios := []struct {
+		cron     string
+		expected time.Time
+	}{
+		{"0 3 * * *", time.Date(2024, time.January, 11, 3, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, time.January, 10, 11, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, time.January, 10, 10, 45, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		{"30 8 * * mon-fri", time.Date(2024, time.January, 11, 8, 30, 0, 0, time.UTC)},
+		{"0 12 * * 7", time.Date(2024, time.January, 14, 12, 0, 0, 0, time.UTC)},
+		{"0 6 ? * *", time.Date(2024, time.January, 11, 6, 0, 0, 0, time.UTC)},
+		{"0 0 29 feb *", time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		// Both day fields restricted: any of them matches
+		{"0 0 20 * 5", time.Date(2024, time.January, 12, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.cron, func(t *testing.T) {
+			cron, err := ParseCron(s.cron)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if next := cron.Next(from); !next.Equal(s.expected) {
+				t.Errorf("expected %v, got %v", s.expected, next)
+			}
+		})
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	for _, cron := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "*/0 * * * *", "5-1 * * * *", "a * * * *", "@every 5m"} {
+		if _, err := ParseCron(cron); err == nil {
+			t.Errorf("expected error for \"%s\"", cron)
+		}
+	}
+	// 31 of February never happens
+	cron, err := ParseCron("0 0 31 2 *")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if next := cron.Next(time.Now()); !next.IsZero() {
+		t.Errorf("expected zero time, got %v", next)
+	}
+}
+
+func TestServiceScheduleValidate(t *testing.T) {
+	scenarios := []struct {
+		schedule ServiceSchedule
+		valid    bool
+	}{
+		{ServiceSchedule{Cron: "@daily"}, true},
+		{ServiceSchedule{Cron: "0 3 * * *", TimeZone: "Europe/Madrid", ConcurrencyPolicy: "Replace"}, true},
+		{ServiceSchedule{Cron: "invalid"}, false},
+		{ServiceSchedule{Cron: "@daily", TimeZone: "Mars/Olympus"}, false},
+		{ServiceSchedule{Cron: "@daily", ConcurrencyPolicy: "Queue"}, false},
+		{ServiceSchedule{Cron: "TZ=Europe/Madrid 0 3 * * *"}, true},
+		{ServiceSchedule{Cron: "CRON_TZ=Europe/Madrid 0 3 ? * *", TimeZone: "Europe/Madrid"}, true},
+		{ServiceSchedule{Cron: "TZ=Europe/Madrid 0 3 * * *", TimeZone: "UTC"}, false},
+		{ServiceSchedule{Cron: "TZ=Mars/Olympus @daily"}, false},
+	}
+	for _, s := range scenarios {
+		err := s.schedule.Validate()
+		if s.valid && err != nil {
+			t.Errorf("%+v: unexpected error: %v", s.schedule, err)
+		}
+		if !s.valid && err == nil {
+			t.Errorf("%+v: expected error, got nil", s.schedule)
+		}
+	}
+
+	if err := (&Service{}).ValidateSchedule(); err != nil {
+		t.Errorf("unexpected error for service without schedule: %v", err)
+	}
+}
+
+func TestServiceScheduleCronTimeZone(t *testing.T) {
+	scenarios := []struct {
+		schedule ServiceSchedule
+		cron     string
+		timeZone string
+	}{
+		{ServiceSchedule{Cron: "0 3 * * *"}, "0 3 * * *", DefaultScheduleTimeZone},
+		{ServiceSchedule{Cron: "0 3 * * *", TimeZone: "Europe/Madrid"}, "0 3 * * *", "Europe/Madrid"},
+		{ServiceSchedule{Cron: "TZ=Europe/Madrid 0 3 * * *"}, "0 3 * * *", "Europe/Madrid"},
+		{ServiceSchedule{Cron: " CRON_TZ=America/New_York  @daily"}, "@daily", "America/New_York"},
+	}
+	for _, s := range scenarios {
+		cron, timeZone, err := s.schedule.CronTimeZone()
+		if err != nil {
+			t.Errorf("%+v: unexpected error: %v", s.schedule, err)
+		}
+		if cron != s.cron || timeZone != s.timeZone {
+			t.Errorf("%+v: expected \"%s\" in %s, got \"%s\" in %s", s.schedule, s.cron, s.timeZone, cron, timeZone)
+		}
+	}
+}
+
+func TestKubeConcurrencyPolicy(t *testing.T) {
+	scenarios := map[string]batchv1.ConcurrencyPolicy{
+		"":        batchv1.ForbidConcurrent,
+		"allow":   batchv1.AllowConcurrent,
+		"Replace": batchv1.ReplaceConcurrent,
+	}
+	for policy, expected := range scenarios {
+		schedule := ServiceSchedule{ConcurrencyPolicy: policy}
+		if got := schedule.KubeConcurrencyPolicy(); got != expected {
+			t.Errorf("%s: expected %s, got %s", policy, expected, got)
+		}
+	}
+}
+
+func TestServiceCronJobName(t *testing.T) {
+	if name := ServiceCronJobName("nightly"); name != "nightly-schedule" {
+		t.Errorf("unexpected name %s", name)
+	}
+	long := ServiceCronJobName(strings.Repeat("a", 40) + "-" + strings.Repeat("b", 20))
+	if len(long) > maxCronJobNameLength || !strings.HasSuffix(long, ScheduleCronJobSuffix) || strings.Contains(long, "--") {
+		t.Errorf("unexpected name %s", long)
+	}
+}
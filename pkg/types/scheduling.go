@@ -0,0 +1,122 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// SchedulingAllowAll value of the scheduling allow-lists to allow any key
+const SchedulingAllowAll = "*"
+
+// HasScheduling returns true if the service defines node selectors, affinity or tolerations
+func (service *Service) HasScheduling() bool {
+	return len(service.NodeSelector) > 0 || service.Affinity != nil || len(service.Tolerations) > 0
+}
+
+// ValidateScheduling checks the node selectors, affinity and tolerations of the service
+// against the node labels and toleration keys allowed by the cluster administrator
+func (service *Service) ValidateScheduling(cfg *Config) error {
+	for key := range service.NodeSelector {
+		if !schedulingKeyAllowed(cfg.SchedulingAllowedNodeLabels, key) {
+			return fmt.Errorf("the node label \"%s\" is not allowed in node_selector", key)
+		}
+	}
+
+	if service.Affinity != nil {
+		if err := validateNodeAffinity(cfg, service.Affinity.NodeAffinity); err != nil {
+			return err
+		}
+		if podAffinity := service.Affinity.PodAffinity; podAffinity != nil {
+			if err := validatePodAffinityTerms(cfg, podAffinity.RequiredDuringSchedulingIgnoredDuringExecution, podAffinity.PreferredDuringSchedulingIgnoredDuringExecution); err != nil {
+				return err
+			}
+		}
+		if podAntiAffinity := service.Affinity.PodAntiAffinity; podAntiAffinity != nil {
+			if err := validatePodAffinityTerms(cfg, podAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution, podAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, toleration := range service.Tolerations {
+		// An empty key with the "Exists" operator tolerates every taint
+		if toleration.Key == "" && !slices.Contains(cfg.SchedulingAllowedTolerations, SchedulingAllowAll) {
+			return fmt.Errorf("tolerations must define a key")
+		}
+		if !schedulingKeyAllowed(cfg.SchedulingAllowedTolerations, toleration.Key) {
+			return fmt.Errorf("the toleration key \"%s\" is not allowed", toleration.Key)
+		}
+	}
+	return nil
+}
+
+func validateNodeAffinity(cfg *Config, nodeAffinity *v1.NodeAffinity) error {
+	if nodeAffinity == nil {
+		return nil
+	}
+	terms := []v1.NodeSelectorTerm{}
+	if nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution != nil {
+		terms = append(terms, nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms...)
+	}
+	for _, preferred := range nodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution {
+		terms = append(terms, preferred.Preference)
+	}
+	for _, term := range terms {
+		for _, requirement := range slices.Concat(term.MatchExpressions, term.MatchFields) {
+			if !schedulingKeyAllowed(cfg.SchedulingAllowedNodeLabels, requirement.Key) {
+				return fmt.Errorf("the node label \"%s\" is not allowed in node affinity", requirement.Key)
+			}
+		}
+	}
+	return nil
+}
+
+func validatePodAffinityTerms(cfg *Config, required []v1.PodAffinityTerm, preferred []v1.WeightedPodAffinityTerm) error {
+	terms := slices.Clone(required)
+	for _, weighted := range preferred {
+		terms = append(terms, weighted.PodAffinityTerm)
+	}
+	for _, term := range terms {
+		// The topology key is a node label, so it is restricted by the same allow-list
+		if !schedulingKeyAllowed(cfg.SchedulingAllowedNodeLabels, term.TopologyKey) {
+			return fmt.Errorf("the topology key \"%s\" is not allowed in pod affinity", term.TopologyKey)
+		}
+	}
+	return nil
+}
+
+func schedulingKeyAllowed(allowed []string, key string) bool {
+	return slices.Contains(allowed, SchedulingAllowAll) || slices.Contains(allowed, key)
+}
+
+// addScheduling sets the node selectors, affinity and tolerations of the service in the podSpec
+func addScheduling(podSpec *v1.PodSpec, service *Service) {
+	if len(service.NodeSelector) > 0 {
+		podSpec.NodeSelector = maps.Clone(service.NodeSelector)
+	}
+	if service.Affinity != nil {
+		podSpec.Affinity = service.Affinity.DeepCopy()
+	}
+	if len(service.Tolerations) > 0 {
+		podSpec.Tolerations = slices.Clone(service.Tolerations)
+	}
+}
@@ -0,0 +1,126 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func schedulingService() *Service {
+	return &Service{
+		NodeSelector: map[string]string{"node-pool": "highmem"},
+		Affinity: &v1.Affinity{
+			NodeAffinity: &v1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{
+					NodeSelectorTerms: []v1.NodeSelectorTerm{{
+						MatchExpressions: []v1.NodeSelectorRequirement{{
+							Key:      "kubernetes.io/arch",
+							Operator: v1.NodeSelectorOpIn,
+							Values:   []string{"arm64"},
+						}},
+					}},
+				},
+			},
+			PodAntiAffinity: &v1.PodAntiAffinity{
+				PreferredDuringSchedulingIgnoredDuringExecution: []v1.WeightedPodAffinityTerm{{
+					Weight:          10,
+					PodAffinityTerm: v1.PodAffinityTerm{TopologyKey: "kubernetes.io/hostname"},
+				}},
+			},
+		},
+		Tolerations: []v1.Toleration{{Key: "spot", Operator: v1.TolerationOpExists, Effect: v1.TaintEffectNoSchedule}},
+	}
+}
+
+func TestValidateScheduling(t *testing.T) {
+	allowed := &Config{
+		SchedulingAllowedNodeLabels:  []string{"node-pool", "kubernetes.io/arch", "kubernetes.io/hostname"},
+		SchedulingAllowedTolerations: []string{"spot"},
+	}
+
+	scenarios := []struct {
+		name   string
+		cfg    *Config
+		modify func(svc *Service)
+		valid  bool
+	}{
+		{"allowed", allowed, func(svc *Service) {}, true},
+		{"allow all", &Config{SchedulingAllowedNodeLabels: []string{"*"}, SchedulingAllowedTolerations: []string{"*"}}, func(svc *Service) {}, true},
+		{"no scheduling", &Config{}, func(svc *Service) { *svc = Service{} }, true},
+		{"empty allow-list", &Config{}, func(svc *Service) {}, false},
+		{"node selector not allowed", allowed, func(svc *Service) { svc.NodeSelector["gpu"] = "true" }, false},
+		{"node affinity not allowed", allowed, func(svc *Service) {
+			svc.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms[0].MatchExpressions[0].Key = "zone"
+		}, false},
+		{"topology key not allowed", allowed, func(svc *Service) {
+			svc.Affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution[0].PodAffinityTerm.TopologyKey = "zone"
+		}, false},
+		{"toleration not allowed", allowed, func(svc *Service) { svc.Tolerations[0].Key = InterLinkTolerationKey }, false},
+		{"toleration without key", allowed, func(svc *Service) { svc.Tolerations[0].Key = "" }, false},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			svc := schedulingService()
+			s.modify(svc)
+			err := svc.ValidateScheduling(s.cfg)
+			if s.valid && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !s.valid && err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestToPodSpecWithScheduling(t *testing.T) {
+	svc := testService
+	scheduling := schedulingService()
+	svc.NodeSelector = scheduling.NodeSelector
+	svc.Affinity = scheduling.Affinity
+	svc.Tolerations = scheduling.Tolerations
+
+	podSpec, err := svc.ToPodSpec(&testConfig)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if podSpec.NodeSelector["node-pool"] != "highmem" {
+		t.Errorf("unexpected node selector: %v", podSpec.NodeSelector)
+	}
+	if podSpec.Affinity == nil || podSpec.Affinity.NodeAffinity == nil || podSpec.Affinity.PodAntiAffinity == nil {
+		t.Errorf("unexpected affinity: %v", podSpec.Affinity)
+	}
+	if len(podSpec.Tolerations) != 1 || podSpec.Tolerations[0].Key != "spot" {
+		t.Errorf("unexpected tolerations: %v", podSpec.Tolerations)
+	}
+
+	// InterLink jobs keep the service constraints
+	SetInterlinkJob(podSpec, &Service{InterLinkNodeName: "vk-node"}, &testConfig, []byte("event"))
+	if podSpec.NodeSelector["node-pool"] != "highmem" || podSpec.NodeSelector[NodeSelectorKey] != "vk-node" {
+		t.Errorf("unexpected node selector: %v", podSpec.NodeSelector)
+	}
+	if len(podSpec.Tolerations) != 2 || podSpec.Tolerations[1].Key != InterLinkTolerationKey {
+		t.Errorf("unexpected tolerations: %v", podSpec.Tolerations)
+	}
+	// The service definition must not be modified
+	if len(svc.NodeSelector) != 1 || len(svc.Tolerations) != 1 {
+		t.Errorf("the service definition was modified: %v %v", svc.NodeSelector, svc.Tolerations)
+	}
+}
@@ -98,6 +98,15 @@ const (
 	// EventVariable name used by the environment variable where events are stored
 	EventVariable = "EVENT"
 
+	// EventRefVariable name of the environment variable with the reference to the stored event of a job
+	EventRefVariable = "EVENT_REF"
+
+	// EventFileMountPath directory where the stored event of a job is mounted
+	EventFileMountPath = "/oscar/event"
+
+	// EventFileName name of the file with the stored event of a job
+	EventFileName = "event"
+
 	// JobUUIDVariable name used by the environment variable of the job UUID
 	JobUUIDVariable = "JOB_UUID"
 
@@ -157,6 +166,27 @@ const (
 	OriginClusterAnnotation    = "oscar.grycap/origin-cluster"
 	OriginServiceAnnotation    = "oscar.grycap/origin-service"
 	FederationWorkerAnnotation = "oscar.grycap/federation-worker"
+
+	// DelegatedFromAnnotation annotation with the cluster that delegated the job
+	DelegatedFromAnnotation = "oscar.grycap/delegated-from"
+	// DelegatedToAnnotation annotation of the delegation events with the cluster that received the job
+	DelegatedToAnnotation = "oscar.grycap/delegated-to"
+	// EventSHA256Annotation annotation of the jobs with the hex encoded SHA-256 hash of their stored event or idempotent invocation event
+	EventSHA256Annotation = "oscar.grycap/event-sha256"
+	// JobHandlersDoneAnnotation annotation with the finished job handlers already run on a job
+	JobHandlersDoneAnnotation = "oscar.grycap/job-handlers-done"
+	// IdempotencyKeyAnnotation annotation of the jobs with the idempotency key of the invocation that created them
+	IdempotencyKeyAnnotation = "oscar.grycap/idempotency-key"
+	// IdempotencyRecordLabel label of the records of the idempotency keys of the delegated jobs, with the name of their service
+	IdempotencyRecordLabel = "oscar.grycap/idempotency-record-of"
+	// JobCancelledAnnotation annotation of the cancelled jobs with the time of the cancellation
+	JobCancelledAnnotation = "oscar.grycap/cancelled"
+	// JobSuspendedAnnotation annotation of the jobs suspended by a user with the time of the suspension
+	JobSuspendedAnnotation = "oscar.grycap/suspended"
+	// RerunOfAnnotation annotation of the jobs created by running again the event of another job, with its name
+	RerunOfAnnotation = "oscar.grycap/rerun-of"
+	// JobHeldLabel label of the jobs held by the MaxConcurrentJobs limit of their service, with the time they were queued in nanoseconds
+	JobHeldLabel = "oscar.grycap/held"
 )
 
 // YAMLMarshal package-level yaml marshal function
@@ -193,6 +223,11 @@ type Service struct {
 	// Optional. (default: "")
 	TotalCPU string `json:"total_cpu"`
 
+	// MaxConcurrentJobs maximum number of asynchronous jobs of the service running simultaneously.
+	// The jobs beyond the limit are created suspended and released in order of arrival as the running ones finish
+	// Optional. (default: 0, unlimited)
+	MaxConcurrentJobs int `json:"max_concurrent_jobs,omitempty"`
+
 	// EphemeralStorageRequest request size for ephemeral storage following the kubernetes format
 	// https://kubernetes.io/docs/concepts/configuration/manage-compute-resources-container/#meaning-of-ephemeral-storage
 	// Optional. (default: "")
@@ -202,6 +237,10 @@ type Service struct {
 	// Optional. (default: false)
 	EnableGPU bool `json:"enable_gpu"`
 
+	// Accelerators number, resource and model of the accelerators requested by the service. Takes precedence over EnableGPU
+	// Optional
+	Accelerators *Accelerators `json:"accelerators,omitempty"`
+
 	// EnableSGX parameter to use the SCONE k8s plugin
 	// Optional. (default: false)
 	EnableSGX bool `json:"enable_sgx"`
@@ -325,6 +364,46 @@ type Service struct {
 	// Optional
 	Volume *ServiceVolumeConfig `json:"volume,omitempty"`
 
+	// InitContainers containers run to completion before the service container starts
+	// Optional
+	InitContainers []ServiceContainer `json:"init_containers,omitempty"`
+
+	// Sidecars containers running alongside the service container
+	// Optional
+	Sidecars []ServiceContainer `json:"sidecars,omitempty"`
+
+	// SharedVolumes ephemeral volumes shared by the service container, its init containers and sidecars
+	// Optional
+	SharedVolumes []SharedVolume `json:"shared_volumes,omitempty"`
+
+	// NodeSelector node labels required to schedule the service pods
+	// Optional. Keys must be allowed by the cluster administrator
+	NodeSelector map[string]string `json:"node_selector,omitempty"`
+
+	// Affinity node and pod affinity of the service pods, following the kubernetes format
+	// Optional. Node labels and topology keys must be allowed by the cluster administrator
+	Affinity *v1.Affinity `json:"affinity,omitempty"`
+
+	// Tolerations taints tolerated by the service pods, following the kubernetes format
+	// Optional. Keys must be allowed by the cluster administrator
+	Tolerations []v1.Toleration `json:"tolerations,omitempty"`
+
+	// Schedule periodic invocation of the service as a kubernetes CronJob
+	// Optional
+	Schedule *ServiceSchedule `json:"schedule,omitempty"`
+
+	// Callbacks webhooks notified when an asynchronous job of the service finishes
+	// Optional
+	Callbacks []ServiceCallback `json:"callbacks,omitempty"`
+
+	// RetryPolicy retries, failure policy and deadline of the asynchronous jobs of the service
+	// Optional. (default: no retries nor deadline)
+	RetryPolicy *JobRetryPolicy `json:"retry_policy,omitempty"`
+
+	// ACL roles of other users and OIDC groups on the service, in addition to its owner and visibility
+	// Optional
+	ACL *ServiceACL `json:"acl,omitempty"`
+
 	// VolumeStatus exposes basic volume state information in API responses.
 	// Internal/API use only, not part of FDL.
 	VolumeStatus ServiceVolumeStatus `json:"volume_status,omitempty" yaml:"-"`
@@ -389,6 +468,10 @@ type Kserve struct {
 	// Optional. (default: false)
 	EnableGPU bool `json:"enable_gpu,omitempty" default:"false"`
 
+	// Accelerators number and resource of the accelerators requested by the KServe InferenceService. Takes precedence over EnableGPU
+	// Optional. The model is not supported
+	Accelerators *Accelerators `json:"accelerators,omitempty"`
+
 	// SetAuth parameter to set the authentication for the KServe InferenceService
 	// Optional. (default: true)
 	SetAuth bool `json:"set_auth,omitempty" default:"true"`
@@ -573,6 +656,15 @@ func (service *Service) ToPodSpec(cfg *Config) (*v1.PodSpec, error) {
 		})
 	}
 
+	// Add user-defined init containers, sidecars and shared volumes
+	if err := addServiceContainers(podSpec, service); err != nil {
+		return nil, err
+	}
+
+	// Add node selectors, affinity and tolerations
+	addScheduling(podSpec, service)
+	addAcceleratorNodeSelector(podSpec, service, cfg)
+
 	// Add OSCAR-managed environment variables
 	addServiceMetadataEnvVars(podSpec, service)
 
@@ -674,12 +766,8 @@ func CreateResources(service *Service) (v1.ResourceRequirements, error) {
 		resources.Requests[v1.ResourceEphemeralStorage] = ephemeral
 	}
 
-	if service.EnableGPU {
-		gpu, err := resource.ParseQuantity("1")
-		if err != nil {
-			return resources, err
-		}
-		resources.Limits["nvidia.com/gpu"] = gpu
+	if name, quantity, ok := AcceleratorRequest(service.EnableGPU, service.Accelerators); ok {
+		resources.Limits[name] = quantity
 	}
 
 	if service.EnableSGX {
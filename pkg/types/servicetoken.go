@@ -0,0 +1,117 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+const (
+	// ServiceTokenScopeInvokeSync scope of the tokens allowed to invoke the service synchronously (/run)
+	ServiceTokenScopeInvokeSync = "invoke-sync"
+	// ServiceTokenScopeInvokeAsync scope of the tokens allowed to invoke the service asynchronously (/job)
+	ServiceTokenScopeInvokeAsync = "invoke-async"
+	// ServiceTokenScopeReadLogs scope of the tokens allowed to read the jobs and logs of the service
+	ServiceTokenScopeReadLogs = "read-logs"
+	// ServiceTokenScopeExposedAccess scope of the tokens allowed to access the exposed service
+	ServiceTokenScopeExposedAccess = "exposed-access"
+
+	// PrimaryServiceTokenID ID of the token stored in the service definition, which has all the scopes
+	PrimaryServiceTokenID = "primary"
+	// GraceServiceTokenID ID of the previous primary token, accepted until the end of its grace period
+	GraceServiceTokenID = "grace"
+)
+
+// ServiceTokenScopes scopes that can be granted to the named tokens of a service
+var ServiceTokenScopes = []string{
+	ServiceTokenScopeInvokeSync,
+	ServiceTokenScopeInvokeAsync,
+	ServiceTokenScopeReadLogs,
+	ServiceTokenScopeExposedAccess,
+}
+
+// ServiceToken token accepted to access a service, without its value
+type ServiceToken struct {
+	// ID identifier of the token, "primary" and "grace" for the current and previous primary tokens
+	ID string `json:"id"`
+	// Name description of the token
+	Name string `json:"name"`
+	// Scopes operations allowed with the token
+	Scopes []string `json:"scopes"`
+	// CreatedAt time the token was created, unknown for the primary tokens created before the rotations
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	// ExpiresAt time the token expires, if any
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// LastUsedAt time the token was last accepted, with a resolution of a minute
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	// Token value of the token, only returned when it is created
+	Token string `json:"token,omitempty"`
+}
+
+// ServiceTokenRequest request to create a named token of a service
+type ServiceTokenRequest struct {
+	// Name description of the token
+	Name string `json:"name" binding:"required"`
+	// Scopes operations allowed with the token
+	Scopes []string `json:"scopes" binding:"required"`
+	// ExpiresIn validity of the token in seconds
+	// Optional. (default: 0, the token doesn't expire)
+	ExpiresIn int64 `json:"expires_in,omitempty"`
+}
+
+// ServiceTokenRotationRequest request to rotate the primary token of a service
+type ServiceTokenRotationRequest struct {
+	// GracePeriod seconds the previous primary token is still accepted, 0 to revoke it immediately
+	// Optional. (default: SERVICE_TOKEN_GRACE_PERIOD)
+	GracePeriod *int64 `json:"grace_period,omitempty"`
+}
+
+// ServiceTokenRotation result of the rotation of the primary token of a service
+type ServiceTokenRotation struct {
+	// Token new primary token of the service
+	Token string `json:"token"`
+	// GraceExpiresAt time the previous primary token stops being accepted, if it has a grace period
+	GraceExpiresAt *time.Time `json:"grace_expires_at,omitempty"`
+}
+
+// Validate checks the scopes and validity of the token request
+func (request ServiceTokenRequest) Validate() error {
+	if len(request.Scopes) == 0 {
+		return fmt.Errorf("at least one scope is required")
+	}
+	for _, scope := range request.Scopes {
+		if !slices.Contains(ServiceTokenScopes, scope) {
+			return fmt.Errorf("invalid scope %q, must be one of %v", scope, ServiceTokenScopes)
+		}
+	}
+	if request.ExpiresIn < 0 {
+		return fmt.Errorf("expires_in can't be negative")
+	}
+	return nil
+}
+
+// HasScope returns true if the token allows the operations of the scope
+func (token *ServiceToken) HasScope(scope string) bool {
+	return slices.Contains(token.Scopes, scope)
+}
+
+// Expired returns true if the token has an expiration time and it has passed at the provided time
+func (token *ServiceToken) Expired(now time.Time) bool {
+	return token.ExpiresAt != nil && !now.Before(*token.ExpiresAt)
+}
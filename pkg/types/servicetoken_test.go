@@ -0,0 +1,63 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"testing"
+	"time"
+)
+
+func TestServiceTokenRequestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		request ServiceTokenRequest
+		valid   bool
+	}{
+		{"single scope", ServiceTokenRequest{Name: "ci", Scopes: []string{ServiceTokenScopeInvokeAsync}}, true},
+		{"all scopes", ServiceTokenRequest{Name: "ci", Scopes: ServiceTokenScopes, ExpiresIn: 3600}, true},
+		{"no scopes", ServiceTokenRequest{Name: "ci"}, false},
+		{"invalid scope", ServiceTokenRequest{Name: "ci", Scopes: []string{"admin"}}, false},
+		{"negative expiration", ServiceTokenRequest{Name: "ci", Scopes: []string{ServiceTokenScopeReadLogs}, ExpiresIn: -1}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.request.Validate()
+			if tt.valid && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestServiceTokenExpired(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Minute)
+	future := now.Add(time.Minute)
+
+	if (&ServiceToken{}).Expired(now) {
+		t.Error("tokens without expiration must not expire")
+	}
+	if !(&ServiceToken{ExpiresAt: &past}).Expired(now) {
+		t.Error("expected the token to be expired")
+	}
+	if (&ServiceToken{ExpiresAt: &future}).Expired(now) {
+		t.Error("expected the token to be valid")
+	}
+}
@@ -53,7 +53,8 @@ type MemoryMetrics struct {
 }
 
 type GPUMetrics struct {
-	TotalGPU int64 `json:"total_gpu"`
+	TotalGPU     int64                  `json:"total_gpu"`
+	Accelerators []AvailableAccelerator `json:"accelerators,omitempty"`
 }
 
 type NodeDetail struct {
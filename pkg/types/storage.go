@@ -159,3 +159,20 @@ func (onedataProvider OnedataProvider) GetCDMIClient() *cdmi.Client {
 
 	return cdmi.New(opHostCDMI, onedataProvider.Token, true)
 }
+
+// MatchesObject returns true if the name of an object, relative to the path, starts with any of the
+// prefixes and ends with any of the suffixes of the configuration (empty filters match all the objects)
+func (ioConfig StorageIOConfig) MatchesObject(name string) bool {
+	matches := func(filters []string, match func(string, string) bool) bool {
+		if len(filters) == 0 {
+			return true
+		}
+		for _, filter := range filters {
+			if match(name, filter) {
+				return true
+			}
+		}
+		return false
+	}
+	return matches(ioConfig.Prefix, strings.HasPrefix) && matches(ioConfig.Suffix, strings.HasSuffix)
+}
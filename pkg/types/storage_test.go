@@ -117,3 +117,26 @@ func TestGetCDMIClient(t *testing.T) {
 		t.Errorf("expected Oneprovider host: %s, got: %s", onedataProvider.OneproviderHost, client.Endpoint)
 	}
 }
+
+func TestStorageIOConfigMatchesObject(t *testing.T) {
+	tests := []struct {
+		name     string
+		ioConfig StorageIOConfig
+		object   string
+		expected bool
+	}{
+		{"no filters", StorageIOConfig{}, "image.jpg", true},
+		{"suffix", StorageIOConfig{Suffix: []string{".png", ".jpg"}}, "image.jpg", true},
+		{"wrong suffix", StorageIOConfig{Suffix: []string{".png"}}, "image.jpg", false},
+		{"prefix", StorageIOConfig{Prefix: []string{"img-"}}, "img-1.jpg", true},
+		{"wrong prefix", StorageIOConfig{Prefix: []string{"img-"}}, "doc-1.jpg", false},
+		{"prefix and suffix", StorageIOConfig{Prefix: []string{"img-"}, Suffix: []string{".jpg"}}, "img-1.png", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.ioConfig.MatchesObject(tt.object); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
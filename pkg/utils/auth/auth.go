@@ -19,6 +19,8 @@ package auth
 import (
 	"fmt"
 	"log"
+	"maps"
+	"slices"
 	"strings"
 	"time"
 
@@ -51,18 +53,27 @@ func BuildServiceAuthMiddlewareChain(cfg *types.Config, kubeClientset kubernetes
 		authHandler = CustomAuth(cfg, kubeClientset)
 	}
 
-	var wrapperHandler gin.HandlerFunc = func(c *gin.Context) {
-		if isServiceToken, exists := c.Get(isServiceTokenKey); exists {
-			if validServiceToken, ok := isServiceToken.(bool); ok && validServiceToken {
-				c.Next()
-				return
-			}
+	return []gin.HandlerFunc{GetServiceTokenMiddleware(back), SkipIfServiceToken(authHandler), GetServicePermissionsMiddleware(back)}
+}
+
+// BuildScopedServiceTokenMiddlewareChain returns the middlewares accepting the tokens of the service with the
+// scope in addition to the authentication of the /system paths. The handlers must authorise the requests
+// authenticated with users' credentials
+func BuildScopedServiceTokenMiddlewareChain(back types.ServerlessBackend, authHandler gin.HandlerFunc, scope string) []gin.HandlerFunc {
+	return []gin.HandlerFunc{GetScopedServiceTokenMiddleware(back, scope), SkipIfServiceToken(authHandler)}
+}
+
+// SkipIfServiceToken returns a middleware running the auth handler unless the request has already been
+// authenticated with a service token
+func SkipIfServiceToken(authHandler gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if IsServiceTokenRequest(c) {
+			c.Next()
+			return
 		}
 
 		authHandler(c)
 	}
-
-	return []gin.HandlerFunc{GetServiceTokenMiddleware(back), wrapperHandler, GetServicePermissionsMiddleware(back)}
 }
 
 // CustomAuth returns a custom auth handler (gin middleware)
@@ -128,11 +139,36 @@ func GetLoggerMiddleware() gin.HandlerFunc {
 			clientIP, _ = IPAddress.(string)
 		}
 
-		log.Printf("[GIN-EXECUTIONS-LOGGER] %s | %3d | %13v | %s | %-7s %s | %s", // #nosec
-			logTime, status, latency, clientIP, method, path, user) // #nosec
+		// Append the attributes of the CloudEvent of the request, if any
+		var cloudEventInfo string
+		if cloudEvent, ok := c.Get("cloudEvent"); ok {
+			if ce, ok := cloudEvent.(*types.CloudEvent); ok {
+				cloudEventInfo = " | " + formatCloudEventLog(ce)
+			}
+		}
+
+		log.Printf("[GIN-EXECUTIONS-LOGGER] %s | %3d | %13v | %s | %-7s %s | %s%s", // #nosec
+			logTime, status, latency, clientIP, method, path, user, cloudEventInfo) // #nosec
 	}
 }
 
+// formatCloudEventLog formats the id, source, type, subject and extensions of a CloudEvent as quoted key-value pairs
+func formatCloudEventLog(ce *types.CloudEvent) string {
+	attrs := maps.Clone(ce.Extensions)
+	if attrs == nil {
+		attrs = map[string]string{}
+	}
+	attrs["id"], attrs["source"], attrs["type"] = ce.ID, ce.Source, ce.Type
+	if ce.Subject != "" {
+		attrs["subject"] = ce.Subject
+	}
+	pairs := []string{"cloudevent"}
+	for _, name := range slices.Sorted(maps.Keys(attrs)) {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", name, attrs[name]))
+	}
+	return strings.Join(pairs, " ")
+}
+
 func GetUIDFromContext(c *gin.Context) (string, error) {
 	uidOrigin, uidExists := c.Get("uidOrigin")
 	if !uidExists || uidOrigin == "" {
@@ -150,6 +186,19 @@ func GetUserNameFromContext(c *gin.Context) string {
 	return userName
 }
 
+// userGroupsKey context key of the OIDC groups of the user
+const userGroupsKey = "userGroups"
+
+// GetUserGroupsFromContext returns the OIDC groups of the user authenticated with an OIDC or personal access token
+func GetUserGroupsFromContext(c *gin.Context) []string {
+	return c.GetStringSlice(userGroupsKey)
+}
+
+// SetUserGroupsInContext stores the OIDC groups of the user authenticated by a handler
+func SetUserGroupsInContext(c *gin.Context, groups []string) {
+	c.Set(userGroupsKey, groups)
+}
+
 func GetMultitenancyConfigFromContext(c *gin.Context) (*MultitenancyConfig, error) {
 	mcUntyped, mcExists := c.Get("multitenancyConfig")
 	if !mcExists {
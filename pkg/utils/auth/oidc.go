@@ -18,6 +18,7 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -137,28 +138,58 @@ func getOIDCMiddleware(kubeClientset kubernetes.Interface, minIOAdminClient *uti
 			return
 		}
 		rawToken := strings.TrimPrefix(authHeader, "Bearer ")
-		iss, err := GetIssuerFromToken(rawToken)
-		if err != nil {
-			c.String(http.StatusBadRequest, fmt.Sprintf("%v", err))
-			return
-		}
-		oidcManager := ClusterOidcManagers[iss]
-		if oidcManager == nil {
-			c.String(http.StatusUnauthorized, fmt.Sprintf("'%s' is not listed as an authorized issuer", iss))
-			return
-		}
-		// Check the token
-		if !oidcManager.IsAuthorised(rawToken) {
-			c.AbortWithStatus(http.StatusUnauthorized)
-			return
-		}
+		var uid, userName string
+		var groups []string
+		if IsPersonalToken(rawToken) {
+			// Personal access tokens carry the identity of the OIDC user who created them
+			token, err := ValidatePersonalToken(c.Request.Context(), kubeClientset, cfg.Namespace, rawToken)
+			if err != nil {
+				if errors.Is(err, ErrInvalidPersonalToken) {
+					c.AbortWithStatus(http.StatusUnauthorized)
+				} else {
+					c.String(http.StatusInternalServerError, fmt.Sprintf("%v", err))
+				}
+				return
+			}
+			// The owner must still be enrolled in the allowed groups, as with OIDC tokens
+			if err := CheckPersonalTokenGroups(token, cfg); err != nil {
+				c.String(http.StatusUnauthorized, err.Error())
+				c.Abort()
+				return
+			}
+			uid = token.Owner
+			userName = token.UserName
+			groups = token.Groups
+		} else {
+			iss, err := GetIssuerFromToken(rawToken)
+			if err != nil {
+				c.String(http.StatusBadRequest, fmt.Sprintf("%v", err))
+				c.Abort()
+				return
+			}
+			oidcManager := ClusterOidcManagers[iss]
+			if oidcManager == nil {
+				c.String(http.StatusUnauthorized, fmt.Sprintf("'%s' is not listed as an authorized issuer", iss))
+				c.Abort()
+				return
+			}
+			// Check the token
+			if !oidcManager.IsAuthorised(rawToken) {
+				c.AbortWithStatus(http.StatusUnauthorized)
+				return
+			}
 
-		ui, err := oidcManager.GetUserInfo(rawToken)
-		if err != nil {
-			c.String(http.StatusInternalServerError, fmt.Sprintf("%v", err))
-			return
+			ui, err := oidcManager.GetUserInfo(rawToken)
+			if err != nil {
+				c.String(http.StatusInternalServerError, fmt.Sprintf("%v", err))
+				c.Abort()
+				return
+			}
+			uid = ui.Subject
+			userName = ui.Name
+			groups = ui.Groups
+			refreshPersonalTokenGroupsIfDue(c.Request.Context(), kubeClientset, cfg.Namespace, uid, groups)
 		}
-		uid := ui.Subject
 
 		// Check if exist MinIO user in cached users list
 		minioUserExists := mc.UserExists(uid)
@@ -172,11 +203,13 @@ func getOIDCMiddleware(kubeClientset kubernetes.Interface, minIOAdminClient *uti
 			err = mc.CreateSecretForOIDC(uid, sk)
 			if err != nil {
 				c.String(http.StatusInternalServerError, fmt.Sprintf("Error creating secret for user %s: %v", uid, err))
+				c.Abort()
 				return
 			}
 			err = minIOAdminClient.CreateMinIOUser(uid, sk)
 			if err != nil {
 				c.String(http.StatusInternalServerError, fmt.Sprintf("Error creating MinIO user for uid %s: %v", uid, err))
+				c.Abort()
 				return
 			}
 		}
@@ -184,24 +217,28 @@ func getOIDCMiddleware(kubeClientset kubernetes.Interface, minIOAdminClient *uti
 		// Create Kueue ClusterQueue and LocalQueue for the user if they don't exist
 		if err := utils.CreateKueueUserQueuesIfDontExist(cfg, uid); err != nil {
 			c.String(http.StatusInternalServerError, fmt.Sprintf("Error creating Kueue ClusterQueue for user %s: %v", uid, err))
+			c.Abort()
 			return
 		}
 		namespace, err := utils.EnsureUserNamespace(c.Request.Context(), kubeClientset, cfg, uid)
 		if err != nil {
 			c.String(http.StatusInternalServerError, fmt.Sprintf("error ensuring namespace for user %s: %v", uid, err))
+			c.Abort()
 			return
 		}
 
 		// Ensure Volume Quotas for the user
 		if _, err := utils.CreateMinIOQuotaConfigMapIfDontExist(c.Request.Context(), cfg, kubeClientset, namespace); err != nil {
 			c.String(http.StatusInternalServerError, fmt.Sprintf("Error creating Kueue ClusterQueue for user %s: %v", uid, err))
+			c.Abort()
 			return
 		}
 
 		utils.EnsureVolumeLimits(FormatUID(uid), namespace, kubeClientset, cfg)
 
 		c.Set("uidOrigin", uid)
-		c.Set("userName", ui.Name)
+		c.Set("userName", userName)
+		c.Set(userGroupsKey, groups)
 		c.Set("multitenancyConfig", mc)
 		c.Next()
 	}
@@ -346,15 +383,7 @@ func (om *oidcManager) IsAuthorised(rawToken string) bool {
 	}
 
 	// Groups
-	for _, tokenGroup := range ui.Groups {
-		for _, authGroup := range om.groups {
-			if tokenGroup == authGroup {
-				return true
-			}
-		}
-	}
-
-	return false
+	return inAllowedGroups(ui.Groups, om.groups)
 }
 
 func (om *oidcManager) UserInOneGroup(ui *userInfo, cfg *types.Config) bool {
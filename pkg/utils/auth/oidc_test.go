@@ -353,6 +353,9 @@ func TestGetOIDCMiddleware(t *testing.T) {
 			if c.Writer.Status() != s.code {
 				t.Errorf("expected status to be %v, got %v", s.code, c.Writer.Status())
 			}
+			if c.IsAborted() != (s.code != http.StatusOK) {
+				t.Errorf("expected aborted to be %v, got %v", s.code != http.StatusOK, c.IsAborted())
+			}
 		})
 	}
 }
@@ -0,0 +1,307 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grycap/oscar/v4/pkg/types"
+	"github.com/grycap/oscar/v4/pkg/utils"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// PersonalTokenPrefix prefix of the personal access tokens, which distinguishes them from service and OIDC tokens
+	PersonalTokenPrefix = "oscar_pat_"
+	// PersonalTokenOwnerLabel label of the secrets of the personal access tokens with the hash of their owner
+	PersonalTokenOwnerLabel = "oscar.grycap/personal-token-owner"
+
+	personalTokenSecretPrefix = "oscar-pat-"
+	personalTokenIDBytes      = 8
+
+	personalTokenOwnerKey     = "owner"
+	personalTokenUserNameKey  = "user_name"
+	personalTokenNameKey      = "name"
+	personalTokenGroupsKey    = "groups"
+	personalTokenHashKey      = "sha256"
+	personalTokenCreatedAtKey = "created_at"
+	personalTokenExpiresAtKey = "expires_at"
+	personalTokenCheckedAtKey = "groups_checked_at"
+
+	// personalTokenGroupsRefreshInterval minimum time between two refreshes of the groups stored in the
+	// personal access tokens of a user whose groups didn't change
+	personalTokenGroupsRefreshInterval = 10 * time.Minute
+)
+
+// ErrInvalidPersonalToken is returned when a personal access token is malformed, unknown, revoked or expired
+var ErrInvalidPersonalToken = errors.New("invalid personal access token")
+
+// ErrPersonalTokenGroupsOutdated is returned when the groups stored in a personal access token are no longer trusted
+var ErrPersonalTokenGroupsOutdated = errors.New("the groups of the owner of the personal access token are outdated, the owner must log in with an OIDC token to refresh them")
+
+// personalTokenGroupsRefreshes last groups stored in the personal access tokens of each user by this instance
+var personalTokenGroupsRefreshes sync.Map
+
+type personalTokenGroupsRefresh struct {
+	groups []string
+	at     time.Time
+}
+
+// IsPersonalToken returns true if the raw bearer token is a personal access token
+func IsPersonalToken(rawToken string) bool {
+	return strings.HasPrefix(rawToken, PersonalTokenPrefix)
+}
+
+// CreatePersonalToken mints a personal access token of the owner. Only the SHA-256 hash of its secret
+// is stored, so the returned token is the only copy of its value
+func CreatePersonalToken(ctx context.Context, kubeClientset kubernetes.Interface, namespace string, owner string, userName string, groups []string, name string, expiresAt time.Time) (*types.PersonalToken, error) {
+	idBytes := make([]byte, personalTokenIDBytes)
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil, err
+	}
+	id := hex.EncodeToString(idBytes)
+	secret := utils.GenerateToken()
+
+	token := &types.PersonalToken{
+		ID:        id,
+		Name:      name,
+		Owner:     owner,
+		UserName:  userName,
+		Groups:    groups,
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+		ExpiresAt: expiresAt.UTC().Truncate(time.Second),
+	}
+	token.GroupsCheckedAt = token.CreatedAt
+	groupsJSON, err := json.Marshal(groups)
+	if err != nil {
+		return nil, err
+	}
+	tokenSecret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      personalTokenSecretPrefix + id,
+			Namespace: namespace,
+			Labels: map[string]string{
+				PersonalTokenOwnerLabel: personalTokenOwnerHash(owner),
+			},
+		},
+		Type: v1.SecretTypeOpaque,
+		Data: map[string][]byte{
+			personalTokenOwnerKey:     []byte(owner),
+			personalTokenUserNameKey:  []byte(userName),
+			personalTokenNameKey:      []byte(name),
+			personalTokenGroupsKey:    groupsJSON,
+			personalTokenHashKey:      []byte(personalTokenHash(secret)),
+			personalTokenCreatedAtKey: []byte(token.CreatedAt.Format(time.RFC3339)),
+			personalTokenExpiresAtKey: []byte(token.ExpiresAt.Format(time.RFC3339)),
+			personalTokenCheckedAtKey: []byte(token.GroupsCheckedAt.Format(time.RFC3339)),
+		},
+	}
+	if _, err := kubeClientset.CoreV1().Secrets(namespace).Create(ctx, tokenSecret, metav1.CreateOptions{}); err != nil {
+		return nil, fmt.Errorf("error storing the personal access token: %v", err)
+	}
+	token.Token = PersonalTokenPrefix + id + "_" + secret
+	return token, nil
+}
+
+// ListPersonalTokens returns the personal access tokens of the owner sorted by creation time, without their values.
+// The expired tokens are deleted
+func ListPersonalTokens(ctx context.Context, kubeClientset kubernetes.Interface, namespace string, owner string) ([]types.PersonalToken, error) {
+	secrets, err := kubeClientset.CoreV1().Secrets(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", PersonalTokenOwnerLabel, personalTokenOwnerHash(owner)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	tokens := []types.PersonalToken{}
+	for i := range secrets.Items {
+		token := personalTokenFromSecret(&secrets.Items[i])
+		if token.Owner != owner {
+			continue
+		}
+		if token.Expired(now) {
+			if err := kubeClientset.CoreV1().Secrets(namespace).Delete(ctx, secrets.Items[i].Name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+				return nil, err
+			}
+			continue
+		}
+		tokens = append(tokens, *token)
+	}
+	slices.SortFunc(tokens, func(a, b types.PersonalToken) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return tokens, nil
+}
+
+// DeletePersonalToken revokes a personal access token of the owner, returning a NotFound error if the owner has no token with the ID
+func DeletePersonalToken(ctx context.Context, kubeClientset kubernetes.Interface, namespace string, owner string, id string) error {
+	tokenSecret, err := getPersonalTokenSecret(ctx, kubeClientset, namespace, id)
+	if err != nil {
+		return err
+	}
+	if tokenSecret == nil || string(tokenSecret.Data[personalTokenOwnerKey]) != owner {
+		return apierrors.NewNotFound(schema.GroupResource{Resource: "tokens"}, id)
+	}
+	return kubeClientset.CoreV1().Secrets(namespace).Delete(ctx, tokenSecret.Name, metav1.DeleteOptions{})
+}
+
+// ValidatePersonalToken returns the personal access token of the raw bearer token, or ErrInvalidPersonalToken
+// if it doesn't match a stored token or it has expired
+func ValidatePersonalToken(ctx context.Context, kubeClientset kubernetes.Interface, namespace string, rawToken string) (*types.PersonalToken, error) {
+	id, secret, ok := strings.Cut(strings.TrimPrefix(rawToken, PersonalTokenPrefix), "_")
+	if !ok || !IsPersonalToken(rawToken) || len(id) != 2*personalTokenIDBytes || secret == "" {
+		return nil, ErrInvalidPersonalToken
+	}
+	tokenSecret, err := getPersonalTokenSecret(ctx, kubeClientset, namespace, id)
+	if err != nil {
+		return nil, err
+	}
+	if tokenSecret == nil {
+		return nil, ErrInvalidPersonalToken
+	}
+	if subtle.ConstantTimeCompare(tokenSecret.Data[personalTokenHashKey], []byte(personalTokenHash(secret))) != 1 {
+		return nil, ErrInvalidPersonalToken
+	}
+	token := personalTokenFromSecret(tokenSecret)
+	if token.Owner == "" || token.Expired(time.Now()) {
+		return nil, ErrInvalidPersonalToken
+	}
+	return token, nil
+}
+
+// CheckPersonalTokenGroups checks that the owner of a personal access token belongs to one of the groups allowed
+// in the cluster, as the users of OIDC tokens, and that its groups were refreshed within PERSONAL_TOKEN_GROUPS_TTL
+func CheckPersonalTokenGroups(token *types.PersonalToken, cfg *types.Config) error {
+	if token.GroupsOutdated(time.Now(), cfg.PersonalTokenGroupsTTL) {
+		return ErrPersonalTokenGroupsOutdated
+	}
+	if !inAllowedGroups(token.Groups, cfg.OIDCGroups) {
+		return fmt.Errorf("this user isn't enrrolled on the vo: %v", cfg.OIDCGroups)
+	}
+	return nil
+}
+
+// RefreshPersonalTokenGroups stores the groups read from the OIDC provider in the personal access tokens of the owner
+func RefreshPersonalTokenGroups(ctx context.Context, kubeClientset kubernetes.Interface, namespace string, owner string, groups []string) error {
+	secrets, err := kubeClientset.CoreV1().Secrets(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", PersonalTokenOwnerLabel, personalTokenOwnerHash(owner)),
+	})
+	if err != nil {
+		return err
+	}
+	groupsJSON, err := json.Marshal(groups)
+	if err != nil {
+		return err
+	}
+	checkedAt := []byte(time.Now().UTC().Truncate(time.Second).Format(time.RFC3339))
+	for i := range secrets.Items {
+		tokenSecret := &secrets.Items[i]
+		if string(tokenSecret.Data[personalTokenOwnerKey]) != owner {
+			continue
+		}
+		tokenSecret.Data[personalTokenGroupsKey] = groupsJSON
+		tokenSecret.Data[personalTokenCheckedAtKey] = checkedAt
+		if _, err := kubeClientset.CoreV1().Secrets(namespace).Update(ctx, tokenSecret, metav1.UpdateOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// refreshPersonalTokenGroupsIfDue refreshes the groups of the personal access tokens of the owner after an OIDC login,
+// skipping the refresh if this instance stored the same groups less than personalTokenGroupsRefreshInterval ago
+func refreshPersonalTokenGroupsIfDue(ctx context.Context, kubeClientset kubernetes.Interface, namespace string, owner string, groups []string) {
+	if last, ok := personalTokenGroupsRefreshes.Load(owner); ok {
+		refresh := last.(personalTokenGroupsRefresh)
+		if slices.Equal(refresh.groups, groups) && time.Since(refresh.at) < personalTokenGroupsRefreshInterval {
+			return
+		}
+	}
+	if err := RefreshPersonalTokenGroups(ctx, kubeClientset, namespace, owner, groups); err != nil {
+		oidcLogger.Printf("Error refreshing the groups of the personal access tokens of user %s: %v", owner, err)
+		return
+	}
+	personalTokenGroupsRefreshes.Store(owner, personalTokenGroupsRefresh{groups: slices.Clone(groups), at: time.Now()})
+}
+
+// inAllowedGroups returns true if any of the groups of a user is allowed in the cluster.
+// No user is allowed if the cluster has no allowed groups (OIDC_GROUPS), both with OIDC and personal access tokens
+func inAllowedGroups(userGroups []string, allowedGroups []string) bool {
+	return slices.ContainsFunc(userGroups, func(group string) bool {
+		return slices.Contains(allowedGroups, group)
+	})
+}
+
+// getPersonalTokenSecret returns the secret of the personal access token with the ID, or nil if it doesn't exist
+func getPersonalTokenSecret(ctx context.Context, kubeClientset kubernetes.Interface, namespace string, id string) (*v1.Secret, error) {
+	tokenSecret, err := kubeClientset.CoreV1().Secrets(namespace).Get(ctx, personalTokenSecretPrefix+id, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if _, ok := tokenSecret.Labels[PersonalTokenOwnerLabel]; !ok {
+		return nil, nil
+	}
+	return tokenSecret, nil
+}
+
+func personalTokenFromSecret(tokenSecret *v1.Secret) *types.PersonalToken {
+	token := &types.PersonalToken{
+		ID:       strings.TrimPrefix(tokenSecret.Name, personalTokenSecretPrefix),
+		Name:     string(tokenSecret.Data[personalTokenNameKey]),
+		Owner:    string(tokenSecret.Data[personalTokenOwnerKey]),
+		UserName: string(tokenSecret.Data[personalTokenUserNameKey]),
+	}
+	_ = json.Unmarshal(tokenSecret.Data[personalTokenGroupsKey], &token.Groups)
+	token.CreatedAt, _ = time.Parse(time.RFC3339, string(tokenSecret.Data[personalTokenCreatedAtKey]))
+	// Tokens without a valid expiration time are expired
+	token.ExpiresAt, _ = time.Parse(time.RFC3339, string(tokenSecret.Data[personalTokenExpiresAtKey]))
+	// Tokens created before their groups were refreshed keep the groups read when they were created
+	token.GroupsCheckedAt, _ = time.Parse(time.RFC3339, string(tokenSecret.Data[personalTokenCheckedAtKey]))
+	if token.GroupsCheckedAt.IsZero() {
+		token.GroupsCheckedAt = token.CreatedAt
+	}
+	return token
+}
+
+// personalTokenHash returns the hex encoded SHA-256 hash of the secret of a personal access token
+func personalTokenHash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// personalTokenOwnerHash returns a label value identifying the owner of a personal access token
+func personalTokenOwnerHash(owner string) string {
+	return personalTokenHash(owner)[:40]
+}
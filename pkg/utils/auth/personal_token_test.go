@@ -0,0 +1,200 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package auth
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grycap/oscar/v4/pkg/types"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestPersonalTokenLifecycle(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset()
+	namespace := "oscar"
+	owner := "user@egi.eu"
+
+	token, err := CreatePersonalToken(ctx, clientset, namespace, owner, "User", []string{"vo.example.eu"}, "ci", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !IsPersonalToken(token.Token) {
+		t.Fatalf("expected a personal access token, got %q", token.Token)
+	}
+	if len(token.Token) == 64 {
+		t.Errorf("personal access tokens must not have the length of service tokens")
+	}
+
+	// Only the hash of the token is stored
+	secret, err := clientset.CoreV1().Secrets(namespace).Get(ctx, personalTokenSecretPrefix+token.ID, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected the secret of the token: %v", err)
+	}
+	for key, value := range secret.Data {
+		if strings.Contains(token.Token, string(value)) && key != personalTokenOwnerKey && key != personalTokenNameKey && key != personalTokenUserNameKey {
+			t.Errorf("the value of the token is stored in %s", key)
+		}
+	}
+
+	validated, err := ValidatePersonalToken(ctx, clientset, namespace, token.Token)
+	if err != nil {
+		t.Fatalf("unexpected error validating the token: %v", err)
+	}
+	if validated.Owner != owner || validated.UserName != "User" || !slices.Equal(validated.Groups, []string{"vo.example.eu"}) {
+		t.Errorf("unexpected validated token: %+v", validated)
+	}
+	if validated.Token != "" {
+		t.Errorf("validated tokens must not carry their value")
+	}
+
+	if _, err := ValidatePersonalToken(ctx, clientset, namespace, token.Token[:len(token.Token)-1]+"x"); !errors.Is(err, ErrInvalidPersonalToken) {
+		t.Errorf("expected ErrInvalidPersonalToken with a wrong secret, got %v", err)
+	}
+	if _, err := ValidatePersonalToken(ctx, clientset, namespace, PersonalTokenPrefix+"malformed"); !errors.Is(err, ErrInvalidPersonalToken) {
+		t.Errorf("expected ErrInvalidPersonalToken with a malformed token, got %v", err)
+	}
+
+	tokens, err := ListPersonalTokens(ctx, clientset, namespace, owner)
+	if err != nil {
+		t.Fatalf("unexpected error listing the tokens: %v", err)
+	}
+	if len(tokens) != 1 || tokens[0].ID != token.ID || tokens[0].Token != "" {
+		t.Fatalf("unexpected tokens: %+v", tokens)
+	}
+	tokens, err = ListPersonalTokens(ctx, clientset, namespace, "other@egi.eu")
+	if err != nil || len(tokens) != 0 {
+		t.Fatalf("expected no tokens of other users, got %+v (%v)", tokens, err)
+	}
+
+	if err := DeletePersonalToken(ctx, clientset, namespace, "other@egi.eu", token.ID); !apierrors.IsNotFound(err) {
+		t.Errorf("expected NotFound revoking the token of another user, got %v", err)
+	}
+	if err := DeletePersonalToken(ctx, clientset, namespace, owner, token.ID); err != nil {
+		t.Fatalf("unexpected error revoking the token: %v", err)
+	}
+	if _, err := ValidatePersonalToken(ctx, clientset, namespace, token.Token); !errors.Is(err, ErrInvalidPersonalToken) {
+		t.Errorf("expected ErrInvalidPersonalToken with a revoked token, got %v", err)
+	}
+	if err := DeletePersonalToken(ctx, clientset, namespace, owner, token.ID); !apierrors.IsNotFound(err) {
+		t.Errorf("expected NotFound revoking a revoked token, got %v", err)
+	}
+}
+
+func TestPersonalTokenExpired(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset()
+	namespace := "oscar"
+	owner := "user@egi.eu"
+
+	token, err := CreatePersonalToken(ctx, clientset, namespace, owner, "", nil, "old", time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := ValidatePersonalToken(ctx, clientset, namespace, token.Token); !errors.Is(err, ErrInvalidPersonalToken) {
+		t.Errorf("expected ErrInvalidPersonalToken with an expired token, got %v", err)
+	}
+
+	// Expired tokens are deleted when listed
+	tokens, err := ListPersonalTokens(ctx, clientset, namespace, owner)
+	if err != nil || len(tokens) != 0 {
+		t.Fatalf("expected no tokens, got %+v (%v)", tokens, err)
+	}
+	if _, err := clientset.CoreV1().Secrets(namespace).Get(ctx, personalTokenSecretPrefix+token.ID, metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("expected the secret of the expired token to be deleted, got %v", err)
+	}
+}
+
+func TestCheckPersonalTokenGroups(t *testing.T) {
+	now := time.Now()
+	cfg := &types.Config{OIDCGroups: []string{"vo.example.eu"}, PersonalTokenGroupsTTL: time.Hour}
+
+	scenarios := []struct {
+		name  string
+		token types.PersonalToken
+		cfg   *types.Config
+		err   bool
+	}{
+		{"allowed group", types.PersonalToken{Groups: []string{"vo.example.eu"}, GroupsCheckedAt: now}, cfg, false},
+		{"other group", types.PersonalToken{Groups: []string{"other.vo"}, GroupsCheckedAt: now}, cfg, true},
+		{"outdated groups", types.PersonalToken{Groups: []string{"vo.example.eu"}, GroupsCheckedAt: now.Add(-2 * time.Hour)}, cfg, true},
+		{"no groups ttl", types.PersonalToken{Groups: []string{"vo.example.eu"}, GroupsCheckedAt: now.Add(-2 * time.Hour)}, &types.Config{OIDCGroups: cfg.OIDCGroups}, false},
+		// As with OIDC tokens, no user is allowed if the cluster has no allowed groups
+		{"no allowed groups", types.PersonalToken{Groups: []string{"vo.example.eu"}, GroupsCheckedAt: now}, &types.Config{PersonalTokenGroupsTTL: time.Hour}, true},
+	}
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			if err := CheckPersonalTokenGroups(&s.token, s.cfg); (err != nil) != s.err {
+				t.Errorf("expected error %v, got %v", s.err, err)
+			}
+		})
+	}
+	stale := types.PersonalToken{Groups: []string{"vo.example.eu"}, GroupsCheckedAt: now.Add(-2 * time.Hour)}
+	if err := CheckPersonalTokenGroups(&stale, cfg); !errors.Is(err, ErrPersonalTokenGroupsOutdated) {
+		t.Errorf("expected ErrPersonalTokenGroupsOutdated, got %v", err)
+	}
+}
+
+func TestRefreshPersonalTokenGroups(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset()
+	namespace := "oscar"
+	owner := "user@egi.eu"
+
+	token, err := CreatePersonalToken(ctx, clientset, namespace, owner, "", []string{"vo.example.eu"}, "ci", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	other, err := CreatePersonalToken(ctx, clientset, namespace, "other@egi.eu", "", []string{"vo.example.eu"}, "ci", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Simulate a token whose groups were read a day ago
+	secret, err := clientset.CoreV1().Secrets(namespace).Get(ctx, personalTokenSecretPrefix+token.ID, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	secret.Data[personalTokenCheckedAtKey] = []byte(time.Now().Add(-24 * time.Hour).UTC().Format(time.RFC3339))
+	if _, err := clientset.CoreV1().Secrets(namespace).Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := RefreshPersonalTokenGroups(ctx, clientset, namespace, owner, []string{"other.vo"}); err != nil {
+		t.Fatalf("unexpected error refreshing the groups: %v", err)
+	}
+	refreshed, err := ValidatePersonalToken(ctx, clientset, namespace, token.Token)
+	if err != nil {
+		t.Fatalf("unexpected error validating the token: %v", err)
+	}
+	if !slices.Equal(refreshed.Groups, []string{"other.vo"}) || time.Since(refreshed.GroupsCheckedAt) > time.Minute {
+		t.Errorf("expected the groups to be refreshed, got %+v", refreshed)
+	}
+	untouched, err := ValidatePersonalToken(ctx, clientset, namespace, other.Token)
+	if err != nil {
+		t.Fatalf("unexpected error validating the token: %v", err)
+	}
+	if !slices.Equal(untouched.Groups, []string{"vo.example.eu"}) {
+		t.Errorf("expected the groups of other users to be kept, got %v", untouched.Groups)
+	}
+}
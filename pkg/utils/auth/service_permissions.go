@@ -32,6 +32,7 @@ import (
 // - If the service is public, it allows access to everyone.
 // - If the service is private, it allows access only to the owner of the service.
 // - If the service is restricted, it allows access to the owner and the users in the allowed users list.
+// - The users and OIDC groups with, at least, the invoker role in the access control list of the service are allowed.
 func GetServicePermissionsMiddleware(back types.ServerlessBackend) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// If autenticated with service token
@@ -63,13 +64,7 @@ func GetServicePermissionsMiddleware(back types.ServerlessBackend) gin.HandlerFu
 		// If authenticated with OIDC
 		// Check permissions to access the service
 		if _, ok := isAuthBearer(c); ok {
-			uid, err := GetUIDFromContext(c)
-			if err != nil {
-				c.AbortWithStatus(http.StatusForbidden)
-				return
-			}
-
-			if hasPermission(service, uid) {
+			if HasServiceRole(c, service, types.ServiceRoleInvoker) {
 				c.Next()
 				return
 			}
@@ -80,22 +75,47 @@ func GetServicePermissionsMiddleware(back types.ServerlessBackend) gin.HandlerFu
 	}
 }
 
-func hasPermission(service *types.Service, uid string) bool {
+// ServiceRole returns the most privileged role of a user on the service, or an empty string if the user can't access it.
+// The owner of the service has the owner role, the users allowed by its visibility the invoker role,
+// and the users and groups of its access control list the role granted to them
+func ServiceRole(service *types.Service, uid string, groups []string) string {
+	if service == nil {
+		return ""
+	}
+	role := ""
 	switch service.Visibility {
 	case utils.PUBLIC:
-		return true
-	case utils.PRIVATE:
-		if service.Owner == uid {
-			return true
-		}
+		role = types.ServiceRoleInvoker
 	case utils.RESTRICTED:
-		if service.Owner == uid || slices.Contains(service.AllowedUsers, uid) {
-			return true
+		if slices.Contains(service.AllowedUsers, uid) {
+			role = types.ServiceRoleInvoker
 		}
+	case utils.PRIVATE, "":
+		// Only the owner and the access control list grant access
 	default:
+		return ""
+	}
+	if uid != "" && service.Owner == uid {
+		return types.ServiceRoleOwner
+	}
+	if service.ACL != nil {
+		if uid != "" {
+			role = types.HigherServiceRole(role, service.ACL.Users[uid])
+		}
+		for _, group := range groups {
+			role = types.HigherServiceRole(role, service.ACL.Groups[group])
+		}
+	}
+	return role
+}
+
+// HasServiceRole returns true if the user authenticated in the request has, at least, the role on the service
+func HasServiceRole(c *gin.Context, service *types.Service, role string) bool {
+	uid, err := GetUIDFromContext(c)
+	if err != nil {
 		return false
 	}
-	return false
+	return types.ServiceRoleAllows(ServiceRole(service, uid, GetUserGroupsFromContext(c)), role)
 }
 
 func isAuthBearer(c *gin.Context) (string, bool) {
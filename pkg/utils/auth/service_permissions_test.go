@@ -26,8 +26,8 @@ import (
 	"github.com/grycap/oscar/v4/pkg/utils"
 )
 
-func TestHasPermission(t *testing.T) {
-	// Decision graph paths for hasPermission:
+func TestServiceRole(t *testing.T) {
+	// Decision graph paths for the invoker role:
 	// 1) public -> allow
 	// 2) private + owner -> allow
 	// 3) private + non-owner -> deny
@@ -111,14 +111,55 @@ func TestHasPermission(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := hasPermission(tt.service, tt.uid)
+			got := types.ServiceRoleAllows(ServiceRole(tt.service, tt.uid, nil), types.ServiceRoleInvoker)
 			if got != tt.want {
-				t.Errorf("hasPermission() = %v, want %v", got, tt.want)
+				t.Errorf("ServiceRole() allows invoking = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
 
+func TestServiceRoleACL(t *testing.T) {
+	service := &types.Service{
+		Visibility:   utils.RESTRICTED,
+		Owner:        "owner",
+		AllowedUsers: []string{"allowed-user"},
+		ACL: &types.ServiceACL{
+			Users:  map[string]string{"student": types.ServiceRoleViewer, "allowed-user": types.ServiceRoleEditor, "owner": types.ServiceRoleViewer},
+			Groups: map[string]string{"teachers": types.ServiceRoleEditor, "class": types.ServiceRoleViewer},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		uid    string
+		groups []string
+		want   string
+	}{
+		{"owner keeps the owner role", "owner", nil, types.ServiceRoleOwner},
+		{"user role", "student", nil, types.ServiceRoleViewer},
+		{"acl raises the role of allowed users", "allowed-user", nil, types.ServiceRoleEditor},
+		{"group role", "teacher", []string{"teachers"}, types.ServiceRoleEditor},
+		{"most privileged role of the user and groups", "student", []string{"class", "teachers"}, types.ServiceRoleEditor},
+		{"unknown user", "other-user", []string{"others"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ServiceRole(service, tt.uid, tt.groups); got != tt.want {
+				t.Errorf("ServiceRole() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Set("uidOrigin", "teacher")
+	SetUserGroupsInContext(c, []string{"teachers"})
+	if !HasServiceRole(c, service, types.ServiceRoleEditor) || HasServiceRole(c, service, types.ServiceRoleOwner) {
+		t.Errorf("expected the editor role from the groups in the context")
+	}
+}
+
 func TestIsAuthBearer(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -32,6 +32,12 @@ const isServiceTokenKey = "isServiceToken"
 // GetServiceTokenMiddleware returns a gin middleware that checks if the request is authenticated with a service token
 // APPLY ONLY before auth.GetAuthMiddleware, since it relies on the fact that if a service token is provided, the user authentication will not be performed
 func GetServiceTokenMiddleware(back types.ServerlessBackend) gin.HandlerFunc {
+	return GetScopedServiceTokenMiddleware(back, types.ServiceTokenScopeExposedAccess)
+}
+
+// GetScopedServiceTokenMiddleware returns a gin middleware that checks if the request is authenticated with a
+// token of the service allowed to perform the operations of the scope
+func GetScopedServiceTokenMiddleware(back types.ServerlessBackend, scope string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		if isBasicAuth(c) {
 			c.Next()
@@ -54,7 +60,7 @@ func GetServiceTokenMiddleware(back types.ServerlessBackend) gin.HandlerFunc {
 			// the restriction for unique service names is enforced in the service creation and update handlers
 			service := serviceList[0]
 			for _, token := range tokens {
-				if token == service.Token {
+				if MatchServiceToken(c.Request.Context(), back.GetKubeClientset(), service, token, scope) {
 					c.Set(isServiceTokenKey, true)
 					setServiceTokenCookie(c, service.Name, token)
 					c.Next()
@@ -71,6 +77,11 @@ func GetServiceTokenMiddleware(back types.ServerlessBackend) gin.HandlerFunc {
 	}
 }
 
+// IsServiceTokenRequest returns true if the request has been authenticated with a service token
+func IsServiceTokenRequest(c *gin.Context) bool {
+	return c.GetBool(isServiceTokenKey)
+}
+
 func getServiceTokenCandidates(c *gin.Context) []string {
 	tokens := []string{}
 
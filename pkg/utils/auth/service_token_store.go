@@ -0,0 +1,379 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/grycap/oscar/v4/pkg/types"
+	"github.com/grycap/oscar/v4/pkg/utils"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	serviceTokensSecretSuffix = ".tokens"
+	serviceTokenIDBytes       = 8
+	// serviceTokenLastUsedResolution minimum time between the updates of the last use of a token
+	serviceTokenLastUsedResolution = time.Minute
+	// serviceTokenUseTimeout maximum time to record the last use of a token
+	serviceTokenUseTimeout = 10 * time.Second
+)
+
+var serviceTokenLogger = log.New(os.Stdout, "[SERVICE-TOKENS] ", log.Flags())
+
+// serviceTokenLastUses last time this instance recorded the use of each token, keyed by namespace, service and token ID
+var serviceTokenLastUses sync.Map
+
+// serviceTokenUses records of the last use of tokens in progress
+var serviceTokenUses sync.WaitGroup
+
+// serviceTokenRecord token of a service stored with the SHA-256 hash of its value
+type serviceTokenRecord struct {
+	types.ServiceToken
+	Hash string `json:"sha256"`
+}
+
+// ServiceTokensSecretName returns the name of the secret storing the additional tokens of a service.
+// Service names are DNS-1035 labels, so the dot keeps it from colliding with the secret of a service
+func ServiceTokensSecretName(serviceName string) string {
+	return serviceName + serviceTokensSecretSuffix
+}
+
+// FindServiceByToken returns the service of the list accepting the raw token with the scope, or nil if none does.
+// The primary tokens are checked first, so the stored tokens are only read if none of them matches
+func FindServiceByToken(ctx context.Context, kubeClientset kubernetes.Interface, services []*types.Service, rawToken string, scope string) *types.Service {
+	for _, service := range services {
+		if matchPrimaryServiceToken(service, rawToken) {
+			recordServiceTokenUse(kubeClientset, service, types.PrimaryServiceTokenID)
+			return service
+		}
+	}
+	for _, service := range services {
+		if MatchServiceToken(ctx, kubeClientset, service, rawToken, scope) {
+			return service
+		}
+	}
+	return nil
+}
+
+// MatchServiceToken returns true if the raw token is accepted to access the service with the scope. The primary
+// token of the service and its previous token during the grace period have all the scopes, and the named tokens
+// only the scopes granted when they were created. The last use of the matched token is recorded in the background
+func MatchServiceToken(ctx context.Context, kubeClientset kubernetes.Interface, service *types.Service, rawToken string, scope string) bool {
+	if service == nil || rawToken == "" {
+		return false
+	}
+	if matchPrimaryServiceToken(service, rawToken) {
+		recordServiceTokenUse(kubeClientset, service, types.PrimaryServiceTokenID)
+		return true
+	}
+	if kubeClientset == nil {
+		return false
+	}
+
+	records, _, err := getServiceTokenRecords(ctx, kubeClientset, service)
+	if err != nil {
+		serviceTokenLogger.Printf("Error reading the tokens of service '%s': %v", service.Name, err)
+		return false
+	}
+	hash := personalTokenHash(rawToken)
+	now := time.Now()
+	for id, record := range records {
+		if id == types.PrimaryServiceTokenID || subtle.ConstantTimeCompare([]byte(record.Hash), []byte(hash)) != 1 {
+			continue
+		}
+		if record.Expired(now) || (id != types.GraceServiceTokenID && !record.HasScope(scope)) {
+			return false
+		}
+		recordServiceTokenUse(kubeClientset, service, id)
+		return true
+	}
+	return false
+}
+
+// matchPrimaryServiceToken returns true if the raw token is the primary token of the service
+func matchPrimaryServiceToken(service *types.Service, rawToken string) bool {
+	return service != nil && service.Token != "" && rawToken != "" && subtle.ConstantTimeCompare([]byte(rawToken), []byte(service.Token)) == 1
+}
+
+// ListServiceTokens returns the tokens accepted to access the service, without their values. The primary token
+// is listed first, followed by the previous primary token in its grace period and the named tokens by creation time
+func ListServiceTokens(ctx context.Context, kubeClientset kubernetes.Interface, service *types.Service) ([]types.ServiceToken, error) {
+	records, _, err := getServiceTokenRecords(ctx, kubeClientset, service)
+	if err != nil {
+		return nil, err
+	}
+	tokens := []types.ServiceToken{primaryServiceToken(service, records).ServiceToken}
+	named := []types.ServiceToken{}
+	now := time.Now()
+	for id, record := range records {
+		if id == types.PrimaryServiceTokenID || record.Expired(now) {
+			continue
+		}
+		if id == types.GraceServiceTokenID {
+			tokens = append(tokens, record.ServiceToken)
+		} else {
+			named = append(named, record.ServiceToken)
+		}
+	}
+	slices.SortFunc(named, func(a, b types.ServiceToken) int {
+		return a.CreatedAt.Compare(*b.CreatedAt)
+	})
+	return append(tokens, named...), nil
+}
+
+// CreateServiceToken creates a named token of the service with the scopes. A nil expiration time creates a
+// token that doesn't expire. Only the SHA-256 hash of the token is stored, so the returned token is the only
+// copy of its value
+func CreateServiceToken(ctx context.Context, kubeClientset kubernetes.Interface, service *types.Service, name string, scopes []string, expiresAt *time.Time) (*types.ServiceToken, error) {
+	idBytes := make([]byte, serviceTokenIDBytes)
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil, err
+	}
+	value := utils.GenerateToken()
+	createdAt := time.Now().UTC().Truncate(time.Second)
+	record := &serviceTokenRecord{
+		ServiceToken: types.ServiceToken{
+			ID:        hex.EncodeToString(idBytes),
+			Name:      name,
+			Scopes:    slices.Compact(slices.Sorted(slices.Values(scopes))),
+			CreatedAt: &createdAt,
+		},
+		Hash: personalTokenHash(value),
+	}
+	if expiresAt != nil {
+		expiration := expiresAt.UTC().Truncate(time.Second)
+		record.ExpiresAt = &expiration
+	}
+	err := updateServiceTokenRecords(ctx, kubeClientset, service, func(records map[string]*serviceTokenRecord) error {
+		records[record.ID] = record
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	token := record.ServiceToken
+	token.Token = value
+	return &token, nil
+}
+
+// DeleteServiceToken revokes a named token of the service, or the previous primary token before the end of its
+// grace period. Returns a NotFound error if the service has no token with the ID
+func DeleteServiceToken(ctx context.Context, kubeClientset kubernetes.Interface, service *types.Service, id string) error {
+	if id == types.PrimaryServiceTokenID {
+		return fmt.Errorf("the primary token can't be revoked, rotate it instead")
+	}
+	return updateServiceTokenRecords(ctx, kubeClientset, service, func(records map[string]*serviceTokenRecord) error {
+		if _, ok := records[id]; !ok {
+			return apierrors.NewNotFound(schema.GroupResource{Resource: "tokens"}, id)
+		}
+		delete(records, id)
+		return nil
+	})
+}
+
+// RecordServiceTokenRotation keeps the previous primary token of the service, already updated with its new
+// primary token, accepted until the end of the grace period. A grace period already ended revokes the previous
+// token immediately, as well as the token of any previous rotation
+func RecordServiceTokenRotation(ctx context.Context, kubeClientset kubernetes.Interface, service *types.Service, previousToken string, graceExpiresAt time.Time) error {
+	return updateServiceTokenRecords(ctx, kubeClientset, service, func(records map[string]*serviceTokenRecord) error {
+		delete(records, types.GraceServiceTokenID)
+		if previousToken != "" && time.Now().Before(graceExpiresAt) {
+			grace := &serviceTokenRecord{
+				ServiceToken: types.ServiceToken{
+					ID:     types.GraceServiceTokenID,
+					Name:   types.GraceServiceTokenID,
+					Scopes: slices.Clone(types.ServiceTokenScopes),
+				},
+				Hash: personalTokenHash(previousToken),
+			}
+			// The last use of the previous token is kept to know when its clients have been updated
+			if primary, ok := records[types.PrimaryServiceTokenID]; ok && primary.Hash == grace.Hash {
+				grace.CreatedAt = primary.CreatedAt
+				grace.LastUsedAt = primary.LastUsedAt
+			}
+			expiration := graceExpiresAt.UTC().Truncate(time.Second)
+			grace.ExpiresAt = &expiration
+			records[types.GraceServiceTokenID] = grace
+		}
+		createdAt := time.Now().UTC().Truncate(time.Second)
+		primary := primaryServiceToken(service, nil)
+		primary.CreatedAt = &createdAt
+		records[types.PrimaryServiceTokenID] = primary
+		return nil
+	})
+}
+
+// primaryServiceToken returns the record of the primary token of the service, which is new if the stored
+// record belongs to a previous token
+func primaryServiceToken(service *types.Service, records map[string]*serviceTokenRecord) *serviceTokenRecord {
+	hash := personalTokenHash(service.Token)
+	if record, ok := records[types.PrimaryServiceTokenID]; ok && record.Hash == hash {
+		return record
+	}
+	return &serviceTokenRecord{
+		ServiceToken: types.ServiceToken{
+			ID:     types.PrimaryServiceTokenID,
+			Name:   types.PrimaryServiceTokenID,
+			Scopes: slices.Clone(types.ServiceTokenScopes),
+		},
+		Hash: hash,
+	}
+}
+
+// recordServiceTokenUse records the last use of a token of the service in the background, at most once per
+// serviceTokenLastUsedResolution in each instance, so the requests don't wait for the Kubernetes API
+func recordServiceTokenUse(kubeClientset kubernetes.Interface, service *types.Service, id string) {
+	if kubeClientset == nil {
+		return
+	}
+	key := serviceTokensNamespace(service) + "/" + service.Name + "/" + id
+	now := time.Now()
+	if last, ok := serviceTokenLastUses.Load(key); ok && now.Sub(last.(time.Time)) < serviceTokenLastUsedResolution {
+		return
+	}
+	serviceTokenLastUses.Store(key, now)
+
+	used := *service
+	serviceTokenUses.Add(1)
+	go func() {
+		defer serviceTokenUses.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), serviceTokenUseTimeout)
+		defer cancel()
+		touchServiceToken(ctx, kubeClientset, &used, id)
+	}()
+}
+
+// touchServiceToken records the last use of a token of the service. Errors are logged and never reject the request
+func touchServiceToken(ctx context.Context, kubeClientset kubernetes.Interface, service *types.Service, id string) {
+	records, _, err := getServiceTokenRecords(ctx, kubeClientset, service)
+	if err != nil {
+		serviceTokenLogger.Printf("Error reading the tokens of service '%s': %v", service.Name, err)
+		return
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	record, ok := records[id]
+	if id == types.PrimaryServiceTokenID {
+		record, ok = primaryServiceToken(service, records), true
+	}
+	if !ok || (record.LastUsedAt != nil && now.Sub(*record.LastUsedAt) < serviceTokenLastUsedResolution) {
+		return
+	}
+	err = updateServiceTokenRecords(ctx, kubeClientset, service, func(records map[string]*serviceTokenRecord) error {
+		if id == types.PrimaryServiceTokenID {
+			records[id] = primaryServiceToken(service, records)
+		}
+		if current, ok := records[id]; ok {
+			current.LastUsedAt = &now
+		}
+		return nil
+	})
+	if err != nil {
+		serviceTokenLogger.Printf("Error recording the use of token '%s' of service '%s': %v", id, service.Name, err)
+	}
+}
+
+// updateServiceTokenRecords applies the update to the stored tokens of the service, retrying on conflicts.
+// The expired tokens are removed
+func updateServiceTokenRecords(ctx context.Context, kubeClientset kubernetes.Interface, service *types.Service, update func(records map[string]*serviceTokenRecord) error) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		records, secret, err := getServiceTokenRecords(ctx, kubeClientset, service)
+		if err != nil {
+			return err
+		}
+		if err := update(records); err != nil {
+			return err
+		}
+		now := time.Now()
+		data := map[string][]byte{}
+		for id, record := range records {
+			if record.Expired(now) {
+				continue
+			}
+			if data[id], err = json.Marshal(record); err != nil {
+				return err
+			}
+		}
+		if secret == nil {
+			secret = &v1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      ServiceTokensSecretName(service.Name),
+					Namespace: serviceTokensNamespace(service),
+					Labels: map[string]string{
+						types.ServiceLabel: service.Name,
+					},
+				},
+				Type: v1.SecretTypeOpaque,
+				Data: data,
+			}
+			_, err = kubeClientset.CoreV1().Secrets(secret.Namespace).Create(ctx, secret, metav1.CreateOptions{})
+			if apierrors.IsAlreadyExists(err) {
+				// Created concurrently, retry the update
+				return apierrors.NewConflict(schema.GroupResource{Resource: "secrets"}, secret.Name, err)
+			}
+			return err
+		}
+		secret.Data = data
+		_, err = kubeClientset.CoreV1().Secrets(secret.Namespace).Update(ctx, secret, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// getServiceTokenRecords returns the stored tokens of the service with their secret, which is nil if the
+// service has no stored tokens
+func getServiceTokenRecords(ctx context.Context, kubeClientset kubernetes.Interface, service *types.Service) (map[string]*serviceTokenRecord, *v1.Secret, error) {
+	records := map[string]*serviceTokenRecord{}
+	secret, err := kubeClientset.CoreV1().Secrets(serviceTokensNamespace(service)).Get(ctx, ServiceTokensSecretName(service.Name), metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return records, nil, nil
+		}
+		return nil, nil, err
+	}
+	for id, raw := range secret.Data {
+		record := &serviceTokenRecord{}
+		if err := json.Unmarshal(raw, record); err != nil {
+			serviceTokenLogger.Printf("Ignoring invalid token '%s' of service '%s': %v", id, service.Name, err)
+			continue
+		}
+		record.ID = id
+		records[id] = record
+	}
+	return records, secret, nil
+}
+
+func serviceTokensNamespace(service *types.Service) string {
+	if service.Namespace != "" {
+		return service.Namespace
+	}
+	return ServicesNamespace
+}
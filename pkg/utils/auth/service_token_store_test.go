@@ -0,0 +1,275 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/grycap/oscar/v4/pkg/types"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const testPrimaryToken = "11e387cf727630d899925d57fceb4578f478c44be6cde0ae3fe886d8be513acf"
+
+// waitServiceTokenUses waits for the uses of the tokens being recorded and forgets them, so the next uses are recorded too
+func waitServiceTokenUses() {
+	serviceTokenUses.Wait()
+	serviceTokenLastUses.Clear()
+}
+
+func TestNamedServiceTokens(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset()
+	service := &types.Service{Name: "svc", Namespace: "oscar-svc", Token: testPrimaryToken}
+
+	logs, err := CreateServiceToken(ctx, clientset, service, "dashboard", []string{types.ServiceTokenScopeReadLogs}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(logs.Token) != tokenLength || logs.Token == service.Token {
+		t.Fatalf("unexpected token value %q", logs.Token)
+	}
+	expiresAt := time.Now().Add(-time.Second)
+	expired, err := CreateServiceToken(ctx, clientset, service, "old", []string{types.ServiceTokenScopeInvokeAsync}, &expiresAt)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Only the hashes of the tokens are stored
+	secret, err := clientset.CoreV1().Secrets("oscar-svc").Get(ctx, ServiceTokensSecretName("svc"), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected the secret of the tokens: %v", err)
+	}
+	for _, value := range secret.Data {
+		if strings.Contains(string(value), logs.Token) {
+			t.Fatalf("the value of the token is stored in the secret")
+		}
+	}
+
+	scenarios := []struct {
+		name  string
+		token string
+		scope string
+		match bool
+	}{
+		{"primary token", testPrimaryToken, types.ServiceTokenScopeInvokeSync, true},
+		{"named token with the scope", logs.Token, types.ServiceTokenScopeReadLogs, true},
+		{"named token without the scope", logs.Token, types.ServiceTokenScopeInvokeSync, false},
+		{"expired token", expired.Token, types.ServiceTokenScopeInvokeAsync, false},
+		{"unknown token", strings.Repeat("a", tokenLength), types.ServiceTokenScopeReadLogs, false},
+	}
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			if match := MatchServiceToken(ctx, clientset, service, s.token, s.scope); match != s.match {
+				t.Errorf("expected match %v, got %v", s.match, match)
+			}
+		})
+	}
+
+	waitServiceTokenUses()
+	tokens, err := ListServiceTokens(ctx, clientset, service)
+	if err != nil {
+		t.Fatalf("unexpected error listing the tokens: %v", err)
+	}
+	if len(tokens) != 2 || tokens[0].ID != types.PrimaryServiceTokenID || tokens[1].ID != logs.ID {
+		t.Fatalf("unexpected tokens: %+v", tokens)
+	}
+	for _, token := range tokens {
+		if token.LastUsedAt == nil {
+			t.Errorf("expected the last use of token %s to be recorded", token.ID)
+		}
+		if token.Token != "" {
+			t.Errorf("listed tokens must not carry their value")
+		}
+	}
+
+	if err := DeleteServiceToken(ctx, clientset, service, logs.ID); err != nil {
+		t.Fatalf("unexpected error revoking the token: %v", err)
+	}
+	if MatchServiceToken(ctx, clientset, service, logs.Token, types.ServiceTokenScopeReadLogs) {
+		t.Errorf("expected the revoked token to be rejected")
+	}
+	if err := DeleteServiceToken(ctx, clientset, service, logs.ID); !apierrors.IsNotFound(err) {
+		t.Errorf("expected NotFound revoking a revoked token, got %v", err)
+	}
+}
+
+func TestServiceTokenRotation(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset()
+	service := &types.Service{Name: "svc", Namespace: "oscar-svc", Token: testPrimaryToken}
+
+	if !MatchServiceToken(ctx, clientset, service, testPrimaryToken, types.ServiceTokenScopeInvokeSync) {
+		t.Fatalf("expected the primary token to match")
+	}
+	service.Token = strings.Repeat("b", tokenLength)
+	waitServiceTokenUses()
+	if err := RecordServiceTokenRotation(ctx, clientset, service, testPrimaryToken, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !MatchServiceToken(ctx, clientset, service, testPrimaryToken, types.ServiceTokenScopeExposedAccess) {
+		t.Errorf("expected the previous token to match during the grace period")
+	}
+	if !MatchServiceToken(ctx, clientset, service, service.Token, types.ServiceTokenScopeExposedAccess) {
+		t.Errorf("expected the new token to match")
+	}
+
+	waitServiceTokenUses()
+	tokens, err := ListServiceTokens(ctx, clientset, service)
+	if err != nil {
+		t.Fatalf("unexpected error listing the tokens: %v", err)
+	}
+	if len(tokens) != 2 || tokens[0].ID != types.PrimaryServiceTokenID || tokens[1].ID != types.GraceServiceTokenID {
+		t.Fatalf("unexpected tokens: %+v", tokens)
+	}
+	if tokens[0].CreatedAt == nil || tokens[1].ExpiresAt == nil || tokens[1].LastUsedAt == nil {
+		t.Errorf("unexpected rotated tokens: %+v", tokens)
+	}
+
+	// A new rotation without grace period revokes the previous tokens
+	previous := service.Token
+	service.Token = strings.Repeat("c", tokenLength)
+	waitServiceTokenUses()
+	if err := RecordServiceTokenRotation(ctx, clientset, service, previous, time.Now()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, token := range []string{testPrimaryToken, previous} {
+		if MatchServiceToken(ctx, clientset, service, token, types.ServiceTokenScopeInvokeSync) {
+			t.Errorf("expected the token %s to be revoked", token)
+		}
+	}
+}
+
+func TestBuildScopedServiceTokenMiddlewareChain(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	service := &types.Service{Name: "svc", Namespace: "oscar-svc", Token: testPrimaryToken}
+	back := &serviceTokenMockBackend{
+		listServicesByNameResult: []*types.Service{service},
+		kubeClientset:            clientset,
+	}
+
+	logs, err := CreateServiceToken(context.Background(), clientset, service, "logs", []string{types.ServiceTokenScopeReadLogs}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	invoke, err := CreateServiceToken(context.Background(), clientset, service, "invoke", []string{types.ServiceTokenScopeInvokeSync}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	userAuth := func(c *gin.Context) {
+		c.AbortWithStatus(http.StatusTeapot)
+	}
+	r := gin.New()
+	r.GET("/system/logs/:serviceName", append(BuildScopedServiceTokenMiddlewareChain(back, userAuth, types.ServiceTokenScopeReadLogs), func(c *gin.Context) {
+		if !IsServiceTokenRequest(c) {
+			t.Errorf("expected the request to be authenticated with a service token")
+		}
+		c.Status(http.StatusOK)
+	})...)
+
+	scenarios := []struct {
+		name          string
+		authorization string
+		code          int
+	}{
+		{"token with the scope", "Bearer " + logs.Token, http.StatusOK},
+		{"primary token", "Bearer " + testPrimaryToken, http.StatusOK},
+		{"token without the scope", "Bearer " + invoke.Token, http.StatusUnauthorized},
+		{"user credentials", "Bearer oidc-token", http.StatusTeapot},
+	}
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/system/logs/svc", nil)
+			req.Header.Set("Authorization", s.authorization)
+			r.ServeHTTP(w, req)
+			if w.Code != s.code {
+				t.Errorf("expected %d, got %d", s.code, w.Code)
+			}
+		})
+	}
+}
+
+func TestServiceTokensSecretDoesNotCollideWithServiceSecret(t *testing.T) {
+	ctx := context.Background()
+	// Secret with the environment secrets of a service called "svc-tokens"
+	clientset := fake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "svc-tokens", Namespace: "oscar-svc"},
+		Data:       map[string][]byte{"API_KEY": []byte("value")},
+	})
+	service := &types.Service{Name: "svc", Namespace: "oscar-svc", Token: "primary"}
+
+	if _, err := CreateServiceToken(ctx, clientset, service, "ci", []string{types.ServiceTokenScopeInvokeSync}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	secret, err := clientset.CoreV1().Secrets("oscar-svc").Get(ctx, "svc-tokens", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(secret.Data) != 1 || string(secret.Data["API_KEY"]) != "value" {
+		t.Errorf("the secret of another service was modified: %v", secret.Data)
+	}
+}
+
+func TestFindServiceByToken(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset()
+	first := &types.Service{Name: "svc", Namespace: "ns1", Token: testPrimaryToken}
+	second := &types.Service{Name: "svc", Namespace: "ns2", Token: strings.Repeat("b", tokenLength)}
+	named, err := CreateServiceToken(ctx, clientset, second, "ci", []string{types.ServiceTokenScopeInvokeSync}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	waitServiceTokenUses()
+
+	// The primary tokens are matched without reading the stored tokens
+	clientset.ClearActions()
+	if service := FindServiceByToken(ctx, clientset, []*types.Service{first, second}, second.Token, types.ServiceTokenScopeInvokeSync); service != second {
+		t.Errorf("expected the service of the primary token, got %+v", service)
+	}
+	if service := FindServiceByToken(ctx, clientset, []*types.Service{first, second}, second.Token, types.ServiceTokenScopeInvokeSync); service != second {
+		t.Errorf("expected the service of the primary token, got %+v", service)
+	}
+	waitServiceTokenUses()
+	updates := 0
+	for _, action := range clientset.Actions() {
+		if action.GetVerb() == "update" {
+			updates++
+		}
+	}
+	if updates != 1 {
+		t.Errorf("expected a single use to be recorded, got %d updates", updates)
+	}
+
+	if service := FindServiceByToken(ctx, clientset, []*types.Service{first, second}, named.Token, types.ServiceTokenScopeInvokeSync); service != second {
+		t.Errorf("expected the service of the named token, got %+v", service)
+	}
+	if service := FindServiceByToken(ctx, clientset, []*types.Service{first, second}, named.Token, types.ServiceTokenScopeInvokeAsync); service != nil {
+		t.Errorf("expected no service for a scope not granted, got %+v", service)
+	}
+	waitServiceTokenUses()
+}
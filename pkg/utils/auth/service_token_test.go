@@ -34,6 +34,7 @@ type serviceTokenMockBackend struct {
 	listServicesByNameResult []*types.Service
 	listServicesByNameErr    error
 	listServicesByNameCalled bool
+	kubeClientset            kubernetes.Interface
 }
 
 func (m *serviceTokenMockBackend) GetInfo() *types.ServerlessBackendInfo {
@@ -66,7 +67,7 @@ func (m *serviceTokenMockBackend) DeleteService(service types.Service) error {
 }
 
 func (m *serviceTokenMockBackend) GetKubeClientset() kubernetes.Interface {
-	return nil
+	return m.kubeClientset
 }
 
 func TestGetServiceTokenMiddleware(t *testing.T) {
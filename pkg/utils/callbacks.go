@@ -0,0 +1,123 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/grycap/oscar/v4/pkg/types"
+)
+
+// callbackAttempts number of attempts to deliver a callback notification
+const callbackAttempts = 4
+
+var (
+	// callbackClient HTTP client used to send the callback notifications, refusing to connect to internal addresses
+	callbackClient = &http.Client{
+		Timeout: 20 * time.Second,
+		Transport: &http.Transport{
+			DialContext: (&net.Dialer{Timeout: 10 * time.Second, Control: dialPublicAddress}).DialContext,
+		},
+	}
+	// allowedCallbackClient HTTP client used to send the callback notifications to the allowed hosts
+	allowedCallbackClient = &http.Client{Timeout: 20 * time.Second}
+	// callbackBackoff delay before the first retry of a callback notification, doubled on every retry
+	callbackBackoff = 2 * time.Second
+)
+
+// SignCallback returns the value of the signature header of a callback notification,
+// the hex encoded HMAC-SHA256 of the body keyed with the service token
+func SignCallback(token string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(token))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// errCallbackAddressNotAllowed the callback host resolves to an internal address
+var errCallbackAddressNotAllowed = errors.New("the callback address is not allowed")
+
+// dialPublicAddress rejects the connections to the addresses where the callbacks are not allowed,
+// checked after resolving the host so the DNS records can't point the callbacks to the cluster
+func dialPublicAddress(_ string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !types.CallbackAddressAllowed(ip) {
+		return fmt.Errorf("%w: %s", errCallbackAddressNotAllowed, host)
+	}
+	return nil
+}
+
+// SendCallback posts the signed JSON notification to the callback URL, retrying with
+// exponential backoff on connection errors and 5xx or 429 responses. Only the allowed
+// hosts can resolve to internal addresses.
+func SendCallback(ctx context.Context, callbackURL string, allowedHosts []string, deliveryID string, token string, body []byte) error {
+	client := callbackClient
+	if u, err := url.Parse(callbackURL); err == nil && slices.Contains(allowedHosts, strings.ToLower(u.Hostname())) {
+		client = allowedCallbackClient
+	}
+	backoff := callbackBackoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		var retry bool
+		if retry, err = postCallback(ctx, client, callbackURL, deliveryID, token, body); err == nil || !retry || attempt == callbackAttempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// postCallback sends the notification once, returning whether a failed delivery may be retried
+func postCallback(ctx context.Context, client *http.Client, callbackURL string, deliveryID string, token string, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, callbackURL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(types.CallbackDeliveryHeader, deliveryID)
+	req.Header.Set(types.CallbackSignatureHeader, SignCallback(token, body))
+
+	res, err := client.Do(req)
+	if err != nil {
+		return !errors.Is(err, errCallbackAddressNotAllowed), fmt.Errorf("error sending callback to \"%s\": %w", callbackURL, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		retry := res.StatusCode >= 500 || res.StatusCode == http.StatusTooManyRequests
+		return retry, fmt.Errorf("error sending callback to \"%s\": returned status %d", callbackURL, res.StatusCode)
+	}
+	return false, nil
+}
@@ -0,0 +1,106 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/grycap/oscar/v4/pkg/testsupport"
+	"github.com/grycap/oscar/v4/pkg/types"
+)
+
+func TestSignCallback(t *testing.T) {
+	// echo -n '{"status":"Succeeded"}' | openssl dgst -sha256 -hmac token
+	expected := "sha256=f46a6f09450fe41fe76e9e22109bd41adc470b74141b3039c7455742da0bb209"
+	if got := SignCallback("token", []byte(`{"status":"Succeeded"}`)); got != expected {
+		t.Errorf("expected signature %s, got %s", expected, got)
+	}
+}
+
+func TestSendCallback(t *testing.T) {
+	testsupport.SkipIfCannotListen(t)
+
+	defer func(backoff time.Duration) { callbackBackoff = backoff }(callbackBackoff)
+	callbackBackoff = time.Millisecond
+
+	attempts := 0
+	var header http.Header
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		attempts++
+		if attempts < 3 {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		header = req.Header
+		body, _ = io.ReadAll(req.Body)
+		rw.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	payload := []byte(`{"job_name":"job"}`)
+	if err := SendCallback(context.Background(), server.URL, []string{"127.0.0.1"}, "uid", "token", payload); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d", attempts)
+	}
+	if string(body) != string(payload) || header.Get("Content-Type") != "application/json" || header.Get(types.CallbackDeliveryHeader) != "uid" {
+		t.Errorf("unexpected notification %s with headers %v", body, header)
+	}
+	if header.Get(types.CallbackSignatureHeader) != SignCallback("token", payload) {
+		t.Errorf("unexpected signature %s", header.Get(types.CallbackSignatureHeader))
+	}
+}
+
+func TestSendCallbackErrors(t *testing.T) {
+	testsupport.SkipIfCannotListen(t)
+
+	defer func(backoff time.Duration) { callbackBackoff = backoff }(callbackBackoff)
+	callbackBackoff = time.Millisecond
+
+	attempts := 0
+	status := http.StatusBadRequest
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		attempts++
+		rw.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	// Client errors are not retried
+	if err := SendCallback(context.Background(), server.URL, []string{"127.0.0.1"}, "uid", "token", nil); err == nil || attempts != 1 {
+		t.Errorf("expected a single failed attempt, got %d attempts and error %v", attempts, err)
+	}
+
+	attempts = 0
+	status = http.StatusInternalServerError
+	if err := SendCallback(context.Background(), server.URL, []string{"127.0.0.1"}, "uid", "token", nil); err == nil || attempts != callbackAttempts {
+		t.Errorf("expected %d failed attempts, got %d attempts and error %v", callbackAttempts, attempts, err)
+	}
+
+	// Internal addresses are refused unless their host is allowed, without retrying
+	attempts = 0
+	if err := SendCallback(context.Background(), server.URL, nil, "uid", "token", nil); !errors.Is(err, errCallbackAddressNotAllowed) || attempts != 0 {
+		t.Errorf("expected the internal address to be refused, got %d attempts and error %v", attempts, err)
+	}
+}
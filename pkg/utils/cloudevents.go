@@ -0,0 +1,231 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/grycap/oscar/v4/pkg/types"
+)
+
+const (
+	// CloudEventsContentType media type of the CloudEvents in structured mode
+	CloudEventsContentType = "application/cloudevents+json"
+	// CloudEventsBatchContentType media type of the CloudEvents in batched mode (not supported)
+	CloudEventsBatchContentType = "application/cloudevents-batch+json"
+	// CloudEventHeaderPrefix prefix of the headers with the attributes of the CloudEvents in binary mode
+	CloudEventHeaderPrefix = "Ce-"
+)
+
+// cloudEventsClient HTTP client used to send CloudEvents, replaceable in tests
+var cloudEventsClient = &http.Client{Timeout: 20 * time.Second}
+
+// IsStructuredCloudEvent returns true if the request carries a CloudEvent in structured mode
+func IsStructuredCloudEvent(header http.Header) bool {
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	return err == nil && mediaType == CloudEventsContentType
+}
+
+// ParseCloudEvent returns the CloudEvent of an HTTP request in binary or structured mode,
+// or nil if the request is not a CloudEvent
+func ParseCloudEvent(header http.Header, body []byte) (*types.CloudEvent, error) {
+	var ce *types.CloudEvent
+	var specVersion string
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	switch {
+	case mediaType == CloudEventsBatchContentType:
+		return nil, fmt.Errorf("batched CloudEvents are not supported")
+	case mediaType == CloudEventsContentType:
+		var err error
+		if ce, specVersion, err = parseStructuredCloudEvent(body); err != nil {
+			return nil, err
+		}
+	case header.Get(CloudEventHeaderPrefix+"Specversion") != "":
+		ce, specVersion = parseBinaryCloudEvent(header, body)
+	default:
+		return nil, nil
+	}
+
+	if specVersion != types.CloudEventsSpecVersion {
+		return nil, fmt.Errorf("unsupported CloudEvents specversion \"%s\"", specVersion)
+	}
+	if ce.ID == "" || ce.Source == "" || ce.Type == "" {
+		return nil, fmt.Errorf("the CloudEvent must have the id, source and type attributes")
+	}
+	for name := range ce.Extensions {
+		if !validCloudEventAttributeName(name) {
+			return nil, fmt.Errorf("invalid CloudEvent attribute name \"%s\"", name)
+		}
+	}
+	return ce, nil
+}
+
+// parseBinaryCloudEvent reads the attributes of the event from the Ce-* headers and its data from the body
+func parseBinaryCloudEvent(header http.Header, body []byte) (*types.CloudEvent, string) {
+	attrs := map[string]string{}
+	for key, values := range header {
+		name, ok := strings.CutPrefix(http.CanonicalHeaderKey(key), CloudEventHeaderPrefix)
+		if !ok || len(values) == 0 {
+			continue
+		}
+		value, err := url.PathUnescape(values[0])
+		if err != nil {
+			value = values[0]
+		}
+		attrs[strings.ToLower(name)] = value
+	}
+	if contentType := header.Get("Content-Type"); contentType != "" {
+		attrs["datacontenttype"] = contentType
+	}
+	ce, specVersion := newCloudEvent(attrs)
+	ce.Data = body
+	return ce, specVersion
+}
+
+// parseStructuredCloudEvent decodes an event in the JSON event format
+func parseStructuredCloudEvent(body []byte) (*types.CloudEvent, string, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, "", fmt.Errorf("invalid structured CloudEvent: %v", err)
+	}
+	attrs := map[string]string{}
+	for name, raw := range fields {
+		if name == "data" || name == "data_base64" {
+			continue
+		}
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			// Extensions can also be booleans or integers
+			value = string(raw)
+		}
+		attrs[name] = value
+	}
+	ce, specVersion := newCloudEvent(attrs)
+
+	if raw, ok := fields["data_base64"]; ok {
+		var encoded string
+		if err := json.Unmarshal(raw, &encoded); err != nil {
+			return nil, "", fmt.Errorf("invalid data_base64 of the CloudEvent: %v", err)
+		}
+		data, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid data_base64 of the CloudEvent: %v", err)
+		}
+		ce.Data = data
+	} else if raw, ok := fields["data"]; ok {
+		ce.Data = raw
+		// The data of non JSON media types is encoded as a JSON string
+		if ce.DataContentType != "" && !isJSONMediaType(ce.DataContentType) {
+			var data string
+			if err := json.Unmarshal(raw, &data); err == nil {
+				ce.Data = []byte(data)
+			}
+		}
+	}
+	return ce, specVersion, nil
+}
+
+// newCloudEvent builds an event from its attributes, returning also its specversion
+func newCloudEvent(attrs map[string]string) (*types.CloudEvent, string) {
+	ce := &types.CloudEvent{
+		ID:              attrs["id"],
+		Source:          attrs["source"],
+		Type:            attrs["type"],
+		Subject:         attrs["subject"],
+		Time:            attrs["time"],
+		DataContentType: attrs["datacontenttype"],
+		DataSchema:      attrs["dataschema"],
+	}
+	specVersion := attrs["specversion"]
+	for _, name := range []string{"specversion", "id", "source", "type", "subject", "time", "datacontenttype", "dataschema"} {
+		delete(attrs, name)
+	}
+	if len(attrs) > 0 {
+		ce.Extensions = attrs
+	}
+	return ce, specVersion
+}
+
+// validCloudEventAttributeName checks that the name only has lower-case letters and digits
+func validCloudEventAttributeName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+func isJSONMediaType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == "application/json" || mediaType == "text/json" || strings.HasSuffix(mediaType, "+json"))
+}
+
+// SetCloudEventHeaders sets the attributes of the event as Ce-* headers (binary mode)
+func SetCloudEventHeaders(header http.Header, ce *types.CloudEvent) {
+	header.Set(CloudEventHeaderPrefix+"Specversion", types.CloudEventsSpecVersion)
+	for name, value := range ce.Attributes() {
+		if name == "datacontenttype" {
+			header.Set("Content-Type", value)
+			continue
+		}
+		header.Set(CloudEventHeaderPrefix+name, encodeCloudEventHeader(value))
+	}
+}
+
+// encodeCloudEventHeader percent-encodes the characters not allowed in the values of the Ce-* headers
+func encodeCloudEventHeader(value string) string {
+	var sb strings.Builder
+	for _, b := range []byte(value) {
+		if b <= ' ' || b > '~' || b == '"' || b == '%' {
+			fmt.Fprintf(&sb, "%%%02X", b)
+		} else {
+			sb.WriteByte(b)
+		}
+	}
+	return sb.String()
+}
+
+// SendCloudEvent sends the event in binary mode to the sink URL
+func SendCloudEvent(ctx context.Context, sink string, ce *types.CloudEvent) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sink, bytes.NewReader(ce.Data))
+	if err != nil {
+		return err
+	}
+	SetCloudEventHeaders(req.Header, ce)
+	res, err := cloudEventsClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending CloudEvent \"%s\": %v", ce.ID, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("error sending CloudEvent \"%s\": sink returned status %d", ce.ID, res.StatusCode)
+	}
+	return nil
+}
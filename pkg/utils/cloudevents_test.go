@@ -0,0 +1,148 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/grycap/oscar/v4/pkg/testsupport"
+	"github.com/grycap/oscar/v4/pkg/types"
+)
+
+func TestParseCloudEventBinary(t *testing.T) {
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set("Ce-Specversion", "1.0")
+	header.Set("Ce-Id", "1")
+	header.Set("Ce-Source", "/brokers/default")
+	header.Set("Ce-Type", "dev.knative.example")
+	header.Set("Ce-Subject", "hello%20world")
+	header.Set("Ce-Traceparent", "00-abc")
+
+	ce, err := ParseCloudEvent(header, []byte(`{"key":"value"}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ce.ID != "1" || ce.Source != "/brokers/default" || ce.Type != "dev.knative.example" || ce.Subject != "hello world" {
+		t.Errorf("unexpected event: %+v", ce)
+	}
+	if ce.DataContentType != "application/json" || string(ce.Data) != `{"key":"value"}` || ce.Extensions["traceparent"] != "00-abc" {
+		t.Errorf("unexpected event: %+v", ce)
+	}
+}
+
+func TestParseCloudEventStructured(t *testing.T) {
+	header := http.Header{}
+	header.Set("Content-Type", "application/cloudevents+json; charset=utf-8")
+
+	tests := []struct {
+		body string
+		data string
+	}{
+		{`{"specversion":"1.0","id":"1","source":"src","type":"t","data":{"key":"value"}}`, `{"key":"value"}`},
+		{`{"specversion":"1.0","id":"1","source":"src","type":"t","datacontenttype":"text/plain","data":"text"}`, "text"},
+		{`{"specversion":"1.0","id":"1","source":"src","type":"t","data_base64":"aGVsbG8="}`, "hello"},
+	}
+	for _, tc := range tests {
+		ce, err := ParseCloudEvent(header, []byte(tc.body))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if string(ce.Data) != tc.data {
+			t.Errorf("expected data %q, got %q", tc.data, ce.Data)
+		}
+	}
+
+	ce, err := ParseCloudEvent(header, []byte(`{"specversion":"1.0","id":"1","source":"src","type":"t","priority":3}`))
+	if err != nil || ce.Extensions["priority"] != "3" {
+		t.Errorf("unexpected event %+v: %v", ce, err)
+	}
+}
+
+func TestParseCloudEventErrors(t *testing.T) {
+	if ce, err := ParseCloudEvent(http.Header{}, []byte(`{"key":"value"}`)); ce != nil || err != nil {
+		t.Errorf("expected no event for plain requests, got %+v: %v", ce, err)
+	}
+
+	structured := http.Header{}
+	structured.Set("Content-Type", CloudEventsContentType)
+	batch := http.Header{}
+	batch.Set("Content-Type", CloudEventsBatchContentType)
+	binary := http.Header{}
+	binary.Set("Ce-Specversion", "1.0")
+	binary.Set("Ce-Id", "1")
+	binary.Set("Ce-Source", "src")
+	binary.Set("Ce-Type", "t")
+	binary.Set("Ce-Invalid-Name", "value")
+
+	tests := []struct {
+		header http.Header
+		body   string
+	}{
+		{structured, `not json`},
+		{structured, `{"specversion":"0.3","id":"1","source":"src","type":"t"}`},
+		{structured, `{"specversion":"1.0","source":"src","type":"t"}`},
+		{structured, `{"specversion":"1.0","id":"1","source":"src","type":"t","data_base64":"%%%"}`},
+		{batch, `[]`},
+		{binary, ``},
+	}
+	for _, tc := range tests {
+		if _, err := ParseCloudEvent(tc.header, []byte(tc.body)); err == nil {
+			t.Errorf("expected error parsing %q with headers %v", tc.body, tc.header)
+		}
+	}
+}
+
+func TestSendCloudEvent(t *testing.T) {
+	testsupport.SkipIfCannotListen(t)
+
+	var received *types.CloudEvent
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		var err error
+		if received, err = ParseCloudEvent(req.Header, body); err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		rw.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	ce := &types.CloudEvent{
+		ID:              "1",
+		Source:          "/oscar/services/svc",
+		Type:            types.JobFinishedCloudEventType,
+		Subject:         "job \"1\" 100%",
+		DataContentType: "application/json",
+		Extensions:      map[string]string{"oscarstatus": "Succeeded"},
+		Data:            []byte(`{"status":"Succeeded"}`),
+	}
+	if err := SendCloudEvent(context.Background(), server.URL, ce); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if received == nil || received.Subject != ce.Subject || received.Extensions["oscarstatus"] != "Succeeded" || string(received.Data) != string(ce.Data) {
+		t.Errorf("unexpected event received: %+v", received)
+	}
+
+	if err := SendCloudEvent(context.Background(), server.URL, &types.CloudEvent{ID: "1"}); err == nil {
+		t.Errorf("expected error when the sink rejects the event")
+	}
+}
@@ -0,0 +1,302 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/grycap/oscar/v4/pkg/types"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// EventStoreSecret kind of the events stored in a Secret
+	EventStoreSecret = "secret"
+	// EventStoreMinIO kind of the events stored in a MinIO object
+	EventStoreMinIO = "minio"
+
+	// maxSecretEventSize maximum size of the events stored in a Secret (the data of a Secret is limited to 1MiB)
+	maxSecretEventSize   = 1000 * 1024
+	jobEventSecretSuffix = "-event"
+	// jobEventPruneInterval interval between the removals of the events of the deleted jobs
+	jobEventPruneInterval = 10 * time.Minute
+	// jobEventPruneGrace age of the stored events before they can be removed, as they are stored before creating their jobs
+	jobEventPruneGrace = 10 * time.Minute
+)
+
+var jobEventLogger = log.New(os.Stdout, "[JOB-EVENTS] ", log.Flags())
+
+// ErrJobEventNotFound error reading a stored event that has already been deleted
+var ErrJobEventNotFound = errors.New("the event of the job is no longer stored")
+
+// makeEventS3Client returns the S3 client of the events stored in MinIO, replaceable in tests
+var makeEventS3Client = func(cfg *types.Config) s3iface.S3API {
+	return cfg.MinIOProvider.GetS3Client()
+}
+
+// grantJobEventsAccess lets the MinIO user of the owner read its events, replaceable in tests
+var grantJobEventsAccess = func(cfg *types.Config, owner string) error {
+	minIOAdminClient, err := MakeMinIOAdminClient(cfg)
+	if err != nil {
+		return err
+	}
+	prefix := path.Join(cfg.EventBucket, owner)
+	if minIOAdminClient.ResourceInPolicy(owner, prefix) {
+		return nil
+	}
+	return minIOAdminClient.CreateAddPolicy(prefix, owner, ALL_ACTIONS, false)
+}
+
+// EventReference location of a job event stored outside the job definition.
+// It is encoded as "secret:<name>" or "minio:<bucket>/<key>" in the EVENT_REF variable of the job.
+// The keys of the events stored in MinIO are "<owner>/<namespace>/<job>".
+type EventReference struct {
+	Kind string
+	// Path name of the Secret or "<bucket>/<key>" of the MinIO object
+	Path string
+}
+
+// String returns the encoded reference
+func (ref EventReference) String() string {
+	return ref.Kind + ":" + ref.Path
+}
+
+// ParseEventReference decodes a reference returned by EventReference.String
+func ParseEventReference(value string) (*EventReference, error) {
+	kind, refPath, _ := strings.Cut(value, ":")
+	switch {
+	case refPath == "":
+	case kind == EventStoreSecret:
+		return &EventReference{Kind: kind, Path: refPath}, nil
+	case kind == EventStoreMinIO && strings.Contains(refPath, "/"):
+		return &EventReference{Kind: kind, Path: refPath}, nil
+	}
+	return nil, fmt.Errorf("invalid event reference \"%s\"", value)
+}
+
+// IsLargeEvent returns true if the event exceeds the size that can be passed in an environment variable
+func IsLargeEvent(cfg *types.Config, event []byte) bool {
+	return cfg.EventSizeThreshold > 0 && len(event) > cfg.EventSizeThreshold
+}
+
+// JobEventSecretName returns the name of the Secret with the event of a job
+func JobEventSecretName(jobName string) string {
+	return jobName + jobEventSecretSuffix
+}
+
+// StoreJobEvent stores the event of a job in a Secret or, if too large for a Secret, in the EventBucket of MinIO.
+// The events stored in MinIO are readable with the MinIO credentials of the service owner.
+func StoreJobEvent(ctx context.Context, cfg *types.Config, kubeClientset kubernetes.Interface, namespace string, jobName string, serviceName string, owner string, event []byte) (*EventReference, error) {
+	if len(event) <= maxSecretEventSize {
+		secret := &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      JobEventSecretName(jobName),
+				Namespace: namespace,
+				Labels:    map[string]string{types.ServiceLabel: serviceName},
+			},
+			Data: map[string][]byte{types.EventFileName: event},
+		}
+		if _, err := kubeClientset.CoreV1().Secrets(namespace).Create(ctx, secret, metav1.CreateOptions{}); err != nil {
+			return nil, fmt.Errorf("error storing the event of job \"%s\": %v", jobName, err)
+		}
+		return &EventReference{Kind: EventStoreSecret, Path: secret.Name}, nil
+	}
+
+	if cfg.MinIOProvider == nil {
+		return nil, fmt.Errorf("the event of job \"%s\" is too large to be stored in a Secret and MinIO is not available", jobName)
+	}
+	if owner == "" {
+		owner = types.DefaultOwner
+	}
+	if owner != types.DefaultOwner {
+		if err := grantJobEventsAccess(cfg, owner); err != nil {
+			return nil, fmt.Errorf("error granting access to the event of job \"%s\": %v", jobName, err)
+		}
+	}
+	key := path.Join(owner, namespace, jobName)
+	_, err := makeEventS3Client(cfg).PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(cfg.EventBucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(event),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error storing the event of job \"%s\" in MinIO: %v", jobName, err)
+	}
+	return &EventReference{Kind: EventStoreMinIO, Path: path.Join(cfg.EventBucket, key)}, nil
+}
+
+// ReadJobEvent returns the stored event of a job
+func ReadJobEvent(ctx context.Context, cfg *types.Config, kubeClientset kubernetes.Interface, namespace string, ref EventReference) ([]byte, error) {
+	if ref.Kind == EventStoreSecret {
+		secret, err := kubeClientset.CoreV1().Secrets(namespace).Get(ctx, ref.Path, metav1.GetOptions{})
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				return nil, ErrJobEventNotFound
+			}
+			return nil, err
+		}
+		return secret.Data[types.EventFileName], nil
+	}
+
+	if cfg.MinIOProvider == nil {
+		return nil, fmt.Errorf("MinIO is not available to read the event %s", ref)
+	}
+	bucket, key, _ := strings.Cut(ref.Path, "/")
+	out, err := makeEventS3Client(cfg).GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+			return nil, ErrJobEventNotFound
+		}
+		return nil, err
+	}
+	defer out.Body.Close()
+	return io.ReadAll(out.Body)
+}
+
+// DeleteJobEvent deletes the stored event of a job, doing nothing if it does not exist
+func DeleteJobEvent(ctx context.Context, cfg *types.Config, kubeClientset kubernetes.Interface, namespace string, ref EventReference) error {
+	if ref.Kind == EventStoreSecret {
+		err := kubeClientset.CoreV1().Secrets(namespace).Delete(ctx, ref.Path, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+		return nil
+	}
+
+	if cfg.MinIOProvider == nil {
+		return nil
+	}
+	bucket, key, _ := strings.Cut(ref.Path, "/")
+	_, err := makeEventS3Client(cfg).DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+// SetJobEventOwner makes the job the owner of the Secret with its event, so it is deleted with the job
+func SetJobEventOwner(ctx context.Context, kubeClientset kubernetes.Interface, ref EventReference, job *batchv1.Job) error {
+	if ref.Kind != EventStoreSecret {
+		return nil
+	}
+	secret, err := kubeClientset.CoreV1().Secrets(job.Namespace).Get(ctx, ref.Path, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	secret.OwnerReferences = append(secret.OwnerReferences, *metav1.NewControllerRef(job, batchv1.SchemeGroupVersion.WithKind("Job")))
+	_, err = kubeClientset.CoreV1().Secrets(job.Namespace).Update(ctx, secret, metav1.UpdateOptions{})
+	return err
+}
+
+// EnsureEventBucket creates the bucket of the events stored in MinIO if it does not exist
+func EnsureEventBucket(ctx context.Context, cfg *types.Config) error {
+	if cfg.EventSizeThreshold <= 0 || cfg.MinIOProvider == nil {
+		return nil
+	}
+	return ensureBucket(ctx, makeEventS3Client(cfg), cfg.EventBucket)
+}
+
+// PruneJobEvents removes the events stored in MinIO whose jobs have been deleted, returning how many were removed.
+// The Secrets with the events are deleted with their jobs.
+func PruneJobEvents(ctx context.Context, cfg *types.Config, kubeClientset kubernetes.Interface) (int, error) {
+	if cfg.MinIOProvider == nil {
+		return 0, nil
+	}
+	s3Client := makeEventS3Client(cfg)
+	var orphaned []string
+	input := &s3.ListObjectsV2Input{Bucket: aws.String(cfg.EventBucket)}
+	err := s3Client.ListObjectsV2PagesWithContext(ctx, input, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, object := range page.Contents {
+			key := aws.StringValue(object.Key)
+			if time.Since(aws.TimeValue(object.LastModified)) < jobEventPruneGrace {
+				continue
+			}
+			elems := strings.Split(key, "/")
+			if len(elems) < 2 {
+				continue
+			}
+			namespace, jobName := elems[len(elems)-2], elems[len(elems)-1]
+			_, err := kubeClientset.BatchV1().Jobs(namespace).Get(ctx, jobName, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) {
+				orphaned = append(orphaned, key)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+	for i, key := range orphaned {
+		if err := DeleteJobEvent(ctx, cfg, kubeClientset, "", EventReference{Kind: EventStoreMinIO, Path: path.Join(cfg.EventBucket, key)}); err != nil {
+			return i, err
+		}
+	}
+	return len(orphaned), nil
+}
+
+// StartJobEventPruner periodically removes the events stored in MinIO of the deleted jobs
+func StartJobEventPruner(ctx context.Context, cfg *types.Config, kubeClientset kubernetes.Interface) {
+	for {
+		pruned, err := PruneJobEvents(ctx, cfg, kubeClientset)
+		if err != nil {
+			jobEventLogger.Printf("Error removing the events of the deleted jobs: %v", err)
+		} else if pruned > 0 {
+			jobEventLogger.Printf("Removed the events of %d deleted jobs", pruned)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(jobEventPruneInterval):
+		}
+	}
+}
+
+// ensureBucket creates the bucket if it does not exist
+func ensureBucket(ctx context.Context, s3Client s3iface.S3API, bucket string) error {
+	_, err := s3Client.HeadBucketWithContext(ctx, &s3.HeadBucketInput{Bucket: aws.String(bucket)})
+	if err == nil {
+		return nil
+	}
+	_, err = s3Client.CreateBucketWithContext(ctx, &s3.CreateBucketInput{Bucket: aws.String(bucket)})
+	if aerr, ok := err.(awserr.Error); ok && (aerr.Code() == s3.ErrCodeBucketAlreadyExists || aerr.Code() == s3.ErrCodeBucketAlreadyOwnedByYou) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error creating bucket \"%s\": %v", bucket, err)
+	}
+	return nil
+}
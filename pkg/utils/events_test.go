@@ -0,0 +1,209 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/grycap/oscar/v4/pkg/types"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// fakeEventS3 in-memory S3 client storing objects by "bucket/key"
+type fakeEventS3 struct {
+	s3iface.S3API
+	objects  map[string][]byte
+	modified map[string]time.Time
+}
+
+func (f *fakeEventS3) PutObjectWithContext(_ aws.Context, input *s3.PutObjectInput, _ ...request.Option) (*s3.PutObjectOutput, error) {
+	data, _ := io.ReadAll(input.Body)
+	f.objects[*input.Bucket+"/"+*input.Key] = data
+	f.modified[*input.Bucket+"/"+*input.Key] = time.Now()
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (f *fakeEventS3) ListObjectsV2PagesWithContext(_ aws.Context, input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool, _ ...request.Option) error {
+	page := &s3.ListObjectsV2Output{}
+	for object := range f.objects {
+		if key, ok := strings.CutPrefix(object, *input.Bucket+"/"); ok {
+			page.Contents = append(page.Contents, &s3.Object{Key: aws.String(key), LastModified: aws.Time(f.modified[object])})
+		}
+	}
+	fn(page, true)
+	return nil
+}
+
+func (f *fakeEventS3) GetObjectWithContext(_ aws.Context, input *s3.GetObjectInput, _ ...request.Option) (*s3.GetObjectOutput, error) {
+	object, ok := f.objects[*input.Bucket+"/"+*input.Key]
+	if !ok {
+		return nil, awserr.New(s3.ErrCodeNoSuchKey, "not found", nil)
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(object))}, nil
+}
+
+func (f *fakeEventS3) DeleteObjectWithContext(_ aws.Context, input *s3.DeleteObjectInput, _ ...request.Option) (*s3.DeleteObjectOutput, error) {
+	delete(f.objects, *input.Bucket+"/"+*input.Key)
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func TestParseEventReference(t *testing.T) {
+	for _, value := range []string{"secret:job-event", "minio:bucket/ns/job"} {
+		ref, err := ParseEventReference(value)
+		if err != nil || ref.String() != value {
+			t.Errorf("unexpected reference %v for %q: %v", ref, value, err)
+		}
+	}
+	for _, value := range []string{"", "secret:", "minio:bucket", "other:name"} {
+		if _, err := ParseEventReference(value); err == nil {
+			t.Errorf("expected error parsing %q", value)
+		}
+	}
+}
+
+func TestIsLargeEvent(t *testing.T) {
+	if IsLargeEvent(&types.Config{}, make([]byte, 1<<20)) {
+		t.Errorf("expected large events to be disabled with threshold 0")
+	}
+	cfg := &types.Config{EventSizeThreshold: 10}
+	if IsLargeEvent(cfg, make([]byte, 10)) || !IsLargeEvent(cfg, make([]byte, 11)) {
+		t.Errorf("unexpected threshold check")
+	}
+}
+
+func TestStoreJobEventSecret(t *testing.T) {
+	ctx := context.Background()
+	kubeClientset := fake.NewSimpleClientset()
+	cfg := &types.Config{}
+
+	ref, err := StoreJobEvent(ctx, cfg, kubeClientset, "ns", "job", "svc", "user", []byte("payload"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ref.Kind != EventStoreSecret || ref.Path != "job-event" {
+		t.Fatalf("unexpected reference: %v", ref)
+	}
+	event, err := ReadJobEvent(ctx, cfg, kubeClientset, "ns", *ref)
+	if err != nil || string(event) != "payload" {
+		t.Fatalf("unexpected event %q: %v", event, err)
+	}
+
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "job", Namespace: "ns", UID: "uid"}}
+	if err := SetJobEventOwner(ctx, kubeClientset, *ref, job); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	secret, _ := kubeClientset.CoreV1().Secrets("ns").Get(ctx, "job-event", metav1.GetOptions{})
+	if len(secret.OwnerReferences) != 1 || secret.OwnerReferences[0].UID != "uid" {
+		t.Errorf("unexpected owner references: %v", secret.OwnerReferences)
+	}
+
+	if err := DeleteJobEvent(ctx, cfg, kubeClientset, "ns", *ref); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := DeleteJobEvent(ctx, cfg, kubeClientset, "ns", *ref); err != nil {
+		t.Fatalf("expected no error deleting a missing event, got %v", err)
+	}
+	if _, err := ReadJobEvent(ctx, cfg, kubeClientset, "ns", *ref); err != ErrJobEventNotFound {
+		t.Errorf("expected error %v reading a deleted event, got %v", ErrJobEventNotFound, err)
+	}
+}
+
+func TestStoreJobEventMinIO(t *testing.T) {
+	ctx := context.Background()
+	fakeS3 := &fakeEventS3{objects: map[string][]byte{}, modified: map[string]time.Time{}}
+	originalClient, originalGrant := makeEventS3Client, grantJobEventsAccess
+	makeEventS3Client = func(*types.Config) s3iface.S3API { return fakeS3 }
+	var granted []string
+	grantJobEventsAccess = func(_ *types.Config, owner string) error {
+		granted = append(granted, owner)
+		return nil
+	}
+	defer func() { makeEventS3Client, grantJobEventsAccess = originalClient, originalGrant }()
+
+	large := []byte(strings.Repeat("x", maxSecretEventSize+1))
+	if _, err := StoreJobEvent(ctx, &types.Config{}, fake.NewSimpleClientset(), "ns", "job", "svc", "user", large); err == nil {
+		t.Fatalf("expected error without MinIO")
+	}
+
+	cfg := &types.Config{EventBucket: "events", MinIOProvider: &types.MinIOProvider{}}
+	ref, err := StoreJobEvent(ctx, cfg, fake.NewSimpleClientset(), "ns", "job", "svc", "user", large)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ref.String() != "minio:events/user/ns/job" || len(granted) != 1 || granted[0] != "user" {
+		t.Fatalf("unexpected reference %v granted to %v", ref, granted)
+	}
+	event, err := ReadJobEvent(ctx, cfg, nil, "ns", *ref)
+	if err != nil || !bytes.Equal(event, large) {
+		t.Fatalf("unexpected event of %d bytes: %v", len(event), err)
+	}
+	if err := DeleteJobEvent(ctx, cfg, nil, "ns", *ref); err != nil || len(fakeS3.objects) != 0 {
+		t.Fatalf("expected the event to be deleted: %v", err)
+	}
+	if _, err := ReadJobEvent(ctx, cfg, nil, "ns", *ref); err != ErrJobEventNotFound {
+		t.Errorf("expected error %v reading a deleted event, got %v", ErrJobEventNotFound, err)
+	}
+
+	// The events of the services of the administrator need no grant
+	ref, err = StoreJobEvent(ctx, cfg, fake.NewSimpleClientset(), "ns", "job", "svc", "", large)
+	if err != nil || ref.String() != "minio:events/"+types.DefaultOwner+"/ns/job" || len(granted) != 1 {
+		t.Errorf("unexpected reference %v granted to %v: %v", ref, granted, err)
+	}
+}
+
+func TestPruneJobEvents(t *testing.T) {
+	ctx := context.Background()
+	fakeS3 := &fakeEventS3{objects: map[string][]byte{}, modified: map[string]time.Time{}}
+	original := makeEventS3Client
+	makeEventS3Client = func(*types.Config) s3iface.S3API { return fakeS3 }
+	defer func() { makeEventS3Client = original }()
+
+	old := time.Now().Add(-time.Hour)
+	for key, modified := range map[string]time.Time{
+		"events/user/ns/running": old,
+		"events/user/ns/deleted": old,
+		"events/user/ns/new":     time.Now(),
+	} {
+		fakeS3.objects[key] = []byte("event")
+		fakeS3.modified[key] = modified
+	}
+	kubeClientset := fake.NewSimpleClientset(&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "running", Namespace: "ns"}})
+	cfg := &types.Config{EventBucket: "events", MinIOProvider: &types.MinIOProvider{}}
+
+	pruned, err := PruneJobEvents(ctx, cfg, kubeClientset)
+	if err != nil || pruned != 1 {
+		t.Fatalf("expected 1 pruned event, got %d: %v", pruned, err)
+	}
+	// The events are kept while their jobs exist, and the recent ones while their jobs are created
+	for key, kept := range map[string]bool{"events/user/ns/running": true, "events/user/ns/deleted": false, "events/user/ns/new": true} {
+		if _, ok := fakeS3.objects[key]; ok != kept {
+			t.Errorf("expected event %s to be kept: %v", key, kept)
+		}
+	}
+}
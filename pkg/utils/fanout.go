@@ -0,0 +1,303 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/grycap/oscar/v4/pkg/types"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	fanoutRunKey               = "run"
+	fanoutRunConfigMapTemplate = "%s-fanout-%s"
+
+	// FanoutHeartbeatInterval maximum time between the updates of the progress of the submission of a run
+	FanoutHeartbeatInterval = time.Minute
+	// fanoutOrphanTimeout time without heartbeats after which the submission of a run is considered interrupted
+	fanoutOrphanTimeout = 5 * FanoutHeartbeatInterval
+)
+
+var fanoutLogger = log.New(os.Stdout, "[FANOUT] ", log.Flags())
+
+// StorageObject object of a storage provider
+type StorageObject struct {
+	Bucket string
+	Key    string
+	Size   int64
+	ETag   string
+}
+
+// ErrTooManyObjects error of the listings with more objects than allowed
+type ErrTooManyObjects struct {
+	Max int
+}
+
+func (e ErrTooManyObjects) Error() string {
+	return fmt.Sprintf("the path has more than %d matching objects", e.Max)
+}
+
+// ListStorageObjects lists the objects of the path ("bucket/folder") of the configuration that match
+// its prefix and suffix filters. Folders are skipped, and listing more than max objects fails (max <= 0 lists all)
+func ListStorageObjects(ctx context.Context, s3Client *s3.S3, ioConfig types.StorageIOConfig, max int) ([]StorageObject, error) {
+	bucket, folder, _ := strings.Cut(strings.Trim(ioConfig.Path, "/ "), "/")
+	if bucket == "" {
+		return nil, fmt.Errorf("the path must include a bucket")
+	}
+	folder = strings.Trim(folder, "/")
+	if folder != "" {
+		folder += "/"
+	}
+
+	objects := []StorageObject{}
+	var tooMany bool
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(folder),
+	}
+	err := s3Client.ListObjectsV2PagesWithContext(ctx, input, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, object := range page.Contents {
+			key := aws.StringValue(object.Key)
+			if strings.HasSuffix(key, "/") || !ioConfig.MatchesObject(strings.TrimPrefix(key, folder)) {
+				continue
+			}
+			if max > 0 && len(objects) >= max {
+				tooMany = true
+				return false
+			}
+			objects = append(objects, StorageObject{
+				Bucket: bucket,
+				Key:    key,
+				Size:   aws.Int64Value(object.Size),
+				ETag:   strings.Trim(aws.StringValue(object.ETag), "\""),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing the objects of \"%s\": %v", ioConfig.Path, err)
+	}
+	if tooMany {
+		return nil, ErrTooManyObjects{Max: max}
+	}
+	return objects, nil
+}
+
+// ObjectCreatedEvent returns a MinIO bucket notification of the creation of the object by the user,
+// like the ones sent to the services when a file is uploaded to their input
+func ObjectCreatedEvent(object StorageObject, eventSource string, principalID string) []byte {
+	key := url.QueryEscape(object.Key)
+	identity := map[string]string{"principalId": principalID}
+	event := map[string]interface{}{
+		"EventName": "s3:ObjectCreated:Put",
+		"Key":       object.Bucket + "/" + object.Key,
+		"Records": []interface{}{
+			map[string]interface{}{
+				"eventVersion": "2.0",
+				"eventSource":  eventSource,
+				"awsRegion":    "",
+				"eventTime":    time.Now().UTC().Format(time.RFC3339Nano),
+				"eventName":    "s3:ObjectCreated:Put",
+				"userIdentity": identity,
+				"requestParameters": map[string]string{
+					"principalId":     principalID,
+					"region":          "",
+					"sourceIPAddress": "",
+				},
+				"responseElements": map[string]string{},
+				"s3": map[string]interface{}{
+					"s3SchemaVersion": "1.0",
+					"configurationId": "Config",
+					"bucket": map[string]interface{}{
+						"name":          object.Bucket,
+						"ownerIdentity": identity,
+						"arn":           "arn:aws:s3:::" + object.Bucket,
+					},
+					"object": map[string]interface{}{
+						"key":  key,
+						"size": object.Size,
+						"eTag": object.ETag,
+					},
+				},
+			},
+		},
+	}
+	eventBytes, _ := json.Marshal(event)
+	return eventBytes
+}
+
+// FanoutRunConfigMapName returns the name of the ConfigMap storing a fan-out run of a service
+func FanoutRunConfigMapName(serviceName string, runName string) string {
+	return fmt.Sprintf(fanoutRunConfigMapTemplate, serviceName, runName)
+}
+
+// CreateFanoutRun stores a new fan-out run
+func CreateFanoutRun(ctx context.Context, kubeClientset kubernetes.Interface, run *types.FanoutRun) error {
+	data, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      FanoutRunConfigMapName(run.Service, run.Name),
+			Namespace: run.Namespace,
+			Labels: map[string]string{
+				types.FanoutServiceLabel: run.Service,
+				types.FanoutRunLabel:     run.Name,
+			},
+		},
+		Data: map[string]string{fanoutRunKey: string(data)},
+	}
+	_, err = kubeClientset.CoreV1().ConfigMaps(run.Namespace).Create(ctx, cm, metav1.CreateOptions{})
+	return err
+}
+
+// GetFanoutRun returns a stored fan-out run of a service
+func GetFanoutRun(ctx context.Context, kubeClientset kubernetes.Interface, namespace string, serviceName string, runName string) (*types.FanoutRun, error) {
+	cm, err := kubeClientset.CoreV1().ConfigMaps(namespace).Get(ctx, FanoutRunConfigMapName(serviceName, runName), metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return fanoutRunFromConfigMap(cm)
+}
+
+// ListFanoutRuns returns the stored fan-out runs of a service, from the newest to the oldest
+func ListFanoutRuns(ctx context.Context, kubeClientset kubernetes.Interface, namespace string, serviceName string) ([]types.FanoutRun, error) {
+	cms, err := kubeClientset.CoreV1().ConfigMaps(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", types.FanoutServiceLabel, serviceName),
+	})
+	if err != nil {
+		return nil, err
+	}
+	runs := make([]types.FanoutRun, 0, len(cms.Items))
+	for i := range cms.Items {
+		run, err := fanoutRunFromConfigMap(&cms.Items[i])
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, *run)
+	}
+	sort.SliceStable(runs, func(i, j int) bool {
+		return runs[j].CreatedAt.Before(&runs[i].CreatedAt)
+	})
+	return runs, nil
+}
+
+// UpdateFanoutRun applies the update to a stored fan-out run, retrying on conflicts with concurrent updates
+func UpdateFanoutRun(ctx context.Context, kubeClientset kubernetes.Interface, namespace string, serviceName string, runName string, update func(run *types.FanoutRun)) (*types.FanoutRun, error) {
+	var run *types.FanoutRun
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := kubeClientset.CoreV1().ConfigMaps(namespace).Get(ctx, FanoutRunConfigMapName(serviceName, runName), metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if run, err = fanoutRunFromConfigMap(cm); err != nil {
+			return err
+		}
+		update(run)
+		data, err := json.Marshal(run)
+		if err != nil {
+			return err
+		}
+		cm.Data[fanoutRunKey] = string(data)
+		_, err = kubeClientset.CoreV1().ConfigMaps(namespace).Update(ctx, cm, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// FailOrphanedFanoutRuns sets as failed the running runs of all the services whose submission stopped recording its
+// heartbeat, as the submissions are not resumed when the replica of the manager submitting them restarts.
+// The jobs already submitted keep running and are still counted. Returns the number of failed runs
+func FailOrphanedFanoutRuns(ctx context.Context, kubeClientset kubernetes.Interface) (int, error) {
+	cms, err := kubeClientset.CoreV1().ConfigMaps(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		LabelSelector: types.FanoutServiceLabel,
+	})
+	if err != nil {
+		return 0, err
+	}
+	failed := 0
+	for i := range cms.Items {
+		run, err := fanoutRunFromConfigMap(&cms.Items[i])
+		if err != nil || !fanoutRunOrphaned(run, time.Now()) {
+			continue
+		}
+		_, err = UpdateFanoutRun(ctx, kubeClientset, run.Namespace, run.Service, run.Name, func(run *types.FanoutRun) {
+			if !fanoutRunOrphaned(run, time.Now()) {
+				return
+			}
+			run.Status = types.FanoutFailed
+			run.Message = fmt.Sprintf("the submission of the jobs was interrupted after submitting %d of %d objects", run.Submitted, run.Objects)
+			run.SubmitterHeartbeat = nil
+		})
+		if err != nil {
+			return failed, err
+		}
+		failed++
+	}
+	return failed, nil
+}
+
+// StartFanoutRunMonitor periodically sets as failed the runs whose submission was interrupted
+func StartFanoutRunMonitor(ctx context.Context, kubeClientset kubernetes.Interface) {
+	for {
+		failed, err := FailOrphanedFanoutRuns(ctx, kubeClientset)
+		if err != nil {
+			fanoutLogger.Printf("Error checking the submission of the fan-out runs: %v", err)
+		} else if failed > 0 {
+			fanoutLogger.Printf("Set as failed %d fan-out runs whose submission was interrupted", failed)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(FanoutHeartbeatInterval):
+		}
+	}
+}
+
+// fanoutRunOrphaned returns true if the run is still submitting jobs but its submitter stopped recording its heartbeat
+func fanoutRunOrphaned(run *types.FanoutRun, now time.Time) bool {
+	return run.Status == types.FanoutRunning && run.SubmitterHeartbeat != nil && now.Sub(run.SubmitterHeartbeat.Time) > fanoutOrphanTimeout
+}
+
+func fanoutRunFromConfigMap(cm *corev1.ConfigMap) (*types.FanoutRun, error) {
+	run := &types.FanoutRun{}
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	if err := json.Unmarshal([]byte(cm.Data[fanoutRunKey]), run); err != nil {
+		return nil, fmt.Errorf("error decoding fan-out run %s: %v", cm.Name, err)
+	}
+	return run, nil
+}
@@ -0,0 +1,174 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grycap/oscar/v4/pkg/testsupport"
+	"github.com/grycap/oscar/v4/pkg/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	testclient "k8s.io/client-go/kubernetes/fake"
+)
+
+func newListObjectsServer(t *testing.T, keys ...string) *httptest.Server {
+	t.Helper()
+	testsupport.SkipIfCannotListen(t)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contents := ""
+		for _, key := range keys {
+			contents += fmt.Sprintf("<Contents><Key>%s</Key><Size>10</Size><ETag>&quot;etag&quot;</ETag></Contents>", key)
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/"><Name>bucket</Name><Prefix>%s</Prefix><KeyCount>%d</KeyCount><MaxKeys>1000</MaxKeys><IsTruncated>false</IsTruncated>%s</ListBucketResult>`, r.URL.Query().Get("prefix"), len(keys), contents)
+	}))
+}
+
+func TestListStorageObjects(t *testing.T) {
+	server := newListObjectsServer(t, "input/", "input/a.jpg", "input/b.png", "input/img-c.jpg")
+	defer server.Close()
+	s3Client := types.MinIOProvider{Endpoint: server.URL, Region: "us-east-1", AccessKey: "access", SecretKey: "secret"}.GetS3Client()
+
+	objects, err := ListStorageObjects(context.Background(), s3Client, types.StorageIOConfig{Path: "bucket/input", Suffix: []string{".jpg"}}, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(objects) != 2 || objects[0].Key != "input/a.jpg" || objects[1].Key != "input/img-c.jpg" {
+		t.Fatalf("unexpected objects: %+v", objects)
+	}
+	if objects[0].Bucket != "bucket" || objects[0].Size != 10 || objects[0].ETag != "etag" {
+		t.Errorf("unexpected object: %+v", objects[0])
+	}
+
+	objects, err = ListStorageObjects(context.Background(), s3Client, types.StorageIOConfig{Path: "bucket/input", Prefix: []string{"img-"}}, 0)
+	if err != nil || len(objects) != 1 {
+		t.Errorf("expected the object with the prefix, got %+v (%v)", objects, err)
+	}
+
+	if _, err := ListStorageObjects(context.Background(), s3Client, types.StorageIOConfig{Path: "bucket/input"}, 2); err == nil {
+		t.Error("expected an error listing more objects than allowed")
+	} else if _, ok := err.(ErrTooManyObjects); !ok {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if _, err := ListStorageObjects(context.Background(), s3Client, types.StorageIOConfig{Path: "/"}, 0); err == nil {
+		t.Error("expected an error listing a path without bucket")
+	}
+}
+
+func TestObjectCreatedEvent(t *testing.T) {
+	eventBytes := ObjectCreatedEvent(StorageObject{Bucket: "bucket", Key: "input/my file.jpg", Size: 10}, "minio:s3", "user")
+
+	var event struct {
+		Key     string
+		Records []struct {
+			RequestParameters map[string]string `json:"requestParameters"`
+			S3                struct {
+				Bucket struct {
+					Name string `json:"name"`
+				} `json:"bucket"`
+				Object struct {
+					Key  string `json:"key"`
+					Size int64  `json:"size"`
+				} `json:"object"`
+			} `json:"s3"`
+		}
+	}
+	if err := json.Unmarshal(eventBytes, &event); err != nil {
+		t.Fatalf("invalid event: %v", err)
+	}
+	if event.Key != "bucket/input/my file.jpg" || len(event.Records) != 1 {
+		t.Fatalf("unexpected event: %s", eventBytes)
+	}
+	record := event.Records[0]
+	if record.S3.Bucket.Name != "bucket" || record.S3.Object.Key != "input%2Fmy+file.jpg" || record.S3.Object.Size != 10 {
+		t.Errorf("unexpected record: %+v", record)
+	}
+	if record.RequestParameters["principalId"] != "user" {
+		t.Errorf("expected the user as principal, got %v", record.RequestParameters)
+	}
+}
+
+func TestFanoutRuns(t *testing.T) {
+	kubeClientset := testclient.NewSimpleClientset()
+	ctx := context.Background()
+	older := &types.FanoutRun{Name: "older", Service: "svc", Namespace: "ns", Status: types.FanoutRunning, CreatedAt: metav1.Unix(100, 0)}
+	newer := &types.FanoutRun{Name: "newer", Service: "svc", Namespace: "ns", Status: types.FanoutRunning, CreatedAt: metav1.Unix(200, 0)}
+	for _, run := range []*types.FanoutRun{older, newer} {
+		if err := CreateFanoutRun(ctx, kubeClientset, run); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	updated, err := UpdateFanoutRun(ctx, kubeClientset, "ns", "svc", "older", func(run *types.FanoutRun) {
+		run.Progress.Succeeded = 3
+	})
+	if err != nil || updated.Progress.Succeeded != 3 {
+		t.Fatalf("unexpected update result: %+v (%v)", updated, err)
+	}
+	run, err := GetFanoutRun(ctx, kubeClientset, "ns", "svc", "older")
+	if err != nil || run.Progress.Succeeded != 3 {
+		t.Errorf("expected the updated run, got %+v (%v)", run, err)
+	}
+
+	runs, err := ListFanoutRuns(ctx, kubeClientset, "ns", "svc")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(runs) != 2 || runs[0].Name != "newer" || runs[1].Name != "older" {
+		t.Errorf("expected the runs from the newest, got %+v", runs)
+	}
+}
+
+func TestFailOrphanedFanoutRuns(t *testing.T) {
+	kubeClientset := testclient.NewSimpleClientset()
+	ctx := context.Background()
+	stale := metav1.NewTime(time.Now().Add(-2 * fanoutOrphanTimeout))
+	recent := metav1.Now()
+	runs := []*types.FanoutRun{
+		{Name: "orphaned", Service: "svc", Namespace: "ns", Status: types.FanoutRunning, Objects: 10, Submitted: 4, SubmitterHeartbeat: &stale},
+		{Name: "submitting", Service: "svc", Namespace: "ns", Status: types.FanoutRunning, Objects: 10, SubmitterHeartbeat: &recent},
+		{Name: "submitted", Service: "svc", Namespace: "other", Status: types.FanoutRunning, Objects: 10, Submitted: 10},
+		{Name: "cancelled", Service: "svc", Namespace: "ns", Status: types.FanoutCancelled, Objects: 10, SubmitterHeartbeat: &stale},
+	}
+	for _, run := range runs {
+		if err := CreateFanoutRun(ctx, kubeClientset, run); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	failed, err := FailOrphanedFanoutRuns(ctx, kubeClientset)
+	if err != nil || failed != 1 {
+		t.Fatalf("expected 1 failed run, got %d (%v)", failed, err)
+	}
+	run, _ := GetFanoutRun(ctx, kubeClientset, "ns", "svc", "orphaned")
+	if run.Status != types.FanoutFailed || run.SubmitterHeartbeat != nil || !strings.Contains(run.Message, "4 of 10") {
+		t.Errorf("expected the orphaned run to fail, got %+v", run)
+	}
+	for _, run := range runs[1:] {
+		if stored, _ := GetFanoutRun(ctx, kubeClientset, run.Namespace, run.Service, run.Name); stored.Status != run.Status {
+			t.Errorf("expected run %s to keep its status, got %+v", run.Name, stored)
+		}
+	}
+}
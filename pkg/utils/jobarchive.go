@@ -0,0 +1,508 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/grycap/oscar/v4/pkg/types"
+)
+
+const (
+	jobRecordFile   = "record.json"
+	jobLogsFile     = "logs.txt"
+	jobArchiveIndex = "index.json"
+)
+
+// jobArchivePruneInterval period between the removals of the expired jobs of the archive
+const jobArchivePruneInterval = time.Hour
+
+var jobArchiveLogger = log.New(os.Stdout, "[JOB-ARCHIVE] ", log.Flags())
+
+// ErrJobNotArchived error returned when a job is not in the archive
+var ErrJobNotArchived = errors.New("the job is not archived")
+
+// JobArchive storage of the records and logs of the finished jobs, organised as
+// "<namespace>/<service>/<job>/record.json" and "<namespace>/<service>/<job>/logs.txt"
+type JobArchive interface {
+	// Init prepares the storage of the archive
+	Init(ctx context.Context) error
+	// Store saves the record and the logs of a job, replacing them if already archived
+	Store(ctx context.Context, record types.JobRecord, logs []byte) error
+	// Get returns the record of an archived job
+	Get(ctx context.Context, namespace string, service string, job string) (*types.JobRecord, error)
+	// GetLogs returns the logs of an archived job
+	GetLogs(ctx context.Context, namespace string, service string, job string) ([]byte, error)
+	// List returns the records of the archived jobs of a service
+	List(ctx context.Context, namespace string, service string) ([]types.JobRecord, error)
+	// Delete removes an archived job, it is not an error if the job is not archived
+	Delete(ctx context.Context, namespace string, service string, job string) error
+	// DeleteService removes all the archived jobs of a service
+	DeleteService(ctx context.Context, namespace string, service string) error
+	// Prune removes the jobs archived before the given time and returns how many were removed
+	Prune(ctx context.Context, before time.Time) (int, error)
+}
+
+// MakeJobArchive returns the job archive configured, or nil if the archive is disabled.
+// Jobs are archived in the JobArchivePath directory if defined or in the JobArchiveBucket of MinIO otherwise.
+func MakeJobArchive(cfg *types.Config) JobArchive {
+	if !cfg.JobArchiveEnable {
+		return nil
+	}
+	if cfg.JobArchivePath != "" {
+		return &fileJobArchive{basePath: cfg.JobArchivePath}
+	}
+	if cfg.MinIOProvider == nil {
+		return nil
+	}
+	return &minIOJobArchive{s3Client: cfg.MinIOProvider.GetS3Client(), bucket: cfg.JobArchiveBucket}
+}
+
+// StartJobArchivePruner periodically removes the jobs archived longer than the retention period
+func StartJobArchivePruner(ctx context.Context, archive JobArchive, retention time.Duration) {
+	for {
+		pruned, err := archive.Prune(ctx, time.Now().Add(-retention))
+		if err != nil {
+			jobArchiveLogger.Printf("Error pruning the job archive: %v", err)
+		} else if pruned > 0 {
+			jobArchiveLogger.Printf("Removed %d expired jobs from the archive", pruned)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(jobArchivePruneInterval):
+		}
+	}
+}
+
+// validArchiveNames checks that the names can be used as path elements of the archive
+func validArchiveNames(names ...string) bool {
+	for _, name := range names {
+		if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+			return false
+		}
+	}
+	return true
+}
+
+// jobArchivePath returns the path of a file of an archived job
+func jobArchivePath(namespace string, service string, job string, file string) (string, error) {
+	if !validArchiveNames(namespace, service, job) {
+		return "", ErrJobNotArchived
+	}
+	return path.Join(namespace, service, job, file), nil
+}
+
+func decodeJobRecord(data []byte) (*types.JobRecord, error) {
+	record := &types.JobRecord{}
+	if err := json.Unmarshal(data, record); err != nil {
+		return nil, fmt.Errorf("error decoding the archived job: %v", err)
+	}
+	return record, nil
+}
+
+// sortJobRecords sorts the records from the newest to the oldest job
+func sortJobRecords(records []types.JobRecord) {
+	sort.SliceStable(records, func(i, j int) bool {
+		a, b := records[i].CreationTime, records[j].CreationTime
+		if a == nil || b == nil {
+			return b == nil && a != nil
+		}
+		return b.Before(a)
+	})
+}
+
+// fileJobArchive archive in a local directory, usually a mounted PVC
+type fileJobArchive struct {
+	basePath string
+}
+
+func (archive *fileJobArchive) Init(ctx context.Context) error {
+	return os.MkdirAll(archive.basePath, 0750)
+}
+
+func (archive *fileJobArchive) Store(ctx context.Context, record types.JobRecord, logs []byte) error {
+	recordPath, err := jobArchivePath(record.Namespace, record.Service, record.Name, jobRecordFile)
+	if err != nil {
+		return fmt.Errorf("invalid job record: %v", err)
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(archive.basePath, filepath.Dir(filepath.FromSlash(recordPath)))
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, jobLogsFile), logs, 0640); err != nil {
+		return err
+	}
+	// The record is written last, as it marks the job as archived
+	return os.WriteFile(filepath.Join(dir, jobRecordFile), data, 0640)
+}
+
+func (archive *fileJobArchive) read(namespace string, service string, job string, file string) ([]byte, error) {
+	filePath, err := jobArchivePath(namespace, service, job, file)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(archive.basePath, filepath.FromSlash(filePath)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrJobNotArchived
+	}
+	return data, err
+}
+
+func (archive *fileJobArchive) Get(ctx context.Context, namespace string, service string, job string) (*types.JobRecord, error) {
+	data, err := archive.read(namespace, service, job, jobRecordFile)
+	if err != nil {
+		return nil, err
+	}
+	return decodeJobRecord(data)
+}
+
+func (archive *fileJobArchive) GetLogs(ctx context.Context, namespace string, service string, job string) ([]byte, error) {
+	return archive.read(namespace, service, job, jobLogsFile)
+}
+
+func (archive *fileJobArchive) List(ctx context.Context, namespace string, service string) ([]types.JobRecord, error) {
+	records := []types.JobRecord{}
+	if !validArchiveNames(namespace, service) {
+		return records, nil
+	}
+	entries, err := os.ReadDir(filepath.Join(archive.basePath, namespace, service))
+	if errors.Is(err, os.ErrNotExist) {
+		return records, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		record, err := archive.Get(ctx, namespace, service, entry.Name())
+		if err != nil {
+			// Skip jobs still being archived
+			if errors.Is(err, ErrJobNotArchived) {
+				continue
+			}
+			return nil, err
+		}
+		records = append(records, *record)
+	}
+	sortJobRecords(records)
+	return records, nil
+}
+
+func (archive *fileJobArchive) Delete(ctx context.Context, namespace string, service string, job string) error {
+	if !validArchiveNames(namespace, service, job) {
+		return nil
+	}
+	return os.RemoveAll(filepath.Join(archive.basePath, namespace, service, job))
+}
+
+func (archive *fileJobArchive) DeleteService(ctx context.Context, namespace string, service string) error {
+	if !validArchiveNames(namespace, service) {
+		return nil
+	}
+	return os.RemoveAll(filepath.Join(archive.basePath, namespace, service))
+}
+
+func (archive *fileJobArchive) Prune(ctx context.Context, before time.Time) (int, error) {
+	records, err := filepath.Glob(filepath.Join(archive.basePath, "*", "*", "*", jobRecordFile))
+	if err != nil {
+		return 0, err
+	}
+	pruned := 0
+	for _, recordPath := range records {
+		info, err := os.Stat(recordPath)
+		if err != nil || !info.ModTime().Before(before) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Dir(recordPath)); err != nil {
+			return pruned, err
+		}
+		pruned++
+	}
+	return pruned, nil
+}
+
+// minIOJobArchive archive in a MinIO bucket
+type minIOJobArchive struct {
+	s3Client s3iface.S3API
+	bucket   string
+}
+
+func (archive *minIOJobArchive) Init(ctx context.Context) error {
+	return ensureBucket(ctx, archive.s3Client, archive.bucket)
+}
+
+func (archive *minIOJobArchive) Store(ctx context.Context, record types.JobRecord, logs []byte) error {
+	recordKey, err := jobArchivePath(record.Namespace, record.Service, record.Name, jobRecordFile)
+	if err != nil {
+		return fmt.Errorf("invalid job record: %v", err)
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	logsKey := path.Join(path.Dir(recordKey), jobLogsFile)
+	if err := archive.put(ctx, logsKey, logs, "text/plain; charset=utf-8"); err != nil {
+		return err
+	}
+	// The record is written last, as it marks the job as archived
+	if err := archive.put(ctx, recordKey, data, "application/json"); err != nil {
+		return err
+	}
+	// The index is only a cache of the records, List repairs it if this update is lost
+	return archive.updateIndex(ctx, record.Namespace, record.Service, func(index map[string]types.JobRecord) {
+		index[record.Name] = record
+	})
+}
+
+func (archive *minIOJobArchive) put(ctx context.Context, key string, data []byte, contentType string) error {
+	_, err := archive.s3Client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(archive.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return fmt.Errorf("error uploading \"%s\" to the job archive: %v", key, err)
+	}
+	return nil
+}
+
+func (archive *minIOJobArchive) read(ctx context.Context, namespace string, service string, job string, file string) ([]byte, error) {
+	key, err := jobArchivePath(namespace, service, job, file)
+	if err != nil {
+		return nil, err
+	}
+	out, err := archive.s3Client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(archive.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+			return nil, ErrJobNotArchived
+		}
+		return nil, err
+	}
+	defer out.Body.Close()
+	return io.ReadAll(out.Body)
+}
+
+func (archive *minIOJobArchive) Get(ctx context.Context, namespace string, service string, job string) (*types.JobRecord, error) {
+	data, err := archive.read(ctx, namespace, service, job, jobRecordFile)
+	if err != nil {
+		return nil, err
+	}
+	return decodeJobRecord(data)
+}
+
+func (archive *minIOJobArchive) GetLogs(ctx context.Context, namespace string, service string, job string) ([]byte, error) {
+	return archive.read(ctx, namespace, service, job, jobLogsFile)
+}
+
+// List reads the records from the index of the service, so only the jobs archived
+// since the last update of the index (e.g. by other replicas) have to be read
+func (archive *minIOJobArchive) List(ctx context.Context, namespace string, service string) ([]types.JobRecord, error) {
+	records := []types.JobRecord{}
+	if !validArchiveNames(namespace, service) {
+		return records, nil
+	}
+	var jobs []string
+	input := &s3.ListObjectsV2Input{
+		Bucket:    aws.String(archive.bucket),
+		Prefix:    aws.String(path.Join(namespace, service) + "/"),
+		Delimiter: aws.String("/"),
+	}
+	err := archive.s3Client.ListObjectsV2PagesWithContext(ctx, input, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, prefix := range page.CommonPrefixes {
+			jobs = append(jobs, path.Base(aws.StringValue(prefix.Prefix)))
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := archive.readIndex(ctx, namespace, service)
+	if err != nil {
+		return nil, err
+	}
+	changed := false
+	archived := map[string]bool{}
+	for _, job := range jobs {
+		archived[job] = true
+		if record, ok := index[job]; ok {
+			records = append(records, record)
+			continue
+		}
+		record, err := archive.Get(ctx, namespace, service, job)
+		if err != nil {
+			// Skip jobs still being archived
+			if errors.Is(err, ErrJobNotArchived) {
+				continue
+			}
+			return nil, err
+		}
+		index[job] = *record
+		changed = true
+		records = append(records, *record)
+	}
+	// Drop the jobs deleted or pruned from the archive
+	for job := range index {
+		if !archived[job] {
+			delete(index, job)
+			changed = true
+		}
+	}
+	if changed {
+		if err := archive.writeIndex(ctx, namespace, service, index); err != nil {
+			return nil, err
+		}
+	}
+	sortJobRecords(records)
+	return records, nil
+}
+
+func (archive *minIOJobArchive) Delete(ctx context.Context, namespace string, service string, job string) error {
+	if !validArchiveNames(namespace, service, job) {
+		return nil
+	}
+	if err := archive.deletePrefix(ctx, path.Join(namespace, service, job)+"/"); err != nil {
+		return err
+	}
+	return archive.updateIndex(ctx, namespace, service, func(index map[string]types.JobRecord) {
+		delete(index, job)
+	})
+}
+
+func (archive *minIOJobArchive) DeleteService(ctx context.Context, namespace string, service string) error {
+	if !validArchiveNames(namespace, service) {
+		return nil
+	}
+	return archive.deletePrefix(ctx, path.Join(namespace, service)+"/")
+}
+
+// Prune removes the jobs whose record was uploaded before the given time.
+// The indexes of the services are repaired the next time they are listed.
+func (archive *minIOJobArchive) Prune(ctx context.Context, before time.Time) (int, error) {
+	var expired []string
+	input := &s3.ListObjectsV2Input{Bucket: aws.String(archive.bucket)}
+	err := archive.s3Client.ListObjectsV2PagesWithContext(ctx, input, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, object := range page.Contents {
+			key := aws.StringValue(object.Key)
+			if path.Base(key) == jobRecordFile && strings.Count(key, "/") == 3 && aws.TimeValue(object.LastModified).Before(before) {
+				expired = append(expired, path.Dir(key)+"/")
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+	for i, prefix := range expired {
+		if err := archive.deletePrefix(ctx, prefix); err != nil {
+			return i, err
+		}
+	}
+	return len(expired), nil
+}
+
+// deletePrefix removes all the objects under the prefix
+func (archive *minIOJobArchive) deletePrefix(ctx context.Context, prefix string) error {
+	var deleteErr error
+	input := &s3.ListObjectsV2Input{Bucket: aws.String(archive.bucket), Prefix: aws.String(prefix)}
+	err := archive.s3Client.ListObjectsV2PagesWithContext(ctx, input, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		if len(page.Contents) == 0 {
+			return true
+		}
+		objects := make([]*s3.ObjectIdentifier, 0, len(page.Contents))
+		for _, object := range page.Contents {
+			objects = append(objects, &s3.ObjectIdentifier{Key: object.Key})
+		}
+		_, deleteErr = archive.s3Client.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(archive.bucket),
+			Delete: &s3.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		return deleteErr == nil
+	})
+	if err == nil {
+		err = deleteErr
+	}
+	if err != nil {
+		return fmt.Errorf("error deleting \"%s\" from the job archive: %v", prefix, err)
+	}
+	return nil
+}
+
+// readIndex returns the index of the archived jobs of a service, empty if not created yet
+func (archive *minIOJobArchive) readIndex(ctx context.Context, namespace string, service string) (map[string]types.JobRecord, error) {
+	index := map[string]types.JobRecord{}
+	out, err := archive.s3Client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(archive.bucket),
+		Key:    aws.String(path.Join(namespace, service, jobArchiveIndex)),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+			return index, nil
+		}
+		return nil, err
+	}
+	defer out.Body.Close()
+	// A corrupted index is rebuilt from the records
+	if err := json.NewDecoder(out.Body).Decode(&index); err != nil {
+		return map[string]types.JobRecord{}, nil
+	}
+	return index, nil
+}
+
+func (archive *minIOJobArchive) writeIndex(ctx context.Context, namespace string, service string, index map[string]types.JobRecord) error {
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	return archive.put(ctx, path.Join(namespace, service, jobArchiveIndex), data, "application/json")
+}
+
+func (archive *minIOJobArchive) updateIndex(ctx context.Context, namespace string, service string, update func(index map[string]types.JobRecord)) error {
+	index, err := archive.readIndex(ctx, namespace, service)
+	if err != nil {
+		return err
+	}
+	update(index)
+	return archive.writeIndex(ctx, namespace, service, index)
+}
@@ -0,0 +1,263 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/grycap/oscar/v4/pkg/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMakeJobArchive(t *testing.T) {
+	if archive := MakeJobArchive(&types.Config{}); archive != nil {
+		t.Fatalf("expected no archive when disabled")
+	}
+	archive := MakeJobArchive(&types.Config{JobArchiveEnable: true, JobArchivePath: t.TempDir()})
+	if _, ok := archive.(*fileJobArchive); !ok {
+		t.Fatalf("expected a file archive, got %T", archive)
+	}
+	archive = MakeJobArchive(&types.Config{JobArchiveEnable: true, JobArchiveBucket: "archive", MinIOProvider: &types.MinIOProvider{Endpoint: "http://minio:9000"}})
+	if minIOArchive, ok := archive.(*minIOJobArchive); !ok || minIOArchive.bucket != "archive" {
+		t.Fatalf("expected a MinIO archive, got %#v", archive)
+	}
+}
+
+func TestFileJobArchive(t *testing.T) {
+	ctx := context.Background()
+	basePath := filepath.Join(t.TempDir(), "archive")
+	archive := &fileJobArchive{basePath: basePath}
+	if err := archive.Init(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	older := metav1.NewTime(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	newer := metav1.NewTime(older.Add(time.Hour))
+	records := []types.JobRecord{
+		{Name: "job-old", Service: "svc", Namespace: "oscar-svc", Owner: "user", JobInfo: types.JobInfo{Status: "Succeeded", CreationTime: &older}},
+		{Name: "job-new", Service: "svc", Namespace: "oscar-svc", Owner: "user", JobInfo: types.JobInfo{Status: "Failed", CreationTime: &newer}},
+	}
+	for _, record := range records {
+		if err := archive.Store(ctx, record, []byte("logs of "+record.Name)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	// Jobs without record are still being archived
+	if err := os.MkdirAll(filepath.Join(basePath, "oscar-svc", "svc", "job-partial"), 0750); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	record, err := archive.Get(ctx, "oscar-svc", "svc", "job-old")
+	if err != nil || record.Status != "Succeeded" || record.Owner != "user" {
+		t.Fatalf("unexpected record %#v, error: %v", record, err)
+	}
+	logs, err := archive.GetLogs(ctx, "oscar-svc", "svc", "job-new")
+	if err != nil || string(logs) != "logs of job-new" {
+		t.Fatalf("unexpected logs %q, error: %v", logs, err)
+	}
+
+	list, err := archive.List(ctx, "oscar-svc", "svc")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(list) != 2 || list[0].Name != "job-new" || list[1].Name != "job-old" {
+		t.Fatalf("unexpected list %#v", list)
+	}
+	if list, err := archive.List(ctx, "oscar-svc", "other"); err != nil || len(list) != 0 {
+		t.Fatalf("expected empty list, got %#v, error: %v", list, err)
+	}
+
+	if _, err := archive.Get(ctx, "oscar-svc", "svc", "missing"); !errors.Is(err, ErrJobNotArchived) {
+		t.Fatalf("expected ErrJobNotArchived, got %v", err)
+	}
+	if _, err := archive.GetLogs(ctx, "oscar-svc", "..", "svc"); !errors.Is(err, ErrJobNotArchived) {
+		t.Fatalf("expected ErrJobNotArchived for invalid names, got %v", err)
+	}
+	if err := archive.Store(ctx, types.JobRecord{Name: "../job", Service: "svc", Namespace: "oscar-svc"}, nil); err == nil {
+		t.Fatalf("expected error storing a record with an invalid name")
+	}
+}
+
+func TestFileJobArchiveDelete(t *testing.T) {
+	ctx := context.Background()
+	basePath := t.TempDir()
+	archive := &fileJobArchive{basePath: basePath}
+	for _, record := range []types.JobRecord{
+		{Name: "job-1", Service: "svc", Namespace: "oscar-svc"},
+		{Name: "job-2", Service: "svc", Namespace: "oscar-svc"},
+		{Name: "job-3", Service: "svc", Namespace: "oscar-svc"},
+		{Name: "job-1", Service: "other", Namespace: "oscar-svc"},
+	} {
+		if err := archive.Store(ctx, record, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if err := archive.Delete(ctx, "oscar-svc", "svc", "job-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := archive.Get(ctx, "oscar-svc", "svc", "job-1"); !errors.Is(err, ErrJobNotArchived) {
+		t.Errorf("expected the job to be deleted, got %v", err)
+	}
+	if err := archive.Delete(ctx, "oscar-svc", "svc", "missing"); err != nil {
+		t.Errorf("unexpected error deleting a job not archived: %v", err)
+	}
+
+	// Only the jobs archived before the time are pruned
+	old := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(filepath.Join(basePath, "oscar-svc", "svc", "job-2", jobRecordFile), old, old); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pruned, err := archive.Prune(ctx, time.Now().Add(-24*time.Hour)); err != nil || pruned != 1 {
+		t.Fatalf("expected 1 pruned job, got %d, error: %v", pruned, err)
+	}
+	if list, _ := archive.List(ctx, "oscar-svc", "svc"); len(list) != 1 || list[0].Name != "job-3" {
+		t.Errorf("unexpected list after pruning %#v", list)
+	}
+
+	if err := archive.DeleteService(ctx, "oscar-svc", "svc"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if list, _ := archive.List(ctx, "oscar-svc", "svc"); len(list) != 0 {
+		t.Errorf("expected no jobs after deleting the service, got %#v", list)
+	}
+	if list, _ := archive.List(ctx, "oscar-svc", "other"); len(list) != 1 {
+		t.Errorf("expected the jobs of other services to be kept, got %#v", list)
+	}
+}
+
+// fakeS3 in-memory bucket implementing the operations used by the job archive
+type fakeS3 struct {
+	s3iface.S3API
+	objects  map[string][]byte
+	modified map[string]time.Time
+	gets     int
+}
+
+func (f *fakeS3) PutObjectWithContext(ctx aws.Context, input *s3.PutObjectInput, _ ...request.Option) (*s3.PutObjectOutput, error) {
+	data, _ := io.ReadAll(input.Body)
+	f.objects[*input.Key] = data
+	f.modified[*input.Key] = time.Now()
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (f *fakeS3) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, _ ...request.Option) (*s3.GetObjectOutput, error) {
+	f.gets++
+	data, ok := f.objects[*input.Key]
+	if !ok {
+		return nil, awserr.New(s3.ErrCodeNoSuchKey, "not found", nil)
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(data))}, nil
+}
+
+func (f *fakeS3) ListObjectsV2PagesWithContext(ctx aws.Context, input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool, _ ...request.Option) error {
+	page := &s3.ListObjectsV2Output{}
+	prefixes := map[string]bool{}
+	keys := make([]string, 0, len(f.objects))
+	for key := range f.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	prefix := aws.StringValue(input.Prefix)
+	for _, key := range keys {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if delimiter := aws.StringValue(input.Delimiter); delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				common := key[:len(prefix)+i+1]
+				if !prefixes[common] {
+					prefixes[common] = true
+					page.CommonPrefixes = append(page.CommonPrefixes, &s3.CommonPrefix{Prefix: aws.String(common)})
+				}
+				continue
+			}
+		}
+		page.Contents = append(page.Contents, &s3.Object{Key: aws.String(key), LastModified: aws.Time(f.modified[key])})
+	}
+	fn(page, true)
+	return nil
+}
+
+func (f *fakeS3) DeleteObjectsWithContext(ctx aws.Context, input *s3.DeleteObjectsInput, _ ...request.Option) (*s3.DeleteObjectsOutput, error) {
+	for _, object := range input.Delete.Objects {
+		delete(f.objects, *object.Key)
+		delete(f.modified, *object.Key)
+	}
+	return &s3.DeleteObjectsOutput{}, nil
+}
+
+func TestMinIOJobArchive(t *testing.T) {
+	ctx := context.Background()
+	s3Client := &fakeS3{objects: map[string][]byte{}, modified: map[string]time.Time{}}
+	archive := &minIOJobArchive{s3Client: s3Client, bucket: "archive"}
+	for _, name := range []string{"job-1", "job-2", "job-3"} {
+		if err := archive.Store(ctx, types.JobRecord{Name: name, Service: "svc", Namespace: "oscar-svc"}, []byte("logs")); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	// The records are read from the index
+	s3Client.gets = 0
+	list, err := archive.List(ctx, "oscar-svc", "svc")
+	if err != nil || len(list) != 3 {
+		t.Fatalf("unexpected list %#v, error: %v", list, err)
+	}
+	if s3Client.gets != 1 {
+		t.Errorf("expected only the index to be read, got %d reads", s3Client.gets)
+	}
+
+	// The index is repaired with the jobs missing or removed from it
+	delete(s3Client.objects, "oscar-svc/svc/index.json")
+	if list, err := archive.List(ctx, "oscar-svc", "svc"); err != nil || len(list) != 3 {
+		t.Fatalf("unexpected list %#v, error: %v", list, err)
+	}
+	if _, ok := s3Client.objects["oscar-svc/svc/index.json"]; !ok {
+		t.Errorf("expected the index to be rebuilt")
+	}
+	s3Client.modified["oscar-svc/svc/job-2/record.json"] = time.Now().Add(-48 * time.Hour)
+	if pruned, err := archive.Prune(ctx, time.Now().Add(-24*time.Hour)); err != nil || pruned != 1 {
+		t.Fatalf("expected 1 pruned job, got %d, error: %v", pruned, err)
+	}
+	if err := archive.Delete(ctx, "oscar-svc", "svc", "job-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if list, _ := archive.List(ctx, "oscar-svc", "svc"); len(list) != 1 || list[0].Name != "job-3" {
+		t.Errorf("unexpected list after deleting %#v", list)
+	}
+
+	if err := archive.DeleteService(ctx, "oscar-svc", "svc"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(s3Client.objects) != 0 {
+		t.Errorf("expected no objects after deleting the service, got %v", s3Client.objects)
+	}
+}
@@ -177,6 +177,18 @@ func CreateKserveService(service *types.Service, knativeService *knv1.Service, c
 	return nil
 }
 
+// NewKserveServiceDefinition returns the InferenceService or LLMInferenceService that
+// CreateKserveService would create for the provided service, without creating it.
+func NewKserveServiceDefinition(service *types.Service, knativeService *knv1.Service, cfg *types.Config) (*unstructured.Unstructured, error) {
+	if err := ValidateKserveService(service); err != nil {
+		return nil, err
+	}
+	if service.Kserve.Type == KserveTypeLLMInferenceService {
+		return NewKserveLLMInferenceServiceDefinition(service, knativeService, cfg)
+	}
+	return NewKserveInferenceServiceDefinition(service, knativeService, cfg)
+}
+
 func UpdateKserveService(service *types.Service, oldService *types.Service, namespace string) error {
 	if err := ValidateKserveService(service); err != nil {
 		return err
@@ -381,7 +393,7 @@ func NewKserveLLMInferenceServiceDefinition(service *types.Service, knSvc *knv1.
 	}
 
 	runtimeImage := defaultLLMCPUimage
-	if service.Kserve.EnableGPU {
+	if service.Kserve.EnableGPU || service.Kserve.Accelerators != nil {
 		runtimeImage = defaultLLMGPUimage
 	}
 	if service.Kserve.LLMInference != nil && service.Kserve.LLMInference.RuntimeImage != "" {
@@ -459,7 +471,7 @@ func UpdateKserveLLMInferenceServiceDefinition(service *types.Service, oldLLMIsv
 	}
 
 	runtimeImage := defaultLLMCPUimage
-	if service.Kserve.EnableGPU {
+	if service.Kserve.EnableGPU || service.Kserve.Accelerators != nil {
 		runtimeImage = defaultLLMGPUimage
 	}
 	if service.Kserve.LLMInference != nil && service.Kserve.LLMInference.RuntimeImage != "" {
@@ -858,13 +870,9 @@ func createKserveResources(service *types.Kserve) (v1.ResourceRequirements, erro
 		resources.Requests[corev1.ResourceMemory] = memory
 	}
 
-	if service.EnableGPU {
-		gpu, err := resource.ParseQuantity("1")
-		if err != nil {
-			return resources, err
-		}
-		resources.Limits["nvidia.com/gpu"] = gpu
-		resources.Requests["nvidia.com/gpu"] = gpu
+	if name, quantity, ok := types.AcceleratorRequest(service.EnableGPU, service.Accelerators); ok {
+		resources.Limits[name] = quantity
+		resources.Requests[name] = quantity
 	}
 
 	return resources, nil
@@ -4,9 +4,11 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"maps"
 	"math"
 	"os"
 	"reflect"
+	"slices"
 	"strings"
 	"time"
 
@@ -29,6 +31,11 @@ const (
 	defaultKueueQueuePrefix      = "oscar-cq"
 	defaultKueueLocalQueuePrefix = "oscar-lq"
 	defaultKueueAdmissionTimeout = 30 * time.Second
+
+	// KueueQueueNameLabel label of the Jobs managed by Kueue with the name of their LocalQueue
+	KueueQueueNameLabel = "kueue.x-k8s.io/queue-name"
+	// KueueJobUIDLabel label of the Kueue Workloads with the UID of their Job
+	KueueJobUIDLabel = "kueue.x-k8s.io/job-uid"
 )
 
 var (
@@ -132,26 +139,9 @@ func ensureResourceFlavor(ctx context.Context, kueueClient *kueueclientset.Clien
 }
 
 func ensureClusterQueue(ctx context.Context, kueueClient *kueueclientset.Clientset, cfg *types.Config, cqName, flavorName, owner string) error {
-	cpuQuota, err := resource.ParseQuantity(cfg.KueueDefaultCPU)
-	if err != nil {
-		return fmt.Errorf("invalid Kueue default CPU quota %q: %w", cfg.KueueDefaultCPU, err)
-	}
-	memoryQuota, err := resource.ParseQuantity(cfg.KueueDefaultMemory)
-	if err != nil {
-		return fmt.Errorf("invalid Kueue default memory quota %q: %w", cfg.KueueDefaultMemory, err)
-	}
-	// Parse the default ephemeral storage quota from config for per-user limits.
-	ephemeralStorageQuota, err := resource.ParseQuantity(cfg.KueueDefaultEphemeralStorage)
+	coveredResources, resourceQuotas, err := defaultClusterQueueQuotas(cfg)
 	if err != nil {
-		return fmt.Errorf("invalid Kueue default ephemeral storage quota %q: %w", cfg.KueueDefaultEphemeralStorage, err)
-	}
-
-	gpuQuota := resource.MustParse("0")
-	if cfg.GPUAvailable {
-		gpuQuota, err = resource.ParseQuantity(cfg.KueueDefaultGPU)
-		if err != nil {
-			return fmt.Errorf("invalid Kueue default GPU quota %q: %w", cfg.KueueDefaultGPU, err)
-		}
+		return err
 	}
 
 	cq := &kueuev1.ClusterQueue{
@@ -169,28 +159,11 @@ func ensureClusterQueue(ctx context.Context, kueueClient *kueueclientset.Clients
 			},
 			ResourceGroups: []kueuev1.ResourceGroup{
 				{
-					CoveredResources: []v1.ResourceName{v1.ResourceCPU, v1.ResourceMemory, v1.ResourceEphemeralStorage, v1.ResourceName("nvidia.com/gpu")},
+					CoveredResources: coveredResources,
 					Flavors: []kueuev1.FlavorQuotas{
 						{
-							Name: kueuev1.ResourceFlavorReference(flavorName),
-							Resources: []kueuev1.ResourceQuota{
-								{
-									Name:         v1.ResourceCPU,
-									NominalQuota: cpuQuota,
-								},
-								{
-									Name:         v1.ResourceMemory,
-									NominalQuota: memoryQuota,
-								},
-								{
-									Name:         v1.ResourceEphemeralStorage,
-									NominalQuota: ephemeralStorageQuota,
-								},
-								{
-									Name:         v1.ResourceName("nvidia.com/gpu"),
-									NominalQuota: gpuQuota,
-								},
-							},
+							Name:      kueuev1.ResourceFlavorReference(flavorName),
+							Resources: resourceQuotas,
 						},
 					},
 				},
@@ -207,19 +180,97 @@ func ensureClusterQueue(ctx context.Context, kueueClient *kueueclientset.Clients
 		return err
 	}
 
-	// Reconcile quotas if missing/zero so queues are usable without manual patching.
-	if current.Spec.NamespaceSelector == nil ||
-		len(current.Spec.ResourceGroups) == 0 ||
-		len(current.Spec.ResourceGroups[0].Flavors) == 0 ||
-		len(current.Spec.ResourceGroups[0].Flavors[0].Resources) == 0 ||
-		!reflect.DeepEqual(current.Spec.NamespaceSelector, cq.Spec.NamespaceSelector) {
-		current.Spec.ResourceGroups = cq.Spec.ResourceGroups
+	// Reconcile quotas if missing/zero or the accelerators of the cluster changed so queues are usable without manual patching.
+	resourceGroups, changed := reconcileResourceGroups(current.Spec.ResourceGroups, cq.Spec.ResourceGroups[0])
+	if changed || !reflect.DeepEqual(current.Spec.NamespaceSelector, cq.Spec.NamespaceSelector) {
+		current.Spec.ResourceGroups = resourceGroups
 		current.Spec.NamespaceSelector = cq.Spec.NamespaceSelector
 		_, err = kueueClient.KueueV1beta2().ClusterQueues().Update(ctx, current, metav1.UpdateOptions{})
 	}
 	return err
 }
 
+// defaultClusterQueueQuotas returns the resources covered by the ClusterQueues of the users and their default quotas
+func defaultClusterQueueQuotas(cfg *types.Config) ([]v1.ResourceName, []kueuev1.ResourceQuota, error) {
+	cpuQuota, err := resource.ParseQuantity(cfg.KueueDefaultCPU)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid Kueue default CPU quota %q: %w", cfg.KueueDefaultCPU, err)
+	}
+	memoryQuota, err := resource.ParseQuantity(cfg.KueueDefaultMemory)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid Kueue default memory quota %q: %w", cfg.KueueDefaultMemory, err)
+	}
+	// Parse the default ephemeral storage quota from config for per-user limits.
+	ephemeralStorageQuota, err := resource.ParseQuantity(cfg.KueueDefaultEphemeralStorage)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid Kueue default ephemeral storage quota %q: %w", cfg.KueueDefaultEphemeralStorage, err)
+	}
+
+	gpuQuota := resource.MustParse("0")
+	if cfg.GPUAvailable {
+		gpuQuota, err = resource.ParseQuantity(cfg.KueueDefaultGPU)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid Kueue default GPU quota %q: %w", cfg.KueueDefaultGPU, err)
+		}
+	}
+
+	// Kueue quotas are per resource, so every accelerator resource of the cluster gets its own default GPU quota
+	coveredResources := []v1.ResourceName{v1.ResourceCPU, v1.ResourceMemory, v1.ResourceEphemeralStorage}
+	resourceQuotas := []kueuev1.ResourceQuota{
+		{
+			Name:         v1.ResourceCPU,
+			NominalQuota: cpuQuota,
+		},
+		{
+			Name:         v1.ResourceMemory,
+			NominalQuota: memoryQuota,
+		},
+		{
+			Name:         v1.ResourceEphemeralStorage,
+			NominalQuota: ephemeralStorageQuota,
+		},
+	}
+	for _, accelerator := range cfg.AcceleratorResourceNames() {
+		coveredResources = append(coveredResources, accelerator)
+		resourceQuotas = append(resourceQuotas, kueuev1.ResourceQuota{
+			Name:         accelerator,
+			NominalQuota: gpuQuota,
+		})
+	}
+	return coveredResources, resourceQuotas, nil
+}
+
+// reconcileResourceGroups returns the resource groups of an existing ClusterQueue covering the resources of the
+// desired group, and whether they changed. The quotas of the resources already covered are kept, so the ones tuned
+// by the administrators aren't overwritten, and only the new resources get the default quotas
+func reconcileResourceGroups(current []kueuev1.ResourceGroup, desired kueuev1.ResourceGroup) ([]kueuev1.ResourceGroup, bool) {
+	if len(current) == 0 || len(current[0].Flavors) == 0 || len(current[0].Flavors[0].Resources) == 0 {
+		return []kueuev1.ResourceGroup{desired}, true
+	}
+	if reflect.DeepEqual(current[0].CoveredResources, desired.CoveredResources) {
+		return current, false
+	}
+
+	group := current[0]
+	group.CoveredResources = desired.CoveredResources
+	group.Flavors = slices.Clone(current[0].Flavors)
+	for i := range group.Flavors {
+		existing := map[v1.ResourceName]kueuev1.ResourceQuota{}
+		for _, quota := range group.Flavors[i].Resources {
+			existing[quota.Name] = quota
+		}
+		resources := make([]kueuev1.ResourceQuota, 0, len(desired.Flavors[0].Resources))
+		for _, quota := range desired.Flavors[0].Resources {
+			if tuned, ok := existing[quota.Name]; ok {
+				quota = tuned
+			}
+			resources = append(resources, quota)
+		}
+		group.Flavors[i].Resources = resources
+	}
+	return append([]kueuev1.ResourceGroup{group}, current[1:]...), true
+}
+
 func ensureLocalQueue(ctx context.Context, kueueClient *kueueclientset.Clientset, namespace, serviceName, clusterQueueName, owner string) error {
 	lqName := BuildLocalQueueName(serviceName)
 	lq, err := kueueClient.KueueV1beta2().LocalQueues(namespace).Get(ctx, lqName, metav1.GetOptions{})
@@ -277,6 +328,39 @@ func DeleteKueueLocalQueue(ctx context.Context, cfg *types.Config, namespace, se
 	return err
 }
 
+// SetJobWorkloadActive activates or deactivates the Kueue Workload of a Job. Kueue keeps the Jobs of
+// inactive Workloads suspended and evicts them if they were admitted, so users can suspend and resume
+// queued Jobs without Kueue overriding their suspension. It is a no-op if the Job has no Workload yet.
+func SetJobWorkloadActive(ctx context.Context, namespace string, jobUID string, active bool) error {
+	restCfg, err := rest.InClusterConfig()
+	if err != nil {
+		return fmt.Errorf("unable to build in-cluster config for kueue: %w", err)
+	}
+
+	kueueClient, err := kueueclientset.NewForConfig(restCfg)
+	if err != nil {
+		return fmt.Errorf("unable to create kueue client: %w", err)
+	}
+
+	workloads, err := kueueClient.KueueV1beta2().Workloads(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", KueueJobUIDLabel, jobUID),
+	})
+	if err != nil {
+		return fmt.Errorf("listing the kueue Workloads of the job: %w", err)
+	}
+	for i := range workloads.Items {
+		workload := &workloads.Items[i]
+		if workload.Spec.Active != nil && *workload.Spec.Active == active {
+			continue
+		}
+		workload.Spec.Active = &active
+		if _, err := kueueClient.KueueV1beta2().Workloads(namespace).Update(ctx, workload, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("updating kueue Workload %s: %w", workload.Name, err)
+		}
+	}
+	return nil
+}
+
 func buildClusterQueueName(owner string) string {
 	return sanitizeKueueName(fmt.Sprintf("%s-%s", defaultKueueQueuePrefix, owner))
 }
@@ -507,12 +591,8 @@ func getServiceResourceRequests(service *types.Service, cfg *types.Config) (v1.R
 		requests[v1.ResourceEphemeralStorage] = parsedEphemeral
 	}
 
-	if service.EnableGPU {
-		gpu, err := resource.ParseQuantity("1")
-		if err != nil {
-			return nil, fmt.Errorf("invalid service GPU quantity: %w", err)
-		}
-		requests["nvidia.com/gpu"] = gpu
+	if name, quantity, ok := types.AcceleratorRequest(service.EnableGPU, service.Accelerators); ok {
+		requests[name] = quantity
 	}
 
 	if service.EnableSGX {
@@ -558,12 +638,8 @@ func getKserveResourceRequests(service *types.Service, cfg *types.Config) (v1.Re
 	requests[v1.ResourceCPU] = cpuQty
 	requests[v1.ResourceMemory] = memoryQty
 
-	if service.Kserve.EnableGPU {
-		gpu, err := resource.ParseQuantity("1")
-		if err != nil {
-			return nil, 0, false, fmt.Errorf("invalid KServe service GPU quantity: %w", err)
-		}
-		requests["nvidia.com/gpu"] = gpu
+	if name, quantity, ok := types.AcceleratorRequest(service.Kserve.EnableGPU, service.Kserve.Accelerators); ok {
+		requests[name] = quantity
 	}
 
 	var kserveMinScale int32 = 1
@@ -764,6 +840,88 @@ func VerifyWorkloadByResources(service types.Service, cfg *types.Config) bool {
 	return check && delete
 }
 
+// CheckWorkloadQuota checks, without creating any resource, that the ClusterQueue of the owner of the service has
+// quota for the resources requested by the service, so Kueue admits its workload once the quota used by the other
+// workloads of the owner is released. The default quotas are checked if the ClusterQueue is not created yet
+func CheckWorkloadQuota(ctx context.Context, service types.Service, cfg *types.Config) error {
+	if service.Expose.MinScale == 0 {
+		service.Expose.MinScale = 1
+	}
+	workload, err := getResourceOnlyWorkloadSpec(&service, cfg, service.Namespace, service.Name, BuildLocalQueueName(service.Name))
+	if err != nil {
+		return err
+	}
+
+	restCfg, err := rest.InClusterConfig()
+	if err != nil {
+		return fmt.Errorf("unable to build in-cluster config for kueue: %w", err)
+	}
+	kueueClient, err := kueueclientset.NewForConfig(restCfg)
+	if err != nil {
+		return fmt.Errorf("unable to create kueue client: %w", err)
+	}
+
+	var resourceGroups []kueuev1.ResourceGroup
+	clusterQueueName := buildClusterQueueName(service.Owner)
+	clusterQueue, err := kueueClient.KueueV1beta2().ClusterQueues().Get(ctx, clusterQueueName, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		coveredResources, resourceQuotas, err := defaultClusterQueueQuotas(cfg)
+		if err != nil {
+			return err
+		}
+		resourceGroups = []kueuev1.ResourceGroup{{
+			CoveredResources: coveredResources,
+			Flavors:          []kueuev1.FlavorQuotas{{Resources: resourceQuotas}},
+		}}
+	case err != nil:
+		return fmt.Errorf("unable to get ClusterQueue %q: %w", clusterQueueName, err)
+	default:
+		resourceGroups = clusterQueue.Spec.ResourceGroups
+	}
+	return checkWorkloadQuotas(workload.Spec.PodSets, resourceGroups)
+}
+
+// checkWorkloadQuotas checks that the resources requested by the pod sets of a workload are covered by the resource
+// groups of a ClusterQueue, and don't exceed their nominal quotas in all the flavors
+func checkWorkloadQuotas(podSets []kueuev1.PodSet, resourceGroups []kueuev1.ResourceGroup) error {
+	quotas := map[v1.ResourceName]resource.Quantity{}
+	for _, group := range resourceGroups {
+		for _, flavor := range group.Flavors {
+			for _, quota := range flavor.Resources {
+				total := quotas[quota.Name]
+				total.Add(quota.NominalQuota)
+				quotas[quota.Name] = total
+			}
+		}
+	}
+
+	requests := map[v1.ResourceName]resource.Quantity{}
+	for _, podSet := range podSets {
+		for _, container := range podSet.Template.Spec.Containers {
+			for name, quantity := range container.Resources.Requests {
+				quantity = quantity.DeepCopy()
+				quantity.Mul(int64(podSet.Count))
+				total := requests[name]
+				total.Add(quantity)
+				requests[name] = total
+			}
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(requests)) {
+		request := requests[name]
+		quota, ok := quotas[name]
+		if !ok {
+			return fmt.Errorf("the ClusterQueue has no quota of %s", name)
+		}
+		if request.Cmp(quota) > 0 {
+			return fmt.Errorf("the workload requests %s of %s, over the quota of %s", request.String(), name, quota.String())
+		}
+	}
+	return nil
+}
+
 func getPodTemplateSpec(service types.Service, namespace string, cfg *types.Config) v1.PodTemplateSpec {
 	resources, err := types.CreateResources(&service)
 	if err != nil {
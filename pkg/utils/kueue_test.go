@@ -3,6 +3,7 @@ package utils
 import (
 	"context"
 	"math"
+	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
@@ -211,6 +212,55 @@ func TestEnsureClusterQueue(t *testing.T) {
 	t.Skip("Skipping ensureClusterQueue test - requires kubernetes client setup")
 }
 
+func TestReconcileResourceGroups(t *testing.T) {
+	quotas := func(cpu, gpu string) []kueuev1.ResourceQuota {
+		resources := []kueuev1.ResourceQuota{{Name: v1.ResourceCPU, NominalQuota: resource.MustParse(cpu)}}
+		if gpu != "" {
+			resources = append(resources, kueuev1.ResourceQuota{Name: "nvidia.com/gpu", NominalQuota: resource.MustParse(gpu)})
+		}
+		return resources
+	}
+	group := func(resources []kueuev1.ResourceQuota) kueuev1.ResourceGroup {
+		covered := []v1.ResourceName{}
+		for _, quota := range resources {
+			covered = append(covered, quota.Name)
+		}
+		return kueuev1.ResourceGroup{
+			CoveredResources: covered,
+			Flavors:          []kueuev1.FlavorQuotas{{Name: "default-flavor", Resources: resources}},
+		}
+	}
+	desired := group(quotas("1", "1"))
+
+	// Missing quotas get the defaults
+	groups, changed := reconcileResourceGroups(nil, desired)
+	if !changed || !reflect.DeepEqual(groups, []kueuev1.ResourceGroup{desired}) {
+		t.Errorf("expected the default resource groups, got %+v", groups)
+	}
+
+	// Quotas tuned by the administrators are kept
+	tuned := []kueuev1.ResourceGroup{group(quotas("8", "2"))}
+	groups, changed = reconcileResourceGroups(tuned, desired)
+	if changed || !reflect.DeepEqual(groups, tuned) {
+		t.Errorf("expected the tuned resource groups to be kept, got %+v", groups)
+	}
+
+	// A new accelerator gets the default quota and the tuned quotas are kept
+	groups, changed = reconcileResourceGroups([]kueuev1.ResourceGroup{group(quotas("8", ""))}, desired)
+	if !changed || !reflect.DeepEqual(groups, []kueuev1.ResourceGroup{group(quotas("8", "1"))}) {
+		t.Errorf("expected the new accelerator to be added, got %+v", groups)
+	}
+
+	// Removed accelerators stop being covered
+	groups, changed = reconcileResourceGroups(tuned, group(quotas("1", "")))
+	if !changed || !reflect.DeepEqual(groups, []kueuev1.ResourceGroup{group(quotas("8", ""))}) {
+		t.Errorf("expected the removed accelerator to be dropped, got %+v", groups)
+	}
+	if len(tuned[0].Flavors[0].Resources) != 2 {
+		t.Errorf("the current resource groups must not be modified")
+	}
+}
+
 func TestEnsureLocalQueue(t *testing.T) {
 	t.Skip("Skipping ensureLocalQueue test - requires kubernetes client setup")
 }
@@ -581,6 +631,51 @@ func TestVerifyWorkloadByResources(t *testing.T) {
 	}
 }
 
+func TestCheckWorkloadQuotas(t *testing.T) {
+	podSet := func(count int32, cpu string, gpu string) kueuev1.PodSet {
+		requests := v1.ResourceList{v1.ResourceCPU: resource.MustParse(cpu)}
+		if gpu != "" {
+			requests["nvidia.com/gpu"] = resource.MustParse(gpu)
+		}
+		return buildResourceCheckPodSet("oscar-service", count, requests)
+	}
+	groups := []kueuev1.ResourceGroup{{
+		CoveredResources: []v1.ResourceName{v1.ResourceCPU},
+		Flavors: []kueuev1.FlavorQuotas{
+			{Name: "default-flavor", Resources: []kueuev1.ResourceQuota{{Name: v1.ResourceCPU, NominalQuota: resource.MustParse("2")}}},
+			{Name: "spot", Resources: []kueuev1.ResourceQuota{{Name: v1.ResourceCPU, NominalQuota: resource.MustParse("1")}}},
+		},
+	}}
+
+	tests := []struct {
+		name    string
+		podSets []kueuev1.PodSet
+		wantErr bool
+	}{
+		{"fits in the quota of all the flavors", []kueuev1.PodSet{podSet(1, "3", "")}, false},
+		{"replicas over the quota", []kueuev1.PodSet{podSet(2, "2", "")}, true},
+		{"pod sets over the quota", []kueuev1.PodSet{podSet(1, "2", ""), podSet(1, "1500m", "")}, true},
+		{"resource not covered", []kueuev1.PodSet{podSet(1, "1", "1")}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkWorkloadQuotas(tt.podSets, groups); (err != nil) != tt.wantErr {
+				t.Errorf("checkWorkloadQuotas() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckWorkloadQuota(t *testing.T) {
+	cfg := newTestConfig()
+	service := newTestService("test-service", "testuser")
+
+	// Should fail when not in-cluster (test environment)
+	if err := CheckWorkloadQuota(context.Background(), service, cfg); err == nil {
+		t.Error("Expected CheckWorkloadQuota() to fail in test environment")
+	}
+}
+
 func TestWorkloadIsAdmitted(t *testing.T) {
 	tests := []struct {
 		name string
@@ -813,6 +908,19 @@ func TestGetServiceResourceRequestsDecisionGraph(t *testing.T) {
 			wantGPUQty: "1",
 			wantSGX:    true,
 		},
+		{
+			name: "accelerators count takes precedence over enable_gpu",
+			service: func() *types.Service {
+				s := newTestService("svc-multi-gpu", "owner")
+				s.EnableGPU = true
+				s.Accelerators = &types.Accelerators{Count: 4}
+				return &s
+			}(),
+			wantCPU:    "500m",
+			wantMemory: "1Gi",
+			wantGPU:    true,
+			wantGPUQty: "4",
+		},
 	}
 
 	for _, tt := range tests {
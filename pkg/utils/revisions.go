@@ -0,0 +1,213 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/grycap/oscar/v4/pkg/types"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	revisionOperationKey      = "operation"
+	revisionSourceKey         = "source_revision"
+	revisionAuthorKey         = "author"
+	revisionCreatedAtKey      = "created_at"
+	revisionConfigMapTemplate = "%s.rev-%d"
+	// maxRevisionAttempts number of attempts to store a revision while concurrent updates take its number
+	maxRevisionAttempts = 5
+)
+
+// ServiceRevisionConfigMapName returns the name of the ConfigMap storing a service revision.
+// Service names are DNS-1035 labels, so the dot keeps it from colliding with the ConfigMap of a service
+func ServiceRevisionConfigMapName(serviceName string, revision int) string {
+	return fmt.Sprintf(revisionConfigMapTemplate, serviceName, revision)
+}
+
+// RecordServiceRevision stores an immutable snapshot of the service definition and prunes
+// the oldest revisions when the limit is exceeded (limit <= 0 keeps all of them).
+// The revision number is taken again if a concurrent update stored a revision with the same number.
+func RecordServiceRevision(ctx context.Context, kubeClientset kubernetes.Interface, service types.Service, namespace string, author string, operation string, sourceRevision int, limit int) (*types.ServiceRevision, error) {
+	script := service.Script
+	// Never persist the service token in the revision history
+	service.Script = ""
+	service.Token = ""
+	fdl, err := service.ToYAML()
+	if err != nil {
+		return nil, fmt.Errorf("marshalling revision of service %s: %w", service.Name, err)
+	}
+
+	for attempt := 1; ; attempt++ {
+		existing, err := listServiceRevisionConfigMaps(ctx, kubeClientset, namespace, service.Name)
+		if err != nil {
+			return nil, err
+		}
+		next := 1
+		if len(existing) > 0 {
+			next = revisionNumber(&existing[len(existing)-1]) + 1
+		}
+
+		immutable := true
+		createdAt := time.Now().UTC()
+		cm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      ServiceRevisionConfigMapName(service.Name, next),
+				Namespace: namespace,
+				Labels: map[string]string{
+					types.ServiceRevisionLabel:       service.Name,
+					types.ServiceRevisionNumberLabel: strconv.Itoa(next),
+				},
+				Annotations: map[string]string{
+					revisionOperationKey: operation,
+					revisionAuthorKey:    author,
+					revisionCreatedAtKey: createdAt.Format(time.RFC3339),
+				},
+			},
+			Immutable: &immutable,
+			Data: map[string]string{
+				types.FDLFileName:    fdl,
+				types.ScriptFileName: script,
+			},
+		}
+		if sourceRevision > 0 {
+			cm.Annotations[revisionSourceKey] = strconv.Itoa(sourceRevision)
+		}
+
+		created, err := kubeClientset.CoreV1().ConfigMaps(namespace).Create(ctx, cm, metav1.CreateOptions{})
+		if apierrors.IsAlreadyExists(err) && attempt < maxRevisionAttempts {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("creating revision %d of service %s: %w", next, service.Name, err)
+		}
+
+		if limit > 0 && len(existing)+1 > limit {
+			for _, old := range existing[:len(existing)+1-limit] {
+				if err := kubeClientset.CoreV1().ConfigMaps(namespace).Delete(ctx, old.Name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+					return nil, fmt.Errorf("pruning revision %s: %w", old.Name, err)
+				}
+			}
+		}
+
+		return revisionFromConfigMap(created, true), nil
+	}
+}
+
+// ListServiceRevisions returns the stored revisions of a service sorted by revision number, without FDL and script
+func ListServiceRevisions(ctx context.Context, kubeClientset kubernetes.Interface, namespace string, serviceName string) ([]types.ServiceRevision, error) {
+	cms, err := listServiceRevisionConfigMaps(ctx, kubeClientset, namespace, serviceName)
+	if err != nil {
+		return nil, err
+	}
+	revisions := make([]types.ServiceRevision, 0, len(cms))
+	for i := range cms {
+		revisions = append(revisions, *revisionFromConfigMap(&cms[i], false))
+	}
+	return revisions, nil
+}
+
+// GetServiceRevision returns a stored revision of a service including its FDL and script
+// The ConfigMap is selected by its labels, so the revisions stored with previous naming schemes are found too
+func GetServiceRevision(ctx context.Context, kubeClientset kubernetes.Interface, namespace string, serviceName string, revision int) (*types.ServiceRevision, error) {
+	list, err := kubeClientset.CoreV1().ConfigMaps(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s,%s=%d", types.ServiceRevisionLabel, serviceName, types.ServiceRevisionNumberLabel, revision),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(list.Items) == 0 {
+		return nil, apierrors.NewNotFound(schema.GroupResource{Resource: "revisions"}, ServiceRevisionConfigMapName(serviceName, revision))
+	}
+	return revisionFromConfigMap(&list.Items[0], true), nil
+}
+
+// DeleteServiceRevisions removes all the stored revisions of a service
+func DeleteServiceRevisions(ctx context.Context, kubeClientset kubernetes.Interface, namespace string, serviceName string) error {
+	return kubeClientset.CoreV1().ConfigMaps(namespace).DeleteCollection(ctx, metav1.DeleteOptions{}, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", types.ServiceRevisionLabel, serviceName),
+	})
+}
+
+// ServiceFromRevision rebuilds the service definition stored in a revision
+func ServiceFromRevision(revision *types.ServiceRevision) (*types.Service, error) {
+	service := &types.Service{}
+	if err := yaml.Unmarshal([]byte(revision.FDL), service); err != nil {
+		return nil, fmt.Errorf("the FDL of revision %d of service %s cannot be read: %w", revision.Revision, revision.ServiceName, err)
+	}
+	service.Script = revision.Script
+	return service, nil
+}
+
+func listServiceRevisionConfigMaps(ctx context.Context, kubeClientset kubernetes.Interface, namespace string, serviceName string) ([]corev1.ConfigMap, error) {
+	list, err := kubeClientset.CoreV1().ConfigMaps(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", types.ServiceRevisionLabel, serviceName),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing revisions of service %s: %w", serviceName, err)
+	}
+	items := list.Items
+	sort.Slice(items, func(i, j int) bool {
+		return revisionNumber(&items[i]) < revisionNumber(&items[j])
+	})
+	return items, nil
+}
+
+func revisionNumber(cm *corev1.ConfigMap) int {
+	n, _ := strconv.Atoi(cm.Labels[types.ServiceRevisionNumberLabel])
+	return n
+}
+
+func revisionFromConfigMap(cm *corev1.ConfigMap, withDefinition bool) *types.ServiceRevision {
+	revision := &types.ServiceRevision{
+		Revision:    revisionNumber(cm),
+		ServiceName: cm.Labels[types.ServiceRevisionLabel],
+		Namespace:   cm.Namespace,
+		Operation:   cm.Annotations[revisionOperationKey],
+		Author:      cm.Annotations[revisionAuthorKey],
+	}
+	if source, err := strconv.Atoi(cm.Annotations[revisionSourceKey]); err == nil {
+		revision.SourceRevision = source
+	}
+	if createdAt, err := time.Parse(time.RFC3339, cm.Annotations[revisionCreatedAtKey]); err == nil {
+		revision.CreatedAt = metav1.NewTime(createdAt)
+	} else {
+		revision.CreatedAt = cm.CreationTimestamp
+	}
+
+	service := &types.Service{}
+	if err := yaml.Unmarshal([]byte(cm.Data[types.FDLFileName]), service); err == nil {
+		revision.Image = service.Image
+		revision.CPU = service.CPU
+		revision.Memory = service.Memory
+		revision.EnableGPU = service.EnableGPU
+	}
+	if withDefinition {
+		revision.FDL = cm.Data[types.FDLFileName]
+		revision.Script = cm.Data[types.ScriptFileName]
+	}
+	return revision
+}
@@ -0,0 +1,186 @@
+/*
+Copyright (C) GRyCAP - I3M - UPV
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/grycap/oscar/v4/pkg/types"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	testclient "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestRecordServiceRevision(t *testing.T) {
+	ctx := context.Background()
+	kubeClientset := testclient.NewSimpleClientset()
+	service := types.Service{
+		Name:   "svc",
+		Image:  "ghcr.io/grycap/cowsay:v1",
+		CPU:    "1",
+		Memory: "1Gi",
+		Token:  "secret-token",
+		Script: "echo v1",
+	}
+
+	first, err := RecordServiceRevision(ctx, kubeClientset, service, "ns", "user1", types.RevisionOperationCreate, 0, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if first.Revision != 1 || first.Author != "user1" || first.Operation != types.RevisionOperationCreate {
+		t.Fatalf("unexpected first revision: %+v", first)
+	}
+	if strings.Contains(first.FDL, "secret-token") {
+		t.Fatal("expected the service token to be removed from the stored FDL")
+	}
+	if first.Script != "echo v1" {
+		t.Fatalf("expected script to be stored, got %q", first.Script)
+	}
+
+	service.Image = "ghcr.io/grycap/cowsay:v2"
+	second, err := RecordServiceRevision(ctx, kubeClientset, service, "ns", "user1", types.RevisionOperationUpdate, 0, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if second.Revision != 2 || second.Image != "ghcr.io/grycap/cowsay:v2" {
+		t.Fatalf("unexpected second revision: %+v", second)
+	}
+
+	cm, err := kubeClientset.CoreV1().ConfigMaps("ns").Get(ctx, "svc.rev-2", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected revision ConfigMap: %v", err)
+	}
+	if cm.Immutable == nil || !*cm.Immutable {
+		t.Fatal("expected revision ConfigMap to be immutable")
+	}
+	if _, ok := cm.Labels[types.ServiceLabel]; ok {
+		t.Fatal("revision ConfigMaps must not carry the service label")
+	}
+
+	revisions, err := ListServiceRevisions(ctx, kubeClientset, "ns", "svc")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(revisions) != 2 || revisions[0].Revision != 1 || revisions[1].Revision != 2 {
+		t.Fatalf("unexpected revisions: %+v", revisions)
+	}
+	if revisions[0].FDL != "" || revisions[0].Script != "" {
+		t.Fatal("expected listed revisions without definition")
+	}
+	if revisions[0].Image != "ghcr.io/grycap/cowsay:v1" {
+		t.Fatalf("expected image of the first revision, got %q", revisions[0].Image)
+	}
+}
+
+func TestRecordServiceRevisionPrunesOldest(t *testing.T) {
+	ctx := context.Background()
+	kubeClientset := testclient.NewSimpleClientset()
+	service := types.Service{Name: "svc", Image: "image"}
+
+	for i := 0; i < 4; i++ {
+		if _, err := RecordServiceRevision(ctx, kubeClientset, service, "ns", "", types.RevisionOperationUpdate, 0, 2); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	revisions, err := ListServiceRevisions(ctx, kubeClientset, "ns", "svc")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(revisions) != 2 || revisions[0].Revision != 3 || revisions[1].Revision != 4 {
+		t.Fatalf("expected revisions 3 and 4, got %+v", revisions)
+	}
+}
+
+func TestRecordServiceRevisionConcurrentUpdate(t *testing.T) {
+	ctx := context.Background()
+	kubeClientset := testclient.NewSimpleClientset()
+	service := types.Service{Name: "svc", Image: "image"}
+
+	// A concurrent update stores its revision between the List and the Create
+	raced := false
+	kubeClientset.PrependReactor("create", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if !raced {
+			raced = true
+			concurrent := action.(k8stesting.CreateAction).GetObject().(*corev1.ConfigMap).DeepCopy()
+			concurrent.Annotations[revisionAuthorKey] = "user2"
+			_ = kubeClientset.Tracker().Add(concurrent)
+		}
+		return false, nil, nil
+	})
+
+	revision, err := RecordServiceRevision(ctx, kubeClientset, service, "ns", "user1", types.RevisionOperationUpdate, 0, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if revision.Revision != 2 || revision.Author != "user1" {
+		t.Fatalf("expected the revision to be stored as revision 2, got %+v", revision)
+	}
+	revisions, _ := ListServiceRevisions(ctx, kubeClientset, "ns", "svc")
+	if len(revisions) != 2 || revisions[0].Author != "user2" {
+		t.Fatalf("expected the revisions of both updates, got %+v", revisions)
+	}
+}
+
+func TestGetServiceRevisionAndRestore(t *testing.T) {
+	ctx := context.Background()
+	kubeClientset := testclient.NewSimpleClientset()
+	service := types.Service{Name: "svc", Image: "image", Memory: "512Mi", Script: "echo hi"}
+
+	if _, err := RecordServiceRevision(ctx, kubeClientset, service, "ns", "", types.RevisionOperationCreate, 0, 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	revision, err := GetServiceRevision(ctx, kubeClientset, "ns", "svc", 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	restored, err := ServiceFromRevision(revision)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if restored.Name != "svc" || restored.Memory != "512Mi" || restored.Script != "echo hi" {
+		t.Fatalf("unexpected restored service: %+v", restored)
+	}
+
+	if _, err := GetServiceRevision(ctx, kubeClientset, "ns", "svc", 7); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+}
+
+func TestServiceRevisionDoesNotCollideWithServiceConfigMap(t *testing.T) {
+	ctx := context.Background()
+	// ConfigMap of a service called "svc-rev-1"
+	kubeClientset := testclient.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "svc-rev-1", Namespace: "ns"},
+	})
+
+	if _, err := RecordServiceRevision(ctx, kubeClientset, types.Service{Name: "svc", Image: "image"}, "ns", "", types.RevisionOperationCreate, 0, 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := kubeClientset.CoreV1().ConfigMaps("ns").Get(ctx, "svc-rev-1", metav1.GetOptions{}); err != nil {
+		t.Fatalf("expected the service ConfigMap to be kept: %v", err)
+	}
+	if _, err := GetServiceRevision(ctx, kubeClientset, "ns", "svc", 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}